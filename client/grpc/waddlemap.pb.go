@@ -0,0 +1,227 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v6.33.2
+// source: proto/waddlemap.proto
+
+package waddlegrpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+	proto "waddlemap/proto"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CreateCollectionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateCollectionResponse) Reset() {
+	*x = CreateCollectionResponse{}
+	mi := &file_proto_waddlemap_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateCollectionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateCollectionResponse) ProtoMessage() {}
+
+func (x *CreateCollectionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddlemap_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateCollectionResponse.ProtoReflect.Descriptor instead.
+func (*CreateCollectionResponse) Descriptor() ([]byte, []int) {
+	return file_proto_waddlemap_proto_rawDescGZIP(), []int{0}
+}
+
+type AppendBlockResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         uint32                 `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"` // Index of the appended block within its key
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AppendBlockResponse) Reset() {
+	*x = AppendBlockResponse{}
+	mi := &file_proto_waddlemap_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AppendBlockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AppendBlockResponse) ProtoMessage() {}
+
+func (x *AppendBlockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddlemap_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AppendBlockResponse.ProtoReflect.Descriptor instead.
+func (*AppendBlockResponse) Descriptor() ([]byte, []int) {
+	return file_proto_waddlemap_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AppendBlockResponse) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+type DeleteKeyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteKeyResponse) Reset() {
+	*x = DeleteKeyResponse{}
+	mi := &file_proto_waddlemap_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteKeyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteKeyResponse) ProtoMessage() {}
+
+func (x *DeleteKeyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddlemap_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteKeyResponse.ProtoReflect.Descriptor instead.
+func (*DeleteKeyResponse) Descriptor() ([]byte, []int) {
+	return file_proto_waddlemap_proto_rawDescGZIP(), []int{2}
+}
+
+var File_proto_waddlemap_proto protoreflect.FileDescriptor
+
+const file_proto_waddlemap_proto_rawDesc = "" +
+	"\n" +
+	"\x15proto/waddlemap.proto\x12\twaddlemap\x1a\x1bproto/waddle_protocol.proto\"\x1a\n" +
+	"\x18CreateCollectionResponse\"+\n" +
+	"\x13AppendBlockResponse\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\rR\x05index\"\x13\n" +
+	"\x11DeleteKeyResponse2\xc3\x03\n" +
+	"\tWaddleMap\x12[\n" +
+	"\x10CreateCollection\x12\".waddlemap.CreateCollectionRequest\x1a#.waddlemap.CreateCollectionResponse\x12L\n" +
+	"\vAppendBlock\x12\x1d.waddlemap.AppendBlockRequest\x1a\x1e.waddlemap.AppendBlockResponse\x12<\n" +
+	"\bGetBlock\x12\x1a.waddlemap.GetBlockRequest\x1a\x14.waddlemap.BlockData\x12?\n" +
+	"\x06Search\x12\x18.waddlemap.SearchRequest\x1a\x1b.waddlemap.SearchResultList\x12D\n" +
+	"\rKeywordSearch\x12\x1f.waddlemap.KeywordSearchRequest\x1a\x12.waddlemap.KeyList\x12F\n" +
+	"\tDeleteKey\x12\x1b.waddlemap.DeleteKeyRequest\x1a\x1c.waddlemap.DeleteKeyResponseB\"Z waddlemap/client/grpc;waddlegrpcb\x06proto3"
+
+var (
+	file_proto_waddlemap_proto_rawDescOnce sync.Once
+	file_proto_waddlemap_proto_rawDescData []byte
+)
+
+func file_proto_waddlemap_proto_rawDescGZIP() []byte {
+	file_proto_waddlemap_proto_rawDescOnce.Do(func() {
+		file_proto_waddlemap_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_waddlemap_proto_rawDesc), len(file_proto_waddlemap_proto_rawDesc)))
+	})
+	return file_proto_waddlemap_proto_rawDescData
+}
+
+var file_proto_waddlemap_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_proto_waddlemap_proto_goTypes = []any{
+	(*CreateCollectionResponse)(nil),      // 0: waddlemap.CreateCollectionResponse
+	(*AppendBlockResponse)(nil),           // 1: waddlemap.AppendBlockResponse
+	(*DeleteKeyResponse)(nil),             // 2: waddlemap.DeleteKeyResponse
+	(*proto.CreateCollectionRequest)(nil), // 3: waddlemap.CreateCollectionRequest
+	(*proto.AppendBlockRequest)(nil),      // 4: waddlemap.AppendBlockRequest
+	(*proto.GetBlockRequest)(nil),         // 5: waddlemap.GetBlockRequest
+	(*proto.SearchRequest)(nil),           // 6: waddlemap.SearchRequest
+	(*proto.KeywordSearchRequest)(nil),    // 7: waddlemap.KeywordSearchRequest
+	(*proto.DeleteKeyRequest)(nil),        // 8: waddlemap.DeleteKeyRequest
+	(*proto.BlockData)(nil),               // 9: waddlemap.BlockData
+	(*proto.SearchResultList)(nil),        // 10: waddlemap.SearchResultList
+	(*proto.KeyList)(nil),                 // 11: waddlemap.KeyList
+}
+var file_proto_waddlemap_proto_depIdxs = []int32{
+	3,  // 0: waddlemap.WaddleMap.CreateCollection:input_type -> waddlemap.CreateCollectionRequest
+	4,  // 1: waddlemap.WaddleMap.AppendBlock:input_type -> waddlemap.AppendBlockRequest
+	5,  // 2: waddlemap.WaddleMap.GetBlock:input_type -> waddlemap.GetBlockRequest
+	6,  // 3: waddlemap.WaddleMap.Search:input_type -> waddlemap.SearchRequest
+	7,  // 4: waddlemap.WaddleMap.KeywordSearch:input_type -> waddlemap.KeywordSearchRequest
+	8,  // 5: waddlemap.WaddleMap.DeleteKey:input_type -> waddlemap.DeleteKeyRequest
+	0,  // 6: waddlemap.WaddleMap.CreateCollection:output_type -> waddlemap.CreateCollectionResponse
+	1,  // 7: waddlemap.WaddleMap.AppendBlock:output_type -> waddlemap.AppendBlockResponse
+	9,  // 8: waddlemap.WaddleMap.GetBlock:output_type -> waddlemap.BlockData
+	10, // 9: waddlemap.WaddleMap.Search:output_type -> waddlemap.SearchResultList
+	11, // 10: waddlemap.WaddleMap.KeywordSearch:output_type -> waddlemap.KeyList
+	2,  // 11: waddlemap.WaddleMap.DeleteKey:output_type -> waddlemap.DeleteKeyResponse
+	6,  // [6:12] is the sub-list for method output_type
+	0,  // [0:6] is the sub-list for method input_type
+	0,  // [0:0] is the sub-list for extension type_name
+	0,  // [0:0] is the sub-list for extension extendee
+	0,  // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_proto_waddlemap_proto_init() }
+func file_proto_waddlemap_proto_init() {
+	if File_proto_waddlemap_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_waddlemap_proto_rawDesc), len(file_proto_waddlemap_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_waddlemap_proto_goTypes,
+		DependencyIndexes: file_proto_waddlemap_proto_depIdxs,
+		MessageInfos:      file_proto_waddlemap_proto_msgTypes,
+	}.Build()
+	File_proto_waddlemap_proto = out.File
+	file_proto_waddlemap_proto_goTypes = nil
+	file_proto_waddlemap_proto_depIdxs = nil
+}
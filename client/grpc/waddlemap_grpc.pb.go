@@ -0,0 +1,320 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v6.33.2
+// source: proto/waddlemap.proto
+
+package waddlegrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	proto "waddlemap/proto"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	WaddleMap_CreateCollection_FullMethodName = "/waddlemap.WaddleMap/CreateCollection"
+	WaddleMap_AppendBlock_FullMethodName      = "/waddlemap.WaddleMap/AppendBlock"
+	WaddleMap_GetBlock_FullMethodName         = "/waddlemap.WaddleMap/GetBlock"
+	WaddleMap_Search_FullMethodName           = "/waddlemap.WaddleMap/Search"
+	WaddleMap_KeywordSearch_FullMethodName    = "/waddlemap.WaddleMap/KeywordSearch"
+	WaddleMap_DeleteKey_FullMethodName        = "/waddlemap.WaddleMap/DeleteKey"
+)
+
+// WaddleMapClient is the client API for WaddleMap service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// WaddleMap exposes the core operations over gRPC, as an alternative to the
+// length-prefixed protocol of waddle_protocol.proto. Errors are returned as
+// gRPC status codes rather than in the response messages.
+type WaddleMapClient interface {
+	CreateCollection(ctx context.Context, in *proto.CreateCollectionRequest, opts ...grpc.CallOption) (*CreateCollectionResponse, error)
+	AppendBlock(ctx context.Context, in *proto.AppendBlockRequest, opts ...grpc.CallOption) (*AppendBlockResponse, error)
+	GetBlock(ctx context.Context, in *proto.GetBlockRequest, opts ...grpc.CallOption) (*proto.BlockData, error)
+	Search(ctx context.Context, in *proto.SearchRequest, opts ...grpc.CallOption) (*proto.SearchResultList, error)
+	KeywordSearch(ctx context.Context, in *proto.KeywordSearchRequest, opts ...grpc.CallOption) (*proto.KeyList, error)
+	DeleteKey(ctx context.Context, in *proto.DeleteKeyRequest, opts ...grpc.CallOption) (*DeleteKeyResponse, error)
+}
+
+type waddleMapClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWaddleMapClient(cc grpc.ClientConnInterface) WaddleMapClient {
+	return &waddleMapClient{cc}
+}
+
+func (c *waddleMapClient) CreateCollection(ctx context.Context, in *proto.CreateCollectionRequest, opts ...grpc.CallOption) (*CreateCollectionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateCollectionResponse)
+	err := c.cc.Invoke(ctx, WaddleMap_CreateCollection_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *waddleMapClient) AppendBlock(ctx context.Context, in *proto.AppendBlockRequest, opts ...grpc.CallOption) (*AppendBlockResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AppendBlockResponse)
+	err := c.cc.Invoke(ctx, WaddleMap_AppendBlock_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *waddleMapClient) GetBlock(ctx context.Context, in *proto.GetBlockRequest, opts ...grpc.CallOption) (*proto.BlockData, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(proto.BlockData)
+	err := c.cc.Invoke(ctx, WaddleMap_GetBlock_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *waddleMapClient) Search(ctx context.Context, in *proto.SearchRequest, opts ...grpc.CallOption) (*proto.SearchResultList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(proto.SearchResultList)
+	err := c.cc.Invoke(ctx, WaddleMap_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *waddleMapClient) KeywordSearch(ctx context.Context, in *proto.KeywordSearchRequest, opts ...grpc.CallOption) (*proto.KeyList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(proto.KeyList)
+	err := c.cc.Invoke(ctx, WaddleMap_KeywordSearch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *waddleMapClient) DeleteKey(ctx context.Context, in *proto.DeleteKeyRequest, opts ...grpc.CallOption) (*DeleteKeyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteKeyResponse)
+	err := c.cc.Invoke(ctx, WaddleMap_DeleteKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WaddleMapServer is the server API for WaddleMap service.
+// All implementations must embed UnimplementedWaddleMapServer
+// for forward compatibility.
+//
+// WaddleMap exposes the core operations over gRPC, as an alternative to the
+// length-prefixed protocol of waddle_protocol.proto. Errors are returned as
+// gRPC status codes rather than in the response messages.
+type WaddleMapServer interface {
+	CreateCollection(context.Context, *proto.CreateCollectionRequest) (*CreateCollectionResponse, error)
+	AppendBlock(context.Context, *proto.AppendBlockRequest) (*AppendBlockResponse, error)
+	GetBlock(context.Context, *proto.GetBlockRequest) (*proto.BlockData, error)
+	Search(context.Context, *proto.SearchRequest) (*proto.SearchResultList, error)
+	KeywordSearch(context.Context, *proto.KeywordSearchRequest) (*proto.KeyList, error)
+	DeleteKey(context.Context, *proto.DeleteKeyRequest) (*DeleteKeyResponse, error)
+	mustEmbedUnimplementedWaddleMapServer()
+}
+
+// UnimplementedWaddleMapServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedWaddleMapServer struct{}
+
+func (UnimplementedWaddleMapServer) CreateCollection(context.Context, *proto.CreateCollectionRequest) (*CreateCollectionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateCollection not implemented")
+}
+func (UnimplementedWaddleMapServer) AppendBlock(context.Context, *proto.AppendBlockRequest) (*AppendBlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AppendBlock not implemented")
+}
+func (UnimplementedWaddleMapServer) GetBlock(context.Context, *proto.GetBlockRequest) (*proto.BlockData, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlock not implemented")
+}
+func (UnimplementedWaddleMapServer) Search(context.Context, *proto.SearchRequest) (*proto.SearchResultList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedWaddleMapServer) KeywordSearch(context.Context, *proto.KeywordSearchRequest) (*proto.KeyList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method KeywordSearch not implemented")
+}
+func (UnimplementedWaddleMapServer) DeleteKey(context.Context, *proto.DeleteKeyRequest) (*DeleteKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteKey not implemented")
+}
+func (UnimplementedWaddleMapServer) mustEmbedUnimplementedWaddleMapServer() {}
+func (UnimplementedWaddleMapServer) testEmbeddedByValue()                   {}
+
+// UnsafeWaddleMapServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WaddleMapServer will
+// result in compilation errors.
+type UnsafeWaddleMapServer interface {
+	mustEmbedUnimplementedWaddleMapServer()
+}
+
+func RegisterWaddleMapServer(s grpc.ServiceRegistrar, srv WaddleMapServer) {
+	// If the following call pancis, it indicates UnimplementedWaddleMapServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&WaddleMap_ServiceDesc, srv)
+}
+
+func _WaddleMap_CreateCollection_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.CreateCollectionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WaddleMapServer).CreateCollection(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WaddleMap_CreateCollection_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WaddleMapServer).CreateCollection(ctx, req.(*proto.CreateCollectionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WaddleMap_AppendBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.AppendBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WaddleMapServer).AppendBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WaddleMap_AppendBlock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WaddleMapServer).AppendBlock(ctx, req.(*proto.AppendBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WaddleMap_GetBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.GetBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WaddleMapServer).GetBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WaddleMap_GetBlock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WaddleMapServer).GetBlock(ctx, req.(*proto.GetBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WaddleMap_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WaddleMapServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WaddleMap_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WaddleMapServer).Search(ctx, req.(*proto.SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WaddleMap_KeywordSearch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.KeywordSearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WaddleMapServer).KeywordSearch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WaddleMap_KeywordSearch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WaddleMapServer).KeywordSearch(ctx, req.(*proto.KeywordSearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WaddleMap_DeleteKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(proto.DeleteKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WaddleMapServer).DeleteKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WaddleMap_DeleteKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WaddleMapServer).DeleteKey(ctx, req.(*proto.DeleteKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// WaddleMap_ServiceDesc is the grpc.ServiceDesc for WaddleMap service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WaddleMap_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "waddlemap.WaddleMap",
+	HandlerType: (*WaddleMapServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateCollection",
+			Handler:    _WaddleMap_CreateCollection_Handler,
+		},
+		{
+			MethodName: "AppendBlock",
+			Handler:    _WaddleMap_AppendBlock_Handler,
+		},
+		{
+			MethodName: "GetBlock",
+			Handler:    _WaddleMap_GetBlock_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _WaddleMap_Search_Handler,
+		},
+		{
+			MethodName: "KeywordSearch",
+			Handler:    _WaddleMap_KeywordSearch_Handler,
+		},
+		{
+			MethodName: "DeleteKey",
+			Handler:    _WaddleMap_DeleteKey_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/waddlemap.proto",
+}
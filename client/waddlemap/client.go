@@ -0,0 +1,267 @@
+// Package waddlemap is a Go client for the WaddleMap TCP protocol that spreads
+// concurrent requests over a pool of connections.
+package waddlemap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "waddlemap/proto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Defaults for the zero values of Options.
+const (
+	DefaultPoolSize          = 8
+	DefaultDialTimeout       = 5 * time.Second
+	DefaultReconnectAttempts = 5
+	DefaultInitialBackoff    = 50 * time.Millisecond
+	DefaultMaxBackoff        = 2 * time.Second
+)
+
+// ErrClosed is returned by requests made after Close.
+var ErrClosed = errors.New("waddlemap: client closed")
+
+// Options configures a Client. Zero fields take the Default* values.
+type Options struct {
+	PoolSize          int           // Maximum number of connections
+	DialTimeout       time.Duration // Timeout of a single connection attempt
+	ReconnectAttempts int           // Connection attempts before a request fails
+	InitialBackoff    time.Duration // Wait after the first failed attempt, doubled after each
+	MaxBackoff        time.Duration // Upper bound of the wait between attempts
+	TenantToken       string        // Sent with every request, for servers that require tenant tokens
+}
+
+// Client sends requests over a pool of TCP connections. Each request holds one
+// connection for its round trip, so up to PoolSize requests are in flight at
+// once and further requests wait for a free connection. Connections are
+// opened on first use; one that fails is dropped and reopened, with
+// exponential backoff, by the next request that needs it. A Client is safe
+// for concurrent use.
+type Client struct {
+	addr string
+	opts Options
+
+	// slots holds one entry per pool slot: an open connection, or nil for a
+	// slot that has to dial before use.
+	slots  chan *poolConn
+	nextID atomic.Uint64
+
+	mu       sync.RWMutex // Held for reading by in-flight requests
+	closed   bool
+	inFlight sync.WaitGroup
+}
+
+// poolConn is a connection of the pool.
+type poolConn struct {
+	conn   net.Conn
+	lenBuf [4]byte
+}
+
+// Dial creates a client for the server at addr (host:port) and checks that it
+// is reachable. Nil opts uses the defaults.
+func Dial(addr string, opts *Options) (*Client, error) {
+	c := &Client{addr: addr}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.PoolSize <= 0 {
+		c.opts.PoolSize = DefaultPoolSize
+	}
+	if c.opts.DialTimeout <= 0 {
+		c.opts.DialTimeout = DefaultDialTimeout
+	}
+	if c.opts.ReconnectAttempts <= 0 {
+		c.opts.ReconnectAttempts = DefaultReconnectAttempts
+	}
+	if c.opts.InitialBackoff <= 0 {
+		c.opts.InitialBackoff = DefaultInitialBackoff
+	}
+	if c.opts.MaxBackoff <= 0 {
+		c.opts.MaxBackoff = DefaultMaxBackoff
+	}
+
+	first, err := net.DialTimeout("tcp", addr, c.opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c.slots = make(chan *poolConn, c.opts.PoolSize)
+	c.slots <- &poolConn{conn: first}
+	for i := 1; i < c.opts.PoolSize; i++ {
+		c.slots <- nil
+	}
+	return c, nil
+}
+
+// Close waits for in-flight requests to finish and closes every connection.
+// Requests made after Close fail with ErrClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.inFlight.Wait()
+	var errs []error
+	for range c.opts.PoolSize {
+		if pc := <-c.slots; pc != nil {
+			if err := pc.conn.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CreateCollection creates a collection.
+func (c *Client) CreateCollection(name string, dimensions uint32, metric string) error {
+	_, err := c.do(&pb.WaddleRequest{Operation: &pb.WaddleRequest_CreateCol{
+		CreateCol: &pb.CreateCollectionRequest{Name: name, Dimensions: dimensions, Metric: metric},
+	}}, false)
+	return err
+}
+
+// AppendBlock appends a block to key.
+func (c *Client) AppendBlock(collection, key string, block *pb.BlockData) error {
+	_, err := c.do(&pb.WaddleRequest{Operation: &pb.WaddleRequest_AppendBlock{
+		AppendBlock: &pb.AppendBlockRequest{Collection: collection, Key: key, Block: block},
+	}}, false)
+	return err
+}
+
+// GetBlock returns the block at index of key.
+func (c *Client) GetBlock(collection, key string, index uint32) (*pb.BlockData, error) {
+	resp, err := c.do(&pb.WaddleRequest{Operation: &pb.WaddleRequest_GetBlock{
+		GetBlock: &pb.GetBlockRequest{Collection: collection, Key: key, Index: index},
+	}}, true)
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetBlock(), nil
+}
+
+// Search returns the nearest blocks to req.Query.
+func (c *Client) Search(req *pb.SearchRequest) ([]*pb.SearchResultItem, error) {
+	resp, err := c.do(&pb.WaddleRequest{Operation: &pb.WaddleRequest_Search{Search: req}}, true)
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetSearchList().GetResults(), nil
+}
+
+// DeleteKey deletes key and all its blocks.
+func (c *Client) DeleteKey(collection, key string) error {
+	_, err := c.do(&pb.WaddleRequest{Operation: &pb.WaddleRequest_DeleteKey{
+		DeleteKey: &pb.DeleteKeyRequest{Collection: collection, Key: key},
+	}}, false)
+	return err
+}
+
+// do sends req on a pooled connection and returns the server's response. A
+// request whose connection breaks is retried on a new connection only if it
+// is idempotent, since the server may already have applied it.
+func (c *Client) do(req *pb.WaddleRequest, idempotent bool) (*pb.WaddleResponse, error) {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	c.inFlight.Add(1)
+	c.mu.RUnlock()
+	defer c.inFlight.Done()
+
+	req.RequestId = strconv.FormatUint(c.nextID.Add(1), 10)
+	req.TenantToken = c.opts.TenantToken
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		pc := <-c.slots
+		if pc == nil {
+			if pc, err = c.connect(); err != nil {
+				c.slots <- nil
+				return nil, err
+			}
+		}
+
+		resp, err := pc.roundTrip(data, req.RequestId)
+		if err != nil {
+			// The connection state is unknown after a failed round trip
+			pc.conn.Close()
+			c.slots <- nil
+			if idempotent && attempt == 0 {
+				continue
+			}
+			return nil, err
+		}
+		c.slots <- pc
+
+		if !resp.Success {
+			return nil, fmt.Errorf("server error: %s", resp.ErrorMessage)
+		}
+		return resp, nil
+	}
+}
+
+// connect dials the server, retrying with exponential backoff.
+func (c *Client) connect() (*poolConn, error) {
+	backoff := c.opts.InitialBackoff
+	var err error
+	for attempt := 0; attempt < c.opts.ReconnectAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff = min(backoff*2, c.opts.MaxBackoff)
+		}
+		var conn net.Conn
+		if conn, err = net.DialTimeout("tcp", c.addr, c.opts.DialTimeout); err == nil {
+			return &poolConn{conn: conn}, nil
+		}
+	}
+	return nil, fmt.Errorf("connect to %s failed after %d attempts: %w", c.addr, c.opts.ReconnectAttempts, err)
+}
+
+// roundTrip writes a length-prefixed request and reads frames until its
+// response arrives. Subscription events are never requested on pooled
+// connections, but are skipped if they arrive.
+func (pc *poolConn) roundTrip(data []byte, requestID string) (*pb.WaddleResponse, error) {
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	if _, err := pc.conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, err := io.ReadFull(pc.conn, pc.lenBuf[:]); err != nil {
+			return nil, err
+		}
+		body := make([]byte, binary.BigEndian.Uint32(pc.lenBuf[:]))
+		if _, err := io.ReadFull(pc.conn, body); err != nil {
+			return nil, err
+		}
+		resp := &pb.WaddleResponse{}
+		if err := proto.Unmarshal(body, resp); err != nil {
+			return nil, err
+		}
+		if resp.GetEvent() != nil {
+			continue
+		}
+		if resp.RequestId != requestID {
+			return nil, fmt.Errorf("response for request %s, expected %s", resp.RequestId, requestID)
+		}
+		return resp, nil
+	}
+}
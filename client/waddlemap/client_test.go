@@ -0,0 +1,230 @@
+package waddlemap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	pb "waddlemap/proto"
+)
+
+var (
+	serverBin     string
+	serverBinErr  error
+	serverBinOnce sync.Once
+	serverBinDir  string
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if serverBinDir != "" {
+		os.RemoveAll(serverBinDir)
+	}
+	os.Exit(code)
+}
+
+// buildServer compiles cmd/server once per test run.
+func buildServer(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds and runs the server")
+	}
+	serverBinOnce.Do(func() {
+		if serverBinDir, serverBinErr = os.MkdirTemp("", "waddlemap-client-test"); serverBinErr != nil {
+			return
+		}
+		serverBin = filepath.Join(serverBinDir, "waddle-server")
+		out, err := exec.Command("go", "build", "-o", serverBin, "waddlemap/cmd/server").CombinedOutput()
+		if err != nil {
+			serverBinErr = fmt.Errorf("%v: %s", err, out)
+		}
+	})
+	if serverBinErr != nil {
+		t.Fatalf("Failed to build server: %v", serverBinErr)
+	}
+	return serverBin
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startServer runs the server in a subprocess with its data under dir and
+// waits until it accepts connections. The returned function stops it.
+func startServer(t *testing.T, dir string, port int) (stop func()) {
+	t.Helper()
+	cmd := exec.Command(buildServer(t), "-port", strconv.Itoa(port), "-quiet",
+		"-http-port", "0", "-grpc-port", "0", "-metrics-port", "0")
+	cmd.Dir = dir
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cmd.Process.Signal(os.Interrupt)
+			cmd.Wait()
+		})
+	}
+	t.Cleanup(stop)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return stop
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Server did not start listening on %s: %v", addr, err)
+		}
+	}
+}
+
+func TestClient_ConcurrentLoad(t *testing.T) {
+	port := freePort(t)
+	startServer(t, t.TempDir(), port)
+
+	c, err := Dial(fmt.Sprintf("127.0.0.1:%d", port), &Options{PoolSize: 4})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	if err := c.CreateCollection("docs", 4, "l2"); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+
+	const workers, perWorker = 16, 20
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", w)
+			for i := range perWorker {
+				block := &pb.BlockData{
+					Primary: fmt.Sprintf("%s/%d", key, i),
+					Vector:  []float32{float32(w), float32(i), 1, 0},
+				}
+				if err := c.AppendBlock("docs", key, block); err != nil {
+					errs <- fmt.Errorf("append %s/%d: %w", key, i, err)
+					return
+				}
+			}
+			for i := range perWorker {
+				block, err := c.GetBlock("docs", key, uint32(i))
+				if err != nil {
+					errs <- fmt.Errorf("get %s/%d: %w", key, i, err)
+					return
+				}
+				if want := fmt.Sprintf("%s/%d", key, i); block.Primary != want {
+					errs <- fmt.Errorf("block %s/%d has primary %q", key, i, block.Primary)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	results, err := c.Search(&pb.SearchRequest{Collection: "docs", Query: []float32{3, 7, 1, 0}, TopK: 1})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Key != "key-3" || results[0].Index != 7 {
+		t.Errorf("Expected key-3/7 as the nearest block, got %+v", results)
+	}
+
+	if err := c.DeleteKey("docs", "key-3"); err != nil {
+		t.Fatalf("DeleteKey failed: %v", err)
+	}
+	if _, err := c.GetBlock("docs", "key-3", 0); err == nil {
+		t.Error("Expected GetBlock on a deleted key to fail")
+	}
+}
+
+func TestClient_ReconnectsAfterServerRestart(t *testing.T) {
+	dir, port := t.TempDir(), freePort(t)
+	stop := startServer(t, dir, port)
+
+	c, err := Dial(fmt.Sprintf("127.0.0.1:%d", port), &Options{PoolSize: 2, InitialBackoff: 10 * time.Millisecond, ReconnectAttempts: 3})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	if err := c.CreateCollection("docs", 2, "l2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AppendBlock("docs", "a", &pb.BlockData{Primary: "kept", Vector: []float32{1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	stop()
+	if _, err := c.GetBlock("docs", "a", 0); err == nil {
+		t.Fatal("Expected a request to fail while the server is down")
+	}
+
+	startServer(t, dir, port)
+	block, err := c.GetBlock("docs", "a", 0)
+	if err != nil {
+		t.Fatalf("GetBlock after restart failed: %v", err)
+	}
+	if block.Primary != "kept" {
+		t.Errorf("GetBlock after restart = %q, want kept", block.Primary)
+	}
+}
+
+func TestClient_CloseDrainsInFlightRequests(t *testing.T) {
+	port := freePort(t)
+	startServer(t, t.TempDir(), port)
+
+	c, err := Dial(fmt.Sprintf("127.0.0.1:%d", port), &Options{PoolSize: 2})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err := c.CreateCollection("docs", 2, "l2"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.AppendBlock("docs", "k", &pb.BlockData{Vector: []float32{float32(i), 0}})
+			if err != nil && !errors.Is(err, ErrClosed) {
+				errs <- err
+			}
+		}()
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Request failed with %v, want success or ErrClosed", err)
+	}
+
+	if err := c.DeleteKey("docs", "k"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Request after Close returned %v, want ErrClosed", err)
+	}
+}
@@ -1,3 +1,6 @@
+import contextlib
+import queue
+import select
 import socket
 import struct
 import uuid
@@ -13,8 +16,13 @@ class Collection:
         self.client = client
         self.name = name
 
-    def append_block(self, key, primary, vector=None, keywords=None):
-        """Append a block to a key in this collection."""
+    def append_block(self, key, primary, vector=None, keywords=None, ttl_seconds=0):
+        """
+        Append a block to a key in this collection.
+
+        Args:
+            ttl_seconds: Expire the block after this many seconds (0 = never)
+        """
         req = pb.WaddleRequest()
         req.request_id = self.client._get_id()
 
@@ -24,7 +32,9 @@ class Collection:
             block.vector.extend(vector)
         if keywords:
             block.keywords.extend(keywords)
+        block.ttl_seconds = ttl_seconds
 
+        req.transaction_id = self.client.transaction_id or ""
         req.append_block.collection = self.name
         req.append_block.key = key
         req.append_block.block.CopyFrom(block)
@@ -36,11 +46,13 @@ class Collection:
         Batch append multiple blocks to this collection.
 
         Args:
-            items: list of dicts with keys: 'key', 'primary', 'vector', 'keywords'
+            items: list of dicts with keys: 'key', 'primary', 'vector',
+                'keywords' and optionally 'ttl_seconds'
         """
         req = pb.WaddleRequest()
         req.request_id = self.client._get_id()
 
+        req.transaction_id = self.client.transaction_id or ""
         req.batch_append.collection = self.name
 
         for item in items:
@@ -54,6 +66,7 @@ class Collection:
                 block.vector.extend(item["vector"])
             if item.get("keywords"):
                 block.keywords.extend(item["keywords"])
+            block.ttl_seconds = item.get("ttl_seconds", 0)
 
             append_req.block.CopyFrom(block)
 
@@ -73,6 +86,7 @@ class Collection:
         """Delete a key and all its blocks from this collection."""
         req = pb.WaddleRequest()
         req.request_id = self.client._get_id()
+        req.transaction_id = self.client.transaction_id or ""
         req.delete_key.collection = self.name
         req.delete_key.key = key
         return self.client._send_request(req)
@@ -95,7 +109,7 @@ class Collection:
         # Server returns existence in length field (1=Found, 0=Not Found)
         return resp.length > 0
 
-    def search(self, vector, top_k=10, keywords=None, mode="global"):
+    def search(self, vector, top_k=10, keywords=None, mode="global", max_distance=0.0):
         """
         Perform vector search in this collection.
 
@@ -104,6 +118,8 @@ class Collection:
             top_k: Number of results to return
             keywords: Optional keyword filters
             mode: Search mode ("global" or "local")
+            max_distance: Drop results farther than this; fewer than top_k
+                results may be returned (0 = no limit)
         """
         req = pb.WaddleRequest()
         req.request_id = self.client._get_id()
@@ -112,19 +128,69 @@ class Collection:
         req.search.query.extend(vector)
         req.search.top_k = top_k
         req.search.mode = mode
+        req.search.max_distance = max_distance
         if keywords:
             req.search.keywords.extend(keywords)
 
         resp = self.client._send_request(req)
         return resp.search_list.results
 
+    def search_variant(self, vector, variant="primary", top_k=10, keywords=None, mode="global", max_distance=0.0):
+        """
+        Perform vector search against a specific HNSW graph of this collection.
+
+        Args:
+            vector: Query vector
+            variant: "primary" or "secondary"
+            top_k: Number of results to return
+            keywords: Optional keyword filters
+            mode: Search mode ("global" or "local")
+            max_distance: Drop results farther than this (0 = no limit)
+        """
+        req = pb.WaddleRequest()
+        req.request_id = self.client._get_id()
+
+        req.search_variant.collection = self.name
+        req.search_variant.query.extend(vector)
+        req.search_variant.top_k = top_k
+        req.search_variant.mode = mode
+        req.search_variant.variant = variant
+        req.search_variant.max_distance = max_distance
+        if keywords:
+            req.search_variant.keywords.extend(keywords)
+
+        resp = self.client._send_request(req)
+        return resp.search_list.results
+
+    def more_like_this(self, key, index, top_k=10, exclude_self=True):
+        """
+        Find blocks similar to an existing block in this collection.
+
+        Args:
+            key: Key of the source block
+            index: Index of the source block
+            top_k: Number of results to return
+            exclude_self: Leave the source block out of the results
+        """
+        req = pb.WaddleRequest()
+        req.request_id = self.client._get_id()
+        req.search_mlt.collection = self.name
+        req.search_mlt.key = key
+        req.search_mlt.index = index
+        req.search_mlt.top_k = top_k
+        req.search_mlt.exclude_self = exclude_self
+        resp = self.client._send_request(req)
+        return resp.search_list.results
+
     def keyword_search(self, keywords, mode="exact"):
         """
         Perform keyword search in this collection.
 
         Args:
             keywords: List of keywords to search for
-            mode: Search mode ("exact" or other modes)
+            mode: Search mode ("exact", "any", "prefix", "partial", "levenshtein" or "jaccard").
+                "any" matches keys with at least one of the keywords; the
+                other modes require all of them.
         """
         req = pb.WaddleRequest()
         req.request_id = self.client._get_id()
@@ -147,11 +213,18 @@ class Collection:
 class WaddleClient:
     """Client for connecting to a WaddleMap database server."""
 
-    def __init__(self, host="localhost", port=6969):
+    def __init__(self, host="localhost", port=6969, tenant_token=""):
         self.host = host
         self.port = port
+        # Sent with every request to servers started with -tenant-tokens
+        self.tenant_token = tenant_token
         self.sock = socket.socket(socket.AF_INET, socket.SOCK_STREAM)
         self.sock.connect((self.host, self.port))
+        # subscription_id -> queue.Queue of Event messages
+        self._subscriptions = {}
+        # Writes made through Collection objects are buffered in this
+        # transaction while it is set
+        self.transaction_id = None
 
     def close(self):
         """Close the connection to the server."""
@@ -161,11 +234,24 @@ class WaddleClient:
         return str(uuid.uuid4())
 
     def _send_request(self, req):
+        req.tenant_token = self.tenant_token
         data = req.SerializeToString()
         # Send Length (4 bytes big-endian) + Data
         length_prefix = struct.pack(">I", len(data))
         self.sock.sendall(length_prefix + data)
 
+        # Subscription events may arrive before the response
+        while True:
+            resp = self._read_frame()
+            if not self._dispatch_event(resp):
+                break
+
+        if not resp.success:
+            raise Exception(f"Server Error: {resp.error_message}")
+
+        return resp
+
+    def _read_frame(self):
         # Read Length
         len_buf = self._recv_n(4)
         if not len_buf:
@@ -176,12 +262,17 @@ class WaddleClient:
         resp_data = self._recv_n(msg_len)
         resp = pb.WaddleResponse()
         resp.ParseFromString(resp_data)
-
-        if not resp.success:
-            raise Exception(f"Server Error: {resp.error_message}")
-
         return resp
 
+    def _dispatch_event(self, resp):
+        """Queue an event frame for its subscription. Returns False for regular responses."""
+        if resp.WhichOneof("result") != "event":
+            return False
+        events = self._subscriptions.get(resp.event.subscription_id)
+        if events is not None:
+            events.put(resp.event)
+        return True
+
     def _recv_n(self, n):
         data = b""
         while len(data) < n:
@@ -193,14 +284,27 @@ class WaddleClient:
 
     # --- Collection Management ---
 
-    def create_collection(self, name, dimensions, metric="l2"):
+    def create_collection(self, name, dimensions, metric="l2", secondary_hnsw=None, hnsw=None, index_type="hnsw",
+                          index_compression="none", pq_subspaces=0, auto_normalize=False):
         """
         Create a new collection and return a Collection object.
 
         Args:
             name: Collection name
             dimensions: Vector dimensions
-            metric: Distance metric ("l2", "cosine", etc.)
+            metric: Distance metric ("l2", "cosine", "ip", "jaccard" or "manhattan")
+            secondary_hnsw: Optional dict with 'm', 'ef_construction' and
+                'ef_search' to maintain a second HNSW graph
+            hnsw: Optional dict with 'm', 'ef_construction', 'ef_search' and
+                'ml' for the primary HNSW graph; missing keys use the defaults
+            index_type: "hnsw" or "flat" (exact brute-force search, suited
+                to small collections)
+            index_compression: "none", or "pq" to store product-quantized
+                codes of pq_subspaces bytes per vector (implies "flat")
+            pq_subspaces: PQ sub-vectors per vector; must divide dimensions
+                (0 = about 4 dimensions each)
+            auto_normalize: Scale inserted vectors and queries to unit length
+                (requires metric "cosine")
 
         Returns:
             Collection object
@@ -210,6 +314,19 @@ class WaddleClient:
         req.create_col.name = name
         req.create_col.dimensions = dimensions
         req.create_col.metric = metric
+        req.create_col.index_type = index_type
+        req.create_col.index_compression = index_compression
+        req.create_col.pq_subspaces = pq_subspaces
+        req.create_col.auto_normalize = auto_normalize
+        if secondary_hnsw:
+            req.create_col.secondary_hnsw.m = secondary_hnsw.get("m", 0)
+            req.create_col.secondary_hnsw.ef_construction = secondary_hnsw.get("ef_construction", 0)
+            req.create_col.secondary_hnsw.ef_search = secondary_hnsw.get("ef_search", 0)
+        if hnsw:
+            req.create_col.hnsw.m = hnsw.get("m", 0)
+            req.create_col.hnsw.ef_construction = hnsw.get("ef_construction", 0)
+            req.create_col.hnsw.ef_search = hnsw.get("ef_search", 0)
+            req.create_col.hnsw.ml = hnsw.get("ml", 0.0)
         self._send_request(req)
         return Collection(self, name)
 
@@ -232,6 +349,133 @@ class WaddleClient:
         req.delete_col.name = name
         return self._send_request(req)
 
+    # --- Subscriptions ---
+
+    def subscribe(self, collection="", event_types=None, subscription_id=None):
+        """
+        Subscribe to change events on this connection.
+
+        Args:
+            collection: Collection name, or "" for all collections
+            event_types: Optional list of "append", "update", "delete", "drop"
+            subscription_id: Optional ID; a random one is generated if omitted
+
+        Returns:
+            queue.Queue receiving Event messages. Events are read while other
+            requests run on this connection, or by calling poll_events().
+        """
+        subscription_id = subscription_id or self._get_id()
+        events = queue.Queue()
+        self._subscriptions[subscription_id] = events
+
+        req = pb.WaddleRequest()
+        req.request_id = self._get_id()
+        req.subscribe.subscription_id = subscription_id
+        req.subscribe.collection = collection
+        if event_types:
+            req.subscribe.event_types.extend(event_types)
+        try:
+            self._send_request(req)
+        except Exception:
+            del self._subscriptions[subscription_id]
+            raise
+        return events
+
+    def poll_events(self, timeout=None):
+        """
+        Read pending event frames from the connection into their subscription
+        queues, waiting up to timeout seconds for the first one.
+
+        Returns:
+            Number of events read
+        """
+        count = 0
+        wait = timeout
+        while True:
+            ready, _, _ = select.select([self.sock], [], [], wait)
+            if not ready:
+                break
+            if self._dispatch_event(self._read_frame()):
+                count += 1
+            # Drain whatever else is already buffered without waiting
+            wait = 0
+        return count
+
+    def batch_search(self, queries):
+        """
+        Run several searches in one round trip.
+
+        Args:
+            queries: list of dicts with keys 'collection', 'vector' and
+                optionally 'top_k' (default 10), 'keywords', 'mode' and
+                'max_distance'
+
+        Returns:
+            One list of results per query, in order. The whole call fails if
+            any query fails.
+        """
+        req = pb.WaddleRequest()
+        req.request_id = self._get_id()
+        for q in queries:
+            sub = req.batch_search.queries.add()
+            sub.collection = q["collection"]
+            sub.query.extend(q["vector"])
+            sub.top_k = q.get("top_k", 10)
+            sub.mode = q.get("mode", "global")
+            sub.max_distance = q.get("max_distance", 0.0)
+            if q.get("keywords"):
+                sub.keywords.extend(q["keywords"])
+        resp = self._send_request(req)
+        return [r.results for r in resp.batch_search.results]
+
+    # --- Transactions ---
+
+    def begin_transaction(self):
+        """
+        Open a transaction. Until it is committed or rolled back, appends and
+        key deletes made through this client's Collection objects are
+        buffered on the server instead of applied.
+        """
+        if self.transaction_id:
+            raise Exception("a transaction is already open")
+        req = pb.WaddleRequest()
+        req.request_id = self._get_id()
+        req.begin_tx.CopyFrom(pb.BeginTransactionRequest())
+        resp = self._send_request(req)
+        self.transaction_id = resp.transaction.transaction_id
+        return self.transaction_id
+
+    def commit_transaction(self):
+        """Apply the buffered writes atomically. Returns the number of writes applied."""
+        req = pb.WaddleRequest()
+        req.request_id = self._get_id()
+        req.commit_tx.transaction_id = self.transaction_id or ""
+        # The server closes the transaction even if the commit fails
+        self.transaction_id = None
+        return self._send_request(req).length
+
+    def rollback_transaction(self):
+        """Discard the buffered writes."""
+        req = pb.WaddleRequest()
+        req.request_id = self._get_id()
+        req.rollback_tx.transaction_id = self.transaction_id or ""
+        self.transaction_id = None
+        return self._send_request(req)
+
+    @contextlib.contextmanager
+    def transaction(self):
+        """
+        Run the writes in a with block as one transaction, committed when the
+        block exits and rolled back if it raises.
+        """
+        self.begin_transaction()
+        try:
+            yield self
+        except BaseException:
+            self.rollback_transaction()
+            raise
+        self.commit_transaction()
+
     def list_collections(self):
         """List all collections in the database."""
         req = pb.WaddleRequest()
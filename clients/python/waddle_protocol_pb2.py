@@ -24,7 +24,7 @@ _sym_db = _symbol_database.Default()
 
 
 
-DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x15waddle_protocol.proto\x12\twaddlemap\"\xf7\x08\n\rWaddleRequest\x12\x12\n\nrequest_id\x18\x01 \x01(\t\x12\x38\n\ncreate_col\x18\r \x01(\x0b\x32\".waddlemap.CreateCollectionRequestH\x00\x12\x38\n\ndelete_col\x18\x0e \x01(\x0b\x32\".waddlemap.DeleteCollectionRequestH\x00\x12\x36\n\tlist_cols\x18\x0f \x01(\x0b\x32!.waddlemap.ListCollectionsRequestH\x00\x12:\n\x0b\x63ompact_col\x18\x10 \x01(\x0b\x32#.waddlemap.CompactCollectionRequestH\x00\x12\x35\n\x0c\x61ppend_block\x18\x11 \x01(\x0b\x32\x1d.waddlemap.AppendBlockRequestH\x00\x12/\n\tget_block\x18\x12 \x01(\x0b\x32\x1a.waddlemap.GetBlockRequestH\x00\x12\x31\n\nget_vector\x18\x13 \x01(\x0b\x32\x1b.waddlemap.GetVectorRequestH\x00\x12\x35\n\x0bget_key_len\x18\x14 \x01(\x0b\x32\x1e.waddlemap.GetKeyLengthRequestH\x00\x12+\n\x07get_key\x18\x15 \x01(\x0b\x32\x18.waddlemap.GetKeyRequestH\x00\x12\x31\n\ndelete_key\x18\x16 \x01(\x0b\x32\x1b.waddlemap.DeleteKeyRequestH\x00\x12/\n\tlist_keys\x18\x17 \x01(\x0b\x32\x1a.waddlemap.ListKeysRequestH\x00\x12\x35\n\x0c\x63ontains_key\x18\x18 \x01(\x0b\x32\x1d.waddlemap.ContainsKeyRequestH\x00\x12\x35\n\x0cupdate_block\x18\x19 \x01(\x0b\x32\x1d.waddlemap.UpdateBlockRequestH\x00\x12\x37\n\rreplace_block\x18\x1a \x01(\x0b\x32\x1e.waddlemap.ReplaceBlockRequestH\x00\x12*\n\x06search\x18\x1b \x01(\x0b\x32\x18.waddlemap.SearchRequestH\x00\x12:\n\nsearch_mlt\x18\x1c \x01(\x0b\x32$.waddlemap.SearchMoreLikeThisRequestH\x00\x12\x36\n\rsearch_in_key\x18\x1d \x01(\x0b\x32\x1d.waddlemap.SearchInKeyRequestH\x00\x12\x39\n\x0ekeyword_search\x18\x1e \x01(\x0b\x32\x1f.waddlemap.KeywordSearchRequestH\x00\x12<\n\x0csnapshot_col\x18\x1f \x01(\x0b\x32$.waddlemap.SnapshotCollectionRequestH\x00\x12:\n\x0c\x62\x61tch_append\x18  \x01(\x0b\x32\".waddlemap.BatchAppendBlockRequestH\x00\x42\x0b\n\toperation\"\xc6\x02\n\x0eWaddleResponse\x12\x12\n\nrequest_id\x18\x01 \x01(\t\x12\x0f\n\x07success\x18\x02 \x01(\x08\x12\x15\n\rerror_message\x18\x03 \x01(\t\x12\x10\n\x06length\x18\x05 \x01(\x04H\x00\x12&\n\x08key_list\x18\x07 \x01(\x0b\x32\x12.waddlemap.KeyListH\x00\x12-\n\x08\x63ol_list\x18\t \x01(\x0b\x32\x19.waddlemap.CollectionListH\x00\x12\x32\n\x0bsearch_list\x18\n \x01(\x0b\x32\x1b.waddlemap.SearchResultListH\x00\x12%\n\x05\x62lock\x18\x0b \x01(\x0b\x32\x14.waddlemap.BlockDataH\x00\x12*\n\nblock_list\x18\x0c \x01(\x0b\x32\x14.waddlemap.BlockListH\x00\x42\x08\n\x06result\"\x17\n\x07KeyList\x12\x0c\n\x04keys\x18\x01 \x03(\t\"K\n\x17\x43reateCollectionRequest\x12\x0c\n\x04name\x18\x01 \x01(\t\x12\x12\n\ndimensions\x18\x02 \x01(\r\x12\x0e\n\x06metric\x18\x03 \x01(\t\"\'\n\x17\x44\x65leteCollectionRequest\x12\x0c\n\x04name\x18\x01 \x01(\t\"\x18\n\x16ListCollectionsRequest\"(\n\x18\x43ompactCollectionRequest\x12\x0c\n\x04name\x18\x01 \x01(\t\"/\n\x19SnapshotCollectionRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\">\n\nCollection\x12\x0c\n\x04name\x18\x01 \x01(\t\x12\x12\n\ndimensions\x18\x02 \x01(\r\x12\x0e\n\x06metric\x18\x03 \x01(\t\"<\n\x0e\x43ollectionList\x12*\n\x0b\x63ollections\x18\x01 \x03(\x0b\x32\x15.waddlemap.Collection\"1\n\tBlockList\x12$\n\x06\x62locks\x18\x01 \x03(\x0b\x32\x14.waddlemap.BlockData\">\n\tBlockData\x12\x0f\n\x07primary\x18\x01 \x01(\t\x12\x0e\n\x06vector\x18\x02 \x03(\x02\x12\x10\n\x08keywords\x18\x03 \x03(\t\"Z\n\x12\x41ppendBlockRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12#\n\x05\x62lock\x18\x03 \x01(\x0b\x32\x14.waddlemap.BlockData\"^\n\x17\x42\x61tchAppendBlockRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12/\n\x08requests\x18\x02 \x03(\x0b\x32\x1d.waddlemap.AppendBlockRequest\"A\n\x0fGetBlockRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05index\x18\x03 \x01(\r\"B\n\x10GetVectorRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05index\x18\x03 \x01(\r\"6\n\x13GetKeyLengthRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\"0\n\rGetKeyRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\"3\n\x10\x44\x65leteKeyRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\"%\n\x0fListKeysRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\"5\n\x12\x43ontainsKeyRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\"i\n\x12UpdateBlockRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05index\x18\x03 \x01(\r\x12#\n\x05\x62lock\x18\x04 \x01(\x0b\x32\x14.waddlemap.BlockData\"j\n\x13ReplaceBlockRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05index\x18\x03 \x01(\r\x12#\n\x05\x62lock\x18\x04 \x01(\x0b\x32\x14.waddlemap.BlockData\"a\n\rSearchRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\r\n\x05query\x18\x02 \x03(\x02\x12\r\n\x05top_k\x18\x03 \x01(\r\x12\x0c\n\x04mode\x18\x04 \x01(\t\x12\x10\n\x08keywords\x18\x05 \x03(\t\"Z\n\x19SearchMoreLikeThisRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05index\x18\x03 \x01(\r\x12\r\n\x05top_k\x18\x04 \x01(\r\"S\n\x12SearchInKeyRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05query\x18\x03 \x03(\x02\x12\r\n\x05top_k\x18\x04 \x01(\r\"J\n\x14KeywordSearchRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x10\n\x08keywords\x18\x02 \x03(\t\x12\x0c\n\x04mode\x18\x03 \x01(\t\"e\n\x10SearchResultItem\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05index\x18\x02 \x01(\r\x12\x10\n\x08\x64istance\x18\x03 \x01(\x02\x12#\n\x05\x62lock\x18\x04 \x01(\x0b\x32\x14.waddlemap.BlockData\"@\n\x10SearchResultList\x12,\n\x07results\x18\x01 \x03(\x0b\x32\x1b.waddlemap.SearchResultItem2O\n\rWaddleService\x12>\n\x07\x45xecute\x12\x18.waddlemap.WaddleRequest\x1a\x19.waddlemap.WaddleResponseB\x11Z\x0fwaddlemap/protob\x06proto3')
+DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x15waddle_protocol.proto\x12\twaddlemap\"\xba\x0c\n\rWaddleRequest\x12\x12\n\nrequest_id\x18\x01 \x01(\t\x12\x16\n\x0etransaction_id\x18\x02 \x01(\t\x12\x14\n\x0ctenant_token\x18\' \x01(\t\x12\x38\n\ncreate_col\x18\r \x01(\x0b\x32\".waddlemap.CreateCollectionRequestH\x00\x12\x38\n\ndelete_col\x18\x0e \x01(\x0b\x32\".waddlemap.DeleteCollectionRequestH\x00\x12\x36\n\tlist_cols\x18\x0f \x01(\x0b\x32!.waddlemap.ListCollectionsRequestH\x00\x12:\n\x0b\x63ompact_col\x18\x10 \x01(\x0b\x32#.waddlemap.CompactCollectionRequestH\x00\x12\x35\n\x0c\x61ppend_block\x18\x11 \x01(\x0b\x32\x1d.waddlemap.AppendBlockRequestH\x00\x12/\n\tget_block\x18\x12 \x01(\x0b\x32\x1a.waddlemap.GetBlockRequestH\x00\x12\x31\n\nget_vector\x18\x13 \x01(\x0b\x32\x1b.waddlemap.GetVectorRequestH\x00\x12\x35\n\x0bget_key_len\x18\x14 \x01(\x0b\x32\x1e.waddlemap.GetKeyLengthRequestH\x00\x12+\n\x07get_key\x18\x15 \x01(\x0b\x32\x18.waddlemap.GetKeyRequestH\x00\x12\x31\n\ndelete_key\x18\x16 \x01(\x0b\x32\x1b.waddlemap.DeleteKeyRequestH\x00\x12/\n\tlist_keys\x18\x17 \x01(\x0b\x32\x1a.waddlemap.ListKeysRequestH\x00\x12\x35\n\x0c\x63ontains_key\x18\x18 \x01(\x0b\x32\x1d.waddlemap.ContainsKeyRequestH\x00\x12\x35\n\x0cupdate_block\x18\x19 \x01(\x0b\x32\x1d.waddlemap.UpdateBlockRequestH\x00\x12\x37\n\rreplace_block\x18\x1a \x01(\x0b\x32\x1e.waddlemap.ReplaceBlockRequestH\x00\x12*\n\x06search\x18\x1b \x01(\x0b\x32\x18.waddlemap.SearchRequestH\x00\x12:\n\nsearch_mlt\x18\x1c \x01(\x0b\x32$.waddlemap.SearchMoreLikeThisRequestH\x00\x12\x36\n\rsearch_in_key\x18\x1d \x01(\x0b\x32\x1d.waddlemap.SearchInKeyRequestH\x00\x12\x39\n\x0ekeyword_search\x18\x1e \x01(\x0b\x32\x1f.waddlemap.KeywordSearchRequestH\x00\x12<\n\x0csnapshot_col\x18\x1f \x01(\x0b\x32$.waddlemap.SnapshotCollectionRequestH\x00\x12:\n\x0c\x62\x61tch_append\x18  \x01(\x0b\x32\".waddlemap.BatchAppendBlockRequestH\x00\x12\x39\n\x0esearch_variant\x18! \x01(\x0b\x32\x1f.waddlemap.SearchVariantRequestH\x00\x12\x30\n\tsubscribe\x18\" \x01(\x0b\x32\x1b.waddlemap.SubscribeRequestH\x00\x12\x35\n\x0c\x62\x61tch_search\x18# \x01(\x0b\x32\x1d.waddlemap.BatchSearchRequestH\x00\x12\x36\n\x08\x62\x65gin_tx\x18$ \x01(\x0b\x32\".waddlemap.BeginTransactionRequestH\x00\x12\x38\n\tcommit_tx\x18% \x01(\x0b\x32#.waddlemap.CommitTransactionRequestH\x00\x12<\n\x0brollback_tx\x18& \x01(\x0b\x32%.waddlemap.RollbackTransactionRequestH\x00\x12?\n\x12update_conditional\x18( \x01(\x0b\x32!.waddlemap.UpdateValueConditionalH\x00\x42\x0b\n\toperation\"\x87\x04\n\x0eWaddleResponse\x12\x12\n\nrequest_id\x18\x01 \x01(\t\x12\x0f\n\x07success\x18\x02 \x01(\x08\x12\x15\n\rerror_message\x18\x03 \x01(\t\x12(\n\nerror_code\x18\x10 \x01(\x0e\x32\x14.waddlemap.ErrorCode\x12\x10\n\x06length\x18\x05 \x01(\x04H\x00\x12&\n\x08key_list\x18\x07 \x01(\x0b\x32\x12.waddlemap.KeyListH\x00\x12-\n\x08\x63ol_list\x18\t \x01(\x0b\x32\x19.waddlemap.CollectionListH\x00\x12\x32\n\x0bsearch_list\x18\n \x01(\x0b\x32\x1b.waddlemap.SearchResultListH\x00\x12%\n\x05\x62lock\x18\x0b \x01(\x0b\x32\x14.waddlemap.BlockDataH\x00\x12*\n\nblock_list\x18\x0c \x01(\x0b\x32\x14.waddlemap.BlockListH\x00\x12!\n\x05\x65vent\x18\r \x01(\x0b\x32\x10.waddlemap.EventH\x00\x12\x36\n\x0c\x62\x61tch_search\x18\x0e \x01(\x0b\x32\x1e.waddlemap.BatchSearchResponseH\x00\x12:\n\x0btransaction\x18\x0f \x01(\x0b\x32#.waddlemap.BeginTransactionResponseH\x00\x42\x08\n\x06result\"\x17\n\x07KeyList\x12\x0c\n\x04keys\x18\x01 \x03(\t\"\xfe\x01\n\x17\x43reateCollectionRequest\x12\x0c\n\x04name\x18\x01 \x01(\t\x12\x12\n\ndimensions\x18\x02 \x01(\r\x12\x0e\n\x06metric\x18\x03 \x01(\t\x12.\n\x0esecondary_hnsw\x18\x04 \x01(\x0b\x32\x16.waddlemap.HNSWOptions\x12$\n\x04hnsw\x18\x05 \x01(\x0b\x32\x16.waddlemap.HNSWOptions\x12\x12\n\nindex_type\x18\x06 \x01(\t\x12\x19\n\x11index_compression\x18\x07 \x01(\t\x12\x14\n\x0cpq_subspaces\x18\x08 \x01(\r\x12\x16\n\x0e\x61uto_normalize\x18\t \x01(\x08\"P\n\x0bHNSWOptions\x12\t\n\x01m\x18\x01 \x01(\r\x12\x17\n\x0f\x65\x66_construction\x18\x02 \x01(\r\x12\x11\n\tef_search\x18\x03 \x01(\r\x12\n\n\x02ml\x18\x04 \x01(\x01\"\'\n\x17\x44\x65leteCollectionRequest\x12\x0c\n\x04name\x18\x01 \x01(\t\"\x18\n\x16ListCollectionsRequest\"(\n\x18\x43ompactCollectionRequest\x12\x0c\n\x04name\x18\x01 \x01(\t\"/\n\x19SnapshotCollectionRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\">\n\nCollection\x12\x0c\n\x04name\x18\x01 \x01(\t\x12\x12\n\ndimensions\x18\x02 \x01(\r\x12\x0e\n\x06metric\x18\x03 \x01(\t\"<\n\x0e\x43ollectionList\x12*\n\x0b\x63ollections\x18\x01 \x03(\x0b\x32\x15.waddlemap.Collection\"1\n\tBlockList\x12$\n\x06\x62locks\x18\x01 \x03(\x0b\x32\x14.waddlemap.BlockData\"d\n\tBlockData\x12\x0f\n\x07primary\x18\x01 \x01(\t\x12\x0e\n\x06vector\x18\x02 \x03(\x02\x12\x10\n\x08keywords\x18\x03 \x03(\t\x12\x13\n\x0bttl_seconds\x18\x04 \x01(\x03\x12\x0f\n\x07version\x18\x05 \x01(\x04\"Z\n\x12\x41ppendBlockRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12#\n\x05\x62lock\x18\x03 \x01(\x0b\x32\x14.waddlemap.BlockData\"^\n\x17\x42\x61tchAppendBlockRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12/\n\x08requests\x18\x02 \x03(\x0b\x32\x1d.waddlemap.AppendBlockRequest\"A\n\x0fGetBlockRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05index\x18\x03 \x01(\r\"B\n\x10GetVectorRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05index\x18\x03 \x01(\r\"6\n\x13GetKeyLengthRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\"0\n\rGetKeyRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\"3\n\x10\x44\x65leteKeyRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\"%\n\x0fListKeysRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\"5\n\x12\x43ontainsKeyRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\"i\n\x12UpdateBlockRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05index\x18\x03 \x01(\r\x12#\n\x05\x62lock\x18\x04 \x01(\x0b\x32\x14.waddlemap.BlockData\"j\n\x13ReplaceBlockRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05index\x18\x03 \x01(\r\x12#\n\x05\x62lock\x18\x04 \x01(\x0b\x32\x14.waddlemap.BlockData\"\x87\x01\n\x16UpdateValueConditional\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05index\x18\x03 \x01(\r\x12\x18\n\x10\x65xpected_version\x18\x04 \x01(\x04\x12#\n\x05\x62lock\x18\x05 \x01(\x0b\x32\x14.waddlemap.BlockData\"w\n\rSearchRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\r\n\x05query\x18\x02 \x03(\x02\x12\r\n\x05top_k\x18\x03 \x01(\r\x12\x0c\n\x04mode\x18\x04 \x01(\t\x12\x10\n\x08keywords\x18\x05 \x03(\t\x12\x14\n\x0cmax_distance\x18\x06 \x01(\x02\"\x8f\x01\n\x14SearchVariantRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\r\n\x05query\x18\x02 \x03(\x02\x12\r\n\x05top_k\x18\x03 \x01(\r\x12\x0c\n\x04mode\x18\x04 \x01(\t\x12\x10\n\x08keywords\x18\x05 \x03(\t\x12\x0f\n\x07variant\x18\x06 \x01(\t\x12\x14\n\x0cmax_distance\x18\x07 \x01(\x02\"p\n\x19SearchMoreLikeThisRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05index\x18\x03 \x01(\r\x12\r\n\x05top_k\x18\x04 \x01(\r\x12\x14\n\x0c\x65xclude_self\x18\x05 \x01(\x08\"S\n\x12SearchInKeyRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05query\x18\x03 \x03(\x02\x12\r\n\x05top_k\x18\x04 \x01(\r\"J\n\x14KeywordSearchRequest\x12\x12\n\ncollection\x18\x01 \x01(\t\x12\x10\n\x08keywords\x18\x02 \x03(\t\x12\x0c\n\x04mode\x18\x03 \x01(\t\"e\n\x10SearchResultItem\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05index\x18\x02 \x01(\r\x12\x10\n\x08\x64istance\x18\x03 \x01(\x02\x12#\n\x05\x62lock\x18\x04 \x01(\x0b\x32\x14.waddlemap.BlockData\"@\n\x10SearchResultList\x12,\n\x07results\x18\x01 \x03(\x0b\x32\x1b.waddlemap.SearchResultItem\"?\n\x12\x42\x61tchSearchRequest\x12)\n\x07queries\x18\x01 \x03(\x0b\x32\x18.waddlemap.SearchRequest\"C\n\x13\x42\x61tchSearchResponse\x12,\n\x07results\x18\x01 \x03(\x0b\x32\x1b.waddlemap.SearchResultList\"\x19\n\x17\x42\x65ginTransactionRequest\"2\n\x18\x42\x65ginTransactionResponse\x12\x16\n\x0etransaction_id\x18\x01 \x01(\t\"2\n\x18\x43ommitTransactionRequest\x12\x16\n\x0etransaction_id\x18\x01 \x01(\t\"4\n\x1aRollbackTransactionRequest\x12\x16\n\x0etransaction_id\x18\x01 \x01(\t\"T\n\x10SubscribeRequest\x12\x17\n\x0fsubscription_id\x18\x01 \x01(\t\x12\x12\n\ncollection\x18\x02 \x01(\t\x12\x13\n\x0b\x65vent_types\x18\x03 \x03(\t\"U\n\x05\x45vent\x12\x17\n\x0fsubscription_id\x18\x01 \x01(\t\x12\x12\n\nevent_type\x18\x02 \x01(\t\x12\x12\n\ncollection\x18\x03 \x01(\t\x12\x0b\n\x03key\x18\x04 \x01(\t*\xb4\x01\n\tErrorCode\x12\x1a\n\x16\x45RROR_CODE_UNSPECIFIED\x10\x00\x12\x10\n\x0cUNAUTHORIZED\x10\x01\x12\r\n\tNOT_FOUND\x10\x02\x12\x14\n\x10INVALID_ARGUMENT\x10\x03\x12\x12\n\x0e\x41LREADY_EXISTS\x10\x04\x12\x16\n\x12RESOURCE_EXHAUSTED\x10\x05\x12\x12\n\x0e\x44\x41TA_CORRUPTED\x10\x06\x12\x14\n\x10VERSION_CONFLICT\x10\x07\x32O\n\rWaddleService\x12>\n\x07\x45xecute\x12\x18.waddlemap.WaddleRequest\x1a\x19.waddlemap.WaddleResponseB\x11Z\x0fwaddlemap/protob\x06proto3')
 
 _globals = globals()
 _builder.BuildMessageAndEnumDescriptors(DESCRIPTOR, _globals)
@@ -32,64 +32,88 @@ _builder.BuildTopDescriptorsAndMessages(DESCRIPTOR, 'waddle_protocol_pb2', _glob
 if not _descriptor._USE_C_DESCRIPTORS:
   _globals['DESCRIPTOR']._loaded_options = None
   _globals['DESCRIPTOR']._serialized_options = b'Z\017waddlemap/proto'
+  _globals['_ERRORCODE']._serialized_start=5089
+  _globals['_ERRORCODE']._serialized_end=5269
   _globals['_WADDLEREQUEST']._serialized_start=37
-  _globals['_WADDLEREQUEST']._serialized_end=1180
-  _globals['_WADDLERESPONSE']._serialized_start=1183
-  _globals['_WADDLERESPONSE']._serialized_end=1509
-  _globals['_KEYLIST']._serialized_start=1511
-  _globals['_KEYLIST']._serialized_end=1534
-  _globals['_CREATECOLLECTIONREQUEST']._serialized_start=1536
-  _globals['_CREATECOLLECTIONREQUEST']._serialized_end=1611
-  _globals['_DELETECOLLECTIONREQUEST']._serialized_start=1613
-  _globals['_DELETECOLLECTIONREQUEST']._serialized_end=1652
-  _globals['_LISTCOLLECTIONSREQUEST']._serialized_start=1654
-  _globals['_LISTCOLLECTIONSREQUEST']._serialized_end=1678
-  _globals['_COMPACTCOLLECTIONREQUEST']._serialized_start=1680
-  _globals['_COMPACTCOLLECTIONREQUEST']._serialized_end=1720
-  _globals['_SNAPSHOTCOLLECTIONREQUEST']._serialized_start=1722
-  _globals['_SNAPSHOTCOLLECTIONREQUEST']._serialized_end=1769
-  _globals['_COLLECTION']._serialized_start=1771
-  _globals['_COLLECTION']._serialized_end=1833
-  _globals['_COLLECTIONLIST']._serialized_start=1835
-  _globals['_COLLECTIONLIST']._serialized_end=1895
-  _globals['_BLOCKLIST']._serialized_start=1897
-  _globals['_BLOCKLIST']._serialized_end=1946
-  _globals['_BLOCKDATA']._serialized_start=1948
-  _globals['_BLOCKDATA']._serialized_end=2010
-  _globals['_APPENDBLOCKREQUEST']._serialized_start=2012
-  _globals['_APPENDBLOCKREQUEST']._serialized_end=2102
-  _globals['_BATCHAPPENDBLOCKREQUEST']._serialized_start=2104
-  _globals['_BATCHAPPENDBLOCKREQUEST']._serialized_end=2198
-  _globals['_GETBLOCKREQUEST']._serialized_start=2200
-  _globals['_GETBLOCKREQUEST']._serialized_end=2265
-  _globals['_GETVECTORREQUEST']._serialized_start=2267
-  _globals['_GETVECTORREQUEST']._serialized_end=2333
-  _globals['_GETKEYLENGTHREQUEST']._serialized_start=2335
-  _globals['_GETKEYLENGTHREQUEST']._serialized_end=2389
-  _globals['_GETKEYREQUEST']._serialized_start=2391
-  _globals['_GETKEYREQUEST']._serialized_end=2439
-  _globals['_DELETEKEYREQUEST']._serialized_start=2441
-  _globals['_DELETEKEYREQUEST']._serialized_end=2492
-  _globals['_LISTKEYSREQUEST']._serialized_start=2494
-  _globals['_LISTKEYSREQUEST']._serialized_end=2531
-  _globals['_CONTAINSKEYREQUEST']._serialized_start=2533
-  _globals['_CONTAINSKEYREQUEST']._serialized_end=2586
-  _globals['_UPDATEBLOCKREQUEST']._serialized_start=2588
-  _globals['_UPDATEBLOCKREQUEST']._serialized_end=2693
-  _globals['_REPLACEBLOCKREQUEST']._serialized_start=2695
-  _globals['_REPLACEBLOCKREQUEST']._serialized_end=2801
-  _globals['_SEARCHREQUEST']._serialized_start=2803
-  _globals['_SEARCHREQUEST']._serialized_end=2900
-  _globals['_SEARCHMORELIKETHISREQUEST']._serialized_start=2902
-  _globals['_SEARCHMORELIKETHISREQUEST']._serialized_end=2992
-  _globals['_SEARCHINKEYREQUEST']._serialized_start=2994
-  _globals['_SEARCHINKEYREQUEST']._serialized_end=3077
-  _globals['_KEYWORDSEARCHREQUEST']._serialized_start=3079
-  _globals['_KEYWORDSEARCHREQUEST']._serialized_end=3153
-  _globals['_SEARCHRESULTITEM']._serialized_start=3155
-  _globals['_SEARCHRESULTITEM']._serialized_end=3256
-  _globals['_SEARCHRESULTLIST']._serialized_start=3258
-  _globals['_SEARCHRESULTLIST']._serialized_end=3322
-  _globals['_WADDLESERVICE']._serialized_start=3324
-  _globals['_WADDLESERVICE']._serialized_end=3403
+  _globals['_WADDLEREQUEST']._serialized_end=1631
+  _globals['_WADDLERESPONSE']._serialized_start=1634
+  _globals['_WADDLERESPONSE']._serialized_end=2153
+  _globals['_KEYLIST']._serialized_start=2155
+  _globals['_KEYLIST']._serialized_end=2178
+  _globals['_CREATECOLLECTIONREQUEST']._serialized_start=2181
+  _globals['_CREATECOLLECTIONREQUEST']._serialized_end=2435
+  _globals['_HNSWOPTIONS']._serialized_start=2437
+  _globals['_HNSWOPTIONS']._serialized_end=2517
+  _globals['_DELETECOLLECTIONREQUEST']._serialized_start=2519
+  _globals['_DELETECOLLECTIONREQUEST']._serialized_end=2558
+  _globals['_LISTCOLLECTIONSREQUEST']._serialized_start=2560
+  _globals['_LISTCOLLECTIONSREQUEST']._serialized_end=2584
+  _globals['_COMPACTCOLLECTIONREQUEST']._serialized_start=2586
+  _globals['_COMPACTCOLLECTIONREQUEST']._serialized_end=2626
+  _globals['_SNAPSHOTCOLLECTIONREQUEST']._serialized_start=2628
+  _globals['_SNAPSHOTCOLLECTIONREQUEST']._serialized_end=2675
+  _globals['_COLLECTION']._serialized_start=2677
+  _globals['_COLLECTION']._serialized_end=2739
+  _globals['_COLLECTIONLIST']._serialized_start=2741
+  _globals['_COLLECTIONLIST']._serialized_end=2801
+  _globals['_BLOCKLIST']._serialized_start=2803
+  _globals['_BLOCKLIST']._serialized_end=2852
+  _globals['_BLOCKDATA']._serialized_start=2854
+  _globals['_BLOCKDATA']._serialized_end=2954
+  _globals['_APPENDBLOCKREQUEST']._serialized_start=2956
+  _globals['_APPENDBLOCKREQUEST']._serialized_end=3046
+  _globals['_BATCHAPPENDBLOCKREQUEST']._serialized_start=3048
+  _globals['_BATCHAPPENDBLOCKREQUEST']._serialized_end=3142
+  _globals['_GETBLOCKREQUEST']._serialized_start=3144
+  _globals['_GETBLOCKREQUEST']._serialized_end=3209
+  _globals['_GETVECTORREQUEST']._serialized_start=3211
+  _globals['_GETVECTORREQUEST']._serialized_end=3277
+  _globals['_GETKEYLENGTHREQUEST']._serialized_start=3279
+  _globals['_GETKEYLENGTHREQUEST']._serialized_end=3333
+  _globals['_GETKEYREQUEST']._serialized_start=3335
+  _globals['_GETKEYREQUEST']._serialized_end=3383
+  _globals['_DELETEKEYREQUEST']._serialized_start=3385
+  _globals['_DELETEKEYREQUEST']._serialized_end=3436
+  _globals['_LISTKEYSREQUEST']._serialized_start=3438
+  _globals['_LISTKEYSREQUEST']._serialized_end=3475
+  _globals['_CONTAINSKEYREQUEST']._serialized_start=3477
+  _globals['_CONTAINSKEYREQUEST']._serialized_end=3530
+  _globals['_UPDATEBLOCKREQUEST']._serialized_start=3532
+  _globals['_UPDATEBLOCKREQUEST']._serialized_end=3637
+  _globals['_REPLACEBLOCKREQUEST']._serialized_start=3639
+  _globals['_REPLACEBLOCKREQUEST']._serialized_end=3745
+  _globals['_UPDATEVALUECONDITIONAL']._serialized_start=3748
+  _globals['_UPDATEVALUECONDITIONAL']._serialized_end=3883
+  _globals['_SEARCHREQUEST']._serialized_start=3885
+  _globals['_SEARCHREQUEST']._serialized_end=4004
+  _globals['_SEARCHVARIANTREQUEST']._serialized_start=4007
+  _globals['_SEARCHVARIANTREQUEST']._serialized_end=4150
+  _globals['_SEARCHMORELIKETHISREQUEST']._serialized_start=4152
+  _globals['_SEARCHMORELIKETHISREQUEST']._serialized_end=4264
+  _globals['_SEARCHINKEYREQUEST']._serialized_start=4266
+  _globals['_SEARCHINKEYREQUEST']._serialized_end=4349
+  _globals['_KEYWORDSEARCHREQUEST']._serialized_start=4351
+  _globals['_KEYWORDSEARCHREQUEST']._serialized_end=4425
+  _globals['_SEARCHRESULTITEM']._serialized_start=4427
+  _globals['_SEARCHRESULTITEM']._serialized_end=4528
+  _globals['_SEARCHRESULTLIST']._serialized_start=4530
+  _globals['_SEARCHRESULTLIST']._serialized_end=4594
+  _globals['_BATCHSEARCHREQUEST']._serialized_start=4596
+  _globals['_BATCHSEARCHREQUEST']._serialized_end=4659
+  _globals['_BATCHSEARCHRESPONSE']._serialized_start=4661
+  _globals['_BATCHSEARCHRESPONSE']._serialized_end=4728
+  _globals['_BEGINTRANSACTIONREQUEST']._serialized_start=4730
+  _globals['_BEGINTRANSACTIONREQUEST']._serialized_end=4755
+  _globals['_BEGINTRANSACTIONRESPONSE']._serialized_start=4757
+  _globals['_BEGINTRANSACTIONRESPONSE']._serialized_end=4807
+  _globals['_COMMITTRANSACTIONREQUEST']._serialized_start=4809
+  _globals['_COMMITTRANSACTIONREQUEST']._serialized_end=4859
+  _globals['_ROLLBACKTRANSACTIONREQUEST']._serialized_start=4861
+  _globals['_ROLLBACKTRANSACTIONREQUEST']._serialized_end=4913
+  _globals['_SUBSCRIBEREQUEST']._serialized_start=4915
+  _globals['_SUBSCRIBEREQUEST']._serialized_end=4999
+  _globals['_EVENT']._serialized_start=5001
+  _globals['_EVENT']._serialized_end=5086
+  _globals['_WADDLESERVICE']._serialized_start=5271
+  _globals['_WADDLESERVICE']._serialized_end=5350
 # @@protoc_insertion_point(module_scope)
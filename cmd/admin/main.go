@@ -0,0 +1,85 @@
+// Command admin performs offline maintenance on a WaddleMap data directory.
+// The server must not be running against the same data path.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"waddlemap/internal/storage"
+	"waddlemap/internal/types"
+)
+
+func main() {
+	dataPath := flag.String("data-path", "./waddlemap_db", "Path to the WaddleMap data directory")
+	deleteCollection := flag.String("delete-collection", "", "Name of the collection to delete")
+	backupDir := flag.String("backup-before-delete", "", "Archive the collection to this directory before deleting it")
+	migrate := flag.Bool("migrate-collections", false, "Upgrade every collection's meta.json to the current schema version")
+	migrateMetric := flag.String("migrate-metric", "", "Name of the collection to re-index with -metric")
+	metric := flag.String("metric", "", "Distance metric for -migrate-metric (l2, cosine, ip, jaccard, manhattan)")
+	dryRun := flag.Bool("dry-run", false, "With -migrate-metric, only check that the migration is possible")
+	flag.Parse()
+
+	if *migrate {
+		if err := storage.MigrateAllCollections(*dataPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to migrate collections: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Collections in %s migrated to meta version %d\n", *dataPath, storage.CurrentMetaVersion)
+		return
+	}
+
+	if *deleteCollection == "" && *migrateMetric == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{
+		DataPath:      *dataPath,
+		SyncMode:      "strict",
+		FlushInterval: -1,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer vm.Close()
+
+	if *migrateMetric != "" {
+		newMetric := types.DistanceMetric(*metric)
+		if *dryRun {
+			count, err := vm.CheckMetricMigration(*migrateMetric, newMetric)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Collection %q cannot be migrated: %v\n", *migrateMetric, err)
+				vm.Close()
+				os.Exit(1)
+			}
+			fmt.Printf("Collection %q can be migrated to %s; %d vectors would be re-indexed\n", *migrateMetric, newMetric, count)
+			return
+		}
+		if err := vm.MigrateMetric(*migrateMetric, newMetric); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to migrate collection %q: %v\n", *migrateMetric, err)
+			vm.Close()
+			os.Exit(1)
+		}
+		fmt.Printf("Collection %q migrated to %s\n", *migrateMetric, newMetric)
+		return
+	}
+
+	if *backupDir != "" {
+		err = vm.DeleteCollectionWithBackup(*deleteCollection, *backupDir)
+	} else {
+		err = vm.DeleteCollection(*deleteCollection)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to delete collection %q: %v\n", *deleteCollection, err)
+		vm.Close()
+		os.Exit(1)
+	}
+
+	if *backupDir != "" {
+		fmt.Printf("Collection %q archived to %s and deleted\n", *deleteCollection, *backupDir)
+	} else {
+		fmt.Printf("Collection %q deleted\n", *deleteCollection)
+	}
+}
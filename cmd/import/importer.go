@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"waddlemap/internal/storage"
+	"waddlemap/internal/types"
+	"waddlemap/pkg/client"
+	pb "waddlemap/proto"
+)
+
+// sink is where imported blocks are written: a data directory opened in
+// process, or a running server.
+type sink interface {
+	// ensureCollection creates the collection unless it already exists.
+	ensureCollection(cfg types.CollectionConfig) error
+	// keyLength returns the number of blocks stored under key, 0 if none.
+	keyLength(collection, key string) (uint32, error)
+	// appendBatch appends blocks[i] to keys[i] for every i.
+	appendBatch(collection string, keys []string, blocks []*types.BlockData) error
+	Close() error
+}
+
+// embeddedSink writes through a VectorManager opened on the data directory.
+type embeddedSink struct {
+	vm *storage.VectorManager
+}
+
+func (s *embeddedSink) ensureCollection(cfg types.CollectionConfig) error {
+	if _, err := s.vm.GetCollection(cfg.Name); err == nil {
+		return nil
+	}
+	return s.vm.CreateCollectionWithConfig(cfg)
+}
+
+func (s *embeddedSink) keyLength(collection, key string) (uint32, error) {
+	exists, err := s.vm.ContainsKey(collection, key)
+	if err != nil || !exists {
+		return 0, err
+	}
+	return s.vm.GetKeyLength(collection, key)
+}
+
+func (s *embeddedSink) appendBatch(collection string, keys []string, blocks []*types.BlockData) error {
+	_, err := s.vm.BatchAppendBlocks(collection, keys, blocks)
+	return err
+}
+
+func (s *embeddedSink) Close() error {
+	return s.vm.Close()
+}
+
+// remoteSink writes to a server over the TCP protocol.
+type remoteSink struct {
+	c *client.Client
+}
+
+func (s *remoteSink) ensureCollection(cfg types.CollectionConfig) error {
+	err := s.c.CreateCollectionWithOptions(&pb.CreateCollectionRequest{
+		Name: cfg.Name, Dimensions: cfg.Dimensions, Metric: string(cfg.Metric), AutoNormalize: cfg.AutoNormalize,
+	})
+	if err != nil && strings.Contains(err.Error(), "already exists") {
+		return nil
+	}
+	return err
+}
+
+func (s *remoteSink) keyLength(collection, key string) (uint32, error) {
+	return s.c.KeyLength(collection, key)
+}
+
+func (s *remoteSink) appendBatch(collection string, keys []string, blocks []*types.BlockData) error {
+	pbBlocks := make([]*pb.BlockData, len(blocks))
+	for i, block := range blocks {
+		pbBlocks[i] = &pb.BlockData{Primary: block.Primary, Vector: block.Vector, Keywords: block.Keywords}
+	}
+	return s.c.BatchAppend(collection, keys, pbBlocks)
+}
+
+func (s *remoteSink) Close() error {
+	return s.c.Close()
+}
+
+// importStats counts the rows read by an import. Header rows are not counted.
+type importStats struct {
+	Rows    int
+	Failed  int
+	Elapsed time.Duration
+}
+
+// Imported returns the number of rows written.
+func (s importStats) Imported() int {
+	return s.Rows - s.Failed
+}
+
+// String formats the stats as a progress line.
+func (s importStats) String() string {
+	rate := 0.0
+	if s.Elapsed > 0 {
+		rate = float64(s.Rows) / s.Elapsed.Seconds()
+	}
+	return fmt.Sprintf("%d rows processed, %d failed, %s elapsed, %.0f rows/s",
+		s.Rows, s.Failed, s.Elapsed.Round(time.Millisecond), rate)
+}
+
+// importer reads rows of the form
+//
+//	key, block_index, v1 ... vD, keywords, primary_text
+//
+// and appends them to a collection in batches. block_index must be the next
+// index of key, counting the blocks already stored, so rows of a key have to
+// be in order. keywords are separated by keywordSep and may be empty.
+type importer struct {
+	sink       sink
+	collection string
+	dimensions int // Zero takes the dimensions from the first row
+	metric     string
+	normalize  bool // Create the collection with AutoNormalize
+	delimiter  rune
+	keywordSep string
+	batchSize  int
+	skipErrors bool
+
+	progress       io.Writer     // Receives progress lines and skipped rows; may be nil
+	progressPeriod time.Duration // Minimum time between progress lines
+
+	next    map[string]uint32 // Next block index of each key seen
+	created bool
+	stats   importStats
+}
+
+// run imports every row of r.
+func (im *importer) run(r io.Reader) (importStats, error) {
+	start := time.Now()
+	lastReport := start
+	im.next = make(map[string]uint32)
+
+	cr := csv.NewReader(r)
+	cr.Comma = im.delimiter
+	cr.FieldsPerRecord = -1
+
+	var keys []string
+	var blocks []*types.BlockData
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		err := im.sink.appendBatch(im.collection, keys, blocks)
+		if err != nil {
+			im.stats.Failed += len(keys)
+			for _, key := range keys {
+				delete(im.next, key) // Ask the sink again for what was stored
+			}
+			if !im.skipErrors {
+				return fmt.Errorf("batch of %d rows failed: %w", len(keys), err)
+			}
+			im.logf("batch of %d rows failed: %v (skipped)\n", len(keys), err)
+		}
+		keys, blocks = keys[:0], blocks[:0]
+
+		if im.progress != nil && time.Since(lastReport) >= im.progressPeriod {
+			lastReport = time.Now()
+			im.stats.Elapsed = lastReport.Sub(start)
+			im.logf("%s\n", im.stats)
+		}
+		return nil
+	}
+
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				line = parseErr.Line
+			}
+			im.stats.Rows++
+			if err := im.rowError(line, err); err != nil {
+				return im.finish(start), err
+			}
+			continue
+		}
+		if first && isHeader(record) {
+			continue
+		}
+		im.stats.Rows++
+
+		key, block, err := im.parseRow(record)
+		if err != nil {
+			if err := im.rowError(line, err); err != nil {
+				return im.finish(start), err
+			}
+			continue
+		}
+		keys = append(keys, key)
+		blocks = append(blocks, block)
+		if len(keys) >= im.batchSize {
+			if err := flush(); err != nil {
+				return im.finish(start), err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return im.finish(start), err
+	}
+	return im.finish(start), nil
+}
+
+// parseRow converts a record into a block for key, checking its block index
+// against the blocks already stored or queued. The collection is created on
+// the first valid row.
+func (im *importer) parseRow(record []string) (string, *types.BlockData, error) {
+	dims := im.dimensions
+	if dims == 0 {
+		dims = len(record) - 4
+		if dims < 1 {
+			return "", nil, fmt.Errorf("expected at least 5 fields, got %d", len(record))
+		}
+	}
+	if len(record) != dims+4 {
+		return "", nil, fmt.Errorf("expected %d fields, got %d", dims+4, len(record))
+	}
+
+	key := record[0]
+	if key == "" {
+		return "", nil, errors.New("empty key")
+	}
+	index, err := strconv.ParseUint(strings.TrimSpace(record[1]), 10, 32)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid block index %q", record[1])
+	}
+	vector := make([]float32, dims)
+	for i := range vector {
+		v, err := strconv.ParseFloat(strings.TrimSpace(record[2+i]), 32)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid vector component %d: %q", i, record[2+i])
+		}
+		vector[i] = float32(v)
+	}
+	var keywords []string
+	for _, kw := range strings.Split(record[dims+2], im.keywordSep) {
+		if kw = strings.TrimSpace(kw); kw != "" {
+			keywords = append(keywords, kw)
+		}
+	}
+
+	if !im.created {
+		cfg := types.CollectionConfig{Name: im.collection, Dimensions: uint32(dims), Metric: types.DistanceMetric(im.metric), AutoNormalize: im.normalize}
+		if err := im.sink.ensureCollection(cfg); err != nil {
+			return "", nil, fmt.Errorf("failed to create collection %q: %w", im.collection, err)
+		}
+		im.dimensions = dims
+		im.created = true
+	}
+
+	next, ok := im.next[key]
+	if !ok {
+		if next, err = im.sink.keyLength(im.collection, key); err != nil {
+			return "", nil, fmt.Errorf("failed to read length of key %q: %w", key, err)
+		}
+	}
+	if uint32(index) != next {
+		im.next[key] = next
+		return "", nil, fmt.Errorf("block index %d of key %q out of order, expected %d", index, key, next)
+	}
+	im.next[key] = next + 1
+
+	return key, &types.BlockData{Primary: record[dims+3], Vector: vector, Keywords: keywords}, nil
+}
+
+// rowError counts a failed row. It returns the error to abort the import
+// unless skipErrors is set, in which case the row is reported and skipped.
+func (im *importer) rowError(line int, err error) error {
+	im.stats.Failed++
+	if !im.skipErrors {
+		return fmt.Errorf("line %d: %w", line, err)
+	}
+	im.logf("line %d: %v (skipped)\n", line, err)
+	return nil
+}
+
+func (im *importer) logf(format string, args ...any) {
+	if im.progress != nil {
+		fmt.Fprintf(im.progress, format, args...)
+	}
+}
+
+func (im *importer) finish(start time.Time) importStats {
+	im.stats.Elapsed = time.Since(start)
+	return im.stats
+}
+
+// isHeader reports whether the first record is a header row, i.e. its block
+// index column is not a number.
+func isHeader(record []string) bool {
+	if len(record) < 2 {
+		return false
+	}
+	_, err := strconv.ParseUint(strings.TrimSpace(record[1]), 10, 32)
+	return err != nil
+}
+
+// parseDelimiter converts the --delimiter flag to a rune. "tab" and "\t" both
+// select a tab.
+func parseDelimiter(s string) (rune, error) {
+	switch s {
+	case "tab", `\t`, "\t":
+		return '\t', nil
+	}
+	runes := []rune(s)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\n' || runes[0] == '\r' {
+		return 0, fmt.Errorf("invalid delimiter %q: must be a single character other than a quote or newline", s)
+	}
+	return runes[0], nil
+}
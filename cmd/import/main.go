@@ -0,0 +1,119 @@
+// Command import loads vectors from a CSV or TSV file into a collection,
+// either through a running server (--server) or by opening the data
+// directory directly, in which case the server must not be running against it.
+//
+// Each row is
+//
+//	key,block_index,v1,...,vD,kw1;kw2,primary_text
+//
+// A first row whose block_index is not a number is treated as a header.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"waddlemap/internal/logger"
+	"waddlemap/internal/storage"
+	"waddlemap/internal/types"
+	"waddlemap/pkg/client"
+)
+
+func main() {
+	file := flag.String("file", "", "CSV or TSV file to import")
+	collection := flag.String("collection", "", "Collection to import into; created if it does not exist")
+	dimensions := flag.Int("dimensions", 0, "Vector dimensions (0 = take from the first row)")
+	metric := flag.String("metric", "l2", "Distance metric used when creating the collection: l2, cosine, ip, jaccard or manhattan")
+	autoNormalize := flag.Bool("auto-normalize", false, "Create the collection normalizing vectors and queries to unit length (requires -metric cosine)")
+	delimiter := flag.String("delimiter", ",", `Field delimiter; "tab" or "\t" for TSV (default tab for .tsv files)`)
+	keywordSep := flag.String("keyword-separator", ";", "Separator between keywords in the keywords field")
+	server := flag.String("server", "", "Address of a running server (host:port); empty opens --data-path directly")
+	dataPath := flag.String("data-path", "./waddlemap_db", "Path to the WaddleMap data directory when --server is not set")
+	batchSize := flag.Int("batch-size", 1000, "Rows written per batch")
+	skipErrors := flag.Bool("skip-errors", false, "Report and skip invalid rows instead of aborting")
+	flag.Parse()
+
+	if *file == "" || *collection == "" || *dimensions < 0 || *batchSize < 1 || *keywordSep == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	delimiterSet := false
+	flag.Visit(func(f *flag.Flag) {
+		delimiterSet = delimiterSet || f.Name == "delimiter"
+	})
+	if !delimiterSet && strings.EqualFold(filepath.Ext(*file), ".tsv") {
+		*delimiter = "tab"
+	}
+	delim, err := parseDelimiter(*delimiter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	switch *metric {
+	case "l2", "cosine", "ip", "jaccard", "manhattan":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown metric %q: must be l2, cosine, ip, jaccard or manhattan\n", *metric)
+		os.Exit(2)
+	}
+	if *autoNormalize && *metric != "cosine" {
+		fmt.Fprintln(os.Stderr, "-auto-normalize requires -metric cosine")
+		os.Exit(2)
+	}
+
+	in, err := os.Open(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open %s: %v\n", *file, err)
+		os.Exit(1)
+	}
+	defer in.Close()
+
+	var out sink
+	if *server != "" {
+		c, err := client.Dial(*server)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to connect to %s: %v\n", *server, err)
+			os.Exit(1)
+		}
+		out = &remoteSink{c: c}
+	} else {
+		logger.SetLevel(logger.LevelError) // Keep progress readable
+		vm, err := storage.NewVectorManager(&types.DBSchemaConfig{
+			DataPath:            *dataPath,
+			SyncMode:            "normal",
+			FlushInterval:       -1,
+			ExpirySweepInterval: -1,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open storage: %v\n", err)
+			os.Exit(1)
+		}
+		out = &embeddedSink{vm: vm}
+	}
+
+	im := &importer{
+		sink:           out,
+		collection:     *collection,
+		dimensions:     *dimensions,
+		metric:         *metric,
+		normalize:      *autoNormalize,
+		delimiter:      delim,
+		keywordSep:     *keywordSep,
+		batchSize:      *batchSize,
+		skipErrors:     *skipErrors,
+		progress:       os.Stderr,
+		progressPeriod: time.Second,
+	}
+	stats, err := im.run(in)
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close storage: %w", closeErr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed after %s: %v\n", stats, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Imported %d rows into %q: %s\n", stats.Imported(), *collection, stats)
+}
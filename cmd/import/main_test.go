@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"waddlemap/internal/network"
+	"waddlemap/internal/storage"
+	"waddlemap/internal/transaction"
+	"waddlemap/internal/types"
+	"waddlemap/pkg/client"
+)
+
+func openTestManager(t *testing.T) *storage.VectorManager {
+	t.Helper()
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal", FlushInterval: -1})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	t.Cleanup(func() { vm.Close() })
+	return vm
+}
+
+func importFixture(t *testing.T, out sink, skipErrors bool) (importStats, error) {
+	t.Helper()
+	in, err := os.Open("testdata/vectors.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	im := &importer{
+		sink:       out,
+		collection: "docs",
+		metric:     "l2",
+		delimiter:  ',',
+		keywordSep: ";",
+		batchSize:  2,
+		skipErrors: skipErrors,
+	}
+	return im.run(in)
+}
+
+// checkFixture verifies the blocks of the valid fixture rows.
+func checkFixture(t *testing.T, vm *storage.VectorManager) {
+	t.Helper()
+	want := map[string][]types.BlockData{
+		"doc1": {
+			{Primary: "first chunk", Vector: []float32{0.1, 0.2, 0.3}, Keywords: []string{"red", "blue"}},
+			{Primary: "second chunk", Vector: []float32{0.4, 0.5, 0.6}, Keywords: []string{"blue"}},
+		},
+		"doc2": {
+			{Primary: "quoted, with a comma", Vector: []float32{1, 0, 0}},
+			{Primary: "last chunk of doc2", Vector: []float32{0, 0, 1}},
+		},
+		"doc3": {
+			{Primary: "third", Vector: []float32{0, 1, 0}, Keywords: []string{"green", "yellow"}},
+		},
+	}
+	for key, blocks := range want {
+		got, err := vm.GetKey("docs", key)
+		if err != nil {
+			t.Fatalf("GetKey(%s) failed: %v", key, err)
+		}
+		if len(got) != len(blocks) {
+			t.Fatalf("Key %s has %d blocks, want %d", key, len(got), len(blocks))
+		}
+		for i, b := range blocks {
+			if got[i].Primary != b.Primary || !slices.Equal(got[i].Vector, b.Vector) || !slices.Equal(got[i].Keywords, b.Keywords) {
+				t.Errorf("Block %s/%d = %+v, want %+v", key, i, got[i], b)
+			}
+		}
+	}
+}
+
+func TestImport_Embedded(t *testing.T) {
+	vm := openTestManager(t)
+	stats, err := importFixture(t, &embeddedSink{vm: vm}, true)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if stats.Rows != 7 || stats.Failed != 2 || stats.Imported() != 5 {
+		t.Errorf("Stats = %+v, want 7 rows with 2 failed", stats)
+	}
+	coll, err := vm.GetCollection("docs")
+	if err != nil {
+		t.Fatalf("Collection was not created: %v", err)
+	}
+	if coll.Config.Dimensions != 3 {
+		t.Errorf("Inferred %d dimensions, want 3", coll.Config.Dimensions)
+	}
+	checkFixture(t, vm)
+
+	// Importing again finds every block index already taken
+	stats, err = importFixture(t, &embeddedSink{vm: vm}, true)
+	if err != nil {
+		t.Fatalf("Second import failed: %v", err)
+	}
+	if stats.Imported() != 0 {
+		t.Errorf("Second import wrote %d rows, want 0", stats.Imported())
+	}
+}
+
+func TestImport_AbortsOnBadRow(t *testing.T) {
+	vm := openTestManager(t)
+	stats, err := importFixture(t, &embeddedSink{vm: vm}, false)
+	if err == nil || !strings.Contains(err.Error(), "line 5") {
+		t.Fatalf("Expected an error for line 5, got %v", err)
+	}
+	if stats.Rows != 4 || stats.Failed != 1 {
+		t.Errorf("Stats = %+v, want 4 rows with 1 failed", stats)
+	}
+}
+
+func TestImport_RemoteTSV(t *testing.T) {
+	vm := openTestManager(t)
+	txMgr := transaction.NewManager(vm)
+	txMgr.Start()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go network.NewServer(0, txMgr).Serve(listener)
+
+	c, err := client.Dial(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+
+	data, err := os.ReadFile("testdata/vectors.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsv := strings.ReplaceAll(strings.ReplaceAll(string(data), ",", "\t"), "quoted\t with", "quoted, with")
+	delim, err := parseDelimiter(`\t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im := &importer{
+		sink:       &remoteSink{c: c},
+		collection: "docs",
+		dimensions: 3,
+		metric:     "l2",
+		delimiter:  delim,
+		keywordSep: ";",
+		batchSize:  100,
+		skipErrors: true,
+	}
+	stats, err := im.run(strings.NewReader(tsv))
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if stats.Rows != 7 || stats.Failed != 2 {
+		t.Errorf("Stats = %+v, want 7 rows with 2 failed", stats)
+	}
+	checkFixture(t, vm)
+}
@@ -0,0 +1,40 @@
+// Command repartition copies a WaddleMap data directory into a new one whose
+// records are spread over a different number of bucket files. The server
+// must not be running against the source directory; start it on the new
+// directory with -partition-count set to the new count.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+	"waddlemap/internal/logger"
+	"waddlemap/internal/storage"
+)
+
+func main() {
+	src := flag.String("src", "", "Data directory to read")
+	dst := flag.String("dst", "", "Data directory to create; must not exist or be empty")
+	partitions := flag.Int("partitions", 0, "Number of bucket files of the new directory, a power of 2")
+	flag.Parse()
+
+	if *src == "" || *dst == "" || *partitions == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := storage.ValidatePartitionCount(*partitions); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	logger.SetLevel(logger.LevelError) // Bucket index rebuilds are expected
+	start := time.Now()
+	stats, err := storage.Repartition(*src, *dst, *partitions)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Repartition failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Copied %d records of %d keys from %d to %d partitions into %s in %s\n",
+		stats.Records, stats.Keys, stats.FromPartitions, stats.ToPartitions, *dst, time.Since(start).Round(time.Millisecond))
+}
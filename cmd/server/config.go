@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"waddlemap/internal/logger"
+	"waddlemap/internal/network"
+	"waddlemap/internal/storage"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config holds the server settings that can be read from a TOML file with
+// --config. Keys missing from the file keep their defaults, and flags given
+// on the command line override both.
+type Config struct {
+	Port               int           `toml:"port"`
+	HTTPPort           int           `toml:"http_port"`
+	GRPCPort           int           `toml:"grpc_port"`
+	DataPath           string        `toml:"data_path"`
+	SyncMode           string        `toml:"sync_mode"`
+	PayloadSize        int           `toml:"payload_size"`
+	LogLevel           string        `toml:"log_level"`
+	LogFormat          string        `toml:"log_format"`
+	TraceLogLines      int           `toml:"trace_log_lines"` // Log lines kept per request trace, 0 disables
+	TLSCert            string        `toml:"tls_cert"`
+	TLSKey             string        `toml:"tls_key"`
+	ReadTimeout        time.Duration `toml:"read_timeout"`
+	WriteTimeout       time.Duration `toml:"write_timeout"`
+	MaxConnections     int           `toml:"max_connections"`
+	WALMaxSegmentBytes int64         `toml:"wal_max_segment_bytes"` // 0 uses the storage default
+	VectorCacheSize    int           `toml:"vector_cache_size"`     // 0 uses the storage default, negative disables
+	SearchCacheSize    int           `toml:"search_cache_size"`     // 0 uses the storage default, negative disables
+	PartitionCount     int           `toml:"partition_count"`       // Bucket files, a power of 2 fixed once data is written
+	TenantTokens       string        `toml:"tenant_tokens"`         // JSON file of token -> tenant ID; empty disables tenancy
+}
+
+// defaultConfig returns the settings used when neither a config file nor a
+// flag sets them.
+func defaultConfig() *Config {
+	return &Config{
+		Port:           6969,
+		HTTPPort:       network.DefaultHTTPPort,
+		GRPCPort:       network.DefaultGRPCPort,
+		DataPath:       "./waddlemap_db",
+		SyncMode:       "strict",
+		PayloadSize:    1024,
+		LogLevel:       "info",
+		LogFormat:      logger.FormatText,
+		TraceLogLines:  logger.DefaultTraceLines,
+		ReadTimeout:    30 * time.Second,
+		WriteTimeout:   30 * time.Second,
+		PartitionCount: storage.DefaultPartitionCount,
+	}
+}
+
+// loadConfig reads the TOML file at path over the defaults. Durations are
+// strings such as "30s". Unknown keys are an error, so typos are not
+// silently ignored.
+func loadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+	md, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("read config %s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return nil, fmt.Errorf("config %s: unknown keys: %s", path, strings.Join(keys, ", "))
+	}
+	return cfg, nil
+}
+
+// Validate checks that every setting is present and in range, and returns
+// all problems found joined into one error.
+func (c *Config) Validate() error {
+	var errs []error
+	checkPort := func(name string, port int, optional bool) {
+		switch {
+		case port == 0 && !optional:
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		case port < 0 || port > 65535:
+			errs = append(errs, fmt.Errorf("%s %d is out of range 0-65535", name, port))
+		}
+	}
+	checkPort("port", c.Port, false)
+	checkPort("http_port", c.HTTPPort, true)
+	checkPort("grpc_port", c.GRPCPort, true)
+
+	if c.DataPath == "" {
+		errs = append(errs, errors.New("data_path is required"))
+	}
+	if c.SyncMode != "strict" && c.SyncMode != "async" {
+		errs = append(errs, fmt.Errorf("sync_mode %q must be strict or async", c.SyncMode))
+	}
+	if c.PayloadSize <= 0 {
+		errs = append(errs, fmt.Errorf("payload_size %d must be positive", c.PayloadSize))
+	}
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		errs = append(errs, err)
+	}
+	if c.LogFormat != logger.FormatText && c.LogFormat != logger.FormatJSON {
+		errs = append(errs, fmt.Errorf("log_format %q must be %s or %s", c.LogFormat, logger.FormatText, logger.FormatJSON))
+	}
+	if c.TraceLogLines < 0 {
+		errs = append(errs, fmt.Errorf("trace_log_lines %d must not be negative", c.TraceLogLines))
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		errs = append(errs, errors.New("tls_cert and tls_key must be set together"))
+	}
+	if c.ReadTimeout < 0 {
+		errs = append(errs, fmt.Errorf("read_timeout %v must not be negative", c.ReadTimeout))
+	}
+	if c.WriteTimeout < 0 {
+		errs = append(errs, fmt.Errorf("write_timeout %v must not be negative", c.WriteTimeout))
+	}
+	if c.MaxConnections < 0 {
+		errs = append(errs, fmt.Errorf("max_connections %d must not be negative", c.MaxConnections))
+	}
+	if c.WALMaxSegmentBytes < 0 {
+		errs = append(errs, fmt.Errorf("wal_max_segment_bytes %d must not be negative", c.WALMaxSegmentBytes))
+	}
+	if err := storage.ValidatePartitionCount(c.PartitionCount); err != nil {
+		errs = append(errs, fmt.Errorf("partition_count: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// parseLogLevel maps a log_level setting to a logger level.
+func parseLogLevel(level string) (logger.Level, error) {
+	switch level {
+	case "error":
+		return logger.LevelError, nil
+	case "info":
+		return logger.LevelInfo, nil
+	case "debug":
+		return logger.LevelDebug, nil
+	}
+	return 0, fmt.Errorf("log_level %q must be error, info or debug", level)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig_ExampleFile(t *testing.T) {
+	cfg, err := loadConfig("../../waddlemap.example.toml")
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Example config is invalid: %v", err)
+	}
+	if cfg.ReadTimeout != 30*time.Second || cfg.WALMaxSegmentBytes != 64<<20 {
+		t.Errorf("Unexpected values: %+v", cfg)
+	}
+}
+
+func TestLoadConfig_KeepsDefaultsAndRejectsUnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.toml")
+	if err := os.WriteFile(path, []byte("port = 7000\nwrite_timeout = \"1m\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	want := defaultConfig()
+	want.Port, want.WriteTimeout = 7000, time.Minute
+	if *cfg != *want {
+		t.Errorf("loadConfig = %+v, want %+v", cfg, want)
+	}
+
+	if err := os.WriteFile(path, []byte("port = 7000\ndata_dir = \"x\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "data_dir") {
+		t.Errorf("Expected an error naming the unknown key, got %v", err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	if err := defaultConfig().Validate(); err != nil {
+		t.Fatalf("Default config is invalid: %v", err)
+	}
+
+	cfg := defaultConfig()
+	cfg.Port = 0
+	cfg.HTTPPort = 70000
+	cfg.DataPath = ""
+	cfg.SyncMode = "sometimes"
+	cfg.LogLevel = "trace"
+	cfg.TLSCert = "cert.pem"
+	cfg.ReadTimeout = -time.Second
+	cfg.PartitionCount = 24
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected an invalid config to fail validation")
+	}
+	for _, want := range []string{"port is required", "http_port 70000", "data_path", "sync_mode", "log_level", "tls_cert and tls_key", "read_timeout", "partition_count"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+}
@@ -2,24 +2,106 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 	"waddlemap/internal/logger"
+	"waddlemap/internal/metrics"
 	"waddlemap/internal/network"
+	"waddlemap/internal/replication"
 	"waddlemap/internal/storage"
 	"waddlemap/internal/transaction"
 	"waddlemap/internal/types"
 )
 
 func main() {
-	// Flags
-	port := flag.Int("port", 6969, "Port to listen on")
+	// Flags. Those backed by Config override the --config file when given.
+	def := defaultConfig()
+	configPath := flag.String("config", "", "TOML config file with the server settings (see waddlemap.example.toml)")
+	port := flag.Int("port", def.Port, "Port to listen on")
+	dataPath := flag.String("data-path", def.DataPath, "Directory holding the database files")
+	syncMode := flag.String("sync-mode", def.SyncMode, "Disk sync mode: strict or async")
+	payloadSize := flag.Int("payload-size", def.PayloadSize, "Payload size of the storage records in bytes")
+	logLevel := flag.String("log-level", def.LogLevel, "Log level: error, info or debug")
 	quiet := flag.Bool("quiet", false, "Disable info logging (log only errors)")
+	verbose := flag.Bool("verbose", false, "Also log individual appends and searches")
+	logFormat := flag.String("log-format", def.LogFormat, "Log format: text or json")
+	traceLogLines := flag.Int("trace-log-lines", def.TraceLogLines, "Log lines kept in memory per request ID for trace lookups (0 disables)")
+	idleTimeout := flag.Duration("idle-timeout", 5*time.Minute, "Close client connections idle for longer than this (0 disables)")
+	readTimeout := flag.Duration("read-timeout", def.ReadTimeout, "Close connections whose request body takes longer than this to arrive, and cancel searches running longer (0 disables)")
+	writeTimeout := flag.Duration("write-timeout", def.WriteTimeout, "Close connections that take longer than this to accept a response (0 disables)")
+	maxConnections := flag.Int("max-connections", def.MaxConnections, "Reject client connections beyond this many (0 = unlimited)")
+	walMaxSegment := flag.Int64("wal-max-segment-bytes", def.WALMaxSegmentBytes, "Rotate the WAL into a segment once it exceeds this size (0 = default)")
+	vectorCacheSize := flag.Int("vector-cache-size", def.VectorCacheSize, "Vectors kept in the LRU cache of lookups by ID (0 = default, negative disables)")
+	searchCacheSize := flag.Int("search-cache-size", def.SearchCacheSize, "Searches whose results are kept in the LRU cache of repeated searches (0 = default, negative disables)")
+	partitionCount := flag.Int("partition-count", def.PartitionCount, "Number of bucket files, a power of 2; must match the existing data (see cmd/repartition)")
+	tenantTokens := flag.String("tenant-tokens", def.TenantTokens, "JSON file mapping tenant tokens to tenant IDs; requires a token on every request and disables the HTTP and gRPC APIs")
+	expirySweep := flag.Duration("ttl-sweep-interval", storage.DefaultExpirySweepInterval, "How often blocks whose TTL has passed are removed (negative disables)")
+	httpPort := flag.Int("http-port", def.HTTPPort, "Port for the JSON REST API (0 disables)")
+	grpcPort := flag.Int("grpc-port", def.GRPCPort, "Port for the gRPC API (0 disables)")
+	metricsPort := flag.Int("metrics-port", metrics.DefaultPort, "Port for the Prometheus /metrics endpoint (0 disables)")
+	debugPort := flag.Int("debug-port", 0, "Port for the /debug HTTP endpoints (0 disables)")
+	debugKey := flag.String("debug-key", "", "Key required in the X-Debug-Key header for /debug endpoints")
+	pprofPort := flag.Int("pprof-port", 0, "Port for the net/http/pprof profiling endpoints (0 disables; do not expose publicly)")
+	tlsCert := flag.String("tls-cert", def.TLSCert, "TLS certificate file (enables TLS together with --tls-key)")
+	tlsKey := flag.String("tls-key", def.TLSKey, "TLS private key file")
+	rateLimitRPS := flag.Float64("rate-limit-rps", 0, "Requests per second allowed per client IP on the TCP port (0 disables)")
+	rateLimitBurst := flag.Int("rate-limit-burst", 0, "Requests a client IP may burst above --rate-limit-rps (0 = rps rounded up)")
+	repair := flag.Bool("repair", false, "Repair index inconsistencies in all collections before serving")
+	replicaOf := flag.String("replica-of", "", "Run as a read-only replica of the primary whose replication port is at host:port")
+	replicationPort := flag.Int("replication-port", 0, "Port replicas connect to for the WAL stream (0 disables)")
+	adaptiveEf := flag.Bool("adaptive-ef", false, "Tune the EfSearch of each collection to keep searches near --adaptive-ef-target")
+	adaptiveEfTarget := flag.Duration("adaptive-ef-target", storage.DefaultAdaptiveEfTarget, "Search latency --adaptive-ef aims for")
+	coalesceWindow := flag.Duration("coalesce-window", 0, "Buffer concurrent appends to a collection for this long and write them as one batch (0 disables)")
 	flag.Parse()
 
+	conf := def
+	if *configPath != "" {
+		var err error
+		if conf, err = loadConfig(*configPath); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+	}
+	overrides := map[string]func(){
+		"port":                  func() { conf.Port = *port },
+		"http-port":             func() { conf.HTTPPort = *httpPort },
+		"grpc-port":             func() { conf.GRPCPort = *grpcPort },
+		"data-path":             func() { conf.DataPath = *dataPath },
+		"sync-mode":             func() { conf.SyncMode = *syncMode },
+		"payload-size":          func() { conf.PayloadSize = *payloadSize },
+		"log-level":             func() { conf.LogLevel = *logLevel },
+		"log-format":            func() { conf.LogFormat = *logFormat },
+		"trace-log-lines":       func() { conf.TraceLogLines = *traceLogLines },
+		"tls-cert":              func() { conf.TLSCert = *tlsCert },
+		"tls-key":               func() { conf.TLSKey = *tlsKey },
+		"read-timeout":          func() { conf.ReadTimeout = *readTimeout },
+		"write-timeout":         func() { conf.WriteTimeout = *writeTimeout },
+		"max-connections":       func() { conf.MaxConnections = *maxConnections },
+		"wal-max-segment-bytes": func() { conf.WALMaxSegmentBytes = *walMaxSegment },
+		"vector-cache-size":     func() { conf.VectorCacheSize = *vectorCacheSize },
+		"search-cache-size":     func() { conf.SearchCacheSize = *searchCacheSize },
+		"partition-count":       func() { conf.PartitionCount = *partitionCount },
+		"tenant-tokens":         func() { conf.TenantTokens = *tenantTokens },
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if override, ok := overrides[f.Name]; ok {
+			override()
+		}
+	})
+	if *quiet {
+		conf.LogLevel = "error"
+	} else if *verbose {
+		conf.LogLevel = "debug"
+	}
+	if err := conf.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	// 0. Logging Setup
 	logFile, err := os.OpenFile("server.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
@@ -30,12 +112,15 @@ func main() {
 	// 0. Logging Setup
 	multiWriter := io.MultiWriter(os.Stdout, logFile)
 	logger.Setup(multiWriter)
-
-	if *quiet {
-		logger.SetLevel(logger.LevelError)
+	if err := logger.SetFormat(conf.LogFormat); err != nil {
+		log.Fatalf("Invalid log format: %v", err)
+	}
+	level, _ := parseLogLevel(conf.LogLevel) // Checked by Validate
+	logger.SetLevel(level)
+	if conf.TraceLogLines > 0 {
+		logger.SetTraceStore(logger.NewTraceStore(conf.TraceLogLines, logger.DefaultMaxTraces))
 	} else {
-		// Default Info
-		logger.SetLevel(logger.LevelInfo)
+		logger.SetTraceStore(nil)
 	}
 
 	logger.Info("----------------------------------------")
@@ -43,9 +128,19 @@ func main() {
 
 	// 1. Config
 	cfg := &types.DBSchemaConfig{
-		PayloadSize: 1024,
-		DataPath:    "./waddlemap_db",
-		SyncMode:    "strict",
+		PayloadSize: conf.PayloadSize,
+		DataPath:    conf.DataPath,
+		SyncMode:    conf.SyncMode,
+
+		ExpirySweepInterval: *expirySweep,
+		CoalescingEnabled:   *coalesceWindow > 0,
+		CoalescingWindow:    *coalesceWindow,
+		AdaptiveEfEnabled:   *adaptiveEf,
+		AdaptiveEfTarget:    *adaptiveEfTarget,
+		WALMaxSegmentBytes:  conf.WALMaxSegmentBytes,
+		VectorCacheSize:     conf.VectorCacheSize,
+		SearchCacheSize:     conf.SearchCacheSize,
+		PartitionCount:      conf.PartitionCount,
 	}
 
 	// 2. Storage
@@ -55,12 +150,69 @@ func main() {
 	}
 	defer storageMgr.Close()
 
+	if *repair {
+		reports, err := storageMgr.RepairCollections()
+		if err != nil {
+			logger.Fatal("Repair failed: %v", err)
+		}
+		for _, r := range reports {
+			logger.Info("Repaired %s: %d orphan vectors, %d missing vectors, %d keys rebuilt, %d keyword orphans",
+				r.Collection, r.OrphanVectors, r.MissingVectors, r.KeysRebuilt, r.KeywordOrphans)
+		}
+	}
+
+	if *replicaOf != "" {
+		replica, err := replication.NewReplica(*replicaOf, storageMgr, conf.DataPath)
+		if err != nil {
+			logger.Fatal("Failed to init replication: %v", err)
+		}
+		replica.Start()
+		defer replica.Stop()
+		logger.Info("Read-only replica of %s", *replicaOf)
+	}
+	if *replicationPort != 0 {
+		replicator := replication.NewReplicator(*replicationPort, storageMgr)
+		defer replicator.Close()
+		go func() {
+			logger.Info("Replication listening on port %d", *replicationPort)
+			if err := replicator.Start(); err != nil {
+				logger.Error("Replication server error: %v", err)
+			}
+		}()
+	}
+
 	// 3. Transaction Manager
 	txMgr := transaction.NewManager(storageMgr)
 	txMgr.Start()
 
 	// 4. Server
-	server := network.NewServer(*port, txMgr)
+	var server *network.Server
+	if conf.TLSCert != "" {
+		server, err = network.NewServerTLS(conf.Port, txMgr, conf.TLSCert, conf.TLSKey)
+		if err != nil {
+			logger.Fatal("Failed to init TLS: %v", err)
+		}
+		logger.Info("TLS enabled")
+	} else {
+		server = network.NewServer(conf.Port, txMgr)
+	}
+	server.IdleTimeout = *idleTimeout
+	server.ReadTimeout = conf.ReadTimeout
+	server.WriteTimeout = conf.WriteTimeout
+	server.MaxConnections = conf.MaxConnections
+	if *rateLimitRPS > 0 {
+		server.RateLimiter = network.NewIPRateLimiter(*rateLimitRPS, *rateLimitBurst)
+	}
+	if conf.TenantTokens != "" {
+		auth, err := network.LoadTenantAuth(conf.TenantTokens)
+		if err != nil {
+			logger.Fatal("Failed to load tenant tokens: %v", err)
+		}
+		server.Auth = auth
+		// The HTTP and gRPC APIs do not check tenant tokens
+		conf.HTTPPort, conf.GRPCPort = 0, 0
+		logger.Info("Tenant tokens required; HTTP and gRPC APIs disabled")
+	}
 
 	// Graceful Shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -72,7 +224,58 @@ func main() {
 		}
 	}()
 
-	logger.Info("Server started on port %d. Press Ctrl+C to stop.", *port)
+	if conf.HTTPPort != 0 {
+		httpServer := network.NewHTTPServer(conf.HTTPPort, storageMgr)
+		go func() {
+			if err := httpServer.Start(); err != nil {
+				logger.Error("HTTP server error: %v", err)
+			}
+		}()
+	}
+
+	if conf.GRPCPort != 0 {
+		grpcServer := network.NewGRPCServer(conf.GRPCPort, storageMgr)
+		defer grpcServer.Stop()
+		go func() {
+			if err := grpcServer.Start(); err != nil {
+				logger.Error("gRPC server error: %v", err)
+			}
+		}()
+	}
+
+	if *metricsPort != 0 {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler())
+		go func() {
+			logger.Info("Metrics listening on port %d", *metricsPort)
+			if err := http.ListenAndServe(fmt.Sprintf(":%d", *metricsPort), mux); err != nil {
+				logger.Error("Metrics server error: %v", err)
+			}
+		}()
+	}
+
+	if *debugPort != 0 {
+		if *debugKey == "" {
+			logger.Fatal("--debug-key is required when --debug-port is set")
+		}
+		debugServer := network.NewDebugServer(*debugPort, *debugKey, storageMgr)
+		go func() {
+			if err := debugServer.Start(); err != nil {
+				logger.Error("Debug server error: %v", err)
+			}
+		}()
+	}
+
+	if *pprofPort != 0 {
+		pprofServer := network.NewPprofServer(*pprofPort)
+		go func() {
+			if err := pprofServer.Start(); err != nil {
+				logger.Error("pprof server error: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Server started on port %d. Press Ctrl+C to stop.", conf.Port)
 	<-sigChan
 	logger.Info("Shutting down...")
 }
@@ -0,0 +1,133 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Log formats accepted by SetFormat.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// levelFatal is the slog level of Fatal entries.
+const levelFatal = slog.LevelError + 4
+
+var (
+	out         io.Writer    = os.Stderr // Set by Setup
+	jsonHandler slog.Handler             // Non-nil in JSON mode
+)
+
+// SetFormat selects how log entries are written: FormatText (the default,
+// via the standard log package) or FormatJSON (one slog JSON object per line
+// with time, level, msg, source and any contextual fields).
+func SetFormat(format string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	switch format {
+	case FormatText:
+		jsonHandler = nil
+	case FormatJSON:
+		jsonHandler = slog.NewJSONHandler(out, &slog.HandlerOptions{
+			AddSource: true,
+			Level:     slog.LevelDebug, // Filtering is done by SetLevel
+			ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.LevelKey && a.Value.Any() == levelFatal {
+					a.Value = slog.StringValue("FATAL")
+				}
+				return a
+			},
+		})
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+// DebugAttrs logs a structured debug entry. args are alternating keys and
+// values, as for slog.Logger.Info.
+func DebugAttrs(msg string, args ...any) {
+	if enabled(LevelDebug) {
+		outputAttrs(slog.LevelDebug, msg, args...)
+	}
+}
+
+// InfoAttrs logs a structured informative entry.
+func InfoAttrs(msg string, args ...any) {
+	if enabled(LevelInfo) {
+		outputAttrs(slog.LevelInfo, msg, args...)
+	}
+}
+
+// ErrorAttrs logs a structured error entry.
+func ErrorAttrs(msg string, args ...any) {
+	if enabled(LevelError) {
+		outputAttrs(slog.LevelError, msg, args...)
+	}
+}
+
+// Since returns the time elapsed since start in milliseconds, for the
+// duration_ms field.
+func Since(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+func currentHandler() slog.Handler {
+	mu.Lock()
+	defer mu.Unlock()
+	return jsonHandler
+}
+
+// outputAttrs writes a structured entry. In text mode the fields are appended
+// to the message as key=value pairs.
+func outputAttrs(level slog.Level, msg string, args ...any) {
+	if h := currentHandler(); h != nil {
+		emit(h, level, msg, args...)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(levelPrefix(level))
+	b.WriteString(msg)
+	r := slog.NewRecord(time.Time{}, level, "", 0)
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	})
+	// Calldepth 3 to skip this function, InfoAttrs/ErrorAttrs, and get to caller
+	log.Output(3, b.String())
+}
+
+// emit hands an entry to the JSON handler, attributing it to the caller of
+// the exported logging function.
+func emit(h slog.Handler, level slog.Level, msg string, args ...any) {
+	var pcs [1]uintptr
+	// Skip runtime.Callers, emit, output/outputAttrs and Info/InfoAttrs/...
+	runtime.Callers(4, pcs[:])
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(args...)
+	h.Handle(context.Background(), r)
+}
+
+func levelPrefix(level slog.Level) string {
+	switch level {
+	case slog.LevelDebug:
+		return "DEBUG: "
+	case slog.LevelError:
+		return "ERROR: "
+	case levelFatal:
+		return "FATAL: "
+	default:
+		return "INFO: "
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"sync"
 )
@@ -13,6 +14,7 @@ type Level int
 const (
 	LevelError Level = iota
 	LevelInfo
+	LevelDebug
 )
 
 var (
@@ -27,33 +29,55 @@ func SetLevel(l Level) {
 	currentLevel = l
 }
 
+// enabled reports whether messages at level l should be logged.
+func enabled(l Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return currentLevel >= l
+}
+
 // Setup initializes the standard logger output.
 func Setup(w io.Writer) {
+	mu.Lock()
+	out = w
+	mu.Unlock()
 	log.SetOutput(w)
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 }
 
+// Debug logs per-operation detail if the level allows.
+func Debug(format string, v ...interface{}) {
+	if enabled(LevelDebug) {
+		output(slog.LevelDebug, format, v...)
+	}
+}
+
 // Info logs informative messages if the level allows.
 func Info(format string, v ...interface{}) {
-	if currentLevel >= LevelInfo {
-		output("INFO: "+format, v...)
+	if enabled(LevelInfo) {
+		output(slog.LevelInfo, format, v...)
 	}
 }
 
 // Error logs error messages.
 func Error(format string, v ...interface{}) {
-	if currentLevel >= LevelError {
-		output("ERROR: "+format, v...)
+	if enabled(LevelError) {
+		output(slog.LevelError, format, v...)
 	}
 }
 
 // Fatal logs independent of error level and exits.
 func Fatal(format string, v ...interface{}) {
-	output("FATAL: "+format, v...)
+	output(levelFatal, format, v...)
 	os.Exit(1)
 }
 
-func output(format string, v ...interface{}) {
+func output(level slog.Level, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	if h := currentHandler(); h != nil {
+		emit(h, level, msg)
+		return
+	}
 	// Calldepth 3 to skip this function, Info/Error, and get to caller
-	log.Output(3, fmt.Sprintf(format, v...))
+	log.Output(3, levelPrefix(level)+msg)
 }
@@ -0,0 +1,174 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default limits of the trace store.
+const (
+	DefaultTraceLines = 100  // Lines kept per trace
+	DefaultMaxTraces  = 1000 // Traces kept before the oldest is dropped
+)
+
+// traceIDKey is the context key of the trace ID.
+type traceIDKey struct{}
+
+// WithTraceID returns a copy of ctx carrying traceID. Entries logged with
+// DebugContext, InfoContext or ErrorContext under it get a trace_id field and
+// are kept in the trace store.
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceID returns the trace ID carried by ctx, or "" if there is none.
+func TraceID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
+
+// NewTraceID returns a random 16-character hex ID for requests that do not
+// bring their own.
+func NewTraceID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// DebugContext logs a structured debug entry tagged with the trace ID of ctx.
+func DebugContext(ctx context.Context, msg string, args ...any) {
+	args = recordTrace(ctx, slog.LevelDebug, msg, args)
+	if enabled(LevelDebug) {
+		outputAttrs(slog.LevelDebug, msg, args...)
+	}
+}
+
+// InfoContext logs a structured informative entry tagged with the trace ID of
+// ctx.
+func InfoContext(ctx context.Context, msg string, args ...any) {
+	args = recordTrace(ctx, slog.LevelInfo, msg, args)
+	if enabled(LevelInfo) {
+		outputAttrs(slog.LevelInfo, msg, args...)
+	}
+}
+
+// ErrorContext logs a structured error entry tagged with the trace ID of ctx.
+func ErrorContext(ctx context.Context, msg string, args ...any) {
+	args = recordTrace(ctx, slog.LevelError, msg, args)
+	if enabled(LevelError) {
+		outputAttrs(slog.LevelError, msg, args...)
+	}
+}
+
+// recordTrace prepends the trace_id field of ctx to args and records the
+// entry in the trace store whatever the log level, so that a single request
+// can be inspected without enabling debug logging for all of them.
+func recordTrace(ctx context.Context, level slog.Level, msg string, args []any) []any {
+	id := TraceID(ctx)
+	if id == "" {
+		return args
+	}
+	args = append([]any{"trace_id", id}, args...)
+	if ts := Traces(); ts != nil {
+		ts.Record(id, traceLine(level, msg, args...))
+	}
+	return args
+}
+
+// traceLine formats an entry for the trace store like a text log line.
+func traceLine(level slog.Level, msg string, args ...any) string {
+	var b strings.Builder
+	b.WriteString(time.Now().UTC().Format("2006-01-02T15:04:05.000Z "))
+	b.WriteString(levelPrefix(level))
+	b.WriteString(msg)
+	r := slog.NewRecord(time.Time{}, level, "", 0)
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	})
+	return b.String()
+}
+
+// TraceStore keeps the log lines of recent traces in memory, up to a number
+// of lines per trace and a number of traces. Lines past the limit of a trace
+// are dropped; when a new trace would exceed the trace limit, the oldest
+// trace is forgotten.
+type TraceStore struct {
+	mu        sync.Mutex
+	maxLines  int
+	maxTraces int
+	lines     map[string][]string
+	order     []string // Trace IDs, oldest first
+}
+
+// NewTraceStore creates a store keeping up to maxLines lines for each of the
+// last maxTraces traces.
+func NewTraceStore(maxLines, maxTraces int) *TraceStore {
+	return &TraceStore{
+		maxLines:  max(maxLines, 1),
+		maxTraces: max(maxTraces, 1),
+		lines:     make(map[string][]string),
+	}
+}
+
+// Record appends line to the lines of traceID.
+func (ts *TraceStore) Record(traceID, line string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	lines, ok := ts.lines[traceID]
+	if !ok {
+		if len(ts.order) >= ts.maxTraces {
+			delete(ts.lines, ts.order[0])
+			ts.order = ts.order[1:]
+		}
+		ts.order = append(ts.order, traceID)
+	}
+	if len(lines) < ts.maxLines {
+		ts.lines[traceID] = append(lines, line)
+	}
+}
+
+// Lines returns a copy of the lines recorded for traceID, oldest first, or
+// nil if the trace is unknown or was dropped.
+func (ts *TraceStore) Lines(traceID string) []string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	lines, ok := ts.lines[traceID]
+	if !ok {
+		return nil
+	}
+	return append([]string(nil), lines...)
+}
+
+var traces = NewTraceStore(DefaultTraceLines, DefaultMaxTraces)
+
+// SetTraceStore replaces the store traced entries are recorded in. A nil
+// store disables recording.
+func SetTraceStore(ts *TraceStore) {
+	mu.Lock()
+	defer mu.Unlock()
+	traces = ts
+}
+
+// Traces returns the store traced entries are recorded in, or nil if
+// recording is disabled.
+func Traces() *TraceStore {
+	mu.Lock()
+	defer mu.Unlock()
+	return traces
+}
@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTraceStore_Limits(t *testing.T) {
+	ts := NewTraceStore(2, 2)
+	for _, id := range []string{"a", "a", "a", "b", "c"} {
+		ts.Record(id, "line of "+id)
+	}
+	if lines := ts.Lines("a"); lines != nil {
+		t.Errorf("Oldest trace should be dropped, got %q", lines)
+	}
+	if lines := ts.Lines("b"); len(lines) != 1 || lines[0] != "line of b" {
+		t.Errorf("Lines(b) = %q", lines)
+	}
+
+	ts = NewTraceStore(2, 10)
+	for i := range 3 {
+		ts.Record("a", fmt.Sprint(i))
+	}
+	if lines := ts.Lines("a"); len(lines) != 2 || lines[0] != "0" || lines[1] != "1" {
+		t.Errorf("Lines past the limit should be dropped, got %q", lines)
+	}
+}
+
+func TestContextLogging_RecordsTrace(t *testing.T) {
+	old := Traces()
+	defer SetTraceStore(old)
+	ts := NewTraceStore(10, 10)
+	SetTraceStore(ts)
+	SetLevel(LevelError)
+	defer SetLevel(LevelInfo)
+
+	ctx := WithTraceID(context.Background(), "req-1")
+	DebugContext(ctx, "below the log level", "key", "k")
+	InfoContext(context.Background(), "untraced")
+	lines := ts.Lines("req-1")
+	if len(lines) != 1 || !strings.Contains(lines[0], "DEBUG: below the log level trace_id=req-1 key=k") {
+		t.Errorf("Lines(req-1) = %q", lines)
+	}
+	if TraceID(ctx) != "req-1" || TraceID(context.Background()) != "" {
+		t.Errorf("TraceID did not round trip")
+	}
+}
@@ -0,0 +1,84 @@
+// Package metrics defines the Prometheus metrics exported by the server.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultPort is the port the standalone metrics listener uses unless configured otherwise.
+const DefaultPort = 9090
+
+// Search request statuses.
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Vector and search cache lookup results.
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+var (
+	SearchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "waddlemap_search_duration_seconds",
+		Help:    "Time spent serving vector searches.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"collection"})
+
+	AppendDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "waddlemap_append_duration_seconds",
+		Help:    "Time spent appending a single block.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	VectorsTotal = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "waddlemap_vectors_total",
+		Help: "Number of vectors stored per collection.",
+	}, []string{"collection"})
+
+	WALSizeBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "waddlemap_wal_size_bytes",
+		Help: "Size of the live write-ahead log file after the last checkpoint.",
+	})
+
+	IndexSavesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "waddlemap_index_saves_total",
+		Help: "Number of times collection indexes were saved to disk.",
+	})
+
+	SearchRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "waddlemap_search_requests_total",
+		Help: "Number of vector searches by collection and status.",
+	}, []string{"collection", "status"})
+
+	VectorCacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "waddlemap_vector_cache_requests_total",
+		Help: "Number of vector cache lookups by result.",
+	}, []string{"result"})
+
+	VectorCacheEvictionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "waddlemap_vector_cache_evictions_total",
+		Help: "Number of vectors evicted from the vector cache to make room.",
+	})
+
+	SearchCacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "waddlemap_search_cache_requests_total",
+		Help: "Number of search cache lookups by result.",
+	}, []string{"result"})
+
+	SearchCacheEvictionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "waddlemap_search_cache_evictions_total",
+		Help: "Number of searches evicted from the search cache to make room.",
+	})
+)
+
+// Handler serves the default Prometheus registry.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,122 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"waddlemap/internal/storage"
+	pb "waddlemap/proto"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// errUnauthorized is returned for requests without a known tenant token.
+var errUnauthorized = errors.New("UNAUTHORIZED: missing or unknown tenant token")
+
+// TenantAuth maps tenant tokens to tenant IDs. A Server with one requires
+// every request to carry a known tenant_token and confines it to the
+// collections of that tenant: collection names in requests are prefixed with
+// the tenant ID (see storage.TenantCollectionName) and collections of other
+// tenants are left out of listings and events. A connection serves a single
+// tenant.
+type TenantAuth struct {
+	tokens map[string]string // Token -> tenant ID
+}
+
+// NewTenantAuth creates an authenticator from a map of token to tenant ID.
+func NewTenantAuth(tokens map[string]string) (*TenantAuth, error) {
+	for token, tenant := range tokens {
+		if token == "" {
+			return nil, errors.New("tenant token cannot be empty")
+		}
+		if err := storage.ValidateTenantID(tenant); err != nil {
+			return nil, err
+		}
+	}
+	return &TenantAuth{tokens: tokens}, nil
+}
+
+// LoadTenantAuth reads a JSON object mapping tokens to tenant IDs from path,
+// such as {"3f9c...": "acme", "b71e...": "globex"}.
+func LoadTenantAuth(path string) (*TenantAuth, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tenant tokens: %w", err)
+	}
+	var tokens map[string]string
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("parse tenant tokens %s: %w", path, err)
+	}
+	return NewTenantAuth(tokens)
+}
+
+// Tenant returns the tenant ID of token.
+func (a *TenantAuth) Tenant(token string) (string, bool) {
+	tenant, ok := a.tokens[token]
+	return tenant, ok && token != ""
+}
+
+// scopeRequest rewrites the collection names in the operation of req into
+// the namespace of tenant. Every string field called collection is scoped,
+// at any depth, and so is the name of collection operations. Empty names are
+// left empty.
+func scopeRequest(req *pb.WaddleRequest, tenant string) error {
+	m := req.ProtoReflect()
+	fd := m.WhichOneof(m.Descriptor().Oneofs().ByName("operation"))
+	if fd == nil {
+		return nil
+	}
+	return scopeMessage(m.Mutable(fd).Message(), tenant, true)
+}
+
+func scopeMessage(m protoreflect.Message, tenant string, operation bool) error {
+	fields := m.Descriptor().Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		switch {
+		case fd.IsMap():
+		case fd.Kind() == protoreflect.StringKind && !fd.IsList() &&
+			(fd.Name() == "collection" || operation && fd.Name() == "name"):
+			name := m.Get(fd).String()
+			if name == "" {
+				continue
+			}
+			scoped, err := storage.TenantCollectionName(tenant, name)
+			if err != nil {
+				return err
+			}
+			m.Set(fd, protoreflect.ValueOfString(scoped))
+		case fd.Kind() == protoreflect.MessageKind && fd.IsList():
+			list := m.Get(fd).List()
+			for j := range list.Len() {
+				if err := scopeMessage(list.Get(j).Message(), tenant, false); err != nil {
+					return err
+				}
+			}
+		case fd.Kind() == protoreflect.MessageKind && m.Has(fd):
+			if err := scopeMessage(m.Mutable(fd).Message(), tenant, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unscopeResponse restricts a collection listing to the collections of
+// tenant, under the names the tenant gave them.
+func unscopeResponse(resp *pb.WaddleResponse, tenant string) {
+	list, ok := resp.Result.(*pb.WaddleResponse_ColList)
+	if !ok {
+		return
+	}
+	var cols []*pb.Collection
+	for _, col := range list.ColList.Collections {
+		if name, ok := storage.SplitTenantCollectionName(tenant, col.Name); ok {
+			col.Name = name
+			cols = append(cols, col)
+		}
+	}
+	list.ColList.Collections = cols
+}
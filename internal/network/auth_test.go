@@ -0,0 +1,124 @@
+package network
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"waddlemap/internal/storage"
+	"waddlemap/internal/transaction"
+	"waddlemap/internal/types"
+	pb "waddlemap/proto"
+)
+
+func TestServer_TenantIsolation(t *testing.T) {
+	dir := t.TempDir()
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: dir, SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	defer vm.Close()
+	txMgr := transaction.NewManager(vm)
+	txMgr.Start()
+
+	tokensPath := filepath.Join(dir, "tokens.json")
+	if err := os.WriteFile(tokensPath, []byte(`{"acme-token": "acme", "globex-token": "globex"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := LoadTenantAuth(tokensPath)
+	if err != nil {
+		t.Fatalf("LoadTenantAuth failed: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(0, txMgr)
+	server.Auth = auth
+	go server.Serve(listener)
+	defer listener.Close()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	acme, globex, globexEvents := dial(), dial(), dial()
+	do := func(conn net.Conn, token string, req *pb.WaddleRequest) *pb.WaddleResponse {
+		req.TenantToken = token
+		return roundTrip(t, conn, req)
+	}
+	create := func(conn net.Conn, token string) {
+		resp := do(conn, token, &pb.WaddleRequest{Operation: &pb.WaddleRequest_CreateCol{CreateCol: &pb.CreateCollectionRequest{Name: "docs", Dimensions: 2, Metric: "l2"}}})
+		if !resp.Success {
+			t.Fatalf("CreateCollection with %s failed: %s", token, resp.ErrorMessage)
+		}
+	}
+	appendBlock := func(conn net.Conn, token, primary string) {
+		resp := do(conn, token, &pb.WaddleRequest{Operation: &pb.WaddleRequest_AppendBlock{AppendBlock: &pb.AppendBlockRequest{
+			Collection: "docs", Key: "k", Block: &pb.BlockData{Primary: primary, Vector: []float32{1, 0}},
+		}}})
+		if !resp.Success {
+			t.Fatalf("AppendBlock with %s failed: %s", token, resp.ErrorMessage)
+		}
+	}
+	getBlock := func(conn net.Conn, token string) *pb.WaddleResponse {
+		return do(conn, token, &pb.WaddleRequest{Operation: &pb.WaddleRequest_GetBlock{GetBlock: &pb.GetBlockRequest{Collection: "docs", Key: "k"}}})
+	}
+
+	// Requests without a known token are refused
+	for _, token := range []string{"", "wrong"} {
+		resp := do(dial(), token, &pb.WaddleRequest{Operation: &pb.WaddleRequest_ListCols{ListCols: &pb.ListCollectionsRequest{}}})
+		if resp.Success || resp.ErrorCode != pb.ErrorCode_UNAUTHORIZED {
+			t.Errorf("Expected token %q to be unauthorized, got %+v", token, resp)
+		}
+	}
+
+	// Both tenants get their own "docs"
+	create(acme, "acme-token")
+	create(globex, "globex-token")
+	sub := do(globexEvents, "globex-token", &pb.WaddleRequest{Operation: &pb.WaddleRequest_Subscribe{Subscribe: &pb.SubscribeRequest{SubscriptionId: "all"}}})
+	if !sub.Success {
+		t.Fatalf("Subscribe failed: %s", sub.ErrorMessage)
+	}
+	appendBlock(acme, "acme-token", "acme data")
+	appendBlock(globex, "globex-token", "globex data")
+
+	// The first event globex sees is its own append, under its own name
+	ev := readResponse(t, globexEvents)
+	if ev.GetEvent() == nil || ev.GetEvent().Collection != "docs" {
+		t.Fatalf("Expected globex's append event on docs, got %+v", ev)
+	}
+	if resp := getBlock(globex, "globex-token"); resp.GetBlock().GetPrimary() != "globex data" {
+		t.Errorf("globex read %+v", resp)
+	}
+	if resp := getBlock(acme, "acme-token"); resp.GetBlock().GetPrimary() != "acme data" {
+		t.Errorf("acme read %+v", resp)
+	}
+
+	resp := do(globex, "globex-token", &pb.WaddleRequest{Operation: &pb.WaddleRequest_ListCols{ListCols: &pb.ListCollectionsRequest{}}})
+	if cols := resp.GetColList().GetCollections(); len(cols) != 1 || cols[0].Name != "docs" {
+		t.Errorf("Expected globex to list only its docs, got %+v", cols)
+	}
+
+	// Names cannot escape the namespace, and a connection keeps its tenant
+	for _, name := range []string{"acme/docs", "../acme/docs", ".."} {
+		resp := do(globex, "globex-token", &pb.WaddleRequest{Operation: &pb.WaddleRequest_GetBlock{GetBlock: &pb.GetBlockRequest{Collection: name, Key: "k"}}})
+		if resp.Success {
+			t.Errorf("Expected collection %q to be rejected, got %+v", name, resp)
+		}
+	}
+	if resp := getBlock(globex, "acme-token"); resp.Success || resp.ErrorCode != pb.ErrorCode_UNAUTHORIZED {
+		t.Errorf("Expected another tenant's token to be refused on globex's connection, got %+v", resp)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "indexes", "acme", "docs", "meta.json")); err != nil {
+		t.Errorf("Expected acme's collection under indexes/acme/docs: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package network
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"waddlemap/internal/logger"
+	"waddlemap/internal/storage"
+)
+
+// DefaultDocMapSampleLimit is the number of forward index entries returned
+// by the docmap-sample endpoint when no limit is given.
+const DefaultDocMapSampleLimit = 100
+
+// DebugServer exposes in-memory state as JSON for diagnosing a live server,
+// along with operator endpoints under /admin.
+// Every request must carry the configured key in the X-Debug-Key header.
+type DebugServer struct {
+	Port    int
+	Key     string
+	Storage *storage.VectorManager
+}
+
+func NewDebugServer(port int, key string, vm *storage.VectorManager) *DebugServer {
+	return &DebugServer{
+		Port:    port,
+		Key:     key,
+		Storage: vm,
+	}
+}
+
+// Start listens on the debug port and serves requests until the listener fails.
+func (d *DebugServer) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", d.Port))
+	if err != nil {
+		return err
+	}
+	logger.Info("Debug endpoints listening on port %d", d.Port)
+	return http.Serve(listener, d.Handler())
+}
+
+// Handler returns the HTTP handler serving the /debug endpoints.
+func (d *DebugServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/collections", d.handleCollections)
+	mux.HandleFunc("GET /debug/collections/{name}/docmap-sample", d.handleDocMapSample)
+	mux.HandleFunc("GET /debug/wal-size", d.handleWALSize)
+	mux.HandleFunc("GET /debug/buckets", d.handleBuckets)
+	mux.HandleFunc("GET /admin/storage-stats", d.handleStorageStats)
+	return d.authorize(mux)
+}
+
+// authorize rejects requests whose X-Debug-Key header does not match the key.
+// An empty key rejects everything.
+func (d *DebugServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get("X-Debug-Key")
+		if d.Key == "" || subtle.ConstantTimeCompare([]byte(got), []byte(d.Key)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type debugCollection struct {
+	Name       string             `json:"name"`
+	Dimensions uint32             `json:"dimensions"`
+	Metric     string             `json:"metric"`
+	Vectors    uint64             `json:"vectors"`
+	Dirty      bool               `json:"dirty"`
+	IndexType  string             `json:"index_type"`
+	Compressed string             `json:"index_compression,omitempty"`
+	HNSW       *storage.HNSWStats `json:"hnsw,omitempty"` // Nil for flat collections
+}
+
+func (d *DebugServer) handleCollections(w http.ResponseWriter, r *http.Request) {
+	configs := d.Storage.ListCollections()
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name < configs[j].Name })
+
+	result := make([]debugCollection, 0, len(configs))
+	for _, cfg := range configs {
+		coll, err := d.Storage.GetCollection(cfg.Name)
+		if err != nil {
+			continue // Deleted concurrently
+		}
+		entry := debugCollection{
+			Name:       cfg.Name,
+			Dimensions: cfg.Dimensions,
+			Metric:     string(cfg.Metric),
+			Vectors:    coll.Count(),
+			Dirty:      coll.IsDirty(),
+			IndexType:  cfg.IndexType,
+			Compressed: cfg.IndexCompression,
+		}
+		if coll.HNSWIndex != nil {
+			stats := coll.HNSWIndex.Stats()
+			entry.HNSW = &stats
+		}
+		result = append(result, entry)
+	}
+	writeJSON(w, result)
+}
+
+type debugDocLocation struct {
+	VectorID uint64 `json:"vector_id"`
+	Key      string `json:"key"`
+	Index    uint32 `json:"index"`
+}
+
+func (d *DebugServer) handleDocMapSample(w http.ResponseWriter, r *http.Request) {
+	coll, err := d.Storage.GetCollection(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	limit := DefaultDocMapSampleLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sample := make([]debugDocLocation, 0, min(limit, coll.DocMap.Count()))
+	coll.DocMap.Range(func(id uint64, loc storage.DocLocation) bool {
+		if len(sample) >= limit {
+			return false
+		}
+		sample = append(sample, debugDocLocation{VectorID: id, Key: loc.Key, Index: loc.Index})
+		return true
+	})
+	writeJSON(w, sample)
+}
+
+func (d *DebugServer) handleWALSize(w http.ResponseWriter, r *http.Request) {
+	size, err := d.Storage.WALSize()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]int64{"bytes": size})
+}
+
+func (d *DebugServer) handleBuckets(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.Storage.BucketInfos())
+}
+
+// handleStorageStats scans all payloads; the scan stops if the client disconnects.
+func (d *DebugServer) handleStorageStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := d.Storage.StorageStatsContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, stats)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Failed to encode debug response: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package network
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"waddlemap/internal/storage"
+	"waddlemap/internal/types"
+)
+
+func newDebugTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	t.Cleanup(func() { vm.Close() })
+
+	if err := vm.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := vm.AppendBlock("docs", "doc1", &types.BlockData{Primary: "p", Vector: []float32{float32(i), 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := httptest.NewServer(NewDebugServer(0, "secret", vm).Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func debugGet(t *testing.T, url, key string, out interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("X-Debug-Key", key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestDebugServer_RequiresKey(t *testing.T) {
+	srv := newDebugTestServer(t)
+
+	for _, key := range []string{"", "wrong"} {
+		if code := debugGet(t, srv.URL+"/debug/collections", key, nil); code != http.StatusForbidden {
+			t.Errorf("Key %q: expected 403, got %d", key, code)
+		}
+	}
+}
+
+func TestDebugServer_Endpoints(t *testing.T) {
+	srv := newDebugTestServer(t)
+
+	var colls []debugCollection
+	if code := debugGet(t, srv.URL+"/debug/collections", "secret", &colls); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(colls) != 1 || colls[0].Name != "docs" || colls[0].Vectors != 5 || colls[0].HNSW.Nodes != 5 {
+		t.Errorf("Unexpected collections response: %+v", colls)
+	}
+
+	var sample []debugDocLocation
+	if code := debugGet(t, srv.URL+"/debug/collections/docs/docmap-sample?limit=3", "secret", &sample); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(sample) != 3 || sample[0].Key != "doc1" || sample[0].Index != 0 {
+		t.Errorf("Unexpected docmap sample: %+v", sample)
+	}
+	if code := debugGet(t, srv.URL+"/debug/collections/missing/docmap-sample", "secret", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing collection, got %d", code)
+	}
+	if code := debugGet(t, srv.URL+"/debug/collections/docs/docmap-sample?limit=x", "secret", nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid limit, got %d", code)
+	}
+
+	var wal map[string]int64
+	if code := debugGet(t, srv.URL+"/debug/wal-size", "secret", &wal); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if wal["bytes"] <= 0 {
+		t.Errorf("Expected non-empty WAL, got %v", wal)
+	}
+
+	var stats storage.StorageStats
+	if code := debugGet(t, srv.URL+"/admin/storage-stats", "secret", &stats); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if stats.Payload.Histogram["0-1KB"] != 5 || len(stats.Collections) != 1 || stats.Collections[0].Name != "docs" {
+		t.Errorf("Unexpected storage stats: %+v", stats)
+	}
+
+	var buckets []storage.BucketInfo
+	if code := debugGet(t, srv.URL+"/debug/buckets", "secret", &buckets); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(buckets) != storage.DefaultPartitionCount {
+		t.Fatalf("Expected %d buckets, got %d", storage.DefaultPartitionCount, len(buckets))
+	}
+	var records int
+	for _, b := range buckets {
+		records += b.RecordCount
+	}
+	if records != 5 {
+		t.Errorf("Expected 5 records across buckets, got %d", records)
+	}
+}
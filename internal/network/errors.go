@@ -0,0 +1,31 @@
+package network
+
+import (
+	"errors"
+
+	"waddlemap/internal/storage"
+	"waddlemap/internal/types"
+	pb "waddlemap/proto"
+)
+
+// errorCode classifies err for the error_code of a response. Errors the
+// storage layer does not classify get ERROR_CODE_UNSPECIFIED.
+func errorCode(err error) pb.ErrorCode {
+	switch {
+	case errors.Is(err, errUnauthorized):
+		return pb.ErrorCode_UNAUTHORIZED
+	case errors.Is(err, types.ErrCollectionNotFound), errors.Is(err, types.ErrKeyNotFound), errors.Is(err, storage.ErrExpired):
+		return pb.ErrorCode_NOT_FOUND
+	case errors.Is(err, types.ErrDimensionMismatch), errors.Is(err, types.ErrMetricMismatch), errors.Is(err, types.ErrInvalidConfig):
+		return pb.ErrorCode_INVALID_ARGUMENT
+	case errors.Is(err, types.ErrDuplicateID):
+		return pb.ErrorCode_ALREADY_EXISTS
+	case errors.Is(err, types.ErrStorageFull):
+		return pb.ErrorCode_RESOURCE_EXHAUSTED
+	case errors.Is(err, types.ErrChecksumMismatch), errors.Is(err, types.ErrIndexCorrupted):
+		return pb.ErrorCode_DATA_CORRUPTED
+	case errors.Is(err, types.ErrVersionConflict):
+		return pb.ErrorCode_VERSION_CONFLICT
+	}
+	return pb.ErrorCode_ERROR_CODE_UNSPECIFIED
+}
@@ -0,0 +1,127 @@
+package network
+
+import (
+	"sync"
+
+	"waddlemap/internal/storage"
+	pb "waddlemap/proto"
+)
+
+// Event types delivered to subscriptions.
+const (
+	EventAppend = "append" // AppendBlock, BatchAppend
+	EventUpdate = "update" // UpdateBlock, ReplaceBlock, UpdateValueConditional
+	EventDelete = "delete" // DeleteKey
+	EventDrop   = "drop"   // DeleteCollection
+)
+
+// subscriptionBuffer is the number of events queued per subscription before
+// further events are dropped.
+const subscriptionBuffer = 256
+
+// subscription is a single Subscribe registration on a connection.
+type subscription struct {
+	id         string
+	collection string          // Empty matches every collection
+	eventTypes map[string]bool // Empty matches every event type
+	ch         chan *pb.Event
+
+	// tenant, on tenant connections, restricts events to the collections of
+	// the tenant, which are delivered under their unprefixed names.
+	tenant string
+}
+
+func (s *subscription) matches(ev *pb.Event) bool {
+	if s.collection != "" && s.collection != ev.Collection {
+		return false
+	}
+	if _, ok := storage.SplitTenantCollectionName(s.tenant, ev.Collection); s.tenant != "" && !ok {
+		return false
+	}
+	return len(s.eventTypes) == 0 || s.eventTypes[ev.EventType]
+}
+
+// eventHub fans out events from successful writes to every matching subscription
+// on every connection.
+type eventHub struct {
+	mu   sync.RWMutex
+	subs map[chan *pb.Event]*subscription
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[chan *pb.Event]*subscription)}
+}
+
+func (h *eventHub) subscribe(sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[sub.ch] = sub
+}
+
+// unsubscribe removes the subscription delivering on ch. Once it returns, no
+// further events are sent on ch and the caller may close it.
+func (h *eventHub) unsubscribe(ch chan *pb.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, ch)
+}
+
+// publish delivers events to matching subscriptions. A subscription whose
+// buffer is full misses the event rather than stalling the writer.
+func (h *eventHub) publish(events []*pb.Event) {
+	if len(events) == 0 {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, sub := range h.subs {
+		for _, ev := range events {
+			if !sub.matches(ev) {
+				continue
+			}
+			collection := ev.Collection
+			if sub.tenant != "" {
+				collection, _ = storage.SplitTenantCollectionName(sub.tenant, collection)
+			}
+			select {
+			case sub.ch <- &pb.Event{
+				SubscriptionId: sub.id,
+				EventType:      ev.EventType,
+				Collection:     collection,
+				Key:            ev.Key,
+			}:
+			default:
+			}
+		}
+	}
+}
+
+// eventsFor returns the events produced by a successfully applied request.
+func eventsFor(req *pb.WaddleRequest) []*pb.Event {
+	switch op := req.Operation.(type) {
+	case *pb.WaddleRequest_AppendBlock:
+		return []*pb.Event{{EventType: EventAppend, Collection: op.AppendBlock.Collection, Key: op.AppendBlock.Key}}
+	case *pb.WaddleRequest_BatchAppend:
+		// One event per distinct key in the batch
+		var events []*pb.Event
+		seen := make(map[string]bool)
+		for _, r := range op.BatchAppend.Requests {
+			if !seen[r.Key] {
+				seen[r.Key] = true
+				events = append(events, &pb.Event{EventType: EventAppend, Collection: op.BatchAppend.Collection, Key: r.Key})
+			}
+		}
+		return events
+	case *pb.WaddleRequest_UpdateBlock:
+		return []*pb.Event{{EventType: EventUpdate, Collection: op.UpdateBlock.Collection, Key: op.UpdateBlock.Key}}
+	case *pb.WaddleRequest_ReplaceBlock:
+		return []*pb.Event{{EventType: EventUpdate, Collection: op.ReplaceBlock.Collection, Key: op.ReplaceBlock.Key}}
+	case *pb.WaddleRequest_UpdateConditional:
+		return []*pb.Event{{EventType: EventUpdate, Collection: op.UpdateConditional.Collection, Key: op.UpdateConditional.Key}}
+	case *pb.WaddleRequest_DeleteKey:
+		return []*pb.Event{{EventType: EventDelete, Collection: op.DeleteKey.Collection, Key: op.DeleteKey.Key}}
+	case *pb.WaddleRequest_DeleteCol:
+		return []*pb.Event{{EventType: EventDrop, Collection: op.DeleteCol.Name}}
+	}
+	return nil
+}
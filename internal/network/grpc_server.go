@@ -0,0 +1,238 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	waddlegrpc "waddlemap/client/grpc"
+	"waddlemap/internal/logger"
+	"waddlemap/internal/storage"
+	"waddlemap/internal/types"
+	pb "waddlemap/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultGRPCPort is the port the gRPC service listens on unless configured otherwise.
+const DefaultGRPCPort = 6968
+
+// GRPCServer serves the WaddleMap gRPC service defined in proto/waddlemap.proto.
+// Like HTTPServer it calls the VectorManager directly instead of going through
+// the transaction manager's request channel.
+type GRPCServer struct {
+	waddlegrpc.UnimplementedWaddleMapServer
+
+	Port    int
+	Storage *storage.VectorManager
+
+	server *grpc.Server
+}
+
+func NewGRPCServer(port int, vm *storage.VectorManager) *GRPCServer {
+	g := &GRPCServer{
+		Port:    port,
+		Storage: vm,
+		server:  grpc.NewServer(grpc.UnaryInterceptor(traceUnary)),
+	}
+	waddlegrpc.RegisterWaddleMapServer(g.server, g)
+	return g
+}
+
+// requestIDMetadata is the gRPC metadata key carrying the trace ID of a call,
+// the counterpart of the HTTP requestIDHeader.
+const requestIDMetadata = "x-request-id"
+
+// traceUnary tags each call with the trace ID of its requestIDMetadata,
+// generating one if it is missing, and returns the ID in the response header.
+func traceUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDMetadata); len(ids) > 0 && len(ids[0]) <= maxRequestIDLength {
+			id = ids[0]
+		}
+	}
+	if id == "" {
+		id = logger.NewTraceID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+	ctx = logger.WithTraceID(ctx, id)
+	logger.DebugContext(ctx, "grpc request", "method", info.FullMethod)
+	return handler(ctx, req)
+}
+
+// Start listens on the gRPC port and serves requests until Stop is called.
+func (g *GRPCServer) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", g.Port))
+	if err != nil {
+		return err
+	}
+	logger.Info("gRPC API listening on port %d", g.Port)
+	return g.Serve(listener)
+}
+
+// Serve accepts gRPC connections on the listener until Stop is called.
+func (g *GRPCServer) Serve(listener net.Listener) error {
+	return g.server.Serve(listener)
+}
+
+// Stop closes the listener and all connections, waiting for in-flight
+// requests to finish.
+func (g *GRPCServer) Stop() {
+	g.server.GracefulStop()
+}
+
+func (g *GRPCServer) CreateCollection(_ context.Context, req *pb.CreateCollectionRequest) (*waddlegrpc.CreateCollectionResponse, error) {
+	if req.Name == "" || req.Dimensions == 0 {
+		return nil, status.Error(codes.InvalidArgument, "name and dimensions are required")
+	}
+
+	metric := types.MetricL2
+	switch req.Metric {
+	case "", "l2":
+	case "cos", "cosine":
+		metric = types.MetricCosine
+	case "ip", "inner_product":
+		metric = types.MetricIP
+	case "jaccard":
+		metric = types.MetricJaccard
+	case "manhattan", "l1":
+		metric = types.MetricManhattan
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown metric %q", req.Metric)
+	}
+
+	cfg := types.CollectionConfig{
+		Name:             req.Name,
+		Dimensions:       req.Dimensions,
+		Metric:           metric,
+		IndexType:        req.IndexType,
+		IndexCompression: req.IndexCompression,
+		PQSubspaces:      int(req.PqSubspaces),
+	}
+	if opts := req.Hnsw; opts != nil {
+		cfg.HNSWOptions = &types.HNSWOptions{
+			M:              int(opts.M),
+			EfConstruction: int(opts.EfConstruction),
+			EfSearch:       int(opts.EfSearch),
+			Ml:             opts.Ml,
+		}
+	}
+	if opts := req.SecondaryHnsw; opts != nil {
+		cfg.SecondaryHNSWOptions = &types.HNSWOptions{
+			M:              int(opts.M),
+			EfConstruction: int(opts.EfConstruction),
+			EfSearch:       int(opts.EfSearch),
+			Ml:             opts.Ml,
+		}
+	}
+	if _, err := storage.ValidateCollectionConfig(&cfg); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := g.Storage.CreateCollectionWithConfig(cfg); err != nil {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	return &waddlegrpc.CreateCollectionResponse{}, nil
+}
+
+func (g *GRPCServer) AppendBlock(ctx context.Context, req *pb.AppendBlockRequest) (*waddlegrpc.AppendBlockResponse, error) {
+	if req.Block == nil {
+		return nil, status.Error(codes.InvalidArgument, "block is required")
+	}
+	block := &types.BlockData{
+		Primary:    req.Block.Primary,
+		Vector:     req.Block.Vector,
+		Keywords:   req.Block.Keywords,
+		TTLSeconds: req.Block.TtlSeconds,
+	}
+	index, err := g.Storage.AppendBlockContext(ctx, req.Collection, req.Key, block)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &waddlegrpc.AppendBlockResponse{Index: index}, nil
+}
+
+func (g *GRPCServer) GetBlock(_ context.Context, req *pb.GetBlockRequest) (*pb.BlockData, error) {
+	block, err := g.Storage.GetBlock(req.Collection, req.Key, req.Index)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.BlockData{
+		Primary:    block.Primary,
+		Vector:     block.Vector,
+		Keywords:   block.Keywords,
+		TtlSeconds: block.TTLSeconds,
+		Version:    block.Version,
+	}, nil
+}
+
+func (g *GRPCServer) Search(ctx context.Context, req *pb.SearchRequest) (*pb.SearchResultList, error) {
+	filter := &types.SearchFilter{Keywords: req.Keywords, KeywordMode: req.Mode, MaxDistance: req.MaxDistance}
+	results, err := g.Storage.SearchWithFilterContext(ctx, req.Collection, req.Query, req.TopK, filter, "primary")
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	list := &pb.SearchResultList{}
+	for _, r := range results {
+		item := &pb.SearchResultItem{Key: r.Key, Index: r.Index, Distance: r.Distance}
+		if r.Block != nil {
+			item.Block = &pb.BlockData{
+				Primary:    r.Block.Primary,
+				Vector:     r.Block.Vector,
+				Keywords:   r.Block.Keywords,
+				TtlSeconds: r.Block.TTLSeconds,
+				Version:    r.Block.Version,
+			}
+		}
+		list.Results = append(list.Results, item)
+	}
+	return list, nil
+}
+
+func (g *GRPCServer) KeywordSearch(_ context.Context, req *pb.KeywordSearchRequest) (*pb.KeyList, error) {
+	keys, err := g.Storage.KeywordSearch(req.Collection, req.Keywords, req.Mode, 0)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.KeyList{Keys: keys}, nil
+}
+
+func (g *GRPCServer) DeleteKey(ctx context.Context, req *pb.DeleteKeyRequest) (*waddlegrpc.DeleteKeyResponse, error) {
+	if err := g.Storage.DeleteKeyContext(ctx, req.Collection, req.Key); err != nil {
+		return nil, grpcError(err)
+	}
+	return &waddlegrpc.DeleteKeyResponse{}, nil
+}
+
+// grpcError maps storage errors to status codes the way writeError maps them
+// to HTTP statuses.
+func grpcError(err error) error {
+	code := codes.InvalidArgument
+	switch errorCode(err) {
+	case pb.ErrorCode_NOT_FOUND:
+		code = codes.NotFound
+	case pb.ErrorCode_ALREADY_EXISTS:
+		code = codes.AlreadyExists
+	case pb.ErrorCode_VERSION_CONFLICT:
+		code = codes.Aborted
+	case pb.ErrorCode_RESOURCE_EXHAUSTED:
+		code = codes.ResourceExhausted
+	case pb.ErrorCode_DATA_CORRUPTED:
+		code = codes.DataLoss
+	default:
+		if errors.Is(err, storage.ErrClosing) {
+			code = codes.Unavailable
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			code = codes.DeadlineExceeded
+		} else if errors.Is(err, context.Canceled) {
+			code = codes.Canceled
+		} else if strings.Contains(err.Error(), "not found") {
+			code = codes.NotFound
+		}
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,89 @@
+package network
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	waddlegrpc "waddlemap/client/grpc"
+	"waddlemap/internal/storage"
+	"waddlemap/internal/types"
+	pb "waddlemap/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCServer_AppendAndSearch(t *testing.T) {
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	defer vm.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewGRPCServer(0, vm)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer conn.Close()
+	client := waddlegrpc.NewWaddleMapClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.CreateCollection(ctx, &pb.CreateCollectionRequest{Name: "docs", Dimensions: 2, Metric: "l2"}); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	for i, vec := range [][]float32{{0, 0}, {1, 0}, {5, 5}} {
+		resp, err := client.AppendBlock(ctx, &pb.AppendBlockRequest{
+			Collection: "docs",
+			Key:        "doc",
+			Block:      &pb.BlockData{Primary: "block", Vector: vec, Keywords: []string{"go"}},
+		})
+		if err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+		if resp.Index != uint32(i) {
+			t.Errorf("Expected index %d, got %d", i, resp.Index)
+		}
+	}
+
+	results, err := client.Search(ctx, &pb.SearchRequest{Collection: "docs", Query: []float32{0.9, 0}, TopK: 2})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results.Results) != 2 || results.Results[0].Index != 1 || results.Results[1].Index != 0 {
+		t.Fatalf("Expected blocks 1 and 0, got %v", results.Results)
+	}
+
+	block, err := client.GetBlock(ctx, &pb.GetBlockRequest{Collection: "docs", Key: "doc", Index: 2})
+	if err != nil || block.Primary != "block" || len(block.Vector) != 2 {
+		t.Fatalf("GetBlock returned %v, err %v", block, err)
+	}
+	keys, err := client.KeywordSearch(ctx, &pb.KeywordSearchRequest{Collection: "docs", Keywords: []string{"go"}, Mode: "exact"})
+	if err != nil || len(keys.Keys) != 1 || keys.Keys[0] != "doc" {
+		t.Fatalf("KeywordSearch returned %v, err %v", keys, err)
+	}
+
+	if _, err := client.DeleteKey(ctx, &pb.DeleteKeyRequest{Collection: "docs", Key: "doc"}); err != nil {
+		t.Fatalf("DeleteKey failed: %v", err)
+	}
+	_, err = client.GetBlock(ctx, &pb.GetBlockRequest{Collection: "docs", Key: "doc"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for a deleted key, got %v", err)
+	}
+	_, err = client.CreateCollection(ctx, &pb.CreateCollectionRequest{Name: "bad", Dimensions: 2, Metric: "hamming"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for an unknown metric, got %v", err)
+	}
+}
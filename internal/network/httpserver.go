@@ -0,0 +1,502 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"waddlemap/internal/logger"
+	"waddlemap/internal/metrics"
+	"waddlemap/internal/storage"
+	"waddlemap/internal/types"
+	pb "waddlemap/proto"
+)
+
+// DefaultHTTPPort is the port the JSON API listens on unless configured otherwise.
+const DefaultHTTPPort = 6970
+
+// defaultLockTimeout bounds the wait for a collection lock when
+// timeout_seconds is omitted.
+const defaultLockTimeout = 30 * time.Second
+
+// requestIDHeader carries the trace ID of a request. Requests without one,
+// or with one longer than maxRequestIDLength, are given a new ID, which is
+// echoed in the response.
+const requestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength bounds the length of client-supplied request IDs.
+const maxRequestIDLength = 128
+
+// defaultHTTPTopK is the number of search results returned when top_k is omitted.
+const defaultHTTPTopK = 10
+
+// HTTPServer exposes a JSON REST API for querying the database with curl or a
+// browser. It calls the VectorManager directly instead of going through the
+// transaction manager's request channel.
+type HTTPServer struct {
+	Port    int
+	Storage *storage.VectorManager
+}
+
+func NewHTTPServer(port int, vm *storage.VectorManager) *HTTPServer {
+	return &HTTPServer{
+		Port:    port,
+		Storage: vm,
+	}
+}
+
+// Start listens on the HTTP port and serves requests until the listener fails.
+func (h *HTTPServer) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", h.Port))
+	if err != nil {
+		return err
+	}
+	logger.Info("HTTP API listening on port %d", h.Port)
+	return http.Serve(listener, h.Handler())
+}
+
+// Handler returns the HTTP handler serving the REST API.
+func (h *HTTPServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /collections", h.handleCreateCollection)
+	mux.HandleFunc("DELETE /collections/{name}", h.handleDeleteCollection)
+	mux.HandleFunc("POST /collections/{name}/search", h.handleSearch)
+	mux.HandleFunc("POST /collections/{name}/keyword-search", h.handleKeywordSearch)
+	mux.HandleFunc("GET /collections/{name}/stats", h.handleCollectionStats)
+	mux.HandleFunc("GET /collections/{name}/keys", h.handleListKeys)
+	mux.HandleFunc("POST /collections/{name}/keys/{key}/blocks", h.handleAppendBlock)
+	mux.HandleFunc("GET /collections/{name}/keys/{key}/blocks/{index}", h.handleGetBlock)
+	mux.HandleFunc("DELETE /collections/{name}/keys/{key}", h.handleDeleteKey)
+	mux.HandleFunc("GET /admin/storage/stats", h.handleStorageStats)
+	mux.HandleFunc("GET /admin/memstats", h.handleMemStats)
+	mux.HandleFunc("GET /admin/search-cache/stats", h.handleSearchCacheStats)
+	mux.HandleFunc("POST /admin/collections/{name}/lock", h.handleLockCollection)
+	mux.Handle("GET /metrics", metrics.Handler())
+	return traceRequests(mux)
+}
+
+// traceRequests tags each request with the trace ID of its requestIDHeader,
+// so that storage log lines written while serving it can be found with
+// VectorManager.GetTraceLog.
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = logger.NewTraceID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := logger.WithTraceID(r.Context(), id)
+		logger.DebugContext(ctx, "http request", "method", r.Method, "path", r.URL.Path)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// httpBlock is the JSON form of a block. Vectors use float64 for readability.
+type httpBlock struct {
+	Primary    string    `json:"primary"`
+	Vector     []float64 `json:"vector,omitempty"`
+	Keywords   []string  `json:"keywords,omitempty"`
+	TTLSeconds int64     `json:"ttl_seconds,omitempty"` // Remaining TTL on reads
+	Version    uint64    `json:"version,omitempty"`     // Update count on reads
+}
+
+func (b *httpBlock) toBlockData() *types.BlockData {
+	vec := make([]float32, len(b.Vector))
+	for i, v := range b.Vector {
+		vec[i] = float32(v)
+	}
+	return &types.BlockData{Primary: b.Primary, Vector: vec, Keywords: b.Keywords, TTLSeconds: b.TTLSeconds}
+}
+
+func toFloat64s(vec []float32) []float64 {
+	out := make([]float64, len(vec))
+	for i, v := range vec {
+		out[i] = float64(v)
+	}
+	return out
+}
+
+type httpCreateCollection struct {
+	Name       string `json:"name"`
+	Dimensions uint32 `json:"dimensions"`
+	Metric     string `json:"metric"`     // "l2" (default), "cosine" or "ip"
+	IndexType  string `json:"index_type"` // "hnsw" (default) or "flat"
+
+	IndexCompression string `json:"index_compression"` // "none" (default) or "pq"
+	PQSubspaces      int    `json:"pq_subspaces"`
+	Float16Vectors   bool   `json:"float16_vectors"`   // Half-precision HNSW vectors
+	MmapVectors      bool   `json:"mmap_vectors"`      // HNSW vectors in a memory-mapped file
+	AutoNormalize    bool   `json:"auto_normalize"`    // Unit-length vectors and queries; cosine only
+	NGramSizes       []int  `json:"ngram_sizes"`       // Keyword n-gram lengths for partial search (default [3])
+	TokenizationMode string `json:"tokenization_mode"` // "ngram" (default), "whitespace" or "cjk_char"
+
+	HNSW *types.HNSWOptions `json:"hnsw,omitempty"`
+}
+
+type httpSearch struct {
+	Vector   []float64 `json:"vector"`
+	TopK     uint32    `json:"top_k"`
+	Mode     string    `json:"mode"` // Keyword match mode
+	Keywords []string  `json:"keywords,omitempty"`
+}
+
+type httpSearchResult struct {
+	Key      string  `json:"key"`
+	Index    uint32  `json:"index"`
+	Distance float32 `json:"distance"`
+}
+
+type httpKeywordSearch struct {
+	Keywords []string `json:"keywords"`
+	Mode     string   `json:"mode"`   // "exact" (default), "any", "prefix", "partial", ...
+	Ranked   bool     `json:"ranked"` // Order keys by BM25 score
+	TopK     int      `json:"top_k"`  // Ranked results only
+}
+
+type httpRankedKey struct {
+	Key   string  `json:"key"`
+	Score float64 `json:"score"`
+}
+
+func (h *HTTPServer) handleCreateCollection(w http.ResponseWriter, r *http.Request) {
+	var req httpCreateCollection
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Name == "" || req.Dimensions == 0 {
+		http.Error(w, "name and dimensions are required", http.StatusBadRequest)
+		return
+	}
+
+	metric := types.MetricL2
+	switch req.Metric {
+	case "", "l2":
+	case "cos", "cosine":
+		metric = types.MetricCosine
+	case "ip", "inner_product":
+		metric = types.MetricIP
+	case "jaccard":
+		metric = types.MetricJaccard
+	case "manhattan", "l1":
+		metric = types.MetricManhattan
+	default:
+		http.Error(w, fmt.Sprintf("unknown metric %q", req.Metric), http.StatusBadRequest)
+		return
+	}
+
+	cfg := types.CollectionConfig{Name: req.Name, Dimensions: req.Dimensions, Metric: metric, IndexType: req.IndexType, HNSWOptions: req.HNSW,
+		IndexCompression: req.IndexCompression, PQSubspaces: req.PQSubspaces, Float16Vectors: req.Float16Vectors,
+		MmapVectors: req.MmapVectors, AutoNormalize: req.AutoNormalize, NGramSizes: req.NGramSizes,
+		TokenizationMode: req.TokenizationMode}
+	if _, err := storage.ValidateCollectionConfig(&cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.Storage.CreateCollectionWithConfig(cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, req)
+}
+
+func (h *HTTPServer) handleDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	if err := h.Storage.DeleteCollection(r.PathValue("name")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTPServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var req httpSearch
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.TopK == 0 {
+		req.TopK = defaultHTTPTopK
+	}
+	query := make([]float32, len(req.Vector))
+	for i, v := range req.Vector {
+		query[i] = float32(v)
+	}
+
+	filter := &types.SearchFilter{Keywords: req.Keywords, KeywordMode: req.Mode}
+	if s := r.URL.Query().Get("max_distance"); s != "" {
+		maxDistance, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			http.Error(w, "invalid max_distance", http.StatusBadRequest)
+			return
+		}
+		filter.MaxDistance = float32(maxDistance)
+	}
+
+	results, err := h.Storage.SearchWithFilterContext(r.Context(), r.PathValue("name"), query, req.TopK, filter, "primary")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	out := make([]httpSearchResult, len(results))
+	for i, res := range results {
+		out[i] = httpSearchResult{Key: res.Key, Index: res.Index, Distance: res.Distance}
+	}
+	writeJSON(w, out)
+}
+
+// handleKeywordSearch replies with the sorted keys matching the keywords, or
+// with ranked set, the top_k keys with their BM25 scores, best first.
+func (h *HTTPServer) handleKeywordSearch(w http.ResponseWriter, r *http.Request) {
+	var req httpKeywordSearch
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if len(req.Keywords) == 0 {
+		http.Error(w, "keywords are required", http.StatusBadRequest)
+		return
+	}
+	name := r.PathValue("name")
+
+	if !req.Ranked {
+		keys, err := h.Storage.KeywordSearch(name, req.Keywords, req.Mode, 0)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if keys == nil {
+			keys = []string{} // Encodes as [] rather than null
+		}
+		slices.Sort(keys)
+		writeJSON(w, keys)
+		return
+	}
+	if req.TopK <= 0 {
+		req.TopK = defaultHTTPTopK
+	}
+	ranked, err := h.Storage.KeywordSearchRankedKeys(name, req.Keywords, req.Mode, req.TopK)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	out := make([]httpRankedKey, len(ranked))
+	for i, rk := range ranked {
+		out[i] = httpRankedKey{Key: rk.Key, Score: rk.Score}
+	}
+	writeJSON(w, out)
+}
+
+func (h *HTTPServer) handleCollectionStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.Storage.CollectionStats(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, stats)
+}
+
+// handleStorageStats scans all payloads and bucket records; the scan stops if
+// the client disconnects.
+func (h *HTTPServer) handleStorageStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.Storage.StorageStatsContext(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, stats)
+}
+
+func (h *HTTPServer) handleMemStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.Storage.MemStats())
+}
+
+func (h *HTTPServer) handleSearchCacheStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.Storage.SearchCacheStats())
+}
+
+type httpLockCollection struct {
+	Mode           string `json:"mode"` // "write" (default) or "read"
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// handleLockCollection freezes a collection, flushes its vector indexes and
+// releases it. A write lock stops all other operations on the collection, a
+// read lock only writes. It replies 409 if the lock is not acquired within
+// timeout_seconds.
+func (h *HTTPServer) handleLockCollection(w http.ResponseWriter, r *http.Request) {
+	var req httpLockCollection
+	if !readJSON(w, r, &req) {
+		return
+	}
+	name := r.PathValue("name")
+	coll, err := h.Storage.GetCollection(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var lock func() (func(), error)
+	switch req.Mode {
+	case "", "write":
+		req.Mode = "write"
+		lock = func() (func(), error) { return h.Storage.LockCollection(name) }
+	case "read":
+		lock = func() (func(), error) { return h.Storage.RLockCollection(name) }
+	default:
+		http.Error(w, fmt.Sprintf("unknown lock mode %q", req.Mode), http.StatusBadRequest)
+		return
+	}
+	timeout := defaultLockTimeout
+	if req.TimeoutSeconds < 0 {
+		http.Error(w, "timeout_seconds cannot be negative", http.StatusBadRequest)
+		return
+	} else if req.TimeoutSeconds > 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+
+	start := time.Now()
+	unlock, err := lockWithin(lock, timeout)
+	if err != nil {
+		if errors.Is(err, errLockTimeout) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			writeError(w, err)
+		}
+		return
+	}
+	waited := time.Since(start)
+	err = coll.FlushHNSWLocked()
+	unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"collection": name, "mode": req.Mode, "waited_ms": waited.Milliseconds()})
+}
+
+// errLockTimeout is returned by lockWithin when the lock is not acquired in time.
+var errLockTimeout = errors.New("timed out waiting for collection lock")
+
+// lockWithin calls lock and returns its unlock function, or errLockTimeout if
+// lock does not return within timeout. A lock acquired after the timeout is
+// released at once.
+func lockWithin(lock func() (func(), error), timeout time.Duration) (func(), error) {
+	type result struct {
+		unlock func()
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		unlock, err := lock()
+		done <- result{unlock, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res.unlock, res.err
+	case <-timer.C:
+		go func() {
+			if res := <-done; res.err == nil {
+				res.unlock()
+			}
+		}()
+		return nil, errLockTimeout
+	}
+}
+
+// handleListKeys lists the keys of a collection in sorted order, optionally
+// restricted to a prefix. With limit it returns one page, sets X-Has-More and
+// takes the last key of the previous page as after.
+func (h *HTTPServer) handleListKeys(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	limit := 0
+	if s := params.Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	keys, hasMore, err := h.Storage.ListKeysPaged(r.PathValue("name"), params.Get("prefix"), params.Get("after"), limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if limit > 0 {
+		w.Header().Set("X-Has-More", strconv.FormatBool(hasMore))
+	}
+	writeJSON(w, keys)
+}
+
+func (h *HTTPServer) handleAppendBlock(w http.ResponseWriter, r *http.Request) {
+	var block httpBlock
+	if !readJSON(w, r, &block) {
+		return
+	}
+	index, err := h.Storage.AppendBlockContext(r.Context(), r.PathValue("name"), r.PathValue("key"), block.toBlockData())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, map[string]uint32{"index": index})
+}
+
+func (h *HTTPServer) handleGetBlock(w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.ParseUint(r.PathValue("index"), 10, 32)
+	if err != nil {
+		http.Error(w, "invalid block index", http.StatusBadRequest)
+		return
+	}
+	block, err := h.Storage.GetBlock(r.PathValue("name"), r.PathValue("key"), uint32(index))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, httpBlock{Primary: block.Primary, Vector: toFloat64s(block.Vector), Keywords: block.Keywords, TTLSeconds: block.TTLSeconds, Version: block.Version})
+}
+
+func (h *HTTPServer) handleDeleteKey(w http.ResponseWriter, r *http.Request) {
+	if err := h.Storage.DeleteKeyContext(r.Context(), r.PathValue("name"), r.PathValue("key")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readJSON decodes the request body into v, replying 400 on failure.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, fmt.Sprintf("invalid JSON body: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeError replies 404 for missing collections, keys and blocks, 410 for
+// expired blocks, 409 for duplicate vector IDs, 507 when storage is full, 500
+// for corrupted data and 400 otherwise.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch code := errorCode(err); {
+	case errors.Is(err, storage.ErrExpired):
+		status = http.StatusGone
+	case code == pb.ErrorCode_NOT_FOUND || strings.Contains(err.Error(), "not found"):
+		status = http.StatusNotFound
+	case code == pb.ErrorCode_ALREADY_EXISTS || code == pb.ErrorCode_VERSION_CONFLICT:
+		status = http.StatusConflict
+	case code == pb.ErrorCode_RESOURCE_EXHAUSTED:
+		status = http.StatusInsufficientStorage
+	case code == pb.ErrorCode_DATA_CORRUPTED:
+		status = http.StatusInternalServerError
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+	http.Error(w, err.Error(), status)
+}
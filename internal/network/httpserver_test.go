@@ -0,0 +1,427 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"waddlemap/internal/storage"
+	"waddlemap/internal/types"
+)
+
+func newHTTPTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	t.Cleanup(func() { vm.Close() })
+
+	srv := httptest.NewServer(NewHTTPServer(0, vm).Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// httpDo sends body as JSON and decodes a JSON response into out, returning the status code.
+func httpDo(t *testing.T, method, url string, body, out interface{}) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode %s %s: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestHTTPServer_Endpoints(t *testing.T) {
+	srv := newHTTPTestServer(t)
+	base := srv.URL + "/collections"
+
+	// Create collection
+	create := map[string]interface{}{"name": "docs", "dimensions": 2, "metric": "l2"}
+	if code := httpDo(t, http.MethodPost, base, create, nil); code != http.StatusCreated {
+		t.Fatalf("Create collection returned %d", code)
+	}
+	if code := httpDo(t, http.MethodPost, base, create, nil); code != http.StatusConflict {
+		t.Errorf("Duplicate create returned %d, want 409", code)
+	}
+	if code := httpDo(t, http.MethodPost, base, map[string]interface{}{"name": "bad", "dimensions": 2, "metric": "hamming"}, nil); code != http.StatusBadRequest {
+		t.Errorf("Unknown metric returned %d, want 400", code)
+	}
+
+	// Append blocks
+	blocks := []struct {
+		key   string
+		block httpBlock
+	}{
+		{"a", httpBlock{Primary: "first", Vector: []float64{1, 0}, Keywords: []string{"x"}}},
+		{"a", httpBlock{Primary: "second", Vector: []float64{0.9, 0.1}}},
+		{"b", httpBlock{Primary: "other", Vector: []float64{0, 1}}},
+	}
+	for i, b := range blocks {
+		var resp map[string]uint32
+		if code := httpDo(t, http.MethodPost, base+"/docs/keys/"+b.key+"/blocks", b.block, &resp); code != http.StatusCreated {
+			t.Fatalf("Append %d returned %d", i, code)
+		}
+		if i == 1 && resp["index"] != 1 {
+			t.Errorf("Expected second block of a at index 1, got %d", resp["index"])
+		}
+	}
+
+	// Get block
+	var got httpBlock
+	if code := httpDo(t, http.MethodGet, base+"/docs/keys/a/blocks/0", nil, &got); code != http.StatusOK {
+		t.Fatalf("Get block returned %d", code)
+	}
+	if got.Primary != "first" || len(got.Vector) != 2 || got.Vector[0] != 1 || len(got.Keywords) != 1 {
+		t.Errorf("Unexpected block: %+v", got)
+	}
+	if code := httpDo(t, http.MethodGet, base+"/docs/keys/a/blocks/abc", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Invalid index returned %d, want 400", code)
+	}
+	if code := httpDo(t, http.MethodGet, base+"/docs/keys/missing/blocks/0", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Missing key returned %d, want 404", code)
+	}
+
+	// List keys
+	var keys []string
+	if code := httpDo(t, http.MethodGet, base+"/docs/keys", nil, &keys); code != http.StatusOK {
+		t.Fatalf("List keys returned %d", code)
+	}
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("Expected keys [a b], got %v", keys)
+	}
+	if code := httpDo(t, http.MethodGet, base+"/docs/keys?prefix=b", nil, &keys); code != http.StatusOK {
+		t.Fatalf("List keys with prefix returned %d", code)
+	}
+	if len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("Expected keys [b], got %v", keys)
+	}
+	if code := httpDo(t, http.MethodGet, base+"/docs/keys?limit=1&after=a", nil, &keys); code != http.StatusOK {
+		t.Fatalf("List keys page returned %d", code)
+	}
+	if len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("Expected the page after a to be [b], got %v", keys)
+	}
+	if code := httpDo(t, http.MethodGet, base+"/docs/keys?limit=0", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Zero limit returned %d, want 400", code)
+	}
+	if code := httpDo(t, http.MethodGet, base+"/missing/keys", nil, nil); code != http.StatusNotFound {
+		t.Errorf("List keys on missing collection returned %d, want 404", code)
+	}
+
+	// Search
+	var results []httpSearchResult
+	search := httpSearch{Vector: []float64{0, 1}, TopK: 2}
+	if code := httpDo(t, http.MethodPost, base+"/docs/search", search, &results); code != http.StatusOK {
+		t.Fatalf("Search returned %d", code)
+	}
+	if len(results) != 2 || results[0].Key != "b" {
+		t.Errorf("Expected b as the nearest of 2 results, got %+v", results)
+	}
+	if code := httpDo(t, http.MethodPost, base+"/docs/search?max_distance=0.01", search, &results); code != http.StatusOK {
+		t.Fatalf("Search with max_distance returned %d", code)
+	}
+	if len(results) != 1 || results[0].Key != "b" {
+		t.Errorf("Expected only b within max_distance, got %+v", results)
+	}
+	if code := httpDo(t, http.MethodPost, base+"/docs/search?max_distance=near", search, nil); code != http.StatusBadRequest {
+		t.Errorf("Invalid max_distance returned %d, want 400", code)
+	}
+	if code := httpDo(t, http.MethodPost, base+"/missing/search", search, nil); code != http.StatusNotFound {
+		t.Errorf("Search on missing collection returned %d, want 404", code)
+	}
+
+	// Collection stats
+	var stats storage.CollectionStats
+	if code := httpDo(t, http.MethodGet, base+"/docs/stats", nil, &stats); code != http.StatusOK {
+		t.Fatalf("Stats returned %d", code)
+	}
+	if stats.Vectors != 3 || stats.Keys != 2 || stats.HNSW == nil || stats.HNSW.Nodes != 3 || len(stats.Warnings) != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if code := httpDo(t, http.MethodGet, base+"/missing/stats", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Stats on missing collection returned %d, want 404", code)
+	}
+
+	// Storage stats
+	var storageStats storage.StorageStats
+	if code := httpDo(t, http.MethodGet, srv.URL+"/admin/storage/stats", nil, &storageStats); code != http.StatusOK {
+		t.Fatalf("Storage stats returned %d", code)
+	}
+	records := 0
+	for _, b := range storageStats.Buckets {
+		records += b.RecordCount
+	}
+	if len(storageStats.Buckets) != storage.DefaultPartitionCount || records != 3 || len(storageStats.Collections) != 1 {
+		t.Errorf("Unexpected storage stats: %+v", storageStats)
+	}
+
+	var memStats runtime.MemStats
+	if code := httpDo(t, http.MethodGet, srv.URL+"/admin/memstats", nil, &memStats); code != http.StatusOK {
+		t.Fatalf("Memory stats returned %d", code)
+	}
+	if memStats.HeapAlloc == 0 || memStats.Sys < memStats.HeapAlloc {
+		t.Errorf("Unexpected memory stats: heap %d of %d", memStats.HeapAlloc, memStats.Sys)
+	}
+
+	// A repeated search is answered from the search cache
+	if code := httpDo(t, http.MethodPost, base+"/docs/search", search, &results); code != http.StatusOK || len(results) != 2 {
+		t.Fatalf("Repeated search returned %d: %+v", code, results)
+	}
+	var cacheStats storage.CacheStats
+	if code := httpDo(t, http.MethodGet, srv.URL+"/admin/search-cache/stats", nil, &cacheStats); code != http.StatusOK {
+		t.Fatalf("Search cache stats returned %d", code)
+	}
+	if cacheStats.Hits != 1 || cacheStats.Misses == 0 {
+		t.Errorf("Unexpected search cache stats: %+v", cacheStats)
+	}
+
+	// Delete key
+	if code := httpDo(t, http.MethodDelete, base+"/docs/keys/b", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("Delete key returned %d", code)
+	}
+	if code := httpDo(t, http.MethodGet, base+"/docs/keys/b/blocks/0", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Get on deleted key returned %d, want 404", code)
+	}
+
+	// Delete collection
+	if code := httpDo(t, http.MethodDelete, base+"/docs", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("Delete collection returned %d", code)
+	}
+	if code := httpDo(t, http.MethodDelete, base+"/docs", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Deleting a missing collection returned %d, want 404", code)
+	}
+}
+
+// scrapeMetric returns the value of the sample named series from a /metrics endpoint, or 0 if absent.
+func scrapeMetric(t *testing.T, url, series string) float64 {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s returned %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("Bad sample %q: %v", line, err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestHTTPServer_Metrics(t *testing.T) {
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	defer vm.Close()
+	srv := httptest.NewServer(NewHTTPServer(0, vm).Handler())
+	defer srv.Close()
+
+	if err := vm.CreateCollection("metered", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	const appends = "waddlemap_append_duration_seconds_count"
+	before := scrapeMetric(t, srv.URL+"/metrics", appends)
+	for i := 0; i < 2; i++ {
+		if _, err := vm.AppendBlock("metered", "doc", &types.BlockData{Primary: "p", Vector: []float32{1, 0}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := vm.Search("metered", []float32{1, 0}, 1, "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := scrapeMetric(t, srv.URL+"/metrics", appends); got != before+2 {
+		t.Errorf("%s = %v, want %v", appends, got, before+2)
+	}
+	if got := scrapeMetric(t, srv.URL+"/metrics", `waddlemap_vectors_total{collection="metered"}`); got != 2 {
+		t.Errorf("waddlemap_vectors_total = %v, want 2", got)
+	}
+	if got := scrapeMetric(t, srv.URL+"/metrics", `waddlemap_search_requests_total{collection="metered",status="ok"}`); got != 1 {
+		t.Errorf("waddlemap_search_requests_total = %v, want 1", got)
+	}
+}
+
+func TestHTTPServer_LockCollection(t *testing.T) {
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	defer vm.Close()
+	srv := httptest.NewServer(NewHTTPServer(0, vm).Handler())
+	defer srv.Close()
+
+	if err := vm.CreateCollection("frozen", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("frozen", "doc", &types.BlockData{Primary: "p", Vector: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	url := srv.URL + "/admin/collections/frozen/lock"
+	for _, mode := range []string{"read", "write"} {
+		var out map[string]interface{}
+		if code := httpDo(t, "POST", url, map[string]interface{}{"mode": mode}, &out); code != http.StatusOK || out["mode"] != mode {
+			t.Errorf("lock %s: status %d, %v", mode, code, out)
+		}
+	}
+	if code := httpDo(t, "POST", url, map[string]interface{}{"mode": "exclusive"}, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown mode, got %d", code)
+	}
+	if code := httpDo(t, "POST", srv.URL+"/admin/collections/missing/lock", map[string]interface{}{}, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing collection, got %d", code)
+	}
+
+	// A lock held elsewhere times out the request
+	unlock, err := vm.LockCollection("frozen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := httpDo(t, "POST", url, map[string]interface{}{"mode": "read", "timeout_seconds": 1}, nil)
+	unlock()
+	if code != http.StatusConflict {
+		t.Errorf("Expected 409 while locked, got %d", code)
+	}
+	if _, err := vm.AppendBlock("frozen", "doc", &types.BlockData{Primary: "q", Vector: []float32{0, 1}}); err != nil {
+		t.Errorf("AppendBlock after the timed out lock: %v", err)
+	}
+}
+
+func TestHTTPServer_KeywordSearch(t *testing.T) {
+	srv := newHTTPTestServer(t)
+	base := srv.URL + "/collections"
+	if code := httpDo(t, http.MethodPost, base, map[string]interface{}{"name": "docs", "dimensions": 2}, nil); code != http.StatusCreated {
+		t.Fatalf("Create collection returned %d", code)
+	}
+	for key, keywords := range map[string][]string{
+		"short": {"go"},
+		"long":  {"go", "tutorial", "beginner", "guide"},
+		"other": {"rust"},
+	} {
+		block := httpBlock{Primary: key, Vector: []float64{1, 0}, Keywords: keywords}
+		if code := httpDo(t, http.MethodPost, base+"/docs/keys/"+key+"/blocks", block, nil); code != http.StatusCreated {
+			t.Fatalf("Append returned %d", code)
+		}
+	}
+	url := base + "/docs/keyword-search"
+
+	var keys []string
+	if code := httpDo(t, http.MethodPost, url, map[string]interface{}{"keywords": []string{"go"}}, &keys); code != http.StatusOK {
+		t.Fatalf("Keyword search returned %d", code)
+	}
+	if strings.Join(keys, ",") != "long,short" {
+		t.Errorf("Keyword search returned %v, want [long short]", keys)
+	}
+
+	var ranked []httpRankedKey
+	body := map[string]interface{}{"keywords": []string{"go", "rust"}, "mode": "any", "ranked": true, "top_k": 2}
+	if code := httpDo(t, http.MethodPost, url, body, &ranked); code != http.StatusOK {
+		t.Fatalf("Ranked keyword search returned %d", code)
+	}
+	if len(ranked) != 2 || ranked[0].Score < ranked[1].Score || ranked[1].Key == "long" {
+		t.Errorf("Ranked keyword search returned %+v, want the 2 short documents first", ranked)
+	}
+
+	if code := httpDo(t, http.MethodPost, url, map[string]interface{}{}, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without keywords, got %d", code)
+	}
+	if code := httpDo(t, http.MethodPost, base+"/missing/keyword-search", body, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing collection, got %d", code)
+	}
+}
+
+func TestHTTPServer_RequestID(t *testing.T) {
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	defer vm.Close()
+	srv := httptest.NewServer(NewHTTPServer(0, vm).Handler())
+	defer srv.Close()
+
+	if err := vm.CreateCollection("traced", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	send := func(method, path, requestID string, body interface{}) *http.Response {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if requestID != "" {
+			req.Header.Set("X-Request-Id", requestID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := send("POST", "/collections/traced/keys/doc/blocks", "trace-append", map[string]interface{}{"primary": "p", "vector": []float64{1, 0}})
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("X-Request-Id") != "trace-append" {
+		t.Fatalf("append: status %d, X-Request-Id %q", resp.StatusCode, resp.Header.Get("X-Request-Id"))
+	}
+	send("POST", "/collections/traced/search", "trace-search", map[string]interface{}{"vector": []float64{1, 0}})
+	send("POST", "/collections/missing/search", "trace-search", map[string]interface{}{"vector": []float64{1, 0}})
+
+	for id, want := range map[string][]string{
+		"trace-append": {"http request", "block appended"},
+		"trace-search": {"http request", "search completed", "http request", "search failed"},
+	} {
+		lines := vm.GetTraceLog(id)
+		if len(lines) != len(want) {
+			t.Fatalf("Trace %s has %d lines, want %d: %q", id, len(lines), len(want), lines)
+		}
+		for i, line := range lines {
+			if !strings.Contains(line, want[i]) || !strings.Contains(line, "trace_id="+id) {
+				t.Errorf("Trace %s line %d = %q, want %q with its trace ID", id, i, line, want[i])
+			}
+		}
+	}
+
+	// Requests without an ID are given one
+	resp = send("GET", "/collections/traced/keys", "", nil)
+	if id := resp.Header.Get("X-Request-Id"); len(id) != 16 || len(vm.GetTraceLog(id)) != 1 {
+		t.Errorf("Generated X-Request-Id %q with trace %q", id, vm.GetTraceLog(id))
+	}
+	if lines := vm.GetTraceLog("unknown"); lines != nil {
+		t.Errorf("GetTraceLog of an unknown ID = %q, want nil", lines)
+	}
+}
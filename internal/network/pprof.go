@@ -0,0 +1,44 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"waddlemap/internal/logger"
+)
+
+// PprofServer serves the net/http/pprof profiles of the running process
+// under /debug/pprof/. The profiles expose internals and a CPU profile costs
+// throughput while it runs, so it is only started when a port is configured
+// and should not be reachable from untrusted networks. It uses its own mux:
+// the handlers net/http/pprof registers on http.DefaultServeMux are served
+// by none of the other servers.
+type PprofServer struct {
+	Port int
+}
+
+func NewPprofServer(port int) *PprofServer {
+	return &PprofServer{Port: port}
+}
+
+// Start listens on the pprof port and serves requests until the listener fails.
+func (p *PprofServer) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", p.Port))
+	if err != nil {
+		return err
+	}
+	logger.Info("pprof profiling enabled on port %d (/debug/pprof/); do not expose this port publicly", p.Port)
+	return http.Serve(listener, p.Handler())
+}
+
+// Handler returns the HTTP handler serving the profiles.
+func (p *PprofServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index) // Also serves the named profiles, such as heap
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,33 @@
+package network
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPprofServer_Heap(t *testing.T) {
+	srv := httptest.NewServer(NewPprofServer(0).Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/debug/pprof/heap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Fatalf("Heap profile returned %d with %d bytes", resp.StatusCode, len(body))
+	}
+
+	// The other servers do not serve profiles
+	rec := httptest.NewRecorder()
+	NewHTTPServer(0, nil).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/heap", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("HTTP API served /debug/pprof/heap with %d", rec.Code)
+	}
+}
@@ -0,0 +1,83 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultRateLimitWait is how long a request may wait for a token before it
+// is rejected.
+const DefaultRateLimitWait = 50 * time.Millisecond
+
+// ipLimiterSweepSize is the number of tracked IPs above which limiters with a
+// full bucket are dropped; a fresh limiter for the same IP behaves the same.
+const ipLimiterSweepSize = 1024
+
+// IPRateLimiter keeps a token bucket per client IP. Each bucket refills at
+// rps tokens per second and holds at most burst tokens.
+type IPRateLimiter struct {
+	rps   rate.Limit
+	burst int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// NewIPRateLimiter creates a limiter allowing rps requests per second per IP.
+// A burst of zero or less defaults to rps rounded up.
+func NewIPRateLimiter(rps float64, burst int) *IPRateLimiter {
+	if burst <= 0 {
+		burst = max(1, int(math.Ceil(rps)))
+	}
+	return &IPRateLimiter{
+		rps:      rate.Limit(rps),
+		burst:    burst,
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// Limiter returns the token bucket of ip, creating it on first use.
+func (l *IPRateLimiter) Limiter(ip string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limiter, ok := l.limiters[ip]; ok {
+		return limiter
+	}
+	if len(l.limiters) >= ipLimiterSweepSize {
+		for addr, limiter := range l.limiters {
+			if limiter.Tokens() >= float64(l.burst) {
+				delete(l.limiters, addr)
+			}
+		}
+	}
+	limiter := rate.NewLimiter(l.rps, l.burst)
+	l.limiters[ip] = limiter
+	return limiter
+}
+
+// Wait blocks until ip may send another request. It fails without waiting
+// when no token would be available within maxWait.
+func (l *IPRateLimiter) Wait(ip string, maxWait time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), maxWait)
+	defer cancel()
+	if err := l.Limiter(ip).Wait(ctx); err != nil {
+		return fmt.Errorf("rate limit exceeded for %s", ip)
+	}
+	return nil
+}
+
+// remoteIP returns the IP part of a connection's remote address.
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
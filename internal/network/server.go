@@ -1,10 +1,16 @@
 package network
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"time"
 	"waddlemap/internal/logger"
 	"waddlemap/internal/transaction"
 	"waddlemap/internal/types"
@@ -13,63 +19,206 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+// DefaultIdleTimeout is how long a connection may sit without sending a request.
+const DefaultIdleTimeout = 5 * time.Minute
+
 type Server struct {
 	Port      int
 	TxManager *transaction.Manager
+
+	// IdleTimeout closes connections that send no request within the duration.
+	// Zero disables the timeout.
+	IdleTimeout time.Duration
+
+	// ReadTimeout bounds how long a request body may take to arrive once its
+	// length header has been read, and WriteTimeout how long writing one
+	// response frame may take. Zero disables either timeout. ReadTimeout
+	// also bounds how long a request may run: searches still running past
+	// it are cancelled.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// MaxConnections caps the number of connections served at once; further
+	// connections get an error response and are closed. Zero means no limit.
+	MaxConnections int
+
+	// TLSConfig enables TLS on accepted connections. Nil serves plain TCP.
+	TLSConfig *tls.Config
+
+	// RateLimiter limits the requests per second of each client IP across
+	// all its connections. Requests that would wait longer than
+	// RateLimitWait for a token get an error response. Nil disables it.
+	RateLimiter   *IPRateLimiter
+	RateLimitWait time.Duration
+
+	// Auth, when set, requires a tenant token on every request and confines
+	// each connection to the collections of its tenant. Nil disables it.
+	Auth *TenantAuth
+
+	events *eventHub
 }
 
 func NewServer(port int, txMgr *transaction.Manager) *Server {
 	return &Server{
-		Port:      port,
-		TxManager: txMgr,
+		Port:          port,
+		TxManager:     txMgr,
+		IdleTimeout:   DefaultIdleTimeout,
+		RateLimitWait: DefaultRateLimitWait,
+		events:        newEventHub(),
 	}
 }
 
+// NewServerTLS creates a server that serves TLS using the certificate pair in
+// certFile and keyFile.
+func NewServerTLS(port int, txMgr *transaction.Manager, certFile, keyFile string) (*Server, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	s := NewServer(port, txMgr)
+	s.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return s, nil
+}
+
 func (s *Server) Start() error {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Port))
 	if err != nil {
 		return err
 	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on the listener until it is closed.
+// The listener is wrapped with TLS when TLSConfig is set.
+func (s *Server) Serve(listener net.Listener) error {
+	if s.TLSConfig != nil {
+		listener = tls.NewListener(listener, s.TLSConfig)
+	}
 	defer listener.Close()
 	// logger.Info("WaddleMap Server listening on port %d", s.Port)
 
+	// active holds one token per connection being served
+	var active chan struct{}
+	if s.MaxConnections > 0 {
+		active = make(chan struct{}, s.MaxConnections)
+	}
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
 			// logger.Error("Accept error: %v", err)
 			continue
 		}
 
 		// Optimize Buffer Size
-		if tcpConn, ok := conn.(*net.TCPConn); ok {
+		raw := conn
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			raw = tlsConn.NetConn()
+		}
+		if tcpConn, ok := raw.(*net.TCPConn); ok {
 			tcpConn.SetReadBuffer(65536) // 64KB
 			tcpConn.SetWriteBuffer(65536)
 		}
 
-		go s.handleConnection(conn)
+		if active == nil {
+			go s.handleConnection(conn)
+			continue
+		}
+		select {
+		case active <- struct{}{}:
+			go func() {
+				defer func() { <-active }()
+				s.handleConnection(conn)
+			}()
+		default:
+			go s.rejectConnection(conn)
+		}
 	}
 }
 
+// rejectConnection sends an error response to a connection over the
+// MaxConnections limit and closes it.
+func (s *Server) rejectConnection(conn net.Conn) {
+	defer conn.Close()
+	logger.Error("Rejecting connection from %s: limit of %d connections reached", conn.RemoteAddr(), s.MaxConnections)
+	var writeMu sync.Mutex
+	s.writeFrame(conn, &writeMu, &pb.WaddleResponse{
+		Success:      false,
+		ErrorMessage: fmt.Sprintf("server busy: limit of %d connections reached", s.MaxConnections),
+	})
+}
+
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
+	clientIP := remoteIP(conn)
+	// Requests are read through br, so that watchDisconnect can peek at the
+	// connection while a request runs without losing a pipelined one
+	br := bufio.NewReader(conn)
+
+	// Responses and subscription events share the connection; writeMu keeps frames whole.
+	var writeMu sync.Mutex
+	var eventWg sync.WaitGroup
+	connEventBus := make(map[string]chan *pb.Event)
+	// Transactions opened on this connection, with the writes buffered in
+	// each; their events are published when the transaction commits.
+	openTx := make(map[string][]*pb.WaddleRequest)
+	tenant := "" // Bound by the first authorized request when Auth is set
+	defer func() {
+		for id := range openTx {
+			s.TxManager.RollbackTransaction(id)
+		}
+		for _, ch := range connEventBus {
+			s.events.unsubscribe(ch)
+			close(ch)
+		}
+		eventWg.Wait()
+	}()
 
 	for {
+		// Drop clients that stay idle between requests. Connections with
+		// subscriptions are expected to sit idle while waiting for events.
+		if s.IdleTimeout > 0 && len(connEventBus) == 0 {
+			conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+
 		// 1. Read Length Header (4 bytes)
 		lenBuf := make([]byte, 4)
-		if _, err := io.ReadFull(conn, lenBuf); err != nil {
-			if err != io.EOF {
+		if _, err := io.ReadFull(br, lenBuf); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				logger.Info("Closing idle connection from %s", conn.RemoteAddr())
+			} else if err != io.EOF {
 				// logger.Error("Read header error: %v", err)
 			}
 			return
 		}
 		msgLen := binary.BigEndian.Uint32(lenBuf)
 
+		// Request started; replace the idle deadline with the read timeout
+		if s.ReadTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		} else if s.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Time{})
+		}
+
 		// 2. Read Message Body
 		buf := make([]byte, msgLen)
-		if _, err := io.ReadFull(conn, buf); err != nil {
-			// logger.Error("Read body error: %v", err)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				logger.Info("Closing connection from %s: request body not received within %s", conn.RemoteAddr(), s.ReadTimeout)
+			}
 			return
 		}
+		if s.ReadTimeout > 0 {
+			conn.SetReadDeadline(time.Time{})
+		}
 
 		// Decode Protobuf
 		var reqPb pb.WaddleRequest
@@ -78,6 +227,57 @@ func (s *Server) handleConnection(conn net.Conn) {
 			continue
 		}
 
+		// Rate-limited requests never reach the transaction manager
+		if s.RateLimiter != nil {
+			if err := s.RateLimiter.Wait(clientIP, s.RateLimitWait); err != nil {
+				respPb := &pb.WaddleResponse{RequestId: reqPb.RequestId, ErrorMessage: err.Error()}
+				if err := s.writeFrame(conn, &writeMu, respPb); err != nil {
+					return
+				}
+				continue
+			}
+		}
+
+		if s.Auth != nil {
+			if err := s.authorize(&reqPb, &tenant); err != nil {
+				respPb := &pb.WaddleResponse{RequestId: reqPb.RequestId, ErrorMessage: err.Error()}
+				if errors.Is(err, errUnauthorized) {
+					logger.Error("Rejecting request from %s: %v", conn.RemoteAddr(), err)
+					respPb.ErrorCode = pb.ErrorCode_UNAUTHORIZED
+				}
+				if err := s.writeFrame(conn, &writeMu, respPb); err != nil {
+					return
+				}
+				continue
+			}
+		}
+
+		// Subscriptions are per connection and never reach the transaction manager
+		if sub, ok := reqPb.Operation.(*pb.WaddleRequest_Subscribe); ok {
+			respPb := &pb.WaddleResponse{RequestId: reqPb.RequestId, Success: true}
+			if err := s.subscribe(sub.Subscribe, tenant, connEventBus); err != nil {
+				respPb.Success = false
+				respPb.ErrorMessage = err.Error()
+			} else {
+				eventWg.Add(1)
+				go func(ch chan *pb.Event) {
+					defer eventWg.Done()
+					for ev := range ch {
+						// Write errors end the connection on the request path;
+						// keep draining until the subscription is closed.
+						s.writeFrame(conn, &writeMu, &pb.WaddleResponse{
+							Success: true,
+							Result:  &pb.WaddleResponse_Event{Event: ev},
+						})
+					}
+				}(connEventBus[sub.Subscribe.SubscriptionId])
+			}
+			if err := s.writeFrame(conn, &writeMu, respPb); err != nil {
+				return
+			}
+			continue
+		}
+
 		// Map Proto Params to RequestContext
 		ctx := types.RequestContext{
 			ReqID:    reqPb.RequestId,
@@ -129,6 +329,9 @@ func (s *Server) handleConnection(conn net.Conn) {
 		case *pb.WaddleRequest_ReplaceBlock:
 			ctx.Operation = types.OpReplaceBlock
 			ctx.Params = op.ReplaceBlock
+		case *pb.WaddleRequest_UpdateConditional:
+			ctx.Operation = types.OpUpdateValueConditional
+			ctx.Params = op.UpdateConditional
 		case *pb.WaddleRequest_Search:
 			ctx.Operation = types.OpSearch
 			ctx.Params = op.Search
@@ -147,16 +350,69 @@ func (s *Server) handleConnection(conn net.Conn) {
 		case *pb.WaddleRequest_BatchAppend:
 			ctx.Operation = types.OpBatchAppendBlock
 			ctx.Params = op.BatchAppend
+		case *pb.WaddleRequest_SearchVariant:
+			ctx.Operation = types.OpSearchVariant
+			ctx.Params = op.SearchVariant
+		case *pb.WaddleRequest_BatchSearch:
+			ctx.Operation = types.OpBatchSearch
+			ctx.Params = op.BatchSearch
+		case *pb.WaddleRequest_BeginTx:
+			ctx.Operation = types.OpBeginTransaction
+			ctx.Params = op.BeginTx
+		case *pb.WaddleRequest_CommitTx:
+			ctx.Operation = types.OpCommitTransaction
+			ctx.Params = op.CommitTx
+		case *pb.WaddleRequest_RollbackTx:
+			ctx.Operation = types.OpRollbackTransaction
+			ctx.Params = op.RollbackTx
 		default:
 			logger.Info("Unknown operation: %T", reqPb.Operation)
 			continue
 		}
 
+		// Transactions can only be used on the connection that opened them
+		txID := reqPb.TransactionId
+		switch op := reqPb.Operation.(type) {
+		case *pb.WaddleRequest_CommitTx:
+			txID = op.CommitTx.TransactionId
+		case *pb.WaddleRequest_RollbackTx:
+			txID = op.RollbackTx.TransactionId
+		}
+		if _, open := openTx[txID]; txID != "" && !open {
+			respPb := &pb.WaddleResponse{
+				RequestId:    reqPb.RequestId,
+				ErrorMessage: fmt.Sprintf("transaction %q not found", txID),
+			}
+			if err := s.writeFrame(conn, &writeMu, respPb); err != nil {
+				return
+			}
+			continue
+		}
+		ctx.TxID = reqPb.TransactionId
+
+		// The request is cancelled if it outlasts ReadTimeout or the client
+		// goes away before the response
+		reqCtx := context.Background()
+		if reqPb.RequestId != "" {
+			// The request ID doubles as the trace ID of the request's log lines
+			reqCtx = logger.WithTraceID(reqCtx, reqPb.RequestId)
+		}
+		var cancel context.CancelFunc
+		if s.ReadTimeout > 0 {
+			reqCtx, cancel = context.WithTimeout(reqCtx, s.ReadTimeout)
+		} else {
+			reqCtx, cancel = context.WithCancel(reqCtx)
+		}
+		ctx.Ctx = reqCtx
+		stopWatch := watchDisconnect(conn, br, cancel)
+
 		// Send to TxMgr
 		s.TxManager.Requests <- ctx
 
 		// Wait for Response
 		respCtx := <-ctx.RespChan
+		stopWatch()
+		cancel()
 
 		// Encode Response
 		respPb := &pb.WaddleResponse{
@@ -167,6 +423,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 		if respCtx.Error != nil {
 			logger.Error("Op Error (ReqID: %s): %v", respCtx.ReqID, respCtx.Error)
 			respPb.ErrorMessage = respCtx.Error.Error()
+			respPb.ErrorCode = errorCode(respCtx.Error)
 		}
 
 		// Map Result
@@ -184,24 +441,131 @@ func (s *Server) handleConnection(conn net.Conn) {
 				respPb.Result = &pb.WaddleResponse_Block{Block: d}
 			case *pb.BlockList:
 				respPb.Result = &pb.WaddleResponse_BlockList{BlockList: d}
+			case *pb.BatchSearchResponse:
+				respPb.Result = &pb.WaddleResponse_BatchSearch{BatchSearch: d}
+			case *pb.BeginTransactionResponse:
+				respPb.Result = &pb.WaddleResponse_Transaction{Transaction: d}
+				openTx[d.TransactionId] = nil
 			}
 		}
+		if tenant != "" {
+			unscopeResponse(respPb, tenant)
+		}
 
-		data, err := proto.Marshal(respPb)
-		if err != nil {
-			logger.Error("Marshal error: %v", err)
+		switch reqPb.Operation.(type) {
+		case *pb.WaddleRequest_CommitTx:
+			// The transaction is closed whether or not the commit succeeded
+			if respCtx.Success {
+				for _, buffered := range openTx[txID] {
+					s.events.publish(eventsFor(buffered))
+				}
+			}
+			delete(openTx, txID)
+		case *pb.WaddleRequest_RollbackTx:
+			delete(openTx, txID)
+		default:
+			if !respCtx.Success {
+				break
+			}
+			if ctx.TxID != "" {
+				openTx[ctx.TxID] = append(openTx[ctx.TxID], &reqPb)
+			} else {
+				s.events.publish(eventsFor(&reqPb))
+			}
+		}
+
+		if err := s.writeFrame(conn, &writeMu, respPb); err != nil {
 			return
 		}
+	}
+}
 
-		// WRITE Response with Length Prefix
-		respLenBuf := make([]byte, 4)
-		binary.BigEndian.PutUint32(respLenBuf, uint32(len(data)))
+// authorize checks the tenant token of req and scopes it to the tenant. The
+// first authorized request binds the connection to its tenant in *tenant;
+// later requests must carry a token of the same tenant.
+func (s *Server) authorize(req *pb.WaddleRequest, tenant *string) error {
+	t, ok := s.Auth.Tenant(req.TenantToken)
+	if !ok || (*tenant != "" && t != *tenant) {
+		return errUnauthorized
+	}
+	*tenant = t
+	return scopeRequest(req, t)
+}
 
-		if _, err := conn.Write(respLenBuf); err != nil {
-			return
+// subscribe registers a subscription for this connection in connEventBus and the
+// server's event hub. On tenant connections it only receives events of the
+// tenant's collections.
+func (s *Server) subscribe(req *pb.SubscribeRequest, tenant string, connEventBus map[string]chan *pb.Event) error {
+	if req.SubscriptionId == "" {
+		return errors.New("subscription_id is required")
+	}
+	if _, exists := connEventBus[req.SubscriptionId]; exists {
+		return fmt.Errorf("subscription %q already exists on this connection", req.SubscriptionId)
+	}
+
+	sub := &subscription{
+		id:         req.SubscriptionId,
+		collection: req.Collection,
+		eventTypes: make(map[string]bool),
+		ch:         make(chan *pb.Event, subscriptionBuffer),
+		tenant:     tenant,
+	}
+	for _, t := range req.EventTypes {
+		switch t {
+		case EventAppend, EventUpdate, EventDelete, EventDrop:
+			sub.eventTypes[t] = true
+		default:
+			return fmt.Errorf("unknown event type %q", t)
 		}
-		if _, err := conn.Write(data); err != nil {
-			return
+	}
+
+	connEventBus[sub.id] = sub.ch
+	s.events.subscribe(sub)
+	return nil
+}
+
+// watchDisconnect calls cancel if the client closes conn before the returned
+// stop function is called. It peeks at br, so a request the client sends
+// meanwhile stays buffered for the connection loop; watching then ends, as
+// the client is evidently still there. stop interrupts the peek through the
+// read deadline, waits for it to return and clears the deadline.
+func watchDisconnect(conn net.Conn, br *bufio.Reader, cancel context.CancelFunc) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := br.Peek(1); err != nil {
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				cancel()
+			}
 		}
+	}()
+	return func() {
+		conn.SetReadDeadline(time.Now())
+		<-done
+		conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// writeFrame writes a length-prefixed response frame while holding mu,
+// failing if it takes longer than WriteTimeout.
+func (s *Server) writeFrame(conn net.Conn, mu *sync.Mutex, resp *pb.WaddleResponse) error {
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		logger.Error("Marshal error: %v", err)
+		return err
+	}
+
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if s.WriteTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+		defer conn.SetWriteDeadline(time.Time{})
 	}
+	_, err = conn.Write(buf)
+	return err
 }
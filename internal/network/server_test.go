@@ -0,0 +1,576 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"waddlemap/internal/storage"
+	"waddlemap/internal/transaction"
+	"waddlemap/internal/types"
+	pb "waddlemap/proto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestServer_IdleTimeoutClosesConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(0, nil)
+	server.IdleTimeout = 50 * time.Millisecond
+	go server.Serve(listener)
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// Wait past the idle timeout, then expect the server to have closed the connection.
+	time.Sleep(200 * time.Millisecond)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1)
+	_, err = conn.Read(buf)
+	if err == nil {
+		t.Fatal("Expected connection to be closed by server")
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatal("Connection still open after idle timeout")
+	}
+}
+
+func TestServer_ReadTimeoutClosesStalledRequest(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(0, nil)
+	server.IdleTimeout = 0
+	server.ReadTimeout = 50 * time.Millisecond
+	go server.Serve(listener)
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// Announce a 16-byte body, then stall
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, 16)
+	if _, err := conn.Write(header); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if err == nil {
+		t.Fatal("Expected connection to be closed by server")
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatal("Connection still open after read timeout")
+	}
+}
+
+func TestWatchDisconnect(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	br := bufio.NewReader(server)
+
+	// A request sent while watching stays readable and cancels nothing
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := watchDisconnect(server, br, cancel)
+	go client.Write([]byte("next"))
+	time.Sleep(10 * time.Millisecond)
+	stop()
+	if ctx.Err() != nil {
+		t.Error("Expected a request from the client not to cancel")
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "next" {
+		t.Errorf("Read %q, %v after stop; want the pipelined request", buf, err)
+	}
+
+	// Stopping an idle watch cancels nothing
+	ctx, cancel = context.WithCancel(context.Background())
+	watchDisconnect(server, br, cancel)()
+	if ctx.Err() != nil {
+		t.Error("Expected stop not to cancel")
+	}
+
+	// Closing the connection cancels
+	ctx, cancel = context.WithCancel(context.Background())
+	stop = watchDisconnect(server, br, cancel)
+	client.Close()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected the disconnect to cancel the request")
+	}
+	stop()
+}
+
+func TestServer_MaxConnectionsRejectsExtra(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(0, nil)
+	server.MaxConnections = 1
+	go server.Serve(listener)
+	defer listener.Close()
+
+	first, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+
+	// The second connection gets an error frame and is closed
+	second, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(second, header); err != nil {
+		t.Fatalf("Expected an error response, got %v", err)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := io.ReadFull(second, body); err != nil {
+		t.Fatal(err)
+	}
+	var resp pb.WaddleResponse
+	if err := proto.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success || resp.ErrorMessage == "" {
+		t.Fatalf("Expected a failed response with a message, got %+v", &resp)
+	}
+
+	// Closing the first connection frees its slot
+	first.Close()
+	time.Sleep(50 * time.Millisecond)
+	third, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer third.Close()
+	third.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = third.Read(make([]byte, 1))
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Fatalf("Expected third connection to be served, got %v", err)
+	}
+}
+
+// writeSelfSignedCert writes a certificate and key for 127.0.0.1 to dir and
+// returns their paths along with the parsed certificate.
+func writeSelfSignedCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "waddlemap-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestServer_TLSRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: filepath.Join(dir, "db"), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("secure", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	txMgr := transaction.NewManager(vm)
+	txMgr.Start()
+
+	certFile, keyFile, cert := writeSelfSignedCert(t, dir)
+	server, err := NewServerTLS(0, txMgr, certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewServerTLS failed: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	defer listener.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: roots})
+	if err != nil {
+		t.Fatalf("TLS dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req := &pb.WaddleRequest{
+		RequestId: "tls-1",
+		Operation: &pb.WaddleRequest_ListCols{ListCols: &pb.ListCollectionsRequest{}},
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	lenBuf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, lenBuf); err != nil {
+		t.Fatalf("Reading response header failed: %v", err)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(lenBuf))
+	if _, err := io.ReadFull(conn, body); err != nil {
+		t.Fatalf("Reading response body failed: %v", err)
+	}
+	var resp pb.WaddleResponse
+	if err := proto.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.RequestId != "tls-1" {
+		t.Fatalf("Unexpected response: %+v", &resp)
+	}
+	cols := resp.GetColList().GetCollections()
+	if len(cols) != 1 || cols[0].Name != "secure" {
+		t.Errorf("Expected collection list [secure], got %v", cols)
+	}
+
+}
+
+// roundTrip sends req on conn and reads one response frame.
+func roundTrip(t *testing.T, conn net.Conn, req *pb.WaddleRequest) *pb.WaddleResponse {
+	t.Helper()
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	return readResponse(t, conn)
+}
+
+// readResponse reads one response frame from conn.
+func readResponse(t *testing.T, conn net.Conn) *pb.WaddleResponse {
+	t.Helper()
+	lenBuf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, lenBuf); err != nil {
+		t.Fatalf("Reading response header failed: %v", err)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(lenBuf))
+	if _, err := io.ReadFull(conn, body); err != nil {
+		t.Fatalf("Reading response body failed: %v", err)
+	}
+	var resp pb.WaddleResponse
+	if err := proto.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return &resp
+}
+
+func TestServer_Transaction(t *testing.T) {
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("col", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	txMgr := transaction.NewManager(vm)
+	txMgr.Start()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go NewServer(0, txMgr).Serve(listener)
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	begin := func() string {
+		resp := roundTrip(t, conn, &pb.WaddleRequest{
+			Operation: &pb.WaddleRequest_BeginTx{BeginTx: &pb.BeginTransactionRequest{}},
+		})
+		if !resp.Success || resp.GetTransaction().GetTransactionId() == "" {
+			t.Fatalf("Begin failed: %+v", resp)
+		}
+		return resp.GetTransaction().GetTransactionId()
+	}
+	appendTx := func(txID, key string) *pb.WaddleResponse {
+		return roundTrip(t, conn, &pb.WaddleRequest{
+			TransactionId: txID,
+			Operation: &pb.WaddleRequest_AppendBlock{AppendBlock: &pb.AppendBlockRequest{
+				Collection: "col", Key: key, Block: &pb.BlockData{Primary: key, Vector: []float32{1, 0}},
+			}},
+		})
+	}
+	contains := func(key string) bool {
+		ok, err := vm.ContainsKey("col", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	txID := begin()
+	for _, key := range []string{"a", "b"} {
+		if resp := appendTx(txID, key); !resp.Success {
+			t.Fatalf("Buffered append failed: %s", resp.ErrorMessage)
+		}
+	}
+	if contains("a") || contains("b") {
+		t.Fatal("Buffered writes were applied before commit")
+	}
+	// Only writes may be part of a transaction
+	resp := roundTrip(t, conn, &pb.WaddleRequest{
+		TransactionId: txID,
+		Operation:     &pb.WaddleRequest_ListKeys{ListKeys: &pb.ListKeysRequest{Collection: "col"}},
+	})
+	if resp.Success {
+		t.Error("Expected a read tagged with a transaction to fail")
+	}
+
+	resp = roundTrip(t, conn, &pb.WaddleRequest{
+		Operation: &pb.WaddleRequest_CommitTx{CommitTx: &pb.CommitTransactionRequest{TransactionId: txID}},
+	})
+	if !resp.Success || resp.GetLength() != 2 {
+		t.Fatalf("Commit failed: %+v", resp)
+	}
+	if !contains("a") || !contains("b") {
+		t.Fatal("Expected both keys after commit")
+	}
+
+	// Committed transactions are closed
+	if resp := appendTx(txID, "c"); resp.Success {
+		t.Error("Expected a write to a committed transaction to fail")
+	}
+
+	txID = begin()
+	if resp := appendTx(txID, "c"); !resp.Success {
+		t.Fatalf("Buffered append failed: %s", resp.ErrorMessage)
+	}
+	resp = roundTrip(t, conn, &pb.WaddleRequest{
+		Operation: &pb.WaddleRequest_RollbackTx{RollbackTx: &pb.RollbackTransactionRequest{TransactionId: txID}},
+	})
+	if !resp.Success {
+		t.Fatalf("Rollback failed: %s", resp.ErrorMessage)
+	}
+	if contains("c") {
+		t.Error("Rolled back write was applied")
+	}
+}
+
+func TestServer_ErrorCodes(t *testing.T) {
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("col", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	txMgr := transaction.NewManager(vm)
+	txMgr.Start()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go NewServer(0, txMgr).Serve(listener)
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	getBlock := func(collection, key string) *pb.WaddleRequest {
+		return &pb.WaddleRequest{Operation: &pb.WaddleRequest_GetBlock{GetBlock: &pb.GetBlockRequest{Collection: collection, Key: key}}}
+	}
+	tests := []struct {
+		name string
+		req  *pb.WaddleRequest
+		want pb.ErrorCode
+	}{
+		{"missing collection", getBlock("nope", "k"), pb.ErrorCode_NOT_FOUND},
+		{"missing key", getBlock("col", "k"), pb.ErrorCode_NOT_FOUND},
+		{"dimension mismatch", &pb.WaddleRequest{Operation: &pb.WaddleRequest_AppendBlock{AppendBlock: &pb.AppendBlockRequest{
+			Collection: "col", Key: "k", Block: &pb.BlockData{Vector: []float32{1, 0, 0}},
+		}}}, pb.ErrorCode_INVALID_ARGUMENT},
+	}
+	for _, tt := range tests {
+		resp := roundTrip(t, conn, tt.req)
+		if resp.Success || resp.ErrorCode != tt.want {
+			t.Errorf("%s: got error code %v (%q), want %v", tt.name, resp.ErrorCode, resp.ErrorMessage, tt.want)
+		}
+	}
+}
+
+func TestServer_UpdateValueConditional(t *testing.T) {
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("col", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("col", "k", &types.BlockData{Primary: "first", Vector: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	txMgr := transaction.NewManager(vm)
+	txMgr.Start()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go NewServer(0, txMgr).Serve(listener)
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	update := func(expected uint64, primary string) *pb.WaddleResponse {
+		return roundTrip(t, conn, &pb.WaddleRequest{Operation: &pb.WaddleRequest_UpdateConditional{UpdateConditional: &pb.UpdateValueConditional{
+			Collection: "col", Key: "k", ExpectedVersion: expected, Block: &pb.BlockData{Primary: primary, Vector: []float32{0, 1}},
+		}}})
+	}
+	if resp := update(0, "second"); !resp.Success {
+		t.Fatalf("Conditional update at version 0 failed: %s", resp.ErrorMessage)
+	}
+	if resp := update(0, "third"); resp.Success || resp.ErrorCode != pb.ErrorCode_VERSION_CONFLICT {
+		t.Errorf("Conditional update at a stale version: got error code %v (%q)", resp.ErrorCode, resp.ErrorMessage)
+	}
+
+	resp := roundTrip(t, conn, &pb.WaddleRequest{Operation: &pb.WaddleRequest_GetBlock{GetBlock: &pb.GetBlockRequest{Collection: "col", Key: "k"}}})
+	if block := resp.GetBlock(); block.GetPrimary() != "second" || block.GetVersion() != 1 {
+		t.Errorf("Expected the second value at version 1, got %+v", block)
+	}
+}
+
+func TestServer_RateLimitPerIP(t *testing.T) {
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	defer vm.Close()
+	txMgr := transaction.NewManager(vm)
+	txMgr.Start()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(0, txMgr)
+	server.RateLimiter = NewIPRateLimiter(1, 5)
+	go server.Serve(listener)
+	defer listener.Close()
+
+	// Both connections come from 127.0.0.1 and share one bucket
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conns = append(conns, conn)
+	}
+
+	succeeded, limited := 0, 0
+	for i := 0; i < 20; i++ {
+		resp := roundTrip(t, conns[i%2], &pb.WaddleRequest{
+			Operation: &pb.WaddleRequest_ListCols{ListCols: &pb.ListCollectionsRequest{}},
+		})
+		switch {
+		case resp.Success:
+			succeeded++
+		case strings.Contains(resp.ErrorMessage, "rate limit exceeded"):
+			limited++
+		default:
+			t.Fatalf("Unexpected error: %s", resp.ErrorMessage)
+		}
+	}
+	if succeeded < 5 || succeeded > 7 || limited == 0 {
+		t.Errorf("Expected about the burst of 5 to succeed and the rest to be limited, got %d ok and %d limited", succeeded, limited)
+	}
+}
@@ -0,0 +1,33 @@
+// Package replication streams the write-ahead log of a primary server to
+// read-only replicas.
+//
+// A replica connects to the primary's replication port and sends the LSN of
+// the last entry it applied. The primary answers with the entries logged
+// since then that are still in its WAL files, followed by every new entry as
+// it is logged. Both sides use gob over the TCP connection. A replica that
+// disconnects, or falls too far behind the live stream, reconnects and
+// catches up from the files; one whose position was removed by a checkpoint
+// has to be reseeded from a snapshot of the primary.
+package replication
+
+import (
+	"time"
+
+	"waddlemap/internal/storage"
+)
+
+// heartbeatInterval is how often the primary sends a frame on an idle
+// stream. A replica that hears nothing for three intervals reconnects.
+const heartbeatInterval = 5 * time.Second
+
+// hello is the first message of a replica.
+type hello struct {
+	LastLSN uint64 // LSN of the last entry applied, 0 for an empty replica
+}
+
+// frame is a message of the primary: a WAL entry, a heartbeat (neither set)
+// or an error that ends the stream.
+type frame struct {
+	Entry *storage.WALEntry
+	Err   string
+}
@@ -0,0 +1,234 @@
+package replication
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"waddlemap/internal/logger"
+	"waddlemap/internal/storage"
+)
+
+// Defaults for the reconnection backoff of a Replica.
+const (
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+)
+
+// stateFile holds the LSN of the last entry a replica applied, in its data
+// directory.
+const stateFile = "replica.lsn"
+
+// Replica follows the WAL of a primary and applies its entries, in LSN
+// order, to a local VectorManager, which it makes read-only. When the
+// connection drops it reconnects with exponential backoff and resumes after
+// the last entry applied, which survives restarts.
+type Replica struct {
+	primary string
+	vm      *storage.VectorManager
+	state   *os.File
+
+	// InitialBackoff is the wait before the first reconnection attempt,
+	// doubled after each failed one up to MaxBackoff. Set them before Start.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	applied atomic.Uint64
+	pending map[string][]storage.WALEntry // Transaction entries awaiting their commit marker
+
+	mu      sync.Mutex
+	conn    net.Conn // Current connection to the primary, if any
+	started bool
+	stopped bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewReplica creates a replica of the primary at addr (host:port) that
+// applies entries to vm and keeps its position in dataPath.
+func NewReplica(addr string, vm *storage.VectorManager, dataPath string) (*Replica, error) {
+	state, err := os.OpenFile(filepath.Join(dataPath, stateFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replica state: %w", err)
+	}
+	r := &Replica{
+		primary:        addr,
+		vm:             vm,
+		state:          state,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		pending:        make(map[string][]storage.WALEntry),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	var buf [8]byte
+	if _, err := state.ReadAt(buf[:], 0); err != nil && !errors.Is(err, io.EOF) {
+		state.Close()
+		return nil, fmt.Errorf("failed to read replica state: %w", err)
+	}
+	r.applied.Store(binary.BigEndian.Uint64(buf[:]))
+	vm.SetReadOnly(true)
+	return r, nil
+}
+
+// AppliedLSN returns the LSN of the last primary entry applied.
+func (r *Replica) AppliedLSN() uint64 {
+	return r.applied.Load()
+}
+
+// Start begins following the primary in the background.
+func (r *Replica) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started || r.stopped {
+		return
+	}
+	r.started = true
+	go r.run()
+}
+
+// Stop disconnects from the primary and waits for the entry being applied,
+// if any. The VectorManager stays read-only.
+func (r *Replica) Stop() {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return
+	}
+	r.stopped = true
+	close(r.stop)
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	started := r.started
+	r.mu.Unlock()
+
+	if started {
+		<-r.done
+	}
+	r.state.Close()
+}
+
+// run follows the primary until Stop, reconnecting after failures.
+func (r *Replica) run() {
+	defer close(r.done)
+	backoff := r.InitialBackoff
+	for {
+		progressed, err := r.follow()
+		if progressed {
+			backoff = r.InitialBackoff
+		}
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		logger.Error("Replication from %s stopped at LSN %d: %v; reconnecting in %v", r.primary, r.AppliedLSN(), err, backoff)
+
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, r.MaxBackoff)
+	}
+}
+
+// follow connects to the primary and applies the entries it streams until
+// the connection fails. It reports whether any entry arrived.
+func (r *Replica) follow() (progressed bool, err error) {
+	conn, err := net.DialTimeout("tcp", r.primary, 3*heartbeatInterval)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		conn.Close()
+		return false, nil
+	}
+	r.conn = conn
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.conn = nil
+		r.mu.Unlock()
+		conn.Close()
+	}()
+
+	// Transactions cut off by the last disconnect are sent again in full
+	clear(r.pending)
+
+	if err := gob.NewEncoder(conn).Encode(hello{LastLSN: r.AppliedLSN()}); err != nil {
+		return false, err
+	}
+	logger.Info("Replicating from %s after LSN %d", r.primary, r.AppliedLSN())
+
+	dec := gob.NewDecoder(bufio.NewReader(conn))
+	for {
+		conn.SetReadDeadline(time.Now().Add(3 * heartbeatInterval))
+		var f frame
+		if err := dec.Decode(&f); err != nil {
+			return progressed, err
+		}
+		if f.Err != "" {
+			return progressed, fmt.Errorf("primary refused the stream: %s", f.Err)
+		}
+		if f.Entry == nil {
+			continue // Heartbeat
+		}
+		progressed = true
+		if err := r.apply(*f.Entry); err != nil {
+			return progressed, err
+		}
+	}
+}
+
+// apply applies one streamed entry, holding back the entries of a
+// transaction until its commit marker arrives. The position only advances
+// past complete operations, so a replica that stops mid-transaction
+// receives the whole transaction again.
+func (r *Replica) apply(entry storage.WALEntry) error {
+	if entry.LSN <= r.AppliedLSN() {
+		return nil // Applied before a reconnect
+	}
+
+	entries := []storage.WALEntry{entry}
+	switch {
+	case entry.OpType == storage.WALOpCommit:
+		entries = r.pending[entry.TxID]
+		delete(r.pending, entry.TxID)
+	case entry.TxID != "":
+		r.pending[entry.TxID] = append(r.pending[entry.TxID], entry)
+		return nil
+	}
+
+	for _, e := range entries {
+		// The primary logs writes before validating some of them, so a write
+		// it rejected is logged and fails here the same way
+		if err := r.vm.ApplyReplicated(e); err != nil {
+			logger.Error("Replicated entry %d (%s %q) failed: %v", e.LSN, e.Collection, e.Key, err)
+		}
+	}
+	return r.saveLSN(entry.LSN)
+}
+
+// saveLSN records lsn as the last entry applied.
+func (r *Replica) saveLSN(lsn uint64) error {
+	r.applied.Store(lsn)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], lsn)
+	if _, err := r.state.WriteAt(buf[:], 0); err != nil {
+		return fmt.Errorf("failed to save replica state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package replication
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"waddlemap/client/waddlemap"
+	"waddlemap/internal/network"
+	"waddlemap/internal/storage"
+	"waddlemap/internal/transaction"
+	"waddlemap/internal/types"
+	pb "waddlemap/proto"
+)
+
+func openVM(t *testing.T, dir string) *storage.VectorManager {
+	t.Helper()
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: dir, SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	return vm
+}
+
+// serve serves vm on a TCP port and returns its address.
+func serve(t *testing.T, vm *storage.VectorManager) string {
+	t.Helper()
+	txMgr := transaction.NewManager(vm)
+	txMgr.Start()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go network.NewServer(0, txMgr).Serve(listener)
+	return listener.Addr().String()
+}
+
+func startReplicator(t *testing.T, vm *storage.VectorManager) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReplicator(0, vm)
+	go r.Serve(listener)
+	t.Cleanup(func() { r.Close() })
+	return listener.Addr().String()
+}
+
+func startReplica(t *testing.T, primary string, vm *storage.VectorManager, dir string) *Replica {
+	t.Helper()
+	r, err := NewReplica(primary, vm, dir)
+	if err != nil {
+		t.Fatalf("NewReplica failed: %v", err)
+	}
+	r.InitialBackoff = 10 * time.Millisecond
+	r.Start()
+	t.Cleanup(r.Stop)
+	return r
+}
+
+func dial(t *testing.T, addr string) *waddlemap.Client {
+	t.Helper()
+	c, err := waddlemap.Dial(addr, &waddlemap.Options{PoolSize: 2})
+	if err != nil {
+		t.Fatalf("Dial %s failed: %v", addr, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// waitCaughtUp waits until the replica has applied every entry of the primary.
+func waitCaughtUp(t *testing.T, r *Replica, primary *storage.VectorManager) {
+	t.Helper()
+	want := primary.WALPosition()
+	for deadline := time.Now().Add(10 * time.Second); r.AppliedLSN() < want; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Replica stuck at LSN %d, primary is at %d", r.AppliedLSN(), want)
+		}
+	}
+}
+
+func appendBlocks(t *testing.T, c *waddlemap.Client, key string, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		block := &pb.BlockData{Primary: fmt.Sprintf("%s/%d", key, i), Vector: []float32{float32(i), 1}}
+		if err := c.AppendBlock("docs", key, block); err != nil {
+			t.Fatalf("AppendBlock %s/%d failed: %v", key, i, err)
+		}
+	}
+}
+
+// checkBlocks checks that key holds blocks 0..n-1 on the node behind c.
+func checkBlocks(t *testing.T, c *waddlemap.Client, key string, n int) {
+	t.Helper()
+	for i := range n {
+		block, err := c.GetBlock("docs", key, uint32(i))
+		if err != nil {
+			t.Fatalf("GetBlock %s/%d failed: %v", key, i, err)
+		}
+		if want := fmt.Sprintf("%s/%d", key, i); block.Primary != want {
+			t.Fatalf("Block %s/%d = %q, want %q", key, i, block.Primary, want)
+		}
+	}
+}
+
+func TestReplication_StreamsAndBackfills(t *testing.T) {
+	primaryVM := openVM(t, t.TempDir())
+	t.Cleanup(func() { primaryVM.Close() })
+	primaryAddr := serve(t, primaryVM)
+	replAddr := startReplicator(t, primaryVM)
+	replicaDir := t.TempDir()
+	replicaVM := openVM(t, replicaDir)
+	t.Cleanup(func() { replicaVM.Close() }) // Closes the reopened one too
+	replicaAddr := serve(t, replicaVM)
+	replica := startReplica(t, replAddr, replicaVM, replicaDir)
+
+	primary, secondary := dial(t, primaryAddr), dial(t, replicaAddr)
+	if err := primary.CreateCollection("docs", 2, "l2"); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	appendBlocks(t, primary, "a", 0, 20)
+	appendBlocks(t, primary, "gone", 0, 3)
+	if err := primary.DeleteKey("docs", "gone"); err != nil {
+		t.Fatal(err)
+	}
+	err := primaryVM.CommitTransaction("tx1", []storage.TxOp{
+		{Type: storage.TxOpAppend, Collection: "docs", Key: "b", Block: &types.BlockData{Primary: "b/0", Vector: []float32{50, 1}}},
+		{Type: storage.TxOpAppend, Collection: "docs", Key: "b", Block: &types.BlockData{Primary: "b/1", Vector: []float32{51, 1}}},
+	})
+	if err != nil {
+		t.Fatalf("CommitTransaction failed: %v", err)
+	}
+
+	waitCaughtUp(t, replica, primaryVM)
+	checkBlocks(t, secondary, "a", 20)
+	checkBlocks(t, secondary, "b", 2)
+	if _, err := secondary.GetBlock("docs", "gone", 0); err == nil {
+		t.Error("Expected the deleted key to be gone on the replica")
+	}
+	results, err := secondary.Search(&pb.SearchRequest{Collection: "docs", Query: []float32{7, 1}, TopK: 1})
+	if err != nil {
+		t.Fatalf("Search on the replica failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Key != "a" || results[0].Index != 7 {
+		t.Errorf("Expected a/7 as the nearest block on the replica, got %+v", results)
+	}
+	err = secondary.AppendBlock("docs", "a", &pb.BlockData{Vector: []float32{1, 1}})
+	if err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("Expected the replica to reject appends, got %v", err)
+	}
+
+	// Writes made while the replica is down are sent from the WAL files
+	// when it comes back, and its position survives a restart
+	replica.Stop()
+	appendBlocks(t, primary, "a", 20, 30)
+	replicaVM.Close()
+	replicaVM = openVM(t, replicaDir)
+	replica = startReplica(t, replAddr, replicaVM, replicaDir)
+	if replica.AppliedLSN() == 0 {
+		t.Error("Expected the replica to resume from its saved position")
+	}
+	waitCaughtUp(t, replica, primaryVM)
+	if n, err := replicaVM.GetKeyLength("docs", "a"); err != nil || n != 30 {
+		t.Errorf("Replica key length after backfill = %d, %v; want 30", n, err)
+	}
+	for i := range 30 {
+		block, err := replicaVM.GetBlock("docs", "a", uint32(i))
+		if err != nil || block.Primary != fmt.Sprintf("a/%d", i) {
+			t.Fatalf("Replica block a/%d = %+v, %v", i, block, err)
+		}
+	}
+}
+
+func TestReplication_RefusesCheckpointedPosition(t *testing.T) {
+	primaryVM := openVM(t, t.TempDir())
+	t.Cleanup(func() { primaryVM.Close() })
+	replAddr := startReplicator(t, primaryVM)
+	if err := primaryVM.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primaryVM.AppendBlock("docs", "a", &types.BlockData{Vector: []float32{1, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := primaryVM.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty replica needs entries the checkpoint removed
+	replicaDir := t.TempDir()
+	replicaVM := openVM(t, replicaDir)
+	t.Cleanup(func() { replicaVM.Close() })
+	replica := startReplica(t, replAddr, replicaVM, replicaDir)
+	time.Sleep(100 * time.Millisecond)
+	if replica.AppliedLSN() != 0 {
+		t.Errorf("Expected nothing to be applied, replica is at LSN %d", replica.AppliedLSN())
+	}
+	if colls := replicaVM.ListCollections(); len(colls) != 0 {
+		t.Errorf("Expected no collections on the replica, got %v", colls)
+	}
+}
@@ -0,0 +1,176 @@
+package replication
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"waddlemap/internal/logger"
+	"waddlemap/internal/storage"
+)
+
+// liveBuffer is the number of WAL entries buffered for each replica. A
+// replica further behind than that is disconnected and catches up from the
+// WAL files when it reconnects.
+const liveBuffer = 4096
+
+// Replicator serves the WAL of a primary to the replicas that connect to it.
+type Replicator struct {
+	Port int
+	vm   *storage.VectorManager
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	done     chan struct{} // Closed by Close
+	wg       sync.WaitGroup
+}
+
+// NewReplicator creates a replicator for the WAL of vm.
+func NewReplicator(port int, vm *storage.VectorManager) *Replicator {
+	return &Replicator{Port: port, vm: vm, conns: make(map[net.Conn]struct{}), done: make(chan struct{})}
+}
+
+// Start listens on Port and serves replicas until Close.
+func (r *Replicator) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", r.Port))
+	if err != nil {
+		return err
+	}
+	return r.Serve(listener)
+}
+
+// Serve accepts replicas on the listener until Close.
+func (r *Replicator) Serve(listener net.Listener) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		listener.Close()
+		return nil
+	}
+	r.listener = listener
+	r.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			continue
+		}
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		r.conns[conn] = struct{}{}
+		r.wg.Add(1)
+		r.mu.Unlock()
+
+		go func() {
+			defer r.wg.Done()
+			r.serveReplica(conn)
+			r.mu.Lock()
+			delete(r.conns, conn)
+			r.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops accepting replicas, disconnects the connected ones and waits
+// for their streams to end.
+func (r *Replicator) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	var err error
+	if r.listener != nil {
+		err = r.listener.Close()
+	}
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return err
+}
+
+// serveReplica streams the WAL to one replica until either side goes away.
+func (r *Replicator) serveReplica(conn net.Conn) {
+	defer conn.Close()
+	addr := conn.RemoteAddr().String()
+
+	var h hello
+	conn.SetReadDeadline(time.Now().Add(3 * heartbeatInterval))
+	if err := gob.NewDecoder(conn).Decode(&h); err != nil {
+		logger.Error("Replica %s sent no valid handshake: %v", addr, err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	bw := bufio.NewWriter(conn)
+	enc := gob.NewEncoder(bw)
+	send := func(f frame) error {
+		conn.SetWriteDeadline(time.Now().Add(3 * heartbeatInterval))
+		return enc.Encode(f)
+	}
+
+	backlog, live, err := r.vm.FollowWAL(h.LastLSN, liveBuffer)
+	if err != nil {
+		logger.Error("Replica %s cannot resume after LSN %d: %v", addr, h.LastLSN, err)
+		if send(frame{Err: err.Error()}) == nil {
+			bw.Flush()
+		}
+		return
+	}
+	defer r.vm.UnfollowWAL(live)
+	logger.Info("Replica %s connected at LSN %d, sending %d logged entries", addr, h.LastLSN, len(backlog))
+
+	for i := range backlog {
+		if err := send(frame{Entry: &backlog[i]}); err != nil {
+			logger.Error("Replication to %s failed: %v", addr, err)
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		// Batch whatever is queued into one write
+		if len(live) == 0 {
+			if err := bw.Flush(); err != nil {
+				logger.Error("Replication to %s failed: %v", addr, err)
+				return
+			}
+		}
+		var f frame
+		select {
+		case entry, ok := <-live:
+			if !ok {
+				logger.Info("Replica %s fell behind or the WAL closed; disconnecting", addr)
+				bw.Flush()
+				return
+			}
+			f.Entry = &entry
+		case <-heartbeat.C:
+		case <-r.done:
+			return
+		}
+		if err := send(f); err != nil {
+			logger.Error("Replication to %s failed: %v", addr, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"waddlemap/internal/types"
+)
+
+// MaxEfSearch bounds the EfSearch AdaptiveSearch grows to.
+const MaxEfSearch = 1024
+
+// DefaultAdaptiveEfTarget is the search latency AdaptiveSearch aims for
+// unless configured otherwise.
+const DefaultAdaptiveEfTarget = 10 * time.Millisecond
+
+// adaptiveEfAlpha is the weight of the latest search in the moving average
+// of EfSearch values.
+const adaptiveEfAlpha = 0.1
+
+// adaptiveEf is the EfSearch learned by AdaptiveSearch, saved to meta.json.
+type adaptiveEf struct {
+	mu      sync.Mutex
+	learned float64 // Exponentially weighted average; 0 before the first search
+	dirty   bool    // Changed since the last save
+}
+
+// AdaptiveSearch searches the primary index like Search, with an EfSearch
+// tuned to keep searches near targetLatencyMs. It starts from the EfSearch
+// learned by earlier calls, or the configured one, and times the search:
+// below half the target the next EfSearch doubles, up to MaxEfSearch, for
+// better recall; above the target it halves, down to topK. The learned value
+// is a moving average of those, so a single outlier does not swing it.
+// Collections without an HNSW index search exactly, as with Search.
+func (c *Collection) AdaptiveSearch(query []float32, topK uint32, targetLatencyMs float64, filter *types.SearchFilter) ([]types.SearchResultItem, error) {
+	return c.AdaptiveSearchContext(context.Background(), query, topK, targetLatencyMs, filter)
+}
+
+// AdaptiveSearchContext is AdaptiveSearch stopping with a
+// *types.CancelledError once ctx is done. A cancelled search does not change
+// the learned EfSearch.
+func (c *Collection) AdaptiveSearchContext(ctx context.Context, query []float32, topK uint32, targetLatencyMs float64, filter *types.SearchFilter) ([]types.SearchResultItem, error) {
+	if c.HNSWIndex == nil {
+		return c.SearchContext(ctx, query, topK, filter)
+	}
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ef := c.adaptiveEfStart(int(topK))
+	bitset, exclude := c.buildFilter(filter)
+	start := time.Now()
+	hnswResults, err := c.HNSWIndex.SearchEfContext(ctx, c.indexVector(query), int(topK)+len(exclude), ef, bitset)
+	if err != nil {
+		return nil, err
+	}
+	elapsedMs := float64(time.Since(start).Microseconds()) / 1000
+
+	next := ef
+	switch {
+	case elapsedMs < targetLatencyMs/2:
+		next = min(2*ef, MaxEfSearch)
+	case elapsedMs > targetLatencyMs:
+		next = max(ef/2, int(topK), 1)
+	}
+	c.adaptiveEf.mu.Lock()
+	if c.adaptiveEf.learned == 0 {
+		c.adaptiveEf.learned = float64(ef)
+	}
+	c.adaptiveEf.learned = adaptiveEfAlpha*float64(next) + (1-adaptiveEfAlpha)*c.adaptiveEf.learned
+	c.adaptiveEf.dirty = true
+	c.adaptiveEf.mu.Unlock()
+
+	return c.toResultItems(trimByDistance(hnswResults, filter), topK, exclude), nil
+}
+
+// adaptiveEfStart returns the EfSearch of the next adaptive search, at least
+// topK.
+func (c *Collection) adaptiveEfStart(topK int) int {
+	c.adaptiveEf.mu.Lock()
+	learned := c.adaptiveEf.learned
+	c.adaptiveEf.mu.Unlock()
+
+	ef := c.HNSWIndex.EfSearch
+	if learned > 0 {
+		ef = int(math.Round(learned))
+	}
+	return min(max(ef, topK, 1), max(MaxEfSearch, topK))
+}
+
+// LearnedEfSearch returns the EfSearch AdaptiveSearch has converged to, or 0
+// if it has not run on the collection.
+func (c *Collection) LearnedEfSearch() float64 {
+	c.adaptiveEf.mu.Lock()
+	defer c.adaptiveEf.mu.Unlock()
+	return c.adaptiveEf.learned
+}
+
+// saveLearnedEf records the learned EfSearch in meta.json if it changed.
+// Caller must hold mu exclusively.
+func (c *Collection) saveLearnedEf() error {
+	c.adaptiveEf.mu.Lock()
+	defer c.adaptiveEf.mu.Unlock()
+	if !c.adaptiveEf.dirty {
+		return nil
+	}
+	meta, err := LoadCollectionMeta(c.basePath)
+	if err != nil {
+		return err
+	}
+	meta.LearnedEfSearch = c.adaptiveEf.learned
+	if err := SaveCollectionMeta(c.basePath, meta); err != nil {
+		return err
+	}
+	c.adaptiveEf.dirty = false
+	return nil
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestCollection_AdaptiveSearch(t *testing.T) {
+	dataPath := t.TempDir()
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: dataPath, SyncMode: "normal", AdaptiveEfEnabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CreateCollection("adaptive", 8, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	coll, _ := vm.GetCollection("adaptive")
+	rng := rand.New(rand.NewSource(1))
+	vec := func() []float32 {
+		v := make([]float32, 8)
+		for i := range v {
+			v[i] = rng.Float32()
+		}
+		return v
+	}
+	keys := make([]string, 500)
+	blocks := make([]*types.BlockData, 500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("doc%03d", i)
+		blocks[i] = &types.BlockData{Primary: keys[i], Vector: vec()}
+	}
+	if _, err := vm.BatchAppendBlocks("adaptive", keys, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if coll.LearnedEfSearch() != 0 {
+		t.Fatal("Expected no learned EfSearch before any adaptive search")
+	}
+
+	// Searches far below the target raise EfSearch toward MaxEfSearch
+	query := blocks[42].Vector
+	for range 100 {
+		results, err := coll.AdaptiveSearch(query, 5, math.MaxFloat64, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 5 || results[0].Key != "doc042" {
+			t.Fatalf("AdaptiveSearch returned %v, want 5 results led by doc042", results)
+		}
+	}
+	if ef := coll.LearnedEfSearch(); ef <= DefaultEfSearch || ef > MaxEfSearch {
+		t.Errorf("Fast searches learned EfSearch %v, want in (%d, %d]", ef, DefaultEfSearch, MaxEfSearch)
+	}
+
+	// Searches over the target lower it toward topK
+	for range 200 {
+		if _, err := coll.AdaptiveSearch(query, 5, -1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ef := coll.LearnedEfSearch(); ef < 5 || ef > 10 {
+		t.Errorf("Slow searches learned EfSearch %v, want close to topK 5", ef)
+	}
+
+	// The VectorManager searches adaptively when enabled, and the learned
+	// value is reported and survives a restart
+	if _, err := vm.Search("adaptive", query, 5, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	learned := coll.LearnedEfSearch()
+	stats, err := vm.CollectionStats("adaptive")
+	if err != nil || stats.AdaptiveEf != learned {
+		t.Errorf("CollectionStats adaptive EfSearch = %v, %v; want %v", stats.AdaptiveEf, err, learned)
+	}
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	vm, err = NewVectorManager(&types.DBSchemaConfig{DataPath: dataPath, SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	coll, _ = vm.GetCollection("adaptive")
+	if got := coll.LearnedEfSearch(); got != learned {
+		t.Errorf("Learned EfSearch after restart = %v, want %v", got, learned)
+	}
+}
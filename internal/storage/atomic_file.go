@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// writeFileAtomic replaces the file at path with what write produces. The
+// data is written to path.tmp and fsynced before it is renamed over path, so
+// a crash during the write leaves the previous file intact rather than a
+// truncated one. The rename is made durable by fsyncing the directory.
+func writeFileAtomic(path string, write func(w *bufio.Writer) error) error {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir fsyncs a directory so that renames and creations in it survive a
+// crash. Windows cannot sync directories, and does not need to.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
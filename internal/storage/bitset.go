@@ -1,67 +1,110 @@
 package storage
 
 import (
-	"sort"
+	"math/bits"
 	"sync"
 )
 
-// BitSet is a simple bit set implementation for efficient set operations.
+// BitSet is a compact bit set implementation for efficient set operations.
 // Used for filtering VectorIDs during keyword and vector search.
+//
+// Values are stored as bits in a []uint64 word array, so memory grows with the
+// largest value rather than the number of values. VectorIDs are allocated
+// sequentially, which keeps the array dense.
 type BitSet struct {
-	bits map[uint64]struct{}
-	mu   sync.RWMutex
+	words []uint64
+	count int // Number of set bits
+	mu    sync.RWMutex
 }
 
 // NewBitSet creates a new empty BitSet.
 func NewBitSet() *BitSet {
-	return &BitSet{
-		bits: make(map[uint64]struct{}),
-	}
+	return &BitSet{}
+}
+
+// NewBitSetWithCapacity creates an empty BitSet pre-allocated to hold values
+// up to n without growing.
+func NewBitSetWithCapacity(n uint64) *BitSet {
+	return &BitSet{words: make([]uint64, 0, wordIndex(n)+1)}
 }
 
 // NewBitSetFromSlice creates a BitSet from a slice of uint64 values.
 func NewBitSetFromSlice(values []uint64) *BitSet {
 	bs := NewBitSet()
 	for _, v := range values {
-		bs.bits[v] = struct{}{}
+		bs.set(v)
 	}
 	return bs
 }
 
+// wordIndex returns the index of the word holding value.
+func wordIndex(value uint64) int {
+	return int(value >> 6)
+}
+
+// set adds value, growing the word array as needed. Caller must hold bs.mu.
+func (bs *BitSet) set(value uint64) {
+	w := wordIndex(value)
+	if w >= len(bs.words) {
+		if w < cap(bs.words) {
+			bs.words = bs.words[:w+1]
+		} else {
+			grown := make([]uint64, w+1, max(w+1, 2*cap(bs.words)))
+			copy(grown, bs.words)
+			bs.words = grown
+		}
+	}
+	mask := uint64(1) << (value & 63)
+	if bs.words[w]&mask == 0 {
+		bs.words[w] |= mask
+		bs.count++
+	}
+}
+
 // Set adds a value to the BitSet.
 func (bs *BitSet) Set(value uint64) {
 	bs.mu.Lock()
 	defer bs.mu.Unlock()
-	bs.bits[value] = struct{}{}
+	bs.set(value)
 }
 
 // Unset removes a value from the BitSet.
 func (bs *BitSet) Unset(value uint64) {
 	bs.mu.Lock()
 	defer bs.mu.Unlock()
-	delete(bs.bits, value)
+
+	w := wordIndex(value)
+	if w >= len(bs.words) {
+		return
+	}
+	mask := uint64(1) << (value & 63)
+	if bs.words[w]&mask != 0 {
+		bs.words[w] &^= mask
+		bs.count--
+	}
 }
 
 // Contains checks if a value is in the BitSet.
 func (bs *BitSet) Contains(value uint64) bool {
 	bs.mu.RLock()
 	defer bs.mu.RUnlock()
-	_, ok := bs.bits[value]
-	return ok
+
+	w := wordIndex(value)
+	return w < len(bs.words) && bs.words[w]&(uint64(1)<<(value&63)) != 0
 }
 
 // Count returns the number of values in the BitSet.
 func (bs *BitSet) Count() int {
 	bs.mu.RLock()
 	defer bs.mu.RUnlock()
-	return len(bs.bits)
+	return bs.count
 }
 
 // IsEmpty returns true if the BitSet is empty.
 func (bs *BitSet) IsEmpty() bool {
 	bs.mu.RLock()
 	defer bs.mu.RUnlock()
-	return len(bs.bits) == 0
+	return bs.count == 0
 }
 
 // ToSlice returns all values in the BitSet as a sorted slice.
@@ -69,16 +112,25 @@ func (bs *BitSet) ToSlice() []uint64 {
 	bs.mu.RLock()
 	defer bs.mu.RUnlock()
 
-	result := make([]uint64, 0, len(bs.bits))
-	for v := range bs.bits {
-		result = append(result, v)
+	result := make([]uint64, 0, bs.count)
+	for i, word := range bs.words {
+		for word != 0 {
+			result = append(result, uint64(i)<<6|uint64(bits.TrailingZeros64(word)))
+			word &= word - 1 // Clear lowest set bit
+		}
 	}
-	sort.Slice(result, func(i, j int) bool {
-		return result[i] < result[j]
-	})
 	return result
 }
 
+// popCount returns the number of set bits in words.
+func popCount(words []uint64) int {
+	n := 0
+	for _, w := range words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
 // Intersect returns a new BitSet containing only values present in both sets.
 func (bs *BitSet) Intersect(other *BitSet) *BitSet {
 	if bs == nil || other == nil {
@@ -90,19 +142,12 @@ func (bs *BitSet) Intersect(other *BitSet) *BitSet {
 	defer bs.mu.RUnlock()
 	defer other.mu.RUnlock()
 
-	result := NewBitSet()
-
-	// Iterate over the smaller set for efficiency
-	smaller, larger := bs.bits, other.bits
-	if len(bs.bits) > len(other.bits) {
-		smaller, larger = other.bits, bs.bits
-	}
-
-	for v := range smaller {
-		if _, ok := larger[v]; ok {
-			result.bits[v] = struct{}{}
-		}
+	n := min(len(bs.words), len(other.words))
+	result := &BitSet{words: make([]uint64, n)}
+	for i := 0; i < n; i++ {
+		result.words[i] = bs.words[i] & other.words[i]
 	}
+	result.count = popCount(result.words)
 
 	return result
 }
@@ -121,13 +166,16 @@ func (bs *BitSet) Union(other *BitSet) *BitSet {
 	defer bs.mu.RUnlock()
 	defer other.mu.RUnlock()
 
-	result := NewBitSet()
-	for v := range bs.bits {
-		result.bits[v] = struct{}{}
+	longer, shorter := bs.words, other.words
+	if len(shorter) > len(longer) {
+		longer, shorter = shorter, longer
 	}
-	for v := range other.bits {
-		result.bits[v] = struct{}{}
+	result := &BitSet{words: make([]uint64, len(longer))}
+	copy(result.words, longer)
+	for i, w := range shorter {
+		result.words[i] |= w
 	}
+	result.count = popCount(result.words)
 
 	return result
 }
@@ -146,12 +194,12 @@ func (bs *BitSet) Difference(other *BitSet) *BitSet {
 	defer bs.mu.RUnlock()
 	defer other.mu.RUnlock()
 
-	result := NewBitSet()
-	for v := range bs.bits {
-		if _, ok := other.bits[v]; !ok {
-			result.bits[v] = struct{}{}
-		}
+	result := &BitSet{words: make([]uint64, len(bs.words))}
+	copy(result.words, bs.words)
+	for i := 0; i < len(result.words) && i < len(other.words); i++ {
+		result.words[i] &^= other.words[i]
 	}
+	result.count = popCount(result.words)
 
 	return result
 }
@@ -161,9 +209,7 @@ func (bs *BitSet) Clone() *BitSet {
 	bs.mu.RLock()
 	defer bs.mu.RUnlock()
 
-	result := NewBitSet()
-	for v := range bs.bits {
-		result.bits[v] = struct{}{}
-	}
+	result := &BitSet{words: make([]uint64, len(bs.words)), count: bs.count}
+	copy(result.words, bs.words)
 	return result
 }
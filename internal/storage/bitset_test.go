@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestBitSet_RoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	want := make(map[uint64]bool)
+	bs := NewBitSet()
+	for i := 0; i < 5000; i++ {
+		v := uint64(rng.Intn(100000))
+		bs.Set(v)
+		want[v] = true
+	}
+	// Boundaries of a word
+	for _, v := range []uint64{0, 63, 64, 127, 128} {
+		bs.Set(v)
+		want[v] = true
+	}
+	for v := range want {
+		if rng.Intn(3) == 0 {
+			bs.Unset(v)
+			delete(want, v)
+		}
+	}
+	bs.Unset(1 << 30) // Beyond the array; no-op
+
+	if bs.Count() != len(want) {
+		t.Errorf("Count = %d, want %d", bs.Count(), len(want))
+	}
+	expected := make([]uint64, 0, len(want))
+	for v := range want {
+		expected = append(expected, v)
+		if !bs.Contains(v) {
+			t.Fatalf("Missing value %d", v)
+		}
+	}
+	slices.Sort(expected)
+	if got := bs.ToSlice(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("ToSlice mismatch: got %d values, want %d", len(got), len(expected))
+	}
+	if got := NewBitSetFromSlice(expected).ToSlice(); !reflect.DeepEqual(got, expected) {
+		t.Error("NewBitSetFromSlice round trip mismatch")
+	}
+	if bs.Contains(1<<40) || !NewBitSet().IsEmpty() {
+		t.Error("Unexpected membership")
+	}
+}
+
+func TestBitSet_SetOperations(t *testing.T) {
+	a := NewBitSetFromSlice([]uint64{1, 2, 3, 64, 200})
+	b := NewBitSetFromSlice([]uint64{2, 3, 4, 64})
+
+	tests := []struct {
+		name string
+		got  *BitSet
+		want []uint64
+	}{
+		{"Intersect", a.Intersect(b), []uint64{2, 3, 64}},
+		{"Union", a.Union(b), []uint64{1, 2, 3, 4, 64, 200}},
+		{"Difference", a.Difference(b), []uint64{1, 200}},
+		{"DifferenceReverse", b.Difference(a), []uint64{4}},
+		{"Clone", a.Clone(), []uint64{1, 2, 3, 64, 200}},
+	}
+	for _, tt := range tests {
+		if got := tt.got.ToSlice(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.got.Count() != len(tt.want) {
+			t.Errorf("%s Count = %d, want %d", tt.name, tt.got.Count(), len(tt.want))
+		}
+	}
+	if !a.Intersect(nil).IsEmpty() {
+		t.Error("Intersect with nil should be empty")
+	}
+}
+
+func TestBitSet_IntersectLargeSetsAllocation(t *testing.T) {
+	const n = 1_000_000
+	a := NewBitSetWithCapacity(n)
+	b := NewBitSetWithCapacity(n)
+	for v := uint64(0); v < n; v++ {
+		if v%2 == 0 {
+			a.Set(v)
+		}
+		if v%3 == 0 {
+			b.Set(v)
+		}
+	}
+
+	var result *BitSet
+	allocs := testing.AllocsPerRun(5, func() {
+		result = a.Intersect(b)
+	})
+	// One BitSet and one word array, independent of the number of values
+	if allocs > 2 {
+		t.Errorf("Intersect made %.0f allocations, want <= 2", allocs)
+	}
+	if want := (n + 5) / 6; result.Count() != want {
+		t.Errorf("Intersect Count = %d, want %d", result.Count(), want)
+	}
+}
+
+func BenchmarkBitSet_Intersect(b *testing.B) {
+	const n = 1_000_000
+	x, y := NewBitSetWithCapacity(n), NewBitSetWithCapacity(n)
+	for v := uint64(0); v < n; v++ {
+		if v%2 == 0 {
+			x.Set(v)
+		}
+		if v%3 == 0 {
+			y.Set(v)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x.Intersect(y)
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+// bkTreeRebuildMin is the number of removed words below which a BKTree never
+// rebuilds itself.
+const bkTreeRebuildMin = 64
+
+// BKTree is a Burkhard-Keller tree over words under Levenshtein distance. A
+// search for words within d edits of a query only visits the subtrees whose
+// edge distance is within d of the query's distance to their parent, instead
+// of every word. The zero value is an empty tree.
+//
+// Removed words are only marked as such, since children are keyed by their
+// distance to the removed word. The tree is rebuilt from the remaining words
+// once removed words outnumber them.
+type BKTree struct {
+	root *bkNode
+	size int // Words in the tree, not counting removed ones
+	dead int // Removed words still holding a node
+}
+
+// bkNode is a word and its children keyed by their distance to it.
+type bkNode struct {
+	word     string
+	children map[int]*bkNode
+	removed  bool
+}
+
+// Len returns the number of words in the tree.
+func (t *BKTree) Len() int {
+	return t.size
+}
+
+// Insert adds word to the tree. Adding a word already present does nothing.
+func (t *BKTree) Insert(word string) {
+	if t.root == nil {
+		t.root = &bkNode{word: word}
+		t.size++
+		return
+	}
+	node := t.root
+	for {
+		d := levenshteinDistance(word, node.word)
+		if d == 0 {
+			if node.removed {
+				node.removed = false
+				t.size++
+				t.dead--
+			}
+			return
+		}
+		child, ok := node.children[d]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[int]*bkNode)
+			}
+			node.children[d] = &bkNode{word: word}
+			t.size++
+			return
+		}
+		node = child
+	}
+}
+
+// Remove deletes word from the tree and reports whether it was present.
+func (t *BKTree) Remove(word string) bool {
+	node := t.root
+	for node != nil {
+		d := levenshteinDistance(word, node.word)
+		if d == 0 {
+			if node.removed {
+				return false
+			}
+			node.removed = true
+			t.size--
+			t.dead++
+			if t.dead >= bkTreeRebuildMin && t.dead > t.size {
+				t.rebuild()
+			}
+			return true
+		}
+		node = node.children[d]
+	}
+	return false
+}
+
+// Search returns the words within maxDist edits of query, in no particular order.
+func (t *BKTree) Search(query string, maxDist int) []string {
+	if t.root == nil {
+		return nil
+	}
+	var matches []string
+	pending := []*bkNode{t.root}
+	for len(pending) > 0 {
+		node := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		d := levenshteinDistance(query, node.word)
+		if d <= maxDist && !node.removed {
+			matches = append(matches, node.word)
+		}
+		// By the triangle inequality only children at distance d±maxDist can match
+		for edge, child := range node.children {
+			if edge >= d-maxDist && edge <= d+maxDist {
+				pending = append(pending, child)
+			}
+		}
+	}
+	return matches
+}
+
+// rebuild recreates the tree from the words that were not removed.
+func (t *BKTree) rebuild() {
+	var words []string
+	pending := []*bkNode{t.root}
+	for len(pending) > 0 {
+		node := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if !node.removed {
+			words = append(words, node.word)
+		}
+		for _, child := range node.children {
+			pending = append(pending, child)
+		}
+	}
+
+	*t = BKTree{}
+	for _, word := range words {
+		t.Insert(word)
+	}
+}
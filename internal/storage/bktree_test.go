@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// randomWords returns n distinct lowercase words of 4 to 10 letters drawn
+// from a small alphabet, so many words are within a few edits of each other.
+func randomWords(rng *rand.Rand, n int) []string {
+	seen := make(map[string]bool, n)
+	words := make([]string, 0, n)
+	for len(words) < n {
+		b := make([]byte, 4+rng.Intn(7))
+		for i := range b {
+			b[i] = "abcdefghijklmnop"[rng.Intn(16)]
+		}
+		if w := string(b); !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// linearLevenshtein returns the words within maxDist edits of query by
+// comparing against every word.
+func linearLevenshtein(words []string, query string, maxDist int) []string {
+	var matches []string
+	for _, w := range words {
+		if levenshteinDistance(query, w) <= maxDist {
+			matches = append(matches, w)
+		}
+	}
+	return matches
+}
+
+func TestBKTree_SearchMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(40))
+	words := randomWords(rng, 2000)
+
+	var tree BKTree
+	for _, w := range words {
+		tree.Insert(w)
+	}
+	tree.Insert(words[0]) // Duplicates are ignored
+	if tree.Len() != len(words) {
+		t.Fatalf("Expected %d words, got %d", len(words), tree.Len())
+	}
+
+	// Remove enough words to trigger a rebuild, then re-add one
+	for _, w := range words[:1500] {
+		if !tree.Remove(w) {
+			t.Fatalf("Remove(%q) reported the word missing", w)
+		}
+	}
+	if tree.Remove(words[0]) {
+		t.Error("Expected removing a removed word to report false")
+	}
+	tree.Insert(words[0])
+	live := append([]string{words[0]}, words[1500:]...)
+	if tree.Len() != len(live) {
+		t.Fatalf("Expected %d words after removals, got %d", len(live), tree.Len())
+	}
+
+	for _, query := range append(randomWords(rng, 50), words[0], words[10], "") {
+		for maxDist := 0; maxDist <= 3; maxDist++ {
+			got := tree.Search(query, maxDist)
+			want := linearLevenshtein(live, query, maxDist)
+			slices.Sort(got)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Fatalf("Search(%q, %d) = %v, want %v", query, maxDist, got, want)
+			}
+		}
+	}
+
+	var empty BKTree
+	if got := empty.Search("word", 2); len(got) != 0 {
+		t.Errorf("Expected no matches in an empty tree, got %v", got)
+	}
+}
+
+// BenchmarkLevenshteinSearch compares a BK-tree lookup with a linear scan over
+// a vocabulary of 100,000 words.
+func BenchmarkLevenshteinSearch(b *testing.B) {
+	rng := rand.New(rand.NewSource(41))
+	words := randomWords(rng, 100000)
+	var tree BKTree
+	for _, w := range words {
+		tree.Insert(w)
+	}
+	queries := randomWords(rng, 64)
+
+	for _, maxDist := range []int{1, 2} {
+		b.Run(fmt.Sprintf("BKTree/d=%d", maxDist), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tree.Search(queries[i%len(queries)], maxDist)
+			}
+		})
+		b.Run(fmt.Sprintf("LinearScan/d=%d", maxDist), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				linearLevenshtein(words, queries[i%len(queries)], maxDist)
+			}
+		})
+	}
+}
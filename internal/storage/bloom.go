@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"waddlemap/internal/logger"
+)
+
+// BloomFilter is a Bloom filter over strings, sized for a number of
+// insertions at a target false-positive rate. Add and MayContain may be
+// called concurrently without locks.
+type BloomFilter struct {
+	words    []uint64
+	hashes   uint32
+	capacity uint64
+	added    atomic.Uint64
+}
+
+// NewBloomFilter creates a filter that holds capacity strings with a false
+// positive rate of about fpRate.
+func NewBloomFilter(capacity uint64, fpRate float64) *BloomFilter {
+	capacity = max(capacity, 1)
+	m := math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(capacity) * math.Ln2)
+	return &BloomFilter{
+		words:    make([]uint64, (uint64(m)+63)/64),
+		hashes:   uint32(max(k, 1)),
+		capacity: capacity,
+	}
+}
+
+// locations calls fn with the k bit positions of s, derived from one 64-bit
+// FNV-1a hash by double hashing.
+func (bf *BloomFilter) locations(s string, fn func(word int, mask uint64) bool) {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	sum := h.Sum64()
+	h1, h2 := sum, bits.RotateLeft64(sum, 32)|1
+	nbits := uint64(len(bf.words)) * 64
+	for i := range uint64(bf.hashes) {
+		pos, _ := bits.Mul64(h1+i*h2, nbits) // Maps the hash onto [0, nbits)
+		if !fn(int(pos/64), 1<<(pos%64)) {
+			return
+		}
+	}
+}
+
+// Add inserts s into the filter.
+func (bf *BloomFilter) Add(s string) {
+	bf.locations(s, func(word int, mask uint64) bool {
+		atomic.OrUint64(&bf.words[word], mask)
+		return true
+	})
+	bf.added.Add(1)
+}
+
+// MayContain reports whether s may have been added. False is definitive.
+func (bf *BloomFilter) MayContain(s string) bool {
+	found := true
+	bf.locations(s, func(word int, mask uint64) bool {
+		found = atomic.LoadUint64(&bf.words[word])&mask != 0
+		return found
+	})
+	return found
+}
+
+// Full reports whether the filter holds as many strings as it was sized for,
+// beyond which its false-positive rate climbs.
+func (bf *BloomFilter) Full() bool {
+	return bf.added.Load() >= bf.capacity
+}
+
+// keys.bloom format:
+// [Magic(4)][DocNextID(8)][Capacity(8)][Added(8)][Hashes(4)][Words(8)]
+// followed by Words 64-bit words. DocNextID is the forward index's next vector
+// ID when the filter was saved; a filter saved with another forward index
+// state may miss keys and is rebuilt.
+const keyBloomMagic = "KBF1"
+
+const (
+	// keyBloomFPRate is the false-positive rate of collection key filters.
+	keyBloomFPRate = 0.01
+
+	// minKeyBloomCapacity is the capacity of the key filter of an empty
+	// collection.
+	minKeyBloomCapacity = 1024
+)
+
+// rebuildKeyBloom replaces the key filter with one sized for twice the
+// current keys, holding them all. Caller must hold memMu or mu exclusively.
+func (c *Collection) rebuildKeyBloom() {
+	bf := NewBloomFilter(max(2*uint64(len(c.KeyLengths)), minKeyBloomCapacity), keyBloomFPRate)
+	for key := range c.KeyLengths {
+		bf.Add(key)
+	}
+	c.keyBloom.Store(bf)
+}
+
+// addKeyBloom adds a new key to the key filter, growing the filter when it
+// is full. Caller must hold memMu or mu exclusively.
+func (c *Collection) addKeyBloom(key string) {
+	if c.keyBloom.Load().Full() {
+		c.rebuildKeyBloom() // Also drops keys deleted since the last rebuild
+	}
+	c.keyBloom.Load().Add(key)
+}
+
+// saveKeyBloom writes the key filter next to meta.json. Caller must hold mu
+// exclusively, after saving DocMap.
+func (c *Collection) saveKeyBloom() error {
+	bf := c.keyBloom.Load()
+	file, err := os.Create(filepath.Join(c.basePath, "keys.bloom"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	header := make([]byte, 40)
+	copy(header[0:4], keyBloomMagic)
+	binary.BigEndian.PutUint64(header[4:12], c.DocMap.PeekNextVectorID())
+	binary.BigEndian.PutUint64(header[12:20], bf.capacity)
+	binary.BigEndian.PutUint64(header[20:28], bf.added.Load())
+	binary.BigEndian.PutUint32(header[28:32], bf.hashes)
+	binary.BigEndian.PutUint64(header[32:40], uint64(len(bf.words)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	word := make([]byte, 8)
+	for i := range bf.words {
+		binary.BigEndian.PutUint64(word, atomic.LoadUint64(&bf.words[i]))
+		if _, err := w.Write(word); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// loadKeyBloom loads the key filter saved with the collection, or rebuilds it
+// from the in-memory key index if the file is missing, damaged or older than
+// the forward index.
+func (c *Collection) loadKeyBloom() {
+	bf, err := c.readKeyBloom()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.InfoAttrs("rebuilding key filter", "collection", c.Config.Name, "reason", err)
+		}
+		c.rebuildKeyBloom()
+		return
+	}
+	c.keyBloom.Store(bf)
+}
+
+func (c *Collection) readKeyBloom() (*BloomFilter, error) {
+	file, err := os.Open(filepath.Join(c.basePath, "keys.bloom"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header := make([]byte, 40)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read key filter header: %w", err)
+	}
+	if string(header[0:4]) != keyBloomMagic {
+		return nil, errors.New("invalid key filter magic")
+	}
+	if next := binary.BigEndian.Uint64(header[4:12]); next != c.DocMap.PeekNextVectorID() {
+		return nil, fmt.Errorf("key filter saved at vector ID %d, forward index at %d", next, c.DocMap.PeekNextVectorID())
+	}
+	bf := &BloomFilter{
+		capacity: binary.BigEndian.Uint64(header[12:20]),
+		hashes:   binary.BigEndian.Uint32(header[28:32]),
+	}
+	bf.added.Store(binary.BigEndian.Uint64(header[20:28]))
+	words := binary.BigEndian.Uint64(header[32:40])
+	if words == 0 || bf.hashes == 0 {
+		return nil, errors.New("empty key filter")
+	}
+	if info, err := file.Stat(); err != nil || uint64(info.Size()) != uint64(len(header))+words*8 {
+		return nil, errors.New("key filter size does not match its header")
+	}
+
+	bf.words = make([]uint64, words)
+	word := make([]byte, 8)
+	for i := range bf.words {
+		if _, err := io.ReadFull(r, word); err != nil {
+			return nil, fmt.Errorf("failed to read key filter: %w", err)
+		}
+		bf.words[i] = binary.BigEndian.Uint64(word)
+	}
+	return bf, nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"waddlemap/internal/types"
+)
+
+// DefaultCoalescingWindow is how long a WriteCoalescer buffers appends
+// before writing them, unless configured otherwise.
+const DefaultCoalescingWindow = 5 * time.Millisecond
+
+// coalescerMaxBatch is the number of buffered appends that are written
+// without waiting for the rest of the window.
+const coalescerMaxBatch = 1024
+
+// coalescedFlushFunc writes a batch of appends and returns the result of
+// each: the block index assigned to it, or the error that kept it from being
+// written.
+type coalescedFlushFunc func(keys []string, blocks []*types.BlockData) []coalescedResult
+
+// WriteCoalescer buffers the appends to one collection that arrive within a
+// short window and writes them as a single batch, so concurrent appenders
+// take the collection lock once per window instead of once each. Append
+// blocks until the batch holding its block has been written.
+type WriteCoalescer struct {
+	window time.Duration
+	flush  coalescedFlushFunc
+
+	mu      sync.Mutex
+	pending []pendingAppend
+	timer   *time.Timer // Running while pending is not empty
+	closed  bool
+
+	flushMu sync.Mutex // Serializes batches so they are applied in WAL order
+}
+
+// pendingAppend is a buffered append waiting for its batch to be written.
+type pendingAppend struct {
+	key   string
+	block *types.BlockData
+	done  chan coalescedResult
+}
+
+type coalescedResult struct {
+	index uint32
+	err   error
+}
+
+// NewWriteCoalescer creates a coalescer that hands batches to flush. A window
+// of zero or less uses DefaultCoalescingWindow.
+func NewWriteCoalescer(window time.Duration, flush coalescedFlushFunc) *WriteCoalescer {
+	if window <= 0 {
+		window = DefaultCoalescingWindow
+	}
+	return &WriteCoalescer{window: window, flush: flush}
+}
+
+// Append buffers block for key and returns its block index once the batch has
+// been written. It returns ErrClosing after Close.
+func (wc *WriteCoalescer) Append(key string, block *types.BlockData) (uint32, error) {
+	done := make(chan coalescedResult, 1)
+
+	wc.mu.Lock()
+	if wc.closed {
+		wc.mu.Unlock()
+		return 0, ErrClosing
+	}
+	wc.pending = append(wc.pending, pendingAppend{key: key, block: block, done: done})
+	full := len(wc.pending) >= coalescerMaxBatch
+	if len(wc.pending) == 1 && !full {
+		wc.timer = time.AfterFunc(wc.window, wc.flushPending)
+	}
+	wc.mu.Unlock()
+
+	if full {
+		wc.flushPending()
+	}
+	res := <-done
+	return res.index, res.err
+}
+
+// Close writes the buffered appends and waits for them. Later appends fail
+// with ErrClosing.
+func (wc *WriteCoalescer) Close() {
+	wc.mu.Lock()
+	wc.closed = true
+	wc.mu.Unlock()
+	wc.flushPending()
+}
+
+// flushPending writes the appends buffered so far, if any.
+func (wc *WriteCoalescer) flushPending() {
+	wc.flushMu.Lock()
+	defer wc.flushMu.Unlock()
+
+	wc.mu.Lock()
+	batch := wc.pending
+	wc.pending = nil
+	if wc.timer != nil {
+		wc.timer.Stop()
+		wc.timer = nil
+	}
+	wc.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	keys := make([]string, len(batch))
+	blocks := make([]*types.BlockData, len(batch))
+	for i, p := range batch {
+		keys[i], blocks[i] = p.key, p.block
+	}
+	results := wc.flush(keys, blocks)
+	for i, p := range batch {
+		p.done <- results[i]
+	}
+}
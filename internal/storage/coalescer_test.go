@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"waddlemap/internal/types"
+)
+
+func TestWriteCoalescer_PersistsBufferedAppendsOnClose(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &types.DBSchemaConfig{
+		DataPath:          tmpDir,
+		SyncMode:          "normal",
+		FlushInterval:     -1,
+		CoalescingEnabled: true,
+		CoalescingWindow:  time.Hour, // Only Close ends the window
+	}
+	vm, err := NewVectorManager(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	if err := vm.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+
+	const n = 50
+	indices := make([]uint32, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			block := &types.BlockData{Primary: fmt.Sprintf("block-%d", i), Vector: []float32{float32(i), 1}}
+			indices[i], errs[i] = vm.AppendBlock("docs", "hot", block)
+		}()
+	}
+
+	// Wait until every append is buffered, then shut down inside the window
+	wc, err := vm.coalescer("docs", "hot", &types.BlockData{Vector: []float32{0, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		wc.mu.Lock()
+		buffered := len(wc.pending)
+		wc.mu.Unlock()
+		if buffered == n {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Only %d of %d appends were buffered", buffered, n)
+		}
+	}
+	if err := vm.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Append %d failed: %v", i, err)
+		}
+	}
+	sorted := slices.Clone(indices)
+	slices.Sort(sorted)
+	for i, idx := range sorted {
+		if idx != uint32(i) {
+			t.Fatalf("Block indices %v are not 0..%d", sorted, n-1)
+		}
+	}
+
+	cfg.CoalescingEnabled = false
+	vm, err = NewVectorManager(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen VM: %v", err)
+	}
+	defer vm.Close()
+	if length, err := vm.GetKeyLength("docs", "hot"); err != nil || length != n {
+		t.Fatalf("Key length after reopen = %d, %v; want %d", length, err, n)
+	}
+	for i, idx := range indices {
+		block, err := vm.GetBlock("docs", "hot", idx)
+		if err != nil {
+			t.Fatalf("GetBlock(%d) failed: %v", idx, err)
+		}
+		if want := fmt.Sprintf("block-%d", i); block.Primary != want {
+			t.Errorf("Block %d = %q, want %q", idx, block.Primary, want)
+		}
+	}
+}
+
+func TestWriteCoalescer_InvalidBlockFailsAlone(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal", CoalescingEnabled: true})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var goodErr, badErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, goodErr = vm.AppendBlock("docs", "k", &types.BlockData{Vector: []float32{1, 2}})
+	}()
+	go func() {
+		defer wg.Done()
+		_, badErr = vm.AppendBlock("docs", "k", &types.BlockData{Vector: []float32{1, 2, 3}})
+	}()
+	wg.Wait()
+
+	if goodErr != nil {
+		t.Errorf("Valid append failed: %v", goodErr)
+	}
+	if badErr == nil {
+		t.Error("Expected the append with the wrong dimensions to fail")
+	}
+	if _, err := vm.AppendBlock("missing", "k", &types.BlockData{Vector: []float32{1, 2}}); err == nil {
+		t.Error("Expected an append to a missing collection to fail")
+	}
+
+	// A block whose entry cannot be encoded is rejected before it is logged
+	lsn := vm.wal.LSN()
+	long := strings.Repeat("k", MaxKeyLength+1)
+	if _, err := vm.AppendBlock("docs", long, &types.BlockData{Vector: []float32{1, 2}}); err == nil {
+		t.Error("Expected the append with an oversized key to fail")
+	}
+	if ok, _ := vm.ContainsKey("docs", long); ok {
+		t.Error("Expected the oversized key not to be indexed")
+	}
+	if got := vm.wal.LSN(); got != lsn {
+		t.Errorf("Expected the rejected append not to be logged, LSN %d -> %d", lsn, got)
+	}
+}
+
+func TestWriteCoalescer_DeliversPerBlockResults(t *testing.T) {
+	errBad := errors.New("bad block")
+	wc := NewWriteCoalescer(time.Hour, func(keys []string, blocks []*types.BlockData) []coalescedResult {
+		results := make([]coalescedResult, len(keys))
+		for i, key := range keys {
+			if key == "bad" {
+				results[i].err = errBad
+			} else {
+				results[i].index = 7
+			}
+		}
+		return results
+	})
+
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	for _, key := range []string{"good", "bad"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			index, err := wc.Append(key, &types.BlockData{})
+			if err == nil && index != 7 {
+				err = fmt.Errorf("unexpected index %d", index)
+			}
+			mu.Lock()
+			errs[key] = err
+			mu.Unlock()
+		}()
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		wc.mu.Lock()
+		buffered := len(wc.pending)
+		wc.mu.Unlock()
+		if buffered == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Only %d of 2 appends were buffered", buffered)
+		}
+	}
+	wc.Close()
+	wg.Wait()
+
+	if errs["good"] != nil {
+		t.Errorf("Expected the valid block to be appended, got %v", errs["good"])
+	}
+	if !errors.Is(errs["bad"], errBad) {
+		t.Errorf("Expected the invalid block to fail with its own error, got %v", errs["bad"])
+	}
+}
+
+// BenchmarkAppendBlockSameKey measures appends from 100 goroutines to one key.
+func BenchmarkAppendBlockSameKey(b *testing.B) {
+	for _, coalescing := range []bool{false, true} {
+		b.Run(fmt.Sprintf("coalescing=%v", coalescing), func(b *testing.B) {
+			vm, err := NewVectorManager(&types.DBSchemaConfig{
+				DataPath:            b.TempDir(),
+				SyncMode:            "normal",
+				FlushInterval:       -1,
+				ExpirySweepInterval: -1,
+				CoalescingEnabled:   coalescing,
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer vm.Close()
+			if err := vm.CreateCollection("bench", 32, types.MetricL2); err != nil {
+				b.Fatal(err)
+			}
+
+			const workers = 100
+			jobs := make(chan int)
+			var wg sync.WaitGroup
+			for range workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					vec := make([]float32, 32)
+					for i := range jobs {
+						vec[i%32] = float32(i)
+						if _, err := vm.AppendBlock("bench", "hot", &types.BlockData{Vector: slices.Clone(vec)}); err != nil {
+							b.Error(err)
+						}
+					}
+				}()
+			}
+			b.ResetTimer()
+			for i := range b.N {
+				jobs <- i
+			}
+			close(jobs)
+			wg.Wait()
+		})
+	}
+}
@@ -1,33 +1,107 @@
 package storage
 
 import (
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"waddlemap/internal/logger"
+	"waddlemap/internal/metrics"
 	"waddlemap/internal/types"
 )
 
 // Collection represents a vector collection with all its indexes.
 type Collection struct {
-	Config       types.CollectionConfig
+	Config types.CollectionConfig
+
+	// Index is the primary vector index. It is HNSWIndex unless
+	// Config.IndexType is "flat" or vectors are PQ-compressed, in which case
+	// HNSWIndex is nil.
+	Index        VectorIndex
 	HNSWIndex    *HNSWWrapper
 	KeywordIndex *InvertedIndex
-	DocMap       *ForwardIndex
-	basePath     string
-	mu           sync.RWMutex
+
+	// SecondaryHNSW is an optional second graph with different parameters
+	// (see CollectionConfig.SecondaryHNSWOptions). Nil when disabled.
+	SecondaryHNSW *HNSWWrapper
+	DocMap        *ForwardIndex
+	basePath      string
+
+	// mu is held exclusively by operations that need a consistent view of the
+	// whole collection (DeleteKey, Save, ...). AppendBlock holds it shared and
+	// serializes writers per key with keyLocks instead.
+	mu       sync.RWMutex
+	keyLocks [keyLockShards]sync.Mutex
+	memMu    sync.RWMutex // Guards KeyLengths, KeyIndex and keyList while mu is held shared
+
+	// closing rejects new operations once Close has started; drainWg tracks
+	// operations already in flight so Close can wait for them.
+	closing atomic.Bool
+	drainMu sync.Mutex // Orders drainWg.Add against drainWg.Wait
+	drainWg sync.WaitGroup
 
 	// In-Memory Indexes (Rebuilt on Load)
 	KeyLengths map[string]uint32
 	KeyIndex   map[string][]uint64 // Key -> List of VectorIDs
+	keyList    []string            // Keys of KeyLengths in sorted order, for prefix scans
+
+	// keyBloom holds every key of KeyLengths, and possibly deleted ones, so
+	// ContainsKey can reject absent keys without taking memMu. Saved to
+	// keys.bloom.
+	keyBloom atomic.Pointer[BloomFilter]
+
+	vectorCache *VectorCache // Caches GetVectorByID for HNSW collections; nil when unset
+
+	// wal receives the forward and keyword index changes of the collection
+	// before they are applied; nil when they are not logged.
+	wal *WAL
+
+	adaptiveEf adaptiveEf // EfSearch learned by AdaptiveSearch
+}
+
+// ErrClosing is returned by operations on a collection that is being closed.
+var ErrClosing = errors.New("collection is closing")
+
+// enter registers an in-flight operation. Callers must call c.drainWg.Done()
+// when enter returns nil.
+func (c *Collection) enter() error {
+	c.drainMu.Lock()
+	defer c.drainMu.Unlock()
+	if c.closing.Load() {
+		return ErrClosing
+	}
+	c.drainWg.Add(1)
+	return nil
+}
+
+// keyLockShards is the number of per-key lock shards in a collection.
+const keyLockShards = 256
+
+// keyLock returns the shard mutex guarding appends to key.
+func (c *Collection) keyLock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &c.keyLocks[h.Sum32()%keyLockShards]
 }
 
 // CollectionManager manages all vector collections.
 type CollectionManager struct {
 	collections map[string]*Collection
 	basePath    string // Base path for indexes directory
+	vectorCache *VectorCache
+	wal         *WAL // Given to every collection, see SetWAL
 	mu          sync.RWMutex
 }
 
@@ -41,6 +115,7 @@ func NewCollectionManager(basePath string) (*CollectionManager, error) {
 	cm := &CollectionManager{
 		collections: make(map[string]*Collection),
 		basePath:    indexesPath,
+		vectorCache: NewVectorCache(DefaultVectorCacheSize),
 	}
 
 	// Load existing collections
@@ -52,8 +127,16 @@ func NewCollectionManager(basePath string) (*CollectionManager, error) {
 }
 
 // loadExistingCollections loads all existing collections from disk.
+// Directories without metadata are tenant directories, holding the
+// collections of one tenant.
 func (cm *CollectionManager) loadExistingCollections() error {
-	entries, err := os.ReadDir(cm.basePath)
+	return cm.loadCollectionsIn(cm.basePath, true)
+}
+
+// loadCollectionsIn loads the collections in the subdirectories of dir, and
+// with tenants set those of the tenant directories in it.
+func (cm *CollectionManager) loadCollectionsIn(dir string, tenants bool) error {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -63,8 +146,14 @@ func (cm *CollectionManager) loadExistingCollections() error {
 
 	for _, entry := range entries {
 		if entry.IsDir() {
-			collPath := filepath.Join(cm.basePath, entry.Name())
+			collPath := filepath.Join(dir, entry.Name())
 			meta, err := LoadCollectionMeta(collPath)
+			if os.IsNotExist(err) && tenants {
+				if err := cm.loadCollectionsIn(collPath, false); err != nil {
+					return err
+				}
+				continue
+			}
 			if err != nil {
 				// Skip invalid collection directories
 				continue
@@ -85,24 +174,68 @@ func (cm *CollectionManager) loadExistingCollections() error {
 func (cm *CollectionManager) loadCollection(meta *CollectionMeta) (*Collection, error) {
 	collPath := filepath.Join(cm.basePath, meta.Name)
 
-	// Create HNSW wrapper
-	hnswPath := filepath.Join(collPath, "vectors.hnsw")
-	hnsw, err := NewHNSWWrapper(meta.Dimensions, meta.Metric, hnswPath)
+	// Upgrade metadata written by older versions
+	if meta.Version > CurrentMetaVersion {
+		return nil, fmt.Errorf("meta version %d is newer than supported %d", meta.Version, CurrentMetaVersion)
+	}
+	if meta.Version < CurrentMetaVersion {
+		migrateMeta(meta)
+		if err := SaveCollectionMeta(collPath, meta); err != nil {
+			return nil, fmt.Errorf("failed to save migrated metadata: %w", err)
+		}
+	}
+
+	config := types.CollectionConfig{
+		Name:                 meta.Name,
+		Dimensions:           meta.Dimensions,
+		Metric:               meta.Metric,
+		IndexType:            meta.IndexType,
+		IndexCompression:     meta.IndexCompression,
+		PQSubspaces:          meta.PQSubspaces,
+		Float16Vectors:       meta.Float16Vectors,
+		MmapVectors:          meta.MmapVectors,
+		AutoNormalize:        meta.AutoNormalize,
+		NGramSizes:           meta.NGramSizes,
+		TokenizationMode:     meta.TokenizationMode,
+		HNSWOptions:          meta.HNSW,
+		SecondaryHNSWOptions: meta.SecondaryHNSW,
+	}
+	if config.IndexType == "" {
+		config.IndexType = types.IndexTypeHNSW
+	}
+
+	// Create and load the primary index
+	index, hnsw, err := newPrimaryIndex(collPath, &config)
 	if err != nil {
 		return nil, err
 	}
-
-	// Load HNSW index using mmap
-	if err := hnsw.Load(); err != nil {
-		hnsw.Close()
+	if err := index.Load(); err != nil {
+		index.Close()
 		return nil, err
 	}
 
+	// Load secondary HNSW index, if configured
+	var secondary *HNSWWrapper
+	if meta.SecondaryHNSW != nil {
+		secondary, err = newSecondaryHNSW(collPath, &config)
+		if err != nil {
+			index.Close()
+			return nil, err
+		}
+		if err := secondary.Load(); err != nil {
+			index.Close()
+			secondary.Close()
+			return nil, err
+		}
+	}
+
 	// Create keyword index
-	kwPath := filepath.Join(collPath, "keywords.inv")
-	kwIndex := NewInvertedIndex(kwPath)
+	kwIndex := newKeywordIndex(collPath, &config)
 	if err := kwIndex.Load(); err != nil {
-		hnsw.Close()
+		index.Close()
+		if secondary != nil {
+			secondary.Close()
+		}
 		return nil, err
 	}
 
@@ -110,48 +243,122 @@ func (cm *CollectionManager) loadCollection(meta *CollectionMeta) (*Collection,
 	docMapPath := filepath.Join(collPath, "doc_map.bin")
 	docMap := NewForwardIndex(docMapPath)
 	if err := docMap.Load(); err != nil {
-		hnsw.Close()
+		index.Close()
+		if secondary != nil {
+			secondary.Close()
+		}
 		return nil, err
 	}
 
 	coll := &Collection{
-		Config: types.CollectionConfig{
-			Name:       meta.Name,
-			Dimensions: meta.Dimensions,
-			Metric:     meta.Metric,
-		},
-		HNSWIndex:    hnsw,
-		KeywordIndex: kwIndex,
-		DocMap:       docMap,
-		basePath:     collPath,
-		KeyLengths:   make(map[string]uint32),
-		KeyIndex:     make(map[string][]uint64),
+		Config:        config,
+		Index:         index,
+		HNSWIndex:     hnsw,
+		SecondaryHNSW: secondary,
+		KeywordIndex:  kwIndex,
+		DocMap:        docMap,
+		basePath:      collPath,
+		KeyLengths:    make(map[string]uint32),
+		KeyIndex:      make(map[string][]uint64),
+		wal:           cm.wal,
 	}
 
+	coll.adaptiveEf.learned = meta.LearnedEfSearch
+	cm.useVectorCache(coll)
+
 	// Rebuild In-Memory Indexes
 	coll.rebuildMemoryIndexes()
+	coll.loadKeyBloom()
 
 	return coll, nil
 }
 
+// newPrimaryIndex creates the primary vector index stored under collPath.
+// The returned *HNSWWrapper is nil for flat and PQ collections.
+func newPrimaryIndex(collPath string, cfg *types.CollectionConfig) (VectorIndex, *HNSWWrapper, error) {
+	if cfg.IndexCompression == types.CompressionPQ {
+		pq, err := NewPQIndex(cfg.Dimensions, cfg.Metric, cfg.PQSubspaces, filepath.Join(collPath, "vectors.pq"))
+		if err != nil {
+			return nil, nil, err
+		}
+		return pq, nil, nil
+	}
+	if cfg.IndexType == types.IndexTypeFlat {
+		return NewFlatIndex(cfg.Dimensions, cfg.Metric, filepath.Join(collPath, "vectors.flat")), nil, nil
+	}
+	hnsw, err := NewHNSWWrapper(cfg.Dimensions, cfg.Metric, filepath.Join(collPath, "vectors.hnsw"))
+	if err != nil {
+		return nil, nil, err
+	}
+	hnsw.ApplyOptions(cfg.HNSWOptions)
+	hnsw.Float16Vectors = cfg.Float16Vectors
+	hnsw.MmapVectors = cfg.MmapVectors
+	hnsw.Normalized = cfg.AutoNormalize
+	return hnsw, hnsw, nil
+}
+
+// newSecondaryHNSW creates the secondary HNSW wrapper stored in vectors_secondary.hnsw.
+func newSecondaryHNSW(collPath string, cfg *types.CollectionConfig) (*HNSWWrapper, error) {
+	hnsw, err := NewHNSWWrapper(cfg.Dimensions, cfg.Metric, filepath.Join(collPath, "vectors_secondary.hnsw"))
+	if err != nil {
+		return nil, err
+	}
+	hnsw.ApplyOptions(cfg.SecondaryHNSWOptions)
+	hnsw.Float16Vectors = cfg.Float16Vectors
+	hnsw.MmapVectors = cfg.MmapVectors
+	hnsw.Normalized = cfg.AutoNormalize
+	return hnsw, nil
+}
+
+// newKeywordIndex creates the keyword index stored in keywords.inv.
+func newKeywordIndex(collPath string, cfg *types.CollectionConfig) *InvertedIndex {
+	kwIndex := NewInvertedIndex(filepath.Join(collPath, "keywords.inv"))
+	kwIndex.NGramSizes = slices.Clone(cfg.NGramSizes)
+	kwIndex.TokenizationMode = cfg.TokenizationMode
+	return kwIndex
+}
+
 // CreateCollection creates a new vector collection.
 func (cm *CollectionManager) CreateCollection(name string, dimensions uint32, metric types.DistanceMetric) error {
+	return cm.CreateCollectionWithConfig(types.CollectionConfig{
+		Name:       name,
+		Dimensions: dimensions,
+		Metric:     metric,
+	})
+}
+
+// CreateCollectionWithConfig creates a new vector collection from a full configuration.
+func (cm *CollectionManager) CreateCollectionWithConfig(cfg types.CollectionConfig) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
+	name, dimensions, metric := cfg.Name, cfg.Dimensions, cfg.Metric
+
 	// Check if collection already exists
 	if _, exists := cm.collections[name]; exists {
 		return fmt.Errorf("collection %q already exists", name)
 	}
 
-	config := &types.CollectionConfig{
-		Name:       name,
-		Dimensions: dimensions,
-		Metric:     metric,
-	}
-	if err := ValidateCollectionConfig(config); err != nil {
+	config := &cfg
+	warnings, err := ValidateCollectionConfig(config)
+	if err != nil {
 		return err
 	}
+	for _, w := range warnings {
+		logger.InfoAttrs("collection config warning", "collection", name, "code", w.Code, "warning", w.Message)
+	}
+	if config.IndexCompression == types.CompressionPQ {
+		config.IndexType = types.IndexTypeFlat
+		if config.PQSubspaces == 0 {
+			config.PQSubspaces = defaultPQSubspaces(dimensions)
+		}
+	}
+	if config.IndexType == "" {
+		config.IndexType = types.IndexTypeHNSW
+	}
+	if config.IndexType == types.IndexTypeHNSW {
+		config.HNSWOptions = resolveHNSWOptions(config.HNSWOptions)
+	}
 
 	// Create collection directory
 	collPath := filepath.Join(cm.basePath, name)
@@ -161,45 +368,98 @@ func (cm *CollectionManager) CreateCollection(name string, dimensions uint32, me
 
 	// Save metadata
 	meta := &CollectionMeta{
+		Version:    CurrentMetaVersion,
 		Name:       name,
 		Dimensions: dimensions,
 		Metric:     metric,
+		IndexType:  config.IndexType,
+		HNSW:       config.HNSWOptions,
+
+		IndexCompression: config.IndexCompression,
+		PQSubspaces:      config.PQSubspaces,
+		Float16Vectors:   config.Float16Vectors,
+		MmapVectors:      config.MmapVectors,
+		AutoNormalize:    config.AutoNormalize,
+		NGramSizes:       config.NGramSizes,
+		TokenizationMode: config.TokenizationMode,
+		SecondaryHNSW:    config.SecondaryHNSWOptions,
 	}
 	if err := SaveCollectionMeta(collPath, meta); err != nil {
 		os.RemoveAll(collPath)
 		return fmt.Errorf("failed to save collection metadata: %w", err)
 	}
 
-	// Create HNSW wrapper
-	hnswPath := filepath.Join(collPath, "vectors.hnsw")
-	hnsw, err := NewHNSWWrapper(dimensions, metric, hnswPath)
+	// Create the primary index
+	index, hnsw, err := newPrimaryIndex(collPath, config)
 	if err != nil {
 		os.RemoveAll(collPath)
 		return err
 	}
 
+	var secondary *HNSWWrapper
+	if config.SecondaryHNSWOptions != nil {
+		secondary, err = newSecondaryHNSW(collPath, config)
+		if err != nil {
+			os.RemoveAll(collPath)
+			return err
+		}
+	}
+
 	// Create keyword index
-	kwPath := filepath.Join(collPath, "keywords.inv")
-	kwIndex := NewInvertedIndex(kwPath)
+	kwIndex := newKeywordIndex(collPath, config)
 
 	// Create forward index
 	docMapPath := filepath.Join(collPath, "doc_map.bin")
 	docMap := NewForwardIndex(docMapPath)
 
 	collection := &Collection{
-		Config:       *config,
-		HNSWIndex:    hnsw,
-		KeywordIndex: kwIndex,
-		DocMap:       docMap,
-		basePath:     collPath,
-		KeyLengths:   make(map[string]uint32),
-		KeyIndex:     make(map[string][]uint64),
+		Config:        *config,
+		Index:         index,
+		HNSWIndex:     hnsw,
+		SecondaryHNSW: secondary,
+		KeywordIndex:  kwIndex,
+		DocMap:        docMap,
+		basePath:      collPath,
+		KeyLengths:    make(map[string]uint32),
+		KeyIndex:      make(map[string][]uint64),
+		wal:           cm.wal,
 	}
+	collection.rebuildKeyBloom()
+	cm.useVectorCache(collection)
 
 	cm.collections[name] = collection
 	return nil
 }
 
+// useVectorCache attaches the vector cache to a collection being created or
+// loaded, dropping what it still holds for an earlier collection of the same
+// name. Flat and PQ collections are not cached: their vectors are a map
+// lookup away already.
+func (cm *CollectionManager) useVectorCache(coll *Collection) {
+	if coll.HNSWIndex == nil {
+		return
+	}
+	cm.vectorCache.InvalidateCollection(coll.Config.Name)
+	coll.vectorCache = cm.vectorCache
+	coll.HNSWIndex.SetVectorCache(cm.vectorCache, coll.Config.Name)
+}
+
+// SetWAL makes the collections, including those created or loaded later, log
+// their forward and keyword index changes to w before applying them.
+func (cm *CollectionManager) SetWAL(w *WAL) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.wal = w
+	for _, coll := range cm.collections {
+		coll.wal = w
+	}
+}
+
+// VectorCache returns the cache shared by the collections.
+func (cm *CollectionManager) VectorCache() *VectorCache {
+	return cm.vectorCache
+}
+
 // DeleteCollection deletes a vector collection.
 func (cm *CollectionManager) DeleteCollection(name string) error {
 	cm.mu.Lock()
@@ -207,7 +467,7 @@ func (cm *CollectionManager) DeleteCollection(name string) error {
 
 	coll, exists := cm.collections[name]
 	if !exists {
-		return fmt.Errorf("collection %q not found", name)
+		return &types.CollectionNotFoundError{Collection: name}
 	}
 
 	// Close resources
@@ -220,6 +480,127 @@ func (cm *CollectionManager) DeleteCollection(name string) error {
 	return os.RemoveAll(coll.basePath)
 }
 
+// DeleteCollectionWithBackup archives a collection's files to backupDir and
+// deletes the collection only once the archive has been verified. The
+// collection is closed first, so that the archive holds its final indexes
+// and nothing writes to them while they are copied. If the backup fails,
+// the collection is reopened from its untouched directory.
+func (cm *CollectionManager) DeleteCollectionWithBackup(name, backupDir string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	coll, exists := cm.collections[name]
+	if !exists {
+		return &types.CollectionNotFoundError{Collection: name}
+	}
+
+	err := coll.Close()
+	delete(cm.collections, name)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to close collection %q before backup: %w", name, err), cm.openAs(name))
+	}
+	if err := copyCollectionFiles(coll.basePath, backupDir, name); err != nil {
+		return errors.Join(fmt.Errorf("backup of collection %q failed: %w", name, err), cm.openAs(name))
+	}
+	return os.RemoveAll(coll.basePath)
+}
+
+// RenameCollection renames a collection and its directory. The collection is
+// closed, which saves its indexes, and reopened under the new name; other
+// collections stay available throughout.
+func (cm *CollectionManager) RenameCollection(oldName, newName string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	coll, err := cm.checkCopyTarget(oldName, newName)
+	if err != nil {
+		return err
+	}
+	newPath := filepath.Join(cm.basePath, newName)
+
+	// On failure, serve whatever made it to disk under the old name again
+	err = coll.Close()
+	delete(cm.collections, oldName)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to close collection %q: %w", oldName, err), cm.openAs(oldName))
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return errors.Join(fmt.Errorf("failed to rename collection %q: %w", oldName, err), cm.openAs(oldName))
+	}
+	if err := os.Rename(coll.basePath, newPath); err != nil {
+		return errors.Join(fmt.Errorf("failed to rename collection %q: %w", oldName, err), cm.openAs(oldName))
+	}
+	return cm.openAs(newName)
+}
+
+// CopyCollection creates dstName as a copy of the files of srcName. The
+// source is saved first and stays open; writes made to it while the copy
+// runs may or may not be included.
+func (cm *CollectionManager) CopyCollection(srcName, dstName string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	src, err := cm.checkCopyTarget(srcName, dstName)
+	if err != nil {
+		return err
+	}
+	dstPath := filepath.Join(cm.basePath, dstName)
+
+	if err := src.Save(); err != nil {
+		return fmt.Errorf("failed to save collection %q before copying: %w", srcName, err)
+	}
+	if err := src.snapshotTo(dstPath); err != nil {
+		os.RemoveAll(dstPath)
+		return fmt.Errorf("failed to copy collection %q: %w", srcName, err)
+	}
+	if err := cm.openAs(dstName); err != nil {
+		os.RemoveAll(dstPath)
+		return err
+	}
+	return nil
+}
+
+// checkCopyTarget returns the collection name, checking that it can be
+// renamed or copied to target. Caller must hold cm.mu.
+func (cm *CollectionManager) checkCopyTarget(name, target string) (*Collection, error) {
+	coll, exists := cm.collections[name]
+	if !exists {
+		return nil, &types.CollectionNotFoundError{Collection: name}
+	}
+	if target == "" {
+		return nil, errors.New("collection name cannot be empty")
+	}
+	if _, exists := cm.collections[target]; exists {
+		return nil, fmt.Errorf("collection %q already exists", target)
+	}
+	if _, err := os.Stat(filepath.Join(cm.basePath, target)); !os.IsNotExist(err) {
+		return nil, fmt.Errorf("directory for collection %q already exists", target)
+	}
+	return coll, nil
+}
+
+// openAs loads the collection in the directory indexes/name, renaming it to
+// name in its metadata if needed. Caller must hold cm.mu.
+func (cm *CollectionManager) openAs(name string) error {
+	collPath := filepath.Join(cm.basePath, name)
+	meta, err := LoadCollectionMeta(collPath)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata of collection %q: %w", name, err)
+	}
+	if meta.Name != name {
+		meta.Name = name
+		if err := SaveCollectionMeta(collPath, meta); err != nil {
+			return fmt.Errorf("failed to save metadata of collection %q: %w", name, err)
+		}
+	}
+	coll, err := cm.loadCollection(meta)
+	if err != nil {
+		return fmt.Errorf("failed to load collection %q: %w", name, err)
+	}
+	cm.collections[name] = coll
+	return nil
+}
+
 // GetCollection returns a collection by name.
 func (cm *CollectionManager) GetCollection(name string) (*Collection, error) {
 	cm.mu.RLock()
@@ -227,7 +608,7 @@ func (cm *CollectionManager) GetCollection(name string) (*Collection, error) {
 
 	coll, exists := cm.collections[name]
 	if !exists {
-		return nil, fmt.Errorf("collection %q not found", name)
+		return nil, &types.CollectionNotFoundError{Collection: name}
 	}
 	return coll, nil
 }
@@ -258,65 +639,261 @@ func (cm *CollectionManager) Close() error {
 	return lastErr
 }
 
+// restoreFrom replaces the named collections with the copies in
+// srcDir/<name>, as written by snapshotTo, and loads them. With exclusive set
+// every other collection is dropped as well. Operations on the replaced
+// collections fail with ErrClosing while the restore runs.
+func (cm *CollectionManager) restoreFrom(srcDir string, names []string, exclusive bool) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	drop := names
+	if exclusive {
+		drop = slices.Collect(maps.Keys(cm.collections))
+	}
+	for _, name := range drop {
+		if coll, ok := cm.collections[name]; ok {
+			coll.Close()
+			delete(cm.collections, name)
+		}
+		if err := os.RemoveAll(filepath.Join(cm.basePath, name)); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		src := filepath.Join(srcDir, name)
+		dst := filepath.Join(cm.basePath, name)
+		if err := os.CopyFS(dst, os.DirFS(src)); err != nil {
+			return fmt.Errorf("failed to restore collection %s: %w", name, err)
+		}
+		meta, err := LoadCollectionMeta(dst)
+		if err != nil {
+			return fmt.Errorf("failed to restore collection %s: %w", name, err)
+		}
+		coll, err := cm.loadCollection(meta)
+		if err != nil {
+			return fmt.Errorf("failed to load collection %s: %w", name, err)
+		}
+		cm.collections[meta.Name] = coll
+	}
+	return nil
+}
+
 // Collection methods
 
-// Close saves and closes the collection.
+// Close saves and closes the collection. New operations fail with ErrClosing
+// and Close waits for operations already in flight before saving.
 func (c *Collection) Close() error {
+	c.drainMu.Lock()
+	alreadyClosing := c.closing.Swap(true)
+	c.drainMu.Unlock()
+	if alreadyClosing {
+		return nil
+	}
+	start := time.Now()
+	c.drainWg.Wait()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	var errs []error
 
-	if err := c.HNSWIndex.Save(); err != nil {
+	if err := c.Index.Save(); err != nil {
 		errs = append(errs, err)
 	}
-	if err := c.HNSWIndex.Close(); err != nil {
+	if err := c.Index.Close(); err != nil {
 		errs = append(errs, err)
 	}
+	if c.SecondaryHNSW != nil {
+		if err := c.SecondaryHNSW.Save(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := c.SecondaryHNSW.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	if err := c.KeywordIndex.Save(); err != nil {
 		errs = append(errs, err)
 	}
 	if err := c.DocMap.Save(); err != nil {
 		errs = append(errs, err)
+	} else if err := c.saveKeyBloom(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.saveLearnedEf(); err != nil {
+		errs = append(errs, err)
 	}
 
 	if len(errs) > 0 {
-		return errors.Join(errs...)
+		err := errors.Join(errs...)
+		logger.ErrorAttrs("collection close failed", "collection", c.Config.Name, "path", c.basePath,
+			"duration_ms", logger.Since(start), "error", err)
+		return err
 	}
+	logger.InfoAttrs("collection closed", "collection", c.Config.Name, "path", c.basePath,
+		"vectors", c.Index.Count(), "keys", len(c.KeyLengths), "duration_ms", logger.Since(start))
 	return nil
 }
 
 // AppendBlock adds a new block to the key.
+// Appends to different keys run concurrently; appends to the same key are serialized.
 func (c *Collection) AppendBlock(key string, block *types.BlockData) (uint32, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	return c.appendBlock(key, block, 0)
+}
+
+// appendBlock implements AppendBlock. addLSN is the LSN of the WALOpAdd
+// entry of the block, recorded in its index entry.
+func (c *Collection) appendBlock(key string, block *types.BlockData, addLSN uint64) (uint32, error) {
+	if err := c.checkKeywords(block.Keywords); err != nil {
+		return 0, err
+	}
+	if err := c.enter(); err != nil {
+		return 0, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
+	lock := c.keyLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+	index, _, err := c.appendBlockLocked(key, block, addLSN)
+	return index, err
+}
+
+// appendBlockLocked implements appendBlock, returning the block index and
+// vector ID. The keywords must have been checked. Caller must hold mu
+// exclusively, or shared together with the key lock.
+func (c *Collection) appendBlockLocked(key string, block *types.BlockData, addLSN uint64) (uint32, uint64, error) {
 	// Determine new index
+	c.memMu.RLock()
 	index := c.KeyLengths[key]
+	c.memMu.RUnlock()
 
-	// Get next vector ID
-	vectorID := c.DocMap.GetNextVectorID()
+	// Allocate vector ID and add to forward index (VectorID -> Key, Index)
+	vectorID, err := c.DocMap.ReserveVectorIDs(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	loc := DocLocation{Key: key, Index: index, ExpiresAt: blockExpiry(block, time.Now())}
+	if err := c.logIndex(indexAddEntry(c.Config.Name, vectorID, loc, block.Keywords, addLSN)); err != nil {
+		return 0, 0, err
+	}
+	c.DocMap.Add(vectorID, key, index)
+	if loc.ExpiresAt != 0 {
+		c.DocMap.SetExpiry(vectorID, loc.ExpiresAt)
+	}
 
 	// Add to HNSW index (if vector present)
 	if len(block.Vector) > 0 {
-		if err := c.HNSWIndex.Add(vectorID, block.Vector); err != nil {
-			return 0, fmt.Errorf("failed to add vector: %w", err)
+		vector := c.indexVector(block.Vector)
+		if err := c.Index.Add(vectorID, vector); err != nil {
+			c.DocMap.Delete(vectorID)
+			return 0, 0, fmt.Errorf("failed to add vector: %w", err)
+		}
+		if c.SecondaryHNSW != nil {
+			if err := c.SecondaryHNSW.Add(vectorID, vector); err != nil {
+				c.Index.Delete(vectorID)
+				c.DocMap.Delete(vectorID)
+				return 0, 0, fmt.Errorf("failed to add vector to secondary index: %w", err)
+			}
 		}
 	}
 
-	// Add to forward index (VectorID -> Key, Index)
-	c.DocMap.Add(vectorID, key, index)
-
 	// Add to keyword index
 	if len(block.Keywords) > 0 {
 		c.KeywordIndex.Add(block.Keywords, vectorID)
 	}
 
 	// Update Memory Indexes
+	c.memMu.Lock()
+	if index == 0 {
+		c.insertKey(key)
+	}
 	c.KeyLengths[key]++
 	c.KeyIndex[key] = append(c.KeyIndex[key], vectorID)
+	c.memMu.Unlock()
+
+	return index, vectorID, nil
+}
+
+// checkKeywords validates the keywords of a block against the tokenization
+// mode of the collection.
+func (c *Collection) checkKeywords(keywords []string) error {
+	for _, kw := range keywords {
+		if err := ValidateKeywordMode(NormalizeKeyword(kw), c.Config.TokenizationMode); err != nil {
+			return fmt.Errorf("invalid keyword %q: %w", kw, err)
+		}
+	}
+	return nil
+}
+
+// UpdateBlock replaces the vector and keywords of an existing block, keeping its
+// VectorID. Returns the VectorID of the block.
+func (c *Collection) UpdateBlock(key string, index uint32, block *types.BlockData) (uint64, error) {
+	if err := c.enter(); err != nil {
+		return 0, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	lock := c.keyLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+	return c.updateBlockLocked(key, index, block)
+}
+
+// updateBlockLocked implements UpdateBlock. Caller must hold mu exclusively,
+// or shared together with the key lock.
+func (c *Collection) updateBlockLocked(key string, index uint32, block *types.BlockData) (uint64, error) {
+	if err := c.checkKeywords(block.Keywords); err != nil {
+		return 0, err
+	}
+	c.memMu.RLock()
+	vectorID, err := c.blockVectorID(key, index)
+	c.memMu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	if loc, ok := c.DocMap.Get(vectorID); ok && loc.Expired(time.Now().Unix()) {
+		return 0, ErrExpired
+	}
+
+	// Re-insert the vector under the same ID so the old one is unreachable
+	indexes := []VectorIndex{c.Index}
+	if c.SecondaryHNSW != nil {
+		indexes = append(indexes, c.SecondaryHNSW)
+	}
+	vector := c.indexVector(block.Vector)
+	for _, index := range indexes {
+		if index.Contains(vectorID) {
+			if err := index.Delete(vectorID); err != nil {
+				return 0, fmt.Errorf("failed to remove old vector: %w", err)
+			}
+		}
+		if len(block.Vector) > 0 {
+			if err := index.Add(vectorID, vector); err != nil {
+				return 0, fmt.Errorf("failed to add vector: %w", err)
+			}
+		}
+	}
+
+	// The update replaces the block's TTL too
+	c.DocMap.Add(vectorID, key, index)
+	if expiresAt := blockExpiry(block, time.Now()); expiresAt != 0 {
+		c.DocMap.SetExpiry(vectorID, expiresAt)
+	}
+
+	c.KeywordIndex.DeleteDoc(vectorID)
+	if len(block.Keywords) > 0 {
+		c.KeywordIndex.Add(block.Keywords, vectorID)
+	}
 
-	return index, nil
+	return vectorID, nil
 }
 
 // BatchAppendBlocks adds multiple blocks efficiently under a single lock.
@@ -325,6 +902,25 @@ func (c *Collection) BatchAppendBlocks(keys []string, blocks []*types.BlockData)
 	VectorID uint64
 	Index    uint32
 }, error) {
+	return c.batchAppendBlocks(keys, blocks, 0)
+}
+
+// batchAppendBlocks implements BatchAppendBlocks. The WALOpAdd entries of
+// the blocks have consecutive LSNs from firstAddLSN, or none if it is 0.
+func (c *Collection) batchAppendBlocks(keys []string, blocks []*types.BlockData, firstAddLSN uint64) ([]struct {
+	VectorID uint64
+	Index    uint32
+}, error) {
+	for _, block := range blocks {
+		if err := c.checkKeywords(block.Keywords); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.drainWg.Done()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -339,10 +935,37 @@ func (c *Collection) BatchAppendBlocks(keys []string, blocks []*types.BlockData)
 		Vector []float32
 	}, 0, len(keys))
 
+	firstID, err := c.DocMap.ReserveVectorIDs(len(keys))
+	if err != nil {
+		return nil, err
+	}
+
+	// Log the index entries of all blocks before applying any
+	now := time.Now()
+	lengths := make(map[string]uint32)
+	locs := make([]DocLocation, len(keys))
+	logged := make([]WALEntry, len(keys))
+	for i, key := range keys {
+		length, ok := lengths[key]
+		if !ok {
+			length = c.KeyLengths[key]
+		}
+		lengths[key] = length + 1
+		locs[i] = DocLocation{Key: key, Index: length, ExpiresAt: blockExpiry(blocks[i], now)}
+		var addLSN uint64
+		if firstAddLSN != 0 {
+			addLSN = firstAddLSN + uint64(i)
+		}
+		logged[i] = indexAddEntry(c.Config.Name, firstID+uint64(i), locs[i], blocks[i].Keywords, addLSN)
+	}
+	if err := c.logIndex(logged...); err != nil {
+		return nil, err
+	}
+
 	for i, key := range keys {
 		block := blocks[i]
-		index := c.KeyLengths[key]
-		vectorID := c.DocMap.GetNextVectorID()
+		index := locs[i].Index
+		vectorID := firstID + uint64(i)
 
 		results[i].VectorID = vectorID
 		results[i].Index = index
@@ -352,11 +975,14 @@ func (c *Collection) BatchAppendBlocks(keys []string, blocks []*types.BlockData)
 			hnswItems = append(hnswItems, struct {
 				ID     uint64
 				Vector []float32
-			}{vectorID, block.Vector})
+			}{vectorID, c.indexVector(block.Vector)})
 		}
 
 		// Add to forward index
 		c.DocMap.Add(vectorID, key, index)
+		if locs[i].ExpiresAt != 0 {
+			c.DocMap.SetExpiry(vectorID, locs[i].ExpiresAt)
+		}
 
 		// Add to keyword index
 		if len(block.Keywords) > 0 {
@@ -364,15 +990,23 @@ func (c *Collection) BatchAppendBlocks(keys []string, blocks []*types.BlockData)
 		}
 
 		// Update memory indexes
+		if index == 0 {
+			c.insertKey(key)
+		}
 		c.KeyLengths[key]++
 		c.KeyIndex[key] = append(c.KeyIndex[key], vectorID)
 	}
 
 	// Batch insert into HNSW (single lock acquisition inside)
 	if len(hnswItems) > 0 {
-		if err := c.HNSWIndex.BatchAdd(hnswItems); err != nil {
+		if err := c.Index.BatchAdd(hnswItems); err != nil {
 			return results, fmt.Errorf("HNSW batch add failed: %w", err)
 		}
+		if c.SecondaryHNSW != nil {
+			if err := c.SecondaryHNSW.BatchAdd(hnswItems); err != nil {
+				return results, fmt.Errorf("secondary HNSW batch add failed: %w", err)
+			}
+		}
 	}
 
 	return results, nil
@@ -380,58 +1014,414 @@ func (c *Collection) BatchAppendBlocks(keys []string, blocks []*types.BlockData)
 
 // Search performs vector similarity search.
 func (c *Collection) Search(queryVector []float32, topK uint32, filter *types.SearchFilter) ([]types.SearchResultItem, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	return c.SearchVariant(queryVector, topK, filter, "primary")
+}
 
-	var bitset *BitSet
+// SearchContext is Search stopping with a *types.CancelledError once ctx is
+// done.
+func (c *Collection) SearchContext(ctx context.Context, queryVector []float32, topK uint32, filter *types.SearchFilter) ([]types.SearchResultItem, error) {
+	return c.SearchVariantContext(ctx, queryVector, topK, filter, "primary")
+}
 
-	// Apply keyword filter
-	if filter != nil && len(filter.Keywords) > 0 {
-		bitset = c.KeywordIndex.Search(filter.Keywords, filter.KeywordMode, filter.MaxDistance)
-	}
+// SearchAsync starts a search in a goroutine and streams up to topK results
+// as the HNSW search finds them, for callers that can act on the first good
+// enough hit. Results arrive roughly nearest first but are not the exact top
+// k that Search returns. The result channel is closed once the search is done
+// or has failed; it has room for every result, so the caller may stop reading
+// early. The error channel then yields the error of the search, or nil.
+// Collections without an HNSW index search exactly and send the results when
+// done.
+func (c *Collection) SearchAsync(query []float32, topK uint32, filter *types.SearchFilter) (<-chan types.SearchResultItem, <-chan error) {
+	out := make(chan types.SearchResultItem, topK)
+	errc := make(chan error, 1)
+	go func() {
+		err := c.searchAsync(query, topK, filter, out)
+		close(out)
+		errc <- err
+	}()
+	return out, errc
+}
 
-	// Apply key filter
-	if filter != nil && len(filter.Keys) > 0 {
-		keyBitset := NewBitSet()
-		for _, key := range filter.Keys {
-			if vectorIDs, ok := c.KeyIndex[key]; ok {
-				for _, id := range vectorIDs {
-					keyBitset.Set(id)
-				}
-			}
+// searchAsync implements SearchAsync, sending the results to out.
+func (c *Collection) searchAsync(query []float32, topK uint32, filter *types.SearchFilter, out chan<- types.SearchResultItem) error {
+	if c.HNSWIndex == nil {
+		results, err := c.Search(query, topK, filter)
+		if err != nil {
+			return err
 		}
+		for _, r := range results {
+			out <- r
+		}
+		return nil
+	}
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.drainWg.Done()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	bitset, exclude := c.buildFilter(filter)
+	// The first hits include far nodes the search passes through on its
+	// way, so the stream is sized by the search list rather than topK
+	k := max(int(topK)+len(exclude), c.HNSWIndex.EfSearch)
+	hits, errc := c.HNSWIndex.SearchAsync(c.indexVector(query), k, bitset)
+	// Hits are not sorted, so those past the distance thresholds are
+	// skipped one by one instead of trimmed
+	limit := distanceLimit(filter)
+	now := time.Now().Unix()
+	sent := uint32(0)
+	for hit := range hits {
+		if sent == topK || hit.Distance > limit {
+			continue
+		}
+		if _, skip := exclude[hit.VectorID]; skip {
+			continue
+		}
+		loc, ok := c.DocMap.Get(hit.VectorID)
+		if !ok || loc.Expired(now) {
+			continue
+		}
+		out <- types.SearchResultItem{Key: loc.Key, Index: loc.Index, Distance: hit.Distance}
+		sent++
+	}
+	return <-errc
+}
+
+// SearchSecondary searches the secondary HNSW graph.
+func (c *Collection) SearchSecondary(query []float32, k int, filter *BitSet) ([]HNSWSearchResult, error) {
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.SecondaryHNSW == nil {
+		return nil, fmt.Errorf("collection %q has no secondary HNSW index", c.Config.Name)
+	}
+	return c.SecondaryHNSW.Search(c.indexVector(query), k, filter)
+}
+
+// SearchVariant performs vector similarity search against the "primary" or
+// "secondary" HNSW graph.
+func (c *Collection) SearchVariant(queryVector []float32, topK uint32, filter *types.SearchFilter, variant string) ([]types.SearchResultItem, error) {
+	return c.SearchVariantContext(context.Background(), queryVector, topK, filter, variant)
+}
+
+// SearchVariantContext is SearchVariant stopping with a *types.CancelledError
+// once ctx is done. Only HNSW searches notice it while running.
+func (c *Collection) SearchVariantContext(ctx context.Context, queryVector []float32, topK uint32, filter *types.SearchFilter, variant string) ([]types.SearchResultItem, error) {
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	index := c.Index
+	switch variant {
+	case "", "primary":
+	case "secondary":
+		if c.SecondaryHNSW == nil {
+			return nil, fmt.Errorf("collection %q has no secondary HNSW index", c.Config.Name)
+		}
+		index = c.SecondaryHNSW
+	default:
+		return nil, fmt.Errorf("unknown index variant %q", variant)
+	}
+
+	bitset, exclude := c.buildFilter(filter)
+
+	// Perform HNSW search, over-fetching so exclusions don't shrink the result set
+	var hnswResults []HNSWSearchResult
+	var err error
+	if hnsw, ok := index.(*HNSWWrapper); ok {
+		hnswResults, err = hnsw.SearchContext(ctx, c.indexVector(queryVector), int(topK)+len(exclude), bitset)
+	} else {
+		hnswResults, err = index.Search(c.indexVector(queryVector), int(topK)+len(exclude), bitset)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c.toResultItems(trimByDistance(hnswResults, filter), topK, exclude), nil
+}
+
+// pagedSearchPool runs a search whose candidate list is EfSearch multiplied by
+// pagedSearchEfFactor and returns every surviving hit with its vector ID.
+func (c *Collection) pagedSearchPool(queryVector []float32, filter *types.SearchFilter) ([]pagedHit, error) {
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	bitset, exclude := c.buildFilter(filter)
+	efSearch := DefaultEfSearch
+	if c.HNSWIndex != nil {
+		efSearch = c.HNSWIndex.EfSearch
+	}
+	hnswResults, err := c.Index.Search(c.indexVector(queryVector), efSearch*pagedSearchEfFactor, bitset)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	hits := make([]pagedHit, 0, len(hnswResults))
+	for _, hr := range trimByDistance(hnswResults, filter) {
+		if _, skip := exclude[hr.VectorID]; skip {
+			continue
+		}
+		loc, ok := c.DocMap.Get(hr.VectorID)
+		if !ok || loc.Expired(now) {
+			continue // Orphan or not yet swept
+		}
+		hits = append(hits, pagedHit{
+			VectorID: hr.VectorID,
+			Item:     types.SearchResultItem{Key: loc.Key, Index: loc.Index, Distance: hr.Distance},
+		})
+	}
+	return hits, nil
+}
+
+// hybridCandidateFactor is how many HNSW candidates HybridSearch rescores per requested result.
+const hybridCandidateFactor = 20
+
+// HybridSearch ranks blocks by a blend of vector similarity and BM25 keyword
+// relevance instead of using the keywords as a hard filter:
+//
+//	score = alpha * 1/(1+distance) + (1-alpha) * bm25
+//
+// BM25 scores are divided by the best score among the candidates so both terms
+// lie in [0,1]. Candidates are the topK*20 nearest vectors. Results carry the
+// blended score and are ordered by it, highest first.
+func (c *Collection) HybridSearch(query []float32, keywords []string, topK uint32, alpha float32) ([]types.SearchResultItem, error) {
+	if alpha < 0 || alpha > 1 {
+		return nil, fmt.Errorf("alpha must be in [0,1], got %v", alpha)
+	}
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	candidates, err := c.Index.Search(c.indexVector(query), int(topK)*hybridCandidateFactor, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	bm25 := make([]float64, len(candidates))
+	var maxBM25 float64
+	for i, cand := range candidates {
+		bm25[i] = c.KeywordIndex.ScoreDocument(cand.VectorID, keywords)
+		maxBM25 = max(maxBM25, bm25[i])
+	}
+
+	now := time.Now().Unix()
+	results := make([]types.SearchResultItem, 0, len(candidates))
+	for i, cand := range candidates {
+		loc, ok := c.DocMap.Get(cand.VectorID)
+		if !ok || loc.Expired(now) {
+			continue
+		}
+		keywordScore := 0.0
+		if maxBM25 > 0 {
+			keywordScore = bm25[i] / maxBM25
+		}
+		vectorScore := 1 / (1 + float64(cand.Distance))
+		results = append(results, types.SearchResultItem{
+			Key:      loc.Key,
+			Index:    loc.Index,
+			Distance: cand.Distance,
+			Score:    float64(alpha)*vectorScore + float64(1-alpha)*keywordScore,
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > int(topK) {
+		results = results[:topK]
+	}
+	return results, nil
+}
+
+// BatchSearch runs several queries against the primary HNSW graph with one
+// shared filter. Results are returned in query order.
+func (c *Collection) BatchSearch(queries [][]float32, topK uint32, filter *types.SearchFilter) ([][]types.SearchResultItem, error) {
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	bitset, exclude := c.buildFilter(filter)
+	if c.Config.AutoNormalize {
+		normalized := make([][]float32, len(queries))
+		for i, query := range queries {
+			normalized[i] = c.indexVector(query)
+		}
+		queries = normalized
+	}
+	hnswResults, err := c.Index.BatchSearch(queries, int(topK)+len(exclude), bitset)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]types.SearchResultItem, len(hnswResults))
+	for i, hr := range hnswResults {
+		results[i] = c.toResultItems(trimByDistance(hr, filter), topK, exclude)
+	}
+	return results, nil
+}
+
+// RangeSearch returns every block whose vector lies within radius of the query,
+// sorted by ascending distance.
+func (c *Collection) RangeSearch(queryVector []float32, radius float32, filter *types.SearchFilter) ([]types.SearchResultItem, error) {
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	bitset, exclude := c.buildFilter(filter)
+	if bitset != nil && bitset.IsEmpty() {
+		// Nothing matches the keyword/key filter; don't fall back to an unfiltered scan
+		return nil, nil
+	}
+	hnswResults, err := c.Index.RangeSearch(c.indexVector(queryVector), radius, bitset)
+	if err != nil {
+		return nil, err
+	}
+	hnswResults = trimByDistance(hnswResults, filter)
+	return c.toResultItems(hnswResults, uint32(len(hnswResults)), exclude), nil
+}
+
+// buildFilter resolves a SearchFilter into an allow-list BitSet (nil when
+// unfiltered) and a set of excluded VectorIDs. Caller must hold c.mu.
+func (c *Collection) buildFilter(filter *types.SearchFilter) (*BitSet, map[uint64]struct{}) {
+	if filter == nil {
+		return nil, nil
+	}
+
+	var bitset *BitSet
+
+	// Apply keyword filter
+	if len(filter.Keywords) > 0 && filter.KeywordMode == "jaccard" {
+		bitset = jaccardBitSet(c.KeywordIndex.SearchJaccard(filter.Keywords, filter.JaccardThreshold))
+	} else if len(filter.Keywords) > 0 {
+		bitset = c.KeywordIndex.Search(filter.Keywords, filter.KeywordMode, filter.MaxEditDistance)
+	}
+
+	// Apply key filter
+	if len(filter.Keys) > 0 {
+		keyBitset := NewBitSetWithCapacity(c.DocMap.PeekNextVectorID())
+		c.memMu.RLock()
+		for _, key := range filter.Keys {
+			for _, id := range c.KeyIndex[key] {
+				keyBitset.Set(id)
+			}
+		}
+		c.memMu.RUnlock()
 		if bitset == nil {
 			bitset = keyBitset
 		} else {
-			bitset = bitset.Intersect(keyBitset) // Use generic Intersect? or bitset.Intersect returns BitSet
+			bitset = bitset.Intersect(keyBitset)
 		}
 	}
 
-	// Perform HNSW search
-	hnswResults, err := c.HNSWIndex.Search(queryVector, int(topK), bitset)
-	if err != nil {
-		return nil, err
+	// Build exclusion set
+	var exclude map[uint64]struct{}
+	if len(filter.ExcludeIDs) > 0 || len(filter.ExcludeKeys) > 0 {
+		exclude = make(map[uint64]struct{}, len(filter.ExcludeIDs))
+		for _, id := range filter.ExcludeIDs {
+			exclude[id] = struct{}{}
+		}
+		c.memMu.RLock()
+		for _, key := range filter.ExcludeKeys {
+			for _, id := range c.KeyIndex[key] {
+				exclude[id] = struct{}{}
+			}
+		}
+		c.memMu.RUnlock()
+	}
+
+	return bitset, exclude
+}
+
+// trimByDistance drops the hits beyond the filter's MaxDistance and MinScore
+// thresholds. Hits must be sorted by ascending distance.
+func trimByDistance(hits []HNSWSearchResult, filter *types.SearchFilter) []HNSWSearchResult {
+	if filter == nil || (filter.MaxDistance == 0 && filter.MinScore == 0) {
+		return hits
 	}
+	limit := distanceLimit(filter)
+	n := sort.Search(len(hits), func(i int) bool { return hits[i].Distance > limit })
+	return hits[:n]
+}
+
+// distanceLimit returns the largest distance the filter's MaxDistance and
+// MinScore thresholds allow, +Inf without thresholds.
+func distanceLimit(filter *types.SearchFilter) float32 {
+	limit := float32(math.Inf(1))
+	if filter == nil {
+		return limit
+	}
+	if filter.MaxDistance != 0 {
+		limit = filter.MaxDistance
+	}
+	if filter.MinScore != 0 {
+		// Inner-product distance is the negated dot product
+		limit = min(limit, -filter.MinScore)
+	}
+	return limit
+}
 
-	// Convert results
+// toResultItems maps HNSW hits to keys, dropping excluded, expired and orphaned
+// IDs and keeping at most topK items.
+func (c *Collection) toResultItems(hnswResults []HNSWSearchResult, topK uint32, exclude map[uint64]struct{}) []types.SearchResultItem {
+	now := time.Now().Unix()
 	results := make([]types.SearchResultItem, 0, len(hnswResults))
 	for _, hr := range hnswResults {
+		if len(results) == int(topK) {
+			break
+		}
+		if _, skip := exclude[hr.VectorID]; skip {
+			continue
+		}
 		loc, ok := c.DocMap.Get(hr.VectorID)
 		if !ok {
 			continue // Orphan
 		}
+		if loc.Expired(now) {
+			continue // Expired but not yet swept
+		}
 		results = append(results, types.SearchResultItem{
 			Key:      loc.Key,
 			Index:    loc.Index,
 			Distance: hr.Distance,
 		})
 	}
-
-	return results, nil
+	return results
 }
 
-// KeywordSearch performs keyword-only search.
+// KeywordSearch performs keyword-only search. Mode "any" matches blocks with
+// at least one of the keywords; the other modes require all of them.
 func (c *Collection) KeywordSearch(keywords []string, mode string, maxDistance uint32) ([]string, error) {
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.drainWg.Done()
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
@@ -456,56 +1446,391 @@ func (c *Collection) KeywordSearch(keywords []string, mode string, maxDistance u
 	return keys, nil
 }
 
+// KeywordSearchRanked returns the topK blocks matching any of the keywords,
+// ordered by BM25 score. With maxDistance > 0, keywords also match indexed
+// keywords within that Levenshtein distance.
+func (c *Collection) KeywordSearchRanked(keywords []string, topK int, maxDistance uint32) ([]types.SearchResultItem, error) {
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if maxDistance > 0 {
+		keywords = c.KeywordIndex.FuzzyKeywords(keywords, maxDistance)
+	}
+
+	matches := c.KeywordIndex.SearchBM25(keywords, topK)
+	results := make([]types.SearchResultItem, 0, len(matches))
+	for _, m := range matches {
+		if loc, ok := c.DocMap.Get(m.VectorID); ok {
+			results = append(results, types.SearchResultItem{
+				Key:   loc.Key,
+				Index: loc.Index,
+				Score: m.Score,
+			})
+		}
+	}
+	return results, nil
+}
+
+// RankedKey is a key with the BM25 relevance score of its blocks.
+type RankedKey struct {
+	Key   string
+	Score float64
+}
+
+// KeywordSearchRankedKeys returns the topK keys with a block matching the
+// keywords in mode, as KeywordSearch, ordered by score. The score of a key is
+// the sum of the BM25 scores of all its blocks for the keywords, or for the
+// indexed keywords they select in the "prefix" and "partial" modes. topK <= 0
+// returns every match.
+func (c *Collection) KeywordSearchRankedKeys(keywords []string, mode string, topK int) ([]RankedKey, error) {
+	if err := c.enter(); err != nil {
+		return nil, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	matched := c.KeywordIndex.Search(keywords, mode, 0)
+	if matched == nil || matched.IsEmpty() {
+		return nil, nil
+	}
+	scores := make(map[string]float64)
+	for _, vectorID := range matched.ToSlice() {
+		if loc, ok := c.DocMap.Get(vectorID); ok {
+			scores[loc.Key] = 0
+		}
+	}
+	for _, m := range c.KeywordIndex.SearchBM25(c.KeywordIndex.MatchingKeywords(keywords, mode), 0) {
+		if loc, ok := c.DocMap.Get(m.VectorID); ok {
+			if _, ok := scores[loc.Key]; ok {
+				scores[loc.Key] += m.Score
+			}
+		}
+	}
+
+	ranked := make([]RankedKey, 0, len(scores))
+	for key, score := range scores {
+		ranked = append(ranked, RankedKey{Key: key, Score: score})
+	}
+	slices.SortFunc(ranked, func(a, b RankedKey) int {
+		if n := cmp.Compare(b.Score, a.Score); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	if topK > 0 && len(ranked) > topK {
+		ranked = ranked[:topK]
+	}
+	return ranked, nil
+}
+
 // DeleteKey removes a key and all its blocks.
 func (c *Collection) DeleteKey(key string) error {
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.drainWg.Done()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.deleteKeyLocked(key)
+}
 
+// deleteKeyLocked implements DeleteKey. Caller must hold mu exclusively.
+func (c *Collection) deleteKeyLocked(key string) error {
 	vectorIDs, ok := c.KeyIndex[key]
 	if !ok {
-		return fmt.Errorf("key %q not found", key)
+		return &types.KeyNotFoundError{Collection: c.Config.Name, Key: key}
+	}
+
+	logged := make([]WALEntry, 0, len(vectorIDs))
+	for _, id := range vectorIDs {
+		if loc, ok := c.DocMap.Get(id); ok {
+			logged = append(logged, indexDeleteEntry(c.Config.Name, id, loc))
+		}
+	}
+	if err := c.logIndex(logged...); err != nil {
+		return err
 	}
 
 	for _, id := range vectorIDs {
 		// Debug logging
 		// fmt.Printf("Deleting VectorID %d for Key %s\n", id, key)
-		c.HNSWIndex.Delete(id)
-		// How to remove from KeywordIndex? Need to know keywords?
-		// InvertedIndex supports Delete(keywords, id).
-		// We don't track keywords per id here.
-		// So KeywordIndex might just keep stale IDs? Or cleanup on rebuild?
-		// Alternatively, KeywordIndex.DeleteDoc(id)? (Not implemented).
-		// For now, accept stale IDs in KeywordIndex (Search validates against DocMap/ForwardIndex if we check existence).
-		// Wait, Search uses BitSet from Keywords. If we fetch result from HNSW/BitSet, we check DocMap.
-		// If DocMap.Delete(id) is called, Get(id) returns false.
-		// So stale keywords return IDs that are filtered out at end.
-		// Correct.
+		c.Index.Delete(id)
+		if c.SecondaryHNSW != nil {
+			c.SecondaryHNSW.Delete(id)
+		}
+		c.KeywordIndex.DeleteDoc(id)
 		c.DocMap.Delete(id)
 	}
 
 	delete(c.KeyLengths, key)
 	delete(c.KeyIndex, key)
+	c.removeKey(key)
 	return nil
 }
 
+// restoreBlock re-applies the index add logged as entry, for WAL recovery.
+// Only the parts of the add missing from the saved indexes are applied, so
+// restoring a block twice is harmless. vector is the vector of the block, or
+// nil if its add entry is no longer in the log. It returns false, changing
+// nothing, if the logged key and index or vector ID belong to another block
+// by now, as after a defragmentation.
+func (c *Collection) restoreBlock(entry WALEntry, vector []float32) (bool, error) {
+	if err := c.enter(); err != nil {
+		return false, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, loc := entry.VectorID, entry.Location
+	if current, err := c.blockVectorID(loc.Key, loc.Index); err == nil && current != id {
+		return false, nil
+	}
+	if current, ok := c.DocMap.Get(id); ok && (current.Key != loc.Key || current.Index != loc.Index) {
+		return false, nil
+	}
+
+	c.DocMap.reserveThrough(id)
+	if _, ok := c.DocMap.Get(id); !ok {
+		c.DocMap.Add(id, loc.Key, loc.Index)
+		if loc.ExpiresAt != 0 {
+			c.DocMap.SetExpiry(id, loc.ExpiresAt)
+		}
+	}
+	if len(entry.Keywords) > 0 && !c.KeywordIndex.ContainsDoc(id) {
+		c.KeywordIndex.Add(entry.Keywords, id)
+	}
+	if len(vector) > 0 {
+		indexes := []VectorIndex{c.Index}
+		if c.SecondaryHNSW != nil {
+			indexes = append(indexes, c.SecondaryHNSW)
+		}
+		vector = c.indexVector(vector)
+		for _, index := range indexes {
+			if index.Contains(id) {
+				continue
+			}
+			if err := index.Add(id, vector); err != nil {
+				return false, fmt.Errorf("failed to restore vector %d: %w", id, err)
+			}
+		}
+	}
+
+	if _, ok := c.KeyLengths[loc.Key]; !ok {
+		c.insertKey(loc.Key)
+	}
+	if loc.Index >= c.KeyLengths[loc.Key] {
+		c.KeyLengths[loc.Key] = loc.Index + 1
+	}
+	if !slices.Contains(c.KeyIndex[loc.Key], id) {
+		c.KeyIndex[loc.Key] = append(c.KeyIndex[loc.Key], id)
+	}
+	return true, nil
+}
+
+// restoreDelete re-applies the index delete logged as entry, for WAL
+// recovery. It does nothing if the vector ID is gone or belongs to another
+// block by now.
+func (c *Collection) restoreDelete(entry WALEntry) error {
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, loc := entry.VectorID, entry.Location
+	if current, ok := c.DocMap.Get(id); !ok || current.Key != loc.Key || current.Index != loc.Index {
+		return nil
+	}
+	c.Index.Delete(id)
+	if c.SecondaryHNSW != nil {
+		c.SecondaryHNSW.Delete(id)
+	}
+	c.KeywordIndex.DeleteDoc(id)
+	c.DocMap.Delete(id)
+
+	// Keys are deleted whole, so the key goes with its last block
+	if ids := slices.DeleteFunc(c.KeyIndex[loc.Key], func(v uint64) bool { return v == id }); len(ids) > 0 {
+		c.KeyIndex[loc.Key] = ids
+	} else {
+		delete(c.KeyLengths, loc.Key)
+		delete(c.KeyIndex, loc.Key)
+		c.removeKey(loc.Key)
+	}
+	return nil
+}
+
+// logIndex writes index entries to the WAL of the collection, if it has one.
+func (c *Collection) logIndex(entries ...WALEntry) error {
+	if c.wal == nil || len(entries) == 0 {
+		return nil
+	}
+	if err := c.wal.LogBatch(entries); err != nil {
+		return fmt.Errorf("WAL logging of index changes failed: %w", err)
+	}
+	return nil
+}
+
+// insertKey adds a new key to keyList (caller must hold memMu or mu exclusively).
+func (c *Collection) insertKey(key string) {
+	c.addKeyBloom(key)
+	i := sort.SearchStrings(c.keyList, key)
+	if i < len(c.keyList) && c.keyList[i] == key {
+		return
+	}
+	c.keyList = slices.Insert(c.keyList, i, key)
+}
+
+// removeKey removes a key from keyList (caller must hold memMu or mu exclusively).
+func (c *Collection) removeKey(key string) {
+	i := sort.SearchStrings(c.keyList, key)
+	if i < len(c.keyList) && c.keyList[i] == key {
+		c.keyList = slices.Delete(c.keyList, i, i+1)
+	}
+}
+
+// ExpiredBlocks scans the forward index for blocks that have expired at now
+// (a Unix time). It returns the keys whose blocks have all expired, and the
+// vector IDs of expired blocks in keys that still have live blocks and that
+// PurgeBlocks has not removed yet.
+func (c *Collection) ExpiredBlocks(now int64) (keys []string, vectorIDs []uint64) {
+	if c.enter() != nil {
+		return nil, nil
+	}
+	defer c.drainWg.Done()
+
+	live := make(map[string]bool)
+	expired := make(map[string][]uint64)
+	c.DocMap.Range(func(id uint64, loc DocLocation) bool {
+		if loc.Expired(now) {
+			expired[loc.Key] = append(expired[loc.Key], id)
+		} else {
+			live[loc.Key] = true
+		}
+		return true
+	})
+
+	for key, ids := range expired {
+		if live[key] {
+			for _, id := range ids {
+				if c.Index.Contains(id) || c.KeywordIndex.ContainsDoc(id) {
+					vectorIDs = append(vectorIDs, id)
+				}
+			}
+		} else {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, vectorIDs
+}
+
+// PurgeBlocks removes blocks from the vector and keyword indexes so searches
+// stop considering them. Their forward index entries stay, so the indexes of
+// the remaining blocks of the key do not change.
+func (c *Collection) PurgeBlocks(vectorIDs []uint64) {
+	if c.enter() != nil {
+		return
+	}
+	defer c.drainWg.Done()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range vectorIDs {
+		if c.Index.Contains(id) {
+			c.Index.Delete(id)
+		}
+		if c.SecondaryHNSW != nil && c.SecondaryHNSW.Contains(id) {
+			c.SecondaryHNSW.Delete(id)
+		}
+		c.KeywordIndex.DeleteDoc(id)
+	}
+}
+
+// blockExpiry returns the Unix time after which a block appended at now is
+// expired, or 0 if it has no TTL.
+func blockExpiry(block *types.BlockData, now time.Time) int64 {
+	if block.TTLSeconds <= 0 {
+		return 0
+	}
+	return now.Unix() + block.TTLSeconds
+}
+
 // GetKeyLength returns the number of blocks for a key.
 func (c *Collection) GetKeyLength(key string) (uint32, error) {
+	if err := c.enter(); err != nil {
+		return 0, err
+	}
+	defer c.drainWg.Done()
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
+	c.memMu.RLock()
+	defer c.memMu.RUnlock()
 	if l, ok := c.KeyLengths[key]; ok {
 		return l, nil
 	}
-	return 0, fmt.Errorf("key %q not found", key)
+	return 0, &types.KeyNotFoundError{Collection: c.Config.Name, Key: key}
+}
+
+// earliestExpiry returns the earliest expiry time (Unix; 0 = never) of the
+// blocks of results. Blocks that no longer exist are skipped.
+func (c *Collection) earliestExpiry(results []types.SearchResultItem) int64 {
+	if err := c.enter(); err != nil {
+		return 0
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	c.memMu.RLock()
+	defer c.memMu.RUnlock()
+
+	var earliest int64
+	for _, r := range results {
+		vectorID, err := c.blockVectorID(r.Key, r.Index)
+		if err != nil {
+			continue
+		}
+		if loc, ok := c.DocMap.Get(vectorID); ok && loc.ExpiresAt != 0 && (earliest == 0 || loc.ExpiresAt < earliest) {
+			earliest = loc.ExpiresAt
+		}
+	}
+	return earliest
 }
 
 // GetBlockVectorID returns the VectorID for a specific block.
 func (c *Collection) GetBlockVectorID(key string, index uint32) (uint64, error) {
+	if err := c.enter(); err != nil {
+		return 0, err
+	}
+	defer c.drainWg.Done()
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
+	c.memMu.RLock()
+	defer c.memMu.RUnlock()
 
+	return c.blockVectorID(key, index)
+}
+
+// blockVectorID resolves a block to its VectorID (caller must hold memMu).
+func (c *Collection) blockVectorID(key string, index uint32) (uint64, error) {
 	vectorIDs, ok := c.KeyIndex[key]
 	if !ok {
-		return 0, fmt.Errorf("key %q not found", key)
+		return 0, &types.KeyNotFoundError{Collection: c.Config.Name, Key: key}
 	}
 
 	// We need to find which ID corresponds to this Index.
@@ -516,6 +1841,12 @@ func (c *Collection) GetBlockVectorID(key string, index uint32) (uint64, error)
 	// Replacing block keeps index same.
 	// So just check DocMap?
 	// Iterate IDs for this key and check index.
+	if int(index) < len(vectorIDs) {
+		// Blocks are usually listed in index order
+		if loc, ok := c.DocMap.Get(vectorIDs[index]); ok && loc.Index == index {
+			return vectorIDs[index], nil
+		}
+	}
 	for _, id := range vectorIDs {
 		if loc, ok := c.DocMap.Get(id); ok {
 			if loc.Index == index {
@@ -523,13 +1854,20 @@ func (c *Collection) GetBlockVectorID(key string, index uint32) (uint64, error)
 			}
 		}
 	}
-	return 0, fmt.Errorf("block %d not found for key %q", index, key)
+	return 0, &types.BlockNotFoundError{Collection: c.Config.Name, Key: key, Index: index}
 }
 
 // ListKeys returns all keys in the collection.
 func (c *Collection) ListKeys() []string {
+	if c.enter() != nil {
+		return nil
+	}
+	defer c.drainWg.Done()
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
+	c.memMu.RLock()
+	defer c.memMu.RUnlock()
 	keys := make([]string, 0, len(c.KeyLengths))
 	for k := range c.KeyLengths {
 		keys = append(keys, k)
@@ -537,53 +1875,300 @@ func (c *Collection) ListKeys() []string {
 	return keys
 }
 
+// ListKeysWithPrefix returns the keys starting with prefix in sorted order.
+// It binary-searches the sorted key list, so it costs O(log n + k) for k
+// matching keys.
+func (c *Collection) ListKeysWithPrefix(prefix string) []string {
+	keys, _ := c.ListKeysPaged(prefix, "", 0)
+	return keys
+}
+
+// ListKeysPaged returns, in sorted order, up to limit keys starting with
+// prefix that sort after afterKey, and whether more such keys follow. Passing
+// the last key of a page as afterKey returns the next page. A limit of 0 or
+// less returns all remaining keys.
+func (c *Collection) ListKeysPaged(prefix, afterKey string, limit int) (keys []string, hasMore bool) {
+	if c.enter() != nil {
+		return nil, false
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	c.memMu.RLock()
+	defer c.memMu.RUnlock()
+	i := sort.SearchStrings(c.keyList, prefix)
+	if afterKey != "" {
+		i = max(i, sort.Search(len(c.keyList), func(j int) bool { return c.keyList[j] > afterKey }))
+	}
+	keys = []string{}
+	for ; i < len(c.keyList) && strings.HasPrefix(c.keyList[i], prefix); i++ {
+		if limit > 0 && len(keys) == limit {
+			return keys, true
+		}
+		keys = append(keys, c.keyList[i])
+	}
+	return keys, false
+}
+
 // ContainsKey checks if a key exists.
 func (c *Collection) ContainsKey(key string) bool {
+	if c.enter() != nil {
+		return false
+	}
+	defer c.drainWg.Done()
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
+	// A key the filter has never seen is definitely absent
+	if !c.keyBloom.Load().MayContain(key) {
+		return false
+	}
+	c.memMu.RLock()
+	defer c.memMu.RUnlock()
 	_, ok := c.KeyLengths[key]
 	return ok
 }
 
 // Save persists all indexes.
 func (c *Collection) Save() error {
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.drainWg.Done()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.saveLocked()
+}
 
-	// Implementation matches existing Save
+// saveLocked writes every index of the collection in full. Caller must hold
+// mu exclusively.
+func (c *Collection) saveLocked() error {
 	var errs []error
-	if err := c.HNSWIndex.Save(); err != nil {
+	if err := c.Index.Save(); err != nil {
 		errs = append(errs, err)
 	}
+	if c.SecondaryHNSW != nil {
+		if err := c.SecondaryHNSW.Save(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	if err := c.KeywordIndex.Save(); err != nil {
 		errs = append(errs, err)
 	}
 	if err := c.DocMap.Save(); err != nil {
 		errs = append(errs, err)
+	} else if err := c.saveKeyBloom(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.saveLearnedEf(); err != nil {
+		errs = append(errs, err)
 	}
 
 	if len(errs) > 0 {
 		return errors.Join(errs...)
 	}
+	metrics.IndexSavesTotal.Inc()
+	return nil
+}
+
+// CompactKeywordIndex drops the postings of vector IDs that are no longer in
+// the forward index from the keyword index. Returns the number of postings
+// keys removed.
+func (c *Collection) CompactKeywordIndex() (int, error) {
+	if err := c.enter(); err != nil {
+		return 0, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	active := NewBitSetWithCapacity(c.DocMap.PeekNextVectorID())
+	c.DocMap.Range(func(vectorID uint64, _ DocLocation) bool {
+		active.set(vectorID)
+		return true
+	})
+	return c.KeywordIndex.Compact(active), nil
+}
+
+// Defragment renumbers the vectors of the collection to consecutive IDs from
+// 1, in their current order, and saves the collection. This reclaims the ID
+// space of deleted vectors without rebuilding the indexes. Tombstoned HNSW
+// nodes are compacted away first. Vector IDs obtained before the call refer
+// to other vectors, or none, after it.
+func (c *Collection) Defragment() error {
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start := time.Now()
+	for _, hnsw := range []*HNSWWrapper{c.HNSWIndex, c.SecondaryHNSW} {
+		if hnsw == nil {
+			continue
+		}
+		if err := hnsw.Compact(); err != nil {
+			return fmt.Errorf("failed to compact HNSW index: %w", err)
+		}
+	}
+
+	before := c.DocMap.PeekNextVectorID()
+	remap := c.DocMap.Defragment()
+	c.Index.Renumber(remap)
+	if c.SecondaryHNSW != nil {
+		c.SecondaryHNSW.Renumber(remap)
+	}
+	c.KeywordIndex.Renumber(remap)
+	for key, ids := range c.KeyIndex {
+		kept := ids[:0]
+		for _, id := range ids {
+			if newID, ok := remap[id]; ok {
+				kept = append(kept, newID)
+			}
+		}
+		c.KeyIndex[key] = kept
+	}
+
+	if err := c.saveLocked(); err != nil {
+		return err
+	}
+	logger.InfoAttrs("collection defragmented", "collection", c.Config.Name, "vectors", len(remap),
+		"reclaimed_ids", before-c.DocMap.PeekNextVectorID(), "duration_ms", logger.Since(start))
+	return nil
+}
+
+// snapshotTo copies the collection's files into dir and verifies the copy.
+func (c *Collection) snapshotTo(dir string) error {
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return copyCollectionFiles(c.basePath, dir, c.Config.Name)
+}
+
+// copyCollectionFiles copies the files of collection name from srcDir into
+// dstDir and verifies the copy. Files are copied rather than hard-linked,
+// so that later saves to srcDir cannot change the copy.
+func copyCollectionFiles(srcDir, dstDir, name string) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		// Vector files are rebuilt from the index files on load
+		if !entry.Type().IsRegular() || filepath.Ext(entry.Name()) == vectorFileExt {
+			continue
+		}
+		src := filepath.Join(srcDir, entry.Name())
+		dst := filepath.Join(dstDir, entry.Name())
+		if err := copyFilePrefix(src, dst, -1); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", entry.Name(), err)
+		}
+
+		// Verify the file is complete
+		srcInfo, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		dstInfo, err := os.Stat(dst)
+		if err != nil {
+			return err
+		}
+		if srcInfo.Size() != dstInfo.Size() {
+			return fmt.Errorf("incomplete copy of %s: %d of %d bytes", entry.Name(), dstInfo.Size(), srcInfo.Size())
+		}
+	}
+
+	meta, err := LoadCollectionMeta(dstDir)
+	if err != nil {
+		return fmt.Errorf("invalid meta.json in backup: %w", err)
+	}
+	if meta.Name != name {
+		return fmt.Errorf("backup meta.json names collection %q, expected %q", meta.Name, name)
+	}
 	return nil
 }
 
-// FlushHNSW saves only the HNSW index to disk.
+// IsDirty returns true if any of the collection's indexes have unsaved changes.
+func (c *Collection) IsDirty() bool {
+	return c.Index.IsDirty() || c.KeywordIndex.IsDirty() || c.DocMap.IsDirty() ||
+		(c.SecondaryHNSW != nil && c.SecondaryHNSW.IsDirty())
+}
+
+// FlushHNSW saves only the vector indexes to disk. HNSW indexes write a delta
+// of the changed nodes until enough have changed to warrant a full save; Save
+// and Close always write full snapshots.
 // Use this after batch operations to minimize I/O overhead.
 func (c *Collection) FlushHNSW() error {
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.drainWg.Done()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.HNSWIndex.Save()
+	return c.FlushHNSWLocked()
 }
 
-// rebuildMemoryIndexes rebuilds KeyLengths and KeyIndex from DocMap.
-func (c *Collection) rebuildMemoryIndexes() {
-	// Access DocMap directly (already locked by caller or initialized)
-	// Iterate raw map
-	c.DocMap.mu.RLock()
-	defer c.DocMap.mu.RUnlock()
+// FlushHNSWLocked is FlushHNSW for callers that hold the collection with
+// Lock or RLock.
+func (c *Collection) FlushHNSWLocked() error {
+	if c.SecondaryHNSW != nil {
+		if err := c.SecondaryHNSW.Flush(); err != nil {
+			return err
+		}
+	}
+	// HNSW indexes append a delta for small changes instead of rewriting
+	if hnsw, ok := c.Index.(*HNSWWrapper); ok {
+		return hnsw.Flush()
+	}
+	return c.Index.Save()
+}
+
+// Lock freezes the collection for maintenance: every other operation waits
+// until Unlock.
+func (c *Collection) Lock() {
+	c.mu.Lock()
+}
+
+// Unlock releases a freeze taken with Lock.
+func (c *Collection) Unlock() {
+	c.mu.Unlock()
+}
 
-	for id, loc := range c.DocMap.mapping {
+// RLock freezes the collection's contents, as for a backup. Reads continue
+// but writes wait until RUnlock. Appends and updates run under mu held
+// shared, so RLock also takes every key lock.
+func (c *Collection) RLock() {
+	c.mu.RLock()
+	for i := range c.keyLocks {
+		c.keyLocks[i].Lock()
+	}
+}
+
+// RUnlock releases a freeze taken with RLock.
+func (c *Collection) RUnlock() {
+	for i := range c.keyLocks {
+		c.keyLocks[i].Unlock()
+	}
+	c.mu.RUnlock()
+}
+
+// rebuildMemoryIndexes rebuilds KeyLengths, KeyIndex and keyList from DocMap.
+func (c *Collection) rebuildMemoryIndexes() {
+	c.DocMap.Range(func(id uint64, loc DocLocation) bool {
 		// Update Key Index
 		c.KeyIndex[loc.Key] = append(c.KeyIndex[loc.Key], id)
 
@@ -591,24 +2176,46 @@ func (c *Collection) rebuildMemoryIndexes() {
 		if loc.Index >= c.KeyLengths[loc.Key] {
 			c.KeyLengths[loc.Key] = loc.Index + 1
 		}
+		return true
+	})
+
+	c.keyList = make([]string, 0, len(c.KeyLengths))
+	for key := range c.KeyLengths {
+		c.keyList = append(c.keyList, key)
 	}
+	sort.Strings(c.keyList)
 }
 
 // Count returns the number of vectors in the collection.
 func (c *Collection) Count() uint64 {
+	if c.enter() != nil {
+		return 0
+	}
+	defer c.drainWg.Done()
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.HNSWIndex.Count()
+	return c.Index.Count()
 }
 
-// GetVectorByID retrieves a vector by its ID.
+// GetVectorByID retrieves a vector by its ID. Vectors of HNSW collections
+// are served from the vector cache when it holds them, without locking the
+// collection.
 func (c *Collection) GetVectorByID(id uint64) ([]float32, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	node, ok := c.HNSWIndex.nodes[id]
-	if !ok {
+	if c.enter() != nil {
 		return nil, false
 	}
-	return node.Vector, true
+	defer c.drainWg.Done()
+
+	if c.vectorCache != nil {
+		return c.vectorCache.Load(c.Config.Name, id, c.getVector)
+	}
+	return c.getVector(id)
+}
+
+// getVector reads a vector from the primary index.
+func (c *Collection) getVector(id uint64) ([]float32, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Index.GetVector(id)
 }
@@ -0,0 +1,993 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"waddlemap/internal/types"
+)
+
+func TestCollection_SecondaryHNSWRecall(t *testing.T) {
+	dataPath := t.TempDir()
+	cm, err := NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cm.CreateCollectionWithConfig(types.CollectionConfig{
+		Name:       "ab",
+		Dimensions: 16,
+		Metric:     types.MetricL2,
+		// A deliberately weak graph to compare against the defaults.
+		SecondaryHNSWOptions: &types.HNSWOptions{M: 4, EfConstruction: 8, EfSearch: 8},
+	})
+	if err != nil {
+		t.Fatalf("CreateCollectionWithConfig failed: %v", err)
+	}
+	coll, err := cm.GetCollection("ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		vec := make([]float32, 16)
+		for j := range vec {
+			vec[j] = rng.Float32()
+		}
+		if _, err := coll.AppendBlock("doc", &types.BlockData{Vector: vec}); err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+	}
+
+	if coll.SecondaryHNSW.Count() != 1000 {
+		t.Fatalf("Expected 1000 vectors in secondary index, got %d", coll.SecondaryHNSW.Count())
+	}
+
+	queries := make([][]float32, 50)
+	for i := range queries {
+		queries[i] = make([]float32, 16)
+		for j := range queries[i] {
+			queries[i][j] = rng.Float32()
+		}
+	}
+
+	results, err := coll.SearchSecondary(queries[0], 10, nil)
+	if err != nil {
+		t.Fatalf("SearchSecondary failed: %v", err)
+	}
+	if len(results) != 10 {
+		t.Errorf("Expected 10 secondary results, got %d", len(results))
+	}
+
+	primaryRecall, err := coll.HNSWIndex.ComputeRecall(queries, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondaryRecall, err := coll.SecondaryHNSW.ComputeRecall(queries, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("recall@10 primary=%.3f secondary=%.3f", primaryRecall, secondaryRecall)
+	if primaryRecall <= secondaryRecall {
+		t.Errorf("Expected higher EfConstruction to give better recall: primary=%.3f secondary=%.3f", primaryRecall, secondaryRecall)
+	}
+
+	// The secondary graph and its options survive a reload.
+	if err := cm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cm, err = NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	coll, err = cm.GetCollection("ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coll.SecondaryHNSW == nil || coll.SecondaryHNSW.Count() != 1000 || coll.SecondaryHNSW.M != 4 {
+		t.Fatalf("Secondary index not restored: %+v", coll.Config.SecondaryHNSWOptions)
+	}
+	if _, err := coll.SearchVariant(queries[0], 5, nil, "secondary"); err != nil {
+		t.Errorf("SearchVariant(secondary) failed: %v", err)
+	}
+	if _, err := coll.SearchVariant(queries[0], 5, nil, "tertiary"); err == nil {
+		t.Error("Expected error for unknown variant")
+	}
+}
+
+func TestCollection_PrimaryHNSWOptions(t *testing.T) {
+	dataPath := t.TempDir()
+	cm, err := NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs := map[string]*types.HNSWOptions{
+		"sparse": {M: 2, EfConstruction: 4, EfSearch: 4},
+		"dense":  {M: 32, EfConstruction: 200, EfSearch: 100},
+	}
+	for name, opts := range configs {
+		cfg := types.CollectionConfig{Name: name, Dimensions: 16, Metric: types.MetricL2, HNSWOptions: opts}
+		if err := cm.CreateCollectionWithConfig(cfg); err != nil {
+			t.Fatalf("CreateCollectionWithConfig(%s) failed: %v", name, err)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(7))
+	vectors := make([][]float32, 1000)
+	for i := range vectors {
+		vectors[i] = make([]float32, 16)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.Float32()
+		}
+	}
+	queries := vectors[:50]
+
+	recall := make(map[string]float64)
+	for name := range configs {
+		coll, _ := cm.GetCollection(name)
+		for _, vec := range vectors {
+			if _, err := coll.AppendBlock("doc", &types.BlockData{Vector: vec}); err != nil {
+				t.Fatalf("AppendBlock failed: %v", err)
+			}
+		}
+		if recall[name], err = coll.HNSWIndex.ComputeRecall(queries, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Logf("recall@10 sparse=%.3f dense=%.3f", recall["sparse"], recall["dense"])
+	if recall["dense"]-recall["sparse"] < 0.05 {
+		t.Errorf("Expected M=32 to recall measurably better than M=2: dense=%.3f sparse=%.3f", recall["dense"], recall["sparse"])
+	}
+
+	// The parameters are persisted in meta.json and applied on reload
+	if err := cm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cm, err = NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	coll, _ := cm.GetCollection("sparse")
+	if coll.HNSWIndex.M != 2 || coll.HNSWIndex.EfSearch != 4 || coll.Config.HNSWOptions.EfConstruction != 4 {
+		t.Errorf("Options not restored: M=%d ef_search=%d config=%+v", coll.HNSWIndex.M, coll.HNSWIndex.EfSearch, coll.Config.HNSWOptions)
+	}
+
+	invalid := []*types.HNSWOptions{
+		{M: 1},
+		{M: 16, EfConstruction: 8},
+		{EfSearch: -1},
+		{Ml: 1.5},
+	}
+	for _, opts := range invalid {
+		cfg := types.CollectionConfig{Name: "bad", Dimensions: 4, Metric: types.MetricL2, HNSWOptions: opts}
+		if err := cm.CreateCollectionWithConfig(cfg); err == nil {
+			t.Errorf("Expected %+v to be rejected", opts)
+		}
+	}
+}
+
+func TestCollection_FlatIndex(t *testing.T) {
+	dataPath := t.TempDir()
+	cm, err := NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := types.CollectionConfig{Name: "small", Dimensions: 4, Metric: types.MetricCosine, IndexType: types.IndexTypeFlat}
+	if err := cm.CreateCollectionWithConfig(cfg); err != nil {
+		t.Fatalf("CreateCollectionWithConfig failed: %v", err)
+	}
+	coll, _ := cm.GetCollection("small")
+	if coll.HNSWIndex != nil {
+		t.Fatal("Expected no HNSW index for a flat collection")
+	}
+
+	for i, vec := range [][]float32{{1, 0, 0, 0}, {0, 1, 0, 0}, {1, 1, 0, 0}} {
+		key := fmt.Sprintf("doc%d", i)
+		if _, err := coll.AppendBlock(key, &types.BlockData{Primary: key, Vector: vec}); err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+	}
+
+	results, err := coll.Search([]float32{1, 0.1, 0, 0}, 2, nil)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Key != "doc0" || results[1].Key != "doc2" {
+		t.Fatalf("Expected doc0, doc2; got %+v", results)
+	}
+
+	// The index type is persisted and the flat index reloaded
+	if err := cm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cm, err = NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	coll, _ = cm.GetCollection("small")
+	if coll.Config.IndexType != types.IndexTypeFlat || coll.HNSWIndex != nil {
+		t.Fatalf("Expected flat index after reload, got %q", coll.Config.IndexType)
+	}
+	if coll.Count() != 3 {
+		t.Errorf("Expected 3 vectors after reload, got %d", coll.Count())
+	}
+	if vec, ok := coll.GetVectorByID(coll.KeyIndex["doc1"][0]); !ok || vec[1] != 1 {
+		t.Errorf("GetVectorByID returned %v, %v", vec, ok)
+	}
+
+	bad := types.CollectionConfig{Name: "bad", Dimensions: 4, Metric: types.MetricL2, IndexType: "ivf"}
+	if err := cm.CreateCollectionWithConfig(bad); err == nil {
+		t.Error("Expected unknown index type to be rejected")
+	}
+}
+
+func newBenchCollection(tb testing.TB) *Collection {
+	tb.Helper()
+	cm, err := NewCollectionManager(tb.TempDir())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { cm.Close() })
+	if err := cm.CreateCollection("bench", 4, types.MetricL2); err != nil {
+		tb.Fatal(err)
+	}
+	coll, err := cm.GetCollection("bench")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return coll
+}
+
+func TestCollection_ConcurrentAppendDistinctKeys(t *testing.T) {
+	coll := newBenchCollection(t)
+
+	const writers, perWriter = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			key := fmt.Sprintf("doc%d", w)
+			for i := 0; i < perWriter; i++ {
+				idx, err := coll.AppendBlock(key, &types.BlockData{Vector: []float32{float32(w), float32(i), 0, 1}})
+				if err != nil {
+					t.Errorf("AppendBlock failed: %v", err)
+					return
+				}
+				if idx != uint32(i) {
+					t.Errorf("Key %s: expected index %d, got %d", key, i, idx)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if got := coll.DocMap.Count(); got != writers*perWriter {
+		t.Fatalf("Expected %d unique vector IDs, got %d", writers*perWriter, got)
+	}
+	for w := 0; w < writers; w++ {
+		length, err := coll.GetKeyLength(fmt.Sprintf("doc%d", w))
+		if err != nil || length != perWriter {
+			t.Errorf("doc%d: expected length %d, got %d (%v)", w, perWriter, length, err)
+		}
+	}
+}
+
+// BenchmarkCollection_ConcurrentAppend compares parallel appends that all hit
+// one key (serialized by its shard lock) against appends to distinct keys.
+func BenchmarkCollection_ConcurrentAppend(b *testing.B) {
+	block := &types.BlockData{Primary: "payload"}
+
+	b.Run("SameKey", func(b *testing.B) {
+		coll := newBenchCollection(b)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				coll.AppendBlock("shared", block)
+			}
+		})
+	})
+
+	b.Run("DistinctKeys", func(b *testing.B) {
+		coll := newBenchCollection(b)
+		var next atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			key := fmt.Sprintf("doc%d", next.Add(1))
+			for pb.Next() {
+				coll.AppendBlock(key, block)
+			}
+		})
+	})
+}
+
+func TestCollection_CloseDrainsInFlightSearches(t *testing.T) {
+	cm, err := NewCollectionManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.CreateCollection("drain", 4, types.MetricL2); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	coll, err := cm.GetCollection("drain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		vec := []float32{float32(i), 1, 2, 3}
+		if _, err := coll.AppendBlock("doc", &types.BlockData{Vector: vec}); err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+	}
+
+	// Hold the collection lock so the searches register and then block.
+	coll.mu.Lock()
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := coll.Search([]float32{1, 1, 2, 3}, 5, nil)
+			if err == nil && len(results) == 0 {
+				err = fmt.Errorf("search returned no results")
+			}
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- coll.Close() }()
+	for !coll.closing.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := coll.Search([]float32{1, 1, 2, 3}, 5, nil); err != ErrClosing {
+		t.Errorf("Expected ErrClosing for a new search, got %v", err)
+	}
+	select {
+	case <-closed:
+		t.Fatal("Close returned before in-flight searches finished")
+	default:
+	}
+
+	coll.mu.Unlock()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("In-flight search failed: %v", err)
+		}
+	}
+	if err := <-closed; err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if err := coll.Close(); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+}
+
+func TestCollection_MigratesVersion0Meta(t *testing.T) {
+	dataPath := t.TempDir()
+	collPath := filepath.Join(dataPath, "indexes", "legacy")
+	if err := os.MkdirAll(collPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// meta.json as written before the version field existed
+	legacy := `{"name": "legacy", "dimensions": 4, "metric": "l2"}`
+	if err := os.WriteFile(filepath.Join(collPath, "meta.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatalf("NewCollectionManager failed: %v", err)
+	}
+	coll, err := cm.GetCollection("legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coll.HNSWIndex.M != DefaultM || coll.HNSWIndex.EfConstruction != DefaultEfConstruction {
+		t.Errorf("Expected default HNSW params, got M=%d EfConstruction=%d", coll.HNSWIndex.M, coll.HNSWIndex.EfConstruction)
+	}
+	cm.Close()
+
+	meta, err := LoadCollectionMeta(collPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Version != CurrentMetaVersion {
+		t.Errorf("Expected migrated meta version %d, got %d", CurrentMetaVersion, meta.Version)
+	}
+	if meta.HNSW == nil || meta.HNSW.M != 16 || meta.HNSW.EfConstruction != 200 {
+		t.Errorf("Expected M=16 EfConstruction=200 in migrated meta, got %+v", meta.HNSW)
+	}
+}
+
+func TestMigrateAllCollections(t *testing.T) {
+	dataPath := t.TempDir()
+	indexesPath := filepath.Join(dataPath, "indexes")
+	for _, name := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(indexesPath, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveCollectionMeta(filepath.Join(indexesPath, name), &CollectionMeta{Name: name, Dimensions: 4, Metric: types.MetricL2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Directories without meta.json are not collections
+	if err := os.MkdirAll(filepath.Join(indexesPath, "scratch"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateAllCollections(dataPath); err != nil {
+		t.Fatalf("MigrateAllCollections failed: %v", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		meta, err := LoadCollectionMeta(filepath.Join(indexesPath, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Version != CurrentMetaVersion || meta.HNSW == nil || meta.HNSW.EfSearch != DefaultEfSearch {
+			t.Errorf("%s not migrated: %+v", name, meta)
+		}
+	}
+
+	future := &CollectionMeta{Version: CurrentMetaVersion + 1, Name: "a", Dimensions: 4, Metric: types.MetricL2}
+	if err := SaveCollectionMeta(filepath.Join(indexesPath, "a"), future); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateAllCollections(dataPath); err == nil {
+		t.Error("Expected error for a meta version newer than supported")
+	}
+}
+
+func TestCollection_SearchExcludeKeys(t *testing.T) {
+	cm, err := NewCollectionManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	if err := cm.CreateCollection("ex", 2, types.MetricL2); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	coll, err := cm.GetCollection("ex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		coll.AppendBlock("hidden", &types.BlockData{Vector: []float32{float32(i) * 0.01, 0}})
+		coll.AppendBlock("visible", &types.BlockData{Vector: []float32{1 + float32(i), 0}})
+	}
+
+	results, err := coll.Search([]float32{0, 0}, 3, &types.SearchFilter{ExcludeKeys: []string{"hidden"}})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.Key != "visible" {
+			t.Errorf("Excluded key %q returned", r.Key)
+		}
+	}
+}
+
+func TestCollection_SearchAsync(t *testing.T) {
+	cm, err := NewCollectionManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	if err := cm.CreateCollection("async", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.CreateCollectionWithConfig(types.CollectionConfig{Name: "flat", Dimensions: 2, Metric: types.MetricL2, IndexType: types.IndexTypeFlat}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"async", "flat"} {
+		coll, _ := cm.GetCollection(name)
+		for i := range 20 {
+			key := "visible"
+			if i < 5 {
+				key = "hidden"
+			}
+			if _, err := coll.AppendBlock(key, &types.BlockData{Vector: []float32{float32(i), 0}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var results []types.SearchResultItem
+		hits, errc := coll.SearchAsync([]float32{0, 0}, 4, &types.SearchFilter{ExcludeKeys: []string{"hidden"}, MaxDistance: 100})
+		for r := range hits {
+			results = append(results, r)
+		}
+		if err := <-errc; err != nil || len(results) != 4 {
+			t.Fatalf("%s: expected 4 results, got %+v (err %v)", name, results, err)
+		}
+		for _, r := range results {
+			if r.Key != "visible" || r.Distance > 100 {
+				t.Errorf("%s: unexpected result %+v", name, r)
+			}
+		}
+		hits, errc = coll.SearchAsync([]float32{0, 0, 0}, 4, nil)
+		if _, ok := <-hits; ok {
+			t.Errorf("%s: expected a failed search to close the channel", name)
+		}
+		if err := <-errc; !errors.As(err, new(*types.DimensionMismatchError)) {
+			t.Errorf("%s: expected a dimension mismatch error, got %v", name, err)
+		}
+	}
+}
+
+func TestCollection_SearchDistanceThreshold(t *testing.T) {
+	cm, err := NewCollectionManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	if err := cm.CreateCollection("thr", 2, types.MetricL2); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	if err := cm.CreateCollection("dot", 2, types.MetricIP); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	coll, _ := cm.GetCollection("thr")
+	dot, _ := cm.GetCollection("dot")
+	// Squared L2 distances from the origin range from 0 to 10000
+	for i := 0; i < 10; i++ {
+		v := float32(i * i)
+		coll.AppendBlock(fmt.Sprintf("k%d", i), &types.BlockData{Vector: []float32{v, 0}})
+		dot.AppendBlock(fmt.Sprintf("k%d", i), &types.BlockData{Vector: []float32{v, 0}})
+	}
+
+	results, err := coll.Search([]float32{0, 0}, 10, &types.SearchFilter{MaxDistance: 100})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results within distance 100, got %+v", results)
+	}
+	for _, r := range results {
+		if r.Distance > 100 {
+			t.Errorf("Result %s at distance %v exceeds the threshold", r.Key, r.Distance)
+		}
+	}
+
+	// topK still caps a threshold that many results satisfy
+	results, _ = coll.Search([]float32{0, 0}, 2, &types.SearchFilter{MaxDistance: 100})
+	if len(results) != 2 {
+		t.Errorf("Expected topK=2 results, got %d", len(results))
+	}
+	results, _ = coll.Search([]float32{1000, 1000}, 10, &types.SearchFilter{MaxDistance: 1})
+	if len(results) != 0 {
+		t.Errorf("Expected no results when every candidate is too far, got %+v", results)
+	}
+
+	// MinScore bounds the dot product for inner-product collections
+	results, err = dot.Search([]float32{1, 0}, 10, &types.SearchFilter{MinScore: 25})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 5 || results[len(results)-1].Key != "k5" {
+		t.Errorf("Expected k9..k5 with dot product >= 25, got %+v", results)
+	}
+}
+
+func TestCollection_DeleteKeyClearsPostings(t *testing.T) {
+	cm, err := NewCollectionManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	if err := cm.CreateCollection("kw", 2, types.MetricL2); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	coll, _ := cm.GetCollection("kw")
+	for i := 0; i < 3; i++ {
+		coll.AppendBlock("gone", &types.BlockData{Vector: []float32{float32(i), 0}, Keywords: []string{"shared", "unique"}})
+	}
+	coll.AppendBlock("kept", &types.BlockData{Vector: []float32{1, 1}, Keywords: []string{"shared"}})
+
+	if err := coll.DeleteKey("gone"); err != nil {
+		t.Fatalf("DeleteKey failed: %v", err)
+	}
+
+	ii := coll.KeywordIndex
+	if len(ii.docToKeys) != 1 {
+		t.Errorf("Expected only the kept block in the reverse map, got %d entries", len(ii.docToKeys))
+	}
+	if _, ok := ii.index["kw:unique"]; ok {
+		t.Error("Expected the postings list of a keyword used only by the deleted key to be dropped")
+	}
+	if got := ii.index["kw:shared"]; len(got) != 1 {
+		t.Errorf("Expected one posting for the shared keyword, got %v", got)
+	}
+	if !ii.SearchExact([]string{"unique"}).IsEmpty() {
+		t.Error("Expected no matches for a keyword of the deleted key")
+	}
+}
+
+func TestCollection_ListKeysWithPrefix(t *testing.T) {
+	dataPath := t.TempDir()
+	cm, err := NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.CreateCollection("keys", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	coll, err := cm.GetCollection("keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1000 keys under mixed, partly nested prefixes; every 7th is deleted again
+	var live []string
+	for i := 0; i < 1000; i++ {
+		key := [...]string{"user:%04d", "user:admin:%04d", "order:%04d", "%04d"}[i%4]
+		key = fmt.Sprintf(key, i)
+		if _, err := coll.AppendBlock(key, &types.BlockData{Primary: key}); err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+		if i%10 == 0 { // A second block must not list the key twice
+			if _, err := coll.AppendBlock(key, &types.BlockData{Primary: key}); err != nil {
+				t.Fatalf("AppendBlock failed: %v", err)
+			}
+		}
+		if i%7 == 0 {
+			if err := coll.DeleteKey(key); err != nil {
+				t.Fatalf("DeleteKey failed: %v", err)
+			}
+			continue
+		}
+		live = append(live, key)
+	}
+
+	check := func(coll *Collection) {
+		t.Helper()
+		for _, prefix := range []string{"user:", "user:admin:", "order:", "order:00", "0", "u", "", "missing"} {
+			want := []string{}
+			for _, key := range live {
+				if strings.HasPrefix(key, prefix) {
+					want = append(want, key)
+				}
+			}
+			sort.Strings(want)
+			if got := coll.ListKeysWithPrefix(prefix); !slices.Equal(got, want) {
+				t.Errorf("Prefix %q: expected %d keys, got %d", prefix, len(want), len(got))
+			}
+		}
+	}
+	check(coll)
+
+	// The sorted key list is rebuilt on load
+	if err := cm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cm, err = NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	coll, err = cm.GetCollection("keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(coll)
+}
+
+func TestCollection_ListKeysPaged(t *testing.T) {
+	cm, err := NewCollectionManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	if err := cm.CreateCollection("paged", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	coll, err := cm.GetCollection("paged")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10000
+	want := make([]string, 0, n)
+	for i := range n {
+		key := fmt.Sprintf("%s:%05d", [...]string{"user", "order"}[i%2], n-i)
+		if _, err := coll.AppendBlock(key, &types.BlockData{Primary: key}); err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+		want = append(want, key)
+	}
+	sort.Strings(want)
+
+	paginate := func(prefix string, limit int) []string {
+		t.Helper()
+		var all []string
+		after := ""
+		for pages := 0; ; pages++ {
+			if pages > n {
+				t.Fatal("Paginator does not terminate")
+			}
+			keys, hasMore := coll.ListKeysPaged(prefix, after, limit)
+			if len(keys) > limit || hasMore && len(keys) != limit {
+				t.Fatalf("Page of %d keys with hasMore %v at limit %d", len(keys), hasMore, limit)
+			}
+			all = append(all, keys...)
+			if !hasMore {
+				return all
+			}
+			after = keys[len(keys)-1]
+		}
+	}
+	for _, limit := range []int{1, 7, 100, n / 2, n, 2 * n} {
+		if got := paginate("", limit); !slices.Equal(got, want) {
+			t.Errorf("Limit %d: paginated %d keys, want all %d in order", limit, len(got), len(want))
+		}
+	}
+	if got := paginate("user:", 100); !slices.Equal(got, want[n/2:]) {
+		t.Errorf("Prefix user: paginated %d keys, want %d", len(got), n/2)
+	}
+
+	// A limit that ends exactly at the last matching key has no more pages
+	keys, hasMore := coll.ListKeysPaged("order:", "", n/2)
+	if len(keys) != n/2 || hasMore {
+		t.Errorf("Exact page: %d keys, hasMore %v", len(keys), hasMore)
+	}
+	// afterKey need not exist, nor start with the prefix
+	if keys, _ := coll.ListKeysPaged("user:", "a", 1); len(keys) != 1 || keys[0] != want[n/2] {
+		t.Errorf("Page after a = %v, want [%s]", keys, want[n/2])
+	}
+	if keys, hasMore := coll.ListKeysPaged("order:", "order:99999", 10); len(keys) != 0 || hasMore {
+		t.Errorf("Page past the end = %v, %v", keys, hasMore)
+	}
+}
+
+func TestCollectionManager_RenameCollection(t *testing.T) {
+	dataPath := t.TempDir()
+	cm, err := NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { cm.Close() }()
+	for _, name := range []string{"old", "other"} {
+		if err := cm.CreateCollection(name, 4, types.MetricL2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	coll, _ := cm.GetCollection("old")
+	if _, err := coll.AppendBlock("doc", &types.BlockData{Primary: "p", Vector: []float32{1, 0, 0, 0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cm.RenameCollection("old", "other"); err == nil {
+		t.Error("Expected renaming onto an existing collection to fail")
+	}
+	if err := cm.RenameCollection("missing", "new"); err == nil {
+		t.Error("Expected renaming a missing collection to fail")
+	}
+	if err := cm.RenameCollection("old", "new"); err != nil {
+		t.Fatalf("RenameCollection failed: %v", err)
+	}
+	if _, err := cm.GetCollection("old"); err == nil {
+		t.Error("Expected the old name to be gone")
+	}
+	if _, err := os.Stat(filepath.Join(dataPath, "indexes", "old")); !os.IsNotExist(err) {
+		t.Errorf("Expected the old directory to be gone, got %v", err)
+	}
+	if _, err := coll.Search([]float32{1, 0, 0, 0}, 1, nil); err != ErrClosing {
+		t.Errorf("Expected the old handle to be closed, got %v", err)
+	}
+
+	// The new name is served and survives a restart
+	for range 2 {
+		renamed, err := cm.GetCollection("new")
+		if err != nil {
+			t.Fatalf("Expected the new name to be present: %v", err)
+		}
+		results, err := renamed.Search([]float32{1, 0, 0, 0}, 1, nil)
+		if err != nil || len(results) != 1 || results[0].Key != "doc" {
+			t.Fatalf("Search after rename = %+v, %v", results, err)
+		}
+		cm.Close()
+		if cm, err = NewCollectionManager(dataPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names := len(cm.ListCollections()); names != 2 {
+		t.Errorf("Expected 2 collections, got %d", names)
+	}
+}
+
+func TestCollectionManager_CopyCollection(t *testing.T) {
+	cm, err := NewCollectionManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	if err := cm.CreateCollection("src", 4, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	src, _ := cm.GetCollection("src")
+	if _, err := src.AppendBlock("doc", &types.BlockData{Primary: "p", Vector: []float32{1, 0, 0, 0}, Keywords: []string{"kw"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cm.CopyCollection("src", "src"); err == nil {
+		t.Error("Expected copying onto an existing collection to fail")
+	}
+	if err := cm.CopyCollection("src", "dst"); err != nil {
+		t.Fatalf("CopyCollection failed: %v", err)
+	}
+	dst, err := cm.GetCollection("dst")
+	if err != nil {
+		t.Fatalf("Expected the copy to be present: %v", err)
+	}
+	if dst.Config.Name != "dst" || dst.Count() != 1 {
+		t.Errorf("Copy has name %q and %d vectors", dst.Config.Name, dst.Count())
+	}
+
+	// Both stay accessible and change independently
+	if _, err := dst.AppendBlock("doc2", &types.BlockData{Vector: []float32{0, 1, 0, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	if src.Count() != 1 || dst.Count() != 2 {
+		t.Errorf("Expected 1 vector in src and 2 in dst, got %d and %d", src.Count(), dst.Count())
+	}
+	for _, coll := range []*Collection{src, dst} {
+		results, err := coll.Search([]float32{1, 0, 0, 0}, 1, nil)
+		if err != nil || len(results) != 1 || results[0].Key != "doc" {
+			t.Errorf("Search on %s = %+v, %v", coll.Config.Name, results, err)
+		}
+	}
+}
+
+func TestCollection_LockBlocksWrites(t *testing.T) {
+	coll := newBenchCollection(t)
+	if _, err := coll.AppendBlock("a", &types.BlockData{Vector: []float32{1, 2, 3, 4}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// appendWhile checks that an append waits for the freeze taken by lock
+	appendWhile := func(lock, unlock func()) {
+		t.Helper()
+		lock()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if _, err := coll.AppendBlock("b", &types.BlockData{Vector: []float32{4, 3, 2, 1}}); err != nil {
+				t.Error(err)
+			}
+		}()
+		select {
+		case <-done:
+			t.Error("AppendBlock completed while the collection was locked")
+		case <-time.After(100 * time.Millisecond):
+		}
+		unlock()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("AppendBlock did not complete after unlock")
+		}
+	}
+
+	appendWhile(coll.Lock, coll.Unlock)
+	appendWhile(func() {
+		coll.RLock()
+		// Reads proceed under a read freeze
+		if _, err := coll.Search([]float32{1, 2, 3, 4}, 1, nil); err != nil {
+			t.Error(err)
+		}
+		if n, err := coll.GetKeyLength("a"); err != nil || n != 1 {
+			t.Errorf("GetKeyLength = %d, %v", n, err)
+		}
+	}, coll.RUnlock)
+
+	if n, _ := coll.GetKeyLength("b"); n != 2 {
+		t.Errorf("Expected both appends to land, got %d blocks", n)
+	}
+}
+
+func TestCollection_KeyBloom(t *testing.T) {
+	dataPath := t.TempDir()
+	cm, err := NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.CreateCollection("keys", 4, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	coll, _ := cm.GetCollection("keys")
+
+	const n = 100_000
+	for i := range n {
+		if _, err := coll.AppendBlock(fmt.Sprintf("key:%d", i), &types.BlockData{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Deleting from the back keeps the forward index deletes cheap
+	for i := n - 2; i >= 0; i -= 2 {
+		if err := coll.DeleteKey(fmt.Sprintf("key:%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, i := range []int{0, 1, n - 2, n - 1} {
+		if got, want := coll.ContainsKey(fmt.Sprintf("key:%d", i)), i%2 == 1; got != want {
+			t.Errorf("ContainsKey(key:%d) = %v, want %v", i, got, want)
+		}
+	}
+
+	// falsePositiveRate probes the filter with keys that were never added
+	falsePositiveRate := func(bf *BloomFilter) float64 {
+		positives := 0
+		for i := range n {
+			if bf.MayContain(fmt.Sprintf("absent:%d", i)) {
+				positives++
+			}
+		}
+		return float64(positives) / n
+	}
+	if rate := falsePositiveRate(coll.keyBloom.Load()); rate >= 0.01 {
+		t.Errorf("False-positive rate %.4f, want below 0.01", rate)
+	}
+
+	// The filter is saved with the collection and loaded as is
+	if err := coll.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(filepath.Join(dataPath, "indexes", "keys", "keys.bloom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := coll.keyBloom.Load().added.Load()
+	if _, err := coll.AppendBlock("late", &types.BlockData{}); err != nil {
+		t.Fatal(err)
+	}
+	cm.Close()
+
+	cm, err = NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coll, _ = cm.GetCollection("keys")
+	if got := coll.keyBloom.Load().added.Load(); got != added+1 {
+		t.Errorf("Expected the saved filter with %d keys, got %d", added+1, got)
+	}
+	if rate := falsePositiveRate(coll.keyBloom.Load()); rate >= 0.01 {
+		t.Errorf("False-positive rate after reload %.4f, want below 0.01", rate)
+	}
+	cm.Close()
+
+	// A filter older than the forward index would miss "late", so it is
+	// rebuilt instead
+	if err := os.WriteFile(filepath.Join(dataPath, "indexes", "keys", "keys.bloom"), saved, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cm, err = NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	coll, _ = cm.GetCollection("keys")
+	if !coll.ContainsKey("late") || !coll.ContainsKey("key:1") || coll.ContainsKey("key:0") {
+		t.Error("ContainsKey is wrong after rebuilding a stale filter")
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// benchDims covers common embedding sizes, from toy vectors up to 3072-d models.
+var benchDims = []int{8, 32, 128, 384, 768, 1536, 3072}
+
+// distanceSink keeps the compiler from eliding distance calls.
+var distanceSink float32
+
+func randomVector(rng *rand.Rand, dim int) []float32 {
+	v := make([]float32, dim)
+	for i := range v {
+		v[i] = rng.Float32()*2 - 1
+	}
+	return v
+}
+
+// benchmarkDistance reports ns/op, MB/s (one vector's bytes per op) and vectors/s
+// for fn at each dimension. Dimensions where MB/s stays flat as dim grows are
+// compute-bound and gain the most from SIMD.
+func benchmarkDistance(b *testing.B, fn func(a, b []float32) float32) {
+	for _, dim := range benchDims {
+		b.Run(fmt.Sprintf("dim=%d", dim), func(b *testing.B) {
+			rng := rand.New(rand.NewSource(int64(dim)))
+			x, y := randomVector(rng, dim), randomVector(rng, dim)
+			b.SetBytes(int64(dim * 4))
+			b.ResetTimer()
+
+			var d float32
+			for i := 0; i < b.N; i++ {
+				d += fn(x, y)
+			}
+			distanceSink = d
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "vectors/s")
+		})
+	}
+}
+
+func BenchmarkDistanceL2(b *testing.B)     { benchmarkDistance(b, distanceL2) }
+func BenchmarkDistanceCosine(b *testing.B) { benchmarkDistance(b, distanceCosine) }
+func BenchmarkDistanceIP(b *testing.B)     { benchmarkDistance(b, distanceIP) }
+
+// BenchmarkDistanceL2_Sparsity runs the dense L2 kernel on vectors with a given
+// fraction of zero components. There is no sparse distance yet; this is the
+// baseline a sparse representation has to beat.
+func BenchmarkDistanceL2_Sparsity(b *testing.B) {
+	const dim = 1536
+	for _, sparsity := range []float64{0, 0.5, 0.9, 0.99} {
+		b.Run(fmt.Sprintf("zeros=%.0f%%", sparsity*100), func(b *testing.B) {
+			rng := rand.New(rand.NewSource(1))
+			x, y := randomVector(rng, dim), randomVector(rng, dim)
+			for i := range x {
+				if rng.Float64() < sparsity {
+					x[i] = 0
+				}
+				if rng.Float64() < sparsity {
+					y[i] = 0
+				}
+			}
+			b.SetBytes(int64(dim * 4))
+			b.ResetTimer()
+
+			var d float32
+			for i := 0; i < b.N; i++ {
+				d += distanceL2(x, y)
+			}
+			distanceSink = d
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "vectors/s")
+		})
+	}
+}
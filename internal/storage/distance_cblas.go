@@ -0,0 +1,35 @@
+//go:build cblas
+
+package storage
+
+// CBLAS reference kernels for comparing the scalar distance functions against
+// an optimized BLAS. Build with -tags cblas and a CBLAS library installed
+// (e.g. libopenblas-dev or libatlas-base-dev).
+
+/*
+#cgo LDFLAGS: -lcblas
+#include <cblas.h>
+*/
+import "C"
+
+import "unsafe"
+
+// cblasDot returns the inner product of a and b using cblas_sdot.
+func cblasDot(a, b []float32) float32 {
+	if len(a) == 0 {
+		return 0
+	}
+	return float32(C.cblas_sdot(C.int(len(a)),
+		(*C.float)(unsafe.Pointer(&a[0])), 1,
+		(*C.float)(unsafe.Pointer(&b[0])), 1))
+}
+
+// cblasDistanceIP matches distanceIP.
+func cblasDistanceIP(a, b []float32) float32 {
+	return -cblasDot(a, b)
+}
+
+// cblasDistanceL2 matches distanceL2 using |a|^2 + |b|^2 - 2a·b.
+func cblasDistanceL2(a, b []float32) float32 {
+	return cblasDot(a, a) + cblasDot(b, b) - 2*cblasDot(a, b)
+}
@@ -0,0 +1,10 @@
+//go:build cblas
+
+package storage
+
+import "testing"
+
+// Run with: go test -tags cblas -bench 'Distance' ./internal/storage/
+
+func BenchmarkDistanceCBLAS_L2(b *testing.B) { benchmarkDistance(b, cblasDistanceL2) }
+func BenchmarkDistanceCBLAS_IP(b *testing.B) { benchmarkDistance(b, cblasDistanceIP) }
@@ -6,8 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"io"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"waddlemap/internal/types"
@@ -17,6 +21,14 @@ const (
 	// CurrentHeaderSize is the current version's header size in bytes.
 	CurrentHeaderSize = 18
 
+	// ExpiryHeaderSize is the header size of entries that carry an expiry
+	// timestamp after the CRC.
+	ExpiryHeaderSize = 26
+
+	// VersionHeaderSize is the header size of entries that carry a version
+	// after the expiry timestamp.
+	VersionHeaderSize = 34
+
 	// MaxKeyLength is the maximum key length in bytes (65KB).
 	MaxKeyLength = 65535
 
@@ -27,6 +39,10 @@ const (
 	MaxKeywordsBlockSize = 65535
 )
 
+// streamSectionChunk is the most DecodeEntryStream allocates for a section
+// ahead of reading it.
+const streamSectionChunk = 1 << 20
+
 // Entry represents a complete database entry with vector store support.
 type Entry struct {
 	Flags         types.EntryFlags
@@ -34,17 +50,39 @@ type Entry struct {
 	Keywords      []string
 	PrimaryData   []byte
 	SecondaryData []byte // VectorID bytes for vector entries
+	ExpiresAt     int64  // Unix time after which the entry is expired (0 = never)
+	Version       uint64 // Number of updates of the block (0 = never updated)
+}
+
+// ErrExpired is returned when reading a block whose TTL has passed.
+var ErrExpired = errors.New("block has expired")
+
+// Expired reports whether the entry's expiry time has passed. Expiry times have
+// one-second resolution, so a block lives for at least its full TTL.
+func (e *Entry) Expired(now time.Time) bool {
+	return e.ExpiresAt != 0 && now.Unix() > e.ExpiresAt
+}
+
+// remainingTTL returns the seconds left until the entry expires, or 0 if it
+// never does.
+func (e *Entry) remainingTTL(now time.Time) int64 {
+	if e.ExpiresAt == 0 {
+		return 0
+	}
+	return max(1, e.ExpiresAt-now.Unix())
 }
 
 // EntryHeader represents the on-disk entry header (18 bytes minimum).
 type EntryHeader struct {
-	HeaderSize   uint8  // Byte 0: Total header size (currently 18)
+	HeaderSize   uint8  // Byte 0: Total header size (18, 26 with an expiry or 34 with a version)
 	Flags        uint8  // Byte 1: Bitmask for data types and state
 	KeyLen       uint16 // Bytes 2-3: Length of key
 	PrimaryLen   uint32 // Bytes 4-7: Length of primary data
 	SecondaryLen uint32 // Bytes 8-11: Length of secondary data
 	KwLen        uint16 // Bytes 12-13: Length of serialized keywords block
 	CRC32        uint32 // Bytes 14-17: Checksum of entire entry
+	ExpiresAt    int64  // Bytes 18-25: Unix expiry time (26 and 34-byte headers)
+	Version      uint64 // Bytes 26-33: Update count (34-byte headers only)
 }
 
 // keywordRegex validates keyword characters (a-z, 0-9, _, -).
@@ -52,6 +90,45 @@ var keywordRegex = regexp.MustCompile(`^[a-z0-9_-]+$`)
 
 // ValidateKeyword checks if a keyword meets the specification requirements.
 func ValidateKeyword(keyword string) error {
+	if err := checkKeywordLength(keyword); err != nil {
+		return err
+	}
+	normalized := strings.ToLower(keyword)
+	if !keywordRegex.MatchString(normalized) {
+		return errors.New("keyword may only contain a-z, 0-9, underscore, and dash")
+	}
+	return nil
+}
+
+// ValidateKeywordMode checks a keyword of a collection using the given
+// tokenization mode. The n-gram mode allows the characters ValidateKeyword
+// does. The cjk_char mode also allows letters and digits of any script, and
+// the whitespace mode single spaces between words as well.
+func ValidateKeywordMode(keyword, mode string) error {
+	switch mode {
+	case "", TokenizeNGram:
+		return ValidateKeyword(keyword)
+	case TokenizeCJKChar, TokenizeWhitespace:
+	default:
+		return fmt.Errorf("unknown tokenization mode %q", mode)
+	}
+	if err := checkKeywordLength(keyword); err != nil {
+		return err
+	}
+	if mode == TokenizeWhitespace && strings.Join(strings.Fields(keyword), " ") != keyword {
+		return errors.New("keyword words must be separated by single spaces")
+	}
+	for _, r := range keyword {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && (r != ' ' || mode != TokenizeWhitespace) {
+			return fmt.Errorf("keyword may not contain %q", r)
+		}
+	}
+	return nil
+}
+
+// checkKeywordLength checks the length and encoding of a keyword, which
+// every tokenization mode requires.
+func checkKeywordLength(keyword string) error {
 	if len(keyword) == 0 {
 		return errors.New("keyword cannot be empty")
 	}
@@ -61,10 +138,6 @@ func ValidateKeyword(keyword string) error {
 	if !utf8.ValidString(keyword) {
 		return errors.New("keyword must be valid UTF-8")
 	}
-	normalized := strings.ToLower(keyword)
-	if !keywordRegex.MatchString(normalized) {
-		return errors.New("keyword may only contain a-z, 0-9, underscore, and dash")
-	}
 	return nil
 }
 
@@ -73,7 +146,9 @@ func NormalizeKeyword(keyword string) string {
 	return strings.ToLower(keyword)
 }
 
-// EncodeKeywords serializes keywords into the binary format.
+// EncodeKeywords serializes keywords into the binary format. Only their
+// length and encoding are checked; the characters a keyword may contain
+// depend on the tokenization mode of its collection (see ValidateKeywordMode).
 // Format: [Count (2B)] [Len1 (1B)][Keyword1 Bytes] [Len2 (1B)][Keyword2 Bytes] ...
 func EncodeKeywords(keywords []string) ([]byte, error) {
 	if len(keywords) > 65535 {
@@ -90,7 +165,7 @@ func EncodeKeywords(keywords []string) ([]byte, error) {
 	// Write each keyword
 	for _, kw := range keywords {
 		normalized := NormalizeKeyword(kw)
-		if err := ValidateKeyword(normalized); err != nil {
+		if err := checkKeywordLength(normalized); err != nil {
 			return nil, fmt.Errorf("invalid keyword %q: %w", kw, err)
 		}
 		kwBytes := []byte(normalized)
@@ -123,14 +198,16 @@ func DecodeKeywords(data []byte) ([]string, error) {
 		return nil, err
 	}
 
-	keywords := make([]string, 0, count)
+	// Every keyword takes at least its length byte, so a corrupt count cannot
+	// reserve more than the data holds
+	keywords := make([]string, 0, min(int(count), buf.Len()))
 	for i := uint16(0); i < count; i++ {
 		lenByte, err := buf.ReadByte()
 		if err != nil {
 			return nil, fmt.Errorf("failed to read keyword length at index %d: %w", i, err)
 		}
 		kwBytes := make([]byte, lenByte)
-		if _, err := buf.Read(kwBytes); err != nil {
+		if _, err := io.ReadFull(buf, kwBytes); err != nil {
 			return nil, fmt.Errorf("failed to read keyword at index %d: %w", i, err)
 		}
 		keywords = append(keywords, string(kwBytes))
@@ -139,6 +216,19 @@ func DecodeKeywords(data []byte) ([]string, error) {
 	return keywords, nil
 }
 
+// entryHeaderSize returns the header size EncodeEntry writes for entry.
+// Entries without an expiry or version keep the original 18-byte header.
+func entryHeaderSize(entry *Entry) int {
+	switch {
+	case entry.Version != 0:
+		return VersionHeaderSize
+	case entry.ExpiresAt != 0:
+		return ExpiryHeaderSize
+	default:
+		return CurrentHeaderSize
+	}
+}
+
 // EncodeEntry serializes an Entry to the on-disk binary format.
 func EncodeEntry(entry *Entry) ([]byte, error) {
 	// Encode keywords
@@ -152,19 +242,23 @@ func EncodeEntry(entry *Entry) ([]byte, error) {
 		return nil, fmt.Errorf("key exceeds maximum length of %d bytes", MaxKeyLength)
 	}
 
+	headerSize := entryHeaderSize(entry)
+
 	// Build header
 	header := EntryHeader{
-		HeaderSize:   CurrentHeaderSize,
+		HeaderSize:   uint8(headerSize),
 		Flags:        types.EncodeFlags(entry.Flags),
 		KeyLen:       uint16(len(entry.Key)),
 		PrimaryLen:   uint32(len(entry.PrimaryData)),
 		SecondaryLen: uint32(len(entry.SecondaryData)),
 		KwLen:        uint16(len(kwBytes)),
 		CRC32:        0, // Will be calculated after
+		ExpiresAt:    entry.ExpiresAt,
+		Version:      entry.Version,
 	}
 
 	// Calculate total size
-	totalSize := int(CurrentHeaderSize) + len(entry.Key) + len(kwBytes) +
+	totalSize := headerSize + len(entry.Key) + len(kwBytes) +
 		len(entry.PrimaryData) + len(entry.SecondaryData)
 	buf := make([]byte, 0, totalSize)
 	bufWriter := bytes.NewBuffer(buf)
@@ -177,6 +271,12 @@ func EncodeEntry(entry *Entry) ([]byte, error) {
 	binary.Write(bufWriter, binary.BigEndian, header.SecondaryLen)
 	binary.Write(bufWriter, binary.BigEndian, header.KwLen)
 	binary.Write(bufWriter, binary.BigEndian, header.CRC32) // placeholder
+	if headerSize >= ExpiryHeaderSize {
+		binary.Write(bufWriter, binary.BigEndian, header.ExpiresAt)
+	}
+	if headerSize == VersionHeaderSize {
+		binary.Write(bufWriter, binary.BigEndian, header.Version)
+	}
 
 	// Write data
 	bufWriter.Write(entry.Key)
@@ -199,6 +299,9 @@ func DecodeEntryHeader(data []byte) (*EntryHeader, error) {
 	}
 
 	headerSize := data[0]
+	if headerSize < CurrentHeaderSize {
+		return nil, fmt.Errorf("unsupported header size: %d", headerSize)
+	}
 	if int(headerSize) > len(data) {
 		return nil, errors.New("header size exceeds data length")
 	}
@@ -212,6 +315,12 @@ func DecodeEntryHeader(data []byte) (*EntryHeader, error) {
 		KwLen:        binary.BigEndian.Uint16(data[12:14]),
 		CRC32:        binary.BigEndian.Uint32(data[14:18]),
 	}
+	if headerSize >= ExpiryHeaderSize {
+		header.ExpiresAt = int64(binary.BigEndian.Uint64(data[18:26]))
+	}
+	if headerSize >= VersionHeaderSize {
+		header.Version = binary.BigEndian.Uint64(data[26:34])
+	}
 
 	return header, nil
 }
@@ -230,7 +339,7 @@ func DecodeEntry(data []byte) (*Entry, error) {
 	binary.BigEndian.PutUint32(dataCopy[14:18], 0) // Zero out CRC for calculation
 	calculatedCRC := crc32.ChecksumIEEE(dataCopy)
 	if storedCRC != calculatedCRC {
-		return nil, fmt.Errorf("CRC mismatch: stored=%08x calculated=%08x", storedCRC, calculatedCRC)
+		return nil, &types.ChecksumMismatchError{Expected: storedCRC, Actual: calculatedCRC}
 	}
 
 	// Calculate offsets
@@ -262,6 +371,92 @@ func DecodeEntry(data []byte) (*Entry, error) {
 		Keywords:      keywords,
 		PrimaryData:   primaryData,
 		SecondaryData: secondaryData,
+		ExpiresAt:     header.ExpiresAt,
+		Version:       header.Version,
+	}, nil
+}
+
+// DecodeEntryStream deserializes an Entry by reading each section from r
+// sequentially, avoiding a full copy of the encoded entry.
+// The CRC is computed incrementally over all bytes as they are read.
+func DecodeEntryStream(r io.Reader) (*Entry, error) {
+	hasher := crc32.NewIEEE()
+
+	headerBuf := make([]byte, VersionHeaderSize)
+	if _, err := io.ReadFull(r, headerBuf[:CurrentHeaderSize]); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	switch headerBuf[0] {
+	case CurrentHeaderSize:
+		headerBuf = headerBuf[:CurrentHeaderSize]
+	case ExpiryHeaderSize, VersionHeaderSize:
+		headerBuf = headerBuf[:headerBuf[0]]
+		if _, err := io.ReadFull(r, headerBuf[CurrentHeaderSize:]); err != nil {
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported header size: %d", headerBuf[0])
+	}
+	header, err := DecodeEntryHeader(headerBuf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash the header with the CRC field zeroed, matching EncodeEntry.
+	binary.BigEndian.PutUint32(headerBuf[14:18], 0)
+	hasher.Write(headerBuf)
+
+	// Sections are read in chunks so that a corrupt length cannot allocate
+	// much more memory than the data that actually follows
+	readSection := func(n int, name string) ([]byte, error) {
+		section := make([]byte, 0, min(n, streamSectionChunk))
+		for len(section) < n {
+			chunk := min(n-len(section), streamSectionChunk)
+			section = slices.Grow(section, chunk)
+			read, err := io.ReadFull(r, section[len(section):len(section)+chunk])
+			section = section[:len(section)+read]
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+		}
+		hasher.Write(section)
+		return section, nil
+	}
+
+	key, err := readSection(int(header.KeyLen), "key")
+	if err != nil {
+		return nil, err
+	}
+	kwData, err := readSection(int(header.KwLen), "keywords")
+	if err != nil {
+		return nil, err
+	}
+	primaryData, err := readSection(int(header.PrimaryLen), "primary data")
+	if err != nil {
+		return nil, err
+	}
+	secondaryData, err := readSection(int(header.SecondaryLen), "secondary data")
+	if err != nil {
+		return nil, err
+	}
+
+	if calculatedCRC := hasher.Sum32(); calculatedCRC != header.CRC32 {
+		return nil, &types.ChecksumMismatchError{Expected: header.CRC32, Actual: calculatedCRC}
+	}
+
+	keywords, err := DecodeKeywords(kwData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode keywords: %w", err)
+	}
+
+	return &Entry{
+		Flags:         types.ParseFlags(header.Flags),
+		Key:           key,
+		Keywords:      keywords,
+		PrimaryData:   primaryData,
+		SecondaryData: secondaryData,
+		ExpiresAt:     header.ExpiresAt,
+		Version:       header.Version,
 	}, nil
 }
 
@@ -271,6 +466,6 @@ func CalculateTotalSize(entry *Entry) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return CurrentHeaderSize + len(entry.Key) + len(kwBytes) +
+	return entryHeaderSize(entry) + len(entry.Key) + len(kwBytes) +
 		len(entry.PrimaryData) + len(entry.SecondaryData), nil
 }
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"waddlemap/internal/types"
+)
+
+// fuzzSeedEntries are valid entries covering the edges of the format.
+func fuzzSeedEntries() []*Entry {
+	// The most keywords that fit in a keywords block: one byte each plus a
+	// length byte, after the 2-byte count
+	maxKeywords := make([]string, (MaxKeywordsBlockSize-2)/2)
+	for i := range maxKeywords {
+		maxKeywords[i] = string(rune('a' + i%26))
+	}
+	return []*Entry{
+		{},
+		{Key: []byte("doc"), Keywords: []string{}, PrimaryData: []byte("payload")},
+		{Key: []byte("doc"), Keywords: []string{"hello", "world"}, PrimaryData: []byte("payload")},
+		{
+			Flags:         types.EntryFlags{DataType: types.DataTypeVector, Compressed: true},
+			Key:           []byte("vec"),
+			Keywords:      []string{strings.Repeat("k", MaxKeywordLength)},
+			PrimaryData:   []byte(strings.Repeat("x", 4096)),
+			SecondaryData: VectorIDToBytes(7),
+		},
+		{Key: []byte("expiring"), Keywords: []string{"ttl"}, ExpiresAt: 1700000000},
+		{Flags: types.EntryFlags{Tombstone: true}, Key: []byte("gone"), Keywords: maxKeywords},
+		{Key: bytes.Repeat([]byte{0xff}, MaxKeyLength), Keywords: []string{"big-key"}},
+	}
+}
+
+// entriesEqual compares entries treating nil and empty slices alike.
+func entriesEqual(a, b *Entry) bool {
+	return a.Flags == b.Flags && bytes.Equal(a.Key, b.Key) && slices.Equal(a.Keywords, b.Keywords) &&
+		bytes.Equal(a.PrimaryData, b.PrimaryData) && bytes.Equal(a.SecondaryData, b.SecondaryData) &&
+		a.ExpiresAt == b.ExpiresAt
+}
+
+func normalizeKeywords(keywords []string) []string {
+	normalized := make([]string, len(keywords))
+	for i, kw := range keywords {
+		normalized[i] = NormalizeKeyword(kw)
+	}
+	return normalized
+}
+
+func FuzzDecodeEntry(f *testing.F) {
+	for _, entry := range fuzzSeedEntries() {
+		encoded, err := EncodeEntry(entry)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(encoded)
+	}
+	f.Add(make([]byte, CurrentHeaderSize))
+	f.Add([]byte{ExpiryHeaderSize, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		entry, err := DecodeEntry(data)
+		streamed, streamErr := DecodeEntryStream(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// The stream decoder only checksums the sections, so it agrees with
+		// DecodeEntry on entries without trailing bytes
+		if streamErr == nil && !entriesEqual(entry, streamed) {
+			t.Fatalf("DecodeEntryStream = %+v, DecodeEntry = %+v", streamed, entry)
+		}
+
+		// Decoded keywords need not be valid, in which case the entry
+		// cannot be encoded again, nor lowercase, which encoding fixes
+		encoded, err := EncodeEntry(entry)
+		if err != nil {
+			return
+		}
+		decoded, err := DecodeEntry(encoded)
+		if err != nil {
+			t.Fatalf("DecodeEntry of re-encoded entry: %v", err)
+		}
+		entry.Keywords = normalizeKeywords(entry.Keywords)
+		if !entriesEqual(entry, decoded) {
+			t.Fatalf("Round trip changed entry: got %+v, want %+v", decoded, entry)
+		}
+	})
+}
+
+func FuzzDecodeKeywords(f *testing.F) {
+	for _, entry := range fuzzSeedEntries() {
+		encoded, err := EncodeKeywords(entry.Keywords)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(encoded)
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0})
+	f.Add([]byte{0xff, 0xff})         // Count far beyond the data
+	f.Add([]byte{0, 1, 0xff, 'a'})    // Length beyond the data
+	f.Add([]byte{0, 2, 0, 1, 'a'})    // Empty keyword
+	f.Add([]byte{0, 1, 2, 'A', 0xc3}) // Invalid keyword bytes
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		keywords, err := DecodeKeywords(data)
+		if err != nil {
+			return
+		}
+		encoded, err := EncodeKeywords(keywords)
+		if err != nil {
+			return
+		}
+		decoded, err := DecodeKeywords(encoded)
+		if err != nil {
+			t.Fatalf("DecodeKeywords of re-encoded keywords: %v", err)
+		}
+		if want := normalizeKeywords(keywords); !slices.Equal(want, decoded) {
+			t.Fatalf("Round trip changed keywords: got %q, want %q", decoded, want)
+		}
+	})
+}
+
+func FuzzGenerateTrigrams(f *testing.F) {
+	for _, seed := range []string{"", "ab", "abc", "finance", "FINANCE", "数据库", "a\xffb\xfec", strings.Repeat("k", MaxKeywordLength)} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, keyword string) {
+		grams := GenerateTrigrams(keyword)
+		runes := []rune(strings.ToLower(keyword))
+		if len(runes) < 3 {
+			if len(grams) != 1 || grams[0] != strings.ToLower(keyword) {
+				t.Fatalf("GenerateTrigrams(%q) = %q, want the keyword itself", keyword, grams)
+			}
+			return
+		}
+		if len(grams) != len(runes)-2 {
+			t.Fatalf("GenerateTrigrams(%q) returned %d trigrams, want %d", keyword, len(grams), len(runes)-2)
+		}
+		// Consecutive trigrams overlap by two runes and spell the keyword
+		var spelled []rune
+		for i, gram := range grams {
+			if utf8.RuneCountInString(gram) != 3 {
+				t.Fatalf("Trigram %q of %q does not have 3 runes", gram, keyword)
+			}
+			gramRunes := []rune(gram)
+			if i == 0 {
+				spelled = append(spelled, gramRunes...)
+			} else {
+				spelled = append(spelled, gramRunes[2])
+			}
+		}
+		if !slices.Equal(spelled, runes) {
+			t.Fatalf("Trigrams %q do not spell %q", grams, keyword)
+		}
+	})
+}
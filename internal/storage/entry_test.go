@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestDecodeEntryStream_MatchesDecodeEntry(t *testing.T) {
+	entries := []*Entry{
+		{
+			Key:         []byte("doc1"),
+			Keywords:    []string{"hello", "world"},
+			PrimaryData: []byte("Hello World"),
+		},
+		{
+			Flags:         types.EntryFlags{DataType: types.DataTypeVector},
+			Key:           []byte("large"),
+			Keywords:      []string{},
+			PrimaryData:   []byte(strings.Repeat("x", 64*1024)),
+			SecondaryData: VectorIDToBytes(42),
+		},
+		{
+			Key:         []byte("expiring"),
+			Keywords:    []string{"ttl"},
+			PrimaryData: []byte("short-lived"),
+			ExpiresAt:   1700000000,
+		},
+		{
+			Key:         []byte("versioned"),
+			Keywords:    []string{},
+			PrimaryData: []byte("updated twice"),
+			Version:     2,
+		},
+	}
+
+	for _, original := range entries {
+		encoded, err := EncodeEntry(original)
+		if err != nil {
+			t.Fatalf("EncodeEntry failed: %v", err)
+		}
+
+		want, err := DecodeEntry(encoded)
+		if err != nil {
+			t.Fatalf("DecodeEntry failed: %v", err)
+		}
+		got, err := DecodeEntryStream(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("DecodeEntryStream failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("Stream decode mismatch for key %q", original.Key)
+		}
+		if want.ExpiresAt != original.ExpiresAt {
+			t.Errorf("ExpiresAt for key %q: got %d, want %d", original.Key, want.ExpiresAt, original.ExpiresAt)
+		}
+		if want.Version != original.Version {
+			t.Errorf("Version for key %q: got %d, want %d", original.Key, want.Version, original.Version)
+		}
+	}
+}
+
+func TestCalculateTotalSize_MatchesEncodeEntry(t *testing.T) {
+	for _, entry := range []*Entry{
+		{Key: []byte("plain"), Keywords: []string{"a"}, PrimaryData: []byte("data")},
+		{Key: []byte("expiring"), PrimaryData: []byte("data"), ExpiresAt: 1700000000},
+		{Key: []byte("versioned"), Keywords: []string{"b"}, PrimaryData: []byte("data"), Version: 3},
+		{Key: []byte("both"), PrimaryData: []byte("data"), SecondaryData: VectorIDToBytes(7), ExpiresAt: 1700000000, Version: 1},
+	} {
+		encoded, err := EncodeEntry(entry)
+		if err != nil {
+			t.Fatalf("EncodeEntry(%s) failed: %v", entry.Key, err)
+		}
+		size, err := CalculateTotalSize(entry)
+		if err != nil {
+			t.Fatalf("CalculateTotalSize(%s) failed: %v", entry.Key, err)
+		}
+		if size != len(encoded) {
+			t.Errorf("CalculateTotalSize(%s) = %d, EncodeEntry wrote %d bytes", entry.Key, size, len(encoded))
+		}
+	}
+}
+
+func TestDecodeEntryStream_CRCMismatch(t *testing.T) {
+	encoded, err := EncodeEntry(&Entry{Key: []byte("k"), PrimaryData: []byte("data")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded[len(encoded)-1] ^= 0xFF
+
+	_, err = DecodeEntryStream(bytes.NewReader(encoded))
+	var crcErr *types.ChecksumMismatchError
+	if !errors.Is(err, types.ErrChecksumMismatch) || !errors.As(err, &crcErr) || crcErr.Expected == crcErr.Actual {
+		t.Errorf("Expected a checksum mismatch, got %v", err)
+	}
+	if _, err := DecodeEntry(encoded); !errors.Is(err, types.ErrChecksumMismatch) {
+		t.Errorf("Expected DecodeEntry to report a checksum mismatch, got %v", err)
+	}
+}
+
+func TestDecodeEntry_Malformed(t *testing.T) {
+	if _, err := DecodeKeywords([]byte{0, 1, 5, 'a', 'b'}); err == nil {
+		t.Error("Expected an error for a keyword cut short")
+	}
+
+	encoded, err := EncodeEntry(&Entry{Key: []byte("k"), PrimaryData: []byte("data")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A header size overlapping the fixed fields, with a matching CRC
+	encoded[0] = 4
+	binary.BigEndian.PutUint32(encoded[14:18], 0)
+	binary.BigEndian.PutUint32(encoded[14:18], crc32.ChecksumIEEE(encoded))
+	if _, err := DecodeEntry(encoded); err == nil {
+		t.Error("Expected an error for a short header size")
+	}
+
+	// A huge section length must fail on the missing data, not allocate it
+	header := make([]byte, CurrentHeaderSize)
+	header[0] = CurrentHeaderSize
+	copy(header[4:8], []byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := DecodeEntryStream(bytes.NewReader(header)); err == nil {
+		t.Error("Expected an error for a truncated stream")
+	}
+}
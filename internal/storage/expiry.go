@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"waddlemap/internal/logger"
+)
+
+// DefaultExpirySweepInterval is the default period between sweeps for
+// expired blocks.
+const DefaultExpirySweepInterval = 10 * time.Second
+
+// ExpirySweeper periodically removes blocks whose TTL has passed. Keys whose
+// blocks have all expired are deleted; expired blocks of keys that still have
+// live blocks are dropped from the vector and keyword indexes. Reads hide
+// expired blocks between sweeps.
+type ExpirySweeper struct {
+	vm       *VectorManager
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewExpirySweeper creates a sweeper for the given vector manager.
+func NewExpirySweeper(vm *VectorManager, interval time.Duration) *ExpirySweeper {
+	if interval == 0 {
+		interval = DefaultExpirySweepInterval
+	}
+	return &ExpirySweeper{
+		vm:       vm,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start launches the background sweep goroutine.
+func (es *ExpirySweeper) Start() {
+	es.wg.Add(1)
+	go es.run()
+}
+
+// Stop signals the sweep goroutine to exit and waits for it.
+func (es *ExpirySweeper) Stop() {
+	close(es.stop)
+	es.wg.Wait()
+}
+
+func (es *ExpirySweeper) run() {
+	defer es.wg.Done()
+
+	ticker := time.NewTicker(es.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-es.stop:
+			return
+		case <-ticker.C:
+			es.Sweep()
+		}
+	}
+}
+
+// Sweep removes every block that has expired by now from all collections.
+// Returns the number of keys deleted and blocks purged.
+func (es *ExpirySweeper) Sweep() (keys, blocks int) {
+	now := time.Now().Unix()
+	for _, config := range es.vm.collections.ListCollections() {
+		coll, err := es.vm.collections.GetCollection(config.Name)
+		if err != nil {
+			continue
+		}
+		start := time.Now()
+		expiredKeys, expiredIDs := coll.ExpiredBlocks(now)
+		if es.vm.ReadOnly() {
+			expiredKeys = nil // A replica receives the primary's deletes
+		}
+		deleted := 0
+		for _, key := range expiredKeys {
+			if err := es.vm.DeleteKey(config.Name, key); err != nil {
+				if !errors.Is(err, ErrClosing) {
+					logger.Error("Deleting expired key %s in collection %s failed: %v", key, config.Name, err)
+				}
+				continue
+			}
+			deleted++
+		}
+		coll.PurgeBlocks(expiredIDs)
+
+		if deleted > 0 || len(expiredIDs) > 0 {
+			logger.InfoAttrs("expired blocks removed", "collection", config.Name,
+				"keys", deleted, "blocks", len(expiredIDs), "duration_ms", logger.Since(start))
+		}
+		keys += deleted
+		blocks += len(expiredIDs)
+	}
+	return keys, blocks
+}
@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"waddlemap/internal/types"
+)
+
+// Flat index binary format constants
+const (
+	flatMagic      = "FLATV001"
+	flatHeaderSize = 24
+)
+
+// VectorIndex is the primary vector index of a collection. It is implemented
+// by HNSWWrapper (approximate) and FlatIndex (exact).
+type VectorIndex interface {
+	Add(vectorID uint64, vector []float32) error
+	BatchAdd(items []struct {
+		ID     uint64
+		Vector []float32
+	}) error
+	Search(query []float32, k int, filter *BitSet) ([]HNSWSearchResult, error)
+	BatchSearch(queries [][]float32, k int, filter *BitSet) ([][]HNSWSearchResult, error)
+	RangeSearch(query []float32, radius float32, filter *BitSet) ([]HNSWSearchResult, error)
+	Delete(vectorID uint64) error
+	Save() error
+	Load() error
+	Close() error
+	Count() uint64
+	Contains(vectorID uint64) bool
+	GetVector(vectorID uint64) ([]float32, bool)
+	VectorIDs() []uint64
+	IsDirty() bool
+
+	// Renumber changes every vector ID to remap[ID], dropping vectors whose
+	// ID is not in remap. The index must be saved in full afterwards.
+	Renumber(remap map[uint64]uint64)
+}
+
+// FlatIndex stores vectors in a plain map and answers searches by scanning
+// all of them. It has no per-node graph overhead and exact recall, which
+// suits small collections and serves as a reference for HNSW.
+type FlatIndex struct {
+	vectors map[uint64][]float32
+
+	dimensions uint32
+	metric     types.DistanceMetric
+	filePath   string
+
+	dirty bool // Set on Add/Delete, cleared on Save
+	mu    sync.RWMutex
+}
+
+// NewFlatIndex creates an empty flat index persisted at filePath.
+func NewFlatIndex(dims uint32, metric types.DistanceMetric, filePath string) *FlatIndex {
+	return &FlatIndex{
+		vectors:    make(map[uint64][]float32),
+		dimensions: dims,
+		metric:     metric,
+		filePath:   filePath,
+	}
+}
+
+// Add inserts a vector with the given ID.
+func (fi *FlatIndex) Add(vectorID uint64, vector []float32) error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.addUnlocked(vectorID, vector)
+}
+
+// addUnlocked inserts a vector. Caller must hold fi.mu.
+func (fi *FlatIndex) addUnlocked(vectorID uint64, vector []float32) error {
+	if uint32(len(vector)) != fi.dimensions {
+		return &types.DimensionMismatchError{Subject: "vector", Expected: int(fi.dimensions), Actual: len(vector)}
+	}
+	if _, exists := fi.vectors[vectorID]; exists {
+		return &types.DuplicateIDError{ID: vectorID}
+	}
+	vec := make([]float32, len(vector))
+	copy(vec, vector)
+	fi.vectors[vectorID] = vec
+	fi.dirty = true
+	return nil
+}
+
+// BatchAdd inserts multiple vectors under a single lock, skipping invalid ones.
+func (fi *FlatIndex) BatchAdd(items []struct {
+	ID     uint64
+	Vector []float32
+}) error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	for _, item := range items {
+		if err := fi.addUnlocked(item.ID, item.Vector); err != nil {
+			continue
+		}
+	}
+	return nil
+}
+
+// Search returns the exact k nearest neighbors of query among the vectors
+// accepted by filter (all vectors if filter is nil or empty).
+func (fi *FlatIndex) Search(query []float32, k int, filter *BitSet) ([]HNSWSearchResult, error) {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	return fi.searchUnlocked(query, k, filter)
+}
+
+// searchUnlocked implements Search. Caller must hold fi.mu.
+func (fi *FlatIndex) searchUnlocked(query []float32, k int, filter *BitSet) ([]HNSWSearchResult, error) {
+	results, err := fi.scanUnlocked(query, float32(math.Inf(1)), filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// scanUnlocked returns every vector within radius of query that passes
+// filter, sorted by ascending distance. Caller must hold fi.mu.
+func (fi *FlatIndex) scanUnlocked(query []float32, radius float32, filter *BitSet) ([]HNSWSearchResult, error) {
+	if uint32(len(query)) != fi.dimensions {
+		return nil, &types.DimensionMismatchError{Subject: "query", Expected: int(fi.dimensions), Actual: len(query)}
+	}
+
+	hasFilter := filter != nil && !filter.IsEmpty()
+	results := make([]HNSWSearchResult, 0, len(fi.vectors))
+	for id, vec := range fi.vectors {
+		if hasFilter && !filter.Contains(id) {
+			continue
+		}
+		if dist := metricDistance(fi.metric, query, vec); dist <= radius {
+			results = append(results, HNSWSearchResult{VectorID: id, Distance: dist})
+		}
+	}
+	// Break distance ties by ID so results are deterministic
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].VectorID < results[j].VectorID
+	})
+	return results, nil
+}
+
+// BatchSearch runs every query against one read snapshot of the index.
+// Results are returned in query order.
+func (fi *FlatIndex) BatchSearch(queries [][]float32, k int, filter *BitSet) ([][]HNSWSearchResult, error) {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+
+	results := make([][]HNSWSearchResult, len(queries))
+	for i, q := range queries {
+		res, err := fi.searchUnlocked(q, k, filter)
+		if err != nil {
+			return nil, fmt.Errorf("query %d: %w", i, err)
+		}
+		results[i] = res
+	}
+	return results, nil
+}
+
+// RangeSearch returns every vector within radius of query, sorted by
+// ascending distance.
+func (fi *FlatIndex) RangeSearch(query []float32, radius float32, filter *BitSet) ([]HNSWSearchResult, error) {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	return fi.scanUnlocked(query, radius, filter)
+}
+
+// Delete removes a vector from the index.
+func (fi *FlatIndex) Delete(vectorID uint64) error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	if _, ok := fi.vectors[vectorID]; !ok {
+		return fmt.Errorf("vector ID %d not found", vectorID)
+	}
+	delete(fi.vectors, vectorID)
+	fi.dirty = true
+	return nil
+}
+
+// Renumber changes every vector ID to remap[ID], dropping vectors whose ID is
+// not in remap.
+func (fi *FlatIndex) Renumber(remap map[uint64]uint64) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	vectors := make(map[uint64][]float32, len(fi.vectors))
+	for id, vec := range fi.vectors {
+		if newID, ok := remap[id]; ok {
+			vectors[newID] = vec
+		}
+	}
+	fi.vectors = vectors
+	fi.dirty = true
+}
+
+// Save persists the index to disk. The file is a header holding the
+// dimensions, metric and vector count, followed by one
+// [VectorID(8)][float32 × dimensions] record per vector, in ID order.
+func (fi *FlatIndex) Save() error {
+	fi.mu.Lock() // Save clears the dirty flag
+	defer fi.mu.Unlock()
+
+	file, err := os.Create(fi.filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	header := make([]byte, flatHeaderSize)
+	copy(header[0:8], flatMagic)
+	binary.LittleEndian.PutUint32(header[8:12], fi.dimensions)
+	header[12] = metricToByte(fi.metric)
+	binary.LittleEndian.PutUint64(header[16:24], uint64(len(fi.vectors)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	ids := make([]uint64, 0, len(fi.vectors))
+	for id := range fi.vectors {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	record := make([]byte, 8+fi.dimensions*4)
+	for _, id := range ids {
+		binary.LittleEndian.PutUint64(record[0:8], id)
+		for i, v := range fi.vectors[id] {
+			binary.LittleEndian.PutUint32(record[8+i*4:], math.Float32bits(v))
+		}
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fi.dirty = false
+	return nil
+}
+
+// Load reads the index from disk. A missing file leaves the index empty.
+func (fi *FlatIndex) Load() error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	file, err := os.Open(fi.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header := make([]byte, flatHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if string(header[0:8]) != flatMagic {
+		return &types.IndexCorruptedError{Path: fi.filePath, Err: errors.New("wrong magic number")}
+	}
+	if dims := binary.LittleEndian.Uint32(header[8:12]); dims != fi.dimensions {
+		return &types.DimensionMismatchError{Subject: "flat index", Expected: int(fi.dimensions), Actual: int(dims)}
+	}
+	if metric := byteToMetric(header[12]); metric != fi.metric {
+		return &types.MetricMismatchError{Subject: "flat index", Expected: fi.metric, Actual: metric}
+	}
+	count := binary.LittleEndian.Uint64(header[16:24])
+
+	vectors := make(map[uint64][]float32, count)
+	record := make([]byte, 8+fi.dimensions*4)
+	for n := uint64(0); n < count; n++ {
+		if _, err := io.ReadFull(r, record); err != nil {
+			return fmt.Errorf("failed to read vector %d: %w", n, err)
+		}
+		vec := make([]float32, fi.dimensions)
+		for i := range vec {
+			vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(record[8+i*4:]))
+		}
+		vectors[binary.LittleEndian.Uint64(record[0:8])] = vec
+	}
+
+	fi.vectors = vectors
+	fi.dirty = false
+	return nil
+}
+
+// Close releases all resources held by the index.
+func (fi *FlatIndex) Close() error {
+	return nil
+}
+
+// Count returns the number of vectors in the index.
+func (fi *FlatIndex) Count() uint64 {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	return uint64(len(fi.vectors))
+}
+
+// Contains checks if a vector ID exists in the index.
+func (fi *FlatIndex) Contains(vectorID uint64) bool {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	_, ok := fi.vectors[vectorID]
+	return ok
+}
+
+// GetVector returns the stored vector for vectorID.
+func (fi *FlatIndex) GetVector(vectorID uint64) ([]float32, bool) {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	vec, ok := fi.vectors[vectorID]
+	return vec, ok
+}
+
+// VectorIDs returns the IDs of all vectors in the index, in no particular order.
+func (fi *FlatIndex) VectorIDs() []uint64 {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	ids := make([]uint64, 0, len(fi.vectors))
+	for id := range fi.vectors {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// IsDirty returns true if the index has unsaved changes.
+func (fi *FlatIndex) IsDirty() bool {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	return fi.dirty
+}
+
+// Dimensions returns the configured dimensions.
+func (fi *FlatIndex) Dimensions() uint32 {
+	return fi.dimensions
+}
+
+// Metric returns the configured distance metric.
+func (fi *FlatIndex) Metric() types.DistanceMetric {
+	return fi.metric
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestFlatIndex_MatchesBruteForce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.flat")
+	fi := NewFlatIndex(8, types.MetricL2, path)
+	hw, err := NewHNSWWrapper(8, types.MetricL2, filepath.Join(t.TempDir(), "vectors.hnsw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(3))
+	for i := uint64(1); i <= 300; i++ {
+		vec := make([]float32, 8)
+		for j := range vec {
+			vec[j] = rng.Float32()
+		}
+		if err := fi.Add(i, vec); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		hw.Add(i, vec)
+	}
+	if err := fi.Add(1, make([]float32, 8)); err == nil {
+		t.Error("Expected duplicate ID to be rejected")
+	}
+	if err := fi.Add(999, make([]float32, 4)); err == nil {
+		t.Error("Expected dimension mismatch to be rejected")
+	}
+
+	for _, query := range hw.SampleVectors(20) {
+		results, err := fi.Search(query, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		truth, _ := hw.bruteForce(query, 10)
+		if len(results) != len(truth) {
+			t.Fatalf("Expected %d results, got %d", len(truth), len(results))
+		}
+		for i := range truth {
+			if results[i].Distance != truth[i].Distance {
+				t.Fatalf("Result %d: distance %f, want %f", i, results[i].Distance, truth[i].Distance)
+			}
+		}
+	}
+
+	// Filtered search only considers the allowed IDs
+	filter := NewBitSetFromSlice([]uint64{5, 50, 150})
+	results, err := fi.Search(hw.SampleVectors(1)[0], 10, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 filtered results, got %d", len(results))
+	}
+	for _, r := range results {
+		if !filter.Contains(r.VectorID) {
+			t.Errorf("Result %d is outside the filter", r.VectorID)
+		}
+	}
+
+	// Save and Load round-trip
+	if err := fi.Delete(7); err != nil {
+		t.Fatal(err)
+	}
+	if err := fi.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if fi.IsDirty() {
+		t.Error("Expected index to be clean after Save")
+	}
+	loaded := NewFlatIndex(8, types.MetricL2, path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Count() != 299 || loaded.Contains(7) {
+		t.Errorf("Loaded index has %d vectors (contains 7: %v), want 299 without 7", loaded.Count(), loaded.Contains(7))
+	}
+	if !reflect.DeepEqual(loaded.vectors, fi.vectors) {
+		t.Error("Loaded vectors differ from saved vectors")
+	}
+
+	if err := NewFlatIndex(4, types.MetricL2, path).Load(); err == nil {
+		t.Error("Expected Load with mismatched dimensions to fail")
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"waddlemap/internal/logger"
+)
+
+// DefaultFlushInterval is the default period between background index flushes.
+const DefaultFlushInterval = 30 * time.Second
+
+// DirtyFlusher periodically saves collections whose indexes have unsaved changes.
+// This bounds the amount of index state lost if the process crashes between checkpoints.
+type DirtyFlusher struct {
+	collections *CollectionManager
+	interval    time.Duration
+	stop        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewDirtyFlusher creates a flusher for the given collection manager.
+func NewDirtyFlusher(cm *CollectionManager, interval time.Duration) *DirtyFlusher {
+	if interval == 0 {
+		interval = DefaultFlushInterval
+	}
+	return &DirtyFlusher{
+		collections: cm,
+		interval:    interval,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start launches the background flush goroutine.
+func (df *DirtyFlusher) Start() {
+	df.wg.Add(1)
+	go df.run()
+}
+
+// Stop signals the flush goroutine to exit and waits for it.
+func (df *DirtyFlusher) Stop() {
+	close(df.stop)
+	df.wg.Wait()
+}
+
+func (df *DirtyFlusher) run() {
+	defer df.wg.Done()
+
+	ticker := time.NewTicker(df.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-df.stop:
+			return
+		case <-ticker.C:
+			df.FlushDirty()
+		}
+	}
+}
+
+// FlushDirty saves every collection that has unsaved index changes.
+// Returns the number of collections flushed.
+func (df *DirtyFlusher) FlushDirty() int {
+	flushed := 0
+	for _, config := range df.collections.ListCollections() {
+		coll, err := df.collections.GetCollection(config.Name)
+		if err != nil || !coll.IsDirty() {
+			continue
+		}
+		if err := coll.Save(); err != nil {
+			if errors.Is(err, ErrClosing) {
+				continue
+			}
+			logger.Error("Background flush of collection %s failed: %v", config.Name, err)
+			continue
+		}
+		flushed++
+	}
+	return flushed
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"waddlemap/internal/types"
+)
+
+func TestDirtyFlusher_FlushesDirtyCollections(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	cfg := &types.DBSchemaConfig{
+		DataPath:      tmpDir,
+		SyncMode:      "normal",
+		FlushInterval: 20 * time.Millisecond,
+	}
+
+	vm, err := NewVectorManager(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("flush_col", 2, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	block := &types.BlockData{Primary: "data", Vector: []float32{1, 2}, Keywords: []string{"tag"}}
+	if _, err := vm.AppendBlock("flush_col", "doc1", block); err != nil {
+		t.Fatalf("AppendBlock failed: %v", err)
+	}
+
+	coll, err := vm.GetCollection("flush_col")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for coll.IsDirty() {
+		if time.Now().After(deadline) {
+			t.Fatal("Collection still dirty after flush interval elapsed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	docMapPath := filepath.Join(tmpDir, "indexes", "flush_col", "doc_map.bin")
+	if _, err := os.Stat(docMapPath); err != nil {
+		t.Errorf("Expected forward index to be flushed: %v", err)
+	}
+}
@@ -1,110 +1,545 @@
 package storage
 
 import (
+	"bufio"
 	"encoding/binary"
 	"encoding/gob"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"os"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
+
+	"waddlemap/internal/types"
 )
 
 // DocLocation represents a block within a key.
 type DocLocation struct {
-	Key   string
-	Index uint32
+	Key       string
+	Index     uint32
+	ExpiresAt int64 // Unix time after which the block is expired (0 = never)
+}
+
+// Expired reports whether the block's expiry time is before now (a Unix time).
+func (loc DocLocation) Expired(now int64) bool {
+	return loc.ExpiresAt != 0 && now > loc.ExpiresAt
+}
+
+// forwardEntry is a single VectorID → DocLocation mapping.
+type forwardEntry struct {
+	VectorID uint64
+	Loc      DocLocation
 }
 
-// ForwardIndex provides O(1) VectorID → (Key, Index) lookup.
+// doc_map.bin format, written by SaveBinary:
+// [Magic(4)][Version(4)][Count(8)] followed by Count records of
+// [VectorID(8)][KeyLen(2)][KeyBytes][Index(4)][ExpiresAt(8)], sorted by
+// VectorID, and a [NextID(8)] trailer holding the vector ID high-water mark.
+//
+// Older files are still read: "FID3" files have a [Magic(4)][Count(8)][NextID(8)]
+// header and [VectorID(8)][Index(4)][ExpiresAt(8)][KeyLen(2)][KeyBytes]
+// records, "FID2" files have no ExpiresAt, files with the "FIDX" magic also
+// have no NextID, and files without a magic are legacy GOB-encoded maps.
+const (
+	forwardIndexMagic   = "FIDB"
+	forwardIndexVersion = 1
+	forwardIndexMagicV3 = "FID3"
+	forwardIndexMagicV2 = "FID2"
+	forwardIndexMagicV1 = "FIDX"
+
+	forwardIndexHeaderSize = 16
+	// forwardIndexRecordSize is the size of a record without its key bytes.
+	forwardIndexRecordSize = 22
+)
+
+// ForwardIndex provides O(log n) VectorID → (Key, Index) lookup.
+// Entries are kept in a slice sorted by VectorID, which is far more compact
+// than a map for large collections.
 // This corresponds to the doc_map.bin file in the spec.
 type ForwardIndex struct {
-	mapping  map[uint64]DocLocation
+	entries  []forwardEntry
 	filePath string
+	dirty    bool // Set on Add/Delete, cleared on Save
 	mu       sync.RWMutex
+
+	// nextID is the next vector ID to allocate. It only grows, so IDs of
+	// deleted entries are never handed out again, until Defragment
+	// renumbers the entries. math.MaxUint64 means the IDs are exhausted.
+	nextID atomic.Uint64
 }
 
+// ErrVectorIDsExhausted is returned when allocating a vector ID would
+// overflow the ID counter. Defragmenting the collection reclaims the IDs of
+// deleted vectors.
+var ErrVectorIDsExhausted = errors.New("vector IDs exhausted")
+
 // NewForwardIndex creates a new forward index.
 func NewForwardIndex(filePath string) *ForwardIndex {
-	return &ForwardIndex{
-		mapping:  make(map[uint64]DocLocation),
+	fi := &ForwardIndex{
 		filePath: filePath,
 	}
+	fi.nextID.Store(1)
+	return fi
+}
+
+// reserveThrough raises nextID above vectorID for IDs assigned by the caller.
+// Assigning math.MaxUint64 exhausts the IDs rather than wrapping the counter.
+func (fi *ForwardIndex) reserveThrough(vectorID uint64) {
+	through := vectorID
+	if vectorID < math.MaxUint64 {
+		through = vectorID + 1
+	}
+	for {
+		next := fi.nextID.Load()
+		if next >= through || fi.nextID.CompareAndSwap(next, through) {
+			return
+		}
+	}
+}
+
+// reserve allocates n consecutive vector IDs and returns the first. It fails
+// instead of letting the counter wrap around to IDs that may be in use.
+func (fi *ForwardIndex) reserve(n uint64) (uint64, error) {
+	for {
+		next := fi.nextID.Load()
+		if n > math.MaxUint64-next {
+			return 0, ErrVectorIDsExhausted
+		}
+		if fi.nextID.CompareAndSwap(next, next+n) {
+			return next, nil
+		}
+	}
+}
+
+// search returns the position of vectorID in entries (or where it would be inserted).
+func (fi *ForwardIndex) search(vectorID uint64) (int, bool) {
+	i := sort.Search(len(fi.entries), func(i int) bool {
+		return fi.entries[i].VectorID >= vectorID
+	})
+	return i, i < len(fi.entries) && fi.entries[i].VectorID == vectorID
 }
 
 // Add adds a VectorID → (Key, Index) mapping.
 func (fi *ForwardIndex) Add(vectorID uint64, key string, index uint32) {
 	fi.mu.Lock()
 	defer fi.mu.Unlock()
-	fi.mapping[vectorID] = DocLocation{Key: key, Index: index}
+
+	entry := forwardEntry{VectorID: vectorID, Loc: DocLocation{Key: key, Index: index}}
+	fi.dirty = true
+	fi.reserveThrough(vectorID)
+
+	// Fast path: IDs are allocated in increasing order
+	if n := len(fi.entries); n == 0 || fi.entries[n-1].VectorID < vectorID {
+		fi.entries = append(fi.entries, entry)
+		return
+	}
+
+	i, found := fi.search(vectorID)
+	if found {
+		fi.entries[i] = entry
+		return
+	}
+	fi.entries = append(fi.entries, forwardEntry{})
+	copy(fi.entries[i+1:], fi.entries[i:])
+	fi.entries[i] = entry
+}
+
+// AddNext allocates the next vector ID and maps it to (Key, Index) in one step,
+// so concurrent callers never receive the same ID. It returns
+// ErrVectorIDsExhausted when no IDs are left.
+func (fi *ForwardIndex) AddNext(key string, index uint32) (uint64, error) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	// IDs from the counter exceed every stored ID, so appending keeps entries sorted
+	vectorID, err := fi.reserve(1)
+	if err != nil {
+		return 0, err
+	}
+	fi.entries = append(fi.entries, forwardEntry{VectorID: vectorID, Loc: DocLocation{Key: key, Index: index}})
+	fi.dirty = true
+	return vectorID, nil
 }
 
 // Get retrieves a document location by VectorID.
 func (fi *ForwardIndex) Get(vectorID uint64) (DocLocation, bool) {
 	fi.mu.RLock()
 	defer fi.mu.RUnlock()
-	loc, ok := fi.mapping[vectorID]
-	return loc, ok
+	i, found := fi.search(vectorID)
+	if !found {
+		return DocLocation{}, false
+	}
+	return fi.entries[i].Loc, true
+}
+
+// SetExpiry sets the Unix time at which a block expires. It returns false if
+// vectorID is not mapped.
+func (fi *ForwardIndex) SetExpiry(vectorID uint64, expiresAt int64) bool {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	i, found := fi.search(vectorID)
+	if !found {
+		return false
+	}
+	fi.entries[i].Loc.ExpiresAt = expiresAt
+	fi.dirty = true
+	return true
 }
 
 // Delete removes a VectorID mapping.
 func (fi *ForwardIndex) Delete(vectorID uint64) {
 	fi.mu.Lock()
 	defer fi.mu.Unlock()
-	delete(fi.mapping, vectorID)
+	i, found := fi.search(vectorID)
+	if !found {
+		return
+	}
+	fi.entries = append(fi.entries[:i], fi.entries[i+1:]...)
+	fi.dirty = true
+}
+
+// nextFrom returns the mapping with the lowest vector ID of at least
+// vectorID, and false if there is none.
+func (fi *ForwardIndex) nextFrom(vectorID uint64) (uint64, DocLocation, bool) {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	i, _ := fi.search(vectorID)
+	if i == len(fi.entries) {
+		return 0, DocLocation{}, false
+	}
+	return fi.entries[i].VectorID, fi.entries[i].Loc, true
 }
 
 // Count returns the number of entries in the forward index.
 func (fi *ForwardIndex) Count() int {
 	fi.mu.RLock()
 	defer fi.mu.RUnlock()
-	return len(fi.mapping)
+	return len(fi.entries)
 }
 
-// Save persists the forward index to disk using GOB.
-func (fi *ForwardIndex) Save() error {
+// Range calls fn for each mapping in ascending VectorID order until fn returns false.
+// fn must not modify the forward index.
+func (fi *ForwardIndex) Range(fn func(vectorID uint64, loc DocLocation) bool) {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	for _, e := range fi.entries {
+		if !fn(e.VectorID, e.Loc) {
+			return
+		}
+	}
+}
+
+// IsDirty returns true if the index has unsaved changes.
+func (fi *ForwardIndex) IsDirty() bool {
 	fi.mu.RLock()
 	defer fi.mu.RUnlock()
+	return fi.dirty
+}
+
+// Save persists the forward index to disk with SaveBinary.
+func (fi *ForwardIndex) Save() error {
+	return fi.SaveBinary()
+}
 
-	file, err := os.Create(fi.filePath)
+// SaveBinary persists the forward index in the packed binary format. The
+// file is replaced atomically, so a crash mid-save keeps the previous one.
+func (fi *ForwardIndex) SaveBinary() error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	err := writeFileAtomic(fi.filePath, func(w *bufio.Writer) error {
+		header := make([]byte, forwardIndexHeaderSize)
+		copy(header[0:4], forwardIndexMagic)
+		binary.BigEndian.PutUint32(header[4:8], forwardIndexVersion)
+		binary.BigEndian.PutUint64(header[8:16], uint64(len(fi.entries)))
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+
+		buf := make([]byte, 12)
+		for _, e := range fi.entries {
+			if len(e.Loc.Key) > MaxKeyLength {
+				return fmt.Errorf("key exceeds maximum length of %d bytes", MaxKeyLength)
+			}
+			binary.BigEndian.PutUint64(buf[0:8], e.VectorID)
+			binary.BigEndian.PutUint16(buf[8:10], uint16(len(e.Loc.Key)))
+			if _, err := w.Write(buf[:10]); err != nil {
+				return err
+			}
+			if _, err := w.WriteString(e.Loc.Key); err != nil {
+				return err
+			}
+			binary.BigEndian.PutUint32(buf[0:4], e.Loc.Index)
+			binary.BigEndian.PutUint64(buf[4:12], uint64(e.Loc.ExpiresAt))
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+		}
+
+		binary.BigEndian.PutUint64(buf[0:8], fi.nextID.Load())
+		_, err := w.Write(buf[:8])
+		return err
+	})
 	if err != nil {
 		return err
 	}
+	fi.dirty = false
+	return nil
+}
+
+// Load reads the forward index from disk. Files in the binary format are
+// read with LoadBinary; older binary formats and legacy GOB-encoded files
+// are converted to the sorted representation.
+func (fi *ForwardIndex) Load() error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	file, r, size, err := fi.open()
+	if file == nil || err != nil {
+		return err
+	}
 	defer file.Close()
 
-	encoder := gob.NewEncoder(file)
-	return encoder.Encode(fi.mapping)
+	magic, err := r.Peek(len(forwardIndexMagic))
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			fi.reset()
+			return nil
+		}
+		return err
+	}
+	switch string(magic) {
+	case forwardIndexMagic:
+		return fi.readBinary(r, size)
+	case forwardIndexMagicV3, forwardIndexMagicV2, forwardIndexMagicV1:
+		return fi.readFixedHeader(r, size, string(magic))
+	default:
+		return fi.loadLegacyGob(r)
+	}
 }
 
-// Load reads the forward index from disk.
-func (fi *ForwardIndex) Load() error {
+// LoadBinary reads a forward index saved by SaveBinary. Unlike Load it
+// rejects files in any other format.
+func (fi *ForwardIndex) LoadBinary() error {
 	fi.mu.Lock()
 	defer fi.mu.Unlock()
 
+	file, r, size, err := fi.open()
+	if file == nil || err != nil {
+		return err
+	}
+	defer file.Close()
+	return fi.readBinary(r, size)
+}
+
+// open opens the index file for reading. A missing file resets the index
+// and returns a nil file. Caller must hold the lock.
+func (fi *ForwardIndex) open() (*os.File, *bufio.Reader, int64, error) {
 	file, err := os.Open(fi.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			fi.mapping = make(map[uint64]DocLocation)
-			return nil
+			fi.reset()
+			return nil, nil, 0, nil
 		}
+		return nil, nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, 0, err
+	}
+	return file, bufio.NewReader(file), info.Size(), nil
+}
+
+// reset empties the index, as for a missing file. Caller must hold the lock.
+func (fi *ForwardIndex) reset() {
+	fi.entries = nil
+	fi.dirty = false
+	fi.nextID.Store(1)
+}
+
+// checkCount returns an IndexCorruptedError if a header claims more entries
+// than the rest of the file can hold, so that a corrupt count cannot reserve
+// more memory than the file is worth.
+func (fi *ForwardIndex) checkCount(count uint64, available int64, recordSize int) error {
+	if maxCount := uint64(max(available, 0)) / uint64(recordSize); count > maxCount {
+		err := fmt.Errorf("header claims %d entries, but the file holds at most %d", count, maxCount)
+		return &types.IndexCorruptedError{Path: fi.filePath, Err: err}
+	}
+	return nil
+}
+
+// readBinary reads the format written by SaveBinary from r, which holds
+// size bytes. Caller must hold the lock.
+func (fi *ForwardIndex) readBinary(r *bufio.Reader, size int64) error {
+	header := make([]byte, forwardIndexHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("failed to read forward index header: %w", err)
+	}
+	if string(header[0:4]) != forwardIndexMagic {
+		return &types.IndexCorruptedError{Path: fi.filePath, Err: fmt.Errorf("bad magic %q", header[0:4])}
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != forwardIndexVersion {
+		return fmt.Errorf("unsupported forward index version %d", version)
+	}
+	count := binary.BigEndian.Uint64(header[8:16])
+	if err := fi.checkCount(count, size-forwardIndexHeaderSize-8, forwardIndexRecordSize); err != nil {
 		return err
 	}
-	defer file.Close()
 
-	decoder := gob.NewDecoder(file)
-	return decoder.Decode(&fi.mapping)
+	entries := make([]forwardEntry, 0, count)
+	buf := make([]byte, 12)
+	var key []byte // Reused; string(key) copies it
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(r, buf[:10]); err != nil {
+			return fmt.Errorf("failed to read forward index entry %d: %w", i, err)
+		}
+		vectorID := binary.BigEndian.Uint64(buf[0:8])
+		keyLen := int(binary.BigEndian.Uint16(buf[8:10]))
+		key = slices.Grow(key[:0], keyLen)[:keyLen]
+		if _, err := io.ReadFull(r, key); err != nil {
+			return fmt.Errorf("failed to read forward index key %d: %w", i, err)
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return fmt.Errorf("failed to read forward index entry %d: %w", i, err)
+		}
+		loc := DocLocation{
+			Key:       string(key),
+			Index:     binary.BigEndian.Uint32(buf[0:4]),
+			ExpiresAt: int64(binary.BigEndian.Uint64(buf[4:12])),
+		}
+		entries = append(entries, forwardEntry{VectorID: vectorID, Loc: loc})
+	}
+	if _, err := io.ReadFull(r, buf[:8]); err != nil {
+		return fmt.Errorf("failed to read forward index trailer: %w", err)
+	}
+
+	fi.entries = entries
+	fi.dirty = false
+	fi.nextID.Store(max(1, binary.BigEndian.Uint64(buf[0:8])))
+	// Never hand out an ID that is still in use, whatever the trailer says
+	if n := len(entries); n > 0 {
+		fi.reserveThrough(entries[n-1].VectorID)
+	}
+	return nil
+}
+
+// readFixedHeader reads the older "FID3", "FID2" and "FIDX" formats from r,
+// which holds size bytes. The index is marked dirty so the next save
+// rewrites it in the current format. Caller must hold the lock.
+func (fi *ForwardIndex) readFixedHeader(r *bufio.Reader, size int64, magic string) error {
+	headerSize, recordSize := 20, 22
+	switch magic {
+	case forwardIndexMagicV2:
+		recordSize = 14
+	case forwardIndexMagicV1:
+		headerSize, recordSize = 12, 14
+	}
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("failed to read forward index header: %w", err)
+	}
+	count := binary.BigEndian.Uint64(header[4:12])
+	if err := fi.checkCount(count, size-int64(headerSize), recordSize); err != nil {
+		return err
+	}
+
+	entries := make([]forwardEntry, 0, count)
+	record := make([]byte, recordSize)
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(r, record); err != nil {
+			return fmt.Errorf("failed to read forward index entry %d: %w", i, err)
+		}
+		key := make([]byte, binary.BigEndian.Uint16(record[recordSize-2:]))
+		if _, err := io.ReadFull(r, key); err != nil {
+			return fmt.Errorf("failed to read forward index key %d: %w", i, err)
+		}
+		loc := DocLocation{Key: string(key), Index: binary.BigEndian.Uint32(record[8:12])}
+		if recordSize == 22 {
+			loc.ExpiresAt = int64(binary.BigEndian.Uint64(record[12:20]))
+		}
+		entries = append(entries, forwardEntry{VectorID: binary.BigEndian.Uint64(record[0:8]), Loc: loc})
+	}
+
+	fi.entries = entries
+	fi.dirty = true // Rewrite in the current format on next save
+	fi.nextID.Store(1)
+	if headerSize == 20 {
+		fi.nextID.Store(max(1, binary.BigEndian.Uint64(header[12:20])))
+	}
+	// Never hand out an ID that is still in use, whatever the header says
+	if n := len(entries); n > 0 {
+		fi.reserveThrough(entries[n-1].VectorID)
+	}
+	return nil
 }
 
-// GetNextVectorID returns and reserves the next available vector ID.
-func (fi *ForwardIndex) GetNextVectorID() uint64 {
+// loadLegacyGob reads a GOB-encoded map[uint64]DocLocation (caller must hold lock).
+func (fi *ForwardIndex) loadLegacyGob(r io.Reader) error {
+	var mapping map[uint64]DocLocation
+	if err := gob.NewDecoder(r).Decode(&mapping); err != nil {
+		return err
+	}
+
+	entries := make([]forwardEntry, 0, len(mapping))
+	for id, loc := range mapping {
+		entries = append(entries, forwardEntry{VectorID: id, Loc: loc})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].VectorID < entries[j].VectorID })
+
+	fi.entries = entries
+	fi.dirty = true // Rewrite in the new format on next save
+	fi.nextID.Store(1)
+	if n := len(entries); n > 0 {
+		fi.reserveThrough(entries[n-1].VectorID)
+	}
+	return nil
+}
+
+// GetNextVectorID returns and reserves the next available vector ID. It is
+// safe for concurrent use and returns ErrVectorIDsExhausted once the counter
+// reaches math.MaxUint64, rather than wrapping around to IDs in use.
+func (fi *ForwardIndex) GetNextVectorID() (uint64, error) {
+	return fi.reserve(1)
+}
+
+// ReserveVectorIDs reserves n consecutive vector IDs and returns the first,
+// or ErrVectorIDsExhausted if fewer than n are left.
+func (fi *ForwardIndex) ReserveVectorIDs(n int) (uint64, error) {
+	return fi.reserve(uint64(n))
+}
+
+// Defragment renumbers the entries to consecutive vector IDs from 1, in
+// their current order, and resets the counter past them, reclaiming the IDs
+// of deleted entries. Numbering starts at 1 rather than 0 because the
+// counter never allocates 0, so renumbering can't hand out an ID that
+// GetNextVectorID would not. It returns the old ID → new ID mapping instead
+// of an error, since the forward index doesn't own the HNSW and keyword
+// indexes; Collection.Defragment applies the mapping to those and reports
+// errors.
+func (fi *ForwardIndex) Defragment() map[uint64]uint64 {
 	fi.mu.Lock()
 	defer fi.mu.Unlock()
 
-	var maxID uint64 = 0
-	for id := range fi.mapping {
-		if id > maxID {
-			maxID = id
-		}
+	remap := make(map[uint64]uint64, len(fi.entries))
+	for i := range fi.entries {
+		newID := uint64(i) + 1
+		remap[fi.entries[i].VectorID] = newID
+		fi.entries[i].VectorID = newID
 	}
-	return maxID + 1
+	fi.nextID.Store(uint64(len(fi.entries)) + 1)
+	fi.dirty = true
+	return remap
+}
+
+// PeekNextVectorID returns the ID GetNextVectorID would allocate next without
+// reserving it. Every ID in the index is below it.
+func (fi *ForwardIndex) PeekNextVectorID() uint64 {
+	return fi.nextID.Load()
 }
 
 // VectorIDToBytes converts a VectorID to bytes for storage.
@@ -0,0 +1,418 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestForwardIndex_SortedInsertAndLookup(t *testing.T) {
+	fi := NewForwardIndex(filepath.Join(t.TempDir(), "doc_map.bin"))
+
+	for _, id := range []uint64{5, 1, 9, 3, 7} {
+		fi.Add(id, fmt.Sprintf("key-%d", id), uint32(id))
+	}
+	fi.Add(3, "key-3b", 30) // overwrite
+	fi.Delete(9)
+
+	var ids []uint64
+	fi.Range(func(id uint64, _ DocLocation) bool {
+		ids = append(ids, id)
+		return true
+	})
+	want := []uint64{1, 3, 5, 7}
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Fatalf("Expected sorted ids %v, got %v", want, ids)
+	}
+
+	loc, ok := fi.Get(3)
+	if !ok || loc.Key != "key-3b" || loc.Index != 30 {
+		t.Errorf("Unexpected location for id 3: %+v (found=%v)", loc, ok)
+	}
+	if _, ok := fi.Get(9); ok {
+		t.Error("Expected id 9 to be deleted")
+	}
+	// IDs are never reused, even after the highest one is deleted
+	if next, err := fi.GetNextVectorID(); err != nil || next != 10 {
+		t.Errorf("Expected next vector ID 10, got %d (%v)", next, err)
+	}
+}
+
+func TestForwardIndex_ConcurrentAllocationIsUnique(t *testing.T) {
+	fi := NewForwardIndex(filepath.Join(t.TempDir(), "doc_map.bin"))
+
+	const workers, perWorker = 8, 12500
+	ids := make([][]uint64, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				var id uint64
+				var err error
+				if i%2 == 0 {
+					id, err = fi.AddNext(fmt.Sprintf("w%d", w), uint32(i))
+				} else if id, err = fi.GetNextVectorID(); err == nil {
+					fi.Add(id, fmt.Sprintf("w%d", w), uint32(i))
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ids[w] = append(ids[w], id)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[uint64]bool, workers*perWorker)
+	for _, batch := range ids {
+		for _, id := range batch {
+			if seen[id] {
+				t.Fatalf("Vector ID %d allocated twice", id)
+			}
+			seen[id] = true
+		}
+	}
+	if fi.Count() != workers*perWorker {
+		t.Errorf("Expected %d entries, got %d", workers*perWorker, fi.Count())
+	}
+}
+
+func TestForwardIndex_NextIDPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc_map.bin")
+	fi := NewForwardIndex(path)
+	for i := 0; i < 5; i++ {
+		fi.AddNext("k", uint32(i))
+	}
+	fi.Delete(5)
+	fi.Delete(4)
+	if err := fi.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := NewForwardIndex(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if next := loaded.PeekNextVectorID(); next != 6 {
+		t.Errorf("Expected next vector ID 6 after reload, got %d", next)
+	}
+	if id, err := loaded.AddNext("k", 5); err != nil || id != 6 {
+		t.Errorf("Expected AddNext to allocate 6, got %d (%v)", id, err)
+	}
+}
+
+func TestForwardIndex_ExhaustedIDs(t *testing.T) {
+	fi := NewForwardIndex(filepath.Join(t.TempDir(), "doc_map.bin"))
+	fi.nextID.Store(math.MaxUint64 - 2)
+
+	if _, err := fi.ReserveVectorIDs(3); !errors.Is(err, ErrVectorIDsExhausted) {
+		t.Errorf("Expected ErrVectorIDsExhausted reserving past the last ID, got %v", err)
+	}
+	if id, err := fi.AddNext("k", 0); err != nil || id != math.MaxUint64-2 {
+		t.Fatalf("Expected AddNext to allocate %d, got %d (%v)", uint64(math.MaxUint64-2), id, err)
+	}
+	if id, err := fi.GetNextVectorID(); err != nil || id != math.MaxUint64-1 {
+		t.Fatalf("Expected GetNextVectorID to allocate %d, got %d (%v)", uint64(math.MaxUint64-1), id, err)
+	}
+	// The counter stops instead of wrapping around to IDs in use
+	if id, err := fi.GetNextVectorID(); !errors.Is(err, ErrVectorIDsExhausted) {
+		t.Errorf("Expected ErrVectorIDsExhausted, got ID %d (%v)", id, err)
+	}
+	if _, err := fi.AddNext("k", 1); !errors.Is(err, ErrVectorIDsExhausted) {
+		t.Errorf("Expected ErrVectorIDsExhausted from AddNext, got %v", err)
+	}
+	fi.Add(math.MaxUint64, "k", 2)
+	if next := fi.PeekNextVectorID(); next != math.MaxUint64 {
+		t.Errorf("Expected the counter to stay at the maximum, got %d", next)
+	}
+
+	// Defragmenting reclaims the ID space, renumbering from 1 since 0 is
+	// never allocated
+	remap := fi.Defragment()
+	if remap[math.MaxUint64-2] != 1 || remap[math.MaxUint64] != 2 || len(remap) != 2 {
+		t.Errorf("Unexpected remap %v", remap)
+	}
+	if _, ok := fi.Get(0); ok {
+		t.Error("Expected Defragment not to assign vector ID 0")
+	}
+	if id, err := fi.AddNext("k", 3); err != nil || id != 3 {
+		t.Errorf("Expected AddNext to allocate 3 after Defragment, got %d (%v)", id, err)
+	}
+	if loc, ok := fi.Get(2); !ok || loc.Index != 2 {
+		t.Errorf("Unexpected location for renumbered ID 2: %+v (found=%v)", loc, ok)
+	}
+}
+
+func TestForwardIndex_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc_map.bin")
+	fi := NewForwardIndex(path)
+	for i := uint64(1); i <= 100; i++ {
+		fi.Add(i, fmt.Sprintf("doc-%d", i%7), uint32(i))
+	}
+	fi.SetExpiry(42, 1700000000)
+	if err := fi.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := NewForwardIndex(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Count() != 100 {
+		t.Fatalf("Expected 100 entries, got %d", loaded.Count())
+	}
+	loc, ok := loaded.Get(42)
+	if !ok || loc.Key != "doc-0" || loc.Index != 42 || loc.ExpiresAt != 1700000000 {
+		t.Errorf("Unexpected location for id 42: %+v (found=%v)", loc, ok)
+	}
+}
+
+func TestForwardIndex_LoadCorruptCount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc_map.bin")
+	fi := NewForwardIndex(path)
+	for i := uint64(1); i <= 10; i++ {
+		fi.Add(i, "doc", uint32(i))
+	}
+	if err := fi.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, count := range []uint64{math.MaxUint64, 1 << 40, 11} {
+		binary.BigEndian.PutUint64(data[8:16], count)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewForwardIndex(path).Load(); err == nil {
+			t.Errorf("Load with a count of %d succeeded", count)
+		} else if count != 11 && !errors.Is(err, types.ErrIndexCorrupted) {
+			t.Errorf("Load with a count of %d = %v, want ErrIndexCorrupted", count, err)
+		}
+	}
+}
+
+func TestForwardIndex_SaveReplacesFileAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "doc_map.bin")
+	fi := NewForwardIndex(path)
+	fi.Add(1, "a", 0)
+	if err := fi.Save(); err != nil {
+		t.Fatal(err)
+	}
+	// A hard link, as taken by snapshots, keeps the file it was made from
+	linked := filepath.Join(dir, "linked.bin")
+	if err := os.Link(path, linked); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(path)
+
+	fi.Add(2, "b", 0)
+	if err := fi.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(linked); string(after) != string(before) {
+		t.Error("Save rewrote a hard-linked copy of the old file")
+	}
+
+	// A failed save leaves the last saved file in place
+	fi.Add(3, strings.Repeat("k", MaxKeyLength+1), 0)
+	if err := fi.Save(); err == nil {
+		t.Fatal("Save succeeded with an oversized key")
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Temporary file left behind: %v", err)
+	}
+	loaded := NewForwardIndex(path)
+	if err := loaded.Load(); err != nil || loaded.Count() != 2 {
+		t.Errorf("Load after a failed save = %d entries, %v, want 2", loaded.Count(), err)
+	}
+}
+
+func TestForwardIndex_LoadFID3(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc_map.bin")
+	var data []byte
+	data = append(data, forwardIndexMagicV3...)
+	data = binary.BigEndian.AppendUint64(data, 2)  // Count
+	data = binary.BigEndian.AppendUint64(data, 20) // NextID
+	for _, e := range []forwardEntry{
+		{VectorID: 3, Loc: DocLocation{Key: "a", Index: 0, ExpiresAt: 1700000000}},
+		{VectorID: 7, Loc: DocLocation{Key: "bc", Index: 4}},
+	} {
+		data = binary.BigEndian.AppendUint64(data, e.VectorID)
+		data = binary.BigEndian.AppendUint32(data, e.Loc.Index)
+		data = binary.BigEndian.AppendUint64(data, uint64(e.Loc.ExpiresAt))
+		data = binary.BigEndian.AppendUint16(data, uint16(len(e.Loc.Key)))
+		data = append(data, e.Loc.Key...)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewForwardIndex(path).LoadBinary(); !errors.Is(err, types.ErrIndexCorrupted) {
+		t.Errorf("LoadBinary of an FID3 file = %v, want ErrIndexCorrupted", err)
+	}
+	fi := NewForwardIndex(path)
+	if err := fi.Load(); err != nil {
+		t.Fatalf("Load of FID3 file failed: %v", err)
+	}
+	if loc, ok := fi.Get(3); !ok || loc != (DocLocation{Key: "a", Index: 0, ExpiresAt: 1700000000}) {
+		t.Errorf("Unexpected location for id 3: %+v (found=%v)", loc, ok)
+	}
+	if !fi.IsDirty() {
+		t.Error("Expected FID3 index to be marked dirty for rewrite")
+	}
+
+	// The rewrite keeps every field, including the ID high-water mark
+	if err := fi.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewForwardIndex(path)
+	if err := loaded.LoadBinary(); err != nil {
+		t.Fatalf("LoadBinary after rewrite failed: %v", err)
+	}
+	if loc, ok := loaded.Get(7); !ok || loc != (DocLocation{Key: "bc", Index: 4}) {
+		t.Errorf("Unexpected location for id 7: %+v (found=%v)", loc, ok)
+	}
+	if loc, _ := loaded.Get(3); loc.ExpiresAt != 1700000000 {
+		t.Errorf("Expected expiry to survive the rewrite, got %d", loc.ExpiresAt)
+	}
+	if next := loaded.PeekNextVectorID(); next != 20 {
+		t.Errorf("Expected next vector ID 20, got %d", next)
+	}
+}
+
+func TestForwardIndex_LoadLegacyGob(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc_map.bin")
+	legacy := map[uint64]DocLocation{
+		10: {Key: "b", Index: 1},
+		2:  {Key: "a", Index: 0},
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gob.NewEncoder(f).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fi := NewForwardIndex(path)
+	if err := fi.Load(); err != nil {
+		t.Fatalf("Load of legacy file failed: %v", err)
+	}
+	if loc, ok := fi.Get(10); !ok || loc.Key != "b" {
+		t.Errorf("Unexpected location for id 10: %+v (found=%v)", loc, ok)
+	}
+	if !fi.IsDirty() {
+		t.Error("Expected legacy index to be marked dirty for rewrite")
+	}
+	if next := fi.PeekNextVectorID(); next != 11 {
+		t.Errorf("Expected next vector ID 11 for legacy index, got %d", next)
+	}
+}
+
+// BenchmarkForwardIndexMemory compares the heap footprint of the sorted slice
+// representation against the previous map[uint64]DocLocation.
+func BenchmarkForwardIndexMemory(b *testing.B) {
+	const n = 100000
+
+	heapInUse := func() uint64 {
+		runtime.GC()
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		return ms.HeapAlloc
+	}
+
+	b.Run("map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			before := heapInUse()
+			m := make(map[uint64]DocLocation)
+			for id := uint64(1); id <= n; id++ {
+				m[id] = DocLocation{Key: "key", Index: uint32(id)}
+			}
+			b.ReportMetric(float64(heapInUse()-before)/n, "B/entry")
+			runtime.KeepAlive(m)
+		}
+	})
+
+	b.Run("sorted", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			before := heapInUse()
+			fi := NewForwardIndex("")
+			for id := uint64(1); id <= n; id++ {
+				fi.Add(id, "key", uint32(id))
+			}
+			b.ReportMetric(float64(heapInUse()-before)/n, "B/entry")
+			runtime.KeepAlive(fi)
+		}
+	})
+}
+
+// BenchmarkForwardIndexLoad compares loading 1M entries from the legacy GOB
+// map encoding against the packed binary format written by SaveBinary.
+func BenchmarkForwardIndexLoad(b *testing.B) {
+	const n = 1000000
+	dir := b.TempDir()
+
+	gobPath := filepath.Join(dir, "doc_map.gob")
+	legacy := make(map[uint64]DocLocation, n)
+	for id := uint64(1); id <= n; id++ {
+		legacy[id] = DocLocation{Key: fmt.Sprintf("key-%d", id/4), Index: uint32(id % 4)}
+	}
+	f, err := os.Create(gobPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := gob.NewEncoder(f).Encode(legacy); err != nil {
+		b.Fatal(err)
+	}
+	f.Close()
+
+	binPath := filepath.Join(dir, "doc_map.bin")
+	fi := NewForwardIndex(binPath)
+	for id := uint64(1); id <= n; id++ {
+		loc := legacy[id]
+		fi.Add(id, loc.Key, loc.Index)
+	}
+	if err := fi.SaveBinary(); err != nil {
+		b.Fatal(err)
+	}
+	legacy, fi = nil, nil
+
+	for _, bc := range []struct {
+		name, path string
+		load       func(*ForwardIndex) error
+	}{
+		{"gob", gobPath, (*ForwardIndex).Load},
+		{"binary", binPath, (*ForwardIndex).LoadBinary},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				fi := NewForwardIndex(bc.path)
+				if err := bc.load(fi); err != nil {
+					b.Fatal(err)
+				}
+				if fi.Count() != n {
+					b.Fatalf("Expected %d entries, got %d", n, fi.Count())
+				}
+			}
+		})
+	}
+}
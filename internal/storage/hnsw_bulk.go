@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"waddlemap/internal/types"
+)
+
+// bulkBatchSize is the number of vectors BulkAdd links to each other by
+// brute force at a time. Larger batches give a more exact level-0 graph at a
+// quadratic cost.
+const bulkBatchSize = 10000
+
+// bulkBridgeSize is the number of vectors, drawn from all batches, that
+// every vector is also compared with so that the batches get linked.
+const bulkBridgeSize = 1024
+
+// BulkAdd inserts many vectors into an empty index at once. Instead of
+// searching the graph for every insert, it links each vector to its nearest
+// neighbors found by brute force, in parallel over batches of bulkBatchSize
+// shuffled vectors, then builds each upper level the same way from the nodes
+// promoted to it. Vectors of different batches are linked through a shared
+// random sample and one round of neighbor-of-neighbor refinement. An index
+// that already holds vectors, or a load too small to benefit, is filled with
+// Add in random order instead. Nothing is inserted if any vector is invalid.
+// Unlike Add, BulkAdd never modifies the vectors passed in: with Normalized
+// it normalizes copies.
+func (hw *HNSWWrapper) BulkAdd(vectors map[uint64][]float32) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	ids := make([]uint64, 0, len(vectors))
+	for id, vector := range vectors {
+		if uint32(len(vector)) != hw.dimensions {
+			return &types.DimensionMismatchError{Subject: fmt.Sprintf("vector %d", id), Expected: int(hw.dimensions), Actual: len(vector)}
+		}
+		if node, exists := hw.nodes[id]; exists && !node.Tombstone {
+			return &types.DuplicateIDError{ID: id}
+		}
+		ids = append(ids, id)
+	}
+	// A random order keeps the entry point and the batches unbiased
+	slices.Sort(ids)
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+
+	if len(hw.nodes) > 0 || len(ids) <= hw.EfConstruction {
+		for _, id := range ids {
+			vector := vectors[id]
+			if hw.Normalized {
+				vector = slices.Clone(vector)
+			}
+			if err := hw.addUnlocked(id, vector); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	vecs := make([][]float32, len(ids))
+	nodes := make([]*hnswNode, len(ids))
+	entry := 0
+	for i, id := range ids {
+		vecs[i] = vectors[id]
+		if hw.Normalized {
+			vecs[i] = normalizedCopy(vecs[i])
+		}
+		level := hw.randomLevel()
+		nodes[i] = &hnswNode{ID: id, Level: level, Neighbors: make([][]uint64, level+1)}
+		if err := hw.setVector(nodes[i], vecs[i]); err != nil {
+			for _, node := range nodes[:i] {
+				hw.releaseVector(node)
+			}
+			return err
+		}
+		if level > nodes[entry].Level {
+			entry = i
+		}
+	}
+
+	// Link each level among the nodes that reach it, keeping the M nearest
+	members := make([]int, len(ids))
+	for i := range members {
+		members[i] = i
+	}
+	for level := 0; len(members) > 1; level++ {
+		knn := hw.bulkKNN(vecs, members, 2*hw.M)
+		for i, pos := range members {
+			neighbors := knn[i][:min(hw.M, len(knn[i]))]
+			node := nodes[pos]
+			node.Neighbors[level] = make([]uint64, 0, len(neighbors))
+			for _, c := range neighbors {
+				node.Neighbors[level] = append(node.Neighbors[level], nodes[c.ID].ID)
+			}
+		}
+		members = slices.DeleteFunc(members, func(pos int) bool { return nodes[pos].Level <= level })
+	}
+
+	for _, node := range nodes {
+		hw.nodes[node.ID] = node
+		hw.markDirty(node.ID)
+	}
+	// Reverse links, pruned like those of Add
+	for _, node := range nodes {
+		for level, neighbors := range node.Neighbors {
+			for _, nid := range neighbors {
+				hw.addConnection(nid, node.ID, level)
+			}
+		}
+	}
+
+	hw.entryPoint = nodes[entry].ID
+	hw.hasEntry = true
+	hw.MaxLevel = nodes[entry].Level
+	return nil
+}
+
+// bulkKNN returns, for each of members (positions in vecs), its k nearest
+// other members sorted by distance, with positions as candidate IDs. Lists
+// are exact within batches of bulkBatchSize members and approximate across
+// them.
+func (hw *HNSWWrapper) bulkKNN(vecs [][]float32, members []int, k int) [][]candidate {
+	knn := make([][]candidate, len(members))
+	for start := 0; start < len(members); start += bulkBatchSize {
+		batch := members[start:min(start+bulkBatchSize, len(members))]
+		parallelFor(len(batch), func(i int) {
+			knn[start+i] = hw.nearestAmong(vecs, batch[i], batch, k)
+		})
+	}
+	if len(members) <= bulkBatchSize {
+		return knn
+	}
+
+	// Link the batches through a shared sample, then let each member take
+	// the nearest of its neighbors' neighbors, which spreads those links
+	bridge := make([]int, bulkBridgeSize)
+	for i, j := range rand.Perm(len(members))[:bulkBridgeSize] {
+		bridge[i] = members[j]
+	}
+	parallelFor(len(members), func(i int) {
+		knn[i] = mergeNearest(knn[i], hw.nearestAmong(vecs, members[i], bridge, k), k)
+	})
+
+	memberIndex := make(map[int]int, len(members))
+	for i, pos := range members {
+		memberIndex[pos] = i
+	}
+	refined := make([][]candidate, len(members))
+	parallelFor(len(members), func(i int) {
+		var twoHop []int
+		for _, c := range knn[i] {
+			for _, cc := range knn[memberIndex[int(c.ID)]] {
+				twoHop = append(twoHop, int(cc.ID))
+			}
+		}
+		slices.Sort(twoHop)
+		refined[i] = mergeNearest(knn[i], hw.nearestAmong(vecs, members[i], slices.Compact(twoHop), k), k)
+	})
+	return refined
+}
+
+// nearestAmong returns the k positions of among nearest to vecs[pos],
+// excluding pos itself, sorted by distance.
+func (hw *HNSWWrapper) nearestAmong(vecs [][]float32, pos int, among []int, k int) []candidate {
+	query := vecs[pos]
+	nearest := make(maxCandidateHeap, 0, k+1)
+	for _, other := range among {
+		if other == pos {
+			continue
+		}
+		dist := hw.distance(query, vecs[other])
+		if len(nearest) == k && dist >= nearest[0].Distance {
+			continue
+		}
+		heap.Push(&nearest, candidate{ID: uint64(other), Distance: dist})
+		if len(nearest) > k {
+			heap.Pop(&nearest)
+		}
+	}
+	slices.SortFunc(nearest, compareCandidates)
+	return nearest
+}
+
+// mergeNearest returns the k nearest distinct candidates of the sorted
+// lists a and b.
+func mergeNearest(a, b []candidate, k int) []candidate {
+	merged := make([]candidate, 0, len(a)+len(b))
+	merged = append(append(merged, a...), b...)
+	slices.SortFunc(merged, compareCandidates)
+	merged = slices.CompactFunc(merged, func(x, y candidate) bool { return x.ID == y.ID })
+	return merged[:min(k, len(merged))]
+}
+
+// compareCandidates orders candidates by distance, then ID.
+func compareCandidates(a, b candidate) int {
+	switch {
+	case a.Distance < b.Distance:
+		return -1
+	case a.Distance > b.Distance:
+		return 1
+	case a.ID < b.ID:
+		return -1
+	case a.ID > b.ID:
+		return 1
+	}
+	return 0
+}
+
+// parallelFor calls fn for every i in [0, n) on one goroutine per CPU.
+func parallelFor(n int, fn func(i int)) {
+	workers := min(runtime.GOMAXPROCS(0), n)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1) - 1); i < n; i = int(next.Add(1) - 1) {
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// HNSW delta file format: a 16-byte header followed by batches of records,
+// one batch per SaveDelta call. A batch is only applied once its commit
+// record has been read, so a batch torn by a crash is ignored.
+//
+//	header: magic "HNSWD001" | dims uint32 | metric uint8 | half uint8 | reserved [2]
+//	upsert: op=1 | id uint64 | level uint32 (tombstone flag) | vector [dims]float32 or float16 |
+//	        levels uint16 | per level: count uint16 | ids [count]uint64
+//	delete: op=2 | id uint64
+//	commit: op=3 | entryPoint uint64 | maxLevel uint32 | hasEntry uint8 | records uint32
+const (
+	hnswDeltaMagic      = "HNSWD001"
+	hnswDeltaHeaderSize = 16
+
+	hnswDeltaUpsert uint8 = 1
+	hnswDeltaDelete uint8 = 2
+	hnswDeltaCommit uint8 = 3
+)
+
+// DefaultDeltaThreshold is the default HNSWWrapper.DeltaThreshold.
+const DefaultDeltaThreshold = 1000
+
+// deltaPath returns the path of the delta file next to the snapshot.
+func (hw *HNSWWrapper) deltaPath() string {
+	return hw.filePath + ".delta"
+}
+
+func (hw *HNSWWrapper) deltaThreshold() int {
+	if hw.DeltaThreshold > 0 {
+		return hw.DeltaThreshold
+	}
+	return DefaultDeltaThreshold
+}
+
+// markDirty records that a node was added, changed or removed. Caller must
+// hold hw.mu.
+func (hw *HNSWWrapper) markDirty(id uint64) {
+	hw.dirtySet[id] = true
+	hw.dirty = true
+	hw.dirtyCount = hnswVersions.Add(1)
+}
+
+// Flush persists unsaved changes: as a delta while few nodes have changed
+// since the last full save, and with a full Save once more than
+// DeltaThreshold have.
+func (hw *HNSWWrapper) Flush() error {
+	hw.mu.RLock()
+	dirty := hw.dirty
+	full := hw.deltaNodes+len(hw.dirtySet) > hw.deltaThreshold()
+	hw.mu.RUnlock()
+
+	if !dirty {
+		return nil
+	}
+	if full {
+		return hw.Save()
+	}
+	return hw.SaveDelta()
+}
+
+// SaveDelta appends the nodes changed since the last save to the delta file,
+// leaving the snapshot written by Save untouched. Load applies the delta on
+// top of the snapshot.
+func (hw *HNSWWrapper) SaveDelta() error {
+	hw.mu.Lock() // SaveDelta clears the dirty set
+	defer hw.mu.Unlock()
+
+	if !hw.dirty {
+		return nil
+	}
+
+	ids := make([]uint64, 0, len(hw.dirtySet))
+	for id := range hw.dirtySet {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var buf bytes.Buffer
+	for _, id := range ids {
+		node, ok := hw.nodes[id]
+		if !ok {
+			buf.WriteByte(hnswDeltaDelete)
+			binary.Write(&buf, binary.LittleEndian, id)
+			continue
+		}
+		level := uint32(node.Level)
+		if node.Tombstone {
+			level |= hnswLevelTombstone
+		}
+		buf.WriteByte(hnswDeltaUpsert)
+		binary.Write(&buf, binary.LittleEndian, id)
+		binary.Write(&buf, binary.LittleEndian, level)
+		hw.writeVector(&buf, node)
+		binary.Write(&buf, binary.LittleEndian, uint16(len(node.Neighbors)))
+		for _, neighbors := range node.Neighbors {
+			binary.Write(&buf, binary.LittleEndian, uint16(len(neighbors)))
+			binary.Write(&buf, binary.LittleEndian, neighbors)
+		}
+	}
+	var hasEntry uint8
+	if hw.hasEntry {
+		hasEntry = 1
+	}
+	buf.WriteByte(hnswDeltaCommit)
+	binary.Write(&buf, binary.LittleEndian, hw.entryPoint)
+	binary.Write(&buf, binary.LittleEndian, uint32(hw.MaxLevel))
+	buf.WriteByte(hasEntry)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(ids)))
+
+	file, err := os.OpenFile(hw.deltaPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		header := make([]byte, hnswDeltaHeaderSize)
+		copy(header[0:8], hnswDeltaMagic)
+		binary.LittleEndian.PutUint32(header[8:12], hw.dimensions)
+		header[12] = metricToByte(hw.metric)
+		if hw.Float16Vectors {
+			header[13] = 1
+		}
+		if _, err := file.Write(header); err != nil {
+			return err
+		}
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	hw.deltaNodes += len(ids)
+	clear(hw.dirtySet)
+	hw.dirty = false
+	return nil
+}
+
+// MergeDelta folds the delta file into the snapshot and removes it. The
+// in-memory graph already includes the delta, so this is a full Save.
+func (hw *HNSWWrapper) MergeDelta() error {
+	if _, err := os.Stat(hw.deltaPath()); os.IsNotExist(err) {
+		return nil
+	}
+	return hw.Save()
+}
+
+// hnswDeltaRecord is an upsert or delete read from the delta file.
+type hnswDeltaRecord struct {
+	id   uint64
+	node *hnswNode // Nil for deletes
+}
+
+// applyDelta replays the committed batches of the delta file, if any, onto
+// the loaded graph. Caller must hold hw.mu.
+func (hw *HNSWWrapper) applyDelta() error {
+	file, err := os.Open(hw.deltaPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header := make([]byte, hnswDeltaHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil // Crashed before the header was written
+	}
+	if string(header[0:8]) != hnswDeltaMagic {
+		return errors.New("invalid HNSW delta file: wrong magic number")
+	}
+	if dims := binary.LittleEndian.Uint32(header[8:12]); dims != hw.dimensions {
+		return fmt.Errorf("delta dimension mismatch: file has %d, expected %d", dims, hw.dimensions)
+	}
+
+	var pending []hnswDeltaRecord
+	nodes := 0
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			break // End of file, or a torn batch
+		}
+		if op == hnswDeltaCommit {
+			var state struct {
+				EntryPoint uint64
+				MaxLevel   uint32
+				HasEntry   uint8
+				Records    uint32
+			}
+			if binary.Read(r, binary.LittleEndian, &state) != nil || int(state.Records) != len(pending) {
+				break
+			}
+			for _, rec := range pending {
+				if old := hw.nodes[rec.id]; old != nil {
+					hw.releaseVector(old)
+				}
+				if rec.node == nil {
+					delete(hw.nodes, rec.id)
+				} else {
+					hw.nodes[rec.id] = rec.node
+				}
+			}
+			hw.entryPoint = state.EntryPoint
+			hw.MaxLevel = int(state.MaxLevel)
+			hw.hasEntry = state.HasEntry == 1
+			nodes += len(pending)
+			pending = pending[:0]
+			continue
+		}
+
+		rec, err := hw.readDeltaRecord(r, op, header[13] == 1)
+		if err != nil {
+			break
+		}
+		pending = append(pending, rec)
+	}
+	// Records of a torn batch are dropped
+	for _, rec := range pending {
+		if rec.node != nil {
+			hw.releaseVector(rec.node)
+		}
+	}
+
+	hw.tombstones = 0
+	for _, node := range hw.nodes {
+		if node.Tombstone {
+			hw.tombstones++
+		}
+	}
+	hw.deltaNodes = nodes
+	return nil
+}
+
+// readDeltaRecord reads the body of an upsert or delete record. half is set
+// when the file stores vectors in half precision.
+func (hw *HNSWWrapper) readDeltaRecord(r io.Reader, op uint8, half bool) (rec hnswDeltaRecord, err error) {
+	if err := binary.Read(r, binary.LittleEndian, &rec.id); err != nil {
+		return rec, err
+	}
+	switch op {
+	case hnswDeltaDelete:
+		return rec, nil
+	case hnswDeltaUpsert:
+	default:
+		return rec, fmt.Errorf("unknown delta record type %d", op)
+	}
+
+	var level uint32
+	if err := binary.Read(r, binary.LittleEndian, &level); err != nil {
+		return rec, err
+	}
+	node := &hnswNode{
+		ID:        rec.id,
+		Level:     int(level &^ hnswLevelTombstone),
+		Tombstone: level&hnswLevelTombstone != 0,
+	}
+	if err := hw.readVector(r, node, half); err != nil {
+		return rec, err
+	}
+	defer func() {
+		if err != nil {
+			hw.releaseVector(node)
+		}
+	}()
+	var levels uint16
+	if err := binary.Read(r, binary.LittleEndian, &levels); err != nil {
+		return rec, err
+	}
+	if int(levels) > node.Level+1 {
+		return rec, fmt.Errorf("corrupt delta record for node %d", rec.id)
+	}
+	node.Neighbors = make([][]uint64, levels)
+	for l := range node.Neighbors {
+		var count uint16
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return rec, err
+		}
+		node.Neighbors[l] = make([]uint64, count)
+		if err := binary.Read(r, binary.LittleEndian, node.Neighbors[l]); err != nil {
+			return rec, err
+		}
+	}
+	rec.node = node
+	return rec, nil
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"slices"
+
+	"waddlemap/internal/types"
+)
+
+// hnswMagic16 marks an HNSW snapshot whose vectors are stored as IEEE 754
+// half-precision values (2 bytes per dimension) instead of float32.
+const hnswMagic16 = "HNSWH001"
+
+// float32ToFloat16 converts v to the IEEE 754 half-precision bit pattern,
+// rounding to nearest even. Values beyond the half range become infinities.
+func float32ToFloat16(v float32) uint16 {
+	bits := math.Float32bits(v)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	if exp == 0xff { // Infinity or NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	}
+
+	e := exp - 127 + 15
+	if e >= 0x1f {
+		return sign | 0x7c00 // Overflow
+	}
+	if e <= 0 {
+		// Subnormal half, or zero once the value is below half the smallest subnormal
+		if e < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint32(14 - e)
+		half := mant >> shift
+		rem, halfway := mant&(1<<shift-1), uint32(1)<<(shift-1)
+		if rem > halfway || (rem == halfway && half&1 == 1) {
+			half++
+		}
+		return sign | uint16(half)
+	}
+
+	half := uint32(e)<<10 | mant>>13
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && half&1 == 1) {
+		half++ // A carry into the exponent is still the correctly rounded value
+	}
+	return sign | uint16(half)
+}
+
+// float16ToFloat32 converts an IEEE 754 half-precision bit pattern to float32.
+// The conversion is exact.
+func float16ToFloat32(v uint16) float32 {
+	sign := uint32(v&0x8000) << 16
+	exp := uint32(v>>10) & 0x1f
+	mant := uint32(v & 0x3ff)
+
+	switch exp {
+	case 0x1f: // Infinity or NaN
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case 0:
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		// Subnormal half: normalize for float32
+		e := uint32(113)
+		for mant&0x400 == 0 {
+			mant <<= 1
+			e--
+		}
+		return math.Float32frombits(sign | e<<23 | (mant&0x3ff)<<13)
+	default:
+		return math.Float32frombits(sign | (exp+112)<<23 | mant<<13)
+	}
+}
+
+// float16Table maps every half-precision bit pattern to its float32 value, so
+// distance loops expand components with a single load.
+var float16Table = func() *[1 << 16]float32 {
+	var table [1 << 16]float32
+	for i := range table {
+		table[i] = float16ToFloat32(uint16(i))
+	}
+	return &table
+}()
+
+// encodeFloat16 converts a vector to half precision.
+func encodeFloat16(v []float32) []uint16 {
+	out := make([]uint16, len(v))
+	for i, x := range v {
+		out[i] = float32ToFloat16(x)
+	}
+	return out
+}
+
+// decodeFloat16 expands a half-precision vector to float32.
+func decodeFloat16(v []uint16) []float32 {
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float16Table[x]
+	}
+	return out
+}
+
+// setVector stores v in node with the wrapper's precision, in the vector
+// file with MmapVectors. v is copied.
+func (hw *HNSWWrapper) setVector(node *hnswNode, v []float32) error {
+	if hw.MmapVectors {
+		return hw.mapVector(node, v)
+	}
+	if hw.Float16Vectors {
+		node.Vector, node.Vector16 = nil, encodeFloat16(v)
+		return nil
+	}
+	node.Vector, node.Vector16 = slices.Clone(v), nil
+	return nil
+}
+
+// vectorOf returns the vector of node as float32. Half-precision vectors are
+// expanded into a new slice; float32 vectors are returned as stored.
+func (hw *HNSWWrapper) vectorOf(node *hnswNode) []float32 {
+	if node.Vector16 != nil {
+		return decodeFloat16(node.Vector16)
+	}
+	return node.Vector
+}
+
+// vector16Of returns the vector of node in half precision.
+func (hw *HNSWWrapper) vector16Of(node *hnswNode) []uint16 {
+	if node.Vector16 != nil {
+		return node.Vector16
+	}
+	return encodeFloat16(node.Vector)
+}
+
+// readVector reads a vector stored in half precision if half is set, float32
+// otherwise, and stores it in node with the wrapper's precision.
+func (hw *HNSWWrapper) readVector(r io.Reader, node *hnswNode, half bool) error {
+	if half {
+		v := make([]uint16, hw.dimensions)
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return err
+		}
+		if hw.MmapVectors {
+			// Half-precision values survive the round trip through float32
+			return hw.setVector(node, decodeFloat16(v))
+		}
+		if hw.Float16Vectors {
+			node.Vector16 = v
+		} else {
+			node.Vector = decodeFloat16(v)
+		}
+		return nil
+	}
+	v := make([]float32, hw.dimensions)
+	if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+		return err
+	}
+	if hw.MmapVectors {
+		return hw.setVector(node, v)
+	}
+	if hw.Float16Vectors {
+		node.Vector16 = encodeFloat16(v)
+	} else {
+		node.Vector = v
+	}
+	return nil
+}
+
+// writeVector writes the vector of node with the wrapper's precision.
+func (hw *HNSWWrapper) writeVector(w io.Writer, node *hnswNode) error {
+	if hw.Float16Vectors {
+		return binary.Write(w, binary.LittleEndian, hw.vector16Of(node))
+	}
+	return binary.Write(w, binary.LittleEndian, hw.vectorOf(node))
+}
+
+// nodeDistance calculates the distance between query and the vector of node,
+// expanding half-precision components on the fly.
+func (hw *HNSWWrapper) nodeDistance(query []float32, node *hnswNode) float32 {
+	if node.Vector16 == nil {
+		return hw.distance(query, node.Vector)
+	}
+	return metricDistance16(hw.metric, query, node.Vector16)
+}
+
+// metricDistance16 is metricDistance with b in half precision.
+func metricDistance16(metric types.DistanceMetric, a []float32, b []uint16) float32 {
+	table := float16Table
+	switch metric {
+	case types.MetricCosine:
+		var dot, normA, normB float32
+		for i := range a {
+			x := table[b[i]]
+			dot += a[i] * x
+			normA += a[i] * a[i]
+			normB += x * x
+		}
+		if normA == 0 || normB == 0 {
+			return 1.0
+		}
+		return 1.0 - (dot / (float32(math.Sqrt(float64(normA))) * float32(math.Sqrt(float64(normB)))))
+	case types.MetricIP:
+		var dot float32
+		for i := range a {
+			dot += a[i] * table[b[i]]
+		}
+		return -dot
+	case types.MetricJaccard:
+		var intersection, union int
+		for i := range a {
+			inA, inB := a[i] != 0, table[b[i]] != 0
+			if inA && inB {
+				intersection++
+			}
+			if inA || inB {
+				union++
+			}
+		}
+		if union == 0 {
+			return 0
+		}
+		return 1 - float32(intersection)/float32(union)
+	case types.MetricManhattan:
+		var sum float32
+		for i := range a {
+			sum += float32(math.Abs(float64(a[i] - table[b[i]])))
+		}
+		return sum
+	default:
+		var sum float32
+		for i := range a {
+			diff := a[i] - table[b[i]]
+			sum += diff * diff
+		}
+		return sum
+	}
+}
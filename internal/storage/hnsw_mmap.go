@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// vectorFileExt is the extension of the file mapped vectors are kept in,
+// next to the index file: vectors.mmap for vectors.hnsw.
+const vectorFileExt = ".mmap"
+
+// Sizes of the regions a vector file is mapped in. The first region is
+// small, so that small collections stay small, and each next one doubles up
+// to the maximum. Regions are never remapped, since nodes point into them.
+const (
+	minVectorRegionSize = 1 << 20
+	maxVectorRegionSize = 64 << 20
+)
+
+// vectorRegionAlign is the alignment of region offsets in the file, the
+// largest mmap offset granularity of the supported platforms (Windows).
+const vectorRegionAlign = 64 << 10
+
+// vectorFile keeps vectors of a fixed size in a memory-mapped file, so that
+// the operating system can page them out instead of them taking heap memory.
+// The file is scratch space: the index file stays the durable copy, and the
+// vector file is recreated when the index is opened and removed on close.
+// Builds without mmap support keep the slots on the heap. Only one open
+// index may use a path, as with the index file. It is not safe for
+// concurrent use.
+type vectorFile struct {
+	path     string
+	file     *os.File // Nil without mmap support
+	slotSize int      // Bytes per vector
+	regions  [][]byte
+	starts   []uint64 // File offset of each region
+	next     uint64   // Offset of the first slot never handed out
+	free     []uint64 // Offsets of released slots
+}
+
+// openVectorFile creates or truncates the vector file at path, for vectors
+// of slotSize bytes.
+func openVectorFile(path string, slotSize int) (*vectorFile, error) {
+	vf := &vectorFile{path: path, slotSize: slotSize}
+	if mmapSupported {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return nil, err
+		}
+		vf.file = file
+	}
+	return vf, nil
+}
+
+// alloc returns the offset and memory of a free slot, reusing released slots
+// first and mapping a new region when the last one is full.
+func (vf *vectorFile) alloc() (uint64, []byte, error) {
+	if n := len(vf.free); n > 0 {
+		offset := vf.free[n-1]
+		vf.free = vf.free[:n-1]
+		return offset, vf.slot(offset), nil
+	}
+
+	last := len(vf.regions) - 1
+	if last < 0 || vf.next+uint64(vf.slotSize) > vf.starts[last]+uint64(len(vf.regions[last])) {
+		if err := vf.grow(); err != nil {
+			return 0, nil, err
+		}
+	}
+	offset := vf.next
+	vf.next += uint64(vf.slotSize)
+	return offset, vf.slot(offset), nil
+}
+
+// grow maps a new region after the last one and moves next to its start.
+func (vf *vectorFile) grow() error {
+	size := minVectorRegionSize
+	start := uint64(0)
+	if n := len(vf.regions); n > 0 {
+		size = min(2*len(vf.regions[n-1]), maxVectorRegionSize)
+		start = vf.starts[n-1] + uint64(len(vf.regions[n-1]))
+	}
+	// Every region holds at least one slot and ends on the alignment
+	size = max(size, vf.slotSize)
+	size = (size + vectorRegionAlign - 1) / vectorRegionAlign * vectorRegionAlign
+
+	if vf.file != nil {
+		if err := vf.file.Truncate(int64(start) + int64(size)); err != nil {
+			return storageWriteError(vf.path, err)
+		}
+	}
+	region, err := mapRegion(vf.file, int64(start), size)
+	if err != nil {
+		return err
+	}
+	vf.regions = append(vf.regions, region)
+	vf.starts = append(vf.starts, start)
+	vf.next = start
+	return nil
+}
+
+// slot returns the memory of the slot at offset.
+func (vf *vectorFile) slot(offset uint64) []byte {
+	i := sort.Search(len(vf.starts), func(i int) bool { return vf.starts[i] > offset }) - 1
+	pos := offset - vf.starts[i]
+	return vf.regions[i][pos : pos+uint64(vf.slotSize) : pos+uint64(vf.slotSize)]
+}
+
+// release returns the slot at offset for reuse.
+func (vf *vectorFile) release(offset uint64) {
+	vf.free = append(vf.free, offset)
+}
+
+// close unmaps the file and removes it. Memory handed out by alloc must not
+// be used afterwards.
+func (vf *vectorFile) close() error {
+	var firstErr error
+	for _, region := range vf.regions {
+		if err := unmapRegion(region); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	vf.regions, vf.starts, vf.free = nil, nil, nil
+	if vf.file != nil {
+		if err := vf.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := os.Remove(vf.path); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		vf.file = nil
+	}
+	return firstErr
+}
+
+// vectorFilePath returns the path of the vector file of the index.
+func (hw *HNSWWrapper) vectorFilePath() string {
+	return strings.TrimSuffix(hw.filePath, filepath.Ext(hw.filePath)) + vectorFileExt
+}
+
+// mapVector stores v in a slot of the vector file, opening the file first
+// if needed, and points node at it. Caller must hold hw.mu.
+func (hw *HNSWWrapper) mapVector(node *hnswNode, v []float32) error {
+	dims := int(hw.dimensions)
+	if hw.vectors == nil {
+		slotSize := 4 * dims
+		if hw.Float16Vectors {
+			slotSize = 2 * dims
+		}
+		vf, err := openVectorFile(hw.vectorFilePath(), slotSize)
+		if err != nil {
+			return err
+		}
+		hw.vectors = vf
+	}
+
+	offset, slot, err := hw.vectors.alloc()
+	if err != nil {
+		return err
+	}
+	if hw.Float16Vectors {
+		v16 := unsafe.Slice((*uint16)(unsafe.Pointer(&slot[0])), dims)
+		for i, x := range v {
+			v16[i] = float32ToFloat16(x)
+		}
+		node.Vector, node.Vector16 = nil, v16
+	} else {
+		v32 := unsafe.Slice((*float32)(unsafe.Pointer(&slot[0])), dims)
+		copy(v32, v)
+		node.Vector, node.Vector16 = v32, nil
+	}
+	node.vectorOffset, node.mapped = offset, true
+	return nil
+}
+
+// releaseVector returns the slot of node to the vector file, if it has one.
+// The node must not be used afterwards. Caller must hold hw.mu.
+func (hw *HNSWWrapper) releaseVector(node *hnswNode) {
+	if !node.mapped {
+		return
+	}
+	if hw.vectors != nil { // Nil once closed
+		hw.vectors.release(node.vectorOffset)
+	}
+	node.Vector, node.Vector16, node.mapped = nil, nil, false
+}
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"bufio"
 	"container/heap"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -11,8 +13,11 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
 	"sync"
+	"sync/atomic"
 
 	"waddlemap/internal/types"
 )
@@ -25,9 +30,27 @@ const (
 
 // Metric byte encoding
 const (
-	metricByteL2     uint8 = 0
-	metricByteCosine uint8 = 1
-	metricByteIP     uint8 = 2
+	metricByteL2        uint8 = 0
+	metricByteCosine    uint8 = 1
+	metricByteIP        uint8 = 2
+	metricByteJaccard   uint8 = 3
+	metricByteManhattan uint8 = 4
+)
+
+// Delete modes for HNSWWrapper.DeleteMode.
+const (
+	DeleteModeHard = "hard" // Remove the node and its edges immediately
+	DeleteModeSoft = "soft" // Tombstone the node until Compact
+)
+
+// hnswLevelTombstone flags a tombstoned node in the level field of the node table.
+const hnswLevelTombstone uint32 = 1 << 30
+
+// Default HNSW graph parameters.
+const (
+	DefaultM              = 16
+	DefaultEfConstruction = 200
+	DefaultEfSearch       = 100
 )
 
 // HNSWWrapper provides an HNSW index implementation.
@@ -48,33 +71,113 @@ type HNSWWrapper struct {
 	EfSearch       int     // Size of dynamic candidate list during search
 	MaxLevel       int     // Maximum level in the graph
 
+	// DeleteMode selects how Delete removes nodes: DeleteModeHard (the
+	// default when empty) or DeleteModeSoft.
+	DeleteMode string
+	tombstones int // Number of tombstoned nodes
+
+	// DeltaThreshold is the number of changed nodes, counting those already
+	// in the delta file, above which Flush rewrites the whole index instead
+	// of appending a delta. Zero uses DefaultDeltaThreshold.
+	DeltaThreshold int
+
+	// Float16Vectors stores vectors in half precision, halving their memory
+	// at some loss of accuracy. Queries stay float32. It should be set
+	// before any vectors are added.
+	Float16Vectors bool
+
+	// MmapVectors keeps vectors in a memory-mapped file next to the index
+	// file (vectors.mmap for vectors.hnsw) instead of on the heap, so that
+	// the operating system can page them out. The file is scratch space,
+	// rebuilt from the index file on Load and removed by Close. It should be
+	// set before any vectors are added.
+	MmapVectors bool
+	vectors     *vectorFile // Opened by the first mapped vector
+
+	// Normalized has Add scale vectors to unit length in place, so that
+	// cosine distances are computed as 1 - a·b without the norms. Queries
+	// must be unit length as well. It only applies to the cosine metric and
+	// should be set before any vectors are added.
+	Normalized bool
+
+	dirtySet   map[uint64]bool // Nodes added, changed or removed since the last Save or SaveDelta
+	deltaNodes int             // Node records in the delta file
+
 	dirty bool // Set on Add/Delete, cleared on Save
 	mu    sync.RWMutex
+
+	// dirtyCount changes with every change to the nodes. It is drawn from
+	// hnswVersions, so that two indexes never share a value.
+	dirtyCount uint64
+
+	// cache, when set, holds vectors of this index under cacheName. Deleted
+	// vectors are invalidated in it.
+	cache     *VectorCache
+	cacheName string
 }
 
 // hnswNode represents a node in the HNSW graph.
 type hnswNode struct {
 	ID        uint64
-	Vector    []float32
+	Vector    []float32 // Nil when Vector16 holds the vector
+	Vector16  []uint16  // Half-precision vector, with Float16Vectors
 	Level     int
 	Neighbors [][]uint64 // neighbors[level] = list of neighbor IDs
+
+	// Tombstone marks a soft-deleted node. It is still traversed during
+	// search but never returned, until Compact removes it.
+	Tombstone bool
+
+	// vectorOffset is the offset of the vector in the vector file when
+	// mapped is set, with MmapVectors.
+	vectorOffset uint64
+	mapped       bool
 }
 
+// hnswVersions hands out the values of HNSWWrapper.dirtyCount.
+var hnswVersions atomic.Uint64
+
 // NewHNSWWrapper creates a new HNSW wrapper with the given configuration.
 func NewHNSWWrapper(dims uint32, metric types.DistanceMetric, filePath string) (*HNSWWrapper, error) {
 	return &HNSWWrapper{
+		dirtyCount:     hnswVersions.Add(1),
 		nodes:          make(map[uint64]*hnswNode),
+		dirtySet:       make(map[uint64]bool),
 		dimensions:     dims,
 		metric:         metric,
 		filePath:       filePath,
-		M:              16,
-		Ml:             1.0 / math.Log(16),
-		EfConstruction: 200,
-		EfSearch:       100,
+		M:              DefaultM,
+		Ml:             1.0 / math.Log(DefaultM),
+		EfConstruction: DefaultEfConstruction,
+		EfSearch:       DefaultEfSearch,
 		MaxLevel:       0,
 	}, nil
 }
 
+// ApplyOptions overrides the graph parameters with the non-zero fields of opts.
+// It should be called before any vectors are added.
+func (hw *HNSWWrapper) ApplyOptions(opts *types.HNSWOptions) {
+	if opts == nil {
+		return
+	}
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	if opts.M > 1 {
+		hw.M = opts.M
+		hw.Ml = 1.0 / math.Log(float64(opts.M))
+	}
+	if opts.Ml > 0 {
+		hw.Ml = opts.Ml
+	}
+	if opts.EfConstruction > 0 {
+		hw.EfConstruction = opts.EfConstruction
+	}
+	if opts.EfSearch > 0 {
+		hw.EfSearch = opts.EfSearch
+	}
+}
+
 // distanceL2 calculates squared Euclidean distance.
 func distanceL2(a, b []float32) float32 {
 	var sum float32
@@ -99,6 +202,16 @@ func distanceCosine(a, b []float32) float32 {
 	return 1.0 - (dot / (float32(math.Sqrt(float64(normA))) * float32(math.Sqrt(float64(normB)))))
 }
 
+// distanceCosineUnit calculates the cosine distance of unit vectors, where
+// it is 1 - a·b, half their squared L2 distance.
+func distanceCosineUnit(a, b []float32) float32 {
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return 1.0 - dot
+}
+
 // distanceIP calculates negative inner product (for max inner product search).
 func distanceIP(a, b []float32) float32 {
 	var dot float32
@@ -108,13 +221,123 @@ func distanceIP(a, b []float32) float32 {
 	return -dot // Negative because we want to maximize IP
 }
 
+// distanceJaccard calculates the Jaccard distance of the sets of dimensions
+// where a and b are non-zero: 1 - |A ∩ B| / |A ∪ B|. Two zero vectors are at
+// distance 0.
+func distanceJaccard(a, b []float32) float32 {
+	var intersection, union int
+	for i := range a {
+		inA, inB := a[i] != 0, b[i] != 0
+		if inA && inB {
+			intersection++
+		}
+		if inA || inB {
+			union++
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return 1 - float32(intersection)/float32(union)
+}
+
+// distanceManhattan calculates the Manhattan (L1) distance.
+func distanceManhattan(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += float32(math.Abs(float64(a[i] - b[i])))
+	}
+	return sum
+}
+
+// parallelNormalizeThreshold is the batch size below which NormalizeBatchParallel
+// normalizes on the calling goroutine.
+const parallelNormalizeThreshold = 10000
+
+// normalizeVector scales v to unit L2 norm in place. Zero vectors are left unchanged.
+// The loops are unrolled by four so the compiler can keep the accumulators in registers.
+func normalizeVector(v []float32) {
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(v); i += 4 {
+		s0 += v[i] * v[i]
+		s1 += v[i+1] * v[i+1]
+		s2 += v[i+2] * v[i+2]
+		s3 += v[i+3] * v[i+3]
+	}
+	for ; i < len(v); i++ {
+		s0 += v[i] * v[i]
+	}
+	sum := s0 + s1 + s2 + s3
+	if sum == 0 {
+		return
+	}
+
+	inv := float32(1.0 / math.Sqrt(float64(sum)))
+	i = 0
+	for ; i+4 <= len(v); i += 4 {
+		v[i] *= inv
+		v[i+1] *= inv
+		v[i+2] *= inv
+		v[i+3] *= inv
+	}
+	for ; i < len(v); i++ {
+		v[i] *= inv
+	}
+}
+
+// NormalizeBatch normalizes every vector to unit L2 norm in place and returns the batch.
+func NormalizeBatch(vectors [][]float32) [][]float32 {
+	for _, v := range vectors {
+		normalizeVector(v)
+	}
+	return vectors
+}
+
+// NormalizeBatchParallel is NormalizeBatch spread over a pool of workers.
+// Batches smaller than 10k vectors are normalized on the calling goroutine.
+// A non-positive worker count uses one worker per CPU.
+func NormalizeBatchParallel(vectors [][]float32, workers int) [][]float32 {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if len(vectors) < parallelNormalizeThreshold || workers == 1 {
+		return NormalizeBatch(vectors)
+	}
+
+	chunk := (len(vectors) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < len(vectors); start += chunk {
+		end := min(start+chunk, len(vectors))
+		wg.Add(1)
+		go func(part [][]float32) {
+			defer wg.Done()
+			NormalizeBatch(part)
+		}(vectors[start:end])
+	}
+	wg.Wait()
+	return vectors
+}
+
 // distance calculates distance between two vectors using the configured metric.
 func (hw *HNSWWrapper) distance(a, b []float32) float32 {
-	switch hw.metric {
+	if hw.Normalized && hw.metric == types.MetricCosine {
+		return distanceCosineUnit(a, b)
+	}
+	return metricDistance(hw.metric, a, b)
+}
+
+// metricDistance calculates the distance between a and b under metric.
+func metricDistance(metric types.DistanceMetric, a, b []float32) float32 {
+	switch metric {
 	case types.MetricCosine:
 		return distanceCosine(a, b)
 	case types.MetricIP:
 		return distanceIP(a, b)
+	case types.MetricJaccard:
+		return distanceJaccard(a, b)
+	case types.MetricManhattan:
+		return distanceManhattan(a, b)
 	case types.MetricL2:
 		fallthrough
 	default:
@@ -131,7 +354,8 @@ func (hw *HNSWWrapper) randomLevel() int {
 	return level
 }
 
-// Add inserts a vector with the given ID.
+// Add inserts a vector with the given ID. With Normalized, vector is scaled
+// to unit length in place.
 func (hw *HNSWWrapper) Add(vectorID uint64, vector []float32) error {
 	hw.mu.Lock()
 	defer hw.mu.Unlock()
@@ -141,21 +365,29 @@ func (hw *HNSWWrapper) Add(vectorID uint64, vector []float32) error {
 // addUnlocked inserts a vector without acquiring the lock (caller must hold lock).
 func (hw *HNSWWrapper) addUnlocked(vectorID uint64, vector []float32) error {
 	if uint32(len(vector)) != hw.dimensions {
-		return fmt.Errorf("vector dimension mismatch: expected %d, got %d", hw.dimensions, len(vector))
+		return &types.DimensionMismatchError{Subject: "vector", Expected: int(hw.dimensions), Actual: len(vector)}
+	}
+	if hw.Normalized {
+		normalizeVector(vector)
 	}
 
-	if _, exists := hw.nodes[vectorID]; exists {
-		return fmt.Errorf("vector ID %d already exists", vectorID)
+	if existing, exists := hw.nodes[vectorID]; exists {
+		if !existing.Tombstone {
+			return &types.DuplicateIDError{ID: vectorID}
+		}
+		// Re-adding a soft-deleted ID replaces the tombstone
+		hw.deleteUnlocked(vectorID)
 	}
 
 	level := hw.randomLevel()
 	node := &hnswNode{
 		ID:        vectorID,
-		Vector:    make([]float32, len(vector)),
 		Level:     level,
 		Neighbors: make([][]uint64, level+1),
 	}
-	copy(node.Vector, vector)
+	if err := hw.setVector(node, vector); err != nil {
+		return err
+	}
 	for i := range node.Neighbors {
 		node.Neighbors[i] = make([]uint64, 0, hw.M)
 	}
@@ -165,19 +397,19 @@ func (hw *HNSWWrapper) addUnlocked(vectorID uint64, vector []float32) error {
 		hw.entryPoint = vectorID
 		hw.hasEntry = true
 		hw.MaxLevel = level
-		hw.dirty = true
+		hw.markDirty(vectorID)
 		return nil
 	}
 
 	// Find entry point at the top level
 	ep := hw.entryPoint
 	for l := hw.MaxLevel; l > level; l-- {
-		ep = hw.searchLayer(vector, ep, 1, l)[0].ID
+		ep = hw.searchLayer(vector, ep, 1, l, nil)[0].ID
 	}
 
 	// Insert at each level
 	for l := min(level, hw.MaxLevel); l >= 0; l-- {
-		neighbors := hw.searchLayer(vector, ep, hw.EfConstruction, l)
+		neighbors := hw.searchLayer(vector, ep, hw.EfConstruction, l, nil)
 		selectedNeighbors := hw.selectNeighbors(vector, neighbors, hw.M, l)
 
 		node.Neighbors[l] = make([]uint64, 0, len(selectedNeighbors))
@@ -193,7 +425,10 @@ func (hw *HNSWWrapper) addUnlocked(vectorID uint64, vector []float32) error {
 	}
 
 	hw.nodes[vectorID] = node
-	hw.dirty = true
+	hw.markDirty(vectorID)
+	for l := min(level, hw.MaxLevel); l >= 0; l-- {
+		hw.ensureBidirectional(vectorID, l)
+	}
 
 	if level > hw.MaxLevel {
 		hw.MaxLevel = level
@@ -257,16 +492,30 @@ func (h *maxCandidateHeap) Pop() any {
 	return x
 }
 
-// searchLayer performs a greedy search at a given layer.
-func (hw *HNSWWrapper) searchLayer(query []float32, entryID uint64, ef int, level int) []candidate {
+// cancelCheckInterval is the number of candidates searchLayerContext expands
+// between checks of its context.
+const cancelCheckInterval = 100
+
+// searchLayer performs a greedy search at a given layer. With resultChan set,
+// every candidate is also sent to it when popped for expansion, nearest
+// first as far as found so far; the returned results are a subset of them.
+func (hw *HNSWWrapper) searchLayer(query []float32, entryID uint64, ef int, level int, resultChan chan<- candidate) []candidate {
+	results, _ := hw.searchLayerContext(context.Background(), query, entryID, ef, level, resultChan)
+	return results
+}
+
+// searchLayerContext is searchLayer stopping with a *types.CancelledError
+// once ctx is done, checked every cancelCheckInterval candidates. The
+// candidate heaps are dropped with the partial results.
+func (hw *HNSWWrapper) searchLayerContext(ctx context.Context, query []float32, entryID uint64, ef int, level int, resultChan chan<- candidate) ([]candidate, error) {
 	visited := make(map[uint64]bool)
 
 	entryNode := hw.nodes[entryID]
 	if entryNode == nil {
-		return nil
+		return nil, nil
 	}
 
-	entryDist := hw.distance(query, entryNode.Vector)
+	entryDist := hw.nodeDistance(query, entryNode)
 
 	candidates := &candidateHeap{{ID: entryID, Distance: entryDist}}
 	heap.Init(candidates)
@@ -276,12 +525,20 @@ func (hw *HNSWWrapper) searchLayer(query []float32, entryID uint64, ef int, leve
 
 	visited[entryID] = true
 
-	for candidates.Len() > 0 {
+	for expanded := 0; candidates.Len() > 0; expanded++ {
+		if expanded%cancelCheckInterval == cancelCheckInterval-1 {
+			if err := ctx.Err(); err != nil {
+				return nil, &types.CancelledError{Err: err}
+			}
+		}
 		current := heap.Pop(candidates).(candidate)
 
 		if results.Len() > 0 && current.Distance > (*results)[0].Distance && results.Len() >= ef {
 			break
 		}
+		if resultChan != nil {
+			resultChan <- current
+		}
 
 		node := hw.nodes[current.ID]
 		if node == nil || level >= len(node.Neighbors) {
@@ -299,7 +556,7 @@ func (hw *HNSWWrapper) searchLayer(query []float32, entryID uint64, ef int, leve
 				continue
 			}
 
-			dist := hw.distance(query, neighborNode.Vector)
+			dist := hw.nodeDistance(query, neighborNode)
 
 			if results.Len() < ef || dist < (*results)[0].Distance {
 				heap.Push(candidates, candidate{ID: neighborID, Distance: dist})
@@ -317,7 +574,7 @@ func (hw *HNSWWrapper) searchLayer(query []float32, entryID uint64, ef int, leve
 	for i := len(resultSlice) - 1; i >= 0; i-- {
 		resultSlice[i] = heap.Pop(results).(candidate)
 	}
-	return resultSlice
+	return resultSlice, nil
 }
 
 // selectNeighbors selects the best neighbors from candidates.
@@ -343,6 +600,7 @@ func (hw *HNSWWrapper) addConnection(sourceID, targetID uint64, level int) {
 	}
 
 	source.Neighbors[level] = append(source.Neighbors[level], targetID)
+	hw.markDirty(sourceID)
 
 	// Prune if too many connections
 	if len(source.Neighbors[level]) > hw.M*2 {
@@ -358,23 +616,56 @@ func (hw *HNSWWrapper) pruneConnections(nodeID uint64, level int) {
 	}
 
 	// Calculate distances to all neighbors
+	vector := hw.vectorOf(node)
 	candidates := make([]candidate, 0, len(node.Neighbors[level]))
 	for _, neighborID := range node.Neighbors[level] {
 		neighbor := hw.nodes[neighborID]
 		if neighbor != nil {
-			dist := hw.distance(node.Vector, neighbor.Vector)
+			dist := hw.nodeDistance(vector, neighbor)
 			candidates = append(candidates, candidate{ID: neighborID, Distance: dist})
 		}
 	}
 
 	// Sort by distance and keep only M
-	selected := hw.selectNeighbors(node.Vector, candidates, hw.M, level)
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Distance < candidates[j].Distance })
+	selected := hw.selectNeighbors(vector, candidates, hw.M, level)
 	node.Neighbors[level] = make([]uint64, 0, len(selected))
 	for _, c := range selected {
 		node.Neighbors[level] = append(node.Neighbors[level], c.ID)
 	}
 }
 
+// ensureBidirectional reconnects the neighbors of a newly added node that
+// have fewer than M/2 connections at level. Adding the reverse link to the
+// new node can prune a neighbor's list, and a neighbor whose list was short
+// to begin with is never revisited otherwise. Each one is linked both ways to
+// the closest nodes found by searchLayer, starting from the new node, until
+// it has M connections or runs out of candidates. Caller must hold hw.mu.
+func (hw *HNSWWrapper) ensureBidirectional(newNodeID uint64, level int) {
+	node := hw.nodes[newNodeID]
+	if node == nil || level >= len(node.Neighbors) {
+		return
+	}
+
+	minConnections := max(hw.M/2, 1)
+	for _, nid := range node.Neighbors[level] {
+		neighbor := hw.nodes[nid]
+		if neighbor == nil || level >= len(neighbor.Neighbors) || len(neighbor.Neighbors[level]) >= minConnections {
+			continue
+		}
+		for _, c := range hw.searchLayer(hw.vectorOf(neighbor), newNodeID, hw.EfConstruction, level, nil) {
+			if len(neighbor.Neighbors[level]) >= hw.M {
+				break
+			}
+			if c.ID == nid {
+				continue
+			}
+			hw.addConnection(nid, c.ID, level)
+			hw.addConnection(c.ID, nid, level)
+		}
+	}
+}
+
 // HNSWSearchResult represents a single search result from HNSW.
 type HNSWSearchResult struct {
 	VectorID uint64
@@ -382,66 +673,454 @@ type HNSWSearchResult struct {
 }
 
 // Search performs ANN search and returns the k nearest neighbors.
+// It holds only the read lock, so concurrent searches do not block each other.
 func (hw *HNSWWrapper) Search(query []float32, k int, filter *BitSet) ([]HNSWSearchResult, error) {
+	return hw.SearchContext(context.Background(), query, k, filter)
+}
+
+// SearchContext is Search returning a *types.CancelledError, which matches
+// types.ErrCancelled, soon after ctx is done.
+func (hw *HNSWWrapper) SearchContext(ctx context.Context, query []float32, k int, filter *BitSet) ([]HNSWSearchResult, error) {
+	hw.mu.RLock()
+	defer hw.mu.RUnlock()
+	return hw.searchUnlocked(ctx, query, k, hw.EfSearch, filter)
+}
+
+// SearchEf is Search with a candidate list of ef entries instead of
+// EfSearch, trading latency for recall per call.
+func (hw *HNSWWrapper) SearchEf(query []float32, k, ef int, filter *BitSet) ([]HNSWSearchResult, error) {
+	return hw.SearchEfContext(context.Background(), query, k, ef, filter)
+}
+
+// SearchEfContext is SearchEf stopping once ctx is done, as SearchContext.
+func (hw *HNSWWrapper) SearchEfContext(ctx context.Context, query []float32, k, ef int, filter *BitSet) ([]HNSWSearchResult, error) {
+	hw.mu.RLock()
+	defer hw.mu.RUnlock()
+	return hw.searchUnlocked(ctx, query, k, ef, filter)
+}
+
+// BatchSearch runs every query against one read snapshot of the graph, fanning
+// them out across runtime.NumCPU() workers. Results are returned in query order.
+func (hw *HNSWWrapper) BatchSearch(queries [][]float32, k int, filter *BitSet) ([][]HNSWSearchResult, error) {
+	hw.mu.RLock()
+	defer hw.mu.RUnlock()
+
+	for i, q := range queries {
+		if uint32(len(q)) != hw.dimensions {
+			return nil, &types.DimensionMismatchError{Subject: fmt.Sprintf("query %d", i), Expected: int(hw.dimensions), Actual: len(q)}
+		}
+	}
+
+	results := make([][]HNSWSearchResult, len(queries))
+	workers := min(runtime.NumCPU(), len(queries))
+	if workers <= 1 {
+		for i, q := range queries {
+			results[i], _ = hw.searchUnlocked(context.Background(), q, k, hw.EfSearch, filter)
+		}
+		return results, nil
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				// Dimensions were validated above, so searchUnlocked cannot fail
+				results[i], _ = hw.searchUnlocked(context.Background(), queries[i], k, hw.EfSearch, filter)
+			}
+		}()
+	}
+	for i := range queries {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results, nil
+}
+
+// RangeSearch returns every vector within radius of query, sorted by ascending
+// distance. It locates the nearest region with a regular search, then expands
+// outward at level 0 for as long as unvisited neighbors fall within radius.
+// The filter restricts which IDs are returned, not which nodes are traversed.
+func (hw *HNSWWrapper) RangeSearch(query []float32, radius float32, filter *BitSet) ([]HNSWSearchResult, error) {
 	hw.mu.RLock()
 	defer hw.mu.RUnlock()
 
 	if uint32(len(query)) != hw.dimensions {
-		return nil, fmt.Errorf("query dimension mismatch: expected %d, got %d", hw.dimensions, len(query))
+		return nil, &types.DimensionMismatchError{Subject: "query", Expected: int(hw.dimensions), Actual: len(query)}
+	}
+	if !hw.hasEntry {
+		return nil, nil
+	}
+
+	// Navigate from top level to level 0
+	ep := hw.entryPoint
+	for l := hw.MaxLevel; l > 0; l-- {
+		candidates := hw.searchLayer(query, ep, 1, l, nil)
+		if len(candidates) > 0 {
+			ep = candidates[0].ID
+		}
+	}
+
+	// Seed the frontier with the in-range hits of a regular level-0 search
+	visited := make(map[uint64]bool)
+	frontier := &candidateHeap{}
+	var inRange []candidate
+	for _, c := range hw.searchLayer(query, ep, hw.EfSearch, 0, nil) {
+		visited[c.ID] = true
+		if c.Distance <= radius {
+			heap.Push(frontier, c)
+			inRange = append(inRange, c)
+		}
+	}
+
+	// Expand until no unvisited neighbor lies within radius
+	for frontier.Len() > 0 {
+		current := heap.Pop(frontier).(candidate)
+		node := hw.nodes[current.ID]
+		if node == nil || len(node.Neighbors) == 0 {
+			continue
+		}
+		for _, neighborID := range node.Neighbors[0] {
+			if visited[neighborID] {
+				continue
+			}
+			visited[neighborID] = true
+
+			neighborNode := hw.nodes[neighborID]
+			if neighborNode == nil {
+				continue
+			}
+			dist := hw.nodeDistance(query, neighborNode)
+			if dist <= radius {
+				c := candidate{ID: neighborID, Distance: dist}
+				heap.Push(frontier, c)
+				inRange = append(inRange, c)
+			}
+		}
+	}
+
+	sort.Slice(inRange, func(i, j int) bool { return inRange[i].Distance < inRange[j].Distance })
+
+	hasFilter := filter != nil && !filter.IsEmpty()
+	results := make([]HNSWSearchResult, 0, len(inRange))
+	for _, c := range inRange {
+		if hw.nodes[c.ID].Tombstone || (hasFilter && !filter.Contains(c.ID)) {
+			continue
+		}
+		results = append(results, HNSWSearchResult{VectorID: c.ID, Distance: c.Distance})
+	}
+	return results, nil
+}
+
+// searchUnlocked implements Search with a level-0 candidate list of at least
+// ef entries, stopping once ctx is done. It drains the stream of the search
+// and keeps the nearest k hits. Caller must hold hw.mu (read or write).
+func (hw *HNSWWrapper) searchUnlocked(ctx context.Context, query []float32, k, ef int, filter *BitSet) ([]HNSWSearchResult, error) {
+	if uint32(len(query)) != hw.dimensions {
+		return nil, &types.DimensionMismatchError{Subject: "query", Expected: int(hw.dimensions), Actual: len(query)}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, &types.CancelledError{Err: err}
 	}
 
 	if !hw.hasEntry {
 		return nil, nil
 	}
 
+	hasFilter := filter != nil && !filter.IsEmpty()
+	popped, errc := hw.searchStream(ctx, query, max(hw.searchListSize(k, filter), ef))
+	found := make(map[uint64]float32)
+	for c := range popped {
+		if hw.nodes[c.ID].Tombstone || (hasFilter && !filter.Contains(c.ID)) {
+			continue
+		}
+		found[c.ID] = c.Distance
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	results := make([]HNSWSearchResult, 0, len(found))
+	for id, dist := range found {
+		results = append(results, HNSWSearchResult{VectorID: id, Distance: dist})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].VectorID < results[j].VectorID
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// searchStream runs a search of query with a level-0 candidate list of ef
+// entries in a goroutine. Every level-0 candidate is sent to the returned
+// channel when popped for expansion, nearest first as far as found so far,
+// followed by the final candidate list, so candidates may repeat and include
+// tombstones and filtered out nodes. The error channel yields the error of
+// the search, or nil, when the channel is closed. Caller must hold hw.mu and
+// drain the channel.
+func (hw *HNSWWrapper) searchStream(ctx context.Context, query []float32, ef int) (<-chan candidate, <-chan error) {
+	popped := make(chan candidate, 64)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(popped)
+		ep := hw.entryPoint
+		for l := hw.MaxLevel; l > 0; l-- {
+			candidates, err := hw.searchLayerContext(ctx, query, ep, 1, l, nil)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if len(candidates) > 0 {
+				ep = candidates[0].ID
+			}
+		}
+		// Results the search found but stopped before expanding follow
+		// the expanded ones
+		candidates, err := hw.searchLayerContext(ctx, query, ep, ef, 0, popped)
+		for _, c := range candidates {
+			popped <- c
+		}
+		errc <- err
+	}()
+	return popped, errc
+}
+
+// searchListSize returns the number of level-0 candidates needed for k hits
+// surviving filter and tombstones. Caller must hold hw.mu.
+func (hw *HNSWWrapper) searchListSize(k int, filter *BitSet) int {
 	// If we have a filter, search for more results
 	searchK := k
-	hasFilter := filter != nil && !filter.IsEmpty()
-	if hasFilter {
+	if filter != nil && !filter.IsEmpty() {
 		searchK = k * 10
 		if searchK > len(hw.nodes) {
 			searchK = len(hw.nodes)
 		}
 	}
+	// Tombstones are traversed but dropped from the results
+	return searchK + min(hw.tombstones, len(hw.nodes))
+}
 
-	// Navigate from top level to level 0
-	ep := hw.entryPoint
-	for l := hw.MaxLevel; l > 0; l-- {
-		candidates := hw.searchLayer(query, ep, 1, l)
-		if len(candidates) > 0 {
-			ep = candidates[0].ID
+// SearchAsync runs a search in a goroutine and streams up to k hits as the
+// level-0 search pops them, instead of returning them once it completes. Hits
+// arrive roughly nearest first but are not the exact top k: a nearer node may
+// be found after a farther one was sent. The hit channel is closed when the
+// search is done and has room for all k hits, so the caller may stop reading
+// at any point. The error channel then yields the error of the search, or
+// nil. Search drains the same stream and returns the exact top k.
+func (hw *HNSWWrapper) SearchAsync(query []float32, k int, filter *BitSet) (<-chan HNSWSearchResult, <-chan error) {
+	return hw.SearchAsyncContext(context.Background(), query, k, filter)
+}
+
+// SearchAsyncContext is SearchAsync stopping with a *types.CancelledError
+// once ctx is done, as SearchContext.
+func (hw *HNSWWrapper) SearchAsyncContext(ctx context.Context, query []float32, k int, filter *BitSet) (<-chan HNSWSearchResult, <-chan error) {
+	out := make(chan HNSWSearchResult, max(k, 0))
+	errc := make(chan error, 1)
+	go func() {
+		err := hw.searchAsync(ctx, query, k, filter, out)
+		close(out)
+		errc <- err
+	}()
+	return out, errc
+}
+
+// searchAsync implements SearchAsyncContext, sending the hits to out.
+func (hw *HNSWWrapper) searchAsync(ctx context.Context, query []float32, k int, filter *BitSet, out chan<- HNSWSearchResult) error {
+	hw.mu.RLock()
+	defer hw.mu.RUnlock()
+	if uint32(len(query)) != hw.dimensions {
+		return &types.DimensionMismatchError{Subject: "query", Expected: int(hw.dimensions), Actual: len(query)}
+	}
+	if err := ctx.Err(); err != nil {
+		return &types.CancelledError{Err: err}
+	}
+	if !hw.hasEntry || k <= 0 {
+		return nil
+	}
+
+	// The rest of the search is drained, so it never blocks on a send
+	popped, errc := hw.searchStream(ctx, query, max(hw.searchListSize(k, filter), hw.EfSearch))
+	hasFilter := filter != nil && !filter.IsEmpty()
+	seen := make(map[uint64]bool)
+	sent := 0
+	for c := range popped {
+		if sent == k || seen[c.ID] || hw.nodes[c.ID].Tombstone || (hasFilter && !filter.Contains(c.ID)) {
+			continue
 		}
+		seen[c.ID] = true
+		out <- HNSWSearchResult{VectorID: c.ID, Distance: c.Distance}
+		sent++
 	}
+	return <-errc
+}
 
-	// Search at level 0
-	candidates := hw.searchLayer(query, ep, max(searchK, hw.EfSearch), 0)
+// maxRecallQueries bounds the number of queries evaluated by ComputeRecall,
+// since the brute-force ground truth is O(n×d) per query.
+const maxRecallQueries = 100
+
+// ComputeRecall estimates recall@k of the index by comparing Search results
+// against brute-force ground truth over all stored vectors.
+// Only the first maxRecallQueries queries are evaluated, and queries without
+// ground truth are skipped. Returns the mean recall across the evaluated
+// queries, or an error when none could be evaluated.
+func (hw *HNSWWrapper) ComputeRecall(queries [][]float32, k int) (float64, error) {
+	if k <= 0 {
+		return 0, fmt.Errorf("k must be greater than 0")
+	}
+	if len(queries) > maxRecallQueries {
+		queries = queries[:maxRecallQueries]
+	}
+	if len(queries) == 0 {
+		return 0, fmt.Errorf("no queries provided")
+	}
 
-	results := make([]HNSWSearchResult, 0, k)
-	for _, c := range candidates {
-		if hasFilter && !filter.Contains(c.ID) {
+	var total float64
+	evaluated := 0
+	for _, query := range queries {
+		truth, err := hw.bruteForce(query, k)
+		if err != nil {
+			return 0, err
+		}
+		if len(truth) == 0 {
 			continue
 		}
-		results = append(results, HNSWSearchResult{
-			VectorID: c.ID,
-			Distance: c.Distance,
-		})
-		if len(results) >= k {
-			break
+
+		results, err := hw.Search(query, k, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		expected := make(map[uint64]struct{}, len(truth))
+		for _, c := range truth {
+			expected[c.ID] = struct{}{}
 		}
+		hits := 0
+		for _, r := range results {
+			if _, ok := expected[r.VectorID]; ok {
+				hits++
+			}
+		}
+		total += float64(hits) / float64(len(truth))
+		evaluated++
 	}
 
-	return results, nil
+	if evaluated == 0 {
+		return 0, fmt.Errorf("no live vectors to evaluate recall against")
+	}
+	return total / float64(evaluated), nil
+}
+
+// bruteForce returns the exact k nearest neighbors of query, sorted by distance.
+func (hw *HNSWWrapper) bruteForce(query []float32, k int) ([]candidate, error) {
+	hw.mu.RLock()
+	defer hw.mu.RUnlock()
+
+	if uint32(len(query)) != hw.dimensions {
+		return nil, &types.DimensionMismatchError{Subject: "query", Expected: int(hw.dimensions), Actual: len(query)}
+	}
+
+	all := make([]candidate, 0, len(hw.nodes))
+	for id, node := range hw.nodes {
+		if node.Tombstone {
+			continue
+		}
+		all = append(all, candidate{ID: id, Distance: hw.nodeDistance(query, node)})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Distance < all[j].Distance })
+	if len(all) > k {
+		all = all[:k]
+	}
+	return all, nil
+}
+
+// SampleVectors returns copies of up to n randomly chosen stored vectors.
+func (hw *HNSWWrapper) SampleVectors(n int) [][]float32 {
+	hw.mu.RLock()
+	defer hw.mu.RUnlock()
+
+	ids := make([]uint64, 0, len(hw.nodes))
+	for id, node := range hw.nodes {
+		if !node.Tombstone {
+			ids = append(ids, id)
+		}
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	if n < len(ids) {
+		ids = ids[:n]
+	}
+
+	samples := make([][]float32, 0, len(ids))
+	for _, id := range ids {
+		samples = append(samples, slices.Clone(hw.vectorOf(hw.nodes[id])))
+	}
+	return samples
 }
 
-// Delete marks a vector for deletion.
+// Delete removes a vector according to DeleteMode.
 func (hw *HNSWWrapper) Delete(vectorID uint64) error {
 	hw.mu.Lock()
 	defer hw.mu.Unlock()
 
 	node := hw.nodes[vectorID]
-	if node == nil {
+	if node == nil || node.Tombstone {
 		return fmt.Errorf("vector ID %d not found", vectorID)
 	}
+	if hw.DeleteMode == DeleteModeSoft {
+		hw.softDeleteUnlocked(node)
+		return nil
+	}
+	hw.deleteUnlocked(vectorID)
+	return nil
+}
+
+// SoftDelete tombstones a vector regardless of DeleteMode. The node keeps its
+// edges, so paths through it survive, but it is no longer returned by
+// searches. Compact removes tombstoned nodes for good.
+func (hw *HNSWWrapper) SoftDelete(vectorID uint64) error {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	node := hw.nodes[vectorID]
+	if node == nil || node.Tombstone {
+		return fmt.Errorf("vector ID %d not found", vectorID)
+	}
+	hw.softDeleteUnlocked(node)
+	return nil
+}
+
+// SetVectorCache makes Delete invalidate the vectors that collection caches
+// in vc. A nil vc stops it.
+func (hw *HNSWWrapper) SetVectorCache(vc *VectorCache, collection string) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	hw.cache, hw.cacheName = vc, collection
+}
+
+// softDeleteUnlocked tombstones node. Caller must hold hw.mu.
+func (hw *HNSWWrapper) softDeleteUnlocked(node *hnswNode) {
+	node.Tombstone = true
+	hw.tombstones++
+	hw.markDirty(node.ID)
+	if hw.cache != nil {
+		hw.cache.Invalidate(hw.cacheName, node.ID)
+	}
+}
+
+// deleteUnlocked removes a node and its edges. Caller must hold hw.mu.
+func (hw *HNSWWrapper) deleteUnlocked(vectorID uint64) {
+	node := hw.nodes[vectorID]
+	if node.Tombstone {
+		hw.tombstones--
+	}
 
 	// Remove connections from neighbors
 	for level, neighbors := range node.Neighbors {
@@ -452,14 +1131,139 @@ func (hw *HNSWWrapper) Delete(vectorID uint64) error {
 
 	// Remove the node
 	delete(hw.nodes, vectorID)
-	hw.dirty = true
+	hw.releaseVector(node)
+	hw.markDirty(vectorID)
+	if hw.cache != nil {
+		hw.cache.Invalidate(hw.cacheName, vectorID)
+	}
 
 	// Update entry point if needed
 	if hw.entryPoint == vectorID {
 		hw.updateEntryPoint()
 	}
+}
 
-	return nil
+// Compact physically removes all tombstoned nodes and saves the index. Every
+// neighbor list that pointed at a tombstone is rebuilt from its live
+// neighbors plus the live nodes reachable through the removed ones, keeping
+// the closest with selectNeighbors so the graph stays connected.
+func (hw *HNSWWrapper) Compact() error {
+	hw.mu.Lock()
+	if hw.tombstones == 0 {
+		hw.mu.Unlock()
+		return nil
+	}
+
+	for id, node := range hw.nodes {
+		if node.Tombstone {
+			continue
+		}
+		for level, neighbors := range node.Neighbors {
+			if !slices.ContainsFunc(neighbors, func(n uint64) bool { return hw.isTombstone(n) }) {
+				continue
+			}
+			node.Neighbors[level] = hw.reconnect(id, node, neighbors, level)
+		}
+	}
+
+	for id, node := range hw.nodes {
+		if node.Tombstone {
+			delete(hw.nodes, id)
+			hw.releaseVector(node)
+		}
+	}
+	hw.tombstones = 0
+	hw.updateEntryPoint()
+	hw.dirty = true
+	hw.dirtyCount = hnswVersions.Add(1)
+	hw.mu.Unlock()
+
+	return hw.Save()
+}
+
+// Renumber changes every node ID to remap[ID], in the node itself, in the
+// neighbor lists and in the entry point. Nodes whose ID is not in remap are
+// deleted first. The delta file no longer matches the nodes afterwards, so
+// the index must be written with Save rather than Flush.
+func (hw *HNSWWrapper) Renumber(remap map[uint64]uint64) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	for id := range hw.nodes {
+		if _, ok := remap[id]; !ok {
+			hw.deleteUnlocked(id)
+		}
+	}
+
+	nodes := make(map[uint64]*hnswNode, len(hw.nodes))
+	for id, node := range hw.nodes {
+		node.ID = remap[id]
+		for level, neighbors := range node.Neighbors {
+			kept := neighbors[:0]
+			for _, nid := range neighbors {
+				if newID, ok := remap[nid]; ok {
+					kept = append(kept, newID)
+				}
+			}
+			node.Neighbors[level] = kept
+		}
+		nodes[node.ID] = node
+	}
+	hw.nodes = nodes
+	if hw.hasEntry {
+		hw.entryPoint = remap[hw.entryPoint]
+	}
+	clear(hw.dirtySet)
+	hw.dirty = true
+	hw.dirtyCount = hnswVersions.Add(1)
+	if hw.cache != nil {
+		hw.cache.InvalidateCollection(hw.cacheName)
+	}
+}
+
+// isTombstone reports whether id is a tombstoned node. Caller must hold hw.mu.
+func (hw *HNSWWrapper) isTombstone(id uint64) bool {
+	node := hw.nodes[id]
+	return node != nil && node.Tombstone
+}
+
+// reconnect returns a new neighbor list for node at level with tombstones
+// replaced by the live nodes reachable through them. The list keeps its
+// previous length. Caller must hold hw.mu.
+func (hw *HNSWWrapper) reconnect(id uint64, node *hnswNode, neighbors []uint64, level int) []uint64 {
+	seen := map[uint64]bool{id: true}
+	vector := hw.vectorOf(node)
+	var candidates []candidate
+	pending := slices.Clone(neighbors)
+	for len(pending) > 0 {
+		nid := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[nid] {
+			continue
+		}
+		seen[nid] = true
+
+		neighbor := hw.nodes[nid]
+		if neighbor == nil {
+			continue
+		}
+		if neighbor.Tombstone {
+			// Walk through chains of tombstones to the live nodes beyond them
+			if level < len(neighbor.Neighbors) {
+				pending = append(pending, neighbor.Neighbors[level]...)
+			}
+			continue
+		}
+		candidates = append(candidates, candidate{ID: nid, Distance: hw.nodeDistance(vector, neighbor)})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Distance < candidates[j].Distance })
+	selected := hw.selectNeighbors(vector, candidates, len(neighbors), level)
+	result := make([]uint64, 0, len(selected))
+	for _, c := range selected {
+		result = append(result, c.ID)
+	}
+	return result
 }
 
 // removeConnection removes a connection from source to target.
@@ -476,6 +1280,7 @@ func (hw *HNSWWrapper) removeConnection(sourceID, targetID uint64, level int) {
 		}
 	}
 	source.Neighbors[level] = newNeighbors
+	hw.markDirty(sourceID)
 }
 
 // updateEntryPoint finds a new entry point after deletion.
@@ -499,6 +1304,10 @@ func metricToByte(m types.DistanceMetric) uint8 {
 		return metricByteCosine
 	case types.MetricIP:
 		return metricByteIP
+	case types.MetricJaccard:
+		return metricByteJaccard
+	case types.MetricManhattan:
+		return metricByteManhattan
 	default:
 		return metricByteL2
 	}
@@ -511,22 +1320,38 @@ func byteToMetric(b uint8) types.DistanceMetric {
 		return types.MetricCosine
 	case metricByteIP:
 		return types.MetricIP
+	case metricByteJaccard:
+		return types.MetricJaccard
+	case metricByteManhattan:
+		return types.MetricManhattan
 	default:
 		return types.MetricL2
 	}
 }
 
-// Save persists the HNSW index to disk in binary format.
+// Save persists the HNSW index to disk in binary format. The file is
+// replaced atomically, so a crash mid-save keeps the previous snapshot.
 func (hw *HNSWWrapper) Save() error {
-	hw.mu.RLock()
-	defer hw.mu.RUnlock()
+	hw.mu.Lock() // Save clears the dirty flag
+	defer hw.mu.Unlock()
 
-	file, err := os.Create(hw.filePath)
-	if err != nil {
+	if err := writeFileAtomic(hw.filePath, hw.writeSnapshot); err != nil {
 		return err
 	}
-	defer file.Close()
 
+	// The snapshot now includes everything in the delta
+	if err := os.Remove(hw.deltaPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	clear(hw.dirtySet)
+	hw.deltaNodes = 0
+	hw.dirty = false
+	return nil
+}
+
+// writeSnapshot writes the index in the vectors.hnsw format. Caller must
+// hold mu.
+func (hw *HNSWWrapper) writeSnapshot(w *bufio.Writer) error {
 	// Collect and sort node IDs for deterministic output
 	nodeIDs := make([]uint64, 0, len(hw.nodes))
 	for id := range hw.nodes {
@@ -536,6 +1361,11 @@ func (hw *HNSWWrapper) Save() error {
 
 	// Calculate offsets
 	vectorSize := hw.dimensions * 4 // float32 = 4 bytes
+	magic := hnswMagic
+	if hw.Float16Vectors {
+		vectorSize = hw.dimensions * 2
+		magic = hnswMagic16
+	}
 	nodeTableSize := uint32(len(hw.nodes)) * 24
 	vectorSectionOffset := uint32(hnswHeaderSize) + nodeTableSize
 
@@ -563,9 +1393,13 @@ func (hw *HNSWWrapper) Save() error {
 			neighborSize += 2 + uint32(len(neighbors))*8
 		}
 
+		level := uint32(node.Level)
+		if node.Tombstone {
+			level |= hnswLevelTombstone
+		}
 		entries[i] = nodeEntry{
 			id:             id,
-			level:          int32(node.Level),
+			level:          int32(level),
 			vectorOffset:   uint32(i) * vectorSize,
 			neighborOffset: neighborOffset,
 			neighborCount:  totalNeighbors,
@@ -577,7 +1411,7 @@ func (hw *HNSWWrapper) Save() error {
 
 	// Write header (64 bytes)
 	header := make([]byte, hnswHeaderSize)
-	copy(header[0:8], hnswMagic)
+	copy(header[0:8], magic)
 	binary.LittleEndian.PutUint32(header[8:12], hw.dimensions)
 	header[12] = metricToByte(hw.metric)
 	// header[13:16] reserved
@@ -590,7 +1424,7 @@ func (hw *HNSWWrapper) Save() error {
 	}
 	// header[37:64] reserved
 
-	if _, err := file.Write(header); err != nil {
+	if _, err := w.Write(header); err != nil {
 		return err
 	}
 
@@ -602,18 +1436,15 @@ func (hw *HNSWWrapper) Save() error {
 		binary.LittleEndian.PutUint32(nodeBuf[12:16], entry.vectorOffset)
 		binary.LittleEndian.PutUint32(nodeBuf[16:20], neighborSectionOffset+entry.neighborOffset)
 		binary.LittleEndian.PutUint32(nodeBuf[20:24], entry.neighborCount)
-		if _, err := file.Write(nodeBuf); err != nil {
+		if _, err := w.Write(nodeBuf); err != nil {
 			return err
 		}
 	}
 
 	// Write vector data
 	for _, id := range nodeIDs {
-		node := hw.nodes[id]
-		for _, v := range node.Vector {
-			if err := binary.Write(file, binary.LittleEndian, v); err != nil {
-				return err
-			}
+		if err := hw.writeVector(w, hw.nodes[id]); err != nil {
+			return err
 		}
 	}
 
@@ -621,34 +1452,35 @@ func (hw *HNSWWrapper) Save() error {
 	for _, id := range nodeIDs {
 		node := hw.nodes[id]
 		// Write level count
-		if err := binary.Write(file, binary.LittleEndian, uint16(len(node.Neighbors))); err != nil {
+		if err := binary.Write(w, binary.LittleEndian, uint16(len(node.Neighbors))); err != nil {
 			return err
 		}
 		for _, neighbors := range node.Neighbors {
 			// Write neighbor count for this level
-			if err := binary.Write(file, binary.LittleEndian, uint16(len(neighbors))); err != nil {
+			if err := binary.Write(w, binary.LittleEndian, uint16(len(neighbors))); err != nil {
 				return err
 			}
 			// Write neighbor IDs
 			for _, nid := range neighbors {
-				if err := binary.Write(file, binary.LittleEndian, nid); err != nil {
+				if err := binary.Write(w, binary.LittleEndian, nid); err != nil {
 					return err
 				}
 			}
 		}
 	}
 
-	hw.dirty = false
 	return nil
 }
 
-// Load reads an HNSW index from disk in binary format.
+// Load reads an HNSW index from disk in binary format, then applies the
+// delta file on top of it if there is one.
 func (hw *HNSWWrapper) Load() error {
 	hw.mu.Lock()
 	defer hw.mu.Unlock()
 
 	if _, err := os.Stat(hw.filePath); os.IsNotExist(err) {
-		return nil
+		// Changes made before the first full save are only in the delta
+		return hw.applyDelta()
 	}
 
 	file, err := os.Open(hw.filePath)
@@ -663,9 +1495,14 @@ func (hw *HNSWWrapper) Load() error {
 		return fmt.Errorf("failed to read header: %w", err)
 	}
 
-	// Validate magic
-	if string(header[0:8]) != hnswMagic {
-		return errors.New("invalid HNSW file: wrong magic number")
+	// Validate magic; either precision is converted to the configured one
+	var half bool
+	switch string(header[0:8]) {
+	case hnswMagic:
+	case hnswMagic16:
+		half = true
+	default:
+		return &types.IndexCorruptedError{Path: hw.filePath, Err: errors.New("wrong magic number")}
 	}
 
 	// Parse header
@@ -679,10 +1516,10 @@ func (hw *HNSWWrapper) Load() error {
 
 	// Validate
 	if dimensions != hw.dimensions {
-		return fmt.Errorf("dimension mismatch: file has %d, expected %d", dimensions, hw.dimensions)
+		return &types.DimensionMismatchError{Subject: "index file", Expected: int(hw.dimensions), Actual: int(dimensions)}
 	}
 	if metric != hw.metric {
-		return fmt.Errorf("metric mismatch: file has %s, expected %s", metric, hw.metric)
+		return &types.MetricMismatchError{Subject: "index file", Expected: hw.metric, Actual: metric}
 	}
 
 	// Read node table
@@ -697,7 +1534,7 @@ func (hw *HNSWWrapper) Load() error {
 	for i := uint32(0); i < nodeCount; i++ {
 		nodeBuf := make([]byte, 24)
 		if _, err := io.ReadFull(file, nodeBuf); err != nil {
-			return fmt.Errorf("failed to read node table entry %d: %w", i, err)
+			return &types.IndexCorruptedError{Path: hw.filePath, Err: fmt.Errorf("failed to read node table entry %d: %w", i, err)}
 		}
 		entries[i] = nodeEntry{
 			id:             binary.LittleEndian.Uint64(nodeBuf[0:8]),
@@ -710,17 +1547,20 @@ func (hw *HNSWWrapper) Load() error {
 
 	// Read vectors
 	nodes := make(map[uint64]*hnswNode)
+	tombstones := 0
 	for _, entry := range entries {
-		vector := make([]float32, dimensions)
-		for j := uint32(0); j < dimensions; j++ {
-			if err := binary.Read(file, binary.LittleEndian, &vector[j]); err != nil {
-				return fmt.Errorf("failed to read vector for node %d: %w", entry.id, err)
-			}
+		level := uint32(entry.level)
+		node := &hnswNode{
+			ID:        entry.id,
+			Level:     int(level &^ hnswLevelTombstone),
+			Tombstone: level&hnswLevelTombstone != 0,
+		}
+		if err := hw.readVector(file, node, half); err != nil {
+			return &types.IndexCorruptedError{Path: hw.filePath, Err: fmt.Errorf("failed to read vector for node %d: %w", entry.id, err)}
 		}
-		nodes[entry.id] = &hnswNode{
-			ID:     entry.id,
-			Vector: vector,
-			Level:  int(entry.level),
+		nodes[entry.id] = node
+		if nodes[entry.id].Tombstone {
+			tombstones++
 		}
 	}
 
@@ -729,30 +1569,34 @@ func (hw *HNSWWrapper) Load() error {
 		node := nodes[entry.id]
 		var levelCount uint16
 		if err := binary.Read(file, binary.LittleEndian, &levelCount); err != nil {
-			return fmt.Errorf("failed to read level count for node %d: %w", entry.id, err)
+			return &types.IndexCorruptedError{Path: hw.filePath, Err: fmt.Errorf("failed to read level count for node %d: %w", entry.id, err)}
 		}
 		node.Neighbors = make([][]uint64, levelCount)
 		for l := uint16(0); l < levelCount; l++ {
 			var neighborCount uint16
 			if err := binary.Read(file, binary.LittleEndian, &neighborCount); err != nil {
-				return fmt.Errorf("failed to read neighbor count for node %d level %d: %w", entry.id, l, err)
+				return &types.IndexCorruptedError{Path: hw.filePath, Err: fmt.Errorf("failed to read neighbor count for node %d level %d: %w", entry.id, l, err)}
 			}
 			node.Neighbors[l] = make([]uint64, neighborCount)
 			for n := uint16(0); n < neighborCount; n++ {
 				if err := binary.Read(file, binary.LittleEndian, &node.Neighbors[l][n]); err != nil {
-					return fmt.Errorf("failed to read neighbor for node %d: %w", entry.id, err)
+					return &types.IndexCorruptedError{Path: hw.filePath, Err: fmt.Errorf("failed to read neighbor for node %d: %w", entry.id, err)}
 				}
 			}
 		}
 	}
 
+	for _, node := range hw.nodes {
+		hw.releaseVector(node)
+	}
 	hw.nodes = nodes
+	hw.tombstones = tombstones
 	hw.entryPoint = entryPoint
 	hw.hasEntry = hasEntry
 	hw.MaxLevel = maxLevel
 	hw.dirty = false
 
-	return nil
+	return hw.applyDelta()
 }
 
 // IsDirty returns true if the index has unsaved changes.
@@ -762,11 +1606,165 @@ func (hw *HNSWWrapper) IsDirty() bool {
 	return hw.dirty
 }
 
-// Count returns the number of vectors in the index.
+// DirtyCount returns the version of the nodes: it changes whenever a node is
+// added, changed or removed, and no other index has had it.
+func (hw *HNSWWrapper) DirtyCount() uint64 {
+	hw.mu.RLock()
+	defer hw.mu.RUnlock()
+	return hw.dirtyCount
+}
+
+// Count returns the number of vectors in the index, excluding tombstones.
 func (hw *HNSWWrapper) Count() uint64 {
 	hw.mu.RLock()
 	defer hw.mu.RUnlock()
-	return uint64(len(hw.nodes))
+	return uint64(len(hw.nodes) - hw.tombstones)
+}
+
+// HNSWStats summarizes the shape and parameters of an HNSW graph. Degrees
+// count the level-0 neighbors of a node, tombstones included.
+type HNSWStats struct {
+	Nodes          int    `json:"nodes"`
+	Tombstones     int    `json:"tombstones"`
+	MaxLevel       int    `json:"max_level"`
+	EntryPoint     uint64 `json:"entry_point"`
+	HasEntry       bool   `json:"has_entry"`
+	M              int    `json:"m"`
+	EfConstruction int    `json:"ef_construction"`
+	EfSearch       int    `json:"ef_search"`
+
+	EdgeCountPerLevel []int       `json:"edge_count_per_level"` // Directed edges at each level
+	AvgDegree         float64     `json:"avg_degree"`
+	MaxDegree         int         `json:"max_degree"`
+	MinDegree         int         `json:"min_degree"`
+	UnconnectedNodes  int         `json:"unconnected_nodes"`  // Nodes without level-0 neighbors
+	LevelDistribution map[int]int `json:"level_distribution"` // Top level -> number of nodes
+}
+
+// Stats returns a snapshot of the graph's statistics.
+func (hw *HNSWWrapper) Stats() HNSWStats {
+	hw.mu.RLock()
+	defer hw.mu.RUnlock()
+
+	stats := HNSWStats{
+		Nodes:             len(hw.nodes),
+		Tombstones:        hw.tombstones,
+		MaxLevel:          hw.MaxLevel,
+		EntryPoint:        hw.entryPoint,
+		HasEntry:          hw.hasEntry,
+		M:                 hw.M,
+		EfConstruction:    hw.EfConstruction,
+		EfSearch:          hw.EfSearch,
+		EdgeCountPerLevel: make([]int, hw.MaxLevel+1),
+		LevelDistribution: make(map[int]int),
+	}
+	if len(hw.nodes) == 0 {
+		return stats
+	}
+
+	stats.MinDegree = math.MaxInt
+	totalDegree := 0
+	for _, node := range hw.nodes {
+		stats.LevelDistribution[node.Level]++
+		for l, neighbors := range node.Neighbors {
+			for len(stats.EdgeCountPerLevel) <= l {
+				stats.EdgeCountPerLevel = append(stats.EdgeCountPerLevel, 0)
+			}
+			stats.EdgeCountPerLevel[l] += len(neighbors)
+		}
+
+		degree := 0
+		if len(node.Neighbors) > 0 {
+			degree = len(node.Neighbors[0])
+		}
+		if degree == 0 {
+			stats.UnconnectedNodes++
+		}
+		stats.MaxDegree = max(stats.MaxDegree, degree)
+		stats.MinDegree = min(stats.MinDegree, degree)
+		totalDegree += degree
+	}
+	stats.AvgDegree = float64(totalDegree) / float64(len(hw.nodes))
+	return stats
+}
+
+// Validate checks the graph's structural invariants and returns a warning for
+// each violation found: links to missing nodes or to levels a neighbor does
+// not have, nodes without neighbors at level 0, oversized neighbor lists and
+// an inconsistent entry point. A
+// healthy graph returns no warnings.
+func (hw *HNSWWrapper) Validate() []string {
+	hw.mu.RLock()
+	defer hw.mu.RUnlock()
+
+	ids := make([]uint64, 0, len(hw.nodes))
+	for id := range hw.nodes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids) // Stable warning order
+
+	var warnings []string
+	missing := make(map[uint64]int) // Missing neighbor -> number of referencing links
+	topLevel := 0
+	for _, id := range ids {
+		node := hw.nodes[id]
+		topLevel = max(topLevel, node.Level)
+		if node.ID != id {
+			warnings = append(warnings, fmt.Sprintf("node %d is stored under ID %d", node.ID, id))
+		}
+		if len(node.Neighbors) > node.Level+1 {
+			warnings = append(warnings, fmt.Sprintf("node %d has neighbor lists for %d levels but level %d",
+				id, len(node.Neighbors), node.Level))
+		}
+		for l, neighbors := range node.Neighbors {
+			if len(neighbors) == 0 && l == 0 && len(hw.nodes) > 1 {
+				warnings = append(warnings, fmt.Sprintf("node %d has no neighbors at level 0", id))
+			}
+			if len(neighbors) > 2*hw.M {
+				warnings = append(warnings, fmt.Sprintf("node %d has %d neighbors at level %d, above the limit of %d",
+					id, len(neighbors), l, 2*hw.M))
+			}
+			for _, nid := range neighbors {
+				neighbor, ok := hw.nodes[nid]
+				switch {
+				case !ok:
+					missing[nid]++
+				case nid == id:
+					warnings = append(warnings, fmt.Sprintf("node %d links to itself at level %d", id, l))
+				case neighbor.Level < l:
+					warnings = append(warnings, fmt.Sprintf("node %d links to node %d at level %d, above that node's level %d",
+						id, nid, l, neighbor.Level))
+				}
+			}
+		}
+	}
+
+	missingIDs := make([]uint64, 0, len(missing))
+	for nid := range missing {
+		missingIDs = append(missingIDs, nid)
+	}
+	slices.Sort(missingIDs)
+	for _, nid := range missingIDs {
+		warnings = append(warnings, fmt.Sprintf("node %d is missing but referenced by %d links", nid, missing[nid]))
+	}
+
+	switch {
+	case !hw.hasEntry && len(hw.nodes) > 0:
+		warnings = append(warnings, fmt.Sprintf("graph has %d nodes but no entry point", len(hw.nodes)))
+	case hw.hasEntry:
+		entry, ok := hw.nodes[hw.entryPoint]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("entry point %d is missing", hw.entryPoint))
+		} else if entry.Level != hw.MaxLevel {
+			warnings = append(warnings, fmt.Sprintf("entry point %d has level %d but MaxLevel is %d",
+				hw.entryPoint, entry.Level, hw.MaxLevel))
+		}
+		if topLevel > hw.MaxLevel {
+			warnings = append(warnings, fmt.Sprintf("a node has level %d, above MaxLevel %d", topLevel, hw.MaxLevel))
+		}
+	}
+
+	return warnings
 }
 
 // Dimensions returns the configured dimensions.
@@ -779,28 +1777,207 @@ func (hw *HNSWWrapper) Metric() types.DistanceMetric {
 	return hw.metric
 }
 
-// Close releases all resources held by the index.
+// Close releases all resources held by the index. With MmapVectors the
+// vectors are unmapped, so the index must not be used afterwards.
 func (hw *HNSWWrapper) Close() error {
-	return nil
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if hw.vectors == nil {
+		return nil
+	}
+	err := hw.vectors.close()
+	hw.vectors = nil
+	return err
 }
 
 // Contains checks if a vector ID exists in the index.
 func (hw *HNSWWrapper) Contains(vectorID uint64) bool {
 	hw.mu.RLock()
 	defer hw.mu.RUnlock()
-	_, exists := hw.nodes[vectorID]
-	return exists
+	node, exists := hw.nodes[vectorID]
+	return exists && !node.Tombstone
+}
+
+// GetVector returns the stored vector for vectorID. Half-precision vectors
+// are expanded to float32, and mapped vectors copied, since their memory is
+// reused once they are deleted.
+func (hw *HNSWWrapper) GetVector(vectorID uint64) ([]float32, bool) {
+	hw.mu.RLock()
+	defer hw.mu.RUnlock()
+	node, ok := hw.nodes[vectorID]
+	if !ok || node.Tombstone {
+		return nil, false
+	}
+	if node.mapped && node.Vector != nil {
+		return slices.Clone(node.Vector), true
+	}
+	return hw.vectorOf(node), true
 }
 
+// VectorIDs returns the IDs of all vectors in the index, in no particular order.
+func (hw *HNSWWrapper) VectorIDs() []uint64 {
+	hw.mu.RLock()
+	defer hw.mu.RUnlock()
+	ids := make([]uint64, 0, len(hw.nodes))
+	for id, node := range hw.nodes {
+		if !node.Tombstone {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// CurrentMetaVersion is the CollectionMeta schema version written by this build.
+// Bump it and extend migrateMeta whenever CollectionMeta gains a field that
+// older meta.json files lack.
+//
+// Version history:
+//   - 0: name, dimensions, metric, secondary_hnsw
+//   - 1: version, hnsw (primary graph parameters)
+const CurrentMetaVersion = 1
+
 // CollectionMeta holds collection metadata for persistence.
 type CollectionMeta struct {
+	Version    int                  `json:"version"`
 	Name       string               `json:"name"`
 	Dimensions uint32               `json:"dimensions"`
 	Metric     types.DistanceMetric `json:"metric"`
+
+	// IndexType is the primary index kind; empty means HNSW.
+	IndexType string `json:"index_type,omitempty"`
+
+	// IndexCompression and PQSubspaces mirror CollectionConfig; empty means
+	// uncompressed.
+	IndexCompression string `json:"index_compression,omitempty"`
+	PQSubspaces      int    `json:"pq_subspaces,omitempty"`
+	Float16Vectors   bool   `json:"float16_vectors,omitempty"`
+	MmapVectors      bool   `json:"mmap_vectors,omitempty"`
+	AutoNormalize    bool   `json:"auto_normalize,omitempty"`
+
+	// NGramSizes and TokenizationMode mirror CollectionConfig; empty means
+	// n-gram tokenization by trigrams.
+	NGramSizes       []int  `json:"ngram_sizes,omitempty"`
+	TokenizationMode string `json:"tokenization_mode,omitempty"`
+
+	// HNSW holds the primary graph parameters.
+	HNSW          *types.HNSWOptions `json:"hnsw,omitempty"`
+	SecondaryHNSW *types.HNSWOptions `json:"secondary_hnsw,omitempty"`
+
+	// LearnedEfSearch is the EfSearch AdaptiveSearch converged to; zero
+	// until it has run.
+	LearnedEfSearch float64 `json:"learned_ef_search,omitempty"`
+}
+
+// migrateMeta upgrades meta in place to CurrentMetaVersion, filling in
+// defaults for fields older versions did not record.
+func migrateMeta(meta *CollectionMeta) {
+	if meta.Version < 1 {
+		// Version 0 collections were always built with the default parameters
+		if meta.HNSW == nil {
+			meta.HNSW = &types.HNSWOptions{}
+		}
+		if meta.HNSW.M == 0 {
+			meta.HNSW.M = DefaultM
+		}
+		if meta.HNSW.EfConstruction == 0 {
+			meta.HNSW.EfConstruction = DefaultEfConstruction
+		}
+		if meta.HNSW.EfSearch == 0 {
+			meta.HNSW.EfSearch = DefaultEfSearch
+		}
+	}
+	meta.Version = CurrentMetaVersion
+}
+
+// MigrateAllCollections upgrades the meta.json of every collection in the data
+// directory basePath to CurrentMetaVersion. Collections already current are left
+// alone. It must not run while a server has the data path open.
+func MigrateAllCollections(basePath string) error {
+	indexesPath := filepath.Join(basePath, "indexes")
+	entries, err := os.ReadDir(indexesPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		collPath := filepath.Join(indexesPath, entry.Name())
+		meta, err := LoadCollectionMeta(collPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // Not a collection directory
+			}
+			return fmt.Errorf("failed to read %s: %w", collPath, err)
+		}
+		if meta.Version > CurrentMetaVersion {
+			return fmt.Errorf("collection %s has meta version %d, newer than supported %d", meta.Name, meta.Version, CurrentMetaVersion)
+		}
+		if meta.Version == CurrentMetaVersion {
+			continue
+		}
+		migrateMeta(meta)
+		if err := SaveCollectionMeta(collPath, meta); err != nil {
+			return fmt.Errorf("failed to save migrated meta for %s: %w", meta.Name, err)
+		}
+	}
+	return nil
 }
 
-// ValidateCollectionConfig validates collection configuration.
-func ValidateCollectionConfig(config *types.CollectionConfig) error {
+// resolveHNSWOptions returns opts with zero fields replaced by the defaults.
+func resolveHNSWOptions(opts *types.HNSWOptions) *types.HNSWOptions {
+	resolved := types.HNSWOptions{M: DefaultM, EfConstruction: DefaultEfConstruction, EfSearch: DefaultEfSearch}
+	if opts != nil {
+		if opts.M != 0 {
+			resolved.M = opts.M
+		}
+		if opts.EfConstruction != 0 {
+			resolved.EfConstruction = opts.EfConstruction
+		}
+		if opts.EfSearch != 0 {
+			resolved.EfSearch = opts.EfSearch
+		}
+		resolved.Ml = opts.Ml
+	}
+	return &resolved
+}
+
+// validateHNSWOptions checks the graph parameters opts resolves to.
+func validateHNSWOptions(opts *types.HNSWOptions) error {
+	r := resolveHNSWOptions(opts)
+	if r.M < 2 {
+		return fmt.Errorf("HNSW M must be at least 2, got %d", r.M)
+	}
+	if r.EfConstruction < r.M {
+		return fmt.Errorf("HNSW ef_construction (%d) must be at least M (%d)", r.EfConstruction, r.M)
+	}
+	if r.EfSearch < 1 {
+		return fmt.Errorf("HNSW ef_search must be at least 1, got %d", r.EfSearch)
+	}
+	if r.Ml < 0 || r.Ml >= 1 {
+		return fmt.Errorf("HNSW ml must be in [0,1), got %v", r.Ml)
+	}
+	return nil
+}
+
+// ValidateCollectionConfig validates collection configuration. The error it
+// returns is a *types.InvalidConfigError. A valid config may come with
+// warnings about likely mistakes, such as a cosine collection without
+// AutoNormalize.
+func ValidateCollectionConfig(config *types.CollectionConfig) ([]Warning, error) {
+	if err := validateCollectionConfig(config); err != nil {
+		return nil, &types.InvalidConfigError{Collection: config.Name, Err: err}
+	}
+	if config.Metric == types.MetricCosine && !config.AutoNormalize {
+		return []Warning{{
+			Code:    WarningAutoNormalizeOff,
+			Message: "cosine collection without auto normalize computes vector norms in every distance; store unit-length vectors or enable auto normalize",
+		}}, nil
+	}
+	return nil, nil
+}
+
+func validateCollectionConfig(config *types.CollectionConfig) error {
 	if config.Name == "" {
 		return errors.New("collection name cannot be empty")
 	}
@@ -808,11 +1985,76 @@ func ValidateCollectionConfig(config *types.CollectionConfig) error {
 		return errors.New("dimensions must be greater than 0")
 	}
 	switch config.Metric {
-	case types.MetricL2, types.MetricCosine, types.MetricIP:
+	case types.MetricL2, types.MetricCosine, types.MetricIP, types.MetricJaccard, types.MetricManhattan:
 		// Valid
 	default:
 		return fmt.Errorf("invalid metric: %s", config.Metric)
 	}
+	if config.AutoNormalize && config.Metric != types.MetricCosine {
+		return errors.New("auto normalize requires the cosine metric")
+	}
+	switch config.IndexType {
+	case "", types.IndexTypeHNSW:
+		// Valid
+	case types.IndexTypeFlat:
+		if config.HNSWOptions != nil {
+			return errors.New("hnsw options require index type hnsw")
+		}
+		if config.Float16Vectors {
+			return errors.New("float16 vectors require index type hnsw")
+		}
+		if config.MmapVectors {
+			return errors.New("mmap vectors require index type hnsw")
+		}
+	default:
+		return fmt.Errorf("invalid index type: %s", config.IndexType)
+	}
+	switch config.IndexCompression {
+	case "", types.CompressionNone:
+		if config.PQSubspaces != 0 {
+			return errors.New("pq subspaces require pq compression")
+		}
+	case types.CompressionPQ:
+		if config.IndexType == types.IndexTypeHNSW || config.HNSWOptions != nil || config.Float16Vectors || config.MmapVectors {
+			return errors.New("pq compression requires index type flat")
+		}
+		// PQ distance tables only decompose the L2 and dot product metrics
+		if config.Metric == types.MetricJaccard || config.Metric == types.MetricManhattan {
+			return fmt.Errorf("pq compression does not support the %s metric", config.Metric)
+		}
+		if config.PQSubspaces < 0 || config.PQSubspaces > int(config.Dimensions) ||
+			(config.PQSubspaces > 0 && config.Dimensions%uint32(config.PQSubspaces) != 0) {
+			return fmt.Errorf("pq subspaces %d must divide dimensions %d", config.PQSubspaces, config.Dimensions)
+		}
+	default:
+		return fmt.Errorf("invalid index compression: %s", config.IndexCompression)
+	}
+	switch config.TokenizationMode {
+	case "", TokenizeNGram, TokenizeCJKChar:
+		// Valid
+	case TokenizeWhitespace:
+		if len(config.NGramSizes) > 0 {
+			return errors.New("n-gram sizes do not apply to whitespace tokenization")
+		}
+	default:
+		return fmt.Errorf("invalid tokenization mode: %s", config.TokenizationMode)
+	}
+	for i, n := range config.NGramSizes {
+		if n < 1 || n > MaxKeywordLength {
+			return fmt.Errorf("n-gram size must be between 1 and %d, got %d", MaxKeywordLength, n)
+		}
+		if slices.Contains(config.NGramSizes[:i], n) {
+			return fmt.Errorf("duplicate n-gram size %d", n)
+		}
+	}
+	if err := validateHNSWOptions(config.HNSWOptions); err != nil {
+		return err
+	}
+	if config.SecondaryHNSWOptions != nil {
+		if err := validateHNSWOptions(config.SecondaryHNSWOptions); err != nil {
+			return fmt.Errorf("secondary graph: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,1144 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"waddlemap/internal/types"
+)
+
+func TestHNSWWrapper_ComputeRecallExact(t *testing.T) {
+	hw, err := NewHNSWWrapper(8, types.MetricL2, filepath.Join(t.TempDir(), "vectors.hnsw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A small index with EfSearch larger than the node count is searched exhaustively.
+	rng := rand.New(rand.NewSource(42))
+	for i := uint64(1); i <= 50; i++ {
+		vec := make([]float32, 8)
+		for j := range vec {
+			vec[j] = rng.Float32()
+		}
+		if err := hw.Add(i, vec); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	recall, err := hw.ComputeRecall(hw.SampleVectors(20), 5)
+	if err != nil {
+		t.Fatalf("ComputeRecall failed: %v", err)
+	}
+	if recall != 1.0 {
+		t.Errorf("Expected recall 1.0, got %f", recall)
+	}
+}
+
+func TestHNSWWrapper_ComputeRecallNoGroundTruth(t *testing.T) {
+	hw, err := NewHNSWWrapper(2, types.MetricL2, filepath.Join(t.TempDir(), "vectors.hnsw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hw.Add(1, []float32{1, 0}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := hw.Delete(1); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	// Every node is tombstoned, so no query has ground truth to compare against
+	if recall, err := hw.ComputeRecall([][]float32{{1, 0}, {0, 1}}, 5); err == nil {
+		t.Errorf("Expected an error with no evaluated queries, got recall %f", recall)
+	}
+}
+
+func TestNormalizeBatch_UnitNorm(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	randomBatch := func(n, dims int) [][]float32 {
+		vectors := make([][]float32, n)
+		for i := range vectors {
+			vectors[i] = make([]float32, dims)
+			for j := range vectors[i] {
+				vectors[i][j] = rng.Float32()*10 - 5
+			}
+		}
+		return vectors
+	}
+
+	checkUnit := func(name string, vectors [][]float32) {
+		for i, v := range vectors {
+			var sum float64
+			for _, x := range v {
+				sum += float64(x) * float64(x)
+			}
+			if math.Abs(math.Sqrt(sum)-1) > 1e-5 {
+				t.Fatalf("%s: vector %d has norm %f, want 1", name, i, math.Sqrt(sum))
+			}
+		}
+	}
+
+	// 13 dimensions exercises the unrolled loop remainder.
+	checkUnit("NormalizeBatch", NormalizeBatch(randomBatch(100, 13)))
+	checkUnit("NormalizeBatchParallel", NormalizeBatchParallel(randomBatch(parallelNormalizeThreshold+7, 13), 4))
+
+	zero := NormalizeBatch([][]float32{{0, 0, 0}})
+	for _, x := range zero[0] {
+		if x != 0 {
+			t.Fatalf("Expected zero vector to stay zero, got %v", zero[0])
+		}
+	}
+}
+
+// newRandomHNSW builds an L2 index of n random vectors with IDs 1..n.
+func newRandomHNSW(tb testing.TB, dims, n int, seed int64) *HNSWWrapper {
+	tb.Helper()
+	hw, err := NewHNSWWrapper(uint32(dims), types.MetricL2, filepath.Join(tb.TempDir(), "vectors.hnsw"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	for i := 1; i <= n; i++ {
+		if err := hw.Add(uint64(i), randomVector(rng, dims)); err != nil {
+			tb.Fatalf("Add failed: %v", err)
+		}
+	}
+	return hw
+}
+
+func TestHNSWWrapper_BatchSearchMatchesSearch(t *testing.T) {
+	hw := newRandomHNSW(t, 16, 500, 3)
+	rng := rand.New(rand.NewSource(4))
+	queries := make([][]float32, 40)
+	for i := range queries {
+		queries[i] = randomVector(rng, 16)
+	}
+	filter := NewBitSet()
+	for id := uint64(1); id <= 500; id += 2 {
+		filter.Set(id)
+	}
+
+	batch, err := hw.BatchSearch(queries, 10, filter)
+	if err != nil {
+		t.Fatalf("BatchSearch failed: %v", err)
+	}
+	if len(batch) != len(queries) {
+		t.Fatalf("Expected %d result sets, got %d", len(queries), len(batch))
+	}
+	for i, q := range queries {
+		want, err := hw.Search(q, 10, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(batch[i], want) {
+			t.Errorf("Query %d: BatchSearch %v, Search %v", i, batch[i], want)
+		}
+	}
+
+	if _, err := hw.BatchSearch([][]float32{queries[0], {1, 2}}, 10, nil); err == nil {
+		t.Error("Expected dimension mismatch error")
+	}
+}
+
+// BenchmarkHNSWSearch compares one-at-a-time searches, concurrent searches
+// sharing the read lock, and BatchSearch over the same queries.
+func BenchmarkHNSWSearch(b *testing.B) {
+	const dims, batchSize = 64, 64
+	hw := newRandomHNSW(b, dims, 5000, 1)
+	rng := rand.New(rand.NewSource(2))
+	queries := make([][]float32, batchSize)
+	for i := range queries {
+		queries[i] = randomVector(rng, dims)
+	}
+
+	b.Run("Sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, q := range queries {
+				hw.Search(q, 10, nil)
+			}
+		}
+	})
+	b.Run("Concurrent", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				for range queries {
+					hw.Search(queries[i%batchSize], 10, nil)
+					i++
+				}
+			}
+		})
+	})
+	b.Run("Batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			hw.BatchSearch(queries, 10, nil)
+		}
+	})
+}
+
+func TestHNSWWrapper_RangeSearch(t *testing.T) {
+	const dims = 8
+	hw := newRandomHNSW(t, dims, 1000, 5)
+	rng := rand.New(rand.NewSource(6))
+	query := randomVector(rng, dims)
+	const radius = 3 // Squared L2
+
+	results, err := hw.RangeSearch(query, radius, nil)
+	if err != nil {
+		t.Fatalf("RangeSearch failed: %v", err)
+	}
+
+	exact := make(map[uint64]bool)
+	for id, node := range hw.nodes {
+		if distanceL2(query, node.Vector) <= radius {
+			exact[id] = true
+		}
+	}
+	if len(exact) < 10 {
+		t.Fatalf("Test radius too small: only %d vectors in range", len(exact))
+	}
+
+	found := 0
+	for i, r := range results {
+		if r.Distance > radius {
+			t.Errorf("Result %d outside radius: %f", r.VectorID, r.Distance)
+		}
+		if i > 0 && r.Distance < results[i-1].Distance {
+			t.Fatal("Results not sorted by ascending distance")
+		}
+		if exact[r.VectorID] {
+			found++
+		}
+	}
+	if recall := float64(found) / float64(len(exact)); recall < 0.95 {
+		t.Errorf("Range recall %.2f (%d of %d)", recall, found, len(exact))
+	}
+
+	filter := NewBitSet()
+	for _, r := range results[:len(results)/2] {
+		filter.Set(r.VectorID)
+	}
+	filtered, err := hw.RangeSearch(query, radius, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) != filter.Count() {
+		t.Errorf("Filtered range search returned %d results, want %d", len(filtered), filter.Count())
+	}
+
+	if results, _ := hw.RangeSearch(query, 0, nil); len(results) != 0 {
+		t.Errorf("Expected no results for zero radius, got %d", len(results))
+	}
+}
+
+func TestHNSWWrapper_SoftDeleteAndCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.hnsw")
+	hw, err := NewHNSWWrapper(8, types.MetricL2, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hw.DeleteMode = DeleteModeSoft
+
+	rng := rand.New(rand.NewSource(11))
+	vectors := make(map[uint64][]float32)
+	for i := uint64(1); i <= 500; i++ {
+		vec := make([]float32, 8)
+		for j := range vec {
+			vec[j] = rng.Float32()
+		}
+		vectors[i] = vec
+		if err := hw.Add(i, vec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tombstone every fifth node, including the entry point
+	deleted := map[uint64]bool{hw.entryPoint: true}
+	for i := uint64(5); i <= 500; i += 5 {
+		deleted[i] = true
+	}
+	for id := range deleted {
+		if err := hw.Delete(id); err != nil {
+			t.Fatalf("Delete(%d) failed: %v", id, err)
+		}
+	}
+	if err := hw.SoftDelete(5); err == nil {
+		t.Error("Expected SoftDelete of a tombstoned node to fail")
+	}
+	live := uint64(500 - len(deleted))
+	if hw.Count() != live || hw.Contains(5) {
+		t.Fatalf("Count = %d (contains 5: %v), want %d", hw.Count(), hw.Contains(5), live)
+	}
+	if len(hw.nodes) != 500 {
+		t.Fatalf("Soft delete removed nodes: %d left", len(hw.nodes))
+	}
+
+	checkNoDeleted := func(stage string) {
+		for id := range deleted {
+			results, err := hw.Search(vectors[id], 10, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 10 {
+				t.Fatalf("%s: expected 10 results, got %d", stage, len(results))
+			}
+			for _, r := range results {
+				if deleted[r.VectorID] {
+					t.Fatalf("%s: search returned deleted vector %d", stage, r.VectorID)
+				}
+			}
+		}
+	}
+	checkNoDeleted("soft-deleted")
+
+	// Tombstones survive a save and reload
+	if err := hw.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, _ := NewHNSWWrapper(8, types.MetricL2, path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Count() != live || reloaded.Stats().Tombstones != len(deleted) {
+		t.Fatalf("Reloaded Count = %d, tombstones = %d", reloaded.Count(), reloaded.Stats().Tombstones)
+	}
+
+	if err := hw.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if len(hw.nodes) != int(live) || hw.Stats().Tombstones != 0 || hw.IsDirty() {
+		t.Fatalf("After Compact: %d nodes, %d tombstones, dirty=%v", len(hw.nodes), hw.Stats().Tombstones, hw.IsDirty())
+	}
+	for id, node := range hw.nodes {
+		for level, neighbors := range node.Neighbors {
+			if level == 0 && len(neighbors) == 0 {
+				t.Errorf("Node %d lost all level-0 neighbors", id)
+			}
+			for _, n := range neighbors {
+				if hw.nodes[n] == nil {
+					t.Fatalf("Node %d still links to removed node %d", id, n)
+				}
+			}
+		}
+	}
+	checkNoDeleted("compacted")
+
+	recall, err := hw.ComputeRecall(hw.SampleVectors(50), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recall < 0.9 {
+		t.Errorf("Recall after Compact = %.3f, want >= 0.9", recall)
+	}
+
+	// A soft-deleted ID can be reused
+	hw.SoftDelete(1)
+	if err := hw.Add(1, vectors[1]); err != nil || !hw.Contains(1) {
+		t.Errorf("Re-adding a tombstoned ID failed: %v", err)
+	}
+}
+
+func TestHNSWWrapper_DeltaSnapshots(t *testing.T) {
+	hw := newRandomHNSW(t, 8, 300, 21)
+	path := hw.filePath
+	if err := hw.Save(); err != nil {
+		t.Fatal(err)
+	}
+	base, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(22))
+	for i := 301; i <= 320; i++ {
+		if err := hw.Add(uint64(i), randomVector(rng, 8)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []uint64{3, 50, hw.entryPoint} {
+		if err := hw.Delete(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hw.SoftDelete(310)
+	if err := hw.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if hw.IsDirty() || len(hw.dirtySet) != 0 {
+		t.Fatal("Expected Flush to clear the dirty set")
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, base) {
+		t.Fatal("Expected Flush below the threshold to leave the snapshot untouched")
+	}
+
+	// A second batch, then a batch torn by a crash
+	if err := hw.Add(321, randomVector(rng, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if err := hw.SaveDelta(); err != nil {
+		t.Fatalf("SaveDelta failed: %v", err)
+	}
+	f, err := os.OpenFile(hw.deltaPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{hnswDeltaUpsert, 1, 2, 3})
+	f.Close()
+
+	checkSame := func(stage string, got *HNSWWrapper) {
+		t.Helper()
+		if got.Count() != hw.Count() || got.Stats().Tombstones != 1 || got.entryPoint != hw.entryPoint {
+			t.Fatalf("%s: count %d, tombstones %d, entry %d; want %d, 1, %d", stage,
+				got.Count(), got.Stats().Tombstones, got.entryPoint, hw.Count(), hw.entryPoint)
+		}
+		if !reflect.DeepEqual(got.nodes, hw.nodes) {
+			t.Fatalf("%s: graph differs from the saved one", stage)
+		}
+	}
+	loaded, _ := NewHNSWWrapper(8, types.MetricL2, path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	checkSame("base+delta", loaded)
+	if loaded.deltaNodes == 0 {
+		t.Error("Expected loaded index to count the delta records")
+	}
+
+	if err := loaded.MergeDelta(); err != nil {
+		t.Fatalf("MergeDelta failed: %v", err)
+	}
+	if _, err := os.Stat(loaded.deltaPath()); !os.IsNotExist(err) {
+		t.Fatal("Expected MergeDelta to remove the delta file")
+	}
+	merged, _ := NewHNSWWrapper(8, types.MetricL2, path)
+	if err := merged.Load(); err != nil {
+		t.Fatal(err)
+	}
+	checkSame("merged", merged)
+
+	// Past the threshold Flush writes a full snapshot
+	merged.DeltaThreshold = 5
+	for i := 400; i < 410; i++ {
+		merged.Add(uint64(i), randomVector(rng, 8))
+	}
+	if err := merged.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(merged.deltaPath()); !os.IsNotExist(err) {
+		t.Error("Expected a full save above DeltaThreshold")
+	}
+}
+
+func TestHNSWWrapper_StatsAndValidate(t *testing.T) {
+	hw, err := NewHNSWWrapper(4, types.MetricL2, filepath.Join(t.TempDir(), "vectors.hnsw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(7))
+	for i := uint64(1); i <= 200; i++ {
+		vec := make([]float32, 4)
+		for j := range vec {
+			vec[j] = rng.Float32()
+		}
+		if err := hw.Add(i, vec); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	hw.DeleteMode = DeleteModeSoft
+	for i := uint64(1); i <= 200; i += 5 {
+		if err := hw.Delete(i); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+	}
+
+	stats := hw.Stats()
+	if stats.Nodes != 200 || stats.Tombstones != 40 {
+		t.Errorf("Expected 200 nodes with 40 tombstones, got %d and %d", stats.Nodes, stats.Tombstones)
+	}
+	perLevel := 0
+	for _, n := range stats.LevelDistribution {
+		perLevel += n
+	}
+	if perLevel != stats.Nodes {
+		t.Errorf("Level distribution covers %d nodes, want %d", perLevel, stats.Nodes)
+	}
+	if len(stats.EdgeCountPerLevel) != stats.MaxLevel+1 {
+		t.Errorf("Expected edge counts for %d levels, got %v", stats.MaxLevel+1, stats.EdgeCountPerLevel)
+	}
+	if got := float64(stats.EdgeCountPerLevel[0]) / float64(stats.Nodes); math.Abs(got-stats.AvgDegree) > 1e-9 {
+		t.Errorf("AvgDegree %f does not match level-0 edges per node %f", stats.AvgDegree, got)
+	}
+	if stats.MinDegree < 1 || stats.MinDegree > stats.MaxDegree || stats.MaxDegree > 2*hw.M || stats.UnconnectedNodes != 0 {
+		t.Errorf("Unexpected degrees: %+v", stats)
+	}
+	if warnings := hw.Validate(); len(warnings) != 0 {
+		t.Fatalf("Expected a healthy graph, got %v", warnings)
+	}
+
+	// Break the graph and expect each problem to be reported
+	node := hw.nodes[2]
+	node.Neighbors[0] = append(node.Neighbors[0], 9999, 2)
+	hw.MaxLevel++
+	warnings := hw.Validate()
+	for _, want := range []string{"node 9999 is missing", "node 2 links to itself", "entry point"} {
+		found := false
+		for _, w := range warnings {
+			found = found || strings.Contains(w, want)
+		}
+		if !found {
+			t.Errorf("Expected a warning containing %q, got %v", want, warnings)
+		}
+	}
+}
+
+func TestHNSWWrapper_AddKeepsNeighborsConnected(t *testing.T) {
+	if testing.Short() {
+		t.Skip("inserts 10,000 vectors")
+	}
+	hw := newRandomHNSW(t, 8, 10000, 11)
+
+	if warnings := hw.Validate(); len(warnings) != 0 {
+		t.Fatalf("Expected a healthy graph, got %d warnings, first %q", len(warnings), warnings[0])
+	}
+	for id, node := range hw.nodes {
+		if len(node.Neighbors[0]) == 0 {
+			t.Fatalf("Node %d has no neighbors at level 0", id)
+		}
+	}
+	if stats := hw.Stats(); stats.UnconnectedNodes != 0 || stats.MinDegree < hw.M/2 {
+		t.Errorf("Expected every node to keep at least %d neighbors, got %+v", hw.M/2, stats)
+	}
+}
+
+func TestHNSWWrapper_SearchAsync(t *testing.T) {
+	if testing.Short() {
+		t.Skip("inserts 10,000 vectors")
+	}
+	hw := newRandomHNSW(t, 8, 10000, 13)
+	hw.EfSearch = 10000 // Expands far more than cancelCheckInterval candidates
+	query := randomVector(rand.New(rand.NewSource(14)), 8)
+
+	hits, errc := hw.SearchAsync(query[:4], 10, nil)
+	if _, ok := <-hits; ok {
+		t.Error("Expected a failed search to close the channel")
+	}
+	if err := <-errc; !errors.As(err, new(*types.DimensionMismatchError)) {
+		t.Errorf("Expected a dimension mismatch error, got %v", err)
+	}
+
+	// The search pauses inside level 0 until resumed, so the first hit must
+	// arrive while it is still running
+	ctx := &pausingContext{Context: context.Background(), paused: make(chan struct{}), resume: make(chan struct{})}
+	hits, errc = hw.SearchAsyncContext(ctx, query, 10, nil)
+	first, ok := <-hits
+	if !ok {
+		t.Fatal("Expected a first hit")
+	}
+	select {
+	case err := <-errc:
+		t.Fatalf("Search completed before resuming: %v", err)
+	default:
+	}
+	<-ctx.paused
+	close(ctx.resume)
+	seen := map[uint64]bool{first.VectorID: true}
+	for hit := range hits {
+		if seen[hit.VectorID] {
+			t.Errorf("Hit %d sent twice", hit.VectorID)
+		}
+		seen[hit.VectorID] = true
+	}
+	if len(seen) != 10 {
+		t.Errorf("Expected 10 hits, got %d", len(seen))
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("SearchAsyncContext failed: %v", err)
+	}
+	if !hw.mu.TryLock() {
+		t.Fatal("Expected the search to release the lock once the channel is closed")
+	}
+	hw.mu.Unlock()
+
+	// A cancelled search reports the cancellation after the last hit
+	inner, cancel := context.WithCancel(context.Background())
+	ctx = &pausingContext{Context: inner, paused: make(chan struct{}), resume: make(chan struct{})}
+	hits, errc = hw.SearchAsyncContext(ctx, query, 10, nil)
+	<-ctx.paused
+	cancel()
+	close(ctx.resume)
+	for range hits {
+	}
+	if err := <-errc; !errors.Is(err, types.ErrCancelled) {
+		t.Errorf("SearchAsyncContext after cancel = %v, want a cancellation error", err)
+	}
+
+	// Stopping early leaves nothing blocked, and the filter applies
+	filter := NewBitSetFromSlice([]uint64{2, 4, 6, 8})
+	hits, _ = hw.SearchAsync(query, 3, filter)
+	if hit := <-hits; !filter.Contains(hit.VectorID) {
+		t.Errorf("Hit %d is not in the filter", hit.VectorID)
+	}
+	if _, err := hw.Search(query, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	hw.mu.Lock() // Waits for the abandoned search
+	hw.mu.Unlock()
+}
+
+// pausingContext pauses the search using it at its second cancellation
+// check, the first one inside a layer, until resume is closed.
+type pausingContext struct {
+	context.Context
+	checks int
+	paused chan struct{}
+	resume chan struct{}
+}
+
+func (c *pausingContext) Err() error {
+	if c.checks++; c.checks == 2 {
+		close(c.paused)
+		<-c.resume
+	}
+	return c.Context.Err()
+}
+
+func TestHNSWWrapper_SearchContextCancel(t *testing.T) {
+	hw := newRandomHNSW(t, 8, 2000, 21)
+	hw.EfSearch = 2000 // Expands far more than cancelCheckInterval candidates
+	query := randomVector(rand.New(rand.NewSource(22)), 8)
+
+	inner, cancel := context.WithCancel(context.Background())
+	ctx := &pausingContext{Context: inner, paused: make(chan struct{}), resume: make(chan struct{})}
+	done := make(chan error, 1)
+	go func() {
+		_, err := hw.SearchContext(ctx, query, 10, nil)
+		done <- err
+	}()
+	<-ctx.paused
+	cancel()
+	close(ctx.resume)
+	select {
+	case err := <-done:
+		if !errors.Is(err, types.ErrCancelled) || !errors.Is(err, context.Canceled) {
+			t.Errorf("SearchContext after cancel = %v, want a cancellation error", err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Search still running 100ms after cancel")
+	}
+	if !hw.mu.TryLock() {
+		t.Fatal("Expected the cancelled search to release the lock")
+	}
+	hw.mu.Unlock()
+
+	// A context that is already done fails before searching
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+	if _, err := hw.SearchEfContext(expired, query, 10, 10, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SearchEfContext past the deadline = %v, want DeadlineExceeded", err)
+	}
+	if results, err := hw.SearchContext(context.Background(), query, 10, nil); err != nil || len(results) != 10 {
+		t.Errorf("SearchContext = %d results, %v", len(results), err)
+	}
+}
+
+func TestFloat16Conversion(t *testing.T) {
+	for _, tc := range []struct {
+		f    float32
+		bits uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},                           // Largest finite half
+		{65520, 0x7c00},                           // Rounds up to infinity
+		{float32(math.Inf(-1)), 0xfc00},           // Negative infinity
+		{float32(math.Ldexp(1, -24)), 0x0001},     // Smallest subnormal
+		{float32(math.Ldexp(1, -14)), 0x0400},     // Smallest normal
+		{1 + float32(math.Ldexp(1, -11)), 0x3c00}, // Tie rounds to even
+		{1 + float32(math.Ldexp(3, -11)), 0x3c02}, // Tie rounds to even
+	} {
+		if got := float32ToFloat16(tc.f); got != tc.bits {
+			t.Errorf("float32ToFloat16(%g) = %#04x, want %#04x", tc.f, got, tc.bits)
+		}
+		if got := float16ToFloat32(tc.bits); float32ToFloat16(got) != tc.bits {
+			t.Errorf("float16ToFloat32(%#04x) = %g does not round-trip", tc.bits, got)
+		}
+	}
+	if got := float16ToFloat32(float32ToFloat16(float32(math.NaN()))); !math.IsNaN(float64(got)) {
+		t.Errorf("Expected NaN to round-trip, got %g", got)
+	}
+
+	// Normal values keep 11 significant bits
+	rng := rand.New(rand.NewSource(16))
+	for i := 0; i < 1000; i++ {
+		v := float32(rng.NormFloat64())
+		got := float16ToFloat32(float32ToFloat16(v))
+		if diff := math.Abs(float64(got - v)); diff > math.Abs(float64(v))/2048+1e-7 {
+			t.Fatalf("%g round-trips to %g", v, got)
+		}
+	}
+}
+
+func TestHNSWWrapper_Float16Vectors(t *testing.T) {
+	const dims = 16
+	dir := t.TempDir()
+	hw, err := NewHNSWWrapper(dims, types.MetricCosine, filepath.Join(dir, "vectors.hnsw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hw.Float16Vectors = true
+
+	rng := rand.New(rand.NewSource(9))
+	vectors := make(map[uint64][]float32)
+	for i := uint64(1); i <= 300; i++ {
+		vectors[i] = randomVector(rng, dims)
+		if err := hw.Add(i, vectors[i]); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if node := hw.nodes[1]; node.Vector != nil || len(node.Vector16) != dims {
+		t.Fatalf("Expected a half-precision vector, got %d float32 and %d float16 components", len(node.Vector), len(node.Vector16))
+	}
+	for id := uint64(1); id <= 300; id += 37 {
+		results, err := hw.Search(vectors[id], 1, nil)
+		if err != nil || len(results) != 1 || results[0].VectorID != id {
+			t.Fatalf("Expected search for vector %d to find itself, got %v (err %v)", id, results, err)
+		}
+	}
+
+	// The snapshot and the delta keep half precision
+	if err := hw.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := hw.Add(301, randomVector(rng, dims)); err != nil {
+		t.Fatal(err)
+	}
+	if err := hw.SaveDelta(); err != nil {
+		t.Fatalf("SaveDelta failed: %v", err)
+	}
+	header, err := os.ReadFile(hw.filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(header[:8]) != hnswMagic16 {
+		t.Errorf("Expected magic %q, got %q", hnswMagic16, header[:8])
+	}
+
+	for _, half := range []bool{true, false} {
+		loaded, err := NewHNSWWrapper(dims, types.MetricCosine, hw.filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded.Float16Vectors = half
+		if err := loaded.Load(); err != nil {
+			t.Fatalf("Load (float16 %v) failed: %v", half, err)
+		}
+		if loaded.Count() != 301 {
+			t.Errorf("Expected 301 vectors after load, got %d", loaded.Count())
+		}
+		want, _ := hw.GetVector(301)
+		got, ok := loaded.GetVector(301)
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("Loaded vector 301 (float16 %v) = %v, want %v", half, got, want)
+		}
+		if !half && loaded.nodes[1].Vector == nil {
+			t.Error("Expected a float32 wrapper to expand half-precision vectors on load")
+		}
+	}
+}
+
+func TestHNSWWrapper_MmapVectors(t *testing.T) {
+	const dims, n = 512, 700 // More vectors than the first region holds
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vectors.hnsw")
+	hw, err := NewHNSWWrapper(dims, types.MetricL2, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hw.MmapVectors = true
+	hw.EfConstruction = 40
+
+	rng := rand.New(rand.NewSource(3))
+	vectors := randomVectors(rng, dims, n)
+	for id := uint64(1); id <= n; id++ {
+		if err := hw.Add(id, vectors[id]); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if len(hw.vectors.regions) < 2 {
+		t.Errorf("Expected %d vectors to span several regions, got %d", n, len(hw.vectors.regions))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "vectors.mmap")); mmapSupported && err != nil {
+		t.Fatalf("Expected a vector file: %v", err)
+	}
+	for id := uint64(1); id <= n; id += 53 {
+		if !hw.nodes[id].mapped {
+			t.Fatalf("Vector %d is not mapped", id)
+		}
+		results, err := hw.Search(vectors[id], 1, nil)
+		if err != nil || len(results) != 1 || results[0].VectorID != id {
+			t.Fatalf("Expected search for vector %d to find itself, got %v (err %v)", id, results, err)
+		}
+	}
+
+	// GetVector hands out copies, not the mapped memory
+	got, _ := hw.GetVector(7)
+	if !reflect.DeepEqual(got, vectors[7]) {
+		t.Fatalf("GetVector(7) = %v, want %v", got[:4], vectors[7][:4])
+	}
+	got[0]++
+	if hw.nodes[7].Vector[0] != vectors[7][0] {
+		t.Error("Changing the vector returned by GetVector changed the index")
+	}
+
+	// The slot of a deleted vector is reused
+	offset := hw.nodes[5].vectorOffset
+	if err := hw.Delete(5); err != nil {
+		t.Fatal(err)
+	}
+	vectors[n+1] = randomVector(rng, dims)
+	if err := hw.Add(n+1, vectors[n+1]); err != nil {
+		t.Fatal(err)
+	}
+	if hw.nodes[n+1].vectorOffset != offset {
+		t.Errorf("Expected vector %d to reuse offset %d, got %d", n+1, offset, hw.nodes[n+1].vectorOffset)
+	}
+
+	if err := hw.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := hw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "vectors.mmap")); !os.IsNotExist(err) {
+		t.Errorf("Expected Close to remove the vector file, got %v", err)
+	}
+
+	for _, half := range []bool{false, true} {
+		loaded, err := NewHNSWWrapper(dims, types.MetricL2, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded.MmapVectors, loaded.Float16Vectors = true, half
+		if err := loaded.Load(); err != nil {
+			t.Fatalf("Load (float16 %v) failed: %v", half, err)
+		}
+		if loaded.Count() != n {
+			t.Errorf("Expected %d vectors after load, got %d", n, loaded.Count())
+		}
+		node := loaded.nodes[n+1]
+		if !node.mapped || (half && len(node.Vector16) != dims) {
+			t.Fatalf("Loaded vector (float16 %v) is not mapped with the configured precision", half)
+		}
+		got, ok := loaded.GetVector(n + 1)
+		for i := range got {
+			if math.Abs(float64(got[i]-vectors[n+1][i])) > 1e-3 {
+				ok = false
+			}
+		}
+		if !ok {
+			t.Errorf("Loaded vector %d (float16 %v) = %v, want %v", n+1, half, got[:4], vectors[n+1][:4])
+		}
+		if err := loaded.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkHNSWFloat16 compares memory per vector and recall against exact
+// float32 results for float32 and half-precision graphs built over the same
+// clustered 128-dimensional vectors.
+func BenchmarkHNSWFloat16(b *testing.B) {
+	const dims, n, k = 128, 5000, 10
+	rng := rand.New(rand.NewSource(5))
+	centers := make([][]float32, 50)
+	for i := range centers {
+		centers[i] = randomVector(rng, dims)
+	}
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		c := centers[rng.Intn(len(centers))]
+		vectors[i] = make([]float32, dims)
+		for j := range vectors[i] {
+			vectors[i][j] = c[j] + 0.1*float32(rng.NormFloat64())
+		}
+	}
+	queries := make([][]float32, 100)
+	for i := range queries {
+		queries[i] = vectors[rng.Intn(n)]
+	}
+
+	// Exact float32 neighbors
+	truth := make([]map[uint64]bool, len(queries))
+	for i, q := range queries {
+		all := make([]candidate, n)
+		for j, v := range vectors {
+			all[j] = candidate{ID: uint64(j + 1), Distance: distanceL2(q, v)}
+		}
+		sort.Slice(all, func(a, c int) bool { return all[a].Distance < all[c].Distance })
+		truth[i] = make(map[uint64]bool, k)
+		for _, c := range all[:k] {
+			truth[i][c.ID] = true
+		}
+	}
+
+	for _, half := range []bool{false, true} {
+		name := "Float32"
+		if half {
+			name = "Float16"
+		}
+		b.Run(name, func(b *testing.B) {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			hw, err := NewHNSWWrapper(dims, types.MetricL2, filepath.Join(b.TempDir(), "vectors.hnsw"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			hw.Float16Vectors = half
+			for i, v := range vectors {
+				if err := hw.Add(uint64(i+1), v); err != nil {
+					b.Fatal(err)
+				}
+			}
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+
+			b.ResetTimer()
+			hits := 0
+			for i := 0; i < b.N; i++ {
+				hits = 0
+				for qi, q := range queries {
+					results, _ := hw.Search(q, k, nil)
+					for _, r := range results {
+						if truth[qi][r.VectorID] {
+							hits++
+						}
+					}
+				}
+			}
+			b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/n, "heap-B/vector")
+			b.ReportMetric(float64(hits)/float64(len(queries)*k), "recall")
+			runtime.KeepAlive(hw)
+		})
+	}
+}
+
+func randomVectors(rng *rand.Rand, dims, n int) map[uint64][]float32 {
+	vectors := make(map[uint64][]float32, n)
+	for i := 1; i <= n; i++ {
+		vectors[uint64(i)] = randomVector(rng, dims)
+	}
+	return vectors
+}
+
+func TestHNSWWrapper_BulkAdd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("links 12,000 vectors by brute force")
+	}
+	const dims, n = 8, 12000 // More than one batch
+	rng := rand.New(rand.NewSource(21))
+	hw, err := NewHNSWWrapper(dims, types.MetricL2, filepath.Join(t.TempDir(), "vectors.hnsw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hw.BulkAdd(map[uint64][]float32{1: {1, 2}}); err == nil {
+		t.Error("Expected a dimension mismatch to be rejected")
+	}
+	if err := hw.BulkAdd(randomVectors(rng, dims, n)); err != nil {
+		t.Fatalf("BulkAdd failed: %v", err)
+	}
+
+	if hw.Count() != n {
+		t.Errorf("Expected %d vectors, got %d", n, hw.Count())
+	}
+	if warnings := hw.Validate(); len(warnings) != 0 {
+		t.Fatalf("Expected a healthy graph, got %d warnings, first %q", len(warnings), warnings[0])
+	}
+	queries := make([][]float32, 100)
+	for i := range queries {
+		queries[i] = randomVector(rng, dims)
+	}
+	recall, err := hw.ComputeRecall(queries, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recall < 0.9 {
+		t.Errorf("Expected recall@10 of at least 0.9, got %.3f", recall)
+	}
+
+	// Later loads go through Add and keep the graph searchable
+	if err := hw.BulkAdd(map[uint64][]float32{1: randomVector(rng, dims)}); err == nil {
+		t.Error("Expected an existing ID to be rejected")
+	}
+	extra := map[uint64][]float32{n + 1: randomVector(rng, dims), n + 2: randomVector(rng, dims)}
+	if err := hw.BulkAdd(extra); err != nil {
+		t.Fatal(err)
+	}
+	results, err := hw.Search(extra[n+1], 1, nil)
+	if err != nil || len(results) != 1 || results[0].VectorID != n+1 {
+		t.Errorf("Expected to find vector %d, got %+v, %v", n+1, results, err)
+	}
+}
+
+func TestHNSWWrapper_BulkAddKeepsInputs(t *testing.T) {
+	rng := rand.New(rand.NewSource(23))
+	// Small loads go through Add, larger ones are linked by brute force
+	for _, n := range []int{10, 500} {
+		hw, err := NewHNSWWrapper(4, types.MetricCosine, filepath.Join(t.TempDir(), "vectors.hnsw"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hw.Normalized = true
+		vectors := randomVectors(rng, 4, n)
+		for _, v := range vectors {
+			v[0] += 10 // Far from unit length
+		}
+		before := make(map[uint64][]float32, n)
+		for id, v := range vectors {
+			before[id] = slices.Clone(v)
+		}
+		if err := hw.BulkAdd(vectors); err != nil {
+			t.Fatalf("BulkAdd of %d vectors failed: %v", n, err)
+		}
+		for id, v := range vectors {
+			if !slices.Equal(v, before[id]) {
+				t.Fatalf("BulkAdd of %d vectors changed input vector %d", n, id)
+			}
+		}
+		if results, err := hw.Search(before[1], 1, nil); err != nil || len(results) != 1 || results[0].VectorID != 1 {
+			t.Errorf("Expected to find vector 1 among %d, got %+v, %v", n, results, err)
+		}
+	}
+}
+
+// BenchmarkHNSWBuild compares building an index of 100K 128-dimensional
+// vectors with Add, one at a time, and with BulkAdd. It takes minutes; run
+// it with -benchtime 1x.
+func BenchmarkHNSWBuild(b *testing.B) {
+	const dims, n = 128, 100_000
+	vectors := randomVectors(rand.New(rand.NewSource(31)), dims, n)
+	queries := make([][]float32, 100)
+	for i := range queries {
+		queries[i] = randomVector(rand.New(rand.NewSource(int64(i))), dims)
+	}
+	build := func(b *testing.B, add func(hw *HNSWWrapper) error) {
+		for range b.N {
+			hw, err := NewHNSWWrapper(dims, types.MetricL2, "")
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := add(hw); err != nil {
+				b.Fatal(err)
+			}
+			b.StopTimer()
+			recall, err := hw.ComputeRecall(queries, 10)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(recall, "recall@10")
+			b.StartTimer()
+		}
+	}
+
+	b.Run("Sequential", func(b *testing.B) {
+		build(b, func(hw *HNSWWrapper) error {
+			for id, v := range vectors {
+				if err := hw.Add(id, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	b.Run("Bulk", func(b *testing.B) {
+		build(b, func(hw *HNSWWrapper) error { return hw.BulkAdd(vectors) })
+	})
+}
+
+func TestMetricDistance_JaccardManhattan(t *testing.T) {
+	tests := []struct {
+		metric types.DistanceMetric
+		a, b   []float32
+		want   float32
+	}{
+		// {0,1} vs {1,2}: 1 shared of 3
+		{types.MetricJaccard, []float32{1, 2, 0, 0}, []float32{0, 0.5, -3, 0}, 1 - 1.0/3},
+		{types.MetricJaccard, []float32{1, 0, 1}, []float32{5, 0, 7}, 0},   // Same set, other weights
+		{types.MetricJaccard, []float32{1, 0, 0}, []float32{0, 1, 0}, 1},   // Disjoint
+		{types.MetricJaccard, []float32{0, 0}, []float32{0, 0}, 0},         // Two empty sets
+		{types.MetricManhattan, []float32{1, 2, 3}, []float32{4, 0, 3}, 5}, // 3 + 2 + 0
+		{types.MetricManhattan, []float32{-1, 1}, []float32{1, -1}, 4},     // 2 + 2
+		{types.MetricManhattan, []float32{0.5, 0.25}, []float32{0.5, 0.25}, 0},
+	}
+	for _, tt := range tests {
+		if got := metricDistance(tt.metric, tt.a, tt.b); math.Abs(float64(got-tt.want)) > 1e-6 {
+			t.Errorf("%s(%v, %v) = %v, want %v", tt.metric, tt.a, tt.b, got, tt.want)
+		}
+		// The values are exact in half precision, so both paths agree
+		if got := metricDistance16(tt.metric, tt.a, encodeFloat16(tt.b)); math.Abs(float64(got-tt.want)) > 1e-6 {
+			t.Errorf("%s float16(%v, %v) = %v, want %v", tt.metric, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestHNSWWrapper_JaccardManhattanIndexes(t *testing.T) {
+	for _, metric := range []types.DistanceMetric{types.MetricJaccard, types.MetricManhattan} {
+		path := filepath.Join(t.TempDir(), "vectors.hnsw")
+		hw, err := NewHNSWWrapper(16, metric, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Sparse binary vectors
+		rng := rand.New(rand.NewSource(9))
+		vectors := make(map[uint64][]float32)
+		for id := uint64(1); id <= 200; id++ {
+			v := make([]float32, 16)
+			for j := range v {
+				if rng.Intn(4) == 0 {
+					v[j] = 1
+				}
+			}
+			vectors[id] = v
+			if err := hw.Add(id, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := hw.Save(); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := NewHNSWWrapper(16, metric, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := loaded.Load(); err != nil {
+			t.Fatalf("%s: Load failed: %v", metric, err)
+		}
+		results, err := loaded.Search(vectors[77], 1, nil)
+		if err != nil || len(results) != 1 || results[0].Distance != 0 {
+			t.Errorf("%s: searching a stored vector returned %v, %v; want an exact match", metric, results, err)
+		}
+	}
+
+	cfg := types.CollectionConfig{Name: "c", Dimensions: 8, Metric: types.MetricManhattan}
+	if _, err := ValidateCollectionConfig(&cfg); err != nil {
+		t.Errorf("ValidateCollectionConfig(manhattan) = %v", err)
+	}
+	cfg = types.CollectionConfig{Name: "c", Dimensions: 8, Metric: types.MetricJaccard, IndexType: types.IndexTypeFlat, IndexCompression: types.CompressionPQ}
+	if _, err := ValidateCollectionConfig(&cfg); err == nil {
+		t.Error("Expected PQ compression to reject the jaccard metric")
+	}
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"waddlemap/internal/types"
+)
+
+// BlockIterator reads the blocks of a key one at a time, in index order,
+// without holding them all in memory. Expired blocks are skipped. It is safe
+// for concurrent use, though the blocks are meant to be read by a single
+// goroutine.
+type BlockIterator struct {
+	mu         sync.Mutex
+	vm         *VectorManager
+	coll       *Collection
+	key        string
+	storageKey string
+	next       uint32 // Index of the next block to read
+	count      uint32 // Blocks of the key when the scan started
+	index      uint32 // Index of the block last returned
+	closed     bool
+}
+
+// ScanKey returns an iterator over the blocks of key. Blocks appended after
+// the scan started are not returned.
+func (vm *VectorManager) ScanKey(collection, key string) (*BlockIterator, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	count, err := coll.GetKeyLength(key)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockIterator{
+		vm:         vm,
+		coll:       coll,
+		key:        key,
+		storageKey: vm.makeStorageKey(collection, key),
+		count:      count,
+	}, nil
+}
+
+// Next returns the next block. It returns io.EOF after the last block, once
+// the key is deleted and once the iterator is closed. An error reading one
+// block does not end the scan: calling Next again moves on to the next block.
+func (it *BlockIterator) Next() (*types.BlockData, error) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	now := time.Now()
+	for !it.closed && it.next < it.count {
+		if !it.coll.ContainsKey(it.key) {
+			break
+		}
+		index := it.next
+		it.next++
+		entry, err := it.vm.Manager.GetEntry(it.storageKey, int(index))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read block %d of key %q: %w", index, it.key, err)
+		}
+		if entry.Expired(now) {
+			continue
+		}
+		it.index = index
+		return blockFromEntry(it.coll, it.key, index, entry, now), nil
+	}
+	return nil, io.EOF
+}
+
+// Index returns the index of the block last returned by Next.
+func (it *BlockIterator) Index() uint32 {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.index
+}
+
+// Close ends the scan. Next returns io.EOF afterwards.
+func (it *BlockIterator) Close() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.closed = true
+	it.vm, it.coll = nil, nil
+	return nil
+}
+
+// KeyIterator walks the (key, block index) pairs of a collection through its
+// forward index, in vector ID order, which is roughly the order the blocks
+// were added in. Pairs are read one at a time, so blocks added during the
+// scan may or may not be returned. Expired blocks are skipped. It is safe
+// for concurrent use, though the pairs are meant to be read by a single
+// goroutine.
+type KeyIterator struct {
+	mu     sync.Mutex
+	coll   *Collection
+	nextID uint64 // Lowest vector ID not yet visited
+	closed bool
+}
+
+// ScanCollection returns an iterator over the blocks of every key in
+// collection.
+func (vm *VectorManager) ScanCollection(collection string) (*KeyIterator, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyIterator{coll: coll}, nil
+}
+
+// Next returns the key and index of the next block. It returns io.EOF after
+// the last block and once the iterator is closed.
+func (it *KeyIterator) Next() (string, uint32, error) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if it.closed {
+		return "", 0, io.EOF
+	}
+	if err := it.coll.enter(); err != nil {
+		return "", 0, err
+	}
+	defer it.coll.drainWg.Done()
+
+	now := time.Now().Unix()
+	for {
+		vectorID, loc, ok := it.coll.DocMap.nextFrom(it.nextID)
+		if !ok {
+			it.closed = true
+			return "", 0, io.EOF
+		}
+		if vectorID == math.MaxUint64 {
+			it.closed = true // Nothing can follow
+		} else {
+			it.nextID = vectorID + 1
+		}
+		if !loc.Expired(now) {
+			return loc.Key, loc.Index, nil
+		}
+		if it.closed {
+			return "", 0, io.EOF
+		}
+	}
+}
+
+// Close ends the scan. Next returns io.EOF afterwards.
+func (it *KeyIterator) Close() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.closed = true
+	return nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestVectorManager_ScanKey(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		block := &types.BlockData{Primary: fmt.Sprintf("chunk %d", i), Vector: []float32{float32(i), 0}}
+		if _, err := vm.AppendBlock("docs", "long", block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := vm.ScanKey("docs", "missing"); !errors.Is(err, types.ErrKeyNotFound) {
+		t.Errorf("ScanKey(missing) = %v, want ErrKeyNotFound", err)
+	}
+
+	it, err := vm.ScanKey("docs", "long")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	// Blocks appended during the scan are not returned
+	if _, err := vm.AppendBlock("docs", "long", &types.BlockData{Primary: "late"}); err != nil {
+		t.Fatal(err)
+	}
+	var indexes []uint32
+	for {
+		block, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		index := it.Index()
+		if want := fmt.Sprintf("chunk %d", index); block.Primary != want || block.Vector[0] != float32(index) {
+			t.Errorf("Block %d = %+v, want %q", index, block, want)
+		}
+		indexes = append(indexes, index)
+	}
+	if fmt.Sprint(indexes) != "[0 1 2 3 4]" {
+		t.Errorf("Scanned blocks %v, want [0 1 2 3 4]", indexes)
+	}
+
+	// Closing ends the scan early
+	it, err = vm.ScanKey("docs", "long")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Next(); err != io.EOF {
+		t.Errorf("Next after Close = %v, want io.EOF", err)
+	}
+}
+
+func TestVectorManager_ScanCollection(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.ScanCollection("missing"); !errors.Is(err, types.ErrCollectionNotFound) {
+		t.Errorf("ScanCollection(missing) = %v, want ErrCollectionNotFound", err)
+	}
+	for _, key := range []string{"a", "b", "a", "c", "b"} {
+		if _, err := vm.AppendBlock("docs", key, &types.BlockData{Primary: key, Vector: []float32{1, 0}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vm.DeleteKey("docs", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	it, err := vm.ScanCollection("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var pairs []string
+	for {
+		key, index, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pairs = append(pairs, fmt.Sprintf("%s/%d", key, index))
+	}
+	if fmt.Sprint(pairs) != "[a/0 b/0 a/1 b/1]" {
+		t.Errorf("Scanned %v, want [a/0 b/0 a/1 b/1]", pairs)
+	}
+	if _, _, err := it.Next(); err != io.EOF {
+		t.Errorf("Next after the end = %v, want io.EOF", err)
+	}
+}
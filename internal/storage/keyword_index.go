@@ -1,60 +1,306 @@
 package storage
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
 	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
 	"os"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"unicode"
+
+	"waddlemap/internal/types"
+)
+
+// DefaultNGramSize is the default n-gram length used for partial matching.
+const DefaultNGramSize = 3
+
+// Tokenization modes for InvertedIndex.TokenizationMode.
+const (
+	// TokenizeNGram indexes every keyword as overlapping n-grams (default).
+	TokenizeNGram = "ngram"
+	// TokenizeWhitespace indexes the space-separated words of each keyword.
+	TokenizeWhitespace = "whitespace"
+	// TokenizeCJKChar indexes CJK keywords as single characters plus bigrams;
+	// non-CJK keywords fall back to n-grams.
+	TokenizeCJKChar = "cjk_char"
+)
+
+// Default BM25 parameters of an InvertedIndex.
+const (
+	DefaultBM25K1 = 1.5  // Term frequency saturation
+	DefaultBM25B  = 0.75 // Document length normalization
 )
 
-// InvertedIndex stores trigram → postings list mappings for keyword search.
+// keywords.inv layout, all integers big-endian:
+//
+//	[Magic "KWI4"][SizeCount(1)][Size(1)]...[ModeLen(1)][TokenizationMode]
+//	[EntryCount(4)] then per entry, sorted by key:
+//	[KeyLen(2)][Key][PostingCount(4)][VectorID(8)]...
+//	[FreqCount(4)] then per repeated keyword, sorted by VectorID and keyword:
+//	[VectorID(8)][KeywordLen(2)][Keyword][Freq(4)]
+//
+// Keywords not in the frequency table occur once in their VectorIDs. The
+// reverse map is rebuilt from the postings on load. Files of older formats
+// have no tokenization mode and were built with n-grams: invMagicFreq files
+// are otherwise the same, and invMagicNoFreq files also end after the
+// postings. Older files hold the same n-gram header under invMagicGob
+// followed by the GOB-encoded maps, and files without any magic are legacy
+// trigram-only GOB indexes.
+const (
+	invMagic       = "KWI4"
+	invMagicFreq   = "KWI3"
+	invMagicNoFreq = "KWI2"
+	invMagicGob    = "KWIX"
+)
+
+// InvertedIndex stores n-gram → postings list mappings for keyword search.
 // This corresponds to the keywords.inv file in the spec.
 type InvertedIndex struct {
-	// index maps trigrams to lists of VectorIDs
-	index    map[string][]uint64
-	filePath string
-	mu       sync.RWMutex
+	// index maps n-grams to lists of VectorIDs
+	index map[string][]uint64
+	// docToKeys maps a VectorID to the postings keys it appears in, so
+	// DeleteDoc can remove it without the original keywords.
+	docToKeys map[uint64][]string
+	// termFreq maps a VectorID to the full keywords it was given more than
+	// once and their counts; other keywords count once. Saved with the index.
+	termFreq map[uint64]map[string]int
+	// docFreq maps a full keyword to the number of VectorIDs indexed under it
+	// and docLengths maps a VectorID to its number of keywords, counting
+	// repeats, for BM25. Both are derived from the postings and termFreq and
+	// rebuilt on Load.
+	docFreq     map[string]int
+	docLengths  map[uint64]int
+	totalLength int    // Sum of docLengths
+	vocab       BKTree // Keys of docFreq, for Levenshtein search
+	filePath    string
+	dirty       bool // Set on Add/Delete, cleared on Save
+	mu          sync.RWMutex
+
+	// NGramSize is the n-gram length used for partial matching (default 3).
+	NGramSize int
+	// NGramSizes optionally indexes several n-gram lengths at once
+	// (e.g. []int{2, 3}) for improved recall. Overrides NGramSize when set.
+	NGramSizes []int
+	// TokenizationMode selects how keywords are split for partial matching:
+	// "ngram" (default), "whitespace" or "cjk_char".
+	TokenizationMode string
+	// K1 and B are the BM25 term frequency saturation and document length
+	// normalization, DefaultBM25K1 and DefaultBM25B unless changed.
+	K1, B float64
 }
 
 // NewInvertedIndex creates a new inverted index.
 func NewInvertedIndex(filePath string) *InvertedIndex {
 	return &InvertedIndex{
-		index:    make(map[string][]uint64),
-		filePath: filePath,
+		index:      make(map[string][]uint64),
+		docToKeys:  make(map[uint64][]string),
+		termFreq:   make(map[uint64]map[string]int),
+		docFreq:    make(map[string]int),
+		docLengths: make(map[uint64]int),
+		filePath:   filePath,
+		NGramSize:  DefaultNGramSize,
+		K1:         DefaultBM25K1,
+		B:          DefaultBM25B,
 	}
 }
 
-// GenerateTrigrams generates trigrams from a keyword.
-// Example: "finance" → ["fin", "ina", "nan", "anc", "nce"]
-func GenerateTrigrams(keyword string) []string {
+// GenerateNGrams generates n-grams of length n from a keyword.
+// Example: ("finance", 3) → ["fin", "ina", "nan", "anc", "nce"]
+func GenerateNGrams(keyword string, n int) []string {
 	keyword = strings.ToLower(keyword)
-	if len(keyword) < 3 {
-		// For short keywords, use the keyword itself as a "trigram"
+	runes := []rune(keyword)
+	if n <= 0 || len(runes) < n {
+		// For short keywords, use the keyword itself as an n-gram
 		return []string{keyword}
 	}
 
-	trigrams := make([]string, 0, len(keyword)-2)
+	grams := make([]string, 0, len(runes)-n+1)
+	for i := 0; i <= len(runes)-n; i++ {
+		grams = append(grams, string(runes[i:i+n]))
+	}
+	return grams
+}
+
+// GenerateTrigrams generates trigrams from a keyword.
+func GenerateTrigrams(keyword string) []string {
+	return GenerateNGrams(keyword, 3)
+}
+
+// GenerateCJKGrams generates every individual character plus every
+// adjacent character pair of a keyword.
+// Example: "数据库" → ["数", "据", "库", "数据", "据库"]
+func GenerateCJKGrams(keyword string) []string {
+	keyword = strings.ToLower(keyword)
 	runes := []rune(keyword)
-	for i := 0; i <= len(runes)-3; i++ {
-		trigrams = append(trigrams, string(runes[i:i+3]))
+	grams := make([]string, 0, 2*len(runes))
+	for _, r := range runes {
+		grams = append(grams, string(r))
+	}
+	for i := 0; i+1 < len(runes); i++ {
+		grams = append(grams, string(runes[i:i+2]))
 	}
-	return trigrams
+	return grams
+}
+
+// isCJK reports whether r is a Chinese, Japanese or Korean character.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
 }
 
-// Add indexes keywords for a given VectorID.
+// containsCJK reports whether s contains any CJK character.
+func containsCJK(s string) bool {
+	for _, r := range s {
+		if isCJK(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// gramSizes returns the configured n-gram sizes in ascending order.
+func (ii *InvertedIndex) gramSizes() []int {
+	if len(ii.NGramSizes) > 0 {
+		sizes := slices.Clone(ii.NGramSizes)
+		sort.Ints(sizes)
+		return sizes
+	}
+	if ii.NGramSize > 0 {
+		return []int{ii.NGramSize}
+	}
+	return []int{DefaultNGramSize}
+}
+
+// indexGrams returns the deduplicated n-grams of all configured sizes for a keyword.
+func (ii *InvertedIndex) indexGrams(keyword string) []string {
+	switch {
+	case ii.TokenizationMode == TokenizeWhitespace:
+		return dedupe(strings.Fields(keyword))
+	case ii.TokenizationMode == TokenizeCJKChar && containsCJK(keyword):
+		return dedupe(GenerateCJKGrams(keyword))
+	}
+
+	var grams []string
+	for _, n := range ii.gramSizes() {
+		grams = append(grams, GenerateNGrams(keyword, n)...)
+	}
+	return dedupe(grams)
+}
+
+// queryGrams returns the n-grams used to look up a partial-match query,
+// using the largest configured size that fits the query.
+func (ii *InvertedIndex) queryGrams(substr string) []string {
+	switch {
+	case ii.TokenizationMode == TokenizeWhitespace:
+		return strings.Fields(substr)
+	case ii.TokenizationMode == TokenizeCJKChar && containsCJK(substr):
+		// Bigrams cover any query of two or more characters
+		return GenerateNGrams(substr, 2)
+	}
+
+	sizes := ii.gramSizes()
+	n := sizes[0]
+	length := len([]rune(substr))
+	for _, size := range sizes {
+		if size <= length {
+			n = size
+		}
+	}
+	return GenerateNGrams(substr, n)
+}
+
+// Add indexes keywords for a given VectorID. A keyword given more than once,
+// in this or earlier calls, raises its BM25 term frequency.
 func (ii *InvertedIndex) Add(keywords []string, vectorID uint64) {
 	ii.mu.Lock()
 	defer ii.mu.Unlock()
 
 	for _, kw := range keywords {
 		kw = strings.ToLower(kw)
-		trigrams := GenerateTrigrams(kw)
-		for _, tg := range trigrams {
-			ii.index[tg] = appendUnique(ii.index[tg], vectorID)
+		for _, tg := range ii.indexGrams(kw) {
+			ii.addPosting(tg, vectorID)
 		}
 		// Also index the full keyword for exact match
-		ii.index["kw:"+kw] = appendUnique(ii.index["kw:"+kw], vectorID)
+		ii.addPosting("kw:"+kw, vectorID)
+	}
+	ii.dirty = true
+}
+
+// addPosting adds vectorID to the postings list for key and records the
+// reverse mapping. Adding a full keyword posting again counts a repeat of
+// the keyword. Caller must hold ii.mu.
+func (ii *InvertedIndex) addPosting(key string, vectorID uint64) {
+	before := len(ii.index[key])
+	ii.index[key] = appendUnique(ii.index[key], vectorID)
+	added := len(ii.index[key]) > before
+	if added {
+		ii.docToKeys[vectorID] = append(ii.docToKeys[vectorID], key)
 	}
+	term, ok := strings.CutPrefix(key, "kw:")
+	if !ok {
+		return
+	}
+	if added {
+		if ii.docFreq[term]++; ii.docFreq[term] == 1 {
+			ii.vocab.Insert(term)
+		}
+	} else {
+		freqs := ii.termFreq[vectorID]
+		if freqs == nil {
+			freqs = make(map[string]int)
+			ii.termFreq[vectorID] = freqs
+		}
+		freqs[term] = ii.termFrequency(term, vectorID) + 1
+	}
+	ii.docLengths[vectorID]++
+	ii.totalLength++
+}
+
+// removePosting removes vectorID from the postings list for key, dropping the
+// list once empty. The reverse mapping is left to the caller. Caller must hold ii.mu.
+func (ii *InvertedIndex) removePosting(key string, vectorID uint64) {
+	before := len(ii.index[key])
+	postings := removeValue(ii.index[key], vectorID)
+	if len(postings) == 0 {
+		delete(ii.index, key)
+	} else {
+		ii.index[key] = postings
+	}
+	if len(postings) == before {
+		return
+	}
+	if term, ok := strings.CutPrefix(key, "kw:"); ok {
+		if ii.docFreq[term]--; ii.docFreq[term] <= 0 {
+			delete(ii.docFreq, term)
+			ii.vocab.Remove(term)
+		}
+		tf := ii.termFrequency(term, vectorID)
+		if freqs := ii.termFreq[vectorID]; freqs != nil {
+			if delete(freqs, term); len(freqs) == 0 {
+				delete(ii.termFreq, vectorID)
+			}
+		}
+		if ii.docLengths[vectorID] -= tf; ii.docLengths[vectorID] <= 0 {
+			delete(ii.docLengths, vectorID)
+		}
+		ii.totalLength -= tf
+	}
+}
+
+// termFrequency returns the number of times vectorID was given term, which
+// it must be indexed under. Caller must hold ii.mu.
+func (ii *InvertedIndex) termFrequency(term string, vectorID uint64) int {
+	if n := ii.termFreq[vectorID][term]; n > 0 {
+		return n
+	}
+	return 1
 }
 
 // Delete removes keyword indexing for a given VectorID.
@@ -62,14 +308,161 @@ func (ii *InvertedIndex) Delete(keywords []string, vectorID uint64) {
 	ii.mu.Lock()
 	defer ii.mu.Unlock()
 
+	removed := make(map[string]struct{})
 	for _, kw := range keywords {
 		kw = strings.ToLower(kw)
-		trigrams := GenerateTrigrams(kw)
-		for _, tg := range trigrams {
-			ii.index[tg] = removeValue(ii.index[tg], vectorID)
+		for _, tg := range ii.indexGrams(kw) {
+			ii.removePosting(tg, vectorID)
+			removed[tg] = struct{}{}
+		}
+		ii.removePosting("kw:"+kw, vectorID)
+		removed["kw:"+kw] = struct{}{}
+	}
+
+	remaining := ii.docToKeys[vectorID][:0]
+	for _, key := range ii.docToKeys[vectorID] {
+		if _, ok := removed[key]; !ok {
+			remaining = append(remaining, key)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(ii.docToKeys, vectorID)
+	} else {
+		ii.docToKeys[vectorID] = remaining
+	}
+	ii.dirty = true
+}
+
+// DeleteDoc removes a VectorID from every postings list it appears in,
+// using the reverse map instead of the original keywords.
+func (ii *InvertedIndex) DeleteDoc(vectorID uint64) {
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+
+	keys, ok := ii.docToKeys[vectorID]
+	if !ok {
+		return
+	}
+	for _, key := range keys {
+		ii.removePosting(key, vectorID)
+	}
+	delete(ii.docToKeys, vectorID)
+	ii.dirty = true
+}
+
+// PruneDocs removes every VectorID for which keep returns false from all
+// postings lists, including IDs missing from the reverse map. Returns the
+// number of distinct VectorIDs removed.
+func (ii *InvertedIndex) PruneDocs(keep func(vectorID uint64) bool) int {
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+
+	removed := make(map[uint64]struct{})
+	for key, postings := range ii.index {
+		kept := postings[:0]
+		for _, id := range postings {
+			if keep(id) {
+				kept = append(kept, id)
+			} else {
+				removed[id] = struct{}{}
+			}
+		}
+		if len(kept) == 0 {
+			delete(ii.index, key)
+		} else {
+			ii.index[key] = kept
+		}
+	}
+	for id := range ii.docToKeys {
+		if !keep(id) {
+			removed[id] = struct{}{}
+			delete(ii.docToKeys, id)
+		}
+	}
+
+	if len(removed) > 0 {
+		ii.rebuildStats()
+		ii.dirty = true
+	}
+	return len(removed)
+}
+
+// Compact drops every VectorID not in activeIDs from the postings lists,
+// deletes the lists left empty and trims the spare capacity of the others.
+// Returns the number of postings keys removed.
+func (ii *InvertedIndex) Compact(activeIDs *BitSet) int {
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+
+	removedKeys, pruned := 0, false
+	for key, postings := range ii.index {
+		kept := postings[:0]
+		for _, id := range postings {
+			if activeIDs.Contains(id) {
+				kept = append(kept, id)
+			}
+		}
+		pruned = pruned || len(kept) < len(postings)
+		switch {
+		case len(kept) == 0:
+			delete(ii.index, key)
+			removedKeys++
+		case cap(kept) > len(kept):
+			ii.index[key] = slices.Clip(slices.Clone(kept))
+		default:
+			ii.index[key] = kept
+		}
+	}
+	for id := range ii.docToKeys {
+		if !activeIDs.Contains(id) {
+			delete(ii.docToKeys, id)
 		}
-		ii.index["kw:"+kw] = removeValue(ii.index["kw:"+kw], vectorID)
 	}
+
+	if pruned || removedKeys > 0 {
+		ii.rebuildStats()
+		ii.dirty = true
+	}
+	return removedKeys
+}
+
+// Renumber changes every VectorID in the postings lists to remap[VectorID],
+// dropping IDs that are not in remap.
+func (ii *InvertedIndex) Renumber(remap map[uint64]uint64) {
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+
+	for key, postings := range ii.index {
+		kept := postings[:0]
+		for _, id := range postings {
+			if newID, ok := remap[id]; ok {
+				kept = append(kept, newID)
+			}
+		}
+		if len(kept) == 0 {
+			delete(ii.index, key)
+		} else {
+			ii.index[key] = kept
+		}
+	}
+	termFreq := make(map[uint64]map[string]int, len(ii.termFreq))
+	for id, freqs := range ii.termFreq {
+		if newID, ok := remap[id]; ok {
+			termFreq[newID] = freqs
+		}
+	}
+	ii.termFreq = termFreq
+	ii.rebuildDocToKeys()
+	ii.rebuildStats()
+	ii.dirty = true
+}
+
+// ContainsDoc reports whether vectorID has any keywords in the index.
+func (ii *InvertedIndex) ContainsDoc(vectorID uint64) bool {
+	ii.mu.RLock()
+	defer ii.mu.RUnlock()
+	_, ok := ii.docToKeys[vectorID]
+	return ok
 }
 
 // SearchExact finds VectorIDs that have all the specified keywords (exact match).
@@ -95,6 +488,24 @@ func (ii *InvertedIndex) SearchExact(keywords []string) *BitSet {
 	return result
 }
 
+// SearchAny finds VectorIDs that have at least one of the specified keywords (exact match).
+func (ii *InvertedIndex) SearchAny(keywords []string) *BitSet {
+	ii.mu.RLock()
+	defer ii.mu.RUnlock()
+
+	if len(keywords) == 0 {
+		return nil
+	}
+
+	result := NewBitSet()
+	for _, kw := range keywords {
+		for _, id := range ii.index["kw:"+strings.ToLower(kw)] {
+			result.Set(id)
+		}
+	}
+	return result
+}
+
 // SearchPrefix finds VectorIDs that have keywords starting with the given prefixes.
 func (ii *InvertedIndex) SearchPrefix(prefixes []string) *BitSet {
 	ii.mu.RLock()
@@ -145,8 +556,8 @@ func (ii *InvertedIndex) SearchPartial(substrings []string) *BitSet {
 		substr = strings.ToLower(substr)
 		candidates := NewBitSet()
 
-		// Use trigrams to find candidates
-		trigrams := GenerateTrigrams(substr)
+		// Use n-grams to find candidates
+		trigrams := ii.queryGrams(substr)
 		if len(trigrams) > 0 {
 			// Start with first trigram's matches
 			for _, id := range ii.index[trigrams[0]] {
@@ -170,6 +581,7 @@ func (ii *InvertedIndex) SearchPartial(substrings []string) *BitSet {
 }
 
 // SearchLevenshtein finds VectorIDs with keywords within Levenshtein distance.
+// Matching keywords are looked up in the vocabulary BK-tree.
 func (ii *InvertedIndex) SearchLevenshtein(keywords []string, maxDistance uint32) *BitSet {
 	ii.mu.RLock()
 	defer ii.mu.RUnlock()
@@ -180,18 +592,10 @@ func (ii *InvertedIndex) SearchLevenshtein(keywords []string, maxDistance uint32
 
 	var result *BitSet
 	for _, query := range keywords {
-		query = strings.ToLower(query)
 		candidates := NewBitSet()
-
-		// Scan all indexed keywords
-		for key, ids := range ii.index {
-			if strings.HasPrefix(key, "kw:") {
-				keyword := strings.TrimPrefix(key, "kw:")
-				if levenshteinDistance(query, keyword) <= int(maxDistance) {
-					for _, id := range ids {
-						candidates.Set(id)
-					}
-				}
+		for _, keyword := range ii.vocab.Search(strings.ToLower(query), int(maxDistance)) {
+			for _, id := range ii.index["kw:"+keyword] {
+				candidates.Set(id)
 			}
 		}
 
@@ -205,54 +609,691 @@ func (ii *InvertedIndex) SearchLevenshtein(keywords []string, maxDistance uint32
 	return result
 }
 
-// Search performs a keyword search with the specified mode.
+// ScoredMatch is a VectorID with its BM25 relevance score.
+type ScoredMatch struct {
+	VectorID uint64
+	Score    float64
+}
+
+// SearchBM25 ranks the VectorIDs matching any of the keywords by BM25 score
+// and returns the topK best, highest score first. topK <= 0 returns all matches.
+// Term frequency is the number of times a VectorID was given a keyword and
+// document length its number of keywords, counting repeats.
+func (ii *InvertedIndex) SearchBM25(keywords []string, topK int) []ScoredMatch {
+	ii.mu.RLock()
+	defer ii.mu.RUnlock()
+
+	if len(ii.docLengths) == 0 || len(keywords) == 0 {
+		return nil
+	}
+
+	scores := make(map[uint64]float64)
+	for _, term := range bm25Terms(keywords) {
+		for _, id := range ii.index["kw:"+term] {
+			scores[id] += ii.bm25Weight(term, id)
+		}
+	}
+
+	matches := make([]ScoredMatch, 0, len(scores))
+	for id, score := range scores {
+		matches = append(matches, ScoredMatch{VectorID: id, Score: score})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].VectorID < matches[j].VectorID
+	})
+	if topK > 0 && len(matches) > topK {
+		matches = matches[:topK]
+	}
+	return matches
+}
+
+// ScoredDoc is a VectorID with its Jaccard similarity to a query.
+type ScoredDoc struct {
+	VectorID uint64
+	Score    float32
+}
+
+// SearchJaccard scores the VectorIDs sharing a keyword with the query by the
+// Jaccard similarity of their keyword sets, |A ∩ B| / |A ∪ B|, and returns
+// those scoring at least threshold, highest score first. Candidates come from
+// the exact keyword postings and their keyword sets from the reverse map.
+func (ii *InvertedIndex) SearchJaccard(keywords []string, threshold float32) []ScoredDoc {
+	ii.mu.RLock()
+	defer ii.mu.RUnlock()
+
+	query := bm25Terms(keywords)
+	if len(query) == 0 {
+		return nil
+	}
+
+	shared := make(map[uint64]int) // VectorID -> |A ∩ B|
+	for _, term := range query {
+		for _, id := range ii.index["kw:"+term] {
+			shared[id]++
+		}
+	}
+
+	var docs []ScoredDoc
+	for id, n := range shared {
+		union := len(query) + ii.docKeywordCount(id) - n
+		if score := float32(n) / float32(union); score >= threshold {
+			docs = append(docs, ScoredDoc{VectorID: id, Score: score})
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Score != docs[j].Score {
+			return docs[i].Score > docs[j].Score
+		}
+		return docs[i].VectorID < docs[j].VectorID
+	})
+	return docs
+}
+
+// docKeywordCount returns the number of full keywords vectorID is indexed
+// under. Caller must hold ii.mu.
+func (ii *InvertedIndex) docKeywordCount(vectorID uint64) int {
+	n := 0
+	for _, key := range ii.docToKeys[vectorID] {
+		if strings.HasPrefix(key, "kw:") {
+			n++
+		}
+	}
+	return n
+}
+
+// ScoreDocument returns the BM25 score of a single VectorID for the keywords,
+// or 0 if it has none of them.
+func (ii *InvertedIndex) ScoreDocument(vectorID uint64, keywords []string) float64 {
+	ii.mu.RLock()
+	defer ii.mu.RUnlock()
+
+	docKeys := ii.docToKeys[vectorID]
+	var score float64
+	for _, term := range bm25Terms(keywords) {
+		if slices.Contains(docKeys, "kw:"+term) {
+			score += ii.bm25Weight(term, vectorID)
+		}
+	}
+	return score
+}
+
+// bm25Terms lowercases and de-duplicates query keywords.
+func bm25Terms(keywords []string) []string {
+	terms := make([]string, len(keywords))
+	for i, kw := range keywords {
+		terms[i] = strings.ToLower(kw)
+	}
+	return dedupe(terms)
+}
+
+// bm25Weight returns the BM25 contribution of term to a VectorID indexed under
+// it. Caller must hold ii.mu.
+func (ii *InvertedIndex) bm25Weight(term string, vectorID uint64) float64 {
+	n := float64(len(ii.docLengths))
+	df := float64(ii.docFreq[term])
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	tf := float64(ii.termFrequency(term, vectorID))
+	norm := 1 - ii.B + ii.B*float64(ii.docLengths[vectorID])/ii.avgDocLength()
+	return idf * tf * (ii.K1 + 1) / (tf + ii.K1*norm)
+}
+
+// AvgDocLength returns the mean number of keywords of the indexed VectorIDs,
+// counting repeats, or 0 for an empty index.
+func (ii *InvertedIndex) AvgDocLength() float64 {
+	ii.mu.RLock()
+	defer ii.mu.RUnlock()
+	return ii.avgDocLength()
+}
+
+// avgDocLength implements AvgDocLength. Caller must hold ii.mu.
+func (ii *InvertedIndex) avgDocLength() float64 {
+	if len(ii.docLengths) == 0 {
+		return 0
+	}
+	return float64(ii.totalLength) / float64(len(ii.docLengths))
+}
+
+// FuzzyKeywords returns the indexed keywords within maxDistance edits of any of
+// the given keywords, including exact matches.
+func (ii *InvertedIndex) FuzzyKeywords(keywords []string, maxDistance uint32) []string {
+	ii.mu.RLock()
+	defer ii.mu.RUnlock()
+
+	var matched []string
+	for _, query := range keywords {
+		matched = append(matched, ii.vocab.Search(strings.ToLower(query), int(maxDistance))...)
+	}
+	sort.Strings(matched)
+	return slices.Compact(matched)
+}
+
+// MatchingKeywords returns the indexed keywords that the keywords select in
+// mode: those starting with or containing one of them for "prefix" and
+// "partial", the keywords themselves, lowercased, otherwise.
+func (ii *InvertedIndex) MatchingKeywords(keywords []string, mode string) []string {
+	terms := bm25Terms(keywords)
+	var match func(term, query string) bool
+	switch mode {
+	case "prefix":
+		match = strings.HasPrefix
+	case "partial":
+		match = strings.Contains
+	default:
+		return terms
+	}
+
+	ii.mu.RLock()
+	defer ii.mu.RUnlock()
+	var matched []string
+	for term := range ii.docFreq {
+		if slices.ContainsFunc(terms, func(query string) bool { return match(term, query) }) {
+			matched = append(matched, term)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+// Search performs a keyword search with the specified mode. The "jaccard"
+// mode matches every VectorID sharing a keyword; see SearchJaccard for a
+// threshold.
 func (ii *InvertedIndex) Search(keywords []string, mode string, maxDistance uint32) *BitSet {
 	switch mode {
 	case "exact":
 		return ii.SearchExact(keywords)
+	case "any":
+		return ii.SearchAny(keywords)
 	case "prefix":
 		return ii.SearchPrefix(keywords)
 	case "partial":
 		return ii.SearchPartial(keywords)
 	case "levenshtein":
 		return ii.SearchLevenshtein(keywords, maxDistance)
+	case "jaccard":
+		return jaccardBitSet(ii.SearchJaccard(keywords, 0))
 	default:
 		return ii.SearchExact(keywords)
 	}
 }
 
-// Save persists the inverted index to disk.
-func (ii *InvertedIndex) Save() error {
+// jaccardBitSet returns the VectorIDs of docs as a BitSet.
+func jaccardBitSet(docs []ScoredDoc) *BitSet {
+	result := NewBitSet()
+	for _, doc := range docs {
+		result.Set(doc.VectorID)
+	}
+	return result
+}
+
+// IsDirty returns true if the index has unsaved changes.
+func (ii *InvertedIndex) IsDirty() bool {
 	ii.mu.RLock()
 	defer ii.mu.RUnlock()
+	return ii.dirty
+}
 
-	file, err := os.Create(ii.filePath)
+// Save persists the inverted index to disk. The output only depends on the
+// index contents, so equal indexes produce identical files. The file is
+// replaced atomically, so a crash mid-save keeps the previous one.
+func (ii *InvertedIndex) Save() error {
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+
+	keys := make([]string, 0, len(ii.index))
+	for key := range ii.index {
+		if len(key) > math.MaxUint16 {
+			return fmt.Errorf("keyword index key of %d bytes exceeds the %d byte limit", len(key), math.MaxUint16)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// bufio.Writer keeps the first write error, which writeFileAtomic returns from Flush
+	err := writeFileAtomic(ii.filePath, func(w *bufio.Writer) error {
+		ii.writeTo(w, keys)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	ii.dirty = false
+	return nil
+}
+
+// writeTo writes the index in the keywords.inv format, with the posting
+// lists in the order of keys. Caller must hold mu.
+func (ii *InvertedIndex) writeTo(w *bufio.Writer, keys []string) {
+	w.Write(ii.gramHeader(invMagic))
+	mode := ii.tokenizationMode()
+	w.WriteByte(byte(len(mode)))
+	w.WriteString(mode)
+	var buf [8]byte
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(keys)))
+	w.Write(buf[:4])
+	for _, key := range keys {
+		postings := ii.index[key]
+		binary.BigEndian.PutUint16(buf[:2], uint16(len(key)))
+		w.Write(buf[:2])
+		w.WriteString(key)
+		binary.BigEndian.PutUint32(buf[:4], uint32(len(postings)))
+		w.Write(buf[:4])
+		for _, id := range postings {
+			binary.BigEndian.PutUint64(buf[:], id)
+			w.Write(buf[:])
+		}
+	}
+
+	ids := make([]uint64, 0, len(ii.termFreq))
+	count := 0
+	for id, freqs := range ii.termFreq {
+		ids = append(ids, id)
+		count += len(freqs)
+	}
+	slices.Sort(ids)
+	binary.BigEndian.PutUint32(buf[:4], uint32(count))
+	w.Write(buf[:4])
+	for _, id := range ids {
+		freqs := ii.termFreq[id]
+		terms := make([]string, 0, len(freqs))
+		for term := range freqs {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+		for _, term := range terms {
+			binary.BigEndian.PutUint64(buf[:], id)
+			w.Write(buf[:])
+			binary.BigEndian.PutUint16(buf[:2], uint16(len(term)))
+			w.Write(buf[:2])
+			w.WriteString(term)
+			binary.BigEndian.PutUint32(buf[:4], uint32(freqs[term]))
+			w.Write(buf[:4])
+		}
+	}
+}
 
-	encoder := gob.NewEncoder(file)
-	return encoder.Encode(ii.index)
+// gramHeader returns the magic followed by the n-gram sizes of the index.
+func (ii *InvertedIndex) gramHeader(magic string) []byte {
+	sizes := ii.gramSizes()
+	header := []byte(magic)
+	header = append(header, byte(len(sizes)))
+	for _, n := range sizes {
+		header = append(header, byte(n))
+	}
+	return header
 }
 
-// Load reads the inverted index from disk.
+// Load reads the inverted index from disk. Files written in the older GOB
+// format are read with LoadLegacyGob.
 func (ii *InvertedIndex) Load() error {
 	ii.mu.Lock()
 	defer ii.mu.Unlock()
 
+	file, err := ii.openIndexFile()
+	if file == nil || err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+
+	peeked, err := reader.Peek(len(invMagic))
+	magic := string(peeked)
+	if err != nil || (magic != invMagic && magic != invMagicFreq && magic != invMagicNoFreq) {
+		return ii.loadLegacyGob(reader)
+	}
+	hasFreq := magic != invMagicNoFreq
+	if err := ii.readGramHeader(reader); err != nil {
+		return err
+	}
+	mode := TokenizeNGram
+	if magic == invMagic {
+		if mode, err = readTokenizationMode(reader); err != nil {
+			return err
+		}
+	}
+	if err := ii.checkTokenizationMode(mode); err != nil {
+		return err
+	}
+
+	var buf [8]byte
+	if _, err := io.ReadFull(reader, buf[:4]); err != nil {
+		return fmt.Errorf("failed to read keyword index: %w", err)
+	}
+	remaining, err := unreadBytes(file, reader)
+	if err != nil {
+		return fmt.Errorf("failed to read keyword index: %w", err)
+	}
+	// Each key record holds at least its key and posting list lengths
+	count := binary.BigEndian.Uint32(buf[:4])
+	if err := ii.checkCount("keys", uint64(count), remaining, 6); err != nil {
+		return err
+	}
+	ii.index = make(map[string][]uint64, count)
+	var raw []byte
+	for range count {
+		if _, err := io.ReadFull(reader, buf[:2]); err != nil {
+			return fmt.Errorf("failed to read keyword index: %w", err)
+		}
+		keyBytes := make([]byte, binary.BigEndian.Uint16(buf[:2]))
+		if _, err := io.ReadFull(reader, keyBytes); err != nil {
+			return fmt.Errorf("failed to read keyword index: %w", err)
+		}
+		if _, err := io.ReadFull(reader, buf[:4]); err != nil {
+			return fmt.Errorf("failed to read keyword index: %w", err)
+		}
+		remaining -= int64(2 + len(keyBytes) + 4)
+		length := binary.BigEndian.Uint32(buf[:4])
+		if err := ii.checkCount("postings", uint64(length), remaining, 8); err != nil {
+			return err
+		}
+		postings := make([]uint64, length)
+		raw = slices.Grow(raw[:0], 8*len(postings))[:8*len(postings)]
+		if _, err := io.ReadFull(reader, raw); err != nil {
+			return fmt.Errorf("failed to read keyword index: %w", err)
+		}
+		remaining -= int64(len(raw))
+		for i := range postings {
+			postings[i] = binary.BigEndian.Uint64(raw[8*i:])
+		}
+		ii.index[string(keyBytes)] = postings
+	}
+
+	ii.termFreq = make(map[uint64]map[string]int)
+	if hasFreq {
+		if err := ii.readTermFreq(reader); err != nil {
+			return fmt.Errorf("failed to read keyword frequencies: %w", err)
+		}
+	}
+
+	ii.rebuildDocToKeys()
+	ii.rebuildStats()
+	return nil
+}
+
+// readTermFreq reads the term frequency table into ii.termFreq.
+// Caller must hold ii.mu.
+func (ii *InvertedIndex) readTermFreq(reader *bufio.Reader) error {
+	var buf [8]byte
+	if _, err := io.ReadFull(reader, buf[:4]); err != nil {
+		return err
+	}
+	for range binary.BigEndian.Uint32(buf[:4]) {
+		if _, err := io.ReadFull(reader, buf[:]); err != nil {
+			return err
+		}
+		id := binary.BigEndian.Uint64(buf[:])
+		if _, err := io.ReadFull(reader, buf[:2]); err != nil {
+			return err
+		}
+		term := make([]byte, binary.BigEndian.Uint16(buf[:2]))
+		if _, err := io.ReadFull(reader, term); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(reader, buf[:4]); err != nil {
+			return err
+		}
+		freqs := ii.termFreq[id]
+		if freqs == nil {
+			freqs = make(map[string]int)
+			ii.termFreq[id] = freqs
+		}
+		freqs[string(term)] = int(binary.BigEndian.Uint32(buf[:4]))
+	}
+	return nil
+}
+
+// rebuildDocToKeys recomputes the reverse map from the postings lists. The
+// key lists are grouped by document before the map is filled, so it gets one
+// insert per document instead of one per posting: with a counting sort when
+// vector IDs are dense, as IDs assigned by the forward index are, and a
+// comparison sort otherwise.
+// Caller must hold ii.mu.
+func (ii *InvertedIndex) rebuildDocToKeys() {
+	keys := make([]string, 0, len(ii.index))
+	total := 0
+	var maxID uint64
+	for key, postings := range ii.index {
+		keys = append(keys, key)
+		total += len(postings)
+		for _, id := range postings {
+			maxID = max(maxID, id)
+		}
+	}
+	ii.docToKeys = make(map[uint64][]string)
+	if total == 0 {
+		return
+	}
+	backing := make([]string, total)
+
+	if maxID < uint64(2*total) {
+		starts := make([]int, maxID+2)
+		for _, postings := range ii.index {
+			for _, id := range postings {
+				starts[id+1]++
+			}
+		}
+		for id := 1; id < len(starts); id++ {
+			starts[id] += starts[id-1]
+		}
+		next := slices.Clone(starts[:maxID+1])
+		for _, key := range keys {
+			for _, id := range ii.index[key] {
+				backing[next[id]] = key
+				next[id]++
+			}
+		}
+		for id := range maxID + 1 {
+			if start, end := starts[id], starts[id+1]; end > start {
+				ii.docToKeys[id] = backing[start:end:end]
+			}
+		}
+		return
+	}
+
+	type docKey struct {
+		id  uint64
+		key int // Index into keys
+	}
+	pairs := make([]docKey, 0, total)
+	for i, key := range keys {
+		for _, id := range ii.index[key] {
+			pairs = append(pairs, docKey{id, i})
+		}
+	}
+	slices.SortFunc(pairs, func(a, b docKey) int { return cmp.Compare(a.id, b.id) })
+	for start := 0; start < len(pairs); {
+		end := start + 1
+		for end < len(pairs) && pairs[end].id == pairs[start].id {
+			end++
+		}
+		for i := start; i < end; i++ {
+			backing[i] = keys[pairs[i].key]
+		}
+		ii.docToKeys[pairs[start].id] = backing[start:end:end]
+		start = end
+	}
+}
+
+// LoadLegacyGob reads an index written in the GOB format used before the
+// binary format. Saving it afterwards writes the current format.
+func (ii *InvertedIndex) LoadLegacyGob() error {
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+
+	file, err := ii.openIndexFile()
+	if file == nil || err != nil {
+		return err
+	}
+	defer file.Close()
+	return ii.loadLegacyGob(bufio.NewReader(file))
+}
+
+// openIndexFile opens the index file for reading. If the file does not exist
+// it resets the index to empty and returns a nil file.
+// Caller must hold ii.mu.
+func (ii *InvertedIndex) openIndexFile() (*os.File, error) {
 	file, err := os.Open(ii.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			ii.index = make(map[string][]uint64)
-			return nil
+			ii.docToKeys = make(map[uint64][]string)
+			ii.termFreq = make(map[uint64]map[string]int)
+			ii.rebuildStats()
+			return nil, nil
 		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// unreadBytes returns the number of bytes of file not yet consumed through
+// reader, including those it has buffered.
+func unreadBytes(file *os.File, reader *bufio.Reader) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	pos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size() - pos + int64(reader.Buffered()), nil
+}
+
+// checkCount returns an IndexCorruptedError if the file claims more records
+// than the available bytes can hold, so that a corrupt length cannot reserve
+// more memory than the file is worth.
+func (ii *InvertedIndex) checkCount(what string, count uint64, available int64, recordSize int) error {
+	if maxCount := uint64(max(available, 0)) / uint64(recordSize); count > maxCount {
+		err := fmt.Errorf("file claims %d %s, but holds at most %d", count, what, maxCount)
+		return &types.IndexCorruptedError{Path: ii.filePath, Err: err}
+	}
+	return nil
+}
+
+// readGramHeader reads the magic and n-gram sizes and checks that the sizes
+// match the index configuration.
+func (ii *InvertedIndex) readGramHeader(reader *bufio.Reader) error {
+	reader.Discard(len(invMagic))
+	count, err := reader.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read n-gram header: %w", err)
+	}
+	sizeBytes := make([]byte, count)
+	if _, err := io.ReadFull(reader, sizeBytes); err != nil {
+		return fmt.Errorf("failed to read n-gram header: %w", err)
+	}
+	storedSizes := make([]int, 0, len(sizeBytes))
+	for _, b := range sizeBytes {
+		storedSizes = append(storedSizes, int(b))
+	}
+	if !slices.Equal(storedSizes, ii.gramSizes()) {
+		return fmt.Errorf("n-gram size mismatch: file has %v, expected %v", storedSizes, ii.gramSizes())
+	}
+	return nil
+}
+
+// readTokenizationMode reads the tokenization mode following the n-gram
+// header.
+func readTokenizationMode(reader *bufio.Reader) (string, error) {
+	n, err := reader.ReadByte()
+	if err != nil {
+		return "", fmt.Errorf("failed to read tokenization mode: %w", err)
+	}
+	mode := make([]byte, n)
+	if _, err := io.ReadFull(reader, mode); err != nil {
+		return "", fmt.Errorf("failed to read tokenization mode: %w", err)
+	}
+	return string(mode), nil
+}
+
+// tokenizationMode returns the tokenization mode of the index, TokenizeNGram
+// unless set.
+func (ii *InvertedIndex) tokenizationMode() string {
+	if ii.TokenizationMode == "" {
+		return TokenizeNGram
+	}
+	return ii.TokenizationMode
+}
+
+// checkTokenizationMode checks that an index file built with mode matches
+// the index configuration.
+func (ii *InvertedIndex) checkTokenizationMode(mode string) error {
+	if mode != ii.tokenizationMode() {
+		return fmt.Errorf("tokenization mode mismatch: file has %q, expected %q", mode, ii.tokenizationMode())
+	}
+	return nil
+}
+
+// loadLegacyGob implements LoadLegacyGob. Caller must hold ii.mu.
+func (ii *InvertedIndex) loadLegacyGob(reader *bufio.Reader) error {
+	if err := ii.checkTokenizationMode(TokenizeNGram); err != nil {
 		return err
 	}
-	defer file.Close()
+	if magic, err := reader.Peek(len(invMagicGob)); err == nil && bytes.Equal(magic, []byte(invMagicGob)) {
+		if err := ii.readGramHeader(reader); err != nil {
+			return err
+		}
+	} else if sizes := ii.gramSizes(); !slices.Equal(sizes, []int{DefaultNGramSize}) {
+		// Files without a header are trigram-only
+		return fmt.Errorf("n-gram size mismatch: file has %v, expected %v", []int{DefaultNGramSize}, sizes)
+	}
+
+	decoder := gob.NewDecoder(reader)
+	if err := decoder.Decode(&ii.index); err != nil {
+		return err
+	}
+	ii.termFreq = make(map[uint64]map[string]int)
 
-	decoder := gob.NewDecoder(file)
-	return decoder.Decode(&ii.index)
+	// Older files have no reverse map; rebuild it from the postings lists.
+	ii.docToKeys = make(map[uint64][]string)
+	if err := decoder.Decode(&ii.docToKeys); err != nil {
+		if err != io.EOF {
+			return fmt.Errorf("failed to read reverse index: %w", err)
+		}
+		ii.rebuildDocToKeys()
+	}
+
+	ii.rebuildStats()
+	return nil
+}
+
+// rebuildStats recomputes the BM25 statistics and the vocabulary from the
+// postings lists and term frequencies, dropping the frequencies of keywords
+// no longer indexed. The reverse map must be up to date.
+// Caller must hold ii.mu.
+func (ii *InvertedIndex) rebuildStats() {
+	ii.docFreq = make(map[string]int)
+	ii.docLengths = make(map[uint64]int)
+	ii.totalLength = 0
+	ii.vocab = BKTree{}
+	for key, postings := range ii.index {
+		term, ok := strings.CutPrefix(key, "kw:")
+		if !ok || len(postings) == 0 {
+			continue
+		}
+		ii.docFreq[term] = len(postings)
+		ii.vocab.Insert(term)
+		for _, id := range postings {
+			ii.docLengths[id]++
+		}
+		ii.totalLength += len(postings)
+	}
+	for id, freqs := range ii.termFreq {
+		for term, n := range freqs {
+			if !slices.Contains(ii.docToKeys[id], "kw:"+term) {
+				delete(freqs, term)
+				continue
+			}
+			ii.docLengths[id] += n - 1
+			ii.totalLength += n - 1
+		}
+		if len(freqs) == 0 {
+			delete(ii.termFreq, id)
+		}
+	}
 }
 
 // Helper functions
@@ -266,6 +1307,19 @@ func appendUnique(slice []uint64, value uint64) []uint64 {
 	return append(slice, value)
 }
 
+// dedupe returns the distinct strings of a slice, preserving order.
+func dedupe(items []string) []string {
+	seen := make(map[string]struct{}, len(items))
+	result := items[:0]
+	for _, s := range items {
+		if _, ok := seen[s]; !ok {
+			seen[s] = struct{}{}
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
 func removeValue(slice []uint64, value uint64) []uint64 {
 	result := make([]uint64, 0, len(slice))
 	for _, v := range slice {
@@ -0,0 +1,654 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestInvertedIndex_BigramPartialSearch(t *testing.T) {
+	ii := NewInvertedIndex(filepath.Join(t.TempDir(), "keywords.inv"))
+	ii.NGramSize = 2
+
+	ii.Add([]string{"finance"}, 1)
+	ii.Add([]string{"sports"}, 2)
+	ii.Add([]string{"go"}, 3)
+
+	cases := []struct {
+		query string
+		want  []uint64
+	}{
+		{"in", []uint64{1}},
+		{"nanc", []uint64{1}},
+		{"port", []uint64{2}},
+		{"go", []uint64{3}},
+		{"xyz", []uint64{}},
+	}
+	for _, tc := range cases {
+		got := ii.SearchPartial([]string{tc.query}).ToSlice()
+		if len(got) != len(tc.want) {
+			t.Errorf("SearchPartial(%q) = %v, want %v", tc.query, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("SearchPartial(%q) = %v, want %v", tc.query, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestInvertedIndex_MultiGramSizes(t *testing.T) {
+	ii := NewInvertedIndex(filepath.Join(t.TempDir(), "keywords.inv"))
+	ii.NGramSizes = []int{2, 3}
+
+	ii.Add([]string{"finance"}, 1)
+
+	// Two-character queries hit the bigram postings, longer ones the trigrams.
+	if !ii.SearchPartial([]string{"na"}).Contains(1) {
+		t.Error("Expected bigram query to match")
+	}
+	if !ii.SearchPartial([]string{"ance"}).Contains(1) {
+		t.Error("Expected trigram query to match")
+	}
+}
+
+func TestInvertedIndex_LoadValidatesNGramSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.inv")
+
+	ii := NewInvertedIndex(path)
+	ii.NGramSize = 2
+	ii.Add([]string{"finance"}, 1)
+	if err := ii.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	reloaded := NewInvertedIndex(path)
+	reloaded.NGramSize = 2
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reloaded.SearchPartial([]string{"in"}).Contains(1) {
+		t.Error("Reloaded index lost postings")
+	}
+
+	mismatched := NewInvertedIndex(path)
+	if err := mismatched.Load(); err == nil {
+		t.Error("Expected n-gram size mismatch error, got nil")
+	}
+}
+
+func TestInvertedIndex_LoadValidatesTokenizationMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.inv")
+
+	ii := NewInvertedIndex(path)
+	ii.TokenizationMode = TokenizeCJKChar
+	ii.Add([]string{"数据库"}, 1)
+	if err := ii.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	reloaded := NewInvertedIndex(path)
+	reloaded.TokenizationMode = TokenizeCJKChar
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reloaded.SearchPartial([]string{"据"}).Contains(1) {
+		t.Error("Reloaded index lost postings")
+	}
+
+	for _, mode := range []string{"", TokenizeWhitespace} {
+		mismatched := NewInvertedIndex(path)
+		mismatched.TokenizationMode = mode
+		if err := mismatched.Load(); err == nil {
+			t.Errorf("Expected a tokenization mode mismatch loading with mode %q, got nil", mode)
+		}
+	}
+}
+
+func TestInvertedIndex_LoadRejectsCorruptCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.inv")
+
+	ii := NewInvertedIndex(path)
+	ii.Add([]string{"finance"}, 1)
+	if err := ii.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The key count follows the n-gram header and tokenization mode
+	countOffset := len(ii.gramHeader(invMagic)) + 1 + len(ii.tokenizationMode())
+	// The first posting list length follows its key
+	keyLen := int(binary.BigEndian.Uint16(data[countOffset+4:]))
+	lengthOffset := countOffset + 4 + 2 + keyLen
+
+	for name, offset := range map[string]int{"key count": countOffset, "posting list length": lengthOffset} {
+		corrupt := slices.Clone(data)
+		binary.BigEndian.PutUint32(corrupt[offset:], 0xFFFFFFFF)
+		if err := os.WriteFile(path, corrupt, 0644); err != nil {
+			t.Fatal(err)
+		}
+		var corrupted *types.IndexCorruptedError
+		if err := NewInvertedIndex(path).Load(); !errors.As(err, &corrupted) {
+			t.Errorf("Expected IndexCorruptedError for a corrupt %s, got %v", name, err)
+		}
+	}
+}
+
+func TestInvertedIndex_CJKCharTokenization(t *testing.T) {
+	ii := NewInvertedIndex(filepath.Join(t.TempDir(), "keywords.inv"))
+	ii.TokenizationMode = TokenizeCJKChar
+
+	ii.Add([]string{"数据库"}, 1)
+	ii.Add([]string{"数据分析"}, 2)
+	ii.Add([]string{"图书馆"}, 3)
+	ii.Add([]string{"finance"}, 4)
+
+	cases := []struct {
+		query string
+		want  []uint64
+	}{
+		{"数据", []uint64{1, 2}},
+		{"据库", []uint64{1}},
+		{"书", []uint64{3}},
+		{"分析", []uint64{2}},
+		{"库分", []uint64{}},
+		{"nanc", []uint64{4}},
+	}
+	for _, tc := range cases {
+		got := ii.SearchPartial([]string{tc.query}).ToSlice()
+		if len(got) != len(tc.want) {
+			t.Errorf("SearchPartial(%q) = %v, want %v", tc.query, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("SearchPartial(%q) = %v, want %v", tc.query, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestInvertedIndex_WhitespaceTokenization(t *testing.T) {
+	ii := NewInvertedIndex(filepath.Join(t.TempDir(), "keywords.inv"))
+	ii.TokenizationMode = TokenizeWhitespace
+
+	ii.Add([]string{"machine learning"}, 1)
+	ii.Add([]string{"deep learning models"}, 2)
+
+	if got := ii.SearchPartial([]string{"learning"}).ToSlice(); len(got) != 2 {
+		t.Errorf("Expected 2 matches for 'learning', got %v", got)
+	}
+	if got := ii.SearchPartial([]string{"deep models"}).ToSlice(); len(got) != 1 || got[0] != 2 {
+		t.Errorf("Expected [2] for 'deep models', got %v", got)
+	}
+	if got := ii.SearchPartial([]string{"learn"}).ToSlice(); len(got) != 0 {
+		t.Errorf("Expected no matches for partial word, got %v", got)
+	}
+}
+
+func TestInvertedIndex_DeleteDoc(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.inv")
+	ii := NewInvertedIndex(path)
+	ii.Add([]string{"finance", "report"}, 1)
+	ii.Add([]string{"finance"}, 2)
+
+	ii.DeleteDoc(1)
+
+	for key, postings := range ii.index {
+		for _, id := range postings {
+			if id == 1 {
+				t.Errorf("VectorID 1 still in postings for %q", key)
+			}
+		}
+	}
+	if _, ok := ii.index["kw:report"]; ok {
+		t.Error("Expected empty postings list to be removed")
+	}
+	if !ii.SearchExact([]string{"finance"}).Contains(2) {
+		t.Error("DeleteDoc removed an unrelated document")
+	}
+
+	// The reverse map survives a save/load cycle.
+	if err := ii.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	reloaded := NewInvertedIndex(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	reloaded.DeleteDoc(2)
+	if !reloaded.SearchExact([]string{"finance"}).IsEmpty() {
+		t.Error("Expected reloaded DeleteDoc to remove VectorID 2")
+	}
+}
+
+func TestInvertedIndex_Compact(t *testing.T) {
+	ii := NewInvertedIndex(filepath.Join(t.TempDir(), "keywords.inv"))
+	postingsCount := func() int {
+		total := 0
+		for _, postings := range ii.index {
+			total += len(postings)
+		}
+		return total
+	}
+
+	const n = 1000
+	for id := uint64(1); id <= n; id++ {
+		ii.Add([]string{fmt.Sprintf("doc%04d", id), "shared"}, id)
+	}
+	keysBefore, postingsBefore := len(ii.index), postingsCount()
+
+	// Only every fifth document is still active; the rest were deleted
+	// without their postings
+	active := NewBitSet()
+	for id := uint64(5); id <= n; id += 5 {
+		active.Set(id)
+	}
+	removed := ii.Compact(active)
+
+	if removed != keysBefore-len(ii.index) || removed == 0 {
+		t.Errorf("Compact reported %d keys removed, index went from %d to %d", removed, keysBefore, len(ii.index))
+	}
+	// Each document has its own "kw:docNNNN" key, plus n-grams shared with
+	// others, so the keys shrink at least by the deleted documents' own keys
+	if len(ii.index) > keysBefore-(n-n/5) {
+		t.Errorf("Expected at most %d keys after compaction, got %d", keysBefore-(n-n/5), len(ii.index))
+	}
+	if got, want := postingsCount(), postingsBefore/5; got != want {
+		t.Errorf("Expected %d postings after compaction, got %d", want, got)
+	}
+	for key, postings := range ii.index {
+		if len(postings) == 0 || cap(postings) != len(postings) {
+			t.Errorf("Postings for %q have length %d and capacity %d", key, len(postings), cap(postings))
+		}
+	}
+	if len(ii.docToKeys) != n/5 {
+		t.Errorf("Expected %d documents in the reverse map, got %d", n/5, len(ii.docToKeys))
+	}
+
+	hits := ii.SearchExact([]string{"shared"})
+	if hits.Count() != n/5 || !hits.Contains(5) || hits.Contains(4) {
+		t.Errorf("Expected the %d active documents to match, got %v", n/5, hits.ToSlice())
+	}
+	if !ii.SearchExact([]string{"doc0004"}).IsEmpty() {
+		t.Error("Expected no matches for a deleted document's keyword")
+	}
+	if got := ii.Compact(active); got != 0 {
+		t.Errorf("Expected a second Compact to remove nothing, removed %d", got)
+	}
+}
+
+func TestInvertedIndex_SearchBM25(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.inv")
+	ii := NewInvertedIndex(path)
+	ii.Add([]string{"go", "database"}, 1)
+	ii.Add([]string{"go"}, 2)
+	ii.Add([]string{"database", "vector", "search", "index"}, 3)
+	ii.Add([]string{"rust"}, 4)
+
+	ids := func(matches []ScoredMatch) []uint64 {
+		out := make([]uint64, len(matches))
+		for i, m := range matches {
+			out[i] = m.VectorID
+		}
+		return out
+	}
+
+	// Shorter documents rank higher for the same term
+	if got := ids(ii.SearchBM25([]string{"Go"}, 0)); !slices.Equal(got, []uint64{2, 1}) {
+		t.Errorf("SearchBM25(go) = %v, want [2 1]", got)
+	}
+	// Matching more query terms outranks matching one
+	matches := ii.SearchBM25([]string{"go", "database"}, 2)
+	if got := ids(matches); !slices.Equal(got, []uint64{1, 2}) {
+		t.Errorf("SearchBM25(go, database) = %v, want [1 2]", got)
+	}
+	if matches[0].Score <= matches[1].Score {
+		t.Errorf("Expected descending scores, got %+v", matches)
+	}
+	if score := ii.ScoreDocument(matches[0].VectorID, []string{"GO", "database"}); score != matches[0].Score {
+		t.Errorf("ScoreDocument = %v, want %v", score, matches[0].Score)
+	}
+	if score := ii.ScoreDocument(4, []string{"go"}); score != 0 {
+		t.Errorf("Expected zero score for a non-matching document, got %v", score)
+	}
+	if got := ii.SearchBM25([]string{"missing"}, 5); len(got) != 0 {
+		t.Errorf("Expected no matches for an unknown term, got %v", got)
+	}
+
+	ii.DeleteDoc(2)
+	ii.Delete([]string{"rust"}, 4)
+	if ii.docFreq["go"] != 1 || ii.docLengths[2] != 0 || ii.docFreq["rust"] != 0 {
+		t.Errorf("Stats not updated on delete: docFreq=%v docLengths=%v", ii.docFreq, ii.docLengths)
+	}
+	before := ii.SearchBM25([]string{"go", "database"}, 0)
+
+	if err := ii.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewInvertedIndex(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if after := loaded.SearchBM25([]string{"go", "database"}, 0); !slices.Equal(after, before) {
+		t.Errorf("Scores changed across Save/Load: %v vs %v", before, after)
+	}
+}
+
+func TestInvertedIndex_TermFrequency(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.inv")
+	ii := NewInvertedIndex(path)
+	ii.Add([]string{"go", "Go", "go", "tutorial"}, 1)
+	ii.Add([]string{"go", "tutorial"}, 2)
+	ii.Add([]string{"rust"}, 3)
+
+	if got := ii.termFreq[1]["go"]; got != 3 {
+		t.Errorf("Term frequency of go = %d, want 3", got)
+	}
+	if ii.docFreq["go"] != 2 || ii.docLengths[1] != 4 {
+		t.Errorf("docFreq=%v docLengths=%v, want go in 2 documents and 4 keywords in 1", ii.docFreq, ii.docLengths)
+	}
+	if got := ii.AvgDocLength(); got != 7.0/3 {
+		t.Errorf("AvgDocLength = %v, want %v", got, 7.0/3)
+	}
+	// Repeating a keyword outweighs the longer document
+	if got := ii.SearchBM25([]string{"go"}, 0); len(got) != 2 || got[0].VectorID != 1 {
+		t.Errorf("SearchBM25(go) = %v, want 1 first", got)
+	}
+
+	// Term frequency saturates faster with a lower K1
+	score := ii.ScoreDocument(1, []string{"go"})
+	ii.K1 = 0.5
+	if lower := ii.ScoreDocument(1, []string{"go"}); lower >= score {
+		t.Errorf("Score with K1 0.5 = %v, want below %v", lower, score)
+	}
+	ii.K1 = DefaultBM25K1
+
+	if err := ii.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewInvertedIndex(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !maps.EqualFunc(ii.termFreq, loaded.termFreq, maps.Equal) || !maps.Equal(ii.docLengths, loaded.docLengths) {
+		t.Errorf("Term frequencies changed across Save/Load: %v vs %v", ii.termFreq, loaded.termFreq)
+	}
+	if got := loaded.ScoreDocument(1, []string{"go"}); got != score {
+		t.Errorf("Score after reload = %v, want %v", got, score)
+	}
+
+	ii.Delete([]string{"go"}, 1)
+	if _, ok := ii.termFreq[1]; ok || ii.docLengths[1] != 1 || ii.totalLength != 4 {
+		t.Errorf("Delete left termFreq=%v docLengths=%v totalLength=%d", ii.termFreq, ii.docLengths, ii.totalLength)
+	}
+	ii.Add([]string{"go", "go"}, 4)
+	ii.Renumber(map[uint64]uint64{1: 1, 2: 2, 4: 10})
+	if ii.termFreq[10]["go"] != 2 || ii.docLengths[10] != 2 {
+		t.Errorf("Renumber left termFreq=%v docLengths=%v", ii.termFreq, ii.docLengths)
+	}
+	ii.PruneDocs(func(id uint64) bool { return id != 10 })
+	if len(ii.termFreq) != 0 {
+		t.Errorf("PruneDocs left termFreq=%v", ii.termFreq)
+	}
+}
+
+func TestInvertedIndex_SearchJaccard(t *testing.T) {
+	ii := NewInvertedIndex(filepath.Join(t.TempDir(), "keywords.inv"))
+	ii.Add([]string{"red", "green"}, 1)
+	ii.Add([]string{"red", "green", "blue", "black"}, 2)
+	ii.Add([]string{"red"}, 3)
+	ii.Add([]string{"white"}, 4)
+
+	// Query {red, green}: 1 scores 2/2, 2 scores 2/4, 3 scores 1/2
+	docs := ii.SearchJaccard([]string{"Red", "green", "red"}, 0)
+	want := []ScoredDoc{{VectorID: 1, Score: 1}, {VectorID: 2, Score: 0.5}, {VectorID: 3, Score: 0.5}}
+	if !slices.Equal(docs, want) {
+		t.Errorf("SearchJaccard(red, green) = %v, want %v", docs, want)
+	}
+	if docs := ii.SearchJaccard([]string{"red", "green"}, 0.75); !slices.Equal(docs, want[:1]) {
+		t.Errorf("SearchJaccard with threshold 0.75 = %v, want %v", docs, want[:1])
+	}
+	if docs := ii.SearchJaccard([]string{"purple"}, 0); len(docs) != 0 {
+		t.Errorf("Expected no matches for an unknown keyword, got %v", docs)
+	}
+
+	// Deleted keywords no longer count towards the union
+	ii.Delete([]string{"blue", "black"}, 2)
+	if docs := ii.SearchJaccard([]string{"red", "green"}, 1); len(docs) != 2 {
+		t.Errorf("Expected 1 and 2 to match exactly after the delete, got %v", docs)
+	}
+	if got := ii.Search([]string{"green"}, "jaccard", 0).ToSlice(); !slices.Equal(got, []uint64{1, 2}) {
+		t.Errorf("Search in jaccard mode = %v, want [1 2]", got)
+	}
+}
+
+func TestInvertedIndex_SearchAny(t *testing.T) {
+	ii := NewInvertedIndex(filepath.Join(t.TempDir(), "keywords.inv"))
+	ii.Add([]string{"go", "database", "vector"}, 1)
+	ii.Add([]string{"go", "web"}, 2)
+	ii.Add([]string{"database", "sql"}, 3)
+	ii.Add([]string{"rust"}, 4)
+
+	query := []string{"go", "Database", "vector"}
+	union := ii.Search(query, "any", 0).ToSlice()
+	if !slices.Equal(union, []uint64{1, 2, 3}) {
+		t.Errorf("Search(any) = %v, want [1 2 3]", union)
+	}
+	exact := ii.Search(query, "exact", 0).ToSlice()
+	if !slices.Equal(exact, []uint64{1}) {
+		t.Errorf("Search(exact) = %v, want [1]", exact)
+	}
+	for _, id := range exact {
+		if !slices.Contains(union, id) {
+			t.Errorf("Expected OR results %v to contain exact match %d", union, id)
+		}
+	}
+	if got := ii.SearchAny(nil); got != nil {
+		t.Errorf("Expected nil for no keywords, got %v", got.ToSlice())
+	}
+}
+
+func TestInvertedIndex_SearchLevenshtein(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.inv")
+	ii := NewInvertedIndex(path)
+	ii.Add([]string{"Finance", "report"}, 1)
+	ii.Add([]string{"finances"}, 2)
+	ii.Add([]string{"fiance", "reports"}, 3)
+
+	if got := ii.SearchLevenshtein([]string{"finance"}, 1).ToSlice(); !slices.Equal(got, []uint64{1, 2, 3}) {
+		t.Errorf("Expected [1 2 3] within one edit of finance, got %v", got)
+	}
+	if got := ii.SearchLevenshtein([]string{"finance", "report"}, 1).ToSlice(); !slices.Equal(got, []uint64{1, 3}) {
+		t.Errorf("Expected [1 3] matching both keywords, got %v", got)
+	}
+
+	// Keywords leave the vocabulary with their last document
+	ii.DeleteDoc(2)
+	if got := ii.FuzzyKeywords([]string{"FINANCE"}, 1); !slices.Equal(got, []string{"fiance", "finance"}) {
+		t.Errorf("Expected fuzzy keywords [fiance finance], got %v", got)
+	}
+
+	if err := ii.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	reloaded := NewInvertedIndex(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := reloaded.SearchLevenshtein([]string{"reprt"}, 1).ToSlice(); !slices.Equal(got, []uint64{1}) {
+		t.Errorf("Expected [1] after reload, got %v", got)
+	}
+}
+
+func TestInvertedIndex_UnicodeRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.inv")
+	ii := NewInvertedIndex(path)
+	ii.NGramSizes = []int{2, 3}
+	docs := map[uint64][]string{
+		1:       {"naïve", "Zürich", "café au lait"},
+		2:       {"日本語", "東京タワー", "naïve"},
+		3:       {"🐧 penguin", "Ωmega", "straße"},
+		100_000: {"Zürich", "ελληνικά"}, // Sparse IDs take the sorting path on load
+	}
+	for id, keywords := range docs {
+		ii.Add(keywords, id)
+	}
+	ii.Delete([]string{"café au lait"}, 1)
+
+	if err := ii.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	first, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(first, []byte(invMagic)) {
+		t.Fatalf("File starts with %q, want magic %q", first[:4], invMagic)
+	}
+
+	reloaded := NewInvertedIndex(path)
+	reloaded.NGramSizes = []int{2, 3}
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !maps.EqualFunc(ii.index, reloaded.index, slices.Equal) {
+		t.Error("Postings changed across Save/Load")
+	}
+	if !maps.Equal(ii.docFreq, reloaded.docFreq) || !maps.Equal(ii.docLengths, reloaded.docLengths) {
+		t.Error("BM25 statistics changed across Save/Load")
+	}
+	for _, q := range [][]string{{"naïve"}, {"zürich"}, {"日本語"}, {"🐧 penguin"}} {
+		if got, want := reloaded.SearchExact(q).ToSlice(), ii.SearchExact(q).ToSlice(); !slices.Equal(got, want) || len(want) == 0 {
+			t.Errorf("SearchExact(%v) = %v after reload, want %v", q, got, want)
+		}
+	}
+	if got := reloaded.SearchPartial([]string{"京タ"}).ToSlice(); !slices.Equal(got, []uint64{2}) {
+		t.Errorf("SearchPartial(京タ) = %v, want [2]", got)
+	}
+	if got := reloaded.SearchLevenshtein([]string{"strasse"}, 2).ToSlice(); !slices.Equal(got, []uint64{3}) {
+		t.Errorf("SearchLevenshtein(strasse) = %v, want [3]", got)
+	}
+
+	if !maps.EqualFunc(ii.docToKeys, reloaded.docToKeys, func(a, b []string) bool {
+		return slices.Equal(slices.Sorted(slices.Values(a)), slices.Sorted(slices.Values(b)))
+	}) {
+		t.Error("Reverse map changed across Save/Load")
+	}
+
+	// Deletes must still find every posting of a document
+	reloaded.DeleteDoc(2)
+	if reloaded.ContainsDoc(2) || !reloaded.SearchPartial([]string{"京タ"}).IsEmpty() {
+		t.Error("DeleteDoc after reload left postings behind")
+	}
+
+	// The format is deterministic
+	if err := ii.Save(); err != nil {
+		t.Fatal(err)
+	}
+	second, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("Saving the same index twice produced different files")
+	}
+}
+
+// saveLegacyGob writes ii in the GOB format used before the binary format.
+func saveLegacyGob(tb testing.TB, ii *InvertedIndex) {
+	tb.Helper()
+	var buf bytes.Buffer
+	buf.Write(ii.gramHeader(invMagicGob))
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(ii.index); err != nil {
+		tb.Fatal(err)
+	}
+	if err := enc.Encode(ii.docToKeys); err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.WriteFile(ii.filePath, buf.Bytes(), 0644); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestInvertedIndex_LoadsLegacyGob(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.inv")
+	ii := NewInvertedIndex(path)
+	ii.Add([]string{"finance", "日本語"}, 1)
+	ii.Add([]string{"finance"}, 2)
+	saveLegacyGob(t, ii)
+
+	for _, load := range []func(*InvertedIndex) error{(*InvertedIndex).Load, (*InvertedIndex).LoadLegacyGob} {
+		reloaded := NewInvertedIndex(path)
+		if err := load(reloaded); err != nil {
+			t.Fatalf("Loading a GOB index failed: %v", err)
+		}
+		if got := reloaded.SearchExact([]string{"finance"}).ToSlice(); !slices.Equal(got, []uint64{1, 2}) {
+			t.Errorf("SearchExact(finance) = %v, want [1 2]", got)
+		}
+	}
+
+	// Saving upgrades the file to the binary format
+	reloaded := NewInvertedIndex(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(invMagic)) {
+		t.Errorf("Saved file starts with %q, want %q", data[:4], invMagic)
+	}
+}
+
+// BenchmarkInvertedIndexLoad compares loading the binary and GOB formats. The
+// index has 50K keys and 5M postings, a tenth of a 500K key / 50M posting
+// index, which behaves the same per posting without needing gigabytes of memory.
+func BenchmarkInvertedIndexLoad(b *testing.B) {
+	const keys, postingsPerKey, docs = 50_000, 100, 500_000
+	dir := b.TempDir()
+	ii := NewInvertedIndex(filepath.Join(dir, "keywords.inv"))
+	for k := range keys {
+		// Every document appears under 10 keys
+		postings := make([]uint64, postingsPerKey)
+		for i := range postings {
+			postings[i] = uint64(k*postingsPerKey+i) % docs
+		}
+		ii.index[fmt.Sprintf("%03x", k)] = postings
+	}
+	ii.rebuildDocToKeys()
+
+	for _, format := range []string{"binary", "gob"} {
+		ii.filePath = filepath.Join(dir, format+".inv")
+		if format == "gob" {
+			saveLegacyGob(b, ii)
+		} else if err := ii.Save(); err != nil {
+			b.Fatal(err)
+		}
+		b.Run(format, func(b *testing.B) {
+			for range b.N {
+				loaded := NewInvertedIndex(ii.filePath)
+				if err := loaded.Load(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
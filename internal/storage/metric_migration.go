@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"waddlemap/internal/logger"
+	"waddlemap/internal/types"
+)
+
+// migratingSuffix is added to the name of an index file being rebuilt by
+// MigrateMetric: vectors_migrating.hnsw for vectors.hnsw. The file it
+// replaces is kept with oldFileSuffix until the migration is committed.
+const (
+	migratingSuffix = "_migrating"
+	oldFileSuffix   = ".old"
+)
+
+// MigrateMetric rebuilds the vector indexes of the collection with
+// newMetric and switches the collection to it. Writes wait for the whole
+// rebuild. The new indexes are built and saved next to the current ones,
+// which are only replaced once everything is written, so a failed migration
+// leaves the collection as it was. Only HNSW collections can be migrated.
+func (c *Collection) MigrateMetric(newMetric types.DistanceMetric) error {
+	if err := c.enter(); err != nil {
+		return err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start := time.Now()
+	oldMetric := c.Config.Metric
+	cfg, err := c.checkMetricMigration(newMetric)
+	if err != nil {
+		return err
+	}
+
+	// GetVectorByID would take mu again, so read the index directly
+	vectors := make(map[uint64][]float32, c.DocMap.Count())
+	c.DocMap.Range(func(vectorID uint64, _ DocLocation) bool {
+		if v, ok := c.Index.GetVector(vectorID); ok {
+			vectors[vectorID] = v
+		}
+		return true
+	})
+
+	_, primary, err := newPrimaryIndex(c.basePath, &cfg)
+	if err != nil {
+		return err
+	}
+	rebuilt := []*HNSWWrapper{primary}
+	if c.SecondaryHNSW != nil {
+		secondary, err := newSecondaryHNSW(c.basePath, &cfg)
+		if err != nil {
+			primary.Close()
+			return err
+		}
+		rebuilt = append(rebuilt, secondary)
+	}
+	swaps := make([]indexFileSwap, len(rebuilt))
+	for i, hnsw := range rebuilt {
+		swaps[i].path = hnsw.filePath
+		hnsw.filePath = migratingPath(hnsw.filePath)
+	}
+	abort := func(err error) error {
+		for i := len(swaps) - 1; i >= 0; i-- {
+			swaps[i].rollback()
+		}
+		for i, hnsw := range rebuilt {
+			hnsw.Close()
+			os.Remove(migratingPath(swaps[i].path))
+		}
+		return fmt.Errorf("failed to migrate collection %q to metric %s: %w", c.Config.Name, newMetric, err)
+	}
+
+	for _, hnsw := range rebuilt {
+		if err := hnsw.BulkAdd(vectors); err != nil {
+			return abort(err)
+		}
+		if err := hnsw.Save(); err != nil {
+			return abort(err)
+		}
+	}
+	for i, hnsw := range rebuilt {
+		if err := swaps[i].commit(hnsw); err != nil {
+			return abort(err)
+		}
+	}
+	meta, err := LoadCollectionMeta(c.basePath)
+	if err != nil {
+		return abort(err)
+	}
+	meta.Metric = newMetric
+	if err := SaveCollectionMeta(c.basePath, meta); err != nil {
+		return abort(err)
+	}
+
+	old := []*HNSWWrapper{c.HNSWIndex, c.SecondaryHNSW}
+	c.Config.Metric = newMetric
+	c.Index, c.HNSWIndex = primary, primary
+	if c.SecondaryHNSW != nil {
+		c.SecondaryHNSW = rebuilt[1]
+	}
+	for _, hnsw := range old {
+		if hnsw != nil {
+			hnsw.Close()
+		}
+	}
+	for _, swap := range swaps {
+		swap.removeOld()
+	}
+
+	logger.InfoAttrs("collection metric migrated", "collection", c.Config.Name, "from", oldMetric, "to", newMetric,
+		"vectors", len(vectors), "duration_ms", logger.Since(start))
+	return nil
+}
+
+// CheckMetricMigration reports whether MigrateMetric would accept newMetric,
+// without changing anything. It returns the number of vectors the migration
+// would re-insert.
+func (c *Collection) CheckMetricMigration(newMetric types.DistanceMetric) (int, error) {
+	if err := c.enter(); err != nil {
+		return 0, err
+	}
+	defer c.drainWg.Done()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if _, err := c.checkMetricMigration(newMetric); err != nil {
+		return 0, err
+	}
+	count := 0
+	c.DocMap.Range(func(vectorID uint64, _ DocLocation) bool {
+		if c.Index.Contains(vectorID) {
+			count++
+		}
+		return true
+	})
+	return count, nil
+}
+
+// checkMetricMigration validates a migration of the collection to newMetric
+// and returns the collection config with it. Caller must hold mu.
+func (c *Collection) checkMetricMigration(newMetric types.DistanceMetric) (types.CollectionConfig, error) {
+	cfg := c.Config
+	cfg.Metric = newMetric
+	invalid := func(format string, args ...any) error {
+		return &types.InvalidConfigError{Collection: cfg.Name, Err: fmt.Errorf(format, args...)}
+	}
+	if c.HNSWIndex == nil {
+		return cfg, invalid("metric migration requires index type hnsw")
+	}
+	if newMetric == c.Config.Metric {
+		return cfg, invalid("collection already uses the %s metric", newMetric)
+	}
+	if _, err := ValidateCollectionConfig(&cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// migratingPath returns the path an index file is rebuilt at.
+func migratingPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + migratingSuffix + ext
+}
+
+// indexFileSwap moves a rebuilt index file over the one at path. The files
+// it replaces, the index and its delta, are kept with oldFileSuffix until
+// removeOld, so that rollback can put them back.
+type indexFileSwap struct {
+	path      string
+	moved     []string // Files renamed to oldFileSuffix
+	committed bool
+}
+
+// commit renames the saved file of hnsw to path and points hnsw at it.
+func (s *indexFileSwap) commit(hnsw *HNSWWrapper) error {
+	for _, p := range []string{s.path, s.path + ".delta"} {
+		if err := os.Rename(p, p+oldFileSuffix); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		s.moved = append(s.moved, p)
+	}
+	if err := os.Rename(hnsw.filePath, s.path); err != nil {
+		return err
+	}
+	hnsw.mu.Lock()
+	hnsw.filePath = s.path
+	hnsw.mu.Unlock()
+	s.committed = true
+	return nil
+}
+
+// rollback restores the files moved by commit. The rebuilt file is moved
+// back to the migrating path, where the caller removes it.
+func (s *indexFileSwap) rollback() {
+	if s.committed {
+		os.Rename(s.path, migratingPath(s.path))
+	}
+	for _, p := range s.moved {
+		os.Rename(p+oldFileSuffix, p)
+	}
+	s.moved, s.committed = nil, false
+}
+
+// removeOld deletes the files replaced by commit.
+func (s *indexFileSwap) removeOld() {
+	for _, p := range s.moved {
+		if err := os.Remove(p + oldFileSuffix); err != nil {
+			logger.Error("Failed to remove replaced index file %s: %v", p+oldFileSuffix, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestVectorManager_MigrateMetric(t *testing.T) {
+	if testing.Short() {
+		t.Skip("re-indexes 10,000 vectors")
+	}
+	dataPath := t.TempDir()
+	cfg := &types.DBSchemaConfig{DataPath: dataPath, SyncMode: "normal"}
+	vm, err := NewVectorManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CreateCollectionWithConfig(types.CollectionConfig{
+		Name:                 "docs",
+		Dimensions:           8,
+		Metric:               types.MetricL2,
+		SecondaryHNSWOptions: &types.HNSWOptions{M: 8, EfConstruction: 50, EfSearch: 50},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	const n = 10000
+	rng := rand.New(rand.NewSource(1))
+	vectors := make([][]float32, n)
+	keys := make([]string, n)
+	blocks := make([]*types.BlockData, n)
+	for i := range n {
+		vectors[i] = randomVector(rng, 8)
+		keys[i] = fmt.Sprintf("doc-%d", i)
+		blocks[i] = &types.BlockData{Primary: keys[i], Vector: vectors[i]}
+	}
+	if _, err := vm.BatchAppendBlocks("docs", keys, blocks); err != nil {
+		t.Fatal(err)
+	}
+	coll, _ := vm.collections.GetCollection("docs")
+	if err := coll.Save(); err != nil {
+		t.Fatal(err)
+	}
+	collPath := coll.basePath
+	indexPath := filepath.Join(collPath, "vectors.hnsw")
+	before, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A scaled copy of a vector is its nearest neighbor only by cosine distance
+	hits := func(variant string) int {
+		t.Helper()
+		found := 0
+		for i := 0; i < n; i += n / 50 {
+			query := make([]float32, 8)
+			for j, x := range vectors[i] {
+				query[j] = 5 * x
+			}
+			results, err := vm.SearchVariant("docs", query, 1, "", nil, variant)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) == 1 && results[0].Key == keys[i] && results[0].Distance < 1e-4 {
+				found++
+			}
+		}
+		return found
+	}
+	if got := hits("primary"); got > 10 {
+		t.Fatalf("%d of 50 scaled queries found their vector by L2 distance", got)
+	}
+
+	for _, tc := range []struct {
+		collection string
+		metric     types.DistanceMetric
+		want       error
+	}{
+		{"missing", types.MetricCosine, types.ErrCollectionNotFound},
+		{"docs", types.MetricL2, types.ErrInvalidConfig},
+		{"docs", "bogus", types.ErrInvalidConfig},
+	} {
+		if _, err := vm.CheckMetricMigration(tc.collection, tc.metric); !errors.Is(err, tc.want) {
+			t.Errorf("CheckMetricMigration(%s, %s) = %v, want %v", tc.collection, tc.metric, err, tc.want)
+		}
+		if err := vm.MigrateMetric(tc.collection, tc.metric); !errors.Is(err, tc.want) {
+			t.Errorf("MigrateMetric(%s, %s) = %v, want %v", tc.collection, tc.metric, err, tc.want)
+		}
+	}
+	if err := vm.CreateCollectionWithConfig(types.CollectionConfig{
+		Name: "small", Dimensions: 8, Metric: types.MetricL2, IndexType: types.IndexTypeFlat,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.MigrateMetric("small", types.MetricCosine); !errors.Is(err, types.ErrInvalidConfig) {
+		t.Errorf("MigrateMetric of a flat collection = %v, want ErrInvalidConfig", err)
+	}
+
+	// A dry run changes nothing
+	count, err := vm.CheckMetricMigration("docs", types.MetricCosine)
+	if err != nil || count != n {
+		t.Fatalf("CheckMetricMigration = %d, %v, want %d", count, err, n)
+	}
+	if coll.Config.Metric != types.MetricL2 {
+		t.Fatalf("Metric after a dry run = %s", coll.Config.Metric)
+	}
+
+	// A failure after the index files were swapped puts the old ones back
+	metaPath := filepath.Join(collPath, "meta.json")
+	metaData, err := os.ReadFile(metaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(metaPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(metaPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.MigrateMetric("docs", types.MetricCosine); err == nil {
+		t.Fatal("MigrateMetric succeeded without meta.json")
+	}
+	if after, err := os.ReadFile(indexPath); err != nil || !bytes.Equal(after, before) {
+		t.Fatalf("Index file changed by a failed migration (%v)", err)
+	}
+	if coll.Config.Metric != types.MetricL2 || coll.HNSWIndex.Metric() != types.MetricL2 {
+		t.Fatalf("Metric after a failed migration = %s", coll.Config.Metric)
+	}
+	assertNoMigrationFiles(t, collPath)
+	if err := os.Remove(metaPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(metaPath, metaData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vm.MigrateMetric("docs", types.MetricCosine); err != nil {
+		t.Fatal(err)
+	}
+	check := func() {
+		t.Helper()
+		coll, _ := vm.collections.GetCollection("docs")
+		if coll.Config.Metric != types.MetricCosine || coll.SecondaryHNSW.Metric() != types.MetricCosine {
+			t.Fatalf("Metric after migration = %s", coll.Config.Metric)
+		}
+		if coll.DocMap.Count() != n || len(coll.HNSWIndex.VectorIDs()) != n || len(coll.SecondaryHNSW.VectorIDs()) != n {
+			t.Fatalf("Collection holds %d vectors after migration, want %d", len(coll.HNSWIndex.VectorIDs()), n)
+		}
+		for _, variant := range []string{"primary", "secondary"} {
+			if got := hits(variant); got < 45 {
+				t.Errorf("%d of 50 scaled queries found their vector by cosine distance on the %s index", got, variant)
+			}
+		}
+		block, err := vm.GetBlock("docs", "doc-42", 0)
+		if err != nil || block.Primary != "doc-42" {
+			t.Errorf("GetBlock after migration = %+v, %v", block, err)
+		}
+	}
+	check()
+	assertNoMigrationFiles(t, collPath)
+
+	// The migrated index and meta.json load back
+	vm.Close()
+	if vm, err = NewVectorManager(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	meta, err := LoadCollectionMeta(collPath)
+	if err != nil || meta.Metric != types.MetricCosine {
+		t.Fatalf("meta.json metric = %+v, %v", meta, err)
+	}
+	check()
+}
+
+// assertNoMigrationFiles fails the test if a MigrateMetric left temporary or
+// replaced index files in dir.
+func assertNoMigrationFiles(t *testing.T, dir string) {
+	t.Helper()
+	for _, pattern := range []string{"*" + migratingSuffix + "*", "*" + oldFileSuffix} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) > 0 {
+			t.Errorf("Migration files left behind: %v", matches)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build nommap || !(linux || darwin || windows)
+
+package storage
+
+import "os"
+
+// mmapSupported reports whether mapRegion maps files. Builds without it, or
+// with the nommap tag, keep mapped vectors on the heap.
+const mmapSupported = false
+
+// mapRegion allocates length bytes on the heap; f and offset are unused.
+func mapRegion(f *os.File, offset int64, length int) ([]byte, error) {
+	return make([]byte, length), nil
+}
+
+// unmapRegion releases a region returned by mapRegion.
+func unmapRegion(b []byte) error {
+	return nil
+}
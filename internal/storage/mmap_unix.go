@@ -0,0 +1,24 @@
+//go:build (linux || darwin) && !nommap
+
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapSupported reports whether mapRegion maps files. Builds without it, or
+// with the nommap tag, keep mapped vectors on the heap.
+const mmapSupported = true
+
+// mapRegion maps length bytes of f starting at offset for reading and
+// writing. Changes are written back to f. offset must be a multiple of the
+// page size.
+func mapRegion(f *os.File, offset int64, length int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), offset, length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+// unmapRegion releases a region returned by mapRegion.
+func unmapRegion(b []byte) error {
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,40 @@
+//go:build windows && !nommap
+
+package storage
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// mmapSupported reports whether mapRegion maps files. Builds without it, or
+// with the nommap tag, keep mapped vectors on the heap.
+const mmapSupported = true
+
+// mapRegion maps length bytes of f starting at offset for reading and
+// writing. Changes are written back to f. offset must be a multiple of the
+// allocation granularity (64KB).
+func mapRegion(f *os.File, offset int64, length int) ([]byte, error) {
+	end := offset + int64(length)
+	h, err := windows.CreateFileMapping(windows.Handle(f.Fd()), nil, windows.PAGE_READWRITE, uint32(end>>32), uint32(end), nil)
+	if err != nil {
+		return nil, os.NewSyscallError("CreateFileMapping", err)
+	}
+	// The view keeps the mapping object alive
+	defer windows.CloseHandle(h)
+
+	addr, err := windows.MapViewOfFile(h, windows.FILE_MAP_WRITE, uint32(offset>>32), uint32(offset), uintptr(length))
+	if err != nil {
+		return nil, os.NewSyscallError("MapViewOfFile", err)
+	}
+	// Converted through memory, since the view is not Go memory and vet
+	// flags a direct uintptr conversion
+	return unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&addr))), length), nil
+}
+
+// unmapRegion releases a region returned by mapRegion.
+func unmapRegion(b []byte) error {
+	return windows.UnmapViewOfFile(uintptr(unsafe.Pointer(&b[0])))
+}
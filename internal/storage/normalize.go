@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+
+	"waddlemap/internal/types"
+)
+
+// unitNormTolerance is how far the L2 norm of a cosine query may be from 1
+// before ValidateQuery warns about it.
+const unitNormTolerance = 1e-3
+
+// Warning describes a likely mistake in a request that does not make it fail.
+type Warning struct {
+	Code    string // Machine-readable kind, such as WarningNotNormalized
+	Message string
+}
+
+// Warning codes.
+const (
+	WarningNotNormalized    = "not_normalized"     // A cosine query is not unit length
+	WarningAutoNormalizeOff = "auto_normalize_off" // A cosine collection config lacks AutoNormalize
+)
+
+// ValidateQuery checks that query can be searched in the collection. It
+// returns an error if the dimensions do not match, and a warning if the
+// collection uses the cosine metric and query is not unit length, which
+// usually means the stored vectors were not normalized either. Collections
+// with AutoNormalize normalize queries themselves and never warn.
+func (c *Collection) ValidateQuery(query []float32) ([]Warning, error) {
+	if uint32(len(query)) != c.Config.Dimensions {
+		return nil, &types.DimensionMismatchError{Collection: c.Config.Name, Subject: "query", Expected: int(c.Config.Dimensions), Actual: len(query)}
+	}
+	if c.Config.Metric != types.MetricCosine || c.Config.AutoNormalize {
+		return nil, nil
+	}
+	if norm := l2Norm(query); math.Abs(norm-1) > unitNormTolerance {
+		return []Warning{{
+			Code:    WarningNotNormalized,
+			Message: fmt.Sprintf("query has L2 norm %.4g; cosine collections work best with unit-length vectors", norm),
+		}}, nil
+	}
+	return nil, nil
+}
+
+// indexVector returns the vector to store or search for v: a unit-length copy
+// when the collection has AutoNormalize, v itself otherwise.
+func (c *Collection) indexVector(v []float32) []float32 {
+	if !c.Config.AutoNormalize || len(v) == 0 {
+		return v
+	}
+	return normalizedCopy(v)
+}
+
+// NormalizeVector returns a copy of v scaled to unit L2 norm. A zero vector
+// is returned as a zero copy.
+func (vm *VectorManager) NormalizeVector(v []float32) []float32 {
+	return normalizedCopy(v)
+}
+
+// NormalizeVector returns a copy of v scaled to unit L2 norm. A zero vector
+// is returned as a zero copy.
+func NormalizeVector(v []float32) []float32 {
+	return normalizedCopy(v)
+}
+
+func normalizedCopy(v []float32) []float32 {
+	out := make([]float32, len(v))
+	copy(out, v)
+	normalizeVector(out)
+	return out
+}
+
+func l2Norm(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"math"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestCollection_ValidateQuery(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("cos", 2, types.MetricCosine); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CreateCollection("l2", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	cos, _ := vm.GetCollection("cos")
+	l2, _ := vm.GetCollection("l2")
+
+	if _, err := cos.ValidateQuery([]float32{1, 0, 0}); err == nil {
+		t.Error("Expected an error for a query of the wrong dimensions")
+	}
+	if _, err := vm.Search("cos", []float32{1}, 1, "", nil); err == nil {
+		t.Error("Expected Search to reject a query of the wrong dimensions")
+	}
+	if warnings, err := cos.ValidateQuery([]float32{3, 4}); err != nil || len(warnings) != 1 || warnings[0].Code != WarningNotNormalized {
+		t.Errorf("ValidateQuery(cosine, norm 5) = %v, %v", warnings, err)
+	}
+	if warnings, _ := cos.ValidateQuery([]float32{0.6, 0.8}); len(warnings) != 0 {
+		t.Errorf("Expected no warning for a unit query, got %v", warnings)
+	}
+	if warnings, _ := l2.ValidateQuery([]float32{3, 4}); len(warnings) != 0 {
+		t.Errorf("Expected no warning for an L2 collection, got %v", warnings)
+	}
+
+	v := []float32{3, 4}
+	if got := vm.NormalizeVector(v); got[0] != 0.6 || got[1] != 0.8 || v[0] != 3 {
+		t.Errorf("NormalizeVector(%v) = %v", v, got)
+	}
+	if got := NormalizeVector([]float32{0, 0}); got[0] != 0 || got[1] != 0 {
+		t.Errorf("NormalizeVector(zero) = %v", got)
+	}
+}
+
+func TestValidateCollectionConfig_CosineWarning(t *testing.T) {
+	cfg := types.CollectionConfig{Name: "c", Dimensions: 2, Metric: types.MetricCosine}
+	if warnings, err := ValidateCollectionConfig(&cfg); err != nil || len(warnings) != 1 || warnings[0].Code != WarningAutoNormalizeOff {
+		t.Errorf("ValidateCollectionConfig(cosine) = %v, %v", warnings, err)
+	}
+	cfg.AutoNormalize = true
+	if warnings, err := ValidateCollectionConfig(&cfg); err != nil || len(warnings) != 0 {
+		t.Errorf("ValidateCollectionConfig(cosine, auto normalize) = %v, %v", warnings, err)
+	}
+	cfg = types.CollectionConfig{Name: "c", Dimensions: 2, Metric: types.MetricL2, AutoNormalize: true}
+	if warnings, err := ValidateCollectionConfig(&cfg); err == nil || warnings != nil {
+		t.Errorf("ValidateCollectionConfig(l2, auto normalize) = %v, %v", warnings, err)
+	}
+}
+
+func TestHNSWWrapper_Normalized(t *testing.T) {
+	hw, err := NewHNSWWrapper(2, types.MetricCosine, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hw.Normalized = true
+	vectors := [][]float32{{3, 4}, {-5, 0}, {0, 2}}
+	for i, v := range vectors {
+		if err := hw.Add(uint64(i), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if vectors[0][0] != 0.6 || vectors[0][1] != 0.8 {
+		t.Errorf("Expected Add to normalize in place, got %v", vectors[0])
+	}
+
+	query := NormalizeVector([]float32{1, 1})
+	results, err := hw.Search(query, 3, nil)
+	if err != nil || len(results) != 3 {
+		t.Fatalf("Search = %v, %v", results, err)
+	}
+	for _, r := range results {
+		if want := distanceCosine(query, vectors[r.VectorID]); math.Abs(float64(r.Distance-want)) > 1e-6 {
+			t.Errorf("Distance to %d = %v, want %v", r.VectorID, r.Distance, want)
+		}
+	}
+	if results[0].VectorID != 0 || results[2].VectorID != 1 {
+		t.Errorf("Unexpected order %v", results)
+	}
+}
+
+func TestCollection_AutoNormalize(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollectionWithConfig(types.CollectionConfig{Name: "l2", Dimensions: 2, Metric: types.MetricL2, AutoNormalize: true}); err == nil {
+		t.Error("Expected AutoNormalize to require the cosine metric")
+	}
+	if err := vm.CreateCollectionWithConfig(types.CollectionConfig{Name: "auto", Dimensions: 2, Metric: types.MetricCosine, AutoNormalize: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	vec := []float32{3, 4}
+	if _, err := vm.AppendBlock("auto", "doc", &types.BlockData{Primary: "p", Vector: vec}); err != nil {
+		t.Fatal(err)
+	}
+	if vec[0] != 3 {
+		t.Errorf("AppendBlock modified the caller's vector: %v", vec)
+	}
+	stored, err := vm.GetVector("auto", "doc", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if norm := l2Norm(stored); math.Abs(norm-1) > 1e-6 {
+		t.Errorf("Stored vector %v has norm %v, want 1", stored, norm)
+	}
+
+	coll, _ := vm.GetCollection("auto")
+	if warnings, _ := coll.ValidateQuery([]float32{30, 40}); len(warnings) != 0 {
+		t.Errorf("Expected no warning with AutoNormalize, got %v", warnings)
+	}
+	results, err := vm.Search("auto", []float32{30, 40}, 1, "", nil)
+	if err != nil || len(results) != 1 || results[0].Distance > 1e-6 {
+		t.Errorf("Search = %v, %v", results, err)
+	}
+}
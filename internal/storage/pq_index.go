@@ -0,0 +1,672 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+
+	"waddlemap/internal/types"
+)
+
+// PQ binary format constants
+const (
+	pqMagic      = "PQIDXV01"
+	pqHeaderSize = 32
+)
+
+// Product quantizer parameters.
+const (
+	pqCentroids        = 256 // Centroids per sub-space, so each code fits in a byte
+	pqKMeansIterations = 20
+
+	// DefaultPQTrainSize is the number of vectors collected before the
+	// codebooks are trained.
+	DefaultPQTrainSize = 4096
+)
+
+// PQIndex stores vectors compressed with a product quantizer: each vector is
+// split into M sub-vectors and every sub-vector is replaced by the index of
+// its nearest centroid, so a vector takes M bytes instead of 4×dimensions.
+// Searches scan every code and use asymmetric distance tables (exact query
+// sub-vectors against the centroids).
+//
+// The codebooks are trained with k-means once TrainSize vectors have been
+// added; until then vectors are kept uncompressed and searched exactly.
+type PQIndex struct {
+	dimensions uint32
+	metric     types.DistanceMetric
+	filePath   string
+
+	M         int // Number of sub-spaces
+	TrainSize int // Vectors collected before training
+
+	subDims   int
+	codebooks [][]float32 // codebooks[m] holds k centroids of subDims each; nil until trained
+	k         int         // Centroids per sub-space (fewer than pqCentroids only for tiny training sets)
+
+	ids   []uint64
+	pos   map[uint64]int // ID -> position in ids
+	codes []byte         // len(ids)*M codes once trained
+	raw   [][]float32    // Vectors parallel to ids before training
+
+	dirty bool // Set on Add/Delete, cleared on Save
+	mu    sync.RWMutex
+}
+
+// NewPQIndex creates an empty PQ index with m sub-spaces. m must divide dims.
+func NewPQIndex(dims uint32, metric types.DistanceMetric, m int, filePath string) (*PQIndex, error) {
+	if m <= 0 || dims%uint32(m) != 0 {
+		return nil, fmt.Errorf("pq subspaces %d must divide dimensions %d", m, dims)
+	}
+	return &PQIndex{
+		dimensions: dims,
+		metric:     metric,
+		filePath:   filePath,
+		M:          m,
+		TrainSize:  DefaultPQTrainSize,
+		subDims:    int(dims) / m,
+		pos:        make(map[uint64]int),
+	}, nil
+}
+
+// defaultPQSubspaces picks a sub-space count for dims when none is configured:
+// the largest divisor of dims that leaves sub-vectors of at least 4 dimensions.
+func defaultPQSubspaces(dims uint32) int {
+	for m := dims / 4; m > 1; m-- {
+		if dims%m == 0 {
+			return int(m)
+		}
+	}
+	return 1
+}
+
+// Trained reports whether the codebooks have been trained.
+func (pq *PQIndex) Trained() bool {
+	pq.mu.RLock()
+	defer pq.mu.RUnlock()
+	return pq.codebooks != nil
+}
+
+// Add inserts a vector with the given ID. Adding the TrainSize-th vector
+// trains the codebooks and compresses everything stored so far.
+func (pq *PQIndex) Add(vectorID uint64, vector []float32) error {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	if err := pq.addUnlocked(vectorID, vector); err != nil {
+		return err
+	}
+	pq.maybeTrain()
+	return nil
+}
+
+// addUnlocked stores a vector without training. Caller must hold pq.mu.
+func (pq *PQIndex) addUnlocked(vectorID uint64, vector []float32) error {
+	if uint32(len(vector)) != pq.dimensions {
+		return &types.DimensionMismatchError{Subject: "vector", Expected: int(pq.dimensions), Actual: len(vector)}
+	}
+	if _, exists := pq.pos[vectorID]; exists {
+		return &types.DuplicateIDError{ID: vectorID}
+	}
+
+	pq.pos[vectorID] = len(pq.ids)
+	pq.ids = append(pq.ids, vectorID)
+	if pq.codebooks != nil {
+		pq.codes = append(pq.codes, pq.encode(vector)...)
+	} else {
+		pq.raw = append(pq.raw, append([]float32(nil), vector...))
+	}
+	pq.dirty = true
+	return nil
+}
+
+// BatchAdd inserts multiple vectors under a single lock, skipping invalid ones.
+func (pq *PQIndex) BatchAdd(items []struct {
+	ID     uint64
+	Vector []float32
+}) error {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	for _, item := range items {
+		if err := pq.addUnlocked(item.ID, item.Vector); err != nil {
+			continue
+		}
+	}
+	pq.maybeTrain()
+	return nil
+}
+
+// maybeTrain trains on the raw vectors once TrainSize have been collected.
+// Caller must hold pq.mu.
+func (pq *PQIndex) maybeTrain() {
+	if pq.codebooks == nil && len(pq.raw) >= pq.TrainSize {
+		pq.trainUnlocked(pq.raw)
+	}
+}
+
+// Train trains the codebooks on samples, which must hold at least one vector,
+// and compresses every stored vector. Retraining re-encodes existing codes
+// from their reconstructions, so it is best done before adding data.
+func (pq *PQIndex) Train(samples [][]float32) error {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	if len(samples) == 0 {
+		return errors.New("no training vectors provided")
+	}
+	for i, v := range samples {
+		if uint32(len(v)) != pq.dimensions {
+			return fmt.Errorf("training vector %d dimension mismatch: expected %d, got %d", i, pq.dimensions, len(v))
+		}
+	}
+	if pq.codebooks != nil {
+		pq.raw = make([][]float32, len(pq.ids))
+		for i := range pq.ids {
+			pq.raw[i] = pq.decode(pq.codes[i*pq.M : (i+1)*pq.M])
+		}
+	}
+	pq.trainUnlocked(samples)
+	return nil
+}
+
+// trainUnlocked runs k-means in every sub-space, then encodes and releases the
+// raw vectors. Caller must hold pq.mu.
+func (pq *PQIndex) trainUnlocked(samples [][]float32) {
+	rng := rand.New(rand.NewSource(int64(len(samples))))
+	pq.k = min(pqCentroids, len(samples))
+	pq.codebooks = make([][]float32, pq.M)
+	for m := range pq.M {
+		sub := make([][]float32, len(samples))
+		for i, v := range samples {
+			sub[i] = v[m*pq.subDims : (m+1)*pq.subDims]
+		}
+		pq.codebooks[m] = kMeans(sub, pq.k, pqKMeansIterations, rng)
+	}
+
+	pq.codes = make([]byte, 0, len(pq.ids)*pq.M)
+	for _, v := range pq.raw {
+		pq.codes = append(pq.codes, pq.encode(v)...)
+	}
+	pq.raw = nil
+	pq.dirty = true
+}
+
+// kMeans clusters points into k centroids and returns them packed into one
+// slice. Centroids start at k distinct random points; an empty cluster is
+// reseeded with a random point.
+func kMeans(points [][]float32, k, iterations int, rng *rand.Rand) []float32 {
+	dims := len(points[0])
+	centroids := make([]float32, k*dims)
+	for c, i := range rng.Perm(len(points))[:k] {
+		copy(centroids[c*dims:], points[i])
+	}
+
+	assign := make([]int, len(points))
+	sums := make([]float64, k*dims)
+	counts := make([]int, k)
+	for iter := 0; iter < iterations; iter++ {
+		changed := false
+		for i, p := range points {
+			best := nearestCentroid(centroids, dims, p)
+			if best != assign[i] || iter == 0 {
+				changed = true
+			}
+			assign[i] = best
+		}
+		if !changed {
+			break
+		}
+
+		clear(sums)
+		clear(counts)
+		for i, p := range points {
+			c := assign[i]
+			counts[c]++
+			for d, x := range p {
+				sums[c*dims+d] += float64(x)
+			}
+		}
+		for c := range k {
+			if counts[c] == 0 {
+				copy(centroids[c*dims:(c+1)*dims], points[rng.Intn(len(points))])
+				continue
+			}
+			for d := range dims {
+				centroids[c*dims+d] = float32(sums[c*dims+d] / float64(counts[c]))
+			}
+		}
+	}
+	return centroids
+}
+
+// nearestCentroid returns the index of the centroid closest to p in L2.
+func nearestCentroid(centroids []float32, dims int, p []float32) int {
+	best, bestDist := 0, float32(math.Inf(1))
+	for c := 0; c*dims < len(centroids); c++ {
+		if d := distanceL2(p, centroids[c*dims:(c+1)*dims]); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// encode returns the PQ code of v. Caller must hold pq.mu with trained codebooks.
+func (pq *PQIndex) encode(v []float32) []byte {
+	code := make([]byte, pq.M)
+	for m := range pq.M {
+		code[m] = byte(nearestCentroid(pq.codebooks[m], pq.subDims, v[m*pq.subDims:(m+1)*pq.subDims]))
+	}
+	return code
+}
+
+// decode reconstructs a vector from its PQ code. Caller must hold pq.mu.
+func (pq *PQIndex) decode(code []byte) []float32 {
+	v := make([]float32, 0, pq.dimensions)
+	for m, c := range code {
+		v = append(v, pq.codebooks[m][int(c)*pq.subDims:(int(c)+1)*pq.subDims]...)
+	}
+	return v
+}
+
+// distanceTables holds the per-query lookup tables for asymmetric distance
+// computation. For L2, l2[m][c] is the squared distance from the query's m-th
+// sub-vector to centroid c; for IP and cosine, dot[m][c] is their dot product
+// and normSq[m][c] the centroid's squared norm.
+type distanceTables struct {
+	l2, dot, normSq [][]float32
+	queryNorm       float32
+}
+
+// buildTables computes the distance tables for query. Caller must hold pq.mu.
+func (pq *PQIndex) buildTables(query []float32) *distanceTables {
+	t := &distanceTables{}
+	table := func() [][]float32 {
+		rows := make([][]float32, pq.M)
+		for m := range rows {
+			rows[m] = make([]float32, pq.k)
+		}
+		return rows
+	}
+	switch pq.metric {
+	case types.MetricIP, types.MetricCosine:
+		t.dot, t.normSq = table(), table()
+	default:
+		t.l2 = table()
+	}
+
+	for m := range pq.M {
+		q := query[m*pq.subDims : (m+1)*pq.subDims]
+		for c := range pq.k {
+			centroid := pq.codebooks[m][c*pq.subDims : (c+1)*pq.subDims]
+			if t.l2 != nil {
+				t.l2[m][c] = distanceL2(q, centroid)
+				continue
+			}
+			t.dot[m][c] = -distanceIP(q, centroid)
+			t.normSq[m][c] = -distanceIP(centroid, centroid)
+		}
+	}
+	t.queryNorm = float32(math.Sqrt(float64(-distanceIP(query, query))))
+	return t
+}
+
+// tableDistance returns the approximate distance to the vector encoded by code,
+// matching the scale of metricDistance.
+func (pq *PQIndex) tableDistance(t *distanceTables, code []byte) float32 {
+	if t.l2 != nil {
+		var sum float32
+		for m, c := range code {
+			sum += t.l2[m][c]
+		}
+		return sum
+	}
+
+	var dot, normSq float32
+	for m, c := range code {
+		dot += t.dot[m][c]
+		normSq += t.normSq[m][c]
+	}
+	if pq.metric == types.MetricIP {
+		return -dot
+	}
+	if t.queryNorm == 0 || normSq == 0 {
+		return 1.0
+	}
+	return 1.0 - dot/(t.queryNorm*float32(math.Sqrt(float64(normSq))))
+}
+
+// Search returns the k vectors nearest to query by approximate distance.
+func (pq *PQIndex) Search(query []float32, k int, filter *BitSet) ([]HNSWSearchResult, error) {
+	pq.mu.RLock()
+	defer pq.mu.RUnlock()
+	return pq.searchUnlocked(query, k, filter)
+}
+
+// searchUnlocked implements Search. Caller must hold pq.mu.
+func (pq *PQIndex) searchUnlocked(query []float32, k int, filter *BitSet) ([]HNSWSearchResult, error) {
+	results, err := pq.scanUnlocked(query, float32(math.Inf(1)), filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// scanUnlocked returns every vector within radius of query that passes
+// filter, sorted by ascending distance. Caller must hold pq.mu.
+func (pq *PQIndex) scanUnlocked(query []float32, radius float32, filter *BitSet) ([]HNSWSearchResult, error) {
+	if uint32(len(query)) != pq.dimensions {
+		return nil, &types.DimensionMismatchError{Subject: "query", Expected: int(pq.dimensions), Actual: len(query)}
+	}
+
+	var tables *distanceTables
+	if pq.codebooks != nil {
+		tables = pq.buildTables(query)
+	}
+
+	hasFilter := filter != nil && !filter.IsEmpty()
+	results := make([]HNSWSearchResult, 0, len(pq.ids))
+	for i, id := range pq.ids {
+		if hasFilter && !filter.Contains(id) {
+			continue
+		}
+		var dist float32
+		if tables != nil {
+			dist = pq.tableDistance(tables, pq.codes[i*pq.M:(i+1)*pq.M])
+		} else {
+			dist = metricDistance(pq.metric, query, pq.raw[i])
+		}
+		if dist <= radius {
+			results = append(results, HNSWSearchResult{VectorID: id, Distance: dist})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].VectorID < results[j].VectorID
+	})
+	return results, nil
+}
+
+// BatchSearch runs every query against one read snapshot of the index.
+// Results are returned in query order.
+func (pq *PQIndex) BatchSearch(queries [][]float32, k int, filter *BitSet) ([][]HNSWSearchResult, error) {
+	pq.mu.RLock()
+	defer pq.mu.RUnlock()
+
+	results := make([][]HNSWSearchResult, len(queries))
+	for i, q := range queries {
+		res, err := pq.searchUnlocked(q, k, filter)
+		if err != nil {
+			return nil, fmt.Errorf("query %d: %w", i, err)
+		}
+		results[i] = res
+	}
+	return results, nil
+}
+
+// RangeSearch returns every vector whose approximate distance to query is
+// within radius, sorted by ascending distance.
+func (pq *PQIndex) RangeSearch(query []float32, radius float32, filter *BitSet) ([]HNSWSearchResult, error) {
+	pq.mu.RLock()
+	defer pq.mu.RUnlock()
+	return pq.scanUnlocked(query, radius, filter)
+}
+
+// Delete removes a vector from the index.
+func (pq *PQIndex) Delete(vectorID uint64) error {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	i, ok := pq.pos[vectorID]
+	if !ok {
+		return fmt.Errorf("vector ID %d not found", vectorID)
+	}
+
+	// Move the last entry into the freed slot
+	last := len(pq.ids) - 1
+	pq.ids[i] = pq.ids[last]
+	pq.pos[pq.ids[i]] = i
+	pq.ids = pq.ids[:last]
+	if pq.codebooks != nil {
+		copy(pq.codes[i*pq.M:(i+1)*pq.M], pq.codes[last*pq.M:])
+		pq.codes = pq.codes[:last*pq.M]
+	} else {
+		pq.raw[i] = pq.raw[last]
+		pq.raw = pq.raw[:last]
+	}
+	delete(pq.pos, vectorID)
+	pq.dirty = true
+	return nil
+}
+
+// Renumber changes every vector ID to remap[ID], dropping vectors whose ID is
+// not in remap.
+func (pq *PQIndex) Renumber(remap map[uint64]uint64) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	kept := 0
+	for i, id := range pq.ids {
+		newID, ok := remap[id]
+		if !ok {
+			continue
+		}
+		pq.ids[kept] = newID
+		if pq.codebooks != nil {
+			copy(pq.codes[kept*pq.M:(kept+1)*pq.M], pq.codes[i*pq.M:(i+1)*pq.M])
+		} else {
+			pq.raw[kept] = pq.raw[i]
+		}
+		kept++
+	}
+	pq.ids = pq.ids[:kept]
+	if pq.codebooks != nil {
+		pq.codes = pq.codes[:kept*pq.M]
+	} else {
+		clear(pq.raw[kept:])
+		pq.raw = pq.raw[:kept]
+	}
+	pq.pos = make(map[uint64]int, kept)
+	for i, id := range pq.ids {
+		pq.pos[id] = i
+	}
+	pq.dirty = true
+}
+
+// Save persists the index to disk. After the header come the codebooks
+// (M × k × subDims float32) and one [VectorID(8)][code(M)] record per vector;
+// an untrained index stores [VectorID(8)][float32 × dimensions] records instead.
+func (pq *PQIndex) Save() error {
+	pq.mu.Lock() // Save clears the dirty flag
+	defer pq.mu.Unlock()
+
+	file, err := os.Create(pq.filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	header := make([]byte, pqHeaderSize)
+	copy(header[0:8], pqMagic)
+	binary.LittleEndian.PutUint32(header[8:12], pq.dimensions)
+	header[12] = metricToByte(pq.metric)
+	if pq.codebooks != nil {
+		header[13] = 1
+	}
+	binary.LittleEndian.PutUint16(header[14:16], uint16(pq.M))
+	binary.LittleEndian.PutUint16(header[16:18], uint16(pq.k))
+	binary.LittleEndian.PutUint64(header[24:32], uint64(len(pq.ids)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	if pq.codebooks != nil {
+		for _, book := range pq.codebooks {
+			if err := binary.Write(w, binary.LittleEndian, book); err != nil {
+				return err
+			}
+		}
+	}
+
+	idBuf := make([]byte, 8)
+	for i, id := range pq.ids {
+		binary.LittleEndian.PutUint64(idBuf, id)
+		if _, err := w.Write(idBuf); err != nil {
+			return err
+		}
+		if pq.codebooks != nil {
+			_, err = w.Write(pq.codes[i*pq.M : (i+1)*pq.M])
+		} else {
+			err = binary.Write(w, binary.LittleEndian, pq.raw[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	pq.dirty = false
+	return nil
+}
+
+// Load reads the index from disk. A missing file leaves the index empty.
+func (pq *PQIndex) Load() error {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	file, err := os.Open(pq.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header := make([]byte, pqHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if string(header[0:8]) != pqMagic {
+		return &types.IndexCorruptedError{Path: pq.filePath, Err: errors.New("wrong magic number")}
+	}
+	if dims := binary.LittleEndian.Uint32(header[8:12]); dims != pq.dimensions {
+		return &types.DimensionMismatchError{Subject: "PQ index", Expected: int(pq.dimensions), Actual: int(dims)}
+	}
+	if metric := byteToMetric(header[12]); metric != pq.metric {
+		return &types.MetricMismatchError{Subject: "PQ index", Expected: pq.metric, Actual: metric}
+	}
+	if m := int(binary.LittleEndian.Uint16(header[14:16])); m != pq.M {
+		return fmt.Errorf("PQ index subspace mismatch: expected %d, got %d", pq.M, m)
+	}
+	trained := header[13] == 1
+	k := int(binary.LittleEndian.Uint16(header[16:18]))
+	count := binary.LittleEndian.Uint64(header[24:32])
+
+	var codebooks [][]float32
+	if trained {
+		codebooks = make([][]float32, pq.M)
+		for m := range codebooks {
+			codebooks[m] = make([]float32, k*pq.subDims)
+			if err := binary.Read(r, binary.LittleEndian, codebooks[m]); err != nil {
+				return fmt.Errorf("failed to read codebook %d: %w", m, err)
+			}
+		}
+	}
+
+	ids := make([]uint64, 0, count)
+	pos := make(map[uint64]int, count)
+	var codes []byte
+	var raw [][]float32
+	idBuf := make([]byte, 8)
+	for n := uint64(0); n < count; n++ {
+		if _, err := io.ReadFull(r, idBuf); err != nil {
+			return fmt.Errorf("failed to read vector %d: %w", n, err)
+		}
+		id := binary.LittleEndian.Uint64(idBuf)
+		pos[id] = len(ids)
+		ids = append(ids, id)
+		if trained {
+			code := make([]byte, pq.M)
+			if _, err := io.ReadFull(r, code); err != nil {
+				return fmt.Errorf("failed to read code %d: %w", n, err)
+			}
+			codes = append(codes, code...)
+			continue
+		}
+		vec := make([]float32, pq.dimensions)
+		if err := binary.Read(r, binary.LittleEndian, vec); err != nil {
+			return fmt.Errorf("failed to read vector %d: %w", n, err)
+		}
+		raw = append(raw, vec)
+	}
+
+	pq.codebooks, pq.k = codebooks, k
+	pq.ids, pq.pos, pq.codes, pq.raw = ids, pos, codes, raw
+	pq.dirty = false
+	return nil
+}
+
+// Close releases all resources held by the index.
+func (pq *PQIndex) Close() error {
+	return nil
+}
+
+// Count returns the number of vectors in the index.
+func (pq *PQIndex) Count() uint64 {
+	pq.mu.RLock()
+	defer pq.mu.RUnlock()
+	return uint64(len(pq.ids))
+}
+
+// Contains checks if a vector ID exists in the index.
+func (pq *PQIndex) Contains(vectorID uint64) bool {
+	pq.mu.RLock()
+	defer pq.mu.RUnlock()
+	_, ok := pq.pos[vectorID]
+	return ok
+}
+
+// GetVector returns the stored vector for vectorID. Once the index is trained
+// this is the reconstruction from the PQ code, not the original vector.
+func (pq *PQIndex) GetVector(vectorID uint64) ([]float32, bool) {
+	pq.mu.RLock()
+	defer pq.mu.RUnlock()
+	i, ok := pq.pos[vectorID]
+	if !ok {
+		return nil, false
+	}
+	if pq.codebooks == nil {
+		return pq.raw[i], true
+	}
+	return pq.decode(pq.codes[i*pq.M : (i+1)*pq.M]), true
+}
+
+// VectorIDs returns the IDs of all vectors in the index, in no particular order.
+func (pq *PQIndex) VectorIDs() []uint64 {
+	pq.mu.RLock()
+	defer pq.mu.RUnlock()
+	return append([]uint64(nil), pq.ids...)
+}
+
+// IsDirty returns true if the index has unsaved changes.
+func (pq *PQIndex) IsDirty() bool {
+	pq.mu.RLock()
+	defer pq.mu.RUnlock()
+	return pq.dirty
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+// pqTestData returns n random vectors of dims dimensions.
+func pqTestData(n, dims int, seed int64) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	vecs := make([][]float32, n)
+	for i := range vecs {
+		vecs[i] = make([]float32, dims)
+		for j := range vecs[i] {
+			vecs[i][j] = rng.Float32()
+		}
+	}
+	return vecs
+}
+
+// pqRecall returns the mean recall@k of pq against exact search over the
+// same vectors.
+func pqRecall(tb testing.TB, pq *PQIndex, exact *FlatIndex, queries [][]float32, k int) float64 {
+	tb.Helper()
+	var hits int
+	for _, q := range queries {
+		truth, err := exact.Search(q, k, nil)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		results, err := pq.Search(q, k, nil)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		want := make(map[uint64]bool, len(truth))
+		for _, r := range truth {
+			want[r.VectorID] = true
+		}
+		for _, r := range results {
+			if want[r.VectorID] {
+				hits++
+			}
+		}
+	}
+	return float64(hits) / float64(len(queries)*k)
+}
+
+func TestPQIndex_RecallAndPersistence(t *testing.T) {
+	const dims = 16
+	path := filepath.Join(t.TempDir(), "vectors.pq")
+	pq, err := NewPQIndex(dims, types.MetricL2, 8, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pq.TrainSize = 500
+	exact := NewFlatIndex(dims, types.MetricL2, filepath.Join(t.TempDir(), "vectors.flat"))
+
+	data := pqTestData(1000, dims, 5)
+	for i, vec := range data {
+		id := uint64(i + 1)
+		if err := pq.Add(id, vec); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		exact.Add(id, vec)
+		if i == 10 {
+			// Before training, searches are exact
+			if pq.Trained() {
+				t.Fatal("Expected index to be untrained below TrainSize")
+			}
+			if recall := pqRecall(t, pq, exact, data[:5], 5); recall != 1 {
+				t.Errorf("Expected exact recall before training, got %.2f", recall)
+			}
+		}
+	}
+	if !pq.Trained() {
+		t.Fatal("Expected index to be trained after TrainSize vectors")
+	}
+	if len(pq.codes) != 1000*8 || pq.raw != nil {
+		t.Fatalf("Expected 8 bytes per vector and no raw vectors, got %d bytes", len(pq.codes))
+	}
+
+	queries := pqTestData(50, dims, 6)
+	recall := pqRecall(t, pq, exact, queries, 10)
+	if recall < 0.5 {
+		t.Errorf("Expected recall@10 >= 0.5, got %.2f", recall)
+	}
+
+	// Delete, then Save and Load round-trip
+	if err := pq.Delete(7); err != nil {
+		t.Fatal(err)
+	}
+	if err := pq.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, _ := NewPQIndex(dims, types.MetricL2, 8, path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Count() != 999 || loaded.Contains(7) || !loaded.Trained() {
+		t.Fatalf("Loaded index has %d vectors (contains 7: %v)", loaded.Count(), loaded.Contains(7))
+	}
+	want, _ := pq.Search(queries[0], 10, nil)
+	got, _ := loaded.Search(queries[0], 10, nil)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Loaded index results differ:\n got %+v\nwant %+v", got, want)
+	}
+
+	if _, err := NewPQIndex(dims, types.MetricL2, 5, path); err == nil {
+		t.Error("Expected subspaces that do not divide dimensions to be rejected")
+	}
+	wrongM, _ := NewPQIndex(dims, types.MetricL2, 4, path)
+	if err := wrongM.Load(); err == nil {
+		t.Error("Expected Load with mismatched subspaces to fail")
+	}
+}
+
+func TestCollection_PQCompression(t *testing.T) {
+	dataPath := t.TempDir()
+	cm, err := NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := types.CollectionConfig{Name: "pq", Dimensions: 8, Metric: types.MetricCosine, IndexCompression: types.CompressionPQ}
+	if err := cm.CreateCollectionWithConfig(cfg); err != nil {
+		t.Fatalf("CreateCollectionWithConfig failed: %v", err)
+	}
+	coll, _ := cm.GetCollection("pq")
+	if coll.Config.IndexType != types.IndexTypeFlat || coll.Config.PQSubspaces != 2 || coll.HNSWIndex != nil {
+		t.Fatalf("Expected flat PQ index with 2 subspaces, got %+v", coll.Config)
+	}
+	for i, vec := range pqTestData(20, 8, 7) {
+		key := fmt.Sprintf("doc%d", i)
+		if _, err := coll.AppendBlock(key, &types.BlockData{Primary: key, Vector: vec}); err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+	}
+	if err := coll.Index.(*PQIndex).Train(pqTestData(300, 8, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if results, err := coll.Search(pqTestData(1, 8, 9)[0], 5, nil); err != nil || len(results) != 5 {
+		t.Fatalf("Search returned %d results, err %v", len(results), err)
+	}
+
+	// Compression settings are persisted
+	if err := cm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cm, err = NewCollectionManager(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	coll, _ = cm.GetCollection("pq")
+	pq, ok := coll.Index.(*PQIndex)
+	if !ok || !pq.Trained() || coll.Count() != 20 {
+		t.Fatalf("Expected trained PQ index with 20 vectors after reload, got %T", coll.Index)
+	}
+
+	for _, bad := range []types.CollectionConfig{
+		{Name: "bad1", Dimensions: 8, IndexCompression: "zstd"},
+		{Name: "bad2", Dimensions: 8, IndexCompression: types.CompressionPQ, IndexType: types.IndexTypeHNSW},
+		{Name: "bad3", Dimensions: 8, IndexCompression: types.CompressionPQ, PQSubspaces: 3},
+		{Name: "bad4", Dimensions: 8, PQSubspaces: 2},
+	} {
+		bad.Metric = types.MetricL2
+		if err := cm.CreateCollectionWithConfig(bad); err == nil {
+			t.Errorf("Expected %s to be rejected", bad.Name)
+		}
+	}
+}
+
+// BenchmarkPQIndex_Recall reports recall@10 against exact search and the
+// bytes stored per vector for several sub-space counts.
+func BenchmarkPQIndex_Recall(b *testing.B) {
+	const dims = 64
+	data := pqTestData(5000, dims, 1)
+	queries := pqTestData(100, dims, 2)
+	exact := NewFlatIndex(dims, types.MetricL2, filepath.Join(b.TempDir(), "vectors.flat"))
+	for i, vec := range data {
+		exact.Add(uint64(i+1), vec)
+	}
+
+	for _, m := range []int{4, 8, 16, 32} {
+		b.Run(fmt.Sprintf("M=%d", m), func(b *testing.B) {
+			pq, err := NewPQIndex(dims, types.MetricL2, m, filepath.Join(b.TempDir(), "vectors.pq"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			for i, vec := range data {
+				pq.Add(uint64(i+1), vec)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				pq.Search(queries[i%len(queries)], 10, nil)
+			}
+			b.StopTimer()
+			b.ReportMetric(pqRecall(b, pq, exact, queries, 10), "recall@10")
+			b.ReportMetric(float64(m), "bytes/vector")
+		})
+	}
+}
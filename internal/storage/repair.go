@@ -3,16 +3,20 @@ package storage
 import (
 	"fmt"
 	"log"
+	"time"
+
+	"waddlemap/internal/types"
 )
 
 // RepairManager handles consistency checks and repairs for collections.
 type RepairManager struct {
-	cm *CollectionManager
+	cm    *CollectionManager
+	store *Manager // Bucket storage, to tell vectorless blocks from lost vectors
 }
 
 // NewRepairManager creates a new repair manager.
-func NewRepairManager(cm *CollectionManager) *RepairManager {
-	return &RepairManager{cm: cm}
+func NewRepairManager(cm *CollectionManager, store *Manager) *RepairManager {
+	return &RepairManager{cm: cm, store: store}
 }
 
 // RepairReport contains the results of a consistency check.
@@ -24,6 +28,10 @@ type RepairReport struct {
 	OrphanIDs      []uint64
 	MissingIDs     []uint64
 	Repaired       bool
+
+	// Set by FullRepair only
+	KeysRebuilt    int // Keys whose in-memory block list disagreed with DocMap
+	KeywordOrphans int // Keyword index documents not in DocMap
 }
 
 // CheckConsistency verifies that HNSW index and DocMap are in sync.
@@ -41,28 +49,21 @@ func (rm *RepairManager) CheckConsistency(collectionName string) (*RepairReport,
 	}
 
 	// Get all vector IDs from DocMap
-	// Accessing unexported field 'mapping' via package-level access
-	coll.DocMap.mu.RLock()
 	docMapIDs := make(map[uint64]bool)
-	for vectorID := range coll.DocMap.mapping {
+	coll.DocMap.Range(func(vectorID uint64, _ DocLocation) bool {
 		docMapIDs[vectorID] = true
 		report.TotalVectors++
-	}
-	coll.DocMap.mu.RUnlock()
+		return true
+	})
 
-	// Check HNSW for orphans (vectors not in DocMap)
-
-	// Scanning strategy: Check defined range or iterate HNSW nodes?
-	// HNSWWrapper exposes 'nodes' (unexported) to package.
-	coll.HNSWIndex.mu.RLock()
-	for id := range coll.HNSWIndex.nodes {
+	// Check the vector index for orphans (vectors not in DocMap)
+	for _, id := range coll.Index.VectorIDs() {
 		if !docMapIDs[id] {
 			report.OrphanIDs = append(report.OrphanIDs, id)
 			report.OrphanVectors++
 		}
 		delete(docMapIDs, id) // Mark as found
 	}
-	coll.HNSWIndex.mu.RUnlock()
 
 	// Remaining IDs in docMapIDs are missing from HNSW
 	for id := range docMapIDs {
@@ -93,12 +94,12 @@ func (rm *RepairManager) RepairOrphans(collectionName string) error {
 	defer coll.mu.Unlock()
 
 	for _, orphanID := range report.OrphanIDs {
-		if err := coll.HNSWIndex.Delete(orphanID); err != nil {
+		if err := coll.Index.Delete(orphanID); err != nil {
 			log.Printf("Warning: failed to delete orphan vector %d: %v", orphanID, err)
 		}
 	}
 
-	return coll.HNSWIndex.Save()
+	return coll.Index.Save()
 }
 
 // VerifyIntegrity performs a full integrity check on a collection.
@@ -115,3 +116,128 @@ func (rm *RepairManager) VerifyIntegrity(collectionName string) error {
 
 	return nil
 }
+
+// FullRepair brings the indexes of a collection back in line with its forward
+// index (DocMap) after a crash left some of them partially written. The
+// indexes were loaded when the collection was opened. FullRepair then
+//
+//  1. removes vector index nodes that have no DocMap entry,
+//  2. removes DocMap entries whose block was stored with a vector that is
+//     missing from the vector index,
+//  3. rebuilds KeyIndex and KeyLengths from DocMap, and
+//  4. removes keyword index documents that have no DocMap entry.
+//
+// Expired blocks and blocks stored without a vector legitimately have no
+// vector index node and are kept. Repaired indexes are saved before
+// returning; OrphanVectors and MissingVectors count what was removed.
+func (rm *RepairManager) FullRepair(collectionName string) (*RepairReport, error) {
+	coll, err := rm.cm.GetCollection(collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := rm.repairIndexes(collectionName, coll)
+	if err != nil {
+		return nil, err
+	}
+	if report.OrphanVectors+report.MissingVectors+report.KeysRebuilt+report.KeywordOrphans == 0 {
+		return report, nil
+	}
+	if err := coll.Save(); err != nil {
+		return report, fmt.Errorf("failed to save repaired indexes: %w", err)
+	}
+	report.Repaired = true
+	return report, nil
+}
+
+// repairIndexes performs the FullRepair steps under the collection lock.
+func (rm *RepairManager) repairIndexes(collectionName string, coll *Collection) (*RepairReport, error) {
+	if err := coll.enter(); err != nil {
+		return nil, err
+	}
+	defer coll.drainWg.Done()
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	report := &RepairReport{Collection: collectionName}
+	docs := make(map[uint64]DocLocation)
+	coll.DocMap.Range(func(vectorID uint64, loc DocLocation) bool {
+		docs[vectorID] = loc
+		return true
+	})
+	report.TotalVectors = len(docs)
+
+	// 1. Vector index nodes without a DocMap entry
+	indexes := []VectorIndex{coll.Index}
+	if coll.SecondaryHNSW != nil {
+		indexes = append(indexes, coll.SecondaryHNSW)
+	}
+	orphans := make(map[uint64]bool)
+	for _, index := range indexes {
+		for _, id := range index.VectorIDs() {
+			if _, ok := docs[id]; ok {
+				continue
+			}
+			if err := index.Delete(id); err != nil {
+				return nil, fmt.Errorf("failed to delete orphan vector %d: %w", id, err)
+			}
+			if !orphans[id] {
+				orphans[id] = true
+				report.OrphanIDs = append(report.OrphanIDs, id)
+			}
+		}
+	}
+	report.OrphanVectors = len(report.OrphanIDs)
+
+	// 2. DocMap entries whose vector was lost
+	now := time.Now().Unix()
+	for id, loc := range docs {
+		if coll.Index.Contains(id) || loc.Expired(now) || !rm.lostVector(collectionName, loc) {
+			continue
+		}
+		coll.DocMap.Delete(id)
+		delete(docs, id)
+		report.MissingIDs = append(report.MissingIDs, id)
+	}
+	report.MissingVectors = len(report.MissingIDs)
+
+	// 3. In-memory key indexes
+	oldLengths := coll.KeyLengths
+	oldIndex := coll.KeyIndex
+	coll.KeyLengths = make(map[string]uint32)
+	coll.KeyIndex = make(map[string][]uint64)
+	coll.rebuildMemoryIndexes()
+	for key, length := range coll.KeyLengths {
+		if oldLengths[key] != length || len(oldIndex[key]) != len(coll.KeyIndex[key]) {
+			report.KeysRebuilt++
+		}
+	}
+	for key := range oldLengths {
+		if _, ok := coll.KeyLengths[key]; !ok {
+			report.KeysRebuilt++
+		}
+	}
+
+	// 4. Keyword index documents without a DocMap entry
+	report.KeywordOrphans = coll.KeywordIndex.PruneDocs(func(vectorID uint64) bool {
+		_, ok := docs[vectorID]
+		return ok
+	})
+
+	return report, nil
+}
+
+// lostVector reports whether the block at loc was stored with a vector, or
+// is missing from bucket storage altogether. Without bucket storage it
+// cannot tell and reports false.
+func (rm *RepairManager) lostVector(collectionName string, loc DocLocation) bool {
+	if rm.store == nil {
+		return false
+	}
+	entry, err := rm.store.GetEntry(collectionStorageKey(collectionName, loc.Key), int(loc.Index))
+	if err != nil {
+		return true
+	}
+	return entry.Flags.DataType == types.DataTypeVector
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestRepairManager_FullRepair(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("col", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	blocks := map[string]*types.BlockData{
+		"a": {Primary: "a", Vector: []float32{1, 0}},
+		"b": {Primary: "b", Keywords: []string{"plain"}}, // No vector
+		"c": {Primary: "c", Vector: []float32{0, 1}, Keywords: []string{"lost"}},
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := vm.AppendBlock("col", key, blocks[key]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	coll, _ := vm.GetCollection("col")
+	lostID, _ := coll.GetBlockVectorID("c", 0)
+
+	// Simulate a crash that left the indexes out of sync
+	coll.Index.Add(999, []float32{5, 5})
+	coll.Index.Delete(lostID)
+	coll.KeywordIndex.Add([]string{"ghost"}, 777)
+	coll.KeyLengths["ghost"] = 3
+
+	report, err := vm.repair.FullRepair("col")
+	if err != nil {
+		t.Fatalf("FullRepair failed: %v", err)
+	}
+	if report.OrphanVectors != 1 || report.MissingVectors != 1 || report.KeysRebuilt != 2 ||
+		report.KeywordOrphans != 2 || !report.Repaired {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if coll.Index.Contains(999) {
+		t.Error("Expected orphan vector 999 to be removed")
+	}
+	if _, ok := coll.DocMap.Get(lostID); ok {
+		t.Error("Expected the DocMap entry of the lost vector to be removed")
+	}
+	if ok, _ := vm.ContainsKey("col", "c"); ok {
+		t.Error("Expected key c to be dropped with its only block")
+	}
+	if ok, _ := vm.ContainsKey("col", "ghost"); ok {
+		t.Error("Expected stale key ghost to be dropped")
+	}
+	if block, err := vm.GetBlock("col", "b", 0); err != nil || block.Primary != "b" {
+		t.Errorf("Expected vectorless block b to survive, got %+v (err %v)", block, err)
+	}
+	for _, kw := range []string{"ghost", "lost"} {
+		if keys, _ := vm.KeywordSearch("col", []string{kw}, "exact", 0); len(keys) != 0 {
+			t.Errorf("Expected no keys for keyword %q, got %v", kw, keys)
+		}
+	}
+
+	report, err = vm.repair.FullRepair("col")
+	if err != nil {
+		t.Fatalf("Second FullRepair failed: %v", err)
+	}
+	if report.OrphanVectors+report.MissingVectors+report.KeysRebuilt+report.KeywordOrphans != 0 || report.Repaired {
+		t.Errorf("Expected a consistent collection after repair, got %+v", report)
+	}
+}
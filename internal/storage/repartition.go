@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"waddlemap/internal/types"
+)
+
+// RepartitionStats summarizes a Repartition run.
+type RepartitionStats struct {
+	Keys           int
+	Records        int
+	FromPartitions uint32
+	ToPartitions   uint32
+}
+
+// Repartition copies the database in srcPath to dstPath with its records
+// spread over partitionCount buckets. dstPath must not exist or be empty.
+// The current records of every key are copied in their stored order, so
+// replaced records and keys deleted from storage are left behind, as with
+// bucket compaction. Collection indexes and the WAL are copied as they are.
+// Snapshots are not copied, since their bucket files have the old layout.
+// No server may be running against either directory.
+func Repartition(srcPath, dstPath string, partitionCount int) (*RepartitionStats, error) {
+	if err := ValidatePartitionCount(partitionCount); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(srcPath, "data")); err != nil {
+		return nil, fmt.Errorf("no database in %s: %w", srcPath, err)
+	}
+	if entries, err := os.ReadDir(dstPath); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("destination %s is not empty", dstPath)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	src, err := NewManager(&types.DBSchemaConfig{DataPath: srcPath, SyncMode: "normal"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", srcPath, err)
+	}
+	defer src.Close()
+	dst, err := NewManager(&types.DBSchemaConfig{DataPath: dstPath, SyncMode: "normal", PartitionCount: partitionCount})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dstPath, err)
+	}
+
+	stats := &RepartitionStats{FromPartitions: src.PartitionCount, ToPartitions: dst.PartitionCount}
+	keys := src.GetKeys()
+	slices.Sort(keys)
+	for _, key := range keys {
+		values, err := src.GetAllValues(key)
+		if err != nil {
+			dst.Close()
+			return stats, fmt.Errorf("failed to read key %q: %w", key, err)
+		}
+		for _, value := range values {
+			if err := dst.Append(key, value); err != nil {
+				dst.Close()
+				return stats, fmt.Errorf("failed to write key %q: %w", key, err)
+			}
+		}
+		stats.Keys++
+		stats.Records += len(values)
+	}
+
+	var errs []error
+	for _, b := range dst.Buckets {
+		errs = append(errs, b.File.Sync())
+	}
+	errs = append(errs, dst.Close())
+	if err := errors.Join(errs...); err != nil {
+		return stats, err
+	}
+	return stats, copyDatabaseFiles(srcPath, dstPath)
+}
+
+// copyDatabaseFiles copies everything in srcPath but the bucket files and
+// snapshots to dstPath.
+func copyDatabaseFiles(srcPath, dstPath string) error {
+	entries, err := os.ReadDir(srcPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		src, dst := filepath.Join(srcPath, name), filepath.Join(dstPath, name)
+		switch {
+		case name == "data" || name == "snapshots":
+			continue
+		case entry.IsDir():
+			err = os.CopyFS(dst, os.DirFS(src))
+		case entry.Type().IsRegular():
+			err = copyFilePrefix(src, dst, -1)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestManager_PartitionCount(t *testing.T) {
+	dataPath := t.TempDir()
+	open := func(count int) (*Manager, error) {
+		return NewManager(&types.DBSchemaConfig{DataPath: dataPath, SyncMode: "normal", PartitionCount: count})
+	}
+
+	for _, bad := range []int{3, 24, -8, 2 * MaxPartitionCount} {
+		if _, err := open(bad); err == nil {
+			t.Errorf("Expected partition count %d to be rejected", bad)
+		}
+	}
+
+	mgr, err := open(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mgr.Buckets) != 64 {
+		t.Errorf("Expected 64 buckets, got %d", len(mgr.Buckets))
+	}
+	for i := range 1000 {
+		if id := mgr.getBucketID(fmt.Sprintf("key-%d", i)); id >= 64 {
+			t.Fatalf("Bucket ID %d out of range", id)
+		}
+	}
+	if err := mgr.Append("k", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	mgr.Close()
+
+	// The count is recorded with the data and must match when reopening
+	if _, err := open(16); err == nil || !strings.Contains(err.Error(), "64 partitions") {
+		t.Errorf("Expected reopening with another count to fail, got %v", err)
+	}
+	mgr, err = open(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+	if mgr.PartitionCount != 64 {
+		t.Errorf("Expected the recorded count 64 when none is configured, got %d", mgr.PartitionCount)
+	}
+	if v, err := mgr.Get("k", 0); err != nil || string(v) != "v" {
+		t.Errorf("Get = %q, %v", v, err)
+	}
+
+	// Data directories from before the meta file have the default count
+	legacy := t.TempDir()
+	os.MkdirAll(filepath.Join(legacy, "data"), 0755)
+	os.WriteFile(filepath.Join(legacy, "data", bucketFileName(0)), nil, 0644)
+	if _, err := NewManager(&types.DBSchemaConfig{DataPath: legacy, PartitionCount: 32}); err == nil {
+		t.Error("Expected a legacy data directory to refuse a non-default count")
+	}
+}
+
+func TestRepartition(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "db")
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: src, SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	const n = 200
+	for i := range n {
+		key := fmt.Sprintf("doc-%d", i)
+		for j := range 2 {
+			block := &types.BlockData{Primary: fmt.Sprintf("%s/%d", key, j), Vector: []float32{float32(i), float32(j)}}
+			if _, err := vm.AppendBlock("docs", key, block); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// DeleteKey leaves the records of the key in storage until compaction
+	if err := vm.DeleteKey("docs", "doc-0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.Snapshot("before"); err != nil {
+		t.Fatal(err)
+	}
+	vm.Close()
+
+	stats, err := Repartition(src, dst, 4)
+	if err != nil {
+		t.Fatalf("Repartition failed: %v", err)
+	}
+	if stats.FromPartitions != DefaultPartitionCount || stats.ToPartitions != 4 || stats.Keys != n || stats.Records != 2*n {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "snapshots")); !os.IsNotExist(err) {
+		t.Errorf("Expected snapshots not to be copied, got %v", err)
+	}
+	if _, err := Repartition(src, dst, 8); err == nil {
+		t.Error("Expected Repartition into a non-empty directory to fail")
+	}
+
+	vm, err = NewVectorManager(&types.DBSchemaConfig{DataPath: dst, SyncMode: "normal", PartitionCount: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if len(vm.Manager.Buckets) != 4 {
+		t.Errorf("Expected 4 buckets, got %d", len(vm.Manager.Buckets))
+	}
+	block, err := vm.GetBlock("docs", "doc-42", 1)
+	if err != nil || block.Primary != "doc-42/1" || block.Vector[0] != 42 {
+		t.Errorf("GetBlock = %+v, %v", block, err)
+	}
+	if ok, _ := vm.ContainsKey("docs", "doc-0"); ok {
+		t.Error("Expected the deleted key to stay deleted")
+	}
+	results, err := vm.Search("docs", []float32{7, 0}, 1, "", nil)
+	if err != nil || len(results) != 1 || results[0].Key != "doc-7" {
+		t.Errorf("Search = %+v, %v", results, err)
+	}
+}
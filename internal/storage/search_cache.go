@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"slices"
+	"sync"
+
+	"waddlemap/internal/metrics"
+	"waddlemap/internal/types"
+)
+
+// DefaultSearchCacheSize is the number of searches a SearchCache holds unless
+// configured otherwise.
+const DefaultSearchCacheSize = 1000
+
+// searchCacheKey identifies a search: a hash of the collection, the hash of
+// the query vector, topK and the hash of the filter.
+type searchCacheKey [sha256.Size]byte
+
+type searchCacheEntry struct {
+	key       searchCacheKey
+	results   []types.SearchResultItem
+	version   uint64 // HNSWWrapper.DirtyCount of the index searched
+	expiresAt int64  // Earliest expiry of the results (Unix time; 0 = never)
+}
+
+// SearchCache is an LRU cache of search results, so that a search repeated
+// while the index is unchanged skips the HNSW search. Each entry records the
+// version of the index it was computed on, and a lookup finding an older one
+// drops it and reports a miss. Expiring blocks leave the index unchanged, so
+// an entry also records when its first result expires and is dropped after.
+type SearchCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[searchCacheKey]*list.Element
+	lru      *list.List // Front is the most recently used
+	stats    CacheStats
+}
+
+// NewSearchCache creates a cache holding the results of up to capacity
+// searches. A capacity of zero or less disables it.
+func NewSearchCache(capacity int) *SearchCache {
+	return &SearchCache{
+		capacity: max(capacity, 0),
+		entries:  make(map[searchCacheKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// newSearchCacheKey returns the key of a search of collection for the topK
+// nearest neighbors of query that pass filter.
+func newSearchCacheKey(collection string, query []float32, topK uint32, filter *types.SearchFilter) searchCacheKey {
+	vectorHash := sha256.New()
+	var buf [4]byte
+	for _, x := range query {
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(x))
+		vectorHash.Write(buf[:])
+	}
+	// Encoding a filter of plain fields cannot fail
+	filterJSON, _ := json.Marshal(filter)
+	filterHash := sha256.Sum256(filterJSON)
+
+	h := sha256.New()
+	binary.LittleEndian.PutUint32(buf[:], uint32(len(collection)))
+	h.Write(buf[:])
+	h.Write([]byte(collection))
+	h.Write(vectorHash.Sum(nil))
+	binary.LittleEndian.PutUint32(buf[:], topK)
+	h.Write(buf[:])
+	h.Write(filterHash[:])
+
+	var key searchCacheKey
+	h.Sum(key[:0])
+	return key
+}
+
+// Get returns a copy of the results cached for key, if they were computed on
+// the index at version and none of them has expired at now (a Unix time).
+func (sc *SearchCache) Get(key searchCacheKey, version uint64, now int64) ([]types.SearchResultItem, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.capacity == 0 {
+		return nil, false
+	}
+	elem, ok := sc.entries[key]
+	if ok && !elem.Value.(*searchCacheEntry).validAt(version, now) {
+		// The index changed or a result expired since
+		sc.lru.Remove(elem)
+		delete(sc.entries, key)
+		ok = false
+	}
+	if !ok {
+		sc.stats.Misses++
+		metrics.SearchCacheRequestsTotal.WithLabelValues(metrics.CacheMiss).Inc()
+		return nil, false
+	}
+	sc.lru.MoveToFront(elem)
+	sc.stats.Hits++
+	metrics.SearchCacheRequestsTotal.WithLabelValues(metrics.CacheHit).Inc()
+	return slices.Clone(elem.Value.(*searchCacheEntry).results), true
+}
+
+// validAt reports whether the entry still holds the results of a search of
+// the index at version at time now.
+func (e *searchCacheEntry) validAt(version uint64, now int64) bool {
+	return e.version == version && (e.expiresAt == 0 || now <= e.expiresAt)
+}
+
+// Put caches the results of the search key computed on the index at
+// version, until expiresAt (a Unix time; 0 = never), the earliest expiry
+// among the results. The caller must read the version before searching, so
+// that results of a search racing a write are dropped on the next Get.
+func (sc *SearchCache) Put(key searchCacheKey, version uint64, expiresAt int64, results []types.SearchResultItem) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.capacity == 0 {
+		return
+	}
+	results = slices.Clone(results)
+	if elem, ok := sc.entries[key]; ok {
+		entry := elem.Value.(*searchCacheEntry)
+		entry.results, entry.version, entry.expiresAt = results, version, expiresAt
+		sc.lru.MoveToFront(elem)
+		return
+	}
+	sc.entries[key] = sc.lru.PushFront(&searchCacheEntry{key: key, results: results, version: version, expiresAt: expiresAt})
+	sc.evictUnlocked()
+}
+
+// Resize changes the capacity of the cache, evicting the least recently
+// used searches beyond it. A capacity of zero or less disables the cache.
+func (sc *SearchCache) Resize(capacity int) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.capacity = max(capacity, 0)
+	sc.evictUnlocked()
+}
+
+// Len returns the number of cached searches.
+func (sc *SearchCache) Len() int {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.lru.Len()
+}
+
+// Stats returns the hit, miss and eviction counts of the cache. Lookups of
+// results computed on an older index version or holding an expired block
+// count as misses.
+func (sc *SearchCache) Stats() CacheStats {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.stats
+}
+
+// evictUnlocked drops least recently used entries until the cache fits its
+// capacity. Caller must hold sc.mu.
+func (sc *SearchCache) evictUnlocked() {
+	for sc.lru.Len() > sc.capacity {
+		elem := sc.lru.Back()
+		sc.lru.Remove(elem)
+		delete(sc.entries, elem.Value.(*searchCacheEntry).key)
+		sc.stats.Evictions++
+		metrics.SearchCacheEvictionsTotal.Inc()
+	}
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"waddlemap/internal/types"
+)
+
+func TestSearchCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	sc := NewSearchCache(2)
+	keys := make([]searchCacheKey, 3)
+	for i := range keys {
+		keys[i] = newSearchCacheKey("c", []float32{float32(i)}, 10, nil)
+		sc.Put(keys[i], 1, 0, []types.SearchResultItem{{Key: fmt.Sprint(i)}})
+		if i == 1 {
+			sc.Get(keys[0], 1, 0) // 1 is now the least recently used
+		}
+	}
+	if results, ok := sc.Get(keys[0], 1, 0); !ok || results[0].Key != "0" {
+		t.Errorf("Get(0) = %v, %v", results, ok)
+	}
+	if _, ok := sc.Get(keys[1], 1, 0); ok {
+		t.Error("Expected the least recently used search to be evicted")
+	}
+
+	// Results of an older index version are dropped
+	if _, ok := sc.Get(keys[2], 2, 0); ok {
+		t.Error("Expected results of another index version to miss")
+	}
+	if _, ok := sc.Get(keys[2], 1, 0); ok || sc.Len() != 1 {
+		t.Errorf("Expected stale results to be removed, %d entries left", sc.Len())
+	}
+	if want := (CacheStats{Hits: 2, Misses: 3, Evictions: 1}); sc.Stats() != want {
+		t.Errorf("Stats = %+v, want %+v", sc.Stats(), want)
+	}
+
+	// Cached results are copies
+	results, _ := sc.Get(keys[0], 1, 0)
+	results[0].Key = "changed"
+	if again, _ := sc.Get(keys[0], 1, 0); again[0].Key != "0" {
+		t.Errorf("Cached results changed through a returned slice: %v", again)
+	}
+
+	sc.Resize(0)
+	sc.Put(keys[1], 1, 0, nil)
+	if _, ok := sc.Get(keys[1], 1, 0); ok || sc.Len() != 0 {
+		t.Error("Expected a disabled cache to hold nothing")
+	}
+}
+
+func TestSearchCache_KeyCoversSearch(t *testing.T) {
+	base := newSearchCacheKey("c", []float32{1, 2}, 10, &types.SearchFilter{Keywords: []string{"a"}})
+	for name, key := range map[string]searchCacheKey{
+		"collection": newSearchCacheKey("d", []float32{1, 2}, 10, &types.SearchFilter{Keywords: []string{"a"}}),
+		"query":      newSearchCacheKey("c", []float32{1, 3}, 10, &types.SearchFilter{Keywords: []string{"a"}}),
+		"topK":       newSearchCacheKey("c", []float32{1, 2}, 5, &types.SearchFilter{Keywords: []string{"a"}}),
+		"filter":     newSearchCacheKey("c", []float32{1, 2}, 10, &types.SearchFilter{Keywords: []string{"b"}}),
+	} {
+		if key == base {
+			t.Errorf("Key ignores the %s", name)
+		}
+	}
+	if newSearchCacheKey("c", []float32{1, 2}, 10, &types.SearchFilter{Keywords: []string{"a"}}) != base {
+		t.Error("Expected equal searches to have equal keys")
+	}
+}
+
+func TestVectorManager_SearchCache(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("docs", "a", &types.BlockData{Primary: "a", Vector: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func() []types.SearchResultItem {
+		t.Helper()
+		results, err := vm.Search("docs", []float32{0, 1}, 1, "", nil)
+		if err != nil || len(results) != 1 {
+			t.Fatalf("Search = %+v, %v", results, err)
+		}
+		return results
+	}
+	search()
+	if results := search(); results[0].Key != "a" || results[0].Block == nil || results[0].Block.Primary != "a" {
+		t.Errorf("Cached search = %+v", results[0])
+	}
+	if stats := vm.SearchCacheStats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Stats after a repeated search = %+v", stats)
+	}
+
+	// A write to the index makes the cached results stale
+	if _, err := vm.AppendBlock("docs", "b", &types.BlockData{Primary: "b", Vector: []float32{0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if results := search(); results[0].Key != "b" {
+		t.Errorf("Search after an append returned %s, want b", results[0].Key)
+	}
+	if err := vm.DeleteKey("docs", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if results := search(); results[0].Key != "a" {
+		t.Errorf("Search after a delete returned %s, want a", results[0].Key)
+	}
+	if stats := vm.SearchCacheStats(); stats.Hits != 1 || stats.Misses != 3 {
+		t.Errorf("Stats after writes = %+v", stats)
+	}
+}
+
+func TestSearchCache_DropsExpiredResults(t *testing.T) {
+	sc := NewSearchCache(10)
+	key := newSearchCacheKey("c", []float32{1}, 10, nil)
+	sc.Put(key, 1, 100, []types.SearchResultItem{{Key: "a"}})
+	if _, ok := sc.Get(key, 1, 100); !ok {
+		t.Error("Expected a hit until the first result expires")
+	}
+	if _, ok := sc.Get(key, 1, 101); ok || sc.Len() != 0 {
+		t.Error("Expected results with an expired block to be dropped")
+	}
+
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal", ExpirySweepInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("docs", "temp", &types.BlockData{Primary: "temp", Vector: []float32{1, 0}, TTLSeconds: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("docs", "keep", &types.BlockData{Primary: "keep", Vector: []float32{0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if results, err := vm.Search("docs", []float32{1, 0}, 2, "", nil); err != nil || len(results) != 2 || results[0].Key != "temp" {
+		t.Fatalf("Search = %+v, %v", results, err)
+	}
+
+	// Expiry leaves the index version unchanged, so only the expiry recorded
+	// with the cached results keeps the expired block out
+	time.Sleep(2 * time.Second)
+	results, err := vm.Search("docs", []float32{1, 0}, 2, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Key != "keep" || results[0].Block == nil || results[0].Block.Primary != "keep" {
+		t.Errorf("Search after expiry = %+v, want keep with its block", results)
+	}
+	if stats := vm.SearchCacheStats(); stats.Hits != 0 || stats.Misses != 2 {
+		t.Errorf("Stats = %+v, want the expired results to miss", stats)
+	}
+}
+
+func BenchmarkVectorManager_RepeatedSearch(b *testing.B) {
+	for _, size := range []int{-1, DefaultSearchCacheSize} {
+		name := "cached"
+		if size < 0 {
+			name = "uncached"
+		}
+		b.Run(name, func(b *testing.B) {
+			vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: b.TempDir(), SyncMode: "normal", SearchCacheSize: size})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer vm.Close()
+			if err := vm.CreateCollection("bench", 32, types.MetricL2); err != nil {
+				b.Fatal(err)
+			}
+			rng := rand.New(rand.NewSource(1))
+			const n = 5000
+			keys := make([]string, n)
+			blocks := make([]*types.BlockData, n)
+			for i := range n {
+				keys[i] = fmt.Sprintf("doc-%d", i)
+				blocks[i] = &types.BlockData{Vector: randomVector(rng, 32)}
+			}
+			if _, err := vm.BatchAppendBlocks("bench", keys, blocks); err != nil {
+				b.Fatal(err)
+			}
+			queries := make([][]float32, 16)
+			for i := range queries {
+				queries[i] = randomVector(rng, 32)
+			}
+
+			b.ResetTimer()
+			for i := range b.N {
+				if _, err := vm.Search("bench", queries[i%len(queries)], 10, "", nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"waddlemap/internal/types"
+)
+
+// DefaultCursorTTL is how long paged search results stay cached after their last access.
+const DefaultCursorTTL = 60 * time.Second
+
+// pagedSearchEfFactor multiplies EfSearch to size the candidate pool of a paged search.
+const pagedSearchEfFactor = 4
+
+// Search cursors are opaque to clients. Internally a cursor is the URL-safe
+// base64 encoding of [SearchID(8)][LastDistance(4)][LastVectorID(8)]: the
+// SearchID names the cached result list and the rest marks the last result
+// already returned.
+const cursorSize = 20
+
+var errInvalidCursor = errors.New("search cursor is invalid or has expired")
+
+// pagedHit is a search result together with the vector ID that produced it.
+type pagedHit struct {
+	VectorID uint64
+	Item     types.SearchResultItem
+}
+
+type cursorEntry struct {
+	collection string
+	hits       []pagedHit // Sorted by ascending distance
+	expires    time.Time
+}
+
+// cursorCache holds the full result lists of paged searches for a short time.
+type cursorCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[uint64]*cursorEntry
+}
+
+func newCursorCache(ttl time.Duration) *cursorCache {
+	if ttl <= 0 {
+		ttl = DefaultCursorTTL
+	}
+	return &cursorCache{ttl: ttl, entries: make(map[uint64]*cursorEntry)}
+}
+
+// put stores a result list and returns its search ID.
+func (cc *cursorCache) put(collection string, hits []pagedHit) uint64 {
+	var buf [8]byte
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.evictExpired()
+	var searchID uint64
+	for searchID == 0 || cc.entries[searchID] != nil {
+		rand.Read(buf[:])
+		searchID = binary.BigEndian.Uint64(buf[:])
+	}
+	cc.entries[searchID] = &cursorEntry{
+		collection: collection,
+		hits:       hits,
+		expires:    time.Now().Add(cc.ttl),
+	}
+	return searchID
+}
+
+// get returns the cached results of a search and extends their lifetime.
+func (cc *cursorCache) get(searchID uint64, collection string) ([]pagedHit, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.evictExpired()
+	entry := cc.entries[searchID]
+	if entry == nil || entry.collection != collection {
+		return nil, false
+	}
+	entry.expires = time.Now().Add(cc.ttl)
+	return entry.hits, true
+}
+
+func (cc *cursorCache) remove(searchID uint64) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	delete(cc.entries, searchID)
+}
+
+// evictExpired drops stale entries (caller must hold mu).
+func (cc *cursorCache) evictExpired() {
+	now := time.Now()
+	for id, entry := range cc.entries {
+		if now.After(entry.expires) {
+			delete(cc.entries, id)
+		}
+	}
+}
+
+func encodeCursor(searchID uint64, last pagedHit) string {
+	buf := make([]byte, cursorSize)
+	binary.BigEndian.PutUint64(buf[0:8], searchID)
+	binary.BigEndian.PutUint32(buf[8:12], math.Float32bits(last.Item.Distance))
+	binary.BigEndian.PutUint64(buf[12:20], last.VectorID)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodeCursor(cursor string) (searchID uint64, lastDistance float32, lastVectorID uint64, err error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(buf) != cursorSize {
+		return 0, 0, 0, errInvalidCursor
+	}
+	return binary.BigEndian.Uint64(buf[0:8]),
+		math.Float32frombits(binary.BigEndian.Uint32(buf[8:12])),
+		binary.BigEndian.Uint64(buf[12:20]),
+		nil
+}
+
+// pageStart returns the position of the first hit after the one with
+// lastVectorID at lastDistance.
+func pageStart(hits []pagedHit, lastDistance float32, lastVectorID uint64) int {
+	i := sort.Search(len(hits), func(i int) bool { return hits[i].Item.Distance >= lastDistance })
+	for ; i < len(hits) && hits[i].Item.Distance == lastDistance; i++ {
+		if hits[i].VectorID == lastVectorID {
+			return i + 1
+		}
+	}
+	return i
+}
@@ -1,29 +1,56 @@
 package storage
 
 import (
+	"bufio"
 	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 	"waddlemap/internal/logger"
 	"waddlemap/internal/types"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/zeebo/blake3"
 )
 
-const PartitionCount = 16
+// DefaultPartitionCount is the number of buckets of a Manager unless
+// configured otherwise.
+const DefaultPartitionCount = 16
+
+// MaxPartitionCount bounds the configurable number of buckets.
+const MaxPartitionCount = 1024
+
+// tombstonePrefix marks a deletion record. DeleteKey appends a record with key
+// tombstonePrefix+key and a zero-length payload, so rebuildIndex can drop the
+// key's earlier records. Tombstones never appear in the in-memory index.
+const tombstonePrefix = "\x00DEL\x00"
 
 type Manager struct {
 	Config      *types.DBSchemaConfig
 	Buckets     map[uint32]*Bucket
 	mu          sync.RWMutex
 	Compression bool
+
+	// PartitionCount is the number of buckets keys are hashed into, a power
+	// of 2 recorded in manager_meta.json. bucketMask is PartitionCount-1.
+	PartitionCount uint32
+	bucketMask     uint32
 }
 
 type Bucket struct {
@@ -33,18 +60,27 @@ type Bucket struct {
 	WriteLock sync.RWMutex
 	Index     map[string][]int64 // Key -> List of Offsets in File
 	IndexLock sync.RWMutex
+
+	// FileLock is held exclusively while File is replaced, by Compact and
+	// snapshot restores, and shared by reads that hold no WriteLock. Writers
+	// hold WriteLock, which the replacements also take.
+	FileLock sync.RWMutex
 }
 
 // NewManager creates a new storage Manager instance with the provided database schema configuration.
-// It initializes the data directory and creates/opens PartitionCount bucket files for data storage.
+// It initializes the data directory and creates/opens cfg.PartitionCount bucket files for data storage.
+// A zero PartitionCount opens as many as the existing data was written with, or DefaultPartitionCount
+// for a new data directory.
 // Each bucket maintains its own file and in-memory index for key-value lookups.
 // If a bucket's index file is corrupted or missing, it will be automatically rebuilt from the data file.
-// Returns an error if directory creation fails, file operations fail, or bucket initialization fails.
+// Buckets are opened in parallel, by up to one goroutine per CPU.
+// Returns an error if directory creation fails, file operations fail, or bucket initialization fails,
+// and if the partition count is not a power of 2 or differs from the one the data was written with.
 func NewManager(cfg *types.DBSchemaConfig) (*Manager, error) {
-	mgr := &Manager{
-		Config:      cfg,
-		Buckets:     make(map[uint32]*Bucket),
-		Compression: true,
+	if cfg.PartitionCount != 0 {
+		if err := ValidatePartitionCount(cfg.PartitionCount); err != nil {
+			return nil, err
+		}
 	}
 
 	// Create data directory inside DataPath
@@ -52,35 +88,165 @@ func NewManager(cfg *types.DBSchemaConfig) (*Manager, error) {
 	if err := os.MkdirAll(dataPath, 0755); err != nil {
 		return nil, err
 	}
+	count, err := checkManagerMeta(dataPath, uint32(cfg.PartitionCount))
+	if err != nil {
+		return nil, err
+	}
+	mgr := &Manager{
+		Config:         cfg,
+		Buckets:        make(map[uint32]*Bucket),
+		Compression:    true,
+		PartitionCount: count,
+		bucketMask:     count - 1,
+	}
+
+	buckets, err := openBuckets(dataPath, count, min(int(count), runtime.NumCPU()))
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range buckets {
+		mgr.Buckets[b.ID] = b
+	}
+	return mgr, nil
+}
 
-	for i := 0; i < PartitionCount; i++ {
-		bucketID := uint32(i)
-		fileName := fmt.Sprintf("waddle_shard_%03d.db", bucketID)
-		filePath := filepath.Join(dataPath, fileName) // Use subdirectory
+// openBuckets opens the count bucket files in dataPath, loading or
+// rebuilding their indexes with up to workers goroutines. The first failure
+// stops the rebuilds still running; the buckets opened are closed again and
+// the errors of all buckets returned.
+func openBuckets(dataPath string, count uint32, workers int) ([]*Bucket, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	buckets := make([]*Bucket, count)
+	errs := make(chan error, count)
+	sem := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+	for id := range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
 
-		f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
-		if err != nil {
-			return nil, err
+			b, err := openBucket(ctx, id, filepath.Join(dataPath, bucketFileName(id)))
+			if err != nil {
+				errs <- fmt.Errorf("bucket %d: %w", id, err)
+				cancel()
+				return
+			}
+			buckets[id] = b
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var failed []error
+	for err := range errs {
+		// Rebuilds stopped because of another failure add nothing
+		if !errors.Is(err, context.Canceled) {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == 0 {
+		return buckets, nil
+	}
+	for _, b := range buckets {
+		if b != nil {
+			b.File.Close()
 		}
+	}
+	return nil, errors.Join(failed...)
+}
+
+// openBucket opens the bucket file at filePath and loads its index, rebuilding
+// it from the file if it is missing or corrupted.
+func openBucket(ctx context.Context, id uint32, filePath string) (*Bucket, error) {
+	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bucket{
+		ID:       id,
+		FilePath: filePath,
+		File:     f,
+		Index:    make(map[string][]int64),
+	}
 
-		b := &Bucket{
-			ID:       bucketID,
-			FilePath: filePath,
-			File:     f,
-			Index:    make(map[string][]int64),
+	if err := b.loadIndex(); err != nil {
+		logger.InfoAttrs("rebuilding bucket index", "bucket", id, "path", b.File.Name(), "reason", err)
+		if err := b.rebuildIndex(ctx); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := b.saveIndex(); err != nil {
+			// The index is rebuilt again on the next start
+			logger.Error("Failed to save the rebuilt index of bucket %d: %v", id, err)
 		}
+	}
+	return b, nil
+}
+
+// ValidatePartitionCount checks that n is a usable number of buckets: a power
+// of 2 between 1 and MaxPartitionCount.
+func ValidatePartitionCount(n int) error {
+	if n < 1 || n > MaxPartitionCount || n&(n-1) != 0 {
+		return fmt.Errorf("partition count %d must be a power of 2 between 1 and %d", n, MaxPartitionCount)
+	}
+	return nil
+}
+
+// managerMetaFile records the layout of the bucket files in the data directory.
+const managerMetaFile = "manager_meta.json"
+
+type managerMeta struct {
+	PartitionCount uint32 `json:"partition_count"`
+}
 
-		// Load Index
-		if err := b.loadIndex(); err != nil {
-			logger.Info("Bucket %d: Rebuilding index... (Reason: %v)", bucketID, err)
-			b.rebuildIndex()
-			b.saveIndex()
+// checkManagerMeta returns the partition count of the bucket files in
+// dataPath, recording it for a new data directory. A data directory with
+// bucket files but no meta file predates configurable partitioning and has
+// DefaultPartitionCount buckets. A non-zero count must match: opening data
+// with another count would hash keys to the wrong buckets.
+func checkManagerMeta(dataPath string, count uint32) (uint32, error) {
+	metaPath := filepath.Join(dataPath, managerMetaFile)
+	var meta managerMeta
+	data, err := os.ReadFile(metaPath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return 0, fmt.Errorf("failed to parse %s: %w", managerMetaFile, err)
 		}
+		if ValidatePartitionCount(int(meta.PartitionCount)) != nil {
+			return 0, fmt.Errorf("%s holds invalid partition count %d", managerMetaFile, meta.PartitionCount)
+		}
+	case !os.IsNotExist(err):
+		return 0, err
+	default:
+		meta.PartitionCount = cmp.Or(count, DefaultPartitionCount)
+		if _, err := os.Stat(filepath.Join(dataPath, bucketFileName(0))); err == nil {
+			meta.PartitionCount = DefaultPartitionCount
+		}
+	}
 
-		mgr.Buckets[bucketID] = b
+	if count != 0 && count != meta.PartitionCount {
+		return 0, fmt.Errorf("data in %s was written with %d partitions, not %d; use cmd/repartition to change it",
+			dataPath, meta.PartitionCount, count)
+	}
+	if data == nil {
+		if data, err = json.MarshalIndent(meta, "", "  "); err != nil {
+			return 0, err
+		}
+		if err := os.WriteFile(metaPath, data, 0644); err != nil {
+			return 0, err
+		}
 	}
+	return meta.PartitionCount, nil
+}
 
-	return mgr, nil
+// bucketFileName returns the name of the data file of bucket id.
+func bucketFileName(id uint32) string {
+	return fmt.Sprintf("waddle_shard_%03d.db", id)
 }
 
 func (m *Manager) Close() error {
@@ -105,13 +271,13 @@ func (m *Manager) Close() error {
 
 // getBucketID computes a bucket ID for the given key using the BLAKE3 hash function.
 // It hashes the key, extracts the first 4 bytes of the hash as a uint32 value in big-endian order,
-// and returns the value modulo PartitionCount to ensure the bucket ID is within valid range.
+// and masks it with PartitionCount-1, a power of 2 minus one, to ensure the bucket ID is within valid range.
 func (m *Manager) getBucketID(key string) uint32 {
 	h := blake3.New()
 	h.Write([]byte(key))
 	sum := h.Sum(nil)
 	val := binary.BigEndian.Uint32(sum[:4])
-	return val % PartitionCount
+	return val & m.bucketMask
 }
 
 // ---------------- Operations ----------------
@@ -123,6 +289,16 @@ func (m *Manager) getBucketID(key string) uint32 {
 // If SyncMode is set to "strict", the file is synced to disk after writing.
 // Returns an error if any file or index operation fails.
 func (m *Manager) Append(key string, payload []byte) error {
+	bucket := m.Buckets[m.getBucketID(key)]
+
+	bucket.WriteLock.Lock()
+	defer bucket.WriteLock.Unlock()
+
+	return m.appendLocked(bucket, key, payload)
+}
+
+// appendLocked implements Append. Caller must hold bucket.WriteLock.
+func (m *Manager) appendLocked(bucket *Bucket, key string, payload []byte) error {
 	// Security: Limit key and payload size to prevent abuse
 	const maxKeyLen = 1024
 	// const maxPayloadLen = 10 * 1024 * 1024 // 10MB
@@ -134,52 +310,66 @@ func (m *Manager) Append(key string, payload []byte) error {
 	// 	return fmt.Errorf("payload too large")
 	// }
 
-	bucket := m.Buckets[m.getBucketID(key)]
+	offset, err := bucket.appendRecord(key, payload)
+	if err != nil {
+		return err
+	}
 
-	bucket.WriteLock.Lock()
-	defer bucket.WriteLock.Unlock()
+	// Update Index
+	bucket.IndexLock.Lock()
+	bucket.Index[key] = append(bucket.Index[key], offset)
+	bucket.IndexLock.Unlock()
+
+	if m.Config.SyncMode == "strict" {
+		return bucket.File.Sync()
+	}
+	return nil
+}
 
-	offset, err := bucket.File.Seek(0, 2) // End // Append the data to the end of the file
+// appendRecord writes a record for key and payload at the end of the bucket file
+// and returns its offset. Caller must hold b.WriteLock.
+func (b *Bucket) appendRecord(key string, payload []byte) (int64, error) {
+	offset, err := b.File.Seek(0, 2) // End // Append the data to the end of the file
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Format: [KeyLen(4 bytes - int32)][KeyBytes][PayloadLen(4 bytes - int32)][PayloadBytes]
 
 	buf := new(bytes.Buffer)
 	if err := binary.Write(buf, binary.BigEndian, int32(len(key))); err != nil {
-		return err
+		return 0, err
 	}
 	if _, err := buf.Write([]byte(key)); err != nil {
-		return err
+		return 0, err
 	}
 
 	compressedPayload := CompressBytes(payload)
 
 	if len(compressedPayload) >= math.MaxInt32 {
-		return fmt.Errorf("Payload size greater than MaxInt32 bytes after compression")
+		return 0, fmt.Errorf("Payload size greater than MaxInt32 bytes after compression")
 	}
 	// Using int32 since we assume the data to be of smaller sizer. It can hold approx 2.14 GB
 	if err := binary.Write(buf, binary.BigEndian, uint32(len(compressedPayload))); err != nil {
-		return err
+		return 0, err
 	}
 	if _, err := buf.Write(compressedPayload); err != nil {
-		return err
+		return 0, err
 	}
 
-	if _, err := bucket.File.Write(buf.Bytes()); err != nil {
-		return err
+	if _, err := b.File.Write(buf.Bytes()); err != nil {
+		return 0, storageWriteError(b.File.Name(), err)
 	}
+	return offset, nil
+}
 
-	// Update Index
-	bucket.IndexLock.Lock()
-	bucket.Index[key] = append(bucket.Index[key], offset)
-	bucket.IndexLock.Unlock()
-
-	if m.Config.SyncMode == "strict" {
-		return bucket.File.Sync()
+// storageWriteError returns err, a failed write to path, as a
+// *types.StorageFullError if the disk is out of space.
+func storageWriteError(path string, err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return &types.StorageFullError{Path: path, Err: err}
 	}
-	return nil
+	return err
 }
 
 // BatchAppend adds multiple entries to the storage.
@@ -202,7 +392,7 @@ func (m *Manager) BatchAppend(entries map[string][]byte) error {
 	// 2. Process each bucket concurrently or sequentially
 	// Using concurrency for speed
 	var mu sync.Mutex
-	var errs []string
+	var errs []error
 	var wg sync.WaitGroup
 
 	for bid, items := range grouped {
@@ -260,7 +450,7 @@ func (m *Manager) BatchAppend(entries map[string][]byte) error {
 			if err != nil {
 				bucket.WriteLock.Unlock()
 				mu.Lock()
-				errs = append(errs, fmt.Sprintf("bucket %d seek: %v", bucketID, err))
+				errs = append(errs, fmt.Errorf("bucket %d seek: %w", bucketID, err))
 				mu.Unlock()
 				return
 			}
@@ -275,7 +465,7 @@ func (m *Manager) BatchAppend(entries map[string][]byte) error {
 				n, err := bucket.File.Write(p.Buffer)
 				if err != nil {
 					mu.Lock()
-					errs = append(errs, fmt.Sprintf("bucket %d write key %s: %v", bucketID, p.Key, err))
+					errs = append(errs, fmt.Errorf("bucket %d write key %s: %w", bucketID, p.Key, storageWriteError(bucket.File.Name(), err)))
 					mu.Unlock()
 					break // Stop writing to this bucket
 				}
@@ -287,39 +477,66 @@ func (m *Manager) BatchAppend(entries map[string][]byte) error {
 			if m.Config.SyncMode == "strict" {
 				bucket.File.Sync()
 			}
-			bucket.WriteLock.Unlock()
 
-			// Update Index
+			// Update Index before releasing the write lock so Compact never
+			// sees records on disk that are missing from the index
 			bucket.IndexLock.Lock()
 			for k, off := range newIndexEntries {
 				bucket.Index[k] = append(bucket.Index[k], off)
 			}
 			bucket.IndexLock.Unlock()
+			bucket.WriteLock.Unlock()
 		}(bid, items)
 	}
 	wg.Wait()
 
 	if len(errs) > 0 {
-		return fmt.Errorf("batch append errors: %s", strings.Join(errs, "; "))
+		return fmt.Errorf("batch append errors: %w", errors.Join(errs...))
 	}
 	return nil
 }
 
 func (m *Manager) Get(key string, index int) ([]byte, error) {
 	bucket := m.Buckets[m.getBucketID(key)]
+	bucket.FileLock.RLock()
+	defer bucket.FileLock.RUnlock()
 
 	bucket.IndexLock.RLock()
 	offsets, exists := bucket.Index[key]
 	bucket.IndexLock.RUnlock()
 
-	if !exists || index >= len(offsets) || index < 0 {
-		return nil, fmt.Errorf("index out of bounds or key not found")
+	if !exists {
+		return nil, &types.KeyNotFoundError{Key: key}
+	}
+	if index >= len(offsets) || index < 0 {
+		return nil, &types.BlockNotFoundError{Key: key, Index: uint32(index)}
 	}
 
 	offset := offsets[index]
 	return bucket.readRecordAt(offset)
 }
 
+// GetEntry retrieves and decodes the entry stored at the given index for key.
+// Large records are decompressed and decoded in streaming fashion.
+func (m *Manager) GetEntry(key string, index int) (*Entry, error) {
+	bucket := m.Buckets[m.getBucketID(key)]
+	bucket.FileLock.RLock()
+	defer bucket.FileLock.RUnlock()
+
+	bucket.IndexLock.RLock()
+	offsets, exists := bucket.Index[key]
+	bucket.IndexLock.RUnlock()
+
+	if !exists {
+		return nil, &types.KeyNotFoundError{Key: key}
+	}
+	if index >= len(offsets) || index < 0 {
+		return nil, &types.BlockNotFoundError{Key: key, Index: uint32(index)}
+	}
+
+	return bucket.readEntryAt(offsets[index])
+}
+
 func (m *Manager) GetLength(key string) int {
 	bucket := m.Buckets[m.getBucketID(key)]
 	bucket.IndexLock.RLock()
@@ -334,8 +551,11 @@ func (m *Manager) Update(key string, index int, payload []byte) error {
 	offsets, exists := bucket.Index[key]
 	bucket.IndexLock.RUnlock()
 
-	if !exists || index >= len(offsets) {
-		return fmt.Errorf("item not found")
+	if !exists {
+		return &types.KeyNotFoundError{Key: key}
+	}
+	if index >= len(offsets) || index < 0 {
+		return &types.BlockNotFoundError{Key: key, Index: uint32(index)}
 	}
 	offset := offsets[index]
 
@@ -352,21 +572,153 @@ func (m *Manager) Update(key string, index int, payload []byte) error {
 	payloadOffset := offset + int64(headerOffset)
 
 	if _, err := bucket.File.WriteAt(payload, payloadOffset); err != nil {
-		return err
+		return storageWriteError(bucket.File.Name(), err)
 	}
 	return nil // No sync forced here unless strict
 }
 
-// DeleteKey removes the key from the in-memory index.
-// Note: The data remains on disk until compaction (not yet implemented).
-// If the index is rebuilt from disk, this data might reappear unless a tombstone is written.
+// Replace stores payload as the record at index for key. The new record is
+// appended and the index redirected to it, so the payload may grow; the old
+// record stays on disk until the bucket is compacted.
+func (m *Manager) Replace(key string, index int, payload []byte) error {
+	bucket := m.Buckets[m.getBucketID(key)]
+
+	bucket.WriteLock.Lock()
+	defer bucket.WriteLock.Unlock()
+
+	return m.replaceLocked(bucket, key, index, payload)
+}
+
+// replaceLocked implements Replace. Caller must hold bucket.WriteLock.
+func (m *Manager) replaceLocked(bucket *Bucket, key string, index int, payload []byte) error {
+	bucket.IndexLock.RLock()
+	count := len(bucket.Index[key])
+	bucket.IndexLock.RUnlock()
+	if index < 0 || index >= count {
+		return &types.BlockNotFoundError{Key: key, Index: uint32(index)}
+	}
+
+	offset, err := bucket.appendRecord(key, payload)
+	if err != nil {
+		return err
+	}
+
+	// Swap in a copy so readers holding the old slice never see it change
+	bucket.IndexLock.Lock()
+	offsets := slices.Clone(bucket.Index[key])
+	offsets[index] = offset
+	bucket.Index[key] = offsets
+	bucket.IndexLock.Unlock()
+
+	if m.Config.SyncMode == "strict" {
+		return bucket.File.Sync()
+	}
+	return nil
+}
+
+// payloadWriter stores encoded entries. It is implemented by Manager, which
+// locks the key's bucket for each call, and by LockedBuckets, whose buckets are
+// already locked.
+type payloadWriter interface {
+	Append(key string, payload []byte) error
+	Replace(key string, index int, payload []byte) error
+}
+
+// LockedBuckets holds the write locks of the buckets of a set of keys, so a
+// group of writes to those keys is not interleaved with other writers.
+type LockedBuckets struct {
+	m   *Manager
+	ids []uint32 // Locked bucket IDs in ascending order
+}
+
+// LockBuckets acquires the write locks of every bucket holding one of keys.
+// Locks are taken in ascending bucket ID order, so concurrent callers cannot
+// deadlock. Call Unlock to release them.
+func (m *Manager) LockBuckets(keys []string) *LockedBuckets {
+	seen := make(map[uint32]bool)
+	lb := &LockedBuckets{m: m}
+	for _, key := range keys {
+		if id := m.getBucketID(key); !seen[id] {
+			seen[id] = true
+			lb.ids = append(lb.ids, id)
+		}
+	}
+	slices.Sort(lb.ids)
+	for _, id := range lb.ids {
+		m.Buckets[id].WriteLock.Lock()
+	}
+	return lb
+}
+
+// Unlock releases the bucket locks in reverse order.
+func (lb *LockedBuckets) Unlock() {
+	for i := len(lb.ids) - 1; i >= 0; i-- {
+		lb.m.Buckets[lb.ids[i]].WriteLock.Unlock()
+	}
+}
+
+// bucket returns the locked bucket of key, or an error if it is not held.
+func (lb *LockedBuckets) bucket(key string) (*Bucket, error) {
+	id := lb.m.getBucketID(key)
+	if _, held := slices.BinarySearch(lb.ids, id); !held {
+		return nil, fmt.Errorf("bucket %d of key %q is not locked", id, key)
+	}
+	return lb.m.Buckets[id], nil
+}
+
+// Append is Manager.Append for a key whose bucket is locked.
+func (lb *LockedBuckets) Append(key string, payload []byte) error {
+	bucket, err := lb.bucket(key)
+	if err != nil {
+		return err
+	}
+	return lb.m.appendLocked(bucket, key, payload)
+}
+
+// Replace is Manager.Replace for a key whose bucket is locked.
+func (lb *LockedBuckets) Replace(key string, index int, payload []byte) error {
+	bucket, err := lb.bucket(key)
+	if err != nil {
+		return err
+	}
+	return lb.m.replaceLocked(bucket, key, index, payload)
+}
+
+// DeleteKey appends a tombstone record for the key and removes it from the
+// in-memory index. The tombstone keeps the key deleted when the index is rebuilt
+// from disk; the data remains on disk until the bucket is compacted.
 func (m *Manager) DeleteKey(key string) error {
 	bucket := m.Buckets[m.getBucketID(key)]
 
+	bucket.WriteLock.Lock()
+	defer bucket.WriteLock.Unlock()
+
+	if err := bucket.appendTombstone(key); err != nil {
+		return err
+	}
+
 	bucket.IndexLock.Lock()
 	delete(bucket.Index, key)
 	bucket.IndexLock.Unlock()
 
+	if m.Config.SyncMode == "strict" {
+		return bucket.File.Sync()
+	}
+	return nil
+}
+
+// appendTombstone writes a deletion record for key at the end of the bucket
+// file. Caller must hold b.WriteLock.
+func (b *Bucket) appendTombstone(key string) error {
+	if _, err := b.File.Seek(0, 2); err != nil {
+		return err
+	}
+	record := make([]byte, 4+len(tombstonePrefix)+len(key)+4) // Payload length stays zero
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(tombstonePrefix)+len(key)))
+	copy(record[4:], tombstonePrefix+key)
+	if _, err := b.File.Write(record); err != nil {
+		return storageWriteError(b.File.Name(), err)
+	}
 	return nil
 }
 
@@ -422,13 +774,15 @@ func (m *Manager) GetKeys() []string {
 
 func (m *Manager) GetAllValues(key string) ([][]byte, error) {
 	bucket := m.Buckets[m.getBucketID(key)]
+	bucket.FileLock.RLock()
+	defer bucket.FileLock.RUnlock()
 
 	bucket.IndexLock.RLock()
 	offsets, exists := bucket.Index[key]
 	bucket.IndexLock.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("key not found")
+		return nil, &types.KeyNotFoundError{Key: key}
 	}
 
 	results := make([][]byte, 0, len(offsets))
@@ -443,164 +797,972 @@ func (m *Manager) GetAllValues(key string) ([][]byte, error) {
 	return results, nil
 }
 
-func (m *Manager) Snapshot(name string) error {
-	snapPath := filepath.Join(m.Config.DataPath, "snapshots", name)
-	if err := os.MkdirAll(snapPath, 0755); err != nil {
-		return err
-	}
+// BucketInfo summarizes a single bucket for diagnostics.
+type BucketInfo struct {
+	ID          uint32 `json:"id"`
+	KeyCount    int    `json:"key_count"`
+	RecordCount int    `json:"record_count"`
+	IndexBytes  int64  `json:"index_bytes"` // Size of the persisted .idx file
+	FileBytes   int64  `json:"file_bytes"`
+}
 
-	for _, b := range m.Buckets {
-		b.WriteLock.Lock() // Pause writes
-		src, err := os.ReadFile(b.FilePath)
-		if err != nil {
-			b.WriteLock.Unlock()
-			return err
+// BucketInfos returns per-bucket record counts and file sizes, ordered by bucket ID.
+func (m *Manager) BucketInfos() []BucketInfo {
+	infos := make([]BucketInfo, 0, len(m.Buckets))
+	for id := uint32(0); id < uint32(len(m.Buckets)); id++ {
+		b := m.Buckets[id]
+		info := BucketInfo{ID: b.ID}
+
+		b.IndexLock.RLock()
+		info.KeyCount = len(b.Index)
+		for _, offsets := range b.Index {
+			info.RecordCount += len(offsets)
 		}
-		b.WriteLock.Unlock() // Resume
+		b.IndexLock.RUnlock()
 
-		dstPath := filepath.Join(snapPath, filepath.Base(b.FilePath))
-		if err := os.WriteFile(dstPath, src, 0644); err != nil {
-			return err
+		if st, err := os.Stat(b.FilePath); err == nil {
+			info.FileBytes = st.Size()
 		}
-		// Also save index
-		idxPath := dstPath + ".idx"
-		// Not implementing index snapshot for brevity, easily rebuilt
-		_ = idxPath
+		if st, err := os.Stat(b.indexFilePath()); err == nil {
+			info.IndexBytes = st.Size()
+		}
+		infos = append(infos, info)
 	}
-	return nil
+	return infos
 }
 
-// ---------------- Helpers ----------------
-
-func (b *Bucket) readRecordAt(offset int64) ([]byte, error) {
-	// Optimistically read a chunk (e.g. 4KB) to avoid multiple syscalls for small records.
-	const bufSize = 4096
-	buf := make([]byte, bufSize)
+// BucketStat describes the size and health of a single bucket file.
+type BucketStat struct {
+	BucketID            uint32  `json:"bucket_id"`
+	FileSizeBytes       int64   `json:"file_size_bytes"`
+	KeyCount            int     `json:"key_count"`
+	RecordCount         int     `json:"record_count"`          // Records reachable from the index
+	AvgRecordSizeBytes  float64 `json:"avg_record_size_bytes"` // Including the record header
+	EstimatedWasteBytes int64   `json:"estimated_waste_bytes"` // File size minus live record sizes
+}
 
-	// ReadAt might return EOF if file is smaller than 4KB or we are at end.
-	n, err := b.File.ReadAt(buf, offset)
-	if err != nil && err != io.EOF {
-		return nil, err
-	}
-	if n < 4 {
-		return nil, fmt.Errorf("record too short (header)")
+// BucketStats returns per-bucket statistics, ordered by bucket ID. Live record
+// sizes are read from each record's header, so this costs a read per record.
+// Records whose header cannot be read count as waste.
+func (m *Manager) BucketStats() []BucketStat {
+	stats := make([]BucketStat, 0, len(m.Buckets))
+	for id := uint32(0); id < uint32(len(m.Buckets)); id++ {
+		stats = append(stats, m.Buckets[id].stat())
 	}
+	return stats
+}
 
-	// 1. Parse KeyLen
-	keyLen := binary.BigEndian.Uint32(buf[0:4])
-
-	// 2. Check if we have Key + PayloadLen header
-	// Header structure: [KeyLen(4)][Key(keyLen)][PayloadLen(4)][Payload...]
-	headerEnd := 4 + int(keyLen) + 4
+func (b *Bucket) stat() BucketStat {
+	b.WriteLock.RLock()
+	defer b.WriteLock.RUnlock()
 
-	if n < headerEnd {
-		// Buffer didn't capture the full header (e.g. huge key).
-		// Fallback: Read specifically the length we need for the rest of header.
-		remainingHeader := make([]byte, headerEnd-n)
-		if _, err := b.File.ReadAt(remainingHeader, offset+int64(n)); err != nil {
-			return nil, err
-		}
-		// Stitch header to parse payloadLen
-		fullHeader := append(buf[:n], remainingHeader...)
-		payloadLen := binary.BigEndian.Uint32(fullHeader[4+keyLen:])
+	st := BucketStat{BucketID: b.ID}
+	if info, err := b.File.Stat(); err == nil {
+		st.FileSizeBytes = info.Size()
+	}
 
-		// Now read payload
-		payload := make([]byte, payloadLen)
-		payloadOffset := offset + int64(headerEnd)
-		if _, err := b.File.ReadAt(payload, payloadOffset); err != nil {
-			return nil, err
+	var liveBytes int64
+	b.IndexLock.RLock()
+	st.KeyCount = len(b.Index)
+	for _, offsets := range b.Index {
+		for _, offset := range offsets {
+			size, err := b.recordSizeAt(offset)
+			if err != nil {
+				continue
+			}
+			st.RecordCount++
+			liveBytes += size
 		}
-		return DecompressBytes(payload)
 	}
+	b.IndexLock.RUnlock()
 
-	// We have the header in buf
-	payloadLen := binary.BigEndian.Uint32(buf[4+keyLen : headerEnd])
-	totalSize := headerEnd + int(payloadLen)
-
-	var payload []byte
-	if n >= totalSize {
-		// We have the full record in buffer
-		payload = buf[headerEnd:totalSize]
-	} else {
-		// We need to read the rest of the payload
-		// We have (n - headerEnd) bytes of payload in buf
-		// We need (payloadLen - (n - headerEnd)) more
-		payload = make([]byte, payloadLen)
-		copy(payload, buf[headerEnd:n])
+	if st.RecordCount > 0 {
+		st.AvgRecordSizeBytes = float64(liveBytes) / float64(st.RecordCount)
+	}
+	st.EstimatedWasteBytes = max(st.FileSizeBytes-liveBytes, 0)
+	return st
+}
 
-		bytesReadSoFar := n - headerEnd
-		remainingPayload := payload[bytesReadSoFar:]
+// CompactionStats reports how much of a bucket file is still referenced by its index.
+type CompactionStats struct {
+	BucketID    uint32  `json:"bucket_id"`
+	LiveBytes   int64   `json:"live_bytes"`   // Bytes of records reachable from the index
+	TotalBytes  int64   `json:"total_bytes"`  // Size of the bucket file
+	WastedRatio float64 `json:"wasted_ratio"` // (TotalBytes - LiveBytes) / TotalBytes
+}
 
-		if _, err := b.File.ReadAt(remainingPayload, offset+int64(n)); err != nil {
-			return nil, err
+// CompactionStats returns per-bucket live and total byte counts, ordered by bucket ID,
+// so callers can decide when compaction is worthwhile.
+func (m *Manager) CompactionStats() ([]CompactionStats, error) {
+	stats := make([]CompactionStats, 0, len(m.Buckets))
+	for id := uint32(0); id < uint32(len(m.Buckets)); id++ {
+		st, err := m.Buckets[id].compactionStats()
+		if err != nil {
+			return nil, fmt.Errorf("bucket %d: %w", id, err)
 		}
+		stats = append(stats, st)
 	}
-
-	return DecompressBytes(payload)
+	return stats, nil
 }
 
-func (b *Bucket) scan(pattern []byte) [][]byte {
+func (b *Bucket) compactionStats() (CompactionStats, error) {
 	b.WriteLock.RLock()
 	defer b.WriteLock.RUnlock()
 
-	var matches [][]byte
-
-	// Naive full scan. Note: mapped index helps finding records,
-	// but global search needs to look at content.
-	// Since we have memory offsets, we can iterate all records.
+	st := CompactionStats{BucketID: b.ID}
+	info, err := b.File.Stat()
+	if err != nil {
+		return st, err
+	}
+	st.TotalBytes = info.Size()
 
 	b.IndexLock.RLock()
 	defer b.IndexLock.RUnlock()
-
-	for key, offsets := range b.Index {
+	for _, offsets := range b.Index {
 		for _, offset := range offsets {
-			val, err := b.readRecordAt(offset)
-			if err == nil {
-				if bytes.Contains(val, pattern) {
-					matches = append(matches, val)
-				}
+			size, err := b.recordSizeAt(offset)
+			if err != nil {
+				return st, fmt.Errorf("offset %d: %w", offset, err)
 			}
+			st.LiveBytes += size
 		}
-		_ = key
 	}
-	return matches
-}
-
-// ---------------- Persistence ----------------
-
-func (b *Bucket) indexFilePath() string {
-	return b.FilePath + ".idx"
+	if st.TotalBytes > 0 {
+		st.WastedRatio = float64(st.TotalBytes-st.LiveBytes) / float64(st.TotalBytes)
+	}
+	return st, nil
 }
 
-func (b *Bucket) saveIndex() error {
+// Compact rewrites every bucket, reclaiming the space held by deleted records.
+func (m *Manager) Compact() error {
+	var errs []string
+	for id := uint32(0); id < uint32(len(m.Buckets)); id++ {
+		if err := m.Buckets[id].Compact(); err != nil {
+			errs = append(errs, fmt.Sprintf("bucket %d: %v", id, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("compaction errors: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Compact writes a new bucket file containing only the records referenced by the
+// index, atomically renames it over the old file and rebuilds the index from it.
+// Tombstones and the records they delete are never in the index, so both are dropped.
+// The write lock is held throughout so no append can race with the rename, and
+// the file lock from the rename until the index matches the new file.
+func (b *Bucket) Compact() error {
+	b.WriteLock.Lock()
+	defer b.WriteLock.Unlock()
+
 	b.IndexLock.RLock()
-	defer b.IndexLock.RUnlock()
+	keys := make([]string, 0, len(b.Index))
+	for k := range b.Index {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	offsets := make([][]int64, len(keys))
+	for i, k := range keys {
+		offsets[i] = slices.Clone(b.Index[k])
+	}
+	b.IndexLock.RUnlock()
 
-	f, err := os.Create(b.indexFilePath())
+	// Write next to the live file so the rename is atomic
+	tmpPath := b.FilePath + ".compact"
+	if err := b.writeLiveRecords(tmpPath, offsets); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	b.FileLock.Lock()
+	defer b.FileLock.Unlock()
+	if err := b.File.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	renameErr := os.Rename(tmpPath, b.FilePath)
+	f, err := os.OpenFile(b.FilePath, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	b.File = f
+	if renameErr != nil {
+		// The old file is still in place and the index still matches it
+		os.Remove(tmpPath)
+		return renameErr
+	}
+
+	if err := b.rebuildIndex(context.Background()); err != nil {
+		return err
+	}
+	return b.saveIndex()
+}
+
+// writeLiveRecords copies the records at offsets, in order, to a new file at path.
+// Caller must hold b.WriteLock.
+func (b *Bucket) writeLiveRecords(path string, offsets [][]int64) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	for _, keyOffsets := range offsets {
+		for _, offset := range keyOffsets {
+			size, err := b.recordSizeAt(offset)
+			if err != nil {
+				return fmt.Errorf("offset %d: %w", offset, err)
+			}
+			if _, err := io.Copy(w, io.NewSectionReader(b.File, offset, size)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// recordSizeAt returns the total on-disk size of the record at offset, including its header.
+func (b *Bucket) recordSizeAt(offset int64) (int64, error) {
+	var lenBuf [4]byte
+	if _, err := b.File.ReadAt(lenBuf[:], offset); err != nil {
+		return 0, err
+	}
+	keyLen := int64(binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := b.File.ReadAt(lenBuf[:], offset+4+keyLen); err != nil {
+		return 0, err
+	}
+	payloadLen := int64(binary.BigEndian.Uint32(lenBuf[:]))
+	return 4 + keyLen + 4 + payloadLen, nil
+}
+
+// Payload size histogram bucket labels, in ascending order.
+var PayloadHistogramBuckets = []string{"0-1KB", "1-10KB", "10-100KB", "100KB-1MB", ">1MB"}
+
+// PayloadStats describes the distribution of stored payload sizes.
+type PayloadStats struct {
+	Histogram              map[string]int64 `json:"histogram"` // Uncompressed payload sizes
+	TotalUncompressedBytes int64            `json:"total_uncompressed_bytes"`
+	TotalCompressedBytes   int64            `json:"total_compressed_bytes"`
+	CompressionRatio       float64          `json:"compression_ratio"` // Uncompressed / compressed
+}
+
+// payloadSizeBucket returns the histogram label for a payload of n bytes.
+func payloadSizeBucket(n int64) string {
+	switch {
+	case n < 1<<10:
+		return "0-1KB"
+	case n < 10<<10:
+		return "1-10KB"
+	case n < 100<<10:
+		return "10-100KB"
+	case n < 1<<20:
+		return "100KB-1MB"
+	default:
+		return ">1MB"
+	}
+}
+
+// PayloadHistogram scans every live record and returns a histogram of
+// uncompressed payload sizes.
+func (m *Manager) PayloadHistogram() map[string]int64 {
+	stats, _ := m.PayloadStats(context.Background())
+	return stats.Histogram
+}
+
+// PayloadStats scans every live record in all buckets. The scan is O(n) in
+// the record count and stops early with ctx.Err() when ctx is cancelled.
+func (m *Manager) PayloadStats(ctx context.Context) (*PayloadStats, error) {
+	stats := &PayloadStats{Histogram: make(map[string]int64, len(PayloadHistogramBuckets))}
+	for _, label := range PayloadHistogramBuckets {
+		stats.Histogram[label] = 0
+	}
+
+	for id := uint32(0); id < uint32(len(m.Buckets)); id++ {
+		if err := m.Buckets[id].addPayloadStats(ctx, stats); err != nil {
+			return stats, err
+		}
+	}
+
+	if stats.TotalCompressedBytes > 0 {
+		stats.CompressionRatio = float64(stats.TotalUncompressedBytes) / float64(stats.TotalCompressedBytes)
+	}
+	return stats, nil
+}
+
+// addPayloadStats adds the payload sizes of the live records of the bucket
+// to stats.
+func (b *Bucket) addPayloadStats(ctx context.Context, stats *PayloadStats) error {
+	b.FileLock.RLock()
+	defer b.FileLock.RUnlock()
+
+	b.IndexLock.RLock()
+	var offsets []int64
+	for _, offs := range b.Index {
+		offsets = append(offsets, offs...)
+	}
+	b.IndexLock.RUnlock()
+
+	for i, offset := range offsets {
+		if i%256 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		compressed, uncompressed, err := b.payloadSizesAt(offset)
+		if err != nil {
+			return fmt.Errorf("bucket %d offset %d: %w", b.ID, offset, err)
+		}
+		stats.Histogram[payloadSizeBucket(uncompressed)]++
+		stats.TotalCompressedBytes += compressed
+		stats.TotalUncompressedBytes += uncompressed
+	}
+	return nil
+}
+
+// payloadSizesAt returns the on-disk and uncompressed sizes of the payload of the record at offset.
+func (b *Bucket) payloadSizesAt(offset int64) (int64, int64, error) {
+	var lenBuf [4]byte
+	if _, err := b.File.ReadAt(lenBuf[:], offset); err != nil {
+		return 0, 0, err
+	}
+	keyLen := int64(binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := b.File.ReadAt(lenBuf[:], offset+4+keyLen); err != nil {
+		return 0, 0, err
+	}
+	payloadLen := int64(binary.BigEndian.Uint32(lenBuf[:]))
+
+	payload := make([]byte, payloadLen)
+	if _, err := b.File.ReadAt(payload, offset+4+keyLen+4); err != nil {
+		return 0, 0, err
+	}
+
+	// Read the size from the zstd frame header when present to avoid decompressing
+	var header zstd.Header
+	if err := header.Decode(payload); err == nil && header.HasFCS {
+		return payloadLen, int64(header.FrameContentSize), nil
+	}
+	raw, err := DecompressBytes(payload)
+	if err != nil {
+		return 0, 0, err
+	}
+	return payloadLen, int64(len(raw)), nil
+}
+
+// SnapshotStats describes how a snapshot was taken.
+type SnapshotStats struct {
+	Method     string // "hardlink" or "copy" ("copy" if any file had to be copied)
+	TotalBytes int64
+	Duration   time.Duration
+}
+
+// Snapshot writes the bucket files to snapshots/<name> under the data path.
+// Files are hard-linked when the snapshot directory is on the same filesystem,
+// falling back to a byte copy otherwise. The length of each file is recorded,
+// so records appended later through a hard link are ignored by RestoreSnapshot.
+// VectorManager.Snapshot adds the collection indexes and the WAL.
+func (m *Manager) Snapshot(name string) (*SnapshotStats, error) {
+	start := time.Now()
+	snapPath := filepath.Join(m.Config.DataPath, "snapshots", name)
+	if err := os.MkdirAll(snapPath, 0755); err != nil {
+		return nil, err
+	}
+
+	stats := &SnapshotStats{Method: "hardlink"}
+	meta := &snapshotMeta{Name: name, CreatedAt: start, Sizes: make(map[string]int64), PartitionCount: m.PartitionCount}
+	for _, b := range m.Buckets {
+		dstPath := filepath.Join(snapPath, filepath.Base(b.FilePath))
+
+		b.WriteLock.Lock() // Pause writes
+		info, err := b.File.Stat()
+		if err == nil {
+			var method string
+			method, err = linkOrCopy(b.FilePath, dstPath)
+			if method == "copy" {
+				stats.Method = "copy"
+			}
+		}
+		b.WriteLock.Unlock() // Resume
+		if err != nil {
+			return nil, err
+		}
+
+		stats.TotalBytes += info.Size()
+		meta.Files = append(meta.Files, filepath.Base(dstPath))
+		meta.Sizes[filepath.Base(dstPath)] = info.Size()
+	}
+	if err := writeSnapshotMeta(snapPath, meta); err != nil {
+		return nil, err
+	}
+	stats.Duration = time.Since(start)
+	return stats, nil
+}
+
+// RestoreSnapshot replaces the live bucket files with those of a snapshot
+// taken by Snapshot or CompressedSnapshot and rebuilds the bucket indexes.
+// The write and file locks of all buckets are held until every bucket is
+// restored, so reads wait for the restore to finish.
+func (m *Manager) RestoreSnapshot(name string) error {
+	snapPath := filepath.Join(m.Config.DataPath, "snapshots", name)
+	meta, err := readSnapshotMeta(snapPath)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot meta: %w", err)
+	}
+	return m.restoreBuckets(snapPath, meta)
+}
+
+// restoreBuckets restores every bucket from the snapshot in snapPath.
+func (m *Manager) restoreBuckets(snapPath string, meta *snapshotMeta) error {
+	if len(meta.Files) == 0 {
+		return fmt.Errorf("snapshot %q holds no bucket files", meta.Name)
+	}
+	if count := cmp.Or(meta.PartitionCount, DefaultPartitionCount); count != m.PartitionCount {
+		return fmt.Errorf("snapshot %q has %d partitions, the database %d", meta.Name, count, m.PartitionCount)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]uint32, 0, len(m.Buckets))
+	for id := range m.Buckets {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		m.Buckets[id].WriteLock.Lock()
+		defer m.Buckets[id].WriteLock.Unlock()
+		m.Buckets[id].FileLock.Lock()
+		defer m.Buckets[id].FileLock.Unlock()
+	}
+
+	for _, id := range ids {
+		b := m.Buckets[id]
+		name := filepath.Base(b.FilePath)
+		src := filepath.Join(snapPath, name)
+		if meta.Compressed {
+			src += ".gz"
+		}
+		size, ok := meta.Sizes[name]
+		if !ok {
+			size = -1 // Snapshots from older versions hold whole files
+		}
+		if err := b.restoreFrom(src, size, meta.Compressed); err != nil {
+			return fmt.Errorf("bucket %d: %w", b.ID, err)
+		}
+	}
+	return nil
+}
+
+// snapshotMetaFile describes the contents of a snapshot directory.
+const snapshotMetaFile = "snapshot_meta.json"
+
+type snapshotMeta struct {
+	Name       string           `json:"name"`
+	Compressed bool             `json:"compressed"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Files      []string         `json:"files"`
+	Sizes      map[string]int64 `json:"sizes,omitempty"` // Bucket file lengths at snapshot time
+
+	// PartitionCount is the number of buckets of the snapshotted Manager;
+	// zero in snapshots from older versions, which had DefaultPartitionCount.
+	PartitionCount uint32 `json:"partition_count,omitempty"`
+
+	// Set by VectorManager snapshots
+	Collections []string `json:"collections,omitempty"` // Copied to indexes/<name>
+	WAL         string   `json:"wal,omitempty"`
+}
+
+func writeSnapshotMeta(dir string, meta *snapshotMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, snapshotMetaFile), data, 0644)
+}
+
+func readSnapshotMeta(dir string) (*snapshotMeta, error) {
+	data, err := os.ReadFile(filepath.Join(dir, snapshotMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	var meta snapshotMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// CompressedSnapshot writes gzip-compressed copies of the bucket files
+// (suffix .gz) to snapshots/<name> under the data path.
+func (m *Manager) CompressedSnapshot(name string) error {
+	snapPath := filepath.Join(m.Config.DataPath, "snapshots", name)
+	if err := os.MkdirAll(snapPath, 0755); err != nil {
+		return err
+	}
+
+	meta := &snapshotMeta{Name: name, Compressed: true, CreatedAt: time.Now(), PartitionCount: m.PartitionCount}
+	for _, b := range m.Buckets {
+		dstName := filepath.Base(b.FilePath) + ".gz"
+
+		b.WriteLock.Lock() // Pause writes
+		err := gzipFile(b.FilePath, filepath.Join(snapPath, dstName))
+		b.WriteLock.Unlock() // Resume
+		if err != nil {
+			return fmt.Errorf("bucket %d: %w", b.ID, err)
+		}
+		meta.Files = append(meta.Files, dstName)
+	}
+	return writeSnapshotMeta(snapPath, meta)
+}
+
+// RestoreCompressedSnapshot replaces the live bucket files with the contents of
+// a compressed snapshot and rebuilds the bucket indexes. Reads wait for the
+// restore to finish.
+func (m *Manager) RestoreCompressedSnapshot(name string) error {
+	snapPath := filepath.Join(m.Config.DataPath, "snapshots", name)
+	meta, err := readSnapshotMeta(snapPath)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot meta: %w", err)
+	}
+	if !meta.Compressed {
+		return fmt.Errorf("snapshot %q is not compressed", name)
+	}
+
+	return m.restoreBuckets(snapPath, meta)
+}
+
+// restoreFrom replaces the bucket file with the first size bytes of srcPath
+// (all of it if size is negative), or with its decompressed contents.
+// Caller must hold b.WriteLock and b.FileLock.
+func (b *Bucket) restoreFrom(srcPath string, size int64, compressed bool) error {
+	// Write next to the live file so the rename is atomic
+	tmpPath := b.FilePath + ".restore"
+	var err error
+	if compressed {
+		err = gunzipFile(srcPath, tmpPath)
+	} else {
+		err = copyFilePrefix(srcPath, tmpPath, size)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := b.File.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, b.FilePath); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(b.FilePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	b.File = f
+
+	if err := b.rebuildIndex(context.Background()); err != nil {
+		return err
+	}
+	return b.saveIndex()
+}
+
+// gzipFile writes a gzip-compressed copy of src to dst.
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	zw, err := gzip.NewWriterLevel(out, gzip.BestSpeed)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// gunzipFile decompresses the gzip file src into dst.
+func gunzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, zr); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ---------------- Helpers ----------------
+
+// copyFilePrefix copies the first n bytes of src to dst, or all of src if n
+// is negative.
+func copyFilePrefix(src, dst string, n int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	var r io.Reader = in
+	if n >= 0 {
+		r = io.LimitReader(in, n)
+	}
+	copied, err := io.Copy(out, r)
+	if err == nil && n >= 0 && copied != n {
+		err = fmt.Errorf("%s is truncated: %d of %d bytes", src, copied, n)
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// linkOrCopy hard-links src to dst, falling back to a byte copy when linking
+// is not possible (cross-device or not permitted). Returns the method used.
+// Note: a hard link shares the inode with the live file, so later appends and
+// in-place updates are visible through the snapshot until it is copied away.
+func linkOrCopy(src, dst string) (string, error) {
+	os.Remove(dst) // Link fails if dst exists
+
+	err := os.Link(src, dst)
+	if err == nil {
+		return "hardlink", nil
+	}
+	if !errors.Is(err, syscall.EXDEV) && !errors.Is(err, syscall.EPERM) {
+		return "", err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
 
-	enc := gob.NewEncoder(f)
-	return enc.Encode(b.Index)
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return "", err
+	}
+	return "copy", out.Close()
+}
+
+// recordPayloadAt reads the header of the record stored at offset. A
+// compressed payload that fits in the first read is returned as a slice;
+// larger ones are returned as a reader over the bucket file, so they are
+// never buffered whole.
+func (b *Bucket) recordPayloadAt(offset int64) ([]byte, *io.SectionReader, error) {
+	// Optimistically read a chunk (e.g. 4KB) to avoid multiple syscalls for small records.
+	const bufSize = 4096
+	buf := make([]byte, bufSize)
+
+	// ReadAt might return EOF if file is smaller than 4KB or we are at end.
+	n, err := b.File.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if n < 4 {
+		return nil, nil, fmt.Errorf("record too short (header)")
+	}
+
+	// Header structure: [KeyLen(4)][Key(keyLen)][PayloadLen(4)][Payload...]
+	keyLen := binary.BigEndian.Uint32(buf[0:4])
+	headerEnd := 4 + int64(keyLen) + 4
+
+	var payloadLen uint32
+	if int64(n) >= headerEnd {
+		payloadLen = binary.BigEndian.Uint32(buf[headerEnd-4 : headerEnd])
+	} else {
+		// Buffer didn't capture the full header (e.g. huge key)
+		lenBuf := make([]byte, 4)
+		if _, err := b.File.ReadAt(lenBuf, offset+headerEnd-4); err != nil {
+			return nil, nil, err
+		}
+		payloadLen = binary.BigEndian.Uint32(lenBuf)
+	}
+
+	if end := headerEnd + int64(payloadLen); int64(n) >= end {
+		return buf[headerEnd:end], nil, nil
+	}
+	return nil, io.NewSectionReader(b.File, offset+headerEnd, int64(payloadLen)), nil
+}
+
+// readRecordAt reads and decompresses the payload of the record stored at
+// offset.
+func (b *Bucket) readRecordAt(offset int64) ([]byte, error) {
+	payload, section, err := b.recordPayloadAt(offset)
+	if err != nil {
+		return nil, err
+	}
+	if section != nil {
+		payload = make([]byte, section.Size())
+		if _, err := io.ReadFull(section, payload); err != nil {
+			return nil, err
+		}
+	}
+	return DecompressBytes(payload)
+}
+
+// readEntryAt reads and decodes the entry stored at offset with
+// DecodeEntryStream. Records larger than the initial read buffer are
+// streamed through the decompressor, so the compressed and decoded payloads
+// are never both held in full.
+func (b *Bucket) readEntryAt(offset int64) (*Entry, error) {
+	payload, section, err := b.recordPayloadAt(offset)
+	if err != nil {
+		return nil, err
+	}
+	if section == nil {
+		data, err := DecompressBytes(payload)
+		if err != nil {
+			return nil, err
+		}
+		return DecodeEntryStream(bytes.NewReader(data))
+	}
+
+	dec, err := zstd.NewReader(section)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	return DecodeEntryStream(dec)
+}
+
+func (b *Bucket) scan(pattern []byte) [][]byte {
+	b.WriteLock.RLock()
+	defer b.WriteLock.RUnlock()
+
+	var matches [][]byte
+
+	// Naive full scan. Note: mapped index helps finding records,
+	// but global search needs to look at content.
+	// Since we have memory offsets, we can iterate all records.
+
+	b.IndexLock.RLock()
+	defer b.IndexLock.RUnlock()
+
+	for key, offsets := range b.Index {
+		for _, offset := range offsets {
+			val, err := b.readRecordAt(offset)
+			if err == nil {
+				if bytes.Contains(val, pattern) {
+					matches = append(matches, val)
+				}
+			}
+		}
+		_ = key
+	}
+	return matches
+}
+
+// ---------------- Persistence ----------------
+
+func (b *Bucket) indexFilePath() string {
+	return b.FilePath + ".idx"
+}
+
+// Bucket index (.idx) binary format:
+// [Magic(4)][Count(8)] followed by Count entries sorted by key:
+// [KeyLen(2)][Key][OffsetCount(4)][Offset(8)]...
+// Files without the magic are legacy GOB-encoded maps and are migrated on load.
+const bucketIndexMagic = "IDXI"
+
+func (b *Bucket) saveIndex() error {
+	b.IndexLock.RLock()
+	defer b.IndexLock.RUnlock()
+	return writeIndexFile(b.indexFilePath(), b.Index)
 }
 
 func (b *Bucket) loadIndex() error {
-	f, err := os.Open(b.indexFilePath())
+	binaryFormat, err := isBinaryIndex(b.indexFilePath())
+	if err != nil {
+		return err
+	}
+	if !binaryFormat {
+		logger.Info("Bucket %d: Migrating index from gob to binary format", b.ID)
+		if err := b.MigrateIndex(); err != nil {
+			return fmt.Errorf("index migration failed: %w", err)
+		}
+	}
+
+	index, err := readIndexFile(b.indexFilePath())
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
 	b.IndexLock.Lock()
 	defer b.IndexLock.Unlock()
+	b.Index = index
+	return nil
+}
+
+// MigrateIndex rewrites a legacy gob-encoded index file in the binary format.
+// The new file is written alongside and renamed over the old one. Files already
+// in the binary format are left untouched.
+func (b *Bucket) MigrateIndex() error {
+	path := b.indexFilePath()
+	binaryFormat, err := isBinaryIndex(path)
+	if err != nil || binaryFormat {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	var index map[string][]int64
+	err = gob.NewDecoder(bufio.NewReader(f)).Decode(&index)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode gob index: %w", err)
+	}
+
+	return writeIndexFile(path, index)
+}
+
+// isBinaryIndex reports whether the index file at path starts with bucketIndexMagic.
+func isBinaryIndex(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(bucketIndexMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil // Too short for either format; gob decode reports the error
+		}
+		return false, err
+	}
+	return string(magic) == bucketIndexMagic, nil
+}
+
+// writeIndexFile writes index in the binary format, replacing the file at
+// path atomically.
+func writeIndexFile(path string, index map[string][]int64) error {
+	keys := make([]string, 0, len(index))
+	for key := range index {
+		if len(key) > MaxKeyLength {
+			return fmt.Errorf("key exceeds maximum length of %d bytes", MaxKeyLength)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// bufio.Writer keeps the first write error, which writeFileAtomic returns from Flush
+	return writeFileAtomic(path, func(w *bufio.Writer) error {
+		header := make([]byte, 12)
+		copy(header[0:4], bucketIndexMagic)
+		binary.BigEndian.PutUint64(header[4:12], uint64(len(keys)))
+		w.Write(header)
+
+		buf := make([]byte, 8)
+		for _, key := range keys {
+			offsets := index[key]
+			binary.BigEndian.PutUint16(buf[0:2], uint16(len(key)))
+			w.Write(buf[0:2])
+			w.WriteString(key)
+			binary.BigEndian.PutUint32(buf[0:4], uint32(len(offsets)))
+			w.Write(buf[0:4])
+			for _, off := range offsets {
+				binary.BigEndian.PutUint64(buf, uint64(off))
+				w.Write(buf)
+			}
+		}
+		return nil
+	})
+}
+
+// readIndexFile reads a binary-format index file.
+func readIndexFile(path string) (map[string][]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, &types.IndexCorruptedError{Path: path, Err: fmt.Errorf("failed to read index header: %w", err)}
+	}
+	if string(header[0:4]) != bucketIndexMagic {
+		return nil, &types.IndexCorruptedError{Path: path, Err: errors.New("wrong magic number")}
+	}
+	count := binary.BigEndian.Uint64(header[4:12])
 
-	dec := gob.NewDecoder(f)
-	return dec.Decode(&b.Index)
+	index := make(map[string][]int64)
+	buf := make([]byte, 8)
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(r, buf[0:2]); err != nil {
+			return nil, &types.IndexCorruptedError{Path: path, Err: fmt.Errorf("truncated at entry %d: %w", i, err)}
+		}
+		key := make([]byte, binary.BigEndian.Uint16(buf[0:2]))
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, &types.IndexCorruptedError{Path: path, Err: fmt.Errorf("truncated at entry %d: %w", i, err)}
+		}
+		if _, err := io.ReadFull(r, buf[0:4]); err != nil {
+			return nil, &types.IndexCorruptedError{Path: path, Err: fmt.Errorf("truncated at entry %d: %w", i, err)}
+		}
+		offsets := make([]int64, binary.BigEndian.Uint32(buf[0:4]))
+		for j := range offsets {
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, &types.IndexCorruptedError{Path: path, Err: fmt.Errorf("truncated at entry %d: %w", i, err)}
+			}
+			offsets[j] = int64(binary.BigEndian.Uint64(buf))
+		}
+		index[string(key)] = offsets
+	}
+	return index, nil
 }
 
-func (b *Bucket) rebuildIndex() {
+// rebuildIndex rebuilds the index of the bucket by scanning its file. A
+// truncated record at the end of the file ends the scan. It stops early with
+// ctx.Err() when ctx is cancelled, leaving the index incomplete.
+func (b *Bucket) rebuildIndex(ctx context.Context) error {
+	start := time.Now()
 	b.IndexLock.Lock()
 	defer b.IndexLock.Unlock()
 
@@ -615,6 +1777,12 @@ func (b *Bucket) rebuildIndex() {
 
 	var count int
 	for offset < fileSize {
+		if count%256 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
 		// Read Key Len
 		header := make([]byte, 4)
 		if _, err := io.ReadFull(b.File, header); err != nil {
@@ -644,9 +1812,13 @@ func (b *Bucket) rebuildIndex() {
 			break
 		}
 
-		// Record Index
-		b.Index[key] = append(b.Index[key], offset)
-		count++
+		// Record Index; a tombstone drops every earlier record of its key
+		if deleted, ok := strings.CutPrefix(key, tombstonePrefix); ok {
+			delete(b.Index, deleted)
+		} else {
+			b.Index[key] = append(b.Index[key], offset)
+			count++
+		}
 
 		if strings.Contains(key, "cycle") {
 			// logger.Info("Bucket %d: Found cycle key at offset %d", b.ID, offset)
@@ -655,5 +1827,7 @@ func (b *Bucket) rebuildIndex() {
 		// Next Offset
 		offset, _ = b.File.Seek(0, 1)
 	}
-	logger.Info("Bucket %d: Rebuilt index with %d keys and %d records", b.ID, len(b.Index), count)
+	logger.InfoAttrs("bucket index rebuilt", "bucket", b.ID, "path", b.File.Name(), "keys", len(b.Index),
+		"records", count, "bytes", fileSize, "duration_ms", logger.Since(start))
+	return nil
 }
@@ -0,0 +1,636 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func newTestManager(t *testing.T, dataPath string) *Manager {
+	t.Helper()
+	mgr, err := NewManager(&types.DBSchemaConfig{DataPath: dataPath, SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	return mgr
+}
+
+func TestManager_SnapshotUsesHardLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	mgr := newTestManager(t, tmpDir)
+	defer mgr.Close()
+
+	if err := mgr.Append("key1", []byte("payload")); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	stats, err := mgr.Snapshot("snap1")
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if stats.Method != "hardlink" {
+		t.Errorf("Expected hardlink method, got %s", stats.Method)
+	}
+
+	for _, b := range mgr.Buckets {
+		srcInfo, err := os.Stat(b.FilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstInfo, err := os.Stat(filepath.Join(tmpDir, "snapshots", "snap1", filepath.Base(b.FilePath)))
+		if err != nil {
+			t.Fatalf("Snapshot file missing: %v", err)
+		}
+		if !os.SameFile(srcInfo, dstInfo) {
+			t.Errorf("Bucket %d snapshot is not a hard link", b.ID)
+		}
+	}
+}
+
+func TestManager_CompressedSnapshotRestore(t *testing.T) {
+	srcDir := t.TempDir()
+	mgr := newTestManager(t, srcDir)
+	defer mgr.Close()
+
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("document-key-%05d", i)
+		if err := mgr.Append(key, []byte(fmt.Sprintf("payload for %s", key))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	if err := mgr.CompressedSnapshot("snap1"); err != nil {
+		t.Fatalf("CompressedSnapshot failed: %v", err)
+	}
+
+	snapDir := filepath.Join(srcDir, "snapshots", "snap1")
+	for _, b := range mgr.Buckets {
+		srcInfo, err := os.Stat(b.FilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gzInfo, err := os.Stat(filepath.Join(snapDir, filepath.Base(b.FilePath)+".gz"))
+		if err != nil {
+			t.Fatalf("Compressed snapshot file missing: %v", err)
+		}
+		if gzInfo.Size() >= srcInfo.Size() {
+			t.Errorf("Bucket %d: compressed size %d not smaller than original %d", b.ID, gzInfo.Size(), srcInfo.Size())
+		}
+	}
+
+	// Restore into a fresh data directory
+	dstDir := t.TempDir()
+	if err := os.CopyFS(filepath.Join(dstDir, "snapshots", "snap1"), os.DirFS(snapDir)); err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestManager(t, dstDir)
+	defer restored.Close()
+
+	if err := restored.RestoreCompressedSnapshot("snap1"); err != nil {
+		t.Fatalf("RestoreCompressedSnapshot failed: %v", err)
+	}
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("document-key-%05d", i)
+		val, err := restored.Get(key, 0)
+		if err != nil {
+			t.Fatalf("Get(%s) after restore failed: %v", key, err)
+		}
+		if want := fmt.Sprintf("payload for %s", key); string(val) != want {
+			t.Errorf("Get(%s) = %q, want %q", key, val, want)
+		}
+	}
+
+	// Uncompressed snapshots are rejected
+	if _, err := restored.Snapshot("plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.RestoreCompressedSnapshot("plain"); err == nil {
+		t.Error("Expected error restoring an uncompressed snapshot")
+	}
+}
+
+func TestManager_GetEntryStreamsLargeRecords(t *testing.T) {
+	mgr := newTestManager(t, t.TempDir())
+	defer mgr.Close()
+
+	// Random bytes do not compress, so the large record exceeds the first read
+	rng := rand.New(rand.NewSource(1))
+	large := make([]byte, 64*1024)
+	rng.Read(large)
+	for _, want := range []*Entry{
+		{Key: []byte("small"), Keywords: []string{"a"}, PrimaryData: []byte("data")},
+		{Key: []byte("large"), Keywords: []string{}, PrimaryData: large, Version: 3},
+	} {
+		encoded, err := EncodeEntry(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := mgr.Append(string(want.Key), encoded); err != nil {
+			t.Fatal(err)
+		}
+		got, err := mgr.GetEntry(string(want.Key), 0)
+		if err != nil {
+			t.Fatalf("GetEntry(%s): %v", want.Key, err)
+		}
+		if !bytes.Equal(got.PrimaryData, want.PrimaryData) || got.Version != want.Version {
+			t.Errorf("GetEntry(%s) returned a different entry", want.Key)
+		}
+		raw, err := mgr.Get(string(want.Key), 0)
+		if err != nil || !bytes.Equal(raw, encoded) {
+			t.Errorf("Get(%s) = %d bytes, %v, want the encoded entry", want.Key, len(raw), err)
+		}
+	}
+}
+
+func TestManager_PayloadHistogram(t *testing.T) {
+	mgr := newTestManager(t, t.TempDir())
+	defer mgr.Close()
+
+	sizes := map[string]int{
+		"tiny":   100,
+		"small":  5 << 10,
+		"medium": 50 << 10,
+		"large":  500 << 10,
+		"huge":   2 << 20,
+	}
+	for key, size := range sizes {
+		if err := mgr.Append(key, bytes.Repeat([]byte("x"), size)); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if err := mgr.Append("tiny", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	hist := mgr.PayloadHistogram()
+	want := map[string]int64{"0-1KB": 2, "1-10KB": 1, "10-100KB": 1, "100KB-1MB": 1, ">1MB": 1}
+	for label, count := range want {
+		if hist[label] != count {
+			t.Errorf("Histogram[%s] = %d, want %d", label, hist[label], count)
+		}
+	}
+
+	stats, err := mgr.PayloadStats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64 = int64(len("second"))
+	for _, size := range sizes {
+		total += int64(size)
+	}
+	if stats.TotalUncompressedBytes != total {
+		t.Errorf("TotalUncompressedBytes = %d, want %d", stats.TotalUncompressedBytes, total)
+	}
+	if stats.CompressionRatio <= 1 {
+		t.Errorf("Expected repetitive payloads to compress, ratio %f", stats.CompressionRatio)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := mgr.PayloadStats(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestBucket_MigrateIndexFromGob(t *testing.T) {
+	b := &Bucket{ID: 0, FilePath: filepath.Join(t.TempDir(), "waddle_shard_000.db")}
+	legacy := map[string][]int64{
+		"zeta":  {0},
+		"alpha": {10, 250, 4096},
+		"mid":   {1 << 40},
+	}
+	f, err := os.Create(b.indexFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gob.NewEncoder(f).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if err := b.MigrateIndex(); err != nil {
+		t.Fatalf("MigrateIndex failed: %v", err)
+	}
+	data, err := os.ReadFile(b.indexFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(bucketIndexMagic)) {
+		t.Fatalf("Migrated index does not start with %q", bucketIndexMagic)
+	}
+	// Migrating an already-binary index is a no-op
+	if err := b.MigrateIndex(); err != nil {
+		t.Fatalf("Second MigrateIndex failed: %v", err)
+	}
+
+	if err := b.loadIndex(); err != nil {
+		t.Fatalf("loadIndex failed: %v", err)
+	}
+	if !reflect.DeepEqual(b.Index, legacy) {
+		t.Errorf("Loaded index %v, want %v", b.Index, legacy)
+	}
+
+	// A truncated binary index is reported rather than partially loaded
+	if err := os.WriteFile(b.indexFilePath(), data[:len(data)-3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.loadIndex(); !errors.Is(err, types.ErrIndexCorrupted) {
+		t.Errorf("Expected a corrupted index error loading a truncated index, got %v", err)
+	}
+}
+
+func TestManager_LoadsLegacyGobIndex(t *testing.T) {
+	dataPath := t.TempDir()
+	mgr := newTestManager(t, dataPath)
+	if err := mgr.Append("key1", []byte("value1")); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	bucket := mgr.Buckets[mgr.getBucketID("key1")]
+	bucket.IndexLock.RLock()
+	legacy := maps.Clone(bucket.Index)
+	bucket.IndexLock.RUnlock()
+	mgr.Close()
+
+	// Rewrite the index as an older release would have saved it
+	f, err := os.Create(bucket.indexFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gob.NewEncoder(f).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	mgr = newTestManager(t, dataPath)
+	defer mgr.Close()
+	if binaryFormat, err := isBinaryIndex(bucket.indexFilePath()); err != nil || !binaryFormat {
+		t.Errorf("Expected index migrated to binary format on startup (err: %v)", err)
+	}
+	val, err := mgr.Get("key1", 0)
+	if err != nil || string(val) != "value1" {
+		t.Errorf("Get after migration = %q, %v", val, err)
+	}
+}
+
+func TestManager_DeleteSurvivesIndexRebuild(t *testing.T) {
+	dataPath := t.TempDir()
+	mgr := newTestManager(t, dataPath)
+
+	for _, key := range []string{"gone", "kept", "readded"} {
+		for i := 0; i < 2; i++ {
+			if err := mgr.Append(key, []byte(fmt.Sprintf("%s-%d", key, i))); err != nil {
+				t.Fatalf("Append failed: %v", err)
+			}
+		}
+	}
+	mgr.DeleteKey("gone")
+	mgr.DeleteKey("readded")
+	if err := mgr.Append("readded", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the saved indexes so reopening rebuilds them from the bucket files
+	idxFiles, _ := filepath.Glob(filepath.Join(dataPath, "data", "*.idx"))
+	for _, f := range idxFiles {
+		os.Remove(f)
+	}
+
+	reopened := newTestManager(t, dataPath)
+	defer reopened.Close()
+	if n := reopened.GetLength("gone"); n != 0 {
+		t.Errorf("Expected deleted key to stay deleted after rebuild, got %d records", n)
+	}
+	if n := reopened.GetLength("kept"); n != 2 {
+		t.Errorf("Expected 2 records for kept, got %d", n)
+	}
+	if n := reopened.GetLength("readded"); n != 1 {
+		t.Fatalf("Expected only the record appended after the delete, got %d", n)
+	}
+	if got, err := reopened.Get("readded", 0); err != nil || string(got) != "new" {
+		t.Errorf("Get(readded) = %q, %v", got, err)
+	}
+	for _, key := range reopened.GetKeys() {
+		if strings.HasPrefix(key, tombstonePrefix) {
+			t.Errorf("Tombstone %q leaked into the index", key)
+		}
+	}
+
+	// Compaction drops the tombstones along with the deleted records
+	if err := reopened.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	stats, err := reopened.CompactionStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range stats {
+		if st.TotalBytes != st.LiveBytes {
+			t.Errorf("Bucket %d keeps %d dead bytes after compaction", st.BucketID, st.TotalBytes-st.LiveBytes)
+		}
+	}
+}
+
+func TestManager_ReadsDuringRestore(t *testing.T) {
+	mgr := newTestManager(t, t.TempDir())
+	defer mgr.Close()
+
+	const n = 200
+	for i := 0; i < n; i++ {
+		if err := mgr.Append(fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("value %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := mgr.Snapshot("snap1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every restore and compaction swaps the bucket files under the readers
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i = (i + 1) % n {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := fmt.Sprintf("key-%d", i)
+				val, err := mgr.Get(key, 0)
+				if err == nil && string(val) != fmt.Sprintf("value %d", i) {
+					err = fmt.Errorf("Get(%s) = %q", key, val)
+				}
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := mgr.RestoreSnapshot("snap1"); err != nil {
+			t.Fatalf("RestoreSnapshot failed: %v", err)
+		}
+		if err := mgr.Compact(); err != nil {
+			t.Fatalf("Compact failed: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		t.Fatalf("Read during restore failed: %v", err)
+	default:
+	}
+}
+
+func TestManager_CompactReclaimsDeletedRecords(t *testing.T) {
+	dataPath := t.TempDir()
+	mgr := newTestManager(t, dataPath)
+
+	for i := 0; i < 200; i++ {
+		payload := []byte(fmt.Sprintf("payload-%d-%s", i, bytes.Repeat([]byte{byte(i)}, 256)))
+		if err := mgr.Append(fmt.Sprintf("key-%d", i), payload); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if err := mgr.Append("key-1", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i += 2 {
+		mgr.DeleteKey(fmt.Sprintf("key-%d", i))
+	}
+
+	before, err := mgr.CompactionStats()
+	if err != nil {
+		t.Fatalf("CompactionStats failed: %v", err)
+	}
+	var wasted int64
+	for _, st := range before {
+		wasted += st.TotalBytes - st.LiveBytes
+	}
+	if wasted == 0 {
+		t.Fatal("Expected deleted records to show up as wasted bytes")
+	}
+
+	if err := mgr.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	after, err := mgr.CompactionStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, st := range after {
+		if st.TotalBytes != st.LiveBytes || st.WastedRatio != 0 {
+			t.Errorf("Bucket %d still wastes space after compaction: %+v", st.BucketID, st)
+		}
+		if st.TotalBytes != before[i].LiveBytes {
+			t.Errorf("Bucket %d: size %d, want %d live bytes", st.BucketID, st.TotalBytes, before[i].LiveBytes)
+		}
+	}
+
+	check := func(m *Manager) {
+		t.Helper()
+		if _, err := m.Get("key-0", 0); err == nil {
+			t.Error("Expected deleted key to stay deleted")
+		}
+		want := fmt.Sprintf("payload-3-%s", bytes.Repeat([]byte{3}, 256))
+		if got, err := m.Get("key-3", 0); err != nil || string(got) != want {
+			t.Errorf("Get(key-3) = %q, %v", got, err)
+		}
+		if got, err := m.Get("key-1", 1); err != nil || string(got) != "second" {
+			t.Errorf("Get(key-1, 1) = %q, %v", got, err)
+		}
+	}
+	check(mgr)
+
+	// Appends after compaction land at the end of the new file
+	if err := mgr.Append("key-new", []byte("fresh")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := newTestManager(t, dataPath)
+	defer reopened.Close()
+	check(reopened)
+	if got, err := reopened.Get("key-new", 0); err != nil || string(got) != "fresh" {
+		t.Errorf("Get(key-new) = %q, %v", got, err)
+	}
+}
+
+func TestManager_BucketStats(t *testing.T) {
+	mgr := newTestManager(t, t.TempDir())
+	defer mgr.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := mgr.Append(fmt.Sprintf("key-%d", i), bytes.Repeat([]byte{'x'}, 100)); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if err := mgr.Append("key-1", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys, records int
+	for _, st := range mgr.BucketStats() {
+		keys += st.KeyCount
+		records += st.RecordCount
+		if st.EstimatedWasteBytes != 0 {
+			t.Errorf("Bucket %d wastes %d bytes before any delete", st.BucketID, st.EstimatedWasteBytes)
+		}
+		if st.RecordCount > 0 && float64(st.FileSizeBytes) != st.AvgRecordSizeBytes*float64(st.RecordCount) {
+			t.Errorf("Bucket %d: average %.1f over %d records does not add up to %d bytes", st.BucketID, st.AvgRecordSizeBytes, st.RecordCount, st.FileSizeBytes)
+		}
+	}
+	if keys != 100 || records != 101 {
+		t.Errorf("Counted %d keys and %d records, want 100 and 101", keys, records)
+	}
+
+	for i := 0; i < 100; i += 2 {
+		mgr.DeleteKey(fmt.Sprintf("key-%d", i))
+	}
+	compaction, err := mgr.CompactionStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = 0
+	for i, st := range mgr.BucketStats() {
+		keys += st.KeyCount
+		if want := compaction[i].TotalBytes - compaction[i].LiveBytes; st.EstimatedWasteBytes != want {
+			t.Errorf("Bucket %d wastes %d bytes, want %d", st.BucketID, st.EstimatedWasteBytes, want)
+		}
+	}
+	if keys != 50 {
+		t.Errorf("Counted %d keys after deleting half, want 50", keys)
+	}
+}
+
+func TestManager_OpenBucketsReportsFailures(t *testing.T) {
+	dataPath := t.TempDir()
+	mgr := newTestManager(t, dataPath)
+	for i := range 100 {
+		if err := mgr.Append(fmt.Sprintf("key-%d", i), []byte("payload")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mgr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cancelled rebuild stops before reading the file
+	b, err := openBucket(context.Background(), 0, filepath.Join(dataPath, "data", bucketFileName(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.rebuildIndex(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("rebuildIndex with a cancelled context = %v, want context.Canceled", err)
+	}
+	if err := b.rebuildIndex(context.Background()); err != nil || len(b.Index) == 0 {
+		t.Errorf("rebuildIndex = %v with %d keys", err, len(b.Index))
+	}
+	b.File.Close()
+
+	// Buckets that cannot be opened are all reported
+	for _, id := range []uint32{3, 11} {
+		path := filepath.Join(dataPath, "data", bucketFileName(id))
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = NewManager(&types.DBSchemaConfig{DataPath: dataPath, SyncMode: "normal"})
+	if err == nil {
+		t.Fatal("NewManager succeeded with unreadable bucket files")
+	}
+	for _, want := range []string{"bucket 3:", "bucket 11:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("NewManager error %q does not mention %s", err, want)
+		}
+	}
+}
+
+// BenchmarkManager_RebuildIndexes opens a data directory of 16 buckets of
+// 1M records each without index files, rebuilding the indexes one bucket at
+// a time and in parallel.
+func BenchmarkManager_RebuildIndexes(b *testing.B) {
+	if testing.Short() {
+		b.Skip("writes 16M records")
+	}
+	const buckets, records = 16, 1 << 20
+	dataPath := filepath.Join(b.TempDir(), "data")
+	if err := os.MkdirAll(dataPath, 0755); err != nil {
+		b.Fatal(err)
+	}
+	payload := CompressBytes([]byte("payload"))
+	for id := range uint32(buckets) {
+		f, err := os.Create(filepath.Join(dataPath, bucketFileName(id)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		w := bufio.NewWriter(f)
+		var buf [4]byte
+		for i := range records {
+			key := fmt.Sprintf("key-%d-%d", id, i)
+			binary.BigEndian.PutUint32(buf[:], uint32(len(key)))
+			w.Write(buf[:])
+			w.WriteString(key)
+			binary.BigEndian.PutUint32(buf[:], uint32(len(payload)))
+			w.Write(buf[:])
+			w.Write(payload)
+		}
+		if err := w.Flush(); err != nil {
+			b.Fatal(err)
+		}
+		f.Close()
+	}
+
+	for _, workers := range []int{1, min(buckets, runtime.NumCPU())} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				idxFiles, _ := filepath.Glob(filepath.Join(dataPath, "*.idx"))
+				for _, f := range idxFiles {
+					os.Remove(f)
+				}
+				opened, err := openBuckets(dataPath, buckets, workers)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, bucket := range opened {
+					bucket.File.Close()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"waddlemap/internal/types"
+)
+
+// TenantSeparator joins a tenant ID and a collection name into the internal
+// name of a tenant's collection. Its files live in indexes/{tenantID}/{name}/.
+const TenantSeparator = "/"
+
+// TenantCollectionName returns the internal name of collection name of
+// tenantID. Neither part may contain a path separator, so a tenant cannot
+// name a collection of another tenant.
+func TenantCollectionName(tenantID, name string) (string, error) {
+	if err := ValidateTenantID(tenantID); err != nil {
+		return "", err
+	}
+	if err := validateTenantNamePart("collection name", name); err != nil {
+		return "", err
+	}
+	return tenantID + TenantSeparator + name, nil
+}
+
+// SplitTenantCollectionName returns the name a tenant's collection has for
+// tenantID, and false if fullName is not one of its collections.
+func SplitTenantCollectionName(tenantID, fullName string) (string, bool) {
+	return strings.CutPrefix(fullName, tenantID+TenantSeparator)
+}
+
+func validateTenantNamePart(what, s string) error {
+	switch {
+	case s == "":
+		return fmt.Errorf("%s cannot be empty", what)
+	case s == "." || s == "..":
+		return fmt.Errorf("invalid %s %q", what, s)
+	case strings.ContainsAny(s, `/\`):
+		return fmt.Errorf("%s %q must not contain path separators", what, s)
+	}
+	return nil
+}
+
+// CreateCollectionForTenant creates collection collectionName in the
+// namespace of tenantID.
+func (vm *VectorManager) CreateCollectionForTenant(tenantID, collectionName string, dimensions uint32, metric types.DistanceMetric) error {
+	name, err := TenantCollectionName(tenantID, collectionName)
+	if err != nil {
+		return err
+	}
+	return vm.CreateCollection(name, dimensions, metric)
+}
+
+// GetCollectionForTenant returns collection collectionName of tenantID.
+func (vm *VectorManager) GetCollectionForTenant(tenantID, collectionName string) (*Collection, error) {
+	name, err := TenantCollectionName(tenantID, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	coll, err := vm.GetCollection(name)
+	if err != nil {
+		return nil, fmt.Errorf("collection %q not found", collectionName)
+	}
+	return coll, nil
+}
+
+// ListCollectionsForTenant returns the configurations of the collections of
+// tenantID, under the names the tenant gave them.
+func (vm *VectorManager) ListCollectionsForTenant(tenantID string) []types.CollectionConfig {
+	var configs []types.CollectionConfig
+	for _, cfg := range vm.ListCollections() {
+		if name, ok := SplitTenantCollectionName(tenantID, cfg.Name); ok {
+			cfg.Name = name
+			configs = append(configs, cfg)
+		}
+	}
+	return configs
+}
+
+// ValidateTenantID checks that tenantID can name a tenant.
+func ValidateTenantID(tenantID string) error {
+	return validateTenantNamePart("tenant ID", tenantID)
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestVectorManager_TenantCollectionsAreIsolated(t *testing.T) {
+	dir := t.TempDir()
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: dir, SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { vm.Close() }()
+
+	for _, tenant := range []string{"acme", "globex"} {
+		if err := vm.CreateCollectionForTenant(tenant, "docs", 2, types.MetricL2); err != nil {
+			t.Fatalf("CreateCollectionForTenant(%s) failed: %v", tenant, err)
+		}
+	}
+	acme, err := vm.GetCollectionForTenant("acme", "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acme.AppendBlock("k", &types.BlockData{Primary: "acme", Vector: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	if globex, _ := vm.GetCollectionForTenant("globex", "docs"); globex == acme || globex.Count() != 0 {
+		t.Error("Expected globex's docs to be separate from acme's")
+	}
+	if _, err := vm.GetCollectionForTenant("initech", "docs"); err == nil {
+		t.Error("Expected another tenant not to see docs")
+	}
+	for _, bad := range [][2]string{{"acme", "../globex/docs"}, {"acme/x", "docs"}, {"", "docs"}, {"acme", ".."}} {
+		if err := vm.CreateCollectionForTenant(bad[0], bad[1], 2, types.MetricL2); err == nil {
+			t.Errorf("Expected tenant %q collection %q to be rejected", bad[0], bad[1])
+		}
+	}
+
+	// Tenant directories are loaded back on restart
+	vm.Close()
+	if vm, err = NewVectorManager(&types.DBSchemaConfig{DataPath: dir, SyncMode: "normal"}); err != nil {
+		t.Fatal(err)
+	}
+	cols := vm.ListCollectionsForTenant("acme")
+	if len(cols) != 1 || cols[0].Name != "docs" {
+		t.Fatalf("Expected acme to list docs after restart, got %+v", cols)
+	}
+	acme, err = vm.GetCollectionForTenant("acme", "docs")
+	if err != nil || acme.Count() != 1 {
+		t.Fatalf("Expected acme's docs with 1 vector after restart, got %v", err)
+	}
+}
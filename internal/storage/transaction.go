@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"waddlemap/internal/logger"
+	"waddlemap/internal/metrics"
+	"waddlemap/internal/types"
+)
+
+// TxOpType is the kind of write buffered in a transaction.
+type TxOpType uint8
+
+const (
+	TxOpAppend TxOpType = iota + 1
+	TxOpUpdate
+	TxOpDeleteKey
+)
+
+// TxOp is one write of a transaction.
+type TxOp struct {
+	Type       TxOpType
+	Collection string
+	Key        string
+	Index      uint32           // Block index, for updates
+	Block      *types.BlockData // Nil for deletes
+}
+
+// CommitTransaction applies ops as one unit. The write locks of all affected
+// buckets are taken first, in bucket order, followed by the affected
+// collections, in name order. Every op is then validated before anything is
+// written, so a transaction that would fail part way is rejected as a whole
+// and no concurrent write can invalidate it before it is applied. The ops are
+// logged in a single WAL batch ending in a commit marker and applied under
+// the same locks. Recovery replays a transaction only if its commit marker
+// reached the log.
+func (vm *VectorManager) CommitTransaction(txID string, ops []TxOp) error {
+	if vm.ReadOnly() {
+		return ErrReadOnly
+	}
+	start := time.Now()
+	colls, err := vm.transactionCollections(ops)
+	if err != nil {
+		return err
+	}
+
+	storageKeys := make([]string, 0, len(ops))
+	for _, op := range ops {
+		storageKeys = append(storageKeys, vm.makeStorageKey(op.Collection, op.Key))
+	}
+	locked := vm.Manager.LockBuckets(storageKeys)
+	defer locked.Unlock()
+	unlock, err := lockCollections(colls)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := validateTransaction(ops, colls); err != nil {
+		return err
+	}
+
+	now := time.Now().UnixNano()
+	walEntries := make([]WALEntry, 0, len(ops)+1)
+	for _, op := range ops {
+		entry := WALEntry{
+			Timestamp:  now,
+			Collection: op.Collection,
+			Key:        op.Key,
+			TxID:       txID,
+		}
+		switch op.Type {
+		case TxOpAppend:
+			entry.OpType = WALOpAdd
+		case TxOpUpdate:
+			entry.OpType = WALOpUpdate
+			entry.Index = op.Index
+		case TxOpDeleteKey:
+			entry.OpType = WALOpDelete
+		}
+		if op.Block != nil {
+			entry.Vector = op.Block.Vector
+			entry.Keywords = op.Block.Keywords
+			entry.Data = []byte(op.Block.Primary)
+			entry.TTLSeconds = op.Block.TTLSeconds
+		}
+		walEntries = append(walEntries, entry)
+	}
+	walEntries = append(walEntries, WALEntry{Timestamp: now, OpType: WALOpCommit, TxID: txID})
+	firstLSN, err := vm.wal.logBatch(walEntries)
+	if err != nil {
+		return fmt.Errorf("WAL logging failed: %w", err)
+	}
+
+	for i, op := range ops {
+		coll := colls[op.Collection]
+		switch op.Type {
+		case TxOpAppend:
+			var vectorID uint64
+			if _, vectorID, err = coll.appendBlockLocked(op.Key, op.Block, firstLSN+uint64(i)); err == nil {
+				err = vm.writeAppend(coll, op.Collection, op.Key, op.Block, vectorID, locked)
+			}
+		case TxOpUpdate:
+			var vectorID uint64
+			if vectorID, err = coll.updateBlockLocked(op.Key, op.Index, op.Block); err == nil {
+				err = vm.writeUpdate(coll, op.Collection, op.Key, op.Index, op.Block, vectorID, locked)
+			}
+		case TxOpDeleteKey:
+			err = coll.deleteKeyLocked(op.Key)
+		}
+		if err != nil {
+			// The transaction is committed in the WAL, so the remaining ops
+			// are applied on the next recovery
+			return fmt.Errorf("transaction %s: op %d failed after commit: %w", txID, i, err)
+		}
+	}
+
+	for name, coll := range colls {
+		if err := coll.FlushHNSWLocked(); err != nil {
+			return fmt.Errorf("HNSW flush failed: %w", err)
+		}
+		metrics.VectorsTotal.WithLabelValues(name).Set(float64(coll.DocMap.Count()))
+	}
+
+	logger.DebugAttrs("transaction committed", "tx", txID, "ops", len(ops),
+		"collections", len(colls), "duration_ms", logger.Since(start))
+	return nil
+}
+
+// transactionCollections returns the collections the ops of a transaction
+// write to, by name.
+func (vm *VectorManager) transactionCollections(ops []TxOp) (map[string]*Collection, error) {
+	colls := make(map[string]*Collection)
+	for i, op := range ops {
+		if _, ok := colls[op.Collection]; ok {
+			continue
+		}
+		coll, err := vm.collections.GetCollection(op.Collection)
+		if err != nil {
+			return nil, fmt.Errorf("op %d: %w", i, err)
+		}
+		colls[op.Collection] = coll
+	}
+	return colls, nil
+}
+
+// lockCollections locks every collection of colls exclusively, in name order,
+// and returns the function that releases them.
+func lockCollections(colls map[string]*Collection) (unlock func(), err error) {
+	names := slices.Sorted(maps.Keys(colls))
+	held := make([]*Collection, 0, len(names))
+	unlock = func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].mu.Unlock()
+			held[i].drainWg.Done()
+		}
+	}
+	for _, name := range names {
+		coll := colls[name]
+		if err := coll.enter(); err != nil {
+			unlock()
+			return nil, err
+		}
+		coll.mu.Lock()
+		held = append(held, coll)
+	}
+	return unlock, nil
+}
+
+// validateTransaction checks that every op of a transaction can be applied,
+// tracking the key lengths left by earlier ops. Caller must hold the
+// collections of colls with lockCollections.
+func validateTransaction(ops []TxOp, colls map[string]*Collection) error {
+	lengths := make(map[string]int64) // Block count per storage key; -1 if absent
+	for i, op := range ops {
+		coll := colls[op.Collection]
+		storageKey := collectionStorageKey(op.Collection, op.Key)
+		length, seen := lengths[storageKey]
+		if !seen {
+			length = -1
+			coll.memMu.RLock()
+			if l, ok := coll.KeyLengths[op.Key]; ok {
+				length = int64(l)
+			}
+			coll.memMu.RUnlock()
+		}
+
+		if op.Type == TxOpAppend || op.Type == TxOpUpdate {
+			if op.Block == nil {
+				return fmt.Errorf("op %d: missing block", i)
+			}
+			if op.Block.TTLSeconds < 0 {
+				return fmt.Errorf("op %d: invalid TTL %d: must not be negative", i, op.Block.TTLSeconds)
+			}
+			if n := len(op.Block.Vector); n > 0 && uint32(n) != coll.Config.Dimensions {
+				return fmt.Errorf("op %d: vector has %d dimensions, collection %q expects %d",
+					i, n, op.Collection, coll.Config.Dimensions)
+			}
+			if err := coll.checkKeywords(op.Block.Keywords); err != nil {
+				return fmt.Errorf("op %d: %w", i, err)
+			}
+		}
+
+		switch op.Type {
+		case TxOpAppend:
+			length = max(length, 0) + 1
+		case TxOpUpdate:
+			if int64(op.Index) >= length {
+				return fmt.Errorf("op %d: block %d of key %q not found", i, op.Index, op.Key)
+			}
+		case TxOpDeleteKey:
+			if length < 0 {
+				return fmt.Errorf("op %d: key %q not found", i, op.Key)
+			}
+			length = -1
+		default:
+			return fmt.Errorf("op %d: unknown operation %d", i, op.Type)
+		}
+		lengths[storageKey] = length
+	}
+	return nil
+}
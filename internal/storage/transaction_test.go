@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"waddlemap/internal/types"
+)
+
+func TestVectorManager_CommitTransaction(t *testing.T) {
+	cfg := &types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"}
+	vm, err := NewVectorManager(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	if err := vm.CreateCollection("col", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("col", "old", &types.BlockData{Primary: "old", Vector: []float32{0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = vm.CommitTransaction("tx1", []TxOp{
+		{Type: TxOpAppend, Collection: "col", Key: "a", Block: &types.BlockData{Primary: "a0", Vector: []float32{1, 0}}},
+		{Type: TxOpAppend, Collection: "col", Key: "b", Block: &types.BlockData{Primary: "b0", Vector: []float32{1, 1}}},
+		{Type: TxOpUpdate, Collection: "col", Key: "a", Index: 0, Block: &types.BlockData{Primary: "a0'", Vector: []float32{2, 0}}},
+		{Type: TxOpDeleteKey, Collection: "col", Key: "old"},
+	})
+	if err != nil {
+		t.Fatalf("CommitTransaction failed: %v", err)
+	}
+	if block, err := vm.GetBlock("col", "a", 0); err != nil || block.Primary != "a0'" {
+		t.Fatalf("Expected updated block a0', got %+v (err %v)", block, err)
+	}
+	if ok, _ := vm.ContainsKey("col", "b"); !ok {
+		t.Error("Expected key b to exist after commit")
+	}
+	if ok, _ := vm.ContainsKey("col", "old"); ok {
+		t.Error("Expected key old to be deleted by commit")
+	}
+
+	// A transaction with an invalid op is rejected before anything is applied
+	for _, ops := range [][]TxOp{
+		{
+			{Type: TxOpAppend, Collection: "col", Key: "c", Block: &types.BlockData{Primary: "c0"}},
+			{Type: TxOpUpdate, Collection: "col", Key: "b", Index: 1, Block: &types.BlockData{Primary: "b1"}},
+		},
+		{
+			{Type: TxOpAppend, Collection: "col", Key: "c", Block: &types.BlockData{Primary: "c0"}},
+			{Type: TxOpAppend, Collection: "col", Key: "d", Block: &types.BlockData{Vector: []float32{1, 2, 3}}},
+		},
+		{
+			{Type: TxOpAppend, Collection: "col", Key: "c", Block: &types.BlockData{Primary: "c0"}},
+			{Type: TxOpDeleteKey, Collection: "missing", Key: "c"},
+		},
+	} {
+		if err := vm.CommitTransaction("bad", ops); err == nil {
+			t.Errorf("Expected transaction %+v to be rejected", ops)
+		}
+		if ok, _ := vm.ContainsKey("col", "c"); ok {
+			t.Fatal("Rejected transaction was partially applied")
+		}
+	}
+
+	// Ops may depend on earlier ops of the same transaction
+	err = vm.CommitTransaction("tx2", []TxOp{
+		{Type: TxOpDeleteKey, Collection: "col", Key: "b"},
+		{Type: TxOpAppend, Collection: "col", Key: "b", Block: &types.BlockData{Primary: "b0'"}},
+		{Type: TxOpUpdate, Collection: "col", Key: "b", Index: 0, Block: &types.BlockData{Primary: "b0''"}},
+	})
+	if err != nil {
+		t.Fatalf("CommitTransaction failed: %v", err)
+	}
+	if block, err := vm.GetBlock("col", "b", 0); err != nil || block.Primary != "b0''" {
+		t.Fatalf("Expected re-created block b0'', got %+v (err %v)", block, err)
+	}
+	vm.Close()
+}
+
+func TestVectorManager_CommitTransactionValidatesUnderLocks(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("col", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("col", "k", &types.BlockData{Primary: "k0", Vector: []float32{0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	coll, err := vm.GetCollection("col")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the bucket of k while the transaction starts, and delete k before
+	// releasing it. The transaction must see the deletion when it validates.
+	locked := vm.Manager.LockBuckets([]string{vm.makeStorageKey("col", "k")})
+	done := make(chan error, 1)
+	go func() {
+		done <- vm.CommitTransaction("tx", []TxOp{
+			{Type: TxOpUpdate, Collection: "col", Key: "k", Index: 0, Block: &types.BlockData{Primary: "k0'"}},
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := coll.DeleteKey("k"); err != nil {
+		t.Fatal(err)
+	}
+	lsn := vm.wal.LSN()
+	locked.Unlock()
+
+	err = <-done
+	if err == nil || strings.Contains(err.Error(), "after commit") {
+		t.Errorf("Expected the transaction to be rejected by validation, got %v", err)
+	}
+	if got := vm.wal.LSN(); got != lsn {
+		t.Errorf("Expected a rejected transaction not to be logged, LSN %d -> %d", lsn, got)
+	}
+}
+
+func TestWAL_ReplaySkipsUncommittedTransaction(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "vector.wal")
+	wal, err := NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wal.LogBatch([]WALEntry{
+		{OpType: WALOpAdd, Collection: "col", Key: "a", TxID: "committed"},
+		{OpType: WALOpAdd, Collection: "col", Key: "b", TxID: "committed"},
+		{OpType: WALOpCommit, TxID: "committed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.LogAdd("col", "plain", 0, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Crash before the commit marker of the second transaction
+	err = wal.LogBatch([]WALEntry{
+		{OpType: WALOpAdd, Collection: "col", Key: "c", TxID: "torn"},
+		{OpType: WALOpDelete, Collection: "col", Key: "a", TxID: "torn"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	wal, err = NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	entries, err := wal.Replay()
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	if len(keys) != 3 || keys[0] != "a" || keys[1] != "b" || keys[2] != "plain" {
+		t.Fatalf("Expected replay of [a b plain], got %v", keys)
+	}
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+
+	"waddlemap/internal/metrics"
+)
+
+// DefaultVectorCacheSize is the number of vectors a VectorCache holds unless
+// configured otherwise.
+const DefaultVectorCacheSize = 10000
+
+// CacheStats holds the counters of a VectorCache or SearchCache since it was
+// created.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// vectorCacheKey identifies a cached vector.
+type vectorCacheKey struct {
+	collection string
+	id         uint64
+}
+
+type vectorCacheEntry struct {
+	key    vectorCacheKey
+	vector []float32
+}
+
+// VectorCache is an LRU cache of vectors shared by the collections of a
+// CollectionManager, so that vectors fetched over and over by ID (cluster
+// centroids, for instance) skip the index lock. Indexes invalidate entries
+// when they delete a vector. Cached slices are shared and must not be
+// modified.
+type VectorCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[vectorCacheKey]*list.Element
+	lru      *list.List // Front is the most recently used
+	stats    CacheStats
+
+	// generation counts invalidations, so that a vector fetched while one of
+	// them ran is not cached after it.
+	generation uint64
+}
+
+// NewVectorCache creates a cache holding up to capacity vectors. A capacity
+// of zero or less disables it.
+func NewVectorCache(capacity int) *VectorCache {
+	return &VectorCache{
+		capacity: max(capacity, 0),
+		entries:  make(map[vectorCacheKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Load returns the vector id of collection, calling fetch on a miss and
+// caching what it finds.
+func (vc *VectorCache) Load(collection string, id uint64, fetch func(id uint64) ([]float32, bool)) ([]float32, bool) {
+	key := vectorCacheKey{collection, id}
+	vc.mu.Lock()
+	if vc.capacity == 0 {
+		vc.mu.Unlock()
+		return fetch(id)
+	}
+	if elem, ok := vc.entries[key]; ok {
+		vc.lru.MoveToFront(elem)
+		vc.stats.Hits++
+		vc.mu.Unlock()
+		metrics.VectorCacheRequestsTotal.WithLabelValues(metrics.CacheHit).Inc()
+		return elem.Value.(*vectorCacheEntry).vector, true
+	}
+	vc.stats.Misses++
+	generation := vc.generation
+	vc.mu.Unlock()
+	metrics.VectorCacheRequestsTotal.WithLabelValues(metrics.CacheMiss).Inc()
+
+	vec, ok := fetch(id)
+	if !ok {
+		return nil, false
+	}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if vc.generation != generation || vc.capacity == 0 {
+		return vec, true
+	}
+	if elem, ok := vc.entries[key]; ok {
+		// Fetched concurrently by another caller
+		vc.lru.MoveToFront(elem)
+		return vec, true
+	}
+	vc.entries[key] = vc.lru.PushFront(&vectorCacheEntry{key: key, vector: vec})
+	vc.evictUnlocked()
+	return vec, true
+}
+
+// Invalidate removes vector id of collection from the cache.
+func (vc *VectorCache) Invalidate(collection string, id uint64) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.generation++
+	if elem, ok := vc.entries[vectorCacheKey{collection, id}]; ok {
+		vc.lru.Remove(elem)
+		delete(vc.entries, elem.Value.(*vectorCacheEntry).key)
+	}
+}
+
+// InvalidateCollection removes every vector of collection from the cache.
+func (vc *VectorCache) InvalidateCollection(collection string) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.generation++
+	for key, elem := range vc.entries {
+		if key.collection == collection {
+			vc.lru.Remove(elem)
+			delete(vc.entries, key)
+		}
+	}
+}
+
+// Resize changes the capacity of the cache, evicting the least recently
+// used vectors beyond it. A capacity of zero or less disables the cache.
+func (vc *VectorCache) Resize(capacity int) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.capacity = max(capacity, 0)
+	vc.evictUnlocked()
+}
+
+// Len returns the number of cached vectors.
+func (vc *VectorCache) Len() int {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	return vc.lru.Len()
+}
+
+// Stats returns the hit, miss and eviction counts of the cache.
+func (vc *VectorCache) Stats() CacheStats {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	return vc.stats
+}
+
+// evictUnlocked drops least recently used entries until the cache fits its
+// capacity. Caller must hold vc.mu.
+func (vc *VectorCache) evictUnlocked() {
+	for vc.lru.Len() > vc.capacity {
+		elem := vc.lru.Back()
+		vc.lru.Remove(elem)
+		delete(vc.entries, elem.Value.(*vectorCacheEntry).key)
+		vc.stats.Evictions++
+		metrics.VectorCacheEvictionsTotal.Inc()
+	}
+}
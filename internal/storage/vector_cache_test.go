@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"math/rand"
+	"testing"
+
+	"waddlemap/internal/types"
+)
+
+func TestVectorCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	vc := NewVectorCache(2)
+	fetches := 0
+	fetch := func(id uint64) ([]float32, bool) {
+		fetches++
+		return []float32{float32(id)}, true
+	}
+
+	vc.Load("c", 1, fetch)
+	vc.Load("c", 2, fetch)
+	vc.Load("c", 1, fetch) // 2 is now the least recently used
+	vc.Load("c", 3, fetch)
+	if vec, _ := vc.Load("c", 1, fetch); vec[0] != 1 {
+		t.Errorf("Load(1) = %v", vec)
+	}
+	if fetches != 3 {
+		t.Errorf("Expected 3 fetches, got %d", fetches)
+	}
+	vc.Load("c", 2, fetch)
+	if fetches != 4 {
+		t.Errorf("Expected the evicted vector to be fetched again, got %d fetches", fetches)
+	}
+	if want := (CacheStats{Hits: 2, Misses: 4, Evictions: 2}); vc.Stats() != want {
+		t.Errorf("Stats = %+v, want %+v", vc.Stats(), want)
+	}
+
+	// Other collections use other keys, and missing vectors are not cached
+	vc.Load("d", 2, fetch)
+	if _, ok := vc.Load("c", 9, func(uint64) ([]float32, bool) { return nil, false }); ok {
+		t.Error("Expected a missing vector to be reported missing")
+	}
+	if fetches != 5 || vc.Len() != 2 {
+		t.Errorf("Expected 5 fetches and 2 entries, got %d and %d", fetches, vc.Len())
+	}
+
+	vc.Resize(0)
+	vc.Load("c", 2, fetch)
+	if vc.Len() != 0 || fetches != 6 {
+		t.Errorf("Expected a disabled cache to fetch every time, got %d entries and %d fetches", vc.Len(), fetches)
+	}
+}
+
+func TestVectorCache_InvalidationDuringFetch(t *testing.T) {
+	vc := NewVectorCache(10)
+	vc.Load("c", 1, func(uint64) ([]float32, bool) {
+		vc.Invalidate("c", 1) // A delete racing the fetch
+		return []float32{1}, true
+	})
+	if vc.Len() != 0 {
+		t.Error("Expected a vector fetched across an invalidation not to be cached")
+	}
+}
+
+func TestCollection_GetVectorByIDCache(t *testing.T) {
+	coll := newBenchCollection(t)
+	for _, key := range []string{"a", "b"} {
+		if _, err := coll.AppendBlock(key, &types.BlockData{Vector: []float32{1, 2, 3, 4}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idA, idB := coll.KeyIndex["a"][0], coll.KeyIndex["b"][0]
+	for range 3 {
+		if vec, ok := coll.GetVectorByID(idA); !ok || vec[0] != 1 {
+			t.Fatalf("GetVectorByID = %v, %v", vec, ok)
+		}
+	}
+	if stats := coll.vectorCache.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %+v", stats)
+	}
+
+	// Updates and deletes go through HNSWWrapper.Delete, which invalidates
+	if _, err := coll.UpdateBlock("a", 0, &types.BlockData{Vector: []float32{5, 6, 7, 8}}); err != nil {
+		t.Fatal(err)
+	}
+	if vec, ok := coll.GetVectorByID(idA); !ok || vec[0] != 5 {
+		t.Errorf("GetVectorByID after update = %v, %v", vec, ok)
+	}
+	coll.GetVectorByID(idB)
+	if err := coll.DeleteKey("b"); err != nil {
+		t.Fatal(err)
+	}
+	if vec, ok := coll.GetVectorByID(idB); ok {
+		t.Errorf("GetVectorByID returned deleted vector %v", vec)
+	}
+}
+
+// BenchmarkVectorCacheZipf fetches vectors by ID with a Zipf-distributed
+// popularity, as when a few centroids are read over and over, and reports
+// the hit rate of a cache holding 10% of them.
+func BenchmarkVectorCacheZipf(b *testing.B) {
+	const n = 100_000
+	cm, err := NewCollectionManager(b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { cm.Close() })
+	cm.VectorCache().Resize(n / 10)
+	if err := cm.CreateCollection("bench", 4, types.MetricL2); err != nil {
+		b.Fatal(err)
+	}
+	coll, _ := cm.GetCollection("bench")
+
+	// GetVectorByID needs no graph, so fill the index without building one
+	rng := rand.New(rand.NewSource(1))
+	for id := range uint64(n) {
+		vec := []float32{rng.Float32(), rng.Float32(), rng.Float32(), rng.Float32()}
+		coll.HNSWIndex.nodes[id] = &hnswNode{ID: id, Vector: vec, Neighbors: make([][]uint64, 1)}
+	}
+
+	zipf := rand.NewZipf(rng, 1.1, 1, n-1)
+	ids := make([]uint64, 1<<16)
+	for i := range ids {
+		ids[i] = zipf.Uint64()
+	}
+	b.ResetTimer()
+	for i := range b.N {
+		if _, ok := coll.GetVectorByID(ids[i%len(ids)]); !ok {
+			b.Fatal("vector not found")
+		}
+	}
+	stats := cm.VectorCache().Stats()
+	b.ReportMetric(float64(stats.Hits)/float64(stats.Hits+stats.Misses), "hit-rate")
+}
@@ -1,11 +1,23 @@
 package storage
 
 import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"waddlemap/internal/logger"
+	"waddlemap/internal/metrics"
 	"waddlemap/internal/types"
 )
 
@@ -15,9 +27,25 @@ type VectorManager struct {
 	collections *CollectionManager
 	wal         *WAL
 	repair      *RepairManager
+	flusher     *DirtyFlusher
+	sweeper     *ExpirySweeper
+	cursors     *cursorCache
 	mu          sync.RWMutex
+
+	coalesceWindow time.Duration // Zero when appends are not coalesced
+	coalescersMu   sync.Mutex
+	coalescers     map[string]*WriteCoalescer // Per collection; nil once closed
+
+	adaptiveEfTarget time.Duration // Latency AdaptiveSearch aims for; zero searches with the fixed EfSearch
+
+	searchCache *SearchCache // Results of primary searches of HNSW collections
+
+	readOnly atomic.Bool // Set on replicas, see SetReadOnly
 }
 
+// ErrReadOnly is returned by writes to a read-only VectorManager.
+var ErrReadOnly = errors.New("read-only replica: send writes to the primary")
+
 // NewVectorManager creates a new vector-enabled storage manager.
 func NewVectorManager(cfg *types.DBSchemaConfig) (*VectorManager, error) {
 	// Create base manager
@@ -41,61 +69,331 @@ func NewVectorManager(cfg *types.DBSchemaConfig) (*VectorManager, error) {
 		baseMgr.Close()
 		return nil, err
 	}
+	if cfg.WALMaxSegmentBytes > 0 {
+		wal.SetMaxSegmentBytes(cfg.WALMaxSegmentBytes)
+	}
+	collMgr.SetWAL(wal)
+	if cfg.VectorCacheSize != 0 {
+		collMgr.VectorCache().Resize(cfg.VectorCacheSize)
+	}
+
+	searchCacheSize := cfg.SearchCacheSize
+	if searchCacheSize == 0 {
+		searchCacheSize = DefaultSearchCacheSize
+	}
 
 	vm := &VectorManager{
 		Manager:     baseMgr,
 		collections: collMgr,
 		wal:         wal,
+		cursors:     newCursorCache(cfg.CursorTTL),
+		searchCache: NewSearchCache(searchCacheSize),
 	}
 
 	// Create repair manager
-	vm.repair = NewRepairManager(collMgr)
+	vm.repair = NewRepairManager(collMgr, baseMgr)
 
 	// Recover from WAL
 	if err := vm.recoverFromWAL(walPath); err != nil {
 		fmt.Printf("Warning: WAL recovery failed: %v\n", err)
 	}
 
+	if cfg.AdaptiveEfEnabled {
+		vm.adaptiveEfTarget = cfg.AdaptiveEfTarget
+		if vm.adaptiveEfTarget <= 0 {
+			vm.adaptiveEfTarget = DefaultAdaptiveEfTarget
+		}
+	}
+
+	if cfg.CoalescingEnabled {
+		vm.coalesceWindow = cfg.CoalescingWindow
+		if vm.coalesceWindow <= 0 {
+			vm.coalesceWindow = DefaultCoalescingWindow
+		}
+		vm.coalescers = make(map[string]*WriteCoalescer)
+	}
+
+	// Start background index flushing
+	if cfg.FlushInterval >= 0 {
+		vm.flusher = NewDirtyFlusher(collMgr, cfg.FlushInterval)
+		vm.flusher.Start()
+	}
+
+	// Start background removal of expired blocks
+	if cfg.ExpirySweepInterval >= 0 {
+		vm.sweeper = NewExpirySweeper(vm, cfg.ExpirySweepInterval)
+		vm.sweeper.Start()
+	}
+
 	return vm, nil
 }
 
 // recoverFromWAL replays WAL logs.
+//
+// An add that reached its collection before the crash is restored from its
+// index entry, under the vector ID and block index it had then, since its
+// vectors may have been flushed already while the forward and keyword
+// indexes were not. Adds without an index entry are appended again; those
+// to a key that a later index entry appends to wait until the end, behind
+// the blocks that got their indexes first.
 func (vm *VectorManager) recoverFromWAL(walPath string) error {
 	entries, err := vm.wal.Replay()
 	if err != nil {
 		return err
 	}
 
-	for _, entry := range entries {
+	indexed, lastIndexAdd := indexedAdds(entries)
+	adds := make(map[uint64]*WALEntry, len(indexed))
+	for i, entry := range entries {
+		if entry.OpType == WALOpAdd && indexed[entry.LSN] {
+			adds[entry.LSN] = &entries[i]
+		}
+		// Appends replayed before an index add must not take its vector ID
+		if entry.OpType == WALOpIndexAdd {
+			if coll, err := vm.collections.GetCollection(entry.Collection); err == nil {
+				coll.DocMap.reserveThrough(entry.VectorID)
+			}
+		}
+	}
+
+	var deferred []WALEntry
+	for i, entry := range entries {
 		switch entry.OpType {
 		case WALOpAdd:
-			// Map legacy Add to AppendBlock
-			block := &types.BlockData{
-				Primary:  string(entry.Data),
-				Vector:   entry.Vector,
-				Keywords: entry.Keywords,
+			if indexed[entry.LSN] {
+				continue // Restored at its index entry
+			}
+			if last, ok := lastIndexAdd[recoveryKey(entry.Collection, entry.Key)]; ok && last > i {
+				deferred = append(deferred, entry)
+				continue
+			}
+			if err := vm.replayAdd(entry); err != nil {
+				return err
 			}
-			_, err := vm.AppendBlock(entry.Collection, entry.Key, block)
+
+		case WALOpIndexAdd:
+			if err := vm.restoreAppend(entry, adds[entry.AddLSN]); err != nil {
+				return err
+			}
+
+		case WALOpIndexDelete:
+			coll, err := vm.collections.GetCollection(entry.Collection)
 			if err != nil {
 				return err
 			}
+			if err := coll.restoreDelete(entry); err != nil {
+				return err
+			}
+
+		case WALOpUpdate:
+			block := &types.BlockData{
+				Primary:    string(entry.Data),
+				Vector:     entry.Vector,
+				Keywords:   entry.Keywords,
+				TTLSeconds: replayTTL(entry),
+			}
+			if err := vm.updateBlock(entry.Collection, entry.Key, entry.Index, block); err != nil {
+				return err
+			}
 
 		case WALOpDelete:
-			if err := vm.DeleteKey(entry.Collection, entry.Key); err != nil {
+			// The delete may have been saved already
+			err := vm.deleteKey(context.Background(), entry.Collection, entry.Key)
+			if err != nil && !errors.Is(err, types.ErrKeyNotFound) {
 				return err
 			}
 		}
+		// Collection entries are skipped: their changes were saved already
+	}
+	for _, entry := range deferred {
+		if err := vm.replayAdd(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayAdd appends the block of an add entry that never reached its
+// collection.
+func (vm *VectorManager) replayAdd(entry WALEntry) error {
+	block := &types.BlockData{
+		Primary:    string(entry.Data),
+		Vector:     entry.Vector,
+		Keywords:   entry.Keywords,
+		TTLSeconds: replayTTL(entry),
+	}
+	_, err := vm.appendBlock(context.Background(), entry.Collection, entry.Key, block)
+	return err
+}
+
+// restoreAppend restores the block of the index add entry indexEntry in its
+// collection, and writes its storage entry if the crash came before that.
+// add is the add entry of the block, nil if it is no longer in the log; the
+// block then only gets back what its index entry records.
+func (vm *VectorManager) restoreAppend(indexEntry WALEntry, add *WALEntry) error {
+	coll, err := vm.collections.GetCollection(indexEntry.Collection)
+	if err != nil {
+		return err
+	}
+	var vector []float32
+	if add != nil {
+		vector = add.Vector
+	}
+	restored, err := coll.restoreBlock(indexEntry, vector)
+	if err != nil || !restored || add == nil {
+		return err
+	}
+
+	loc := indexEntry.Location
+	storageKey := vm.makeStorageKey(indexEntry.Collection, loc.Key)
+	if vm.Manager.GetLength(storageKey) != int(loc.Index) {
+		return nil // Written before the crash
+	}
+	block := &types.BlockData{Primary: string(add.Data), Vector: add.Vector, Keywords: add.Keywords}
+	encoded, err := encodeBlockEntry(loc.Key, block, indexEntry.VectorID, loc.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to encode entry: %w", err)
+	}
+	if err := vm.Manager.Append(storageKey, encoded); err != nil {
+		return fmt.Errorf("storage append failed: %w", err)
+	}
+	return nil
+}
+
+// SetReadOnly makes the writes of clients fail with ErrReadOnly, as on a
+// replica. Entries streamed from the primary are applied with ApplyReplicated.
+func (vm *VectorManager) SetReadOnly(readOnly bool) {
+	vm.readOnly.Store(readOnly)
+}
+
+// ReadOnly reports whether client writes are rejected.
+func (vm *VectorManager) ReadOnly() bool {
+	return vm.readOnly.Load()
+}
+
+// GetTraceLog returns the log lines recorded for a request trace ID, oldest
+// first, or nil if the trace is unknown, has been dropped from the trace
+// store or tracing is disabled.
+func (vm *VectorManager) GetTraceLog(traceID string) []string {
+	ts := logger.Traces()
+	if ts == nil {
+		return nil
+	}
+	return ts.Lines(traceID)
+}
+
+// ApplyReplicated applies an entry of a primary's WAL, bypassing the
+// read-only check. Entries must be applied in LSN order, and the entries of
+// a transaction only once its commit marker has arrived. Commit and
+// checkpoint markers are ignored, and so are index entries: the replica's
+// collections log their own.
+func (vm *VectorManager) ApplyReplicated(entry WALEntry) error {
+	switch entry.OpType {
+	case WALOpAdd:
+		block := &types.BlockData{
+			Primary:    string(entry.Data),
+			Vector:     entry.Vector,
+			Keywords:   entry.Keywords,
+			TTLSeconds: replayTTL(entry),
+		}
+		_, err := vm.appendBlock(context.Background(), entry.Collection, entry.Key, block)
+		return err
+	case WALOpUpdate:
+		block := &types.BlockData{
+			Primary:    string(entry.Data),
+			Vector:     entry.Vector,
+			Keywords:   entry.Keywords,
+			TTLSeconds: replayTTL(entry),
+		}
+		return vm.updateBlock(entry.Collection, entry.Key, entry.Index, block)
+	case WALOpDelete:
+		return vm.deleteKey(context.Background(), entry.Collection, entry.Key)
+	case WALOpCreateCollection:
+		if entry.CollectionConfig == nil {
+			return fmt.Errorf("create entry of collection %q has no config", entry.Collection)
+		}
+		return vm.createCollection(*entry.CollectionConfig)
+	case WALOpDeleteCollection:
+		return vm.deleteCollection(entry.Collection)
 	}
 	return nil
 }
 
+// FollowWAL returns the WAL entries logged after LSN since and a channel of
+// the entries logged from then on. See WAL.Follow.
+func (vm *VectorManager) FollowWAL(since uint64, buffer int) ([]WALEntry, <-chan WALEntry, error) {
+	return vm.wal.Follow(since, buffer)
+}
+
+// UnfollowWAL closes a channel returned by FollowWAL.
+func (vm *VectorManager) UnfollowWAL(ch <-chan WALEntry) {
+	vm.wal.Unfollow(ch)
+}
+
+// WALPosition returns the LSN of the last WAL entry.
+func (vm *VectorManager) WALPosition() uint64 {
+	return vm.wal.LSN()
+}
+
+// replayTTL returns the TTL that gives a replayed block its original expiry
+// time. Blocks that expired while the server was down still take their index
+// and expire a second later.
+func replayTTL(entry WALEntry) int64 {
+	if entry.TTLSeconds <= 0 {
+		return 0
+	}
+	expiresAt := time.Unix(0, entry.Timestamp).Unix() + entry.TTLSeconds
+	return max(1, expiresAt-time.Now().Unix())
+}
+
 // CreateCollection creates a new vector collection.
 func (vm *VectorManager) CreateCollection(name string, dimensions uint32, metric types.DistanceMetric) error {
-	return vm.collections.CreateCollection(name, dimensions, metric)
+	return vm.CreateCollectionWithConfig(types.CollectionConfig{
+		Name:       name,
+		Dimensions: dimensions,
+		Metric:     metric,
+	})
+}
+
+// CreateCollectionWithConfig creates a vector collection from a full configuration.
+func (vm *VectorManager) CreateCollectionWithConfig(cfg types.CollectionConfig) error {
+	if vm.ReadOnly() {
+		return ErrReadOnly
+	}
+	return vm.createCollection(cfg)
+}
+
+// createCollection implements CreateCollectionWithConfig. The creation is
+// logged for replicas only.
+func (vm *VectorManager) createCollection(cfg types.CollectionConfig) error {
+	if err := vm.wal.LogCreateCollection(cfg); err != nil {
+		return fmt.Errorf("WAL logging failed: %w", err)
+	}
+	return vm.collections.CreateCollectionWithConfig(cfg)
 }
 
 // DeleteCollection deletes a vector collection.
 func (vm *VectorManager) DeleteCollection(name string) error {
+	if vm.ReadOnly() {
+		return ErrReadOnly
+	}
+	return vm.deleteCollection(name)
+}
+
+// deleteCollection implements DeleteCollection.
+func (vm *VectorManager) deleteCollection(name string) error {
+	if err := vm.wal.LogDeleteCollection(name); err != nil {
+		return fmt.Errorf("WAL logging failed: %w", err)
+	}
+
+	vm.coalescersMu.Lock()
+	wc := vm.coalescers[name]
+	delete(vm.coalescers, name)
+	vm.coalescersMu.Unlock()
+	if wc != nil {
+		wc.Close() // Appends buffered before the delete are written, then deleted
+	}
+
 	// Purge keys from underlying storage
 	if coll, err := vm.collections.GetCollection(name); err == nil {
 		// Use ListKeys to get all keys in the collection
@@ -109,6 +407,62 @@ func (vm *VectorManager) DeleteCollection(name string) error {
 	return vm.collections.DeleteCollection(name)
 }
 
+// blockBackup is one record of blocks.gob: the blocks of a single key.
+type blockBackup struct {
+	Key    string
+	Blocks []types.BlockData
+}
+
+// DeleteCollectionWithBackup archives a collection to backupDir before deleting it.
+// Besides the index files, the block data is written to blocks.gob in backupDir,
+// since it lives in the shared buckets rather than the collection directory.
+// blocks.gob is a stream of gob-encoded blockBackup records, one per key, so
+// only one key's blocks are held in memory at a time.
+// Nothing is deleted unless the backup succeeds.
+func (vm *VectorManager) DeleteCollectionWithBackup(name, backupDir string) error {
+	if vm.ReadOnly() {
+		return ErrReadOnly
+	}
+	coll, err := vm.collections.GetCollection(name)
+	if err != nil {
+		return err
+	}
+
+	keys := coll.ListKeys()
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return err
+	}
+	err = writeFileAtomic(filepath.Join(backupDir, "blocks.gob"), func(w *bufio.Writer) error {
+		enc := gob.NewEncoder(w)
+		for _, key := range keys {
+			data, err := vm.GetKey(name, key)
+			if err != nil {
+				return fmt.Errorf("failed to read key %q for backup: %w", key, err)
+			}
+			if err := enc.Encode(blockBackup{Key: key, Blocks: data}); err != nil {
+				return fmt.Errorf("failed to write block backup: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := vm.wal.LogDeleteCollection(name); err != nil {
+		return fmt.Errorf("WAL logging failed: %w", err)
+	}
+	if err := vm.collections.DeleteCollectionWithBackup(name, backupDir); err != nil {
+		return err
+	}
+
+	// Purge keys from underlying storage only after the backup is verified
+	for _, key := range keys {
+		_ = vm.Manager.DeleteKey(vm.makeStorageKey(name, key))
+	}
+	return nil
+}
+
 // ListCollections returns all collection configurations.
 func (vm *VectorManager) ListCollections() []types.CollectionConfig {
 	return vm.collections.ListCollections()
@@ -119,70 +473,269 @@ func (vm *VectorManager) GetCollection(name string) (*Collection, error) {
 	return vm.collections.GetCollection(name)
 }
 
+// LockCollection freezes collection name with Collection.Lock and returns
+// the function that releases it, for maintenance that must not race any
+// other operation.
+func (vm *VectorManager) LockCollection(name string) (unlock func(), err error) {
+	coll, err := vm.collections.GetCollection(name)
+	if err != nil {
+		return nil, err
+	}
+	coll.Lock()
+	return coll.Unlock, nil
+}
+
+// RLockCollection freezes the contents of collection name with
+// Collection.RLock and returns the function that releases it. Reads of the
+// collection continue meanwhile.
+func (vm *VectorManager) RLockCollection(name string) (unlock func(), err error) {
+	coll, err := vm.collections.GetCollection(name)
+	if err != nil {
+		return nil, err
+	}
+	coll.RLock()
+	return coll.RUnlock, nil
+}
+
 func (vm *VectorManager) makeStorageKey(collection, key string) string {
+	return collectionStorageKey(collection, key)
+}
+
+// collectionStorageKey returns the bucket storage key of a collection key.
+func collectionStorageKey(collection, key string) string {
 	return fmt.Sprintf("%s:%s", collection, key)
 }
 
 // AppendBlock appends a block to a key.
 func (vm *VectorManager) AppendBlock(collection, key string, block *types.BlockData) (uint32, error) {
+	return vm.AppendBlockContext(context.Background(), collection, key, block)
+}
+
+// AppendBlockContext is AppendBlock logging under the trace ID of ctx.
+func (vm *VectorManager) AppendBlockContext(ctx context.Context, collection, key string, block *types.BlockData) (uint32, error) {
+	if vm.ReadOnly() {
+		return 0, ErrReadOnly
+	}
+	if vm.coalesceWindow > 0 {
+		wc, err := vm.coalescer(collection, key, block)
+		if err != nil {
+			return 0, err
+		}
+		if wc != nil {
+			start := time.Now()
+			defer func() { metrics.AppendDuration.Observe(time.Since(start).Seconds()) }()
+			index, err := wc.Append(key, block)
+			if err == nil {
+				logger.DebugContext(ctx, "block appended", "collection", collection, "key", key, "index", index,
+					"coalesced", true, "duration_ms", logger.Since(start))
+			}
+			return index, err
+		}
+	}
+	return vm.appendBlock(ctx, collection, key, block)
+}
+
+// coalescer returns the write coalescer of collection, creating it on first
+// use. The block is validated first, so that a block the batch would reject
+// fails on its own instead of joining a batch. It returns nil, with no
+// error, once the coalescers are closed.
+func (vm *VectorManager) coalescer(collection, key string, block *types.BlockData) (*WriteCoalescer, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAppend(coll, key, block); err != nil {
+		return nil, err
+	}
+
+	vm.coalescersMu.Lock()
+	defer vm.coalescersMu.Unlock()
+	if vm.coalescers == nil {
+		return nil, nil
+	}
+	wc, ok := vm.coalescers[collection]
+	if !ok {
+		wc = NewWriteCoalescer(vm.coalesceWindow, func(keys []string, blocks []*types.BlockData) []coalescedResult {
+			written, indices, err := vm.appendCheckedBlocks(collection, keys, blocks)
+			results := make([]coalescedResult, len(keys))
+			for i := range results {
+				switch {
+				case written[i]:
+					results[i].index = indices[i]
+				case err != nil:
+					results[i].err = err
+				default:
+					results[i].err = fmt.Errorf("block %d of the batch was not written", i)
+				}
+			}
+			// Match AppendBlock, which flushes the HNSW index after every block
+			if coll, err := vm.collections.GetCollection(collection); err == nil {
+				if err := coll.FlushHNSW(); err != nil {
+					for i := range results {
+						if results[i].err == nil {
+							results[i].err = fmt.Errorf("HNSW flush failed: %w", err)
+						}
+					}
+				}
+			}
+			return results
+		})
+		vm.coalescers[collection] = wc
+	}
+	return wc, nil
+}
+
+// closeCoalescers writes the appends buffered by every coalescer. Later
+// appends are written directly.
+func (vm *VectorManager) closeCoalescers() {
+	vm.coalescersMu.Lock()
+	coalescers := vm.coalescers
+	vm.coalescers = nil
+	vm.coalescersMu.Unlock()
+
+	for _, wc := range coalescers {
+		wc.Close()
+	}
+}
+
+// appendBlock implements AppendBlock without coalescing.
+func (vm *VectorManager) appendBlock(ctx context.Context, collection, key string, block *types.BlockData) (uint32, error) {
 	coll, err := vm.collections.GetCollection(collection)
 	if err != nil {
 		return 0, err
 	}
+	if err := checkAppend(coll, key, block); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	defer func() {
+		metrics.AppendDuration.Observe(time.Since(start).Seconds())
+		metrics.VectorsTotal.WithLabelValues(collection).Set(float64(coll.DocMap.Count()))
+	}()
 
-	if err := vm.wal.LogAdd(collection, key, 0, block.Vector, block.Keywords, []byte(block.Primary)); err != nil {
+	lsn, err := vm.wal.LogAddTTL(collection, key, 0, block.Vector, block.Keywords, []byte(block.Primary), block.TTLSeconds)
+	if err != nil {
 		return 0, fmt.Errorf("WAL logging failed: %w", err)
 	}
 
-	index, err := coll.AppendBlock(key, block)
+	index, vectorID, err := vm.applyAppend(coll, collection, key, block, lsn, vm.Manager)
 	if err != nil {
-		return 0, err
+		return index, err
+	}
+
+	// Flush HNSW to disk for durability
+	if err := coll.FlushHNSW(); err != nil {
+		return index, fmt.Errorf("HNSW flush failed: %w", err)
+	}
+
+	logger.DebugContext(ctx, "block appended", "collection", collection, "key", key, "index", index,
+		"vector_id", vectorID, "dims", len(block.Vector), "keywords", len(block.Keywords),
+		"duration_ms", logger.Since(start))
+	return index, nil
+}
+
+// applyAppend adds a block logged at LSN addLSN to the collection indexes
+// and writes its entry through w. Returns the block index and vector ID.
+func (vm *VectorManager) applyAppend(coll *Collection, collection, key string, block *types.BlockData, addLSN uint64, w payloadWriter) (uint32, uint64, error) {
+	index, err := coll.appendBlock(key, block, addLSN)
+	if err != nil {
+		return 0, 0, err
 	}
 
 	vectorID, err := coll.GetBlockVectorID(key, index)
 	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve vector ID after append: %w", err)
+		return 0, 0, fmt.Errorf("failed to retrieve vector ID after append: %w", err)
+	}
+	return index, vectorID, vm.writeAppend(coll, collection, key, block, vectorID, w)
+}
+
+// writeAppend writes the entry of a block added to the collection indexes as
+// vectorID through w.
+func (vm *VectorManager) writeAppend(coll *Collection, collection, key string, block *types.BlockData, vectorID uint64, w payloadWriter) error {
+	loc, _ := coll.DocMap.Get(vectorID)
+	encoded, err := encodeBlockEntry(key, block, vectorID, loc.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to encode entry: %w", err)
+	}
+
+	storageKey := vm.makeStorageKey(collection, key)
+	if err := w.Append(storageKey, encoded); err != nil {
+		return fmt.Errorf("storage append failed: %w", err)
+	}
+	return nil
+}
+
+// checkAppend validates a block appended to key before it is logged: its TTL,
+// vector dimensions and keywords, and that its storage entry can be encoded.
+func checkAppend(coll *Collection, key string, block *types.BlockData) error {
+	if block.TTLSeconds < 0 {
+		return fmt.Errorf("invalid TTL %d: must not be negative", block.TTLSeconds)
+	}
+	if n := len(block.Vector); n > 0 && uint32(n) != coll.Config.Dimensions {
+		return &types.DimensionMismatchError{Subject: "vector", Expected: int(coll.Config.Dimensions), Actual: n}
+	}
+	if err := coll.checkKeywords(block.Keywords); err != nil {
+		return err
 	}
+	// The vector ID and expiry of the entry don't affect whether it encodes
+	if _, err := encodeBlockEntry(key, block, 0, 0); err != nil {
+		return fmt.Errorf("failed to encode entry: %w", err)
+	}
+	return nil
+}
 
-	// Serialize Entry
+// encodeBlockEntry encodes the storage entry of a block added as vectorID.
+func encodeBlockEntry(key string, block *types.BlockData, vectorID uint64, expiresAt int64) ([]byte, error) {
 	entry := &Entry{
 		Key:           []byte(key),
 		Keywords:      block.Keywords,
 		PrimaryData:   []byte(block.Primary),
 		SecondaryData: VectorIDToBytes(vectorID),
 		Flags:         types.EntryFlags{},
+		ExpiresAt:     expiresAt,
 	}
 	if len(block.Vector) > 0 {
 		entry.Flags.DataType = types.DataTypeVector
 	}
+	return EncodeEntry(entry)
+}
 
-	encoded, err := EncodeEntry(entry)
-	if err != nil {
-		return 0, fmt.Errorf("failed to encode entry: %w", err)
+// BatchAppendBlocks appends multiple blocks efficiently using batch methods.
+func (vm *VectorManager) BatchAppendBlocks(collection string, keys []string, blocks []*types.BlockData) ([]bool, error) {
+	if vm.ReadOnly() {
+		return nil, ErrReadOnly
 	}
+	successes, _, err := vm.batchAppendBlocks(collection, keys, blocks)
+	return successes, err
+}
 
-	storageKey := vm.makeStorageKey(collection, key)
-	if err := vm.Manager.Append(storageKey, encoded); err != nil {
-		return index, fmt.Errorf("storage append failed: %w", err)
+// batchAppendBlocks implements BatchAppendBlocks and also returns the block
+// index assigned to each block. Every block is validated before any is
+// logged, so an invalid block rejects the batch as a whole.
+func (vm *VectorManager) batchAppendBlocks(collection string, keys []string, blocks []*types.BlockData) ([]bool, []uint32, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	// Flush HNSW to disk for durability
-	if err := coll.FlushHNSW(); err != nil {
-		return index, fmt.Errorf("HNSW flush failed: %w", err)
+	for i, block := range blocks {
+		if err := checkAppend(coll, keys[i], block); err != nil {
+			return make([]bool, len(keys)), nil, fmt.Errorf("block %d: %w", i, err)
+		}
 	}
-
-	return index, nil
+	return vm.appendCheckedBlocks(collection, keys, blocks)
 }
 
-// BatchAppendBlocks appends multiple blocks efficiently using batch methods.
-func (vm *VectorManager) BatchAppendBlocks(collection string, keys []string, blocks []*types.BlockData) ([]bool, error) {
+// appendCheckedBlocks appends blocks that passed checkAppend as one batch.
+// A block is reported written once its storage entry is; on error, the
+// blocks not reported written are logged and may be in the collection
+// indexes, but not in storage.
+func (vm *VectorManager) appendCheckedBlocks(collection string, keys []string, blocks []*types.BlockData) ([]bool, []uint32, error) {
+	successes := make([]bool, len(keys))
 	coll, err := vm.collections.GetCollection(collection)
 	if err != nil {
-		return nil, err
+		return successes, nil, err
 	}
 
-	successes := make([]bool, len(keys))
-
 	// Phase 1: WAL Batch Logging
 	walEntries := make([]WALEntry, len(keys))
 	for i, key := range keys {
@@ -195,59 +748,73 @@ func (vm *VectorManager) BatchAppendBlocks(collection string, keys []string, blo
 			Vector:     block.Vector,
 			Keywords:   block.Keywords,
 			Data:       []byte(block.Primary),
+			TTLSeconds: block.TTLSeconds,
 		}
 	}
 
-	if err := vm.wal.LogBatch(walEntries); err != nil {
-		return successes, fmt.Errorf("WAL batch logging failed: %w", err)
+	firstLSN, err := vm.wal.logBatch(walEntries)
+	if err != nil {
+		return successes, nil, fmt.Errorf("WAL batch logging failed: %w", err)
 	}
 
 	// Phase 2: Batch Collection Insert (single lock, batch HNSW)
-	results, err := coll.BatchAppendBlocks(keys, blocks)
+	results, err := coll.batchAppendBlocks(keys, blocks, firstLSN)
 	if err != nil {
-		return successes, err
+		return successes, nil, err
 	}
-
-	// Phase 3: Batch Storage Write
-	batchEntries := make(map[string][]byte)
+	indices := make([]uint32, len(results))
+	for i, result := range results {
+		indices[i] = result.Index
+	}
+	metrics.VectorsTotal.WithLabelValues(collection).Set(float64(coll.DocMap.Count()))
+
+	// Phase 3: Batch Storage Write. Manager.BatchAppend takes one record per
+	// storage key, so the n-th block of each key goes into the n-th round.
+	var rounds []map[string][]byte
+	var members [][]int          // Blocks written by each round
+	seen := make(map[string]int) // Blocks of each storage key placed so far
+	var encodeErr error
 	for i, key := range keys {
 		block := blocks[i]
 		result := results[i]
+		loc, _ := coll.DocMap.Get(result.VectorID)
 
-		entry := &Entry{
-			Key:           []byte(key),
-			Keywords:      block.Keywords,
-			PrimaryData:   []byte(block.Primary),
-			SecondaryData: VectorIDToBytes(result.VectorID),
-			Flags:         types.EntryFlags{},
-		}
-		if len(block.Vector) > 0 {
-			entry.Flags.DataType = types.DataTypeVector
-		}
-
-		encoded, err := EncodeEntry(entry)
+		encoded, err := encodeBlockEntry(key, block, result.VectorID, loc.ExpiresAt)
 		if err != nil {
+			if encodeErr == nil {
+				encodeErr = fmt.Errorf("block %d: failed to encode entry: %w", i, err)
+			}
 			continue
 		}
 
 		storageKey := vm.makeStorageKey(collection, key)
-		batchEntries[storageKey] = encoded
-		successes[i] = true
+		round := seen[storageKey]
+		seen[storageKey]++
+		if round == len(rounds) {
+			rounds = append(rounds, make(map[string][]byte))
+			members = append(members, nil)
+		}
+		rounds[round][storageKey] = encoded
+		members[round] = append(members[round], i)
 	}
 
-	if len(batchEntries) > 0 {
+	for round, batchEntries := range rounds {
 		if err := vm.Manager.BatchAppend(batchEntries); err != nil {
-			return successes, fmt.Errorf("batch storage write failed: %w", err)
+			return successes, indices, fmt.Errorf("batch storage write failed: %w", err)
+		}
+		for _, i := range members[round] {
+			successes[i] = true
 		}
 	}
 
 	// NOTE: FlushHNSW removed for performance.
 	// Durability relies on WAL recovery + periodic Checkpoint.
 
-	return successes, nil
+	return successes, indices, encodeErr
 }
 
-// GetBlock retrieves a specific block.
+// GetBlock retrieves a specific block. It returns ErrExpired if the block's
+// TTL has passed.
 func (vm *VectorManager) GetBlock(collection, key string, index uint32) (*types.BlockData, error) {
 	coll, err := vm.collections.GetCollection(collection)
 	if err != nil {
@@ -255,33 +822,42 @@ func (vm *VectorManager) GetBlock(collection, key string, index uint32) (*types.
 	}
 
 	if exists := coll.ContainsKey(key); !exists {
-		return nil, fmt.Errorf("key %q not found", key)
+		return nil, &types.KeyNotFoundError{Collection: collection, Key: key}
 	}
 
 	storageKey := vm.makeStorageKey(collection, key)
-	payload, err := vm.Manager.Get(storageKey, int(index))
-	if err != nil {
-		return nil, err
-	}
-
-	entry, err := DecodeEntry(payload)
+	entry, err := vm.Manager.GetEntry(storageKey, int(index))
 	if err != nil {
+		if errors.As(err, new(*types.BlockNotFoundError)) {
+			return nil, &types.BlockNotFoundError{Collection: collection, Key: key, Index: index}
+		}
 		return nil, fmt.Errorf("failed to decode entry: %w", err)
 	}
+	now := time.Now()
+	if entry.Expired(now) {
+		return nil, ErrExpired
+	}
+	return blockFromEntry(coll, key, index, entry, now), nil
+}
 
+// blockFromEntry returns the block stored as entry at index of key, with its
+// vector.
+func blockFromEntry(coll *Collection, key string, index uint32, entry *Entry, now time.Time) *types.BlockData {
 	block := &types.BlockData{
-		Primary:  string(entry.PrimaryData),
-		Keywords: entry.Keywords,
+		Primary:    string(entry.PrimaryData),
+		Keywords:   entry.Keywords,
+		TTLSeconds: entry.remainingTTL(now),
+		Version:    entry.Version,
 	}
 
-	if len(entry.SecondaryData) == 8 {
-		vectorID, _ := BytesToVectorID(entry.SecondaryData)
+	// The vector ID recorded in the entry is stale once the collection has
+	// been defragmented, so resolve it through the key index
+	if vectorID, err := coll.GetBlockVectorID(key, index); err == nil {
 		if vec, ok := coll.GetVectorByID(vectorID); ok {
 			block.Vector = vec
 		}
 	}
-
-	return block, nil
+	return block
 }
 
 // GetVector retrieves just the vector for a block.
@@ -312,7 +888,8 @@ func (vm *VectorManager) GetKeyLength(collection, key string) (uint32, error) {
 	return coll.GetKeyLength(key)
 }
 
-// GetKey retrieves all blocks for a key.
+// GetKey retrieves all blocks for a key. ScanKey reads them one at a time
+// instead.
 func (vm *VectorManager) GetKey(collection, key string) ([]types.BlockData, error) {
 	coll, err := vm.collections.GetCollection(collection)
 	if err != nil {
@@ -320,33 +897,23 @@ func (vm *VectorManager) GetKey(collection, key string) ([]types.BlockData, erro
 	}
 
 	if exists := coll.ContainsKey(key); !exists {
-		return nil, fmt.Errorf("key %q not found", key)
+		return nil, &types.KeyNotFoundError{Collection: collection, Key: key}
 	}
 
-	payloads, err := vm.Manager.GetAllValues(key)
-	if err != nil {
-		return nil, err
-	}
+	storageKey := vm.makeStorageKey(collection, key)
+	count := vm.Manager.GetLength(storageKey)
 
-	blocks := make([]types.BlockData, 0, len(payloads))
-	for _, p := range payloads {
-		entry, err := DecodeEntry(p)
+	now := time.Now()
+	blocks := make([]types.BlockData, 0, count)
+	for i := range count {
+		entry, err := vm.Manager.GetEntry(storageKey, i)
 		if err != nil {
 			continue // Skip malformed
 		}
-
-		block := types.BlockData{
-			Primary:  string(entry.PrimaryData),
-			Keywords: entry.Keywords,
-		}
-
-		if len(entry.SecondaryData) == 8 {
-			vid, _ := BytesToVectorID(entry.SecondaryData)
-			if vec, ok := coll.GetVectorByID(vid); ok {
-				block.Vector = vec
-			}
+		if entry.Expired(now) {
+			continue
 		}
-		blocks = append(blocks, block)
+		blocks = append(blocks, *blockFromEntry(coll, key, uint32(i), entry, now))
 	}
 
 	return blocks, nil
@@ -354,6 +921,19 @@ func (vm *VectorManager) GetKey(collection, key string) ([]types.BlockData, erro
 
 // DeleteKey deletes a key and all blocks.
 func (vm *VectorManager) DeleteKey(collection, key string) error {
+	return vm.DeleteKeyContext(context.Background(), collection, key)
+}
+
+// DeleteKeyContext is DeleteKey logging under the trace ID of ctx.
+func (vm *VectorManager) DeleteKeyContext(ctx context.Context, collection, key string) error {
+	if vm.ReadOnly() {
+		return ErrReadOnly
+	}
+	return vm.deleteKey(ctx, collection, key)
+}
+
+// deleteKey implements DeleteKey.
+func (vm *VectorManager) deleteKey(ctx context.Context, collection, key string) error {
 	coll, err := vm.collections.GetCollection(collection)
 	if err != nil {
 		return err
@@ -366,6 +946,8 @@ func (vm *VectorManager) DeleteKey(collection, key string) error {
 	if err := coll.DeleteKey(key); err != nil {
 		return err
 	}
+	metrics.VectorsTotal.WithLabelValues(collection).Set(float64(coll.DocMap.Count()))
+	logger.DebugContext(ctx, "key deleted", "collection", collection, "key", key)
 
 	// Note: Primary data in Manager not deleted, but index cleared in Collection.
 	return nil
@@ -380,32 +962,255 @@ func (vm *VectorManager) ListKeys(collection string) ([]string, error) {
 	return coll.ListKeys(), nil
 }
 
-// ContainsKey checks existence.
-func (vm *VectorManager) ContainsKey(collection, key string) (bool, error) {
+// ListKeysWithPrefix lists the keys starting with prefix, sorted.
+func (vm *VectorManager) ListKeysWithPrefix(collection, prefix string) ([]string, error) {
 	coll, err := vm.collections.GetCollection(collection)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return coll.ContainsKey(key), nil
+	return coll.ListKeysWithPrefix(prefix), nil
 }
 
-// UpdateBlock updates a block.
-func (vm *VectorManager) UpdateBlock(collection, key string, index uint32, block *types.BlockData) error {
-	// Stub
-	return fmt.Errorf("not implemented")
-}
+// ListKeysPaged lists up to limit keys starting with prefix that sort after
+// afterKey, sorted, and reports whether more follow. Iterate by passing the
+// last key returned as the next afterKey. A limit of 0 or less lists all
+// remaining keys.
+func (vm *VectorManager) ListKeysPaged(collection, prefix, afterKey string, limit int) (keys []string, hasMore bool, err error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, false, err
+	}
+	keys, hasMore = coll.ListKeysPaged(prefix, afterKey, limit)
+	return keys, hasMore, nil
+}
+
+// RepairCollections runs RepairManager.FullRepair on every collection.
+func (vm *VectorManager) RepairCollections() ([]*RepairReport, error) {
+	var reports []*RepairReport
+	for _, cfg := range vm.collections.ListCollections() {
+		report, err := vm.repair.FullRepair(cfg.Name)
+		if err != nil {
+			return reports, fmt.Errorf("repair of collection %q failed: %w", cfg.Name, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// DefragmentCollection renumbers the vector IDs of a collection to reclaim
+// the IDs of deleted vectors. See Collection.Defragment.
+func (vm *VectorManager) DefragmentCollection(collection string) error {
+	if vm.ReadOnly() {
+		return ErrReadOnly
+	}
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return err
+	}
+	return coll.Defragment()
+}
+
+// MigrateMetric re-indexes a collection with another distance metric. See
+// Collection.MigrateMetric. The migration is not written to the WAL, so
+// replicas have to be seeded again afterwards.
+func (vm *VectorManager) MigrateMetric(collection string, newMetric types.DistanceMetric) error {
+	if vm.ReadOnly() {
+		return ErrReadOnly
+	}
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return err
+	}
+	return coll.MigrateMetric(newMetric)
+}
+
+// CheckMetricMigration validates a MigrateMetric call without running it and
+// returns the number of vectors it would re-index.
+func (vm *VectorManager) CheckMetricMigration(collection string, newMetric types.DistanceMetric) (int, error) {
+	if vm.ReadOnly() {
+		return 0, ErrReadOnly
+	}
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return 0, err
+	}
+	return coll.CheckMetricMigration(newMetric)
+}
+
+// ContainsKey checks existence.
+func (vm *VectorManager) ContainsKey(collection, key string) (bool, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return false, err
+	}
+	return coll.ContainsKey(key), nil
+}
 
+// UpdateBlock replaces the vector, keywords, primary data and TTL of a block.
+// The block keeps its vector ID; the new record is appended to storage and the
+// old one is left for compaction. Every update increments the block's
+// version, as returned by GetBlock.
+func (vm *VectorManager) UpdateBlock(collection, key string, index uint32, block *types.BlockData) error {
+	if vm.ReadOnly() {
+		return ErrReadOnly
+	}
+	return vm.updateBlock(collection, key, index, block)
+}
+
+// updateBlock implements UpdateBlock.
+func (vm *VectorManager) updateBlock(collection, key string, index uint32, block *types.BlockData) error {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return err
+	}
+	if block.TTLSeconds < 0 {
+		return fmt.Errorf("invalid TTL %d: must not be negative", block.TTLSeconds)
+	}
+
+	if err := vm.wal.LogUpdate(collection, key, index, block.Vector, block.Keywords, []byte(block.Primary), block.TTLSeconds); err != nil {
+		return fmt.Errorf("WAL logging failed: %w", err)
+	}
+
+	// Holding the bucket lock from reading the stored version to writing the
+	// new record gives concurrent updates of the key distinct versions
+	locked := vm.Manager.LockBuckets([]string{vm.makeStorageKey(collection, key)})
+	err = vm.applyUpdate(coll, collection, key, index, block, locked)
+	locked.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := coll.FlushHNSW(); err != nil {
+		return fmt.Errorf("HNSW flush failed: %w", err)
+	}
+	return nil
+}
+
+// applyUpdate replaces an already logged block in the collection indexes and
+// writes its new entry through w. The bucket of the key must be locked, so
+// that the version of the new entry follows the stored one.
+func (vm *VectorManager) applyUpdate(coll *Collection, collection, key string, index uint32, block *types.BlockData, w payloadWriter) error {
+	vectorID, err := coll.UpdateBlock(key, index, block)
+	if err != nil {
+		return err
+	}
+	return vm.writeUpdate(coll, collection, key, index, block, vectorID, w)
+}
+
+// writeUpdate writes the entry of a block updated in the collection indexes
+// through w, one version past the stored entry.
+func (vm *VectorManager) writeUpdate(coll *Collection, collection, key string, index uint32, block *types.BlockData, vectorID uint64, w payloadWriter) error {
+	version, err := vm.blockVersion(collection, key, index)
+	if err != nil {
+		return err
+	}
+	loc, _ := coll.DocMap.Get(vectorID)
+
+	entry := &Entry{
+		Key:           []byte(key),
+		Keywords:      block.Keywords,
+		PrimaryData:   []byte(block.Primary),
+		SecondaryData: VectorIDToBytes(vectorID),
+		Flags:         types.EntryFlags{},
+		ExpiresAt:     loc.ExpiresAt,
+		Version:       version + 1,
+	}
+	if len(block.Vector) > 0 {
+		entry.Flags.DataType = types.DataTypeVector
+	}
+
+	encoded, err := EncodeEntry(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode entry: %w", err)
+	}
+
+	storageKey := vm.makeStorageKey(collection, key)
+	if err := w.Replace(storageKey, int(index), encoded); err != nil {
+		return fmt.Errorf("storage replace failed: %w", err)
+	}
+	return nil
+}
+
+// blockVersion returns the version of the stored entry of a block.
+func (vm *VectorManager) blockVersion(collection, key string, index uint32) (uint64, error) {
+	entry, err := vm.Manager.GetEntry(vm.makeStorageKey(collection, key), int(index))
+	if err != nil {
+		if errors.As(err, new(*types.KeyNotFoundError)) || errors.As(err, new(*types.BlockNotFoundError)) {
+			return 0, &types.BlockNotFoundError{Collection: collection, Key: key, Index: index}
+		}
+		return 0, fmt.Errorf("failed to read block version: %w", err)
+	}
+	return entry.Version, nil
+}
+
+// CompareAndSwapBlock updates a block like UpdateBlock if its version is
+// expectedVersion, and returns a *types.VersionConflictError otherwise. The
+// version check and the update happen under the collection write lock, so no
+// other write can come between them. Blocks that were never updated are at
+// version 0.
+func (vm *VectorManager) CompareAndSwapBlock(collection, key string, index uint32, expectedVersion uint64, newBlock *types.BlockData) error {
+	if vm.ReadOnly() {
+		return ErrReadOnly
+	}
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return err
+	}
+	if newBlock.TTLSeconds < 0 {
+		return fmt.Errorf("invalid TTL %d: must not be negative", newBlock.TTLSeconds)
+	}
+
+	// The bucket is locked before the collection, in the order transactions
+	// take them
+	locked := vm.Manager.LockBuckets([]string{vm.makeStorageKey(collection, key)})
+	defer locked.Unlock()
+
+	if err := coll.enter(); err != nil {
+		return err
+	}
+	defer coll.drainWg.Done()
+
+	coll.mu.Lock()
+	defer coll.mu.Unlock()
+
+	version, err := vm.blockVersion(collection, key, index)
+	if err != nil {
+		return err
+	}
+	if version != expectedVersion {
+		return &types.VersionConflictError{Collection: collection, Key: key, Index: index, Expected: expectedVersion, Actual: version}
+	}
+
+	if err := vm.wal.LogUpdate(collection, key, index, newBlock.Vector, newBlock.Keywords, []byte(newBlock.Primary), newBlock.TTLSeconds); err != nil {
+		return fmt.Errorf("WAL logging failed: %w", err)
+	}
+	vectorID, err := coll.updateBlockLocked(key, index, newBlock)
+	if err != nil {
+		return err
+	}
+	if err := vm.writeUpdate(coll, collection, key, index, newBlock, vectorID, locked); err != nil {
+		return err
+	}
+
+	if err := coll.FlushHNSWLocked(); err != nil {
+		return fmt.Errorf("HNSW flush failed: %w", err)
+	}
+	return nil
+}
+
+// ReplaceBlock replaces a block. Updates never overwrite records in place, so
+// this is the same as UpdateBlock.
 func (vm *VectorManager) ReplaceBlock(collection, key string, index uint32, block *types.BlockData) error {
 	return vm.UpdateBlock(collection, key, index, block)
 }
 
 // Search performs search.
 func (vm *VectorManager) Search(collection string, query []float32, topK uint32, mode string, keywords []string) ([]types.SearchResultItem, error) {
-	coll, err := vm.collections.GetCollection(collection)
-	if err != nil {
-		return nil, err
-	}
+	return vm.SearchVariant(collection, query, topK, mode, keywords, "primary")
+}
 
+// SearchVariant performs a search against the "primary" or "secondary" HNSW graph of a collection.
+func (vm *VectorManager) SearchVariant(collection string, query []float32, topK uint32, mode string, keywords []string, variant string) ([]types.SearchResultItem, error) {
 	filter := &types.SearchFilter{
 		Keywords:    keywords,
 		KeywordMode: "exact",
@@ -413,8 +1218,188 @@ func (vm *VectorManager) Search(collection string, query []float32, topK uint32,
 	if mode != "" {
 		filter.KeywordMode = mode
 	}
+	return vm.SearchWithFilter(collection, query, topK, filter, variant)
+}
 
-	results, err := coll.Search(query, topK, filter)
+// SearchWithFilter performs a search against the "primary" or "secondary" HNSW
+// graph of a collection with a caller-built filter.
+func (vm *VectorManager) SearchWithFilter(collection string, query []float32, topK uint32, filter *types.SearchFilter, variant string) ([]types.SearchResultItem, error) {
+	return vm.SearchWithFilterContext(context.Background(), collection, query, topK, filter, variant)
+}
+
+// SearchWithFilterContext is SearchWithFilter logging under the trace ID of
+// ctx. Once ctx is done the search stops with a *types.CancelledError, which
+// matches types.ErrCancelled. Searches of the primary graph of HNSW
+// collections are served from the search cache while the graph is unchanged.
+func (vm *VectorManager) SearchWithFilterContext(ctx context.Context, collection string, query []float32, topK uint32, filter *types.SearchFilter, variant string) ([]types.SearchResultItem, error) {
+	fail := func(err error) ([]types.SearchResultItem, error) {
+		metrics.SearchRequestsTotal.WithLabelValues(collection, metrics.StatusError).Inc()
+		logger.DebugContext(ctx, "search failed", "collection", collection, "variant", variant, "error", err)
+		return nil, err
+	}
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return fail(err)
+	}
+	warnings, err := coll.ValidateQuery(query)
+	if err != nil {
+		return fail(err)
+	}
+	for _, w := range warnings {
+		logger.DebugContext(ctx, "search query warning", "collection", collection, "code", w.Code, "warning", w.Message)
+	}
+
+	start := time.Now()
+	primary := variant == "" || variant == "primary"
+	var results []types.SearchResultItem
+	var cacheKey searchCacheKey
+	var version uint64
+	cached := false
+	if primary && coll.HNSWIndex != nil {
+		cacheKey = newSearchCacheKey(collection, query, topK, filter)
+		version = coll.HNSWIndex.DirtyCount()
+		results, cached = vm.searchCache.Get(cacheKey, version, start.Unix())
+	}
+	switch {
+	case cached:
+	case vm.adaptiveEfTarget > 0 && primary:
+		results, err = coll.AdaptiveSearchContext(ctx, query, topK, float64(vm.adaptiveEfTarget.Microseconds())/1000, filter)
+	default:
+		results, err = coll.SearchVariantContext(ctx, query, topK, filter, variant)
+	}
+	if err == nil && !cached && primary && coll.HNSWIndex != nil {
+		vm.searchCache.Put(cacheKey, version, coll.earliestExpiry(results), results)
+	}
+	metrics.SearchDuration.WithLabelValues(collection).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return fail(err)
+	}
+
+	// Blocks deleted or expired since the search are dropped
+	kept := results[:0]
+	for _, r := range results {
+		block, err := vm.GetBlock(collection, r.Key, r.Index)
+		switch {
+		case err == nil:
+			r.Block = block
+			kept = append(kept, r)
+		case errors.Is(err, ErrExpired), errors.As(err, new(*types.KeyNotFoundError)), errors.As(err, new(*types.BlockNotFoundError)):
+		default:
+			return fail(fmt.Errorf("failed to read block %d of %q: %w", r.Index, r.Key, err))
+		}
+	}
+	results = kept
+	metrics.SearchRequestsTotal.WithLabelValues(collection, metrics.StatusOK).Inc()
+
+	logger.DebugContext(ctx, "search completed", "collection", collection, "variant", variant, "top_k", topK,
+		"results", len(results), "cached", cached, "duration_ms", logger.Since(start))
+
+	return results, nil
+}
+
+// BatchSearchRequest is one query of a BatchSearch call.
+type BatchSearchRequest struct {
+	Collection string
+	Query      []float32
+	TopK       uint32
+	Filter     *types.SearchFilter
+}
+
+// maxBatchSearchWorkers bounds the number of queries of one BatchSearch call
+// that run at the same time.
+const maxBatchSearchWorkers = 16
+
+// BatchSearch runs independent searches against the primary graph of their
+// collections concurrently and returns one result list per request, in request
+// order. It fails if any of the searches fails.
+func (vm *VectorManager) BatchSearch(requests []BatchSearchRequest) ([][]types.SearchResultItem, error) {
+	results := make([][]types.SearchResultItem, len(requests))
+	errs := make([]error, len(requests))
+
+	sem := make(chan struct{}, min(maxBatchSearchWorkers, max(runtime.NumCPU(), 1)))
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			results[i], errs[i] = vm.SearchWithFilter(req.Collection, req.Query, req.TopK, req.Filter, "primary")
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("query %d: %w", i, err)
+		}
+	}
+	return results, nil
+}
+
+// SearchPaged returns search results one page at a time. The first call (empty
+// cursor) searches a candidate pool larger than EfSearch and caches the full
+// result list; later calls pass the returned cursor to read the next page from
+// the cache. nextCursor is empty after the last page. Cursors are opaque and
+// stop working once their results have been unused for the cache TTL.
+func (vm *VectorManager) SearchPaged(collection string, query []float32, pageSize uint32, cursor string, filter *types.SearchFilter) (results []types.SearchResultItem, nextCursor string, err error) {
+	if pageSize == 0 {
+		return nil, "", fmt.Errorf("page size must be positive")
+	}
+
+	var hits []pagedHit
+	var searchID uint64
+	start := 0
+	if cursor == "" {
+		coll, err := vm.collections.GetCollection(collection)
+		if err != nil {
+			return nil, "", err
+		}
+		hits, err = coll.pagedSearchPool(query, filter)
+		if err != nil {
+			return nil, "", err
+		}
+		searchID = vm.cursors.put(collection, hits)
+	} else {
+		var lastDistance float32
+		var lastVectorID uint64
+		searchID, lastDistance, lastVectorID, err = decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		var ok bool
+		if hits, ok = vm.cursors.get(searchID, collection); !ok {
+			return nil, "", errInvalidCursor
+		}
+		start = pageStart(hits, lastDistance, lastVectorID)
+	}
+
+	end := min(start+int(pageSize), len(hits))
+	results = make([]types.SearchResultItem, 0, end-start)
+	for _, hit := range hits[start:end] {
+		item := hit.Item
+		if block, err := vm.GetBlock(collection, item.Key, item.Index); err == nil {
+			item.Block = block
+		}
+		results = append(results, item)
+	}
+
+	if end >= len(hits) {
+		vm.cursors.remove(searchID)
+		return results, "", nil
+	}
+	return results, encodeCursor(searchID, hits[end-1]), nil
+}
+
+// HybridSearch ranks blocks by a weighted blend of vector similarity and BM25
+// keyword relevance; alpha = 1 is pure vector search, alpha = 0 pure keyword ranking
+// over the vector candidates.
+func (vm *VectorManager) HybridSearch(collection string, query []float32, keywords []string, topK uint32, alpha float32) ([]types.SearchResultItem, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := coll.HybridSearch(query, keywords, topK, alpha)
 	if err != nil {
 		return nil, err
 	}
@@ -429,12 +1414,182 @@ func (vm *VectorManager) Search(collection string, query []float32, topK uint32,
 	return results, nil
 }
 
-func (vm *VectorManager) SearchMLT(collection, key string, index uint32, topK uint32) ([]types.SearchResultItem, error) {
+// RangeSearch returns every block within radius of the query, optionally
+// restricted to blocks matching keywords.
+func (vm *VectorManager) RangeSearch(collection string, query []float32, radius float32, keywords []string) ([]types.SearchResultItem, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &types.SearchFilter{
+		Keywords:    keywords,
+		KeywordMode: "exact",
+	}
+	results, err := coll.RangeSearch(query, radius, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		block, err := vm.GetBlock(collection, results[i].Key, results[i].Index)
+		if err == nil {
+			results[i].Block = block
+		}
+	}
+	return results, nil
+}
+
+// SearchMLT finds blocks similar to the block at key/index. With excludeSelf the
+// source block itself is left out of the results.
+func (vm *VectorManager) SearchMLT(collection, key string, index uint32, topK uint32, excludeSelf bool) ([]types.SearchResultItem, error) {
 	vec, err := vm.GetVector(collection, key, index)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get query vector: %w", err)
 	}
-	return vm.Search(collection, vec, topK, "global", nil)
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &types.SearchFilter{}
+	if excludeSelf {
+		vectorID, err := coll.GetBlockVectorID(key, index)
+		if err != nil {
+			return nil, err
+		}
+		filter.ExcludeIDs = []uint64{vectorID}
+	}
+
+	results, err := coll.Search(vec, topK, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		block, err := vm.GetBlock(collection, results[i].Key, results[i].Index)
+		if err == nil {
+			results[i].Block = block
+		}
+	}
+	return results, nil
+}
+
+// SearchMLTKey finds blocks similar to a whole key by searching with the centroid
+// of the key's block vectors. Blocks without a vector or with an all-zero vector
+// do not contribute to the centroid. The source key is left out of the results.
+func (vm *VectorManager) SearchMLTKey(collection, key string, topK uint32) ([]types.SearchResultItem, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	centroid, err := vm.keyCentroid(coll, key)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := coll.Search(centroid, topK, &types.SearchFilter{ExcludeKeys: []string{key}})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		block, err := vm.GetBlock(collection, results[i].Key, results[i].Index)
+		if err == nil {
+			results[i].Block = block
+		}
+	}
+	return results, nil
+}
+
+// SearchByKey finds the blocks of targetKey nearest to the centroid of
+// queryKey's block vectors, for comparing two multi-chunk documents. The
+// centroid is computed as in SearchMLTKey.
+func (vm *VectorManager) SearchByKey(collection, targetKey, queryKey string, topK uint32) ([]types.SearchResultItem, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	centroid, err := vm.keyCentroid(coll, queryKey)
+	if err != nil {
+		return nil, err
+	}
+	return vm.SearchInKey(collection, targetKey, centroid, topK)
+}
+
+// SearchSimilarKeys returns the topK keys most similar to queryKey: the
+// centroid of queryKey's block vectors is searched against every other key,
+// and each key is ranked by its block nearest to the centroid. Each result
+// holds that block. queryKey itself is left out.
+func (vm *VectorManager) SearchSimilarKeys(collection, queryKey string, topK uint32) ([]types.SearchResultItem, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	centroid, err := vm.keyCentroid(coll, queryKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys may have many blocks, so widen the search until topK keys are found
+	filter := &types.SearchFilter{ExcludeKeys: []string{queryKey}}
+	var results []types.SearchResultItem
+	for k := max(topK, 1) * 4; ; k *= 2 {
+		blocks, err := coll.Search(centroid, k, filter)
+		if err != nil {
+			return nil, err
+		}
+		results = results[:0]
+		seen := make(map[string]bool)
+		for _, r := range blocks {
+			if !seen[r.Key] {
+				seen[r.Key] = true
+				results = append(results, r) // Blocks come nearest first
+			}
+		}
+		if uint32(len(results)) >= topK || uint32(len(blocks)) < k {
+			break
+		}
+	}
+	if uint32(len(results)) > topK {
+		results = results[:topK]
+	}
+
+	for i := range results {
+		block, err := vm.GetBlock(collection, results[i].Key, results[i].Index)
+		if err == nil {
+			results[i].Block = block
+		}
+	}
+	return results, nil
+}
+
+// keyCentroid returns the mean of a key's block vectors. Blocks without a
+// vector or with an all-zero vector do not contribute.
+func (vm *VectorManager) keyCentroid(coll *Collection, key string) ([]float32, error) {
+	blocks, err := vm.GetKey(coll.Config.Name, key)
+	if err != nil {
+		return nil, err
+	}
+
+	centroid := make([]float32, coll.Config.Dimensions)
+	var n int
+	for _, block := range blocks {
+		if len(block.Vector) != len(centroid) || !slices.ContainsFunc(block.Vector, func(v float32) bool { return v != 0 }) {
+			continue
+		}
+		for i, v := range block.Vector {
+			centroid[i] += v
+		}
+		n++
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("key %q has no non-zero vectors", key)
+	}
+	for i := range centroid {
+		centroid[i] /= float32(n)
+	}
+	return centroid, nil
 }
 
 func (vm *VectorManager) SearchInKey(collection, key string, query []float32, topK uint32) ([]types.SearchResultItem, error) {
@@ -470,12 +1625,331 @@ func (vm *VectorManager) KeywordSearch(collection string, keywords []string, mod
 	return coll.KeywordSearch(keywords, mode, maxDistance)
 }
 
+// KeywordSearchRanked returns the topK blocks matching the keywords, ranked by BM25.
+func (vm *VectorManager) KeywordSearchRanked(collection string, keywords []string, topK int, maxDistance uint32) ([]types.SearchResultItem, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	return coll.KeywordSearchRanked(keywords, topK, maxDistance)
+}
+
+// KeywordSearchRankedKeys returns the topK keys matching the keywords in
+// mode, ranked by the BM25 scores of their blocks. See
+// Collection.KeywordSearchRankedKeys.
+func (vm *VectorManager) KeywordSearchRankedKeys(collection string, keywords []string, mode string, topK int) ([]RankedKey, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	return coll.KeywordSearchRankedKeys(keywords, mode, topK)
+}
+
+// CollectionRecall estimates recall@k for a collection's HNSW index using
+// sampleSize randomly chosen stored vectors as queries. Flat collections
+// search exhaustively, so their recall is always 1.
+func (vm *VectorManager) CollectionRecall(collection string, sampleSize, k int) (float64, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return 0, err
+	}
+	if coll.HNSWIndex == nil {
+		if coll.Count() == 0 {
+			return 0, fmt.Errorf("collection %q has no vectors", collection)
+		}
+		return 1, nil
+	}
+
+	queries := coll.HNSWIndex.SampleVectors(sampleSize)
+	if len(queries) == 0 {
+		return 0, fmt.Errorf("collection %q has no vectors", collection)
+	}
+	return coll.HNSWIndex.ComputeRecall(queries, k)
+}
+
+// CollectionStats describes a collection and the health of its HNSW graphs.
+type CollectionStats struct {
+	Name          string     `json:"name"`
+	Vectors       uint64     `json:"vectors"`
+	Keys          int        `json:"keys"`
+	IndexType     string     `json:"index_type"`
+	HNSW          *HNSWStats `json:"hnsw,omitempty"`               // Nil for flat and PQ collections
+	AdaptiveEf    float64    `json:"adaptive_ef_search,omitempty"` // EfSearch learned by AdaptiveSearch
+	SecondaryHNSW *HNSWStats `json:"secondary_hnsw,omitempty"`
+	Warnings      []string   `json:"warnings"` // From HNSWWrapper.Validate
+}
+
+// CollectionStats returns graph statistics and validation warnings for a
+// collection. It walks every HNSW node, so it is meant for diagnosis rather
+// than frequent polling.
+func (vm *VectorManager) CollectionStats(collection string) (CollectionStats, error) {
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return CollectionStats{}, err
+	}
+
+	stats := CollectionStats{
+		Name:      collection,
+		Vectors:   coll.Count(),
+		Keys:      len(coll.ListKeys()),
+		IndexType: coll.Config.IndexType,
+		Warnings:  []string{},
+	}
+	if coll.HNSWIndex != nil {
+		hnsw := coll.HNSWIndex.Stats()
+		stats.HNSW = &hnsw
+		stats.AdaptiveEf = coll.LearnedEfSearch()
+		stats.Warnings = append(stats.Warnings, coll.HNSWIndex.Validate()...)
+	}
+	if coll.SecondaryHNSW != nil {
+		secondary := coll.SecondaryHNSW.Stats()
+		stats.SecondaryHNSW = &secondary
+		for _, w := range coll.SecondaryHNSW.Validate() {
+			stats.Warnings = append(stats.Warnings, "secondary: "+w)
+		}
+	}
+	return stats, nil
+}
+
+// StorageStats aggregates payload and bucket statistics with per-collection
+// index sizes.
+type StorageStats struct {
+	Payload     PayloadStats           `json:"payload"`
+	Buckets     []BucketStat           `json:"buckets"`
+	Collections []CollectionIndexSizes `json:"collections"`
+}
+
+// CollectionIndexSizes holds the on-disk sizes of a collection's index files.
+type CollectionIndexSizes struct {
+	Name         string `json:"name"`
+	HNSWBytes    int64  `json:"hnsw_bytes"`
+	FlatBytes    int64  `json:"flat_bytes,omitempty"`
+	PQBytes      int64  `json:"pq_bytes,omitempty"`
+	KeywordBytes int64  `json:"keyword_bytes"`
+	DocMapBytes  int64  `json:"docmap_bytes"`
+}
+
+// SearchCacheStats returns the hit, miss and eviction counts of the search
+// cache.
+func (vm *VectorManager) SearchCacheStats() CacheStats {
+	return vm.searchCache.Stats()
+}
+
+// MemStats returns the memory statistics of the Go runtime. Reading them
+// briefly stops the world, so it is meant for occasional diagnostics.
+func (vm *VectorManager) MemStats() runtime.MemStats {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats
+}
+
+// StorageStats returns payload and index statistics. See StorageStatsContext.
+func (vm *VectorManager) StorageStats() StorageStats {
+	stats, _ := vm.StorageStatsContext(context.Background())
+	return *stats
+}
+
+// StorageStatsContext scans all stored payloads, stopping early when ctx is cancelled.
+func (vm *VectorManager) StorageStatsContext(ctx context.Context) (*StorageStats, error) {
+	stats := &StorageStats{}
+	payload, err := vm.Manager.PayloadStats(ctx)
+	if payload != nil {
+		stats.Payload = *payload
+	}
+	if err != nil {
+		return stats, err
+	}
+	stats.Buckets = vm.Manager.BucketStats()
+
+	configs := vm.collections.ListCollections()
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name < configs[j].Name })
+	for _, cfg := range configs {
+		coll, err := vm.collections.GetCollection(cfg.Name)
+		if err != nil {
+			continue
+		}
+		stats.Collections = append(stats.Collections, CollectionIndexSizes{
+			Name:         cfg.Name,
+			HNSWBytes:    fileSize(filepath.Join(coll.basePath, "vectors.hnsw")) + fileSize(filepath.Join(coll.basePath, "vectors.hnsw.delta")),
+			FlatBytes:    fileSize(filepath.Join(coll.basePath, "vectors.flat")),
+			PQBytes:      fileSize(filepath.Join(coll.basePath, "vectors.pq")),
+			KeywordBytes: fileSize(filepath.Join(coll.basePath, "keywords.inv")),
+			DocMapBytes:  fileSize(filepath.Join(coll.basePath, "doc_map.bin")),
+		})
+	}
+	return stats, nil
+}
+
+// fileSize returns the size of a file, or 0 if it does not exist.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// WALSize returns the current size of the write-ahead log in bytes.
+func (vm *VectorManager) WALSize() (int64, error) {
+	return vm.wal.Size()
+}
+
+// Snapshot checkpoints the WAL and writes the bucket files, a copy of every
+// collection's indexes and the WAL to snapshots/<name> under the data path.
+// The snapshot is consistent if no writes run while it is taken.
+func (vm *VectorManager) Snapshot(name string) (*SnapshotStats, error) {
+	if err := vm.Checkpoint(); err != nil {
+		return nil, fmt.Errorf("checkpoint failed: %w", err)
+	}
+	stats, err := vm.Manager.Snapshot(name)
+	if err != nil {
+		return nil, err
+	}
+
+	snapPath := filepath.Join(vm.Config.DataPath, "snapshots", name)
+	meta, err := readSnapshotMeta(snapPath)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Collections, err = vm.snapshotCollections(snapPath); err != nil {
+		return nil, err
+	}
+	if err := vm.wal.copyTo(snapPath); err != nil {
+		return nil, fmt.Errorf("failed to copy WAL: %w", err)
+	}
+	meta.WAL = filepath.Base(vm.wal.filePath)
+	if err := writeSnapshotMeta(snapPath, meta); err != nil {
+		return nil, err
+	}
+	stats.Duration = time.Since(meta.CreatedAt)
+	return stats, nil
+}
+
+// SnapshotCollection saves a collection and copies its indexes to
+// snapshots/<collection>-<unix nanos> under the data path. Returns the
+// snapshot name. The bucket files are not included, so RestoreSnapshot only
+// restores the collection's indexes; records of deleted keys are found again
+// until the collection is compacted.
 func (vm *VectorManager) SnapshotCollection(collection string) (string, error) {
-	return "", fmt.Errorf("not implemented")
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return "", err
+	}
+	if err := coll.Save(); err != nil {
+		return "", fmt.Errorf("failed to save collection: %w", err)
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%d", collection, now.UnixNano())
+	snapPath := filepath.Join(vm.Config.DataPath, "snapshots", name)
+	if err := coll.snapshotTo(filepath.Join(snapPath, "indexes", collection)); err != nil {
+		return "", err
+	}
+	meta := &snapshotMeta{Name: name, CreatedAt: now, Collections: []string{collection}}
+	if err := writeSnapshotMeta(snapPath, meta); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// snapshotCollections copies the indexes of every collection to
+// snapPath/indexes and returns the collection names.
+func (vm *VectorManager) snapshotCollections(snapPath string) ([]string, error) {
+	var names []string
+	for _, config := range vm.collections.ListCollections() {
+		coll, err := vm.collections.GetCollection(config.Name)
+		if err != nil {
+			continue // Deleted meanwhile
+		}
+		if err := coll.snapshotTo(filepath.Join(snapPath, "indexes", config.Name)); err != nil {
+			return nil, fmt.Errorf("failed to snapshot collection %s: %w", config.Name, err)
+		}
+		names = append(names, config.Name)
+	}
+	return names, nil
 }
 
+// RestoreSnapshot restores a snapshot written by Snapshot or
+// SnapshotCollection. A full snapshot replaces the bucket files, all
+// collections and the WAL, then replays the WAL; a collection snapshot only
+// replaces the indexes of that collection. It must not run concurrently with
+// other operations.
+func (vm *VectorManager) RestoreSnapshot(snapshotName string) error {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	snapPath := filepath.Join(vm.Config.DataPath, "snapshots", snapshotName)
+	meta, err := readSnapshotMeta(snapPath)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot meta: %w", err)
+	}
+
+	if len(meta.Files) > 0 {
+		if err := vm.Manager.restoreBuckets(snapPath, meta); err != nil {
+			return err
+		}
+	}
+	// Only full snapshots carry the WAL; they hold every collection
+	full := meta.WAL != ""
+	if err := vm.collections.restoreFrom(filepath.Join(snapPath, "indexes"), meta.Collections, full); err != nil {
+		return err
+	}
+	if !full {
+		return nil
+	}
+	if err := vm.wal.restoreFrom(snapPath); err != nil {
+		return fmt.Errorf("failed to restore WAL: %w", err)
+	}
+	return vm.recoverFromWAL(vm.wal.filePath)
+}
+
+// CompactCollection reclaims the disk space held by keys deleted from a collection.
+// Their records are dropped from the storage index and every bucket holding data
+// for the collection is rewritten. Soft-deleted HNSW nodes and keyword postings
+// of deleted vectors are removed as well.
 func (vm *VectorManager) CompactCollection(collection string) error {
-	return fmt.Errorf("not implemented")
+	coll, err := vm.collections.GetCollection(collection)
+	if err != nil {
+		return err
+	}
+	if coll.HNSWIndex != nil {
+		if err := coll.HNSWIndex.Compact(); err != nil {
+			return fmt.Errorf("failed to compact HNSW index: %w", err)
+		}
+	}
+	removedKeys, err := coll.CompactKeywordIndex()
+	if err != nil {
+		return fmt.Errorf("failed to compact keyword index: %w", err)
+	}
+	if removedKeys > 0 {
+		logger.InfoAttrs("keyword index compacted", "collection", collection, "keys_removed", removedKeys)
+	}
+
+	prefix := vm.makeStorageKey(collection, "")
+	buckets := make(map[uint32]bool)
+	for _, storageKey := range vm.Manager.GetKeys() {
+		key, ok := strings.CutPrefix(storageKey, prefix)
+		if !ok {
+			continue
+		}
+		// DeleteKey only clears the collection, so its records are still indexed here
+		if !coll.ContainsKey(key) {
+			if err := vm.Manager.DeleteKey(storageKey); err != nil {
+				return fmt.Errorf("failed to delete key %q: %w", key, err)
+			}
+		}
+		buckets[vm.Manager.getBucketID(storageKey)] = true
+	}
+
+	for id := uint32(0); id < uint32(len(vm.Manager.Buckets)); id++ {
+		if !buckets[id] {
+			continue
+		}
+		if err := vm.Manager.Buckets[id].Compact(); err != nil {
+			return fmt.Errorf("failed to compact bucket %d: %w", id, err)
+		}
+	}
+	return nil
 }
 
 // Checkpoint clears the WAL.
@@ -486,13 +1960,27 @@ func (vm *VectorManager) Checkpoint() error {
 			coll.Save()
 		}
 	}
-	return vm.wal.Checkpoint()
+	if err := vm.wal.Checkpoint(); err != nil {
+		return err
+	}
+	if size, err := vm.wal.Size(); err == nil {
+		metrics.WALSizeBytes.Set(float64(size))
+	}
+	return nil
 }
 
 // Close closes everything.
 func (vm *VectorManager) Close() error {
+	vm.closeCoalescers()
+
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
+	if vm.flusher != nil {
+		vm.flusher.Stop()
+	}
+	if vm.sweeper != nil {
+		vm.sweeper.Stop()
+	}
 	vm.Checkpoint()
 	vm.wal.Close()
 	vm.collections.Close()
@@ -1,8 +1,19 @@
 package storage
 
 import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"waddlemap/internal/types"
 )
@@ -115,3 +126,1496 @@ func TestVectorManager_BlockOperations(t *testing.T) {
 		t.Errorf("Expected 0 results after delete, got %d", len(results))
 	}
 }
+
+func TestVectorManager_BatchAppendValidatesBeforeLogging(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("batch", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+
+	lsn := vm.wal.LSN()
+	keys := []string{"a", strings.Repeat("b", MaxKeyLength+1)}
+	blocks := []*types.BlockData{{Vector: []float32{1, 2}}, {Vector: []float32{3, 4}}}
+	successes, err := vm.BatchAppendBlocks("batch", keys, blocks)
+	if err == nil {
+		t.Fatal("Expected a batch with an unencodable block to fail")
+	}
+	if slices.Contains(successes, true) {
+		t.Errorf("Expected no block to be reported appended, got %v", successes)
+	}
+	if got := vm.wal.LSN(); got != lsn {
+		t.Errorf("Expected the rejected batch not to be logged, LSN %d -> %d", lsn, got)
+	}
+	if ok, _ := vm.ContainsKey("batch", "a"); ok {
+		t.Error("Expected the rejected batch not to be applied")
+	}
+}
+
+func TestVectorManager_BatchAppendBlocksSameKey(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("col", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"a", "b", "a", "a"}
+	blocks := []*types.BlockData{
+		{Primary: "a0", Vector: []float32{1, 0}},
+		{Primary: "b0", Vector: []float32{0, 1}},
+		{Primary: "a1", Vector: []float32{1, 1}},
+		{Primary: "a2", Vector: []float32{2, 2}},
+	}
+	if _, err := vm.BatchAppendBlocks("col", keys, blocks); err != nil {
+		t.Fatalf("BatchAppendBlocks failed: %v", err)
+	}
+	for _, want := range []struct {
+		key     string
+		index   uint32
+		primary string
+	}{{"a", 0, "a0"}, {"a", 1, "a1"}, {"a", 2, "a2"}, {"b", 0, "b0"}} {
+		block, err := vm.GetBlock("col", want.key, want.index)
+		if err != nil || block.Primary != want.primary {
+			t.Errorf("GetBlock(%s, %d) = %+v (err %v), want %s", want.key, want.index, block, err, want.primary)
+		}
+	}
+}
+
+func TestVectorManager_DeleteCollectionWithBackup(t *testing.T) {
+	tmpDir := t.TempDir()
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: tmpDir, SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("archive_me", 4, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	block := &types.BlockData{Primary: "hello", Vector: []float32{1, 0, 0, 0}, Keywords: []string{"greeting"}}
+	if _, err := vm.AppendBlock("archive_me", "doc1", block); err != nil {
+		t.Fatalf("AppendBlock failed: %v", err)
+	}
+
+	collDir := filepath.Join(tmpDir, "indexes", "archive_me")
+	backupDir := filepath.Join(t.TempDir(), "backup")
+	if err := vm.DeleteCollectionWithBackup("archive_me", backupDir); err != nil {
+		t.Fatalf("DeleteCollectionWithBackup failed: %v", err)
+	}
+
+	for _, name := range []string{"meta.json", "vectors.hnsw", "keywords.inv", "doc_map.bin", "blocks.gob"} {
+		if _, err := os.Stat(filepath.Join(backupDir, name)); err != nil {
+			t.Errorf("Backup missing %s: %v", name, err)
+		}
+	}
+	if meta, err := LoadCollectionMeta(backupDir); err != nil || meta.Name != "archive_me" {
+		t.Errorf("Backup meta.json invalid: %+v, %v", meta, err)
+	}
+
+	f, err := os.Open(filepath.Join(backupDir, "blocks.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var rec blockBackup
+	if err := gob.NewDecoder(f).Decode(&rec); err != nil {
+		t.Fatalf("Failed to decode blocks.gob: %v", err)
+	}
+	if rec.Key != "doc1" || len(rec.Blocks) != 1 || rec.Blocks[0].Primary != "hello" {
+		t.Errorf("Unexpected block backup record %+v", rec)
+	}
+	if _, err := os.Stat(collDir); !os.IsNotExist(err) {
+		t.Errorf("Expected collection directory to be removed, stat err: %v", err)
+	}
+	if _, err := vm.GetCollection("archive_me"); err == nil {
+		t.Error("Expected collection to be deleted")
+	}
+}
+
+func TestVectorManager_RestoreSnapshot(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		block := &types.BlockData{Primary: fmt.Sprintf("doc %d", i), Vector: []float32{float32(i), 1}, Keywords: []string{"snap"}}
+		if _, err := vm.AppendBlock("docs", fmt.Sprintf("doc%d", i), block); err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+	}
+	if _, err := vm.Snapshot("snap1"); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	// Written through the hard-linked bucket files after the snapshot
+	if _, err := vm.AppendBlock("docs", "late", &types.BlockData{Primary: "late", Vector: []float32{9, 9}}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := vm.DeleteKey("docs", fmt.Sprintf("doc%d", i)); err != nil {
+			t.Fatalf("DeleteKey failed: %v", err)
+		}
+	}
+
+	if err := vm.RestoreSnapshot("snap1"); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		block, err := vm.GetBlock("docs", fmt.Sprintf("doc%d", i), 0)
+		if err != nil {
+			t.Fatalf("GetBlock(doc%d) after restore failed: %v", i, err)
+		}
+		if want := fmt.Sprintf("doc %d", i); block.Primary != want {
+			t.Errorf("doc%d = %q, want %q", i, block.Primary, want)
+		}
+	}
+	if ok, _ := vm.ContainsKey("docs", "late"); ok {
+		t.Error("Expected key written after the snapshot to be gone")
+	}
+	if slices.Contains(vm.Manager.GetKeys(), collectionStorageKey("docs", "late")) {
+		t.Error("Expected bucket records written after the snapshot to be cut off")
+	}
+	results, err := vm.Search("docs", []float32{3, 1}, 1, "primary", nil)
+	if err != nil || len(results) != 1 || results[0].Key != "doc3" {
+		t.Fatalf("Expected search to find doc3, got %+v (err %v)", results, err)
+	}
+	if keys, _ := vm.KeywordSearch("docs", []string{"snap"}, "and", 0); len(keys) != 5 {
+		t.Errorf("Expected 5 keyword matches after restore, got %v", keys)
+	}
+
+	// A collection snapshot restores the indexes of that collection only
+	name, err := vm.SnapshotCollection("docs")
+	if err != nil {
+		t.Fatalf("SnapshotCollection failed: %v", err)
+	}
+	if err := vm.DeleteKey("docs", "doc2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.RestoreSnapshot(name); err != nil {
+		t.Fatalf("RestoreSnapshot(%s) failed: %v", name, err)
+	}
+	if block, err := vm.GetBlock("docs", "doc2", 0); err != nil || block.Primary != "doc 2" {
+		t.Errorf("Expected doc2 after collection restore, got %+v (err %v)", block, err)
+	}
+}
+
+func TestCollectionManager_DeleteCollectionWithBackupPreservesOnFailure(t *testing.T) {
+	cm, err := NewCollectionManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	if err := cm.CreateCollection("keep_me", 4, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+
+	// A regular file where the backup directory should go makes the snapshot fail.
+	blocker := filepath.Join(t.TempDir(), "not_a_dir")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.DeleteCollectionWithBackup("keep_me", blocker); err == nil {
+		t.Fatal("Expected backup to fail")
+	}
+	if _, err := cm.GetCollection("keep_me"); err != nil {
+		t.Errorf("Collection should be preserved after failed backup: %v", err)
+	}
+}
+
+// TestVectorManager_ConcurrentAccess mixes writers, readers and background
+// flushes so that `go test -race` can flag unprotected shared state.
+func TestVectorManager_ConcurrentAccess(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{
+		DataPath:      t.TempDir(),
+		SyncMode:      "normal",
+		FlushInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("race", 4, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, ops = 4, 25
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		key := fmt.Sprintf("doc%d", w)
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < ops; i++ {
+				block := &types.BlockData{
+					Primary:  "payload",
+					Vector:   []float32{float32(w), float32(i), 1, 0},
+					Keywords: []string{"shared", key},
+				}
+				if _, err := vm.AppendBlock("race", key, block); err != nil {
+					t.Errorf("AppendBlock failed: %v", err)
+					return
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < ops; i++ {
+				vm.Search("race", []float32{1, 1, 1, 0}, 5, "exact", []string{"shared"})
+				vm.KeywordSearch("race", []string{"shar"}, "partial", 0)
+				vm.GetKeyLength("race", key)
+				vm.ListKeys("race")
+				vm.GetKey("race", key)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := vm.DeleteKey("race", "doc0"); err != nil {
+		t.Fatalf("DeleteKey failed: %v", err)
+	}
+	if err := vm.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+}
+
+func TestVectorManager_SearchMLTExcludeSelf(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("mlt", 4, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	vectors := map[string][]float32{
+		"source":  {1, 0, 0, 0},
+		"near":    {0.9, 0.1, 0, 0},
+		"nearer":  {0.95, 0.05, 0, 0},
+		"distant": {0, 0, 0, 1},
+	}
+	for key, vec := range vectors {
+		if _, err := vm.AppendBlock("mlt", key, &types.BlockData{Primary: key, Vector: vec}); err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+	}
+
+	results, err := vm.SearchMLT("mlt", "source", 0, 3, false)
+	if err != nil {
+		t.Fatalf("SearchMLT failed: %v", err)
+	}
+	if len(results) == 0 || results[0].Key != "source" {
+		t.Fatalf("Expected source as the top hit without ExcludeSelf, got %+v", results)
+	}
+
+	results, err = vm.SearchMLT("mlt", "source", 0, 3, true)
+	if err != nil {
+		t.Fatalf("SearchMLT failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results with ExcludeSelf, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.Key == "source" {
+			t.Errorf("Source document returned with ExcludeSelf: %+v", results)
+		}
+	}
+	if results[0].Key != "nearer" {
+		t.Errorf("Expected nearer as the top hit, got %s", results[0].Key)
+	}
+}
+
+func TestVectorManager_RangeSearchKeywords(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("rng", 2, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	blocks := []struct {
+		key     string
+		vec     []float32
+		keyword string
+	}{
+		{"a", []float32{0, 0}, "red"},
+		{"b", []float32{0.5, 0}, "blue"},
+		{"c", []float32{0, 0.8}, "red"},
+		{"d", []float32{5, 5}, "red"},
+	}
+	for _, b := range blocks {
+		block := &types.BlockData{Primary: b.key, Vector: b.vec, Keywords: []string{b.keyword}}
+		if _, err := vm.AppendBlock("rng", b.key, block); err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+	}
+
+	results, err := vm.RangeSearch("rng", []float32{0, 0}, 1, nil)
+	if err != nil {
+		t.Fatalf("RangeSearch failed: %v", err)
+	}
+	var keys []string
+	for _, r := range results {
+		keys = append(keys, r.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Errorf("Expected [a b c] by distance, got %v", keys)
+	}
+	if results[0].Block == nil || results[0].Block.Primary != "a" {
+		t.Errorf("Expected block data attached, got %+v", results[0].Block)
+	}
+
+	results, err = vm.RangeSearch("rng", []float32{0, 0}, 1, []string{"red"})
+	if err != nil {
+		t.Fatalf("RangeSearch failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Key != "a" || results[1].Key != "c" {
+		t.Errorf("Expected [a c] with keyword filter, got %+v", results)
+	}
+
+	results, err = vm.RangeSearch("rng", []float32{0, 0}, 1, []string{"green"})
+	if err != nil || len(results) != 0 {
+		t.Errorf("Expected no results for an unmatched keyword, got %d (%v)", len(results), err)
+	}
+}
+
+func TestVectorManager_CompactCollection(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("cmp", 2, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("doc-%d", i)
+		block := &types.BlockData{Primary: strings.Repeat(key, 50), Vector: []float32{float32(i), 1}}
+		if _, err := vm.AppendBlock("cmp", key, block); err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+	}
+	for i := 0; i < 50; i += 2 {
+		if err := vm.DeleteKey("cmp", fmt.Sprintf("doc-%d", i)); err != nil {
+			t.Fatalf("DeleteKey failed: %v", err)
+		}
+	}
+
+	totalBytes := func() int64 {
+		stats, err := vm.CompactionStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var total int64
+		for _, st := range stats {
+			total += st.TotalBytes
+		}
+		return total
+	}
+	before := totalBytes()
+
+	if err := vm.CompactCollection("cmp"); err != nil {
+		t.Fatalf("CompactCollection failed: %v", err)
+	}
+	if after := totalBytes(); after >= before {
+		t.Errorf("Expected compaction to shrink bucket files, %d -> %d bytes", before, after)
+	}
+
+	block, err := vm.GetBlock("cmp", "doc-7", 0)
+	if err != nil {
+		t.Fatalf("GetBlock failed after compaction: %v", err)
+	}
+	if block.Primary != strings.Repeat("doc-7", 50) {
+		t.Errorf("Unexpected primary data after compaction: %q", block.Primary)
+	}
+	if err := vm.CompactCollection("missing"); err == nil {
+		t.Error("Expected an error compacting an unknown collection")
+	}
+}
+
+func TestVectorManager_CompactCollectionDeleteError(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("cmp", 2, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	if _, err := vm.AppendBlock("cmp", "gone", &types.BlockData{Primary: "x", Vector: []float32{1, 1}}); err != nil {
+		t.Fatalf("AppendBlock failed: %v", err)
+	}
+	if err := vm.DeleteKey("cmp", "gone"); err != nil {
+		t.Fatalf("DeleteKey failed: %v", err)
+	}
+
+	// Swap in a read-only handle so the tombstone write fails
+	bucket := vm.Manager.Buckets[vm.Manager.getBucketID(vm.makeStorageKey("cmp", "gone"))]
+	readOnly, err := os.Open(bucket.File.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket.File.Close()
+	bucket.File = readOnly
+
+	if err := vm.CompactCollection("cmp"); err == nil || !strings.Contains(err.Error(), "gone") {
+		t.Errorf("Expected a key deletion error, got %v", err)
+	}
+}
+
+func TestVectorManager_UpdateBlock(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("upd", 2, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	if _, err := vm.AppendBlock("upd", "a", &types.BlockData{Primary: "old", Vector: []float32{1, 0}, Keywords: []string{"stale"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("upd", "b", &types.BlockData{Primary: "other", Vector: []float32{0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	coll, err := vm.GetCollection("upd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldID, err := coll.GetBlockVectorID("a", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := &types.BlockData{Primary: strings.Repeat("new primary data ", 20), Vector: []float32{-1, 0}, Keywords: []string{"fresh"}}
+	if err := vm.UpdateBlock("upd", "a", 0, updated); err != nil {
+		t.Fatalf("UpdateBlock failed: %v", err)
+	}
+
+	results, err := vm.Search("upd", []float32{-1, 0}, 1, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Key != "a" || results[0].Distance != 0 {
+		t.Errorf("Expected the updated vector as the nearest hit, got %+v", results)
+	}
+
+	// Nothing is left at the old position
+	results, err = vm.RangeSearch("upd", []float32{1, 0}, 0.5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Expected the old vector to be unreachable, got %+v", results)
+	}
+
+	if keys, _ := vm.KeywordSearch("upd", []string{"stale"}, "exact", 0); len(keys) != 0 {
+		t.Errorf("Expected old keywords to be removed, got %v", keys)
+	}
+	if keys, _ := vm.KeywordSearch("upd", []string{"fresh"}, "exact", 0); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("Expected new keywords to match key a, got %v", keys)
+	}
+
+	block, err := vm.GetBlock("upd", "a", 0)
+	if err != nil {
+		t.Fatalf("GetBlock failed: %v", err)
+	}
+	if block.Primary != updated.Primary {
+		t.Errorf("Expected updated primary data, got %q", block.Primary)
+	}
+	if newID, _ := coll.GetBlockVectorID("a", 0); newID != oldID {
+		t.Errorf("Expected vector ID %d to be kept, got %d", oldID, newID)
+	}
+	if n, _ := vm.GetKeyLength("upd", "a"); n != 1 {
+		t.Errorf("Expected key length 1 after update, got %d", n)
+	}
+
+	if err := vm.UpdateBlock("upd", "a", 5, updated); err == nil {
+		t.Error("Expected an error updating a missing block")
+	}
+}
+
+func TestVectorManager_CompareAndSwapBlock(t *testing.T) {
+	cfg := &types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"}
+	vm, err := NewVectorManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CreateCollection("cas", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("cas", "a", &types.BlockData{Primary: "v0", Vector: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	version := func() uint64 {
+		t.Helper()
+		block, err := vm.GetBlock("cas", "a", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return block.Version
+	}
+	if v := version(); v != 0 {
+		t.Fatalf("Expected a new block at version 0, got %d", v)
+	}
+
+	if err := vm.UpdateBlock("cas", "a", 0, &types.BlockData{Primary: "v1", Vector: []float32{0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(); v != 1 {
+		t.Errorf("Expected version 1 after an update, got %d", v)
+	}
+
+	err = vm.CompareAndSwapBlock("cas", "a", 0, 0, &types.BlockData{Primary: "stale", Vector: []float32{1, 1}})
+	var conflict *types.VersionConflictError
+	if !errors.Is(err, types.ErrVersionConflict) || !errors.As(err, &conflict) || conflict.Expected != 0 || conflict.Actual != 1 {
+		t.Errorf("CompareAndSwapBlock at a stale version returned %v", err)
+	}
+	if block, _ := vm.GetBlock("cas", "a", 0); block.Primary != "v1" {
+		t.Errorf("Expected a conflicting swap to leave the block alone, got %q", block.Primary)
+	}
+
+	if err := vm.CompareAndSwapBlock("cas", "a", 0, 1, &types.BlockData{Primary: "v2", Vector: []float32{-1, 0}}); err != nil {
+		t.Fatalf("CompareAndSwapBlock failed: %v", err)
+	}
+	if block, _ := vm.GetBlock("cas", "a", 0); block.Primary != "v2" || block.Version != 2 {
+		t.Errorf("Expected v2 at version 2, got %q at %d", block.Primary, block.Version)
+	}
+	results, err := vm.Search("cas", []float32{-1, 0}, 1, "", nil)
+	if err != nil || len(results) != 1 || results[0].Distance != 0 {
+		t.Errorf("Expected the swapped vector as the nearest hit, got %+v (%v)", results, err)
+	}
+	if err := vm.CompareAndSwapBlock("cas", "a", 3, 0, &types.BlockData{}); !errors.Is(err, types.ErrKeyNotFound) {
+		t.Errorf("CompareAndSwapBlock on a missing block returned %v", err)
+	}
+
+	// Of concurrent swaps from the same version exactly one wins
+	var wg sync.WaitGroup
+	var won atomic.Int32
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := vm.CompareAndSwapBlock("cas", "a", 0, 2, &types.BlockData{Primary: fmt.Sprint(i), Vector: []float32{float32(i), 0}})
+			if err == nil {
+				won.Add(1)
+			} else if !errors.Is(err, types.ErrVersionConflict) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if won.Load() != 1 {
+		t.Errorf("Expected one of the concurrent swaps to win, %d did", won.Load())
+	}
+
+	// The version survives a restart
+	vm.Close()
+	if vm, err = NewVectorManager(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if v := version(); v != 3 {
+		t.Errorf("Expected version 3 after reopening, got %d", v)
+	}
+}
+
+func TestVectorManager_KeywordSearchRanked(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("kw", 2, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	docs := map[string][]string{
+		"both":  {"finance", "report"},
+		"one":   {"finance", "weekly", "summary", "notes"},
+		"other": {"sports"},
+	}
+	for key, keywords := range docs {
+		if _, err := vm.AppendBlock("kw", key, &types.BlockData{Primary: key, Vector: []float32{1, 1}, Keywords: keywords}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := vm.KeywordSearchRanked("kw", []string{"finance", "report"}, 10, 0)
+	if err != nil {
+		t.Fatalf("KeywordSearchRanked failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Key != "both" || results[1].Key != "one" {
+		t.Fatalf("Expected [both one], got %+v", results)
+	}
+	if results[0].Score <= results[1].Score {
+		t.Errorf("Expected descending scores, got %+v", results)
+	}
+
+	// A misspelled keyword matches within the edit distance
+	results, err = vm.KeywordSearchRanked("kw", []string{"fnance"}, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Key != "both" {
+		t.Errorf("Expected the shortest finance document for a fuzzy query, got %+v", results)
+	}
+}
+
+func TestVectorManager_KeywordSearchRankedKeys(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("kw", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	blocks := []struct {
+		key      string
+		keywords []string
+	}{
+		{"guide", []string{"finance", "intro"}},
+		{"guide", []string{"finance", "taxes"}},
+		{"memo", []string{"finance", "finance", "budget"}},
+		{"notes", []string{"financial", "planning", "weekly", "summary"}},
+		{"sports", []string{"football"}},
+	}
+	for _, b := range blocks {
+		if _, err := vm.AppendBlock("kw", b.key, &types.BlockData{Primary: b.key, Keywords: b.keywords}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := func(ranked []RankedKey) []string {
+		out := make([]string, len(ranked))
+		for i, rk := range ranked {
+			out[i] = rk.Key
+		}
+		return out
+	}
+
+	// Scores add up over the blocks of a key
+	ranked, err := vm.KeywordSearchRankedKeys("kw", []string{"finance"}, "exact", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(ranked); !slices.Equal(got, []string{"guide", "memo"}) || ranked[0].Score <= ranked[1].Score {
+		t.Errorf("Ranked %+v, want guide then memo", ranked)
+	}
+	// A key matching in exact mode scores all its blocks
+	ranked, err = vm.KeywordSearchRankedKeys("kw", []string{"finance", "taxes"}, "exact", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranked) != 1 || ranked[0].Key != "guide" {
+		t.Errorf("Ranked %+v, want guide only", ranked)
+	}
+	// Prefix mode scores the keywords it selects
+	ranked, err = vm.KeywordSearchRankedKeys("kw", []string{"financ"}, "prefix", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranked) != 2 || ranked[1].Score <= 0 {
+		t.Errorf("Ranked %+v, want 2 keys with scores", ranked)
+	}
+	if ranked, err := vm.KeywordSearchRankedKeys("kw", []string{"missing"}, "any", 0); err != nil || len(ranked) != 0 {
+		t.Errorf("Ranked %+v, %v for an unknown keyword", ranked, err)
+	}
+	if _, err := vm.KeywordSearchRankedKeys("missing", []string{"finance"}, "any", 0); !errors.Is(err, types.ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound, got %v", err)
+	}
+}
+
+func TestVectorManager_KeywordSearchAny(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("any", 2, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	docs := map[string][]string{"a": {"red", "blue"}, "b": {"blue"}, "c": {"green"}}
+	for key, keywords := range docs {
+		if _, err := vm.AppendBlock("any", key, &types.BlockData{Primary: key, Vector: []float32{1, 0}, Keywords: keywords}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := vm.KeywordSearch("any", []string{"red", "blue"}, "any", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"a", "b"}) {
+		t.Errorf("KeywordSearch(any) = %v, want [a b]", keys)
+	}
+
+	results, err := vm.Search("any", []float32{1, 0}, 10, "any", []string{"red", "green"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, r := range results {
+		found = append(found, r.Key)
+	}
+	slices.Sort(found)
+	if !slices.Equal(found, []string{"a", "c"}) {
+		t.Errorf("Search with mode any = %v, want [a c]", found)
+	}
+}
+
+func TestVectorManager_KeywordNGramSizes(t *testing.T) {
+	cfg := &types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"}
+	vm, err := NewVectorManager(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer func() { vm.Close() }()
+
+	for _, sizes := range [][]int{{0}, {2, 2}, {MaxKeywordLength + 1}} {
+		err := vm.CreateCollectionWithConfig(types.CollectionConfig{Name: "bad", Dimensions: 2, Metric: types.MetricL2, NGramSizes: sizes})
+		if !errors.Is(err, types.ErrInvalidConfig) {
+			t.Errorf("CreateCollectionWithConfig with n-gram sizes %v = %v, want ErrInvalidConfig", sizes, err)
+		}
+	}
+
+	for _, coll := range []types.CollectionConfig{
+		{Name: "trigrams", Dimensions: 2, Metric: types.MetricL2},
+		{Name: "bigrams", Dimensions: 2, Metric: types.MetricL2, NGramSizes: []int{2}},
+	} {
+		if err := vm.CreateCollectionWithConfig(coll); err != nil {
+			t.Fatal(err)
+		}
+		for key, keyword := range map[string]string{"fin": "finance", "sci": "science"} {
+			block := &types.BlockData{Primary: key, Vector: []float32{1, 0}, Keywords: []string{keyword}}
+			if _, err := vm.AppendBlock(coll.Name, key, block); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Only the bigram index finds a two-letter substring
+	check := func() {
+		t.Helper()
+		for coll, want := range map[string][]string{"trigrams": nil, "bigrams": {"fin", "sci"}} {
+			keys, err := vm.KeywordSearch(coll, []string{"nc"}, "partial", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(keys)
+			if !slices.Equal(keys, want) {
+				t.Errorf("Partial search of %s for nc = %v, want %v", coll, keys, want)
+			}
+		}
+	}
+	check()
+
+	// The sizes are kept in meta.json and checked against keywords.inv on load
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if vm, err = NewVectorManager(cfg); err != nil {
+		t.Fatal(err)
+	}
+	coll, _ := vm.collections.GetCollection("bigrams")
+	if !slices.Equal(coll.Config.NGramSizes, []int{2}) {
+		t.Errorf("NGramSizes after reload = %v, want [2]", coll.Config.NGramSizes)
+	}
+	check()
+}
+
+func TestVectorManager_KeywordTokenizationModes(t *testing.T) {
+	cfg := &types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"}
+	vm, err := NewVectorManager(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer func() { vm.Close() }()
+
+	for _, coll := range []types.CollectionConfig{
+		{Name: "ngram", Dimensions: 2, Metric: types.MetricL2},
+		{Name: "cjk", Dimensions: 2, Metric: types.MetricL2, TokenizationMode: TokenizeCJKChar},
+		{Name: "words", Dimensions: 2, Metric: types.MetricL2, TokenizationMode: TokenizeWhitespace},
+	} {
+		if err := vm.CreateCollectionWithConfig(coll); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, bad := range []types.CollectionConfig{
+		{Name: "bad", Dimensions: 2, Metric: types.MetricL2, TokenizationMode: "stemmed"},
+		{Name: "bad", Dimensions: 2, Metric: types.MetricL2, TokenizationMode: TokenizeWhitespace, NGramSizes: []int{2}},
+	} {
+		if err := vm.CreateCollectionWithConfig(bad); !errors.Is(err, types.ErrInvalidConfig) {
+			t.Errorf("CreateCollectionWithConfig(%+v) = %v, want ErrInvalidConfig", bad, err)
+		}
+	}
+
+	appendBlock := func(coll, key, keyword string) error {
+		_, err := vm.AppendBlock(coll, key, &types.BlockData{Primary: key, Vector: []float32{1, 0}, Keywords: []string{keyword}})
+		return err
+	}
+	for key, keyword := range map[string]string{"db": "数据库", "analysis": "数据分析", "library": "图书馆", "fin": "finance"} {
+		if err := appendBlock("cjk", key, keyword); err != nil {
+			t.Fatalf("AppendBlock(cjk, %s): %v", keyword, err)
+		}
+	}
+	for key, keyword := range map[string]string{"ml": "machine learning", "dl": "deep learning models"} {
+		if err := appendBlock("words", key, keyword); err != nil {
+			t.Fatalf("AppendBlock(words, %s): %v", keyword, err)
+		}
+	}
+	// Each mode only accepts the keywords it can tokenize
+	for _, tc := range []struct{ coll, keyword string }{
+		{"ngram", "数据库"},
+		{"ngram", "machine learning"},
+		{"cjk", "machine learning"},
+		{"words", "machine  learning"},
+		{"words", "semi;colon"},
+	} {
+		if err := appendBlock(tc.coll, "rejected", tc.keyword); err == nil {
+			t.Errorf("AppendBlock(%s, %q) succeeded", tc.coll, tc.keyword)
+		}
+	}
+	for _, name := range []string{"ngram", "cjk", "words"} {
+		if coll, _ := vm.collections.GetCollection(name); coll.ContainsKey("rejected") {
+			t.Errorf("A rejected block was added to %s", name)
+		}
+	}
+
+	check := func() {
+		t.Helper()
+		for _, tc := range []struct {
+			coll, query string
+			want        []string
+		}{
+			{"cjk", "数据", []string{"analysis", "db"}},
+			{"cjk", "据库", []string{"db"}},
+			{"cjk", "书", []string{"library"}},
+			{"cjk", "nanc", []string{"fin"}},
+			{"words", "learning", []string{"dl", "ml"}},
+			{"words", "models", []string{"dl"}},
+		} {
+			results, err := vm.Search(tc.coll, []float32{1, 0}, 10, "partial", []string{tc.query})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, r := range results {
+				keys = append(keys, r.Key)
+			}
+			slices.Sort(keys)
+			if !slices.Equal(keys, tc.want) {
+				t.Errorf("Partial search of %s for %q = %v, want %v", tc.coll, tc.query, keys, tc.want)
+			}
+		}
+	}
+	check()
+
+	// The mode is kept in meta.json and checked against keywords.inv on load
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if vm, err = NewVectorManager(cfg); err != nil {
+		t.Fatal(err)
+	}
+	check()
+}
+
+func TestVectorManager_JaccardKeywordFilter(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("tags", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	blocks := map[string][]string{
+		"same":    {"go", "db"},
+		"partial": {"go", "db", "vector", "search"},
+		"one":     {"go", "web", "api"},
+		"none":    {"rust"},
+	}
+	for key, keywords := range blocks {
+		if _, err := vm.AppendBlock("tags", key, &types.BlockData{Vector: []float32{1, 0}, Keywords: keywords}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(threshold float32) []string {
+		t.Helper()
+		filter := &types.SearchFilter{Keywords: []string{"go", "db"}, KeywordMode: "jaccard", JaccardThreshold: threshold}
+		results, err := vm.SearchWithFilter("tags", []float32{1, 0}, 10, filter, "primary")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, r := range results {
+			keys = append(keys, r.Key)
+		}
+		slices.Sort(keys)
+		return keys
+	}
+	if got := search(0); !slices.Equal(got, []string{"one", "partial", "same"}) {
+		t.Errorf("Jaccard filter without a threshold matched %v", got)
+	}
+	if got := search(0.5); !slices.Equal(got, []string{"partial", "same"}) {
+		t.Errorf("Jaccard filter at 0.5 matched %v", got)
+	}
+}
+
+func TestVectorManager_HybridSearch(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("hyb", 2, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	blocks := map[string]*types.BlockData{
+		"near":    {Primary: "near", Vector: []float32{1, 0}, Keywords: []string{"sports"}},
+		"topical": {Primary: "topical", Vector: []float32{0.9, 0.2}, Keywords: []string{"finance", "report"}},
+		"far":     {Primary: "far", Vector: []float32{-1, 0}, Keywords: []string{"finance"}},
+	}
+	for key, block := range blocks {
+		if _, err := vm.AppendBlock("hyb", key, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := []float32{1, 0}
+	keys := func(results []types.SearchResultItem) []string {
+		out := make([]string, len(results))
+		for i, r := range results {
+			out[i] = r.Key
+		}
+		return out
+	}
+
+	// Pure vector ranking
+	results, err := vm.HybridSearch("hyb", query, []string{"finance", "report"}, 3, 1)
+	if err != nil {
+		t.Fatalf("HybridSearch failed: %v", err)
+	}
+	if got := keys(results); !slices.Equal(got, []string{"near", "topical", "far"}) {
+		t.Errorf("alpha=1 order = %v, want [near topical far]", got)
+	}
+
+	// Keyword relevance lifts the slightly more distant block to the top
+	results, err = vm.HybridSearch("hyb", query, []string{"finance", "report"}, 2, 0.3)
+	if err != nil {
+		t.Fatalf("HybridSearch failed: %v", err)
+	}
+	if got := keys(results); !slices.Equal(got, []string{"topical", "far"}) {
+		t.Errorf("alpha=0.3 order = %v, want [topical far]", got)
+	}
+	if results[0].Score <= results[1].Score || results[0].Block == nil {
+		t.Errorf("Expected descending scores with blocks attached, got %+v", results)
+	}
+
+	if _, err := vm.HybridSearch("hyb", query, nil, 3, 1.5); err == nil {
+		t.Error("Expected an error for alpha outside [0,1]")
+	}
+}
+
+func TestVectorManager_SearchPaged(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal", CursorTTL: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("pages", 2, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		if _, err := vm.AppendBlock("pages", fmt.Sprintf("k%02d", i), &types.BlockData{Primary: "p", Vector: []float32{float32(i), 0}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var keys []string
+	cursor := ""
+	for page := 0; ; page++ {
+		results, next, err := vm.SearchPaged("pages", []float32{0, 0}, 10, cursor, nil)
+		if err != nil {
+			t.Fatalf("SearchPaged page %d failed: %v", page, err)
+		}
+		if next != "" && len(results) != 10 {
+			t.Fatalf("Expected a full page before the last, got %d results", len(results))
+		}
+		for _, r := range results {
+			if r.Block == nil {
+				t.Errorf("Expected block attached to %s", r.Key)
+			}
+			keys = append(keys, r.Key)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(keys) != 25 {
+		t.Fatalf("Expected 25 results across pages, got %d", len(keys))
+	}
+	for i, key := range keys {
+		if key != fmt.Sprintf("k%02d", i) {
+			t.Fatalf("Result %d = %s, pages out of order: %v", i, key, keys)
+		}
+	}
+
+	// The cache entry is dropped after the last page
+	if _, _, err := vm.SearchPaged("pages", nil, 10, cursor, nil); err == nil {
+		t.Error("Expected an exhausted cursor to be rejected")
+	}
+
+	_, next, err := vm.SearchPaged("pages", []float32{0, 0}, 5, "", nil)
+	if err != nil || next == "" {
+		t.Fatalf("Expected a cursor for the first page, got %q (%v)", next, err)
+	}
+	if _, _, err := vm.SearchPaged("other", nil, 5, next, nil); err == nil {
+		t.Error("Expected a cursor to be rejected for a different collection")
+	}
+	if _, _, err := vm.SearchPaged("pages", nil, 5, "not-a-cursor", nil); err == nil {
+		t.Error("Expected a malformed cursor to be rejected")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, _, err := vm.SearchPaged("pages", nil, 5, next, nil); err == nil {
+		t.Error("Expected the cursor to expire after the TTL")
+	}
+}
+
+func TestVectorManager_SearchMLTKey(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("mlt", 2, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	// The centroid of src is (1, 1); the zero vector must not pull it toward the origin
+	blocks := []struct {
+		key string
+		vec []float32
+	}{
+		{"src", []float32{2, 0}},
+		{"src", []float32{0, 2}},
+		{"src", []float32{1, 1}},
+		{"src", []float32{0, 0}},
+		{"target", []float32{1.05, 1}},
+		{"decoy", []float32{0.7, 0.7}},
+		{"noise", []float32{-5, 5}},
+	}
+	for _, b := range blocks {
+		if _, err := vm.AppendBlock("mlt", b.key, &types.BlockData{Primary: b.key, Vector: b.vec}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := vm.SearchMLTKey("mlt", "src", 3)
+	if err != nil {
+		t.Fatalf("SearchMLTKey failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %+v", results)
+	}
+	if results[0].Key != "target" || results[2].Key != "noise" {
+		t.Errorf("Expected target first and noise last, got %+v", results)
+	}
+	for _, r := range results {
+		if r.Key == "src" {
+			t.Error("Source key returned in its own results")
+		}
+	}
+
+	if _, err := vm.SearchMLTKey("mlt", "missing", 3); err == nil {
+		t.Error("Expected an error for a missing key")
+	}
+}
+
+func TestVectorManager_SearchByKeyAndSimilarKeys(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	defer vm.Close()
+
+	if err := vm.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	// The centroid of query is (1, 1). near has many chunks close to it, so a
+	// plain block search would return near several times.
+	chunks := map[string][][]float32{
+		"query": {{2, 0}, {0, 2}},
+		"near":  {{1.3, 1}, {1, 1.1}, {0.5, 1}, {1, 0.6}, {1.4, 1.4}, {5, 5}},
+		"mid":   {{2, 2}, {-3, 0}},
+		"far":   {{-4, -4}},
+	}
+	for _, key := range []string{"query", "near", "mid", "far"} {
+		for _, vec := range chunks[key] {
+			if _, err := vm.AppendBlock("docs", key, &types.BlockData{Primary: key, Vector: vec}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	results, err := vm.SearchByKey("docs", "near", "query", 2)
+	if err != nil {
+		t.Fatalf("SearchByKey failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %+v", results)
+	}
+	for _, r := range results {
+		if r.Key != "near" {
+			t.Errorf("Expected only blocks of near, got %+v", r)
+		}
+	}
+	if results[0].Index != 1 || results[1].Index != 0 {
+		t.Errorf("Expected blocks 1 and 0 of near, got %+v", results)
+	}
+
+	results, err = vm.SearchSimilarKeys("docs", "query", 3)
+	if err != nil {
+		t.Fatalf("SearchSimilarKeys failed: %v", err)
+	}
+	var keys []string
+	for _, r := range results {
+		keys = append(keys, r.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"near", "mid", "far"}) {
+		t.Errorf("Expected keys [near mid far], got %v", keys)
+	}
+	if results[1].Index != 0 || results[1].Block == nil || results[1].Block.Primary != "mid" {
+		t.Errorf("Expected mid to be represented by its nearest block, got %+v", results[1])
+	}
+
+	if _, err := vm.SearchSimilarKeys("docs", "missing", 3); err == nil {
+		t.Error("Expected an error for a missing key")
+	}
+}
+
+func TestVectorManager_BlockTTL(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal", ExpirySweepInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("ttl", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+
+	appends := []struct {
+		key   string
+		block types.BlockData
+	}{
+		{"session", types.BlockData{Primary: "temp", Vector: []float32{1, 0}, TTLSeconds: 1}},
+		{"mixed", types.BlockData{Primary: "keep", Vector: []float32{0, 1}}},
+		{"mixed", types.BlockData{Primary: "drop", Vector: []float32{1, 0.1}, Keywords: []string{"tmp"}, TTLSeconds: 1}},
+	}
+	for _, a := range appends {
+		if _, err := vm.AppendBlock("ttl", a.key, &a.block); err != nil {
+			t.Fatalf("AppendBlock failed: %v", err)
+		}
+	}
+	if block, err := vm.GetBlock("ttl", "session", 0); err != nil || block.TTLSeconds != 1 {
+		t.Fatalf("Expected live block with 1s TTL, got %+v, %v", block, err)
+	}
+	if _, err := vm.AppendBlock("ttl", "bad", &types.BlockData{Primary: "x", TTLSeconds: -1}); err == nil {
+		t.Error("Expected negative TTL to be rejected")
+	}
+
+	time.Sleep(2 * time.Second)
+
+	// Expired blocks are hidden before the sweep runs
+	if _, err := vm.GetBlock("ttl", "session", 0); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+	if _, err := vm.GetBlock("ttl", "mixed", 1); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected ErrExpired for expired block of a live key, got %v", err)
+	}
+	results, err := vm.Search("ttl", []float32{1, 0}, 10, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Key != "mixed" || results[0].Index != 0 {
+		t.Fatalf("Expected only mixed/0 in results, got %+v", results)
+	}
+
+	keys, blocks := NewExpirySweeper(vm, 0).Sweep()
+	if keys != 1 || blocks != 1 {
+		t.Fatalf("Expected sweep to delete 1 key and purge 1 block, got %d and %d", keys, blocks)
+	}
+	if ok, _ := vm.ContainsKey("ttl", "session"); ok {
+		t.Error("Expected fully expired key to be deleted")
+	}
+	coll, _ := vm.GetCollection("ttl")
+	if coll.Count() != 1 {
+		t.Errorf("Expected 1 vector after sweep, got %d", coll.Count())
+	}
+	if ids, _ := vm.KeywordSearch("ttl", []string{"tmp"}, "exact", 0); len(ids) != 0 {
+		t.Errorf("Expected purged block to leave the keyword index, got %v", ids)
+	}
+	if block, err := vm.GetBlock("ttl", "mixed", 0); err != nil || block.Primary != "keep" {
+		t.Errorf("Expected live block to survive the sweep, got %+v, %v", block, err)
+	}
+	if keys, blocks := NewExpirySweeper(vm, 0).Sweep(); keys != 0 || blocks != 0 {
+		t.Errorf("Expected nothing left to sweep, got %d keys and %d blocks", keys, blocks)
+	}
+}
+
+func TestVectorManager_DefragmentCollection(t *testing.T) {
+	dataPath := t.TempDir()
+	cfg := &types.DBSchemaConfig{DataPath: dataPath, SyncMode: "normal"}
+	vm, err := NewVectorManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CreateCollectionWithConfig(types.CollectionConfig{
+		Name:                 "defrag",
+		Dimensions:           4,
+		Metric:               types.MetricL2,
+		SecondaryHNSWOptions: &types.HNSWOptions{M: 8, EfConstruction: 50, EfSearch: 20},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	vector := func(i int) []float32 { return []float32{float32(i), float32(i % 7), 1, 0} }
+	const n = 500
+	for i := range n {
+		key := fmt.Sprintf("doc-%d", i)
+		for j := range 2 {
+			block := &types.BlockData{Primary: key, Vector: vector(i*2 + j), Keywords: []string{"all", fmt.Sprintf("k%d", i%10)}}
+			if _, err := vm.AppendBlock("defrag", key, block); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for i := 0; i < n; i += 5 {
+		if i%10 == 0 {
+			continue // Keeps doc-0, doc-10, ... for the keyword checks
+		}
+		if err := vm.DeleteKey("defrag", fmt.Sprintf("doc-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i < n; i += 5 {
+		if err := vm.DeleteKey("defrag", fmt.Sprintf("doc-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := vm.DefragmentCollection("defrag"); err != nil {
+		t.Fatalf("DefragmentCollection failed: %v", err)
+	}
+
+	coll, _ := vm.collections.GetCollection("defrag")
+	count := uint64(coll.DocMap.Count())
+	if next := coll.DocMap.PeekNextVectorID(); next != count+1 {
+		t.Errorf("Expected next vector ID %d after defragmenting, got %d", count+1, next)
+	}
+	for _, index := range []VectorIndex{coll.Index, coll.SecondaryHNSW} {
+		for _, id := range index.VectorIDs() {
+			if id < 1 || id > count {
+				t.Fatalf("Vector ID %d outside 1..%d after defragmenting", id, count)
+			}
+		}
+	}
+
+	check := func() {
+		t.Helper()
+		block, err := vm.GetBlock("defrag", "doc-12", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(block.Vector, vector(25)) {
+			t.Errorf("GetBlock returned vector %v, want %v", block.Vector, vector(25))
+		}
+		blocks, err := vm.GetKey("defrag", "doc-12")
+		if err != nil || len(blocks) != 2 || !slices.Equal(blocks[0].Vector, vector(24)) {
+			t.Errorf("GetKey returned %+v (%v)", blocks, err)
+		}
+		for _, variant := range []string{"primary", "secondary"} {
+			results, err := vm.SearchVariant("defrag", vector(25), 1, "", nil, variant)
+			if err != nil || len(results) != 1 || results[0].Key != "doc-12" || results[0].Index != 1 {
+				t.Errorf("%s search returned %+v (%v)", variant, results, err)
+			}
+		}
+		for _, kw := range []string{"k0", "k2"} {
+			results, err := vm.SearchWithFilter("defrag", vector(0), 200, &types.SearchFilter{Keywords: []string{kw}, KeywordMode: "exact"}, "")
+			if err != nil || len(results) != 100 {
+				t.Fatalf("Expected 100 %s matches, got %d (%v)", kw, len(results), err)
+			}
+			for _, r := range results {
+				if !strings.HasSuffix(r.Key, kw[1:]) {
+					t.Errorf("Key %s matched keyword %s", r.Key, kw)
+				}
+			}
+		}
+	}
+	check()
+
+	// The renumbered indexes are saved and load back
+	vm.Close()
+	if vm, err = NewVectorManager(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	check()
+	if _, err := vm.AppendBlock("defrag", "late", &types.BlockData{Vector: vector(9999)}); err != nil {
+		t.Fatal(err)
+	}
+	coll, _ = vm.collections.GetCollection("defrag")
+	if id, err := coll.GetBlockVectorID("late", 0); err != nil || id != count+1 {
+		t.Errorf("Expected the next block to get vector ID %d, got %d (%v)", count+1, id, err)
+	}
+}
+
+func TestVectorManager_TypedErrors(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("col", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("col", "doc", &types.BlockData{Vector: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = vm.GetBlock("missing", "doc", 0)
+	var collErr *types.CollectionNotFoundError
+	if !errors.Is(err, types.ErrCollectionNotFound) || !errors.As(err, &collErr) || collErr.Collection != "missing" {
+		t.Errorf("GetBlock on a missing collection returned %v", err)
+	}
+
+	_, err = vm.GetKey("col", "nope")
+	var keyErr *types.KeyNotFoundError
+	if !errors.Is(err, types.ErrKeyNotFound) || !errors.As(err, &keyErr) || keyErr.Collection != "col" || keyErr.Key != "nope" {
+		t.Errorf("GetKey on a missing key returned %v", err)
+	}
+
+	_, err = vm.GetBlock("col", "doc", 3)
+	var blockErr *types.BlockNotFoundError
+	if !errors.Is(err, types.ErrKeyNotFound) || !errors.As(err, &blockErr) || blockErr.Key != "doc" || blockErr.Index != 3 {
+		t.Errorf("GetBlock past the end of a key returned %v", err)
+	}
+
+	// Wrapped on the way up, the details stay reachable
+	_, err = vm.AppendBlock("col", "doc", &types.BlockData{Vector: []float32{1, 0, 0}})
+	var dimErr *types.DimensionMismatchError
+	if !errors.Is(err, types.ErrDimensionMismatch) || !errors.As(err, &dimErr) || dimErr.Expected != 2 || dimErr.Actual != 3 {
+		t.Errorf("AppendBlock with a 3-d vector returned %v", err)
+	}
+	if errors.Is(err, types.ErrMetricMismatch) || errors.Is(err, types.ErrKeyNotFound) {
+		t.Errorf("Dimension mismatch %v matches other sentinels", err)
+	}
+	wrapped := fmt.Errorf("request 7: %w", err)
+	if !errors.As(wrapped, &dimErr) || dimErr.Subject != "vector" {
+		t.Errorf("errors.As lost the mismatch in %v", wrapped)
+	}
+
+	err = vm.CreateCollection("bad", 0, types.MetricL2)
+	var cfgErr *types.InvalidConfigError
+	if !errors.Is(err, types.ErrInvalidConfig) || !errors.As(err, &cfgErr) || cfgErr.Collection != "bad" {
+		t.Errorf("CreateCollection with 0 dimensions returned %v", err)
+	}
+
+	coll, _ := vm.collections.GetCollection("col")
+	vectorID, err := coll.GetBlockVectorID("doc", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = coll.Index.Add(vectorID, []float32{0, 1})
+	var dupErr *types.DuplicateIDError
+	if !errors.Is(err, types.ErrDuplicateID) || !errors.As(err, &dupErr) || dupErr.ID != vectorID {
+		t.Errorf("Adding vector ID %d twice returned %v", vectorID, err)
+	}
+}
+
+func TestVectorManager_MmapVectors(t *testing.T) {
+	cfg := &types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"}
+	vm, err := NewVectorManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CreateCollectionWithConfig(types.CollectionConfig{Name: "flat", Dimensions: 2, IndexType: types.IndexTypeFlat, MmapVectors: true}); err == nil {
+		t.Error("Expected mmap vectors to be rejected for a flat index")
+	}
+	if err := vm.CreateCollectionWithConfig(types.CollectionConfig{Name: "col", Dimensions: 4, Metric: types.MetricL2, MmapVectors: true}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 50 {
+		if _, err := vm.AppendBlock("col", fmt.Sprintf("doc-%d", i), &types.BlockData{Vector: []float32{float32(i), 1, 0, 0}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mmapPath := filepath.Join(cfg.DataPath, "indexes", "col", "vectors.mmap")
+	if _, err := os.Stat(mmapPath); mmapSupported && err != nil {
+		t.Fatalf("Expected a vector file: %v", err)
+	}
+	vm.Close()
+	if _, err := os.Stat(mmapPath); !os.IsNotExist(err) {
+		t.Errorf("Expected closing the collection to remove the vector file, got %v", err)
+	}
+
+	// The vectors are rebuilt from the index file on load
+	if vm, err = NewVectorManager(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	block, err := vm.GetBlock("col", "doc-17", 0)
+	if err != nil || !slices.Equal(block.Vector, []float32{17, 1, 0, 0}) {
+		t.Fatalf("GetBlock returned %+v (%v)", block, err)
+	}
+	results, err := vm.Search("col", []float32{17, 1, 0, 0}, 1, "", nil)
+	if err != nil || len(results) != 1 || results[0].Key != "doc-17" {
+		t.Errorf("Search returned %+v (%v)", results, err)
+	}
+}
+
+func TestVectorManager_SearchWithFilterContextCancelled(t *testing.T) {
+	vm, err := NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	if err := vm.CreateCollection("docs", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("docs", "a", &types.BlockData{Primary: "a", Vector: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := vm.SearchWithFilterContext(ctx, "docs", []float32{1, 0}, 1, nil, "primary"); !errors.Is(err, types.ErrCancelled) {
+		t.Errorf("Search with a cancelled context = %v, want ErrCancelled", err)
+	}
+	if results, err := vm.SearchWithFilterContext(context.Background(), "docs", []float32{1, 0}, 1, nil, "primary"); err != nil || len(results) != 1 {
+		t.Errorf("Search = %v, %v", results, err)
+	}
+}
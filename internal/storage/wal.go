@@ -1,16 +1,26 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"waddlemap/internal/types"
 )
 
+// DefaultWALSegmentBytes is the size at which the live WAL file is rotated into a segment.
+const DefaultWALSegmentBytes int64 = 64 << 20
+
 // WAL Operation types
 type WALOpType uint8
 
@@ -18,27 +28,99 @@ const (
 	WALOpAdd    WALOpType = 1
 	WALOpDelete WALOpType = 2
 	WALOpUpdate WALOpType = 3
+	// WALOpCheckpoint marks that all preceding entries are persisted in the indexes.
+	WALOpCheckpoint WALOpType = 4
+	// WALOpCommit marks that every entry logged with its TxID is complete.
+	WALOpCommit WALOpType = 5
+	// WALOpCreateCollection and WALOpDeleteCollection record collection
+	// changes for replicas. Recovery skips them, since collection metadata
+	// is saved as soon as it changes.
+	WALOpCreateCollection WALOpType = 6
+	WALOpDeleteCollection WALOpType = 7
+	// WALOpIndexAdd and WALOpIndexDelete record a change to the forward and
+	// keyword indexes of a collection, logged by the collection before it
+	// applies the change. Recovery restores adds from them, so that a block
+	// keeps the vector ID its vectors were saved under.
+	WALOpIndexAdd    WALOpType = 8
+	WALOpIndexDelete WALOpType = 9
 )
 
+// ErrWALTruncated is returned by Follow when entries after the requested
+// position are no longer in the log files.
+var ErrWALTruncated = errors.New("WAL entries were checkpointed away")
+
 // WALEntry represents a single operation in the write-ahead log.
 type WALEntry struct {
 	Timestamp  int64
 	OpType     WALOpType
 	Collection string
 	Key        string
+	Index      uint32 // Block index, for updates
 	VectorID   uint64
 	Vector     []float32
 	Keywords   []string
 	Data       []byte // Primary data
+	TTLSeconds int64  // Block TTL for adds, counted from Timestamp
+	TxID       string // Transaction the entry belongs to, if any
+
+	// Location is the forward index entry of VectorID, for index adds and
+	// deletes. AddLSN is the LSN of the WALOpAdd an index add belongs to, or
+	// 0 if the block was not appended through the WAL.
+	Location DocLocation
+	AddLSN   uint64
+
+	// LSN is the log sequence number of the entry. It increases by one per
+	// entry across checkpoints and restarts; a checkpoint marker carries
+	// the LSN of the entry before it.
+	LSN uint64
+
+	// CollectionConfig is the created collection, for WALOpCreateCollection.
+	CollectionConfig *types.CollectionConfig
 }
 
 // WAL provides write-ahead logging for atomic writes.
+// Once the live file exceeds maxSegmentBytes it is renamed to
+// <filePath>.NNNNNNNNN and logging continues in a fresh file.
+//
+// By default every entry is synced before the Log call returns. In batch mode
+// (SetBatchMode) entries are buffered in memory and a background goroutine
+// writes and syncs them periodically, trading durability of the most recent
+// writes for throughput: entries logged since the last flush are lost on a
+// crash. Callers that need an entry on disk call Flush.
+//
+// Every logged entry is also sent to the channels returned by Follow, which
+// replication uses to stream the log to replicas.
 type WAL struct {
-	filePath string
-	file     *os.File
-	encoder  *gob.Encoder
-	mu       sync.Mutex
-	seqNum   uint64
+	filePath        string
+	file            *os.File
+	encoder         *gob.Encoder
+	mu              sync.Mutex
+	seqNum          uint64
+	maxSegmentBytes int64
+	nextSegment     uint64 // Sequence number of the next rotated segment
+
+	// Batch mode state; batchInterval is zero when every write is synced.
+	batchInterval time.Duration
+	batchMaxBytes int
+	buf           bytes.Buffer  // Encoded entries awaiting a flush
+	flushErr      error         // First error from a background flush
+	kick          chan struct{} // Requests an early flush once buf exceeds batchMaxBytes
+	stopFlush     chan struct{}
+	flushDone     chan struct{}
+
+	lsn         uint64                            // LSN of the last entry logged
+	subscribers map[<-chan WALEntry]chan WALEntry // Channels returned by Follow
+}
+
+// walSink routes encoded entries to the in-memory buffer in batch mode and
+// straight to the file otherwise. The WAL lock must be held while writing.
+type walSink struct{ w *WAL }
+
+func (s walSink) Write(p []byte) (int, error) {
+	if s.w.batchInterval > 0 {
+		return s.w.buf.Write(p)
+	}
+	return s.w.file.Write(p)
 }
 
 // NewWAL creates a new write-ahead log.
@@ -48,17 +130,234 @@ func NewWAL(filePath string) (*WAL, error) {
 		return nil, fmt.Errorf("failed to open WAL file: %w", err)
 	}
 
-	return &WAL{
-		filePath: filePath,
-		file:     file,
-		encoder:  gob.NewEncoder(file),
-		seqNum:   0,
-	}, nil
+	w := &WAL{
+		filePath:        filePath,
+		file:            file,
+		seqNum:          0,
+		maxSegmentBytes: DefaultWALSegmentBytes,
+		nextSegment:     1,
+	}
+	w.encoder = gob.NewEncoder(walSink{w})
+
+	segments, err := w.segments()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if n := len(segments); n > 0 {
+		w.nextSegment = segments[n-1].seq + 1
+	}
+	w.lsn = w.checkpointLSN()
+	if err := w.readAll(func(entry WALEntry) { w.lsn = max(w.lsn, entry.LSN) }); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// SetMaxSegmentBytes sets the size at which the live WAL file is rotated.
+func (w *WAL) SetMaxSegmentBytes(n int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.maxSegmentBytes = n
+}
+
+// walSegment is a rotated WAL file.
+type walSegment struct {
+	seq  uint64
+	path string
+}
+
+// segments returns the rotated segment files in sequence order.
+func (w *WAL) segments() ([]walSegment, error) {
+	matches, err := filepath.Glob(w.filePath + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var segments []walSegment
+	for _, path := range matches {
+		seq, err := strconv.ParseUint(strings.TrimPrefix(path, w.filePath+"."), 10, 64)
+		if err != nil {
+			continue // Not a segment
+		}
+		segments = append(segments, walSegment{seq: seq, path: path})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].seq < segments[j].seq })
+	return segments, nil
+}
+
+// SegmentCount returns the number of rotated segments awaiting a checkpoint.
+func (w *WAL) SegmentCount() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	segments, err := w.segments()
+	if err != nil {
+		return 0
+	}
+	return len(segments)
+}
+
+// maybeRotate moves the live file to a numbered segment once it exceeds
+// maxSegmentBytes (caller must hold lock).
+func (w *WAL) maybeRotate() error {
+	if w.maxSegmentBytes <= 0 {
+		return nil
+	}
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < w.maxSegmentBytes {
+		return nil
+	}
+
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	segmentPath := fmt.Sprintf("%s.%09d", w.filePath, w.nextSegment)
+	if err := os.Rename(w.filePath, segmentPath); err != nil {
+		return fmt.Errorf("failed to rotate WAL segment: %w", err)
+	}
+	w.nextSegment++
+
+	file, err := os.OpenFile(w.filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL file: %w", err)
+	}
+	w.file = file
+	w.encoder = gob.NewEncoder(walSink{w})
+	return nil
+}
+
+// SetBatchMode switches the WAL to batched writes: entries are buffered and a
+// background goroutine writes and syncs them every interval, or as soon as
+// more than maxBytes are buffered. Log calls then return without waiting for
+// the disk. An interval of zero or less flushes the buffer and restores
+// synchronous writes.
+func (w *WAL) SetBatchMode(interval time.Duration, maxBytes int) error {
+	w.stopBatch()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	w.batchInterval = 0
+	if interval <= 0 {
+		return nil
+	}
+
+	w.batchInterval = interval
+	w.batchMaxBytes = maxBytes
+	w.kick = make(chan struct{}, 1)
+	w.stopFlush = make(chan struct{})
+	w.flushDone = make(chan struct{})
+	go w.flushLoop(interval, w.kick, w.stopFlush, w.flushDone)
+	return nil
+}
+
+// flushLoop writes buffered entries until stop is closed.
+func (w *WAL) flushLoop(interval time.Duration, kick, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-kick:
+		case <-stop:
+			return
+		}
+		w.mu.Lock()
+		if w.buf.Len() > 0 {
+			err := w.flushLocked()
+			if err == nil {
+				err = w.maybeRotate()
+			}
+			if err != nil && w.flushErr == nil {
+				w.flushErr = err
+			}
+		}
+		w.mu.Unlock()
+	}
+}
+
+// stopBatch stops the background flusher, if any. Entries stay buffered
+// until the caller flushes them.
+func (w *WAL) stopBatch() {
+	w.mu.Lock()
+	stop, done := w.stopFlush, w.flushDone
+	w.stopFlush, w.flushDone = nil, nil
+	w.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// Flush writes any buffered entries and syncs the file, returning the first
+// error hit by a background flush since the last call.
+func (w *WAL) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.takeFlushErr(); err != nil {
+		return err
+	}
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	return w.maybeRotate()
+}
+
+// flushLocked writes the buffered entries to the file and syncs it (caller must hold lock).
+func (w *WAL) flushLocked() error {
+	if w.buf.Len() > 0 {
+		if _, err := w.file.Write(w.buf.Bytes()); err != nil {
+			return err
+		}
+		w.buf.Reset()
+	}
+	return w.file.Sync()
+}
+
+// takeFlushErr returns and clears the pending background flush error (caller must hold lock).
+func (w *WAL) takeFlushErr() error {
+	err := w.flushErr
+	w.flushErr = nil
+	return err
+}
+
+// afterWrite syncs a just-encoded write, or in batch mode only schedules it
+// (caller must hold lock).
+func (w *WAL) afterWrite() error {
+	if w.batchInterval > 0 {
+		if w.buf.Len() >= w.batchMaxBytes {
+			select {
+			case w.kick <- struct{}{}:
+			default:
+			}
+		}
+		return w.takeFlushErr()
+	}
+
+	// Sync to ensure durability
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	return w.maybeRotate()
 }
 
 // LogAdd logs an add operation.
 func (w *WAL) LogAdd(collection, key string, vectorID uint64, vector []float32, keywords []string, data []byte) error {
-	return w.log(WALEntry{
+	_, err := w.LogAddTTL(collection, key, vectorID, vector, keywords, data, 0)
+	return err
+}
+
+// LogAddTTL logs an add of a block that expires ttlSeconds after now and
+// returns the LSN of the entry.
+func (w *WAL) LogAddTTL(collection, key string, vectorID uint64, vector []float32, keywords []string, data []byte, ttlSeconds int64) (uint64, error) {
+	return w.logBatch([]WALEntry{{
 		Timestamp:  time.Now().UnixNano(),
 		OpType:     WALOpAdd,
 		Collection: collection,
@@ -67,7 +366,8 @@ func (w *WAL) LogAdd(collection, key string, vectorID uint64, vector []float32,
 		Vector:     vector,
 		Keywords:   keywords,
 		Data:       data,
-	})
+		TTLSeconds: ttlSeconds,
+	}})
 }
 
 // LogDelete logs a delete operation.
@@ -81,68 +381,394 @@ func (w *WAL) LogDelete(collection, key string, vectorID uint64) error {
 	})
 }
 
+// LogUpdate logs an update of the block at index. ttlSeconds is the new TTL
+// of the block (0 = never expires).
+func (w *WAL) LogUpdate(collection, key string, index uint32, vector []float32, keywords []string, data []byte, ttlSeconds int64) error {
+	return w.log(WALEntry{
+		Timestamp:  time.Now().UnixNano(),
+		OpType:     WALOpUpdate,
+		Collection: collection,
+		Key:        key,
+		Index:      index,
+		Vector:     vector,
+		Keywords:   keywords,
+		Data:       data,
+		TTLSeconds: ttlSeconds,
+	})
+}
+
+// LogCreateCollection logs the creation of a collection.
+func (w *WAL) LogCreateCollection(cfg types.CollectionConfig) error {
+	return w.log(WALEntry{
+		Timestamp:        time.Now().UnixNano(),
+		OpType:           WALOpCreateCollection,
+		Collection:       cfg.Name,
+		CollectionConfig: &cfg,
+	})
+}
+
+// LogDeleteCollection logs the deletion of a collection.
+func (w *WAL) LogDeleteCollection(name string) error {
+	return w.log(WALEntry{
+		Timestamp:  time.Now().UnixNano(),
+		OpType:     WALOpDeleteCollection,
+		Collection: name,
+	})
+}
+
+// indexAddEntry returns the WALOpIndexAdd entry of a block added to the
+// indexes of collection as vectorID at loc, with keywords.
+func indexAddEntry(collection string, vectorID uint64, loc DocLocation, keywords []string, addLSN uint64) WALEntry {
+	return WALEntry{
+		Timestamp:  time.Now().UnixNano(),
+		OpType:     WALOpIndexAdd,
+		Collection: collection,
+		VectorID:   vectorID,
+		Location:   loc,
+		Keywords:   keywords,
+		AddLSN:     addLSN,
+	}
+}
+
+// indexDeleteEntry returns the WALOpIndexDelete entry of vectorID, found at
+// loc, removed from the indexes of collection.
+func indexDeleteEntry(collection string, vectorID uint64, loc DocLocation) WALEntry {
+	return WALEntry{
+		Timestamp:  time.Now().UnixNano(),
+		OpType:     WALOpIndexDelete,
+		Collection: collection,
+		VectorID:   vectorID,
+		Location:   loc,
+	}
+}
+
 // LogBatch logs multiple entries in a single batch with one fsync.
 func (w *WAL) LogBatch(entries []WALEntry) error {
+	_, err := w.logBatch(entries)
+	return err
+}
+
+// logBatch implements LogBatch and returns the LSN of the first entry.
+func (w *WAL) logBatch(entries []WALEntry) (uint64, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	for _, entry := range entries {
+	first := w.lsn + 1
+	logged := make([]WALEntry, len(entries))
+	for i, entry := range entries {
 		w.seqNum++
+		w.lsn++
+		entry.LSN = w.lsn
 		if err := w.encoder.Encode(entry); err != nil {
-			return fmt.Errorf("failed to encode WAL entry: %w", err)
+			return 0, fmt.Errorf("failed to encode WAL entry: %w", err)
 		}
+		logged[i] = entry
 	}
-
-	// Sync to ensure durability
-	return w.file.Sync()
+	if err := w.afterWrite(); err != nil {
+		return 0, err
+	}
+	for _, entry := range logged {
+		w.publish(entry)
+	}
+	return first, nil
 }
 
 // log writes an entry to the WAL.
 func (w *WAL) log(entry WALEntry) error {
+	_, err := w.logBatch([]WALEntry{entry})
+	return err
+}
+
+// publish sends a logged entry to every follower. A follower whose channel is
+// full is dropped and its channel closed, so that a slow reader never blocks
+// writes; it can catch up from the log files by calling Follow again (caller
+// must hold lock).
+func (w *WAL) publish(entry WALEntry) {
+	for key, ch := range w.subscribers {
+		select {
+		case ch <- entry:
+		default:
+			delete(w.subscribers, key)
+			close(ch)
+		}
+	}
+}
+
+// LSN returns the sequence number of the last entry logged.
+func (w *WAL) LSN() uint64 {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	return w.lsn
+}
+
+// Follow returns the entries logged after LSN since that are still in the
+// log files, and a channel with room for buffer entries that receives every
+// entry logged from then on. Checkpoint markers are left out. The channel is
+// closed if the follower falls more than buffer entries behind, by Unfollow
+// and by Close. Follow returns ErrWALTruncated if a checkpoint removed entries
+// after since, and an error if since is ahead of the log.
+//
+// Writes wait while Follow reads the log files.
+func (w *WAL) Follow(since uint64, buffer int) ([]WALEntry, <-chan WALEntry, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if since > w.lsn {
+		return nil, nil, fmt.Errorf("position %d is ahead of the log, which ends at %d", since, w.lsn)
+	}
+	if err := w.flushLocked(); err != nil {
+		return nil, nil, err
+	}
 
-	w.seqNum++
-	if err := w.encoder.Encode(entry); err != nil {
-		return fmt.Errorf("failed to encode WAL entry: %w", err)
+	// Entries up to the last checkpoint are gone, unless a crash interrupted
+	// it before the files were truncated
+	base := w.checkpointLSN()
+	var backlog []WALEntry
+	err := w.readAll(func(entry WALEntry) {
+		if entry.OpType != WALOpCheckpoint && entry.LSN > since {
+			if len(backlog) == 0 {
+				base = min(base, entry.LSN-1)
+			}
+			backlog = append(backlog, entry)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if since < base {
+		return nil, nil, fmt.Errorf("%w: the log starts after %d, not %d", ErrWALTruncated, base, since)
 	}
 
-	// Sync to ensure durability
-	return w.file.Sync()
+	ch := make(chan WALEntry, buffer)
+	if w.subscribers == nil {
+		w.subscribers = make(map[<-chan WALEntry]chan WALEntry)
+	}
+	w.subscribers[ch] = ch
+	return backlog, ch, nil
+}
+
+// Unfollow stops sending entries to a channel returned by Follow and closes
+// it, if that has not happened already.
+func (w *WAL) Unfollow(ch <-chan WALEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if sub, ok := w.subscribers[ch]; ok {
+		delete(w.subscribers, ch)
+		close(sub)
+	}
+}
+
+// readAll decodes the entries of the rotated segments and the live file, in
+// order, and passes each to fn. A torn entry at the end of a file ends that
+// file (caller must hold lock or own w exclusively).
+//
+// A file appended to after a restart holds one gob stream per WAL that wrote
+// it, and a single decoder fails at the second stream's type definitions, so
+// each stream is decoded on its own.
+func (w *WAL) readAll(fn func(WALEntry)) error {
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(segments)+1)
+	for _, seg := range segments {
+		paths = append(paths, seg.path)
+	}
+	paths = append(paths, w.filePath)
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, stream := range gobStreams(data) {
+			decoder := gob.NewDecoder(bytes.NewReader(stream))
+			for {
+				var entry WALEntry
+				if err := decoder.Decode(&entry); err != nil {
+					break
+				}
+				fn(entry)
+			}
+		}
+	}
+	return nil
 }
 
-// Replay reads and returns all entries from the WAL.
+// gobStreams splits data into the gob streams written by successive
+// encoders. Each gob message is a length followed by a type ID, negative for
+// a type definition; a stream starts where a type is defined again. A torn
+// message at the end is dropped.
+func gobStreams(data []byte) [][]byte {
+	var streams [][]byte
+	defined := make(map[int64]bool)
+	start, pos := 0, 0
+	for pos < len(data) {
+		length, n := gobUint(data[pos:])
+		if n == 0 || length > uint64(len(data)-pos-n) {
+			break
+		}
+		msg := data[pos+n : pos+n+int(length)]
+		if u, m := gobUint(msg); m > 0 && u&1 == 1 {
+			id := int64(^(u >> 1)) // Negative: a type definition
+			if defined[id] {
+				streams = append(streams, data[start:pos])
+				start = pos
+				clear(defined)
+			}
+			defined[id] = true
+		}
+		pos += n + int(length)
+	}
+	return append(streams, data[start:pos])
+}
+
+// gobUint decodes a gob unsigned integer from the start of b and returns it
+// with the number of bytes read, or 0 bytes if b is too short.
+func gobUint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	if b[0] < 0x80 {
+		return uint64(b[0]), 1
+	}
+	n := -int(int8(b[0]))
+	if n > 8 || len(b) < 1+n {
+		return 0, 0
+	}
+	var v uint64
+	for _, c := range b[1 : 1+n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, 1 + n
+}
+
+// Replay reads and returns the entries logged since the last checkpoint,
+// reading rotated segments in sequence order before the live file.
+// A WAL ending in a checkpoint marker was shut down cleanly and yields no entries.
+// Entries of transactions without a commit marker are skipped. Index entries
+// come in the order their collections logged them, after the add they belong
+// to; indexedAdds pairs them up.
 func (w *WAL) Replay() ([]WALEntry, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if err := w.flushLocked(); err != nil {
+		return nil, err
+	}
+
+	segments, err := w.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []WALEntry
+	for _, seg := range segments {
+		f, err := os.Open(seg.path)
+		if err != nil {
+			return nil, err
+		}
+		entries, err = replayFile(f, entries)
+		f.Close()
+		if err != nil {
+			return committedEntries(entries), nil // Return what we have on error
+		}
+	}
+
 	// Seek to beginning
 	if _, err := w.file.Seek(0, 0); err != nil {
 		return nil, err
 	}
+	entries, _ = replayFile(w.file, entries)
+	return committedEntries(entries), nil
+}
 
-	decoder := gob.NewDecoder(w.file)
-	var entries []WALEntry
+// committedEntries drops commit markers and the entries of transactions that
+// were never committed.
+func committedEntries(entries []WALEntry) []WALEntry {
+	committed := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.OpType == WALOpCommit {
+			committed[entry.TxID] = true
+		}
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.OpType == WALOpCommit || (entry.TxID != "" && !committed[entry.TxID]) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// indexedAdds returns the LSNs of the WALOpAdd entries that have a
+// WALOpIndexAdd entry in entries, and the position of the last index add of
+// each collection key (see recoveryKey). An add without an index entry never
+// reached its collection.
+func indexedAdds(entries []WALEntry) (map[uint64]bool, map[string]int) {
+	indexed := make(map[uint64]bool)
+	lastIndexAdd := make(map[string]int)
+	for i, entry := range entries {
+		if entry.OpType != WALOpIndexAdd {
+			continue
+		}
+		if entry.AddLSN != 0 {
+			indexed[entry.AddLSN] = true
+		}
+		lastIndexAdd[recoveryKey(entry.Collection, entry.Location.Key)] = i
+	}
+	return indexed, lastIndexAdd
+}
 
+// recoveryKey identifies a key of a collection during recovery.
+func recoveryKey(collection, key string) string {
+	return collection + "\x00" + key
+}
+
+// replayFile decodes every entry in r and appends it to entries. A checkpoint
+// marker discards the entries collected so far.
+func replayFile(r io.Reader, entries []WALEntry) ([]WALEntry, error) {
+	decoder := gob.NewDecoder(r)
 	for {
 		var entry WALEntry
 		if err := decoder.Decode(&entry); err != nil {
 			if errors.Is(err, io.EOF) {
-				break
+				return entries, nil
 			}
-			return entries, nil // Return what we have on error
+			return entries, err
+		}
+		if entry.OpType == WALOpCheckpoint {
+			// Everything before the marker is already persisted
+			entries = entries[:0]
+			continue
 		}
 		entries = append(entries, entry)
 	}
-
-	return entries, nil
 }
 
 // Checkpoint clears the WAL after successful commit.
+// A checkpoint marker is synced before truncation so that a crash mid-checkpoint
+// is not mistaken for unpersisted writes.
 func (w *WAL) Checkpoint() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if err := w.writeCheckpointMarker(); err != nil {
+		return err
+	}
+
+	// Rotated segments precede the marker, so they are no longer needed
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
 	// Close current file
 	if err := w.file.Close(); err != nil {
 		return err
@@ -155,17 +781,129 @@ func (w *WAL) Checkpoint() error {
 	}
 
 	w.file = file
-	w.encoder = gob.NewEncoder(file)
+	w.encoder = gob.NewEncoder(walSink{w})
 	w.seqNum = 0
 
-	return nil
+	// The truncated log no longer holds the last LSN, so save it aside
+	return os.WriteFile(w.lsnPath(), []byte(strconv.FormatUint(w.lsn, 10)), 0644)
+}
+
+// lsnPath is the file holding the LSN of the last checkpoint.
+func (w *WAL) lsnPath() string {
+	return w.filePath + ".lsn"
+}
+
+// checkpointLSN returns the LSN saved by the last checkpoint, or 0.
+func (w *WAL) checkpointLSN() uint64 {
+	data, err := os.ReadFile(w.lsnPath())
+	if err != nil {
+		return 0
+	}
+	lsn, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	return lsn
+}
+
+// writeCheckpointMarker appends a checkpoint entry and syncs it along with any
+// buffered entries (caller must hold lock).
+func (w *WAL) writeCheckpointMarker() error {
+	marker := WALEntry{Timestamp: time.Now().UnixNano(), OpType: WALOpCheckpoint, LSN: w.lsn}
+	if err := w.encoder.Encode(marker); err != nil {
+		return fmt.Errorf("failed to write checkpoint marker: %w", err)
+	}
+	return w.flushLocked()
+}
+
+// copyTo flushes buffered entries and copies the live file and any rotated
+// segments into dir.
+func (w *WAL) copyTo(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if err := copyFilePrefix(seg.path, filepath.Join(dir, filepath.Base(seg.path)), -1); err != nil {
+			return err
+		}
+	}
+	return copyFilePrefix(w.filePath, filepath.Join(dir, filepath.Base(w.filePath)), -1)
+}
+
+// restoreFrom replaces the log with the files copied to dir by copyTo.
+// Buffered entries that were not flushed yet are discarded.
+func (w *WAL) restoreFrom(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(w.filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	w.buf.Reset()
+	w.nextSegment = 1
+	matches, err := filepath.Glob(filepath.Join(dir, filepath.Base(w.filePath)+"*"))
+	if err != nil {
+		return err
+	}
+	for _, src := range matches {
+		dst := filepath.Join(filepath.Dir(w.filePath), filepath.Base(src))
+		if err := copyFilePrefix(src, dst, -1); err != nil {
+			return err
+		}
+	}
+	restored, err := w.segments()
+	if err != nil {
+		return err
+	}
+	if n := len(restored); n > 0 {
+		w.nextSegment = restored[n-1].seq + 1
+	}
+
+	file, err := os.OpenFile(w.filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL file: %w", err)
+	}
+	w.file = file
+	w.encoder = gob.NewEncoder(walSink{w})
+	w.seqNum = 0
+	// Keep LSNs increasing even if the restored log ends earlier
+	return w.readAll(func(entry WALEntry) { w.lsn = max(w.lsn, entry.LSN) })
 }
 
-// Close closes the WAL file.
+// Close flushes buffered entries, closes the channels returned by Follow and
+// closes the WAL file.
 func (w *WAL) Close() error {
+	w.stopBatch()
+
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.file.Close()
+	for key, ch := range w.subscribers {
+		delete(w.subscribers, key)
+		close(ch)
+	}
+	flushErr := w.flushLocked()
+	w.batchInterval = 0
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	return flushErr
 }
 
 // Size returns the current size of the WAL file.
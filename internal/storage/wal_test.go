@@ -0,0 +1,452 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"waddlemap/internal/types"
+)
+
+func TestWAL_CheckpointMarker(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "vector.wal")
+
+	wal, err := NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := wal.LogAdd("col", "key", 0, []float32{1, 2}, nil, []byte("data")); err != nil {
+			t.Fatalf("LogAdd failed: %v", err)
+		}
+	}
+	if err := wal.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	wal.Close()
+
+	// A clean checkpoint leaves nothing to replay on the next startup.
+	wal, err = NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := wal.Replay()
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("Expected 0 replay entries after clean checkpoint, got %d", len(entries))
+	}
+
+	// Writes after the checkpoint are replayed.
+	if err := wal.LogDelete("col", "key", 0); err != nil {
+		t.Fatalf("LogDelete failed: %v", err)
+	}
+	wal.Close()
+
+	wal, err = NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	entries, err = wal.Replay()
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].OpType != WALOpDelete {
+		t.Fatalf("Expected a single delete entry after checkpoint, got %+v", entries)
+	}
+}
+
+func TestWAL_ReplaySkipsWhenEndingInCheckpoint(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "vector.wal")
+
+	wal, err := NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.LogAdd("col", "key", 0, nil, nil, []byte("persisted")); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a crash after the marker was synced but before truncation.
+	wal.mu.Lock()
+	err = wal.writeCheckpointMarker()
+	wal.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	wal, err = NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	entries, err := wal.Replay()
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("Expected replay to be skipped, got %d entries", len(entries))
+	}
+}
+
+func TestWAL_SegmentRotation(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "vector.wal")
+
+	wal, err := NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal.SetMaxSegmentBytes(512)
+	for i := 0; i < 40; i++ {
+		if err := wal.LogAdd("col", fmt.Sprintf("key-%d", i), 0, []float32{1, 2}, nil, []byte("data")); err != nil {
+			t.Fatalf("LogAdd failed: %v", err)
+		}
+	}
+	segments := wal.SegmentCount()
+	if segments < 2 {
+		t.Fatalf("Expected several rotated segments, got %d", segments)
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s.%09d", walPath, 1)); err != nil {
+		t.Errorf("Expected first segment file: %v", err)
+	}
+	wal.Close()
+
+	// Segments are replayed in order before the live file, and numbering
+	// continues after a restart.
+	wal, err = NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	entries, err := wal.Replay()
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(entries) != 40 {
+		t.Fatalf("Expected 40 replayed entries, got %d", len(entries))
+	}
+	for i, e := range entries {
+		if e.Key != fmt.Sprintf("key-%d", i) {
+			t.Fatalf("Entry %d out of order: %s", i, e.Key)
+		}
+	}
+	if wal.nextSegment != uint64(segments)+1 {
+		t.Errorf("Expected next segment %d after reopen, got %d", segments+1, wal.nextSegment)
+	}
+
+	if err := wal.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if n := wal.SegmentCount(); n != 0 {
+		t.Errorf("Expected checkpoint to delete segments, %d remain", n)
+	}
+	if entries, _ := wal.Replay(); len(entries) != 0 {
+		t.Errorf("Expected nothing to replay after checkpoint, got %d entries", len(entries))
+	}
+}
+
+func TestWAL_BatchMode(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "vector.wal")
+
+	wal, err := NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An interval long enough that only Flush or the size threshold writes
+	if err := wal.SetBatchMode(time.Hour, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := wal.LogAdd("col", fmt.Sprintf("key-%d", i), 0, []float32{1, 2}, nil, []byte("data")); err != nil {
+			t.Fatalf("LogAdd failed: %v", err)
+		}
+	}
+	if size, _ := wal.Size(); size != 0 {
+		t.Fatalf("Expected entries to stay buffered, file has %d bytes", size)
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	flushed, _ := wal.Size()
+	if flushed == 0 {
+		t.Fatal("Expected Flush to write the buffered entries")
+	}
+
+	// Crossing the size threshold triggers a background flush
+	if err := wal.SetBatchMode(time.Hour, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.LogDelete("col", "key-0", 0); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for size, _ := wal.Size(); size == flushed; size, _ = wal.Size() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the size threshold to flush the buffer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Close flushes whatever is still buffered
+	if err := wal.LogDelete("col", "key-1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	wal, err = NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	entries, err := wal.Replay()
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(entries) != 12 || entries[11].Key != "key-1" {
+		t.Fatalf("Expected 12 replayed entries ending in key-1, got %d", len(entries))
+	}
+}
+
+// benchmarkWALLogAdd measures LogAdd throughput, optionally in batch mode.
+func benchmarkWALLogAdd(b *testing.B, batched bool) {
+	wal, err := NewWAL(filepath.Join(b.TempDir(), "vector.wal"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer wal.Close()
+	if batched {
+		if err := wal.SetBatchMode(10*time.Millisecond, 256<<10); err != nil {
+			b.Fatal(err)
+		}
+	}
+	vec := make([]float32, 384)
+	data := []byte("benchmark payload")
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := wal.LogAdd("col", "key", 0, vec, nil, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := wal.Flush(); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "entries/s")
+}
+
+func BenchmarkWAL_LogAddSync(b *testing.B)    { benchmarkWALLogAdd(b, false) }
+func BenchmarkWAL_LogAddBatched(b *testing.B) { benchmarkWALLogAdd(b, true) }
+
+func TestVectorManager_CleanShutdownSkipsReplay(t *testing.T) {
+	cfg := &types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"}
+
+	vm, err := NewVectorManager(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create VM: %v", err)
+	}
+	if err := vm.CreateCollection("col", 2, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vm.AppendBlock("col", "doc", &types.BlockData{Primary: "a", Vector: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	vm.Close()
+
+	vm, err = NewVectorManager(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen VM: %v", err)
+	}
+	defer vm.Close()
+
+	length, err := vm.GetKeyLength("col", "doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length != 1 {
+		t.Errorf("Expected key length 1 after clean restart, got %d", length)
+	}
+}
+
+func TestWAL_FollowAndLSN(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "vector.wal")
+	wal, err := NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := wal.LogAdd("col", fmt.Sprintf("key-%d", i), 0, []float32{1, 2}, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backlog, live, err := wal.Follow(1, 10)
+	if err != nil {
+		t.Fatalf("Follow failed: %v", err)
+	}
+	if len(backlog) != 2 || backlog[0].LSN != 2 || backlog[1].Key != "key-2" {
+		t.Fatalf("Expected entries 2 and 3 in the backlog, got %+v", backlog)
+	}
+	if err := wal.LogDelete("col", "key-0", 0); err != nil {
+		t.Fatal(err)
+	}
+	if entry := <-live; entry.LSN != 4 || entry.OpType != WALOpDelete {
+		t.Errorf("Expected the delete as LSN 4 on the live channel, got %+v", entry)
+	}
+	if _, _, err := wal.Follow(5, 10); err == nil {
+		t.Error("Expected Follow past the end of the log to fail")
+	}
+
+	// A follower that falls behind is dropped
+	if _, slow, err := wal.Follow(4, 1); err != nil {
+		t.Fatal(err)
+	} else {
+		wal.LogDelete("col", "key-1", 0)
+		wal.LogDelete("col", "key-2", 0)
+		<-slow
+		if _, ok := <-slow; ok {
+			t.Error("Expected the channel of a slow follower to be closed")
+		}
+	}
+	wal.Unfollow(live)
+	for range live {
+		// Entries sent before Unfollow are still buffered; then it is closed
+	}
+
+	// LSNs continue after a checkpoint and a restart, and the entries
+	// removed by the checkpoint can no longer be followed
+	if err := wal.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+	wal, err = NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lsn := wal.LSN(); lsn != 6 {
+		t.Fatalf("LSN after restart = %d, want 6", lsn)
+	}
+	if _, _, err := wal.Follow(2, 10); !errors.Is(err, ErrWALTruncated) {
+		t.Errorf("Expected ErrWALTruncated, got %v", err)
+	}
+	if err := wal.LogAdd("col", "key-3", 0, []float32{1, 2}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	// A live file appended to by a second WAL holds two gob streams
+	wal, err = NewWAL(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	if err := wal.LogAdd("col", "key-4", 0, []float32{1, 2}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	backlog, _, err = wal.Follow(6, 10)
+	if err != nil {
+		t.Fatalf("Follow failed: %v", err)
+	}
+	if len(backlog) != 2 || backlog[0].LSN != 7 || backlog[1].LSN != 8 || backlog[1].Key != "key-4" {
+		t.Errorf("Expected LSNs 7 and 8 across both streams, got %+v", backlog)
+	}
+}
+
+func TestVectorManager_RecoverAfterCrash(t *testing.T) {
+	cfg := &types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal", FlushInterval: -1, ExpirySweepInterval: -1}
+	vm, err := NewVectorManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CreateCollection("docs", 4, types.MetricL2); err != nil {
+		t.Fatal(err)
+	}
+	vectorOf := func(i int) []float32 { return []float32{float32(i), float32(i % 7), 1, 0} }
+	blockOf := func(i int) *types.BlockData {
+		return &types.BlockData{Primary: fmt.Sprintf("block %d", i), Vector: vectorOf(i), Keywords: []string{fmt.Sprintf("kw%d", i)}}
+	}
+	keyOf := func(i int) string { return fmt.Sprintf("key-%d", i%20) }
+
+	// 60 single appends, 40 in a batch and a key deleted in between
+	if _, err := vm.AppendBlock("docs", "gone", &types.BlockData{Primary: "gone", Vector: []float32{9, 9, 9, 9}}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 60 {
+		if _, err := vm.AppendBlock("docs", keyOf(i), blockOf(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vm.DeleteKey("docs", "gone"); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	var blocks []*types.BlockData
+	for i := 60; i < 100; i++ {
+		keys = append(keys, keyOf(i))
+		blocks = append(blocks, blockOf(i))
+	}
+	if _, err := vm.BatchAppendBlocks("docs", keys, blocks); err != nil {
+		t.Fatal(err)
+	}
+
+	// Kill the process: the HNSW index was flushed by every append, but the
+	// forward and keyword indexes were never saved
+	vm.wal.Close()
+	vm.Manager.Close()
+
+	vm, err = NewVectorManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+	coll, err := vm.collections.GetCollection("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := coll.DocMap.Count(); got != 100 {
+		t.Fatalf("Forward index holds %d blocks after recovery, want 100", got)
+	}
+	if got := coll.Index.Count(); got != 100 {
+		t.Fatalf("Vector index holds %d vectors after recovery, want 100", got)
+	}
+	if coll.ContainsKey("gone") {
+		t.Error("Deleted key is back after recovery")
+	}
+	for k := range 20 {
+		if length, err := vm.GetKeyLength("docs", keyOf(k)); err != nil || length != 5 {
+			t.Errorf("GetKeyLength(%s) = %d, %v, want 5", keyOf(k), length, err)
+		}
+	}
+	for i := range 100 {
+		index := uint32(i / 20)
+		block, err := vm.GetBlock("docs", keyOf(i), index)
+		if err != nil {
+			t.Fatalf("GetBlock(%s, %d) = %v", keyOf(i), index, err)
+		}
+		if block.Primary != fmt.Sprintf("block %d", i) || fmt.Sprint(block.Vector) != fmt.Sprint(vectorOf(i)) {
+			t.Errorf("Block %d of %s = %+v, want block %d", index, keyOf(i), block, i)
+		}
+		keys, err := vm.KeywordSearch("docs", []string{fmt.Sprintf("kw%d", i)}, "exact", 0)
+		if err != nil || len(keys) != 1 || keys[0] != keyOf(i) {
+			t.Errorf("KeywordSearch(kw%d) = %v, %v, want [%s]", i, keys, err, keyOf(i))
+		}
+		results, err := vm.Search("docs", vectorOf(i), 1, "", nil)
+		if err != nil || len(results) != 1 || results[0].Key != keyOf(i) || results[0].Index != index {
+			t.Errorf("Search for block %d = %+v, %v", i, results, err)
+		}
+	}
+
+	// New blocks get vector IDs past the recovered ones
+	if _, err := vm.AppendBlock("docs", "new", blockOf(100)); err != nil {
+		t.Fatal(err)
+	}
+	if got := coll.Index.Count(); got != 101 {
+		t.Errorf("Vector index holds %d vectors after a new append, want 101", got)
+	}
+}
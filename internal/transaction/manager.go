@@ -1,7 +1,10 @@
 package transaction
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"time"
 	"waddlemap/internal/logger"
 	"waddlemap/internal/storage"
 	"waddlemap/internal/types"
@@ -11,12 +14,20 @@ import (
 type Manager struct {
 	Storage  *storage.VectorManager
 	Requests chan types.RequestContext
+
+	txMu     sync.Mutex
+	pending  map[string]*PendingTransaction // Open transactions by ID
+	txTTL    time.Duration                  // How long a transaction may stay open
+	maxTxOps int                            // Most writes a transaction may buffer
 }
 
 func NewManager(storage *storage.VectorManager) *Manager {
 	return &Manager{
 		Storage:  storage,
 		Requests: make(chan types.RequestContext, 100),
+		pending:  make(map[string]*PendingTransaction),
+		txTTL:    DefaultTransactionTTL,
+		maxTxOps: DefaultMaxTransactionOps,
 	}
 }
 
@@ -40,11 +51,15 @@ func (tm *Manager) dispatch() {
 func (tm *Manager) handle(req types.RequestContext) {
 	var resp types.ResponseContext
 	resp.ReqID = req.ReqID
+	ctx := req.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 
 	// Recover from panics to prevent crashing the server
 	defer func() {
 		if r := recover(); r != nil {
-			logger.Error("Transaction Manager: PANIC in request %s: %v", req.ReqID, r)
+			logger.ErrorContext(ctx, "transaction manager panic", "request", req.ReqID, "panic", r)
 			resp.Success = false
 			resp.Error = fmt.Errorf("internal error: %v", r)
 			select {
@@ -54,6 +69,17 @@ func (tm *Manager) handle(req types.RequestContext) {
 		}
 	}()
 
+	// Writes tagged with a transaction are buffered until it commits
+	if req.TxID != "" {
+		resp.Error = tm.bufferWrite(req)
+		resp.Success = resp.Error == nil
+		select {
+		case req.RespChan <- resp:
+		default:
+		}
+		return
+	}
+
 	// logger.Info("Transaction Manager: Handling request %s (op: %d)", req.ReqID, req.Operation)
 	switch req.Operation {
 	// Collection Ops
@@ -64,8 +90,38 @@ func (tm *Manager) handle(req types.RequestContext) {
 				metric = types.MetricCosine
 			} else if params.Metric == "ip" || params.Metric == "inner_product" {
 				metric = types.MetricIP
+			} else if params.Metric == "jaccard" {
+				metric = types.MetricJaccard
+			} else if params.Metric == "manhattan" || params.Metric == "l1" {
+				metric = types.MetricManhattan
+			}
+			cfg := types.CollectionConfig{
+				Name:       params.Name,
+				Dimensions: params.Dimensions,
+				Metric:     metric,
+				IndexType:  params.IndexType,
+
+				IndexCompression: params.IndexCompression,
+				PQSubspaces:      int(params.PqSubspaces),
+				AutoNormalize:    params.AutoNormalize,
+			}
+			if opts := params.Hnsw; opts != nil {
+				cfg.HNSWOptions = &types.HNSWOptions{
+					M:              int(opts.M),
+					EfConstruction: int(opts.EfConstruction),
+					EfSearch:       int(opts.EfSearch),
+					Ml:             opts.Ml,
+				}
+			}
+			if opts := params.SecondaryHnsw; opts != nil {
+				cfg.SecondaryHNSWOptions = &types.HNSWOptions{
+					M:              int(opts.M),
+					EfConstruction: int(opts.EfConstruction),
+					EfSearch:       int(opts.EfSearch),
+					Ml:             opts.Ml,
+				}
 			}
-			err := tm.Storage.CreateCollection(params.Name, params.Dimensions, metric)
+			err := tm.Storage.CreateCollectionWithConfig(cfg)
 			if err != nil {
 				resp.Success = false
 				resp.Error = err
@@ -116,11 +172,12 @@ func (tm *Manager) handle(req types.RequestContext) {
 		if params, ok := req.Params.(*pb.AppendBlockRequest); ok {
 			// Convert pb.BlockData to types.BlockData
 			block := &types.BlockData{
-				Primary:  params.Block.Primary,
-				Vector:   params.Block.Vector,
-				Keywords: params.Block.Keywords,
+				Primary:    params.Block.Primary,
+				Vector:     params.Block.Vector,
+				Keywords:   params.Block.Keywords,
+				TTLSeconds: params.Block.TtlSeconds,
 			}
-			_, err := tm.Storage.AppendBlock(params.Collection, params.Key, block)
+			_, err := tm.Storage.AppendBlockContext(ctx, params.Collection, params.Key, block)
 			if err != nil {
 				resp.Success = false
 				resp.Error = err
@@ -137,9 +194,10 @@ func (tm *Manager) handle(req types.RequestContext) {
 			for i, r := range params.Requests {
 				keys[i] = r.Key
 				blocks[i] = &types.BlockData{
-					Primary:  r.Block.Primary,
-					Vector:   r.Block.Vector,
-					Keywords: r.Block.Keywords,
+					Primary:    r.Block.Primary,
+					Vector:     r.Block.Vector,
+					Keywords:   r.Block.Keywords,
+					TTLSeconds: r.Block.TtlSeconds,
 				}
 			}
 
@@ -164,9 +222,11 @@ func (tm *Manager) handle(req types.RequestContext) {
 				resp.Success = true
 				if block != nil {
 					resp.Data = &pb.BlockData{
-						Primary:  block.Primary,
-						Vector:   block.Vector,
-						Keywords: block.Keywords,
+						Primary:    block.Primary,
+						Vector:     block.Vector,
+						Keywords:   block.Keywords,
+						TtlSeconds: block.TTLSeconds,
+						Version:    block.Version,
 					}
 				}
 			}
@@ -214,9 +274,11 @@ func (tm *Manager) handle(req types.RequestContext) {
 				pbBlocks := &pb.BlockList{}
 				for _, b := range blocks {
 					pbBlocks.Blocks = append(pbBlocks.Blocks, &pb.BlockData{
-						Primary:  b.Primary,
-						Vector:   b.Vector,
-						Keywords: b.Keywords,
+						Primary:    b.Primary,
+						Vector:     b.Vector,
+						Keywords:   b.Keywords,
+						TtlSeconds: b.TTLSeconds,
+						Version:    b.Version,
 					})
 				}
 				resp.Data = pbBlocks
@@ -225,7 +287,7 @@ func (tm *Manager) handle(req types.RequestContext) {
 
 	case types.OpDeleteKey:
 		if params, ok := req.Params.(*pb.DeleteKeyRequest); ok {
-			err := tm.Storage.DeleteKey(params.Collection, params.Key)
+			err := tm.Storage.DeleteKeyContext(ctx, params.Collection, params.Key)
 			if err != nil {
 				resp.Success = false
 				resp.Error = err
@@ -267,9 +329,10 @@ func (tm *Manager) handle(req types.RequestContext) {
 	case types.OpUpdateBlock:
 		if params, ok := req.Params.(*pb.UpdateBlockRequest); ok {
 			block := &types.BlockData{
-				Primary:  params.Block.Primary,
-				Vector:   params.Block.Vector,
-				Keywords: params.Block.Keywords,
+				Primary:    params.Block.Primary,
+				Vector:     params.Block.Vector,
+				Keywords:   params.Block.Keywords,
+				TTLSeconds: params.Block.TtlSeconds,
 			}
 			err := tm.Storage.UpdateBlock(params.Collection, params.Key, params.Index, block)
 			if err != nil {
@@ -283,9 +346,10 @@ func (tm *Manager) handle(req types.RequestContext) {
 	case types.OpReplaceBlock:
 		if params, ok := req.Params.(*pb.ReplaceBlockRequest); ok {
 			block := &types.BlockData{
-				Primary:  params.Block.Primary,
-				Vector:   params.Block.Vector,
-				Keywords: params.Block.Keywords,
+				Primary:    params.Block.Primary,
+				Vector:     params.Block.Vector,
+				Keywords:   params.Block.Keywords,
+				TTLSeconds: params.Block.TtlSeconds,
 			}
 			err := tm.Storage.ReplaceBlock(params.Collection, params.Key, params.Index, block)
 			if err != nil {
@@ -296,37 +360,77 @@ func (tm *Manager) handle(req types.RequestContext) {
 			}
 		}
 
+	case types.OpUpdateValueConditional:
+		if params, ok := req.Params.(*pb.UpdateValueConditional); ok {
+			block := &types.BlockData{
+				Primary:    params.Block.Primary,
+				Vector:     params.Block.Vector,
+				Keywords:   params.Block.Keywords,
+				TTLSeconds: params.Block.TtlSeconds,
+			}
+			err := tm.Storage.CompareAndSwapBlock(params.Collection, params.Key, params.Index, params.ExpectedVersion, block)
+			if err != nil {
+				resp.Success = false
+				resp.Error = err
+			} else {
+				resp.Success = true
+			}
+		}
+
 	case types.OpSearch:
 		if params, ok := req.Params.(*pb.SearchRequest); ok {
-			res, err := tm.Storage.Search(params.Collection, params.Query, params.TopK, params.Mode, params.Keywords)
+			filter := &types.SearchFilter{Keywords: params.Keywords, KeywordMode: params.Mode, MaxDistance: params.MaxDistance}
+			res, err := tm.Storage.SearchWithFilterContext(ctx, params.Collection, params.Query, params.TopK, filter, "primary")
 			if err != nil {
 				resp.Success = false
 				resp.Error = err
 			} else {
 				resp.Success = true
-				sList := &pb.SearchResultList{}
-				for _, r := range res {
-					item := &pb.SearchResultItem{
-						Key:      r.Key,
-						Index:    r.Index,
-						Distance: r.Distance,
-					}
-					if r.Block != nil {
-						item.Block = &pb.BlockData{
-							Primary:  r.Block.Primary,
-							Vector:   r.Block.Vector,
-							Keywords: r.Block.Keywords,
-						}
-					}
-					sList.Results = append(sList.Results, item)
+				resp.Data = toSearchResultList(res)
+			}
+		}
+
+	case types.OpSearchVariant:
+		if params, ok := req.Params.(*pb.SearchVariantRequest); ok {
+			filter := &types.SearchFilter{Keywords: params.Keywords, KeywordMode: params.Mode, MaxDistance: params.MaxDistance}
+			res, err := tm.Storage.SearchWithFilterContext(ctx, params.Collection, params.Query, params.TopK, filter, params.Variant)
+			if err != nil {
+				resp.Success = false
+				resp.Error = err
+			} else {
+				resp.Success = true
+				resp.Data = toSearchResultList(res)
+			}
+		}
+
+	case types.OpBatchSearch:
+		if params, ok := req.Params.(*pb.BatchSearchRequest); ok {
+			requests := make([]storage.BatchSearchRequest, len(params.Queries))
+			for i, q := range params.Queries {
+				requests[i] = storage.BatchSearchRequest{
+					Collection: q.Collection,
+					Query:      q.Query,
+					TopK:       q.TopK,
+					Filter:     &types.SearchFilter{Keywords: q.Keywords, KeywordMode: q.Mode, MaxDistance: q.MaxDistance},
 				}
-				resp.Data = sList
+			}
+			res, err := tm.Storage.BatchSearch(requests)
+			if err != nil {
+				resp.Success = false
+				resp.Error = err
+			} else {
+				resp.Success = true
+				batch := &pb.BatchSearchResponse{Results: make([]*pb.SearchResultList, len(res))}
+				for i, r := range res {
+					batch.Results[i] = toSearchResultList(r)
+				}
+				resp.Data = batch
 			}
 		}
 
 	case types.OpSearchMLT:
 		if params, ok := req.Params.(*pb.SearchMoreLikeThisRequest); ok {
-			res, err := tm.Storage.SearchMLT(params.Collection, params.Key, params.Index, params.TopK)
+			res, err := tm.Storage.SearchMLT(params.Collection, params.Key, params.Index, params.TopK, params.ExcludeSelf)
 			if err != nil {
 				resp.Success = false
 				resp.Error = err
@@ -412,6 +516,42 @@ func (tm *Manager) handle(req types.RequestContext) {
 			}
 		}
 
+	// Transactions
+	case types.OpBeginTransaction:
+		if _, ok := req.Params.(*pb.BeginTransactionRequest); ok {
+			id, err := tm.BeginTransaction()
+			if err != nil {
+				resp.Success = false
+				resp.Error = err
+			} else {
+				resp.Success = true
+				resp.Data = &pb.BeginTransactionResponse{TransactionId: id}
+			}
+		}
+
+	case types.OpCommitTransaction:
+		if params, ok := req.Params.(*pb.CommitTransactionRequest); ok {
+			n, err := tm.CommitTransaction(params.TransactionId)
+			if err != nil {
+				resp.Success = false
+				resp.Error = err
+			} else {
+				resp.Success = true
+				resp.Data = uint64(n)
+			}
+		}
+
+	case types.OpRollbackTransaction:
+		if params, ok := req.Params.(*pb.RollbackTransactionRequest); ok {
+			err := tm.RollbackTransaction(params.TransactionId)
+			if err != nil {
+				resp.Success = false
+				resp.Error = err
+			} else {
+				resp.Success = true
+			}
+		}
+
 	default:
 		resp.Success = false
 		resp.Error = fmt.Errorf("operation not implemented: %v", req.Operation)
@@ -427,3 +567,27 @@ func (tm *Manager) handle(req types.RequestContext) {
 	default:
 	}
 }
+
+// toSearchResultList converts search results, including their blocks, to the
+// protocol representation.
+func toSearchResultList(res []types.SearchResultItem) *pb.SearchResultList {
+	sList := &pb.SearchResultList{}
+	for _, r := range res {
+		item := &pb.SearchResultItem{
+			Key:      r.Key,
+			Index:    r.Index,
+			Distance: r.Distance,
+		}
+		if r.Block != nil {
+			item.Block = &pb.BlockData{
+				Primary:    r.Block.Primary,
+				Vector:     r.Block.Vector,
+				Keywords:   r.Block.Keywords,
+				TtlSeconds: r.Block.TTLSeconds,
+				Version:    r.Block.Version,
+			}
+		}
+		sList.Results = append(sList.Results, item)
+	}
+	return sList
+}
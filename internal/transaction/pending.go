@@ -0,0 +1,185 @@
+package transaction
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"waddlemap/internal/storage"
+	"waddlemap/internal/types"
+	pb "waddlemap/proto"
+)
+
+// DefaultTransactionTTL is how long a transaction may stay open. Older
+// transactions are rolled back.
+const DefaultTransactionTTL = 5 * time.Minute
+
+// DefaultMaxTransactionOps is the most writes a transaction may buffer.
+const DefaultMaxTransactionOps = 10000
+
+// PendingTransaction buffers the writes of an open transaction until it is
+// committed or rolled back.
+type PendingTransaction struct {
+	ID      string
+	Ops     []storage.TxOp
+	Created time.Time
+}
+
+// expired reports whether the transaction has been open longer than ttl.
+func (tx *PendingTransaction) expired(now time.Time, ttl time.Duration) bool {
+	return now.Sub(tx.Created) > ttl
+}
+
+// BeginTransaction opens a transaction and returns its token. Transactions
+// still open after the TTL are rolled back.
+func (tm *Manager) BeginTransaction() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("failed to generate transaction ID: %w", err)
+	}
+	id := hex.EncodeToString(buf[:])
+
+	now := time.Now()
+	tm.txMu.Lock()
+	defer tm.txMu.Unlock()
+	tm.evictExpired(now)
+	tm.pending[id] = &PendingTransaction{ID: id, Created: now}
+	return id, nil
+}
+
+// CommitTransaction applies the buffered writes of a transaction atomically
+// and closes it. Returns the number of writes applied. The transaction is
+// closed even if the commit fails.
+func (tm *Manager) CommitTransaction(id string) (int, error) {
+	tx, err := tm.takeTransaction(id)
+	if err != nil {
+		return 0, err
+	}
+	if err := tm.Storage.CommitTransaction(tx.ID, tx.Ops); err != nil {
+		return 0, err
+	}
+	return len(tx.Ops), nil
+}
+
+// RollbackTransaction discards the buffered writes of a transaction.
+func (tm *Manager) RollbackTransaction(id string) error {
+	_, err := tm.takeTransaction(id)
+	return err
+}
+
+// takeTransaction removes an open transaction so it can be finished.
+func (tm *Manager) takeTransaction(id string) (*PendingTransaction, error) {
+	tm.txMu.Lock()
+	defer tm.txMu.Unlock()
+	tx, err := tm.openTransaction(id)
+	if err != nil {
+		return nil, err
+	}
+	delete(tm.pending, id)
+	return tx, nil
+}
+
+// openTransaction returns the open transaction id, rolling it back if it
+// has expired (caller must hold txMu).
+func (tm *Manager) openTransaction(id string) (*PendingTransaction, error) {
+	tx, ok := tm.pending[id]
+	if !ok {
+		return nil, fmt.Errorf("transaction %q not found", id)
+	}
+	if tx.expired(time.Now(), tm.txTTL) {
+		delete(tm.pending, id)
+		return nil, fmt.Errorf("transaction %q expired", id)
+	}
+	return tx, nil
+}
+
+// evictExpired rolls back the transactions open longer than the TTL, so
+// abandoned ones don't hold their writes forever (caller must hold txMu).
+func (tm *Manager) evictExpired(now time.Time) {
+	for id, tx := range tm.pending {
+		if tx.expired(now, tm.txTTL) {
+			delete(tm.pending, id)
+		}
+	}
+}
+
+// bufferWrite adds the write in req to the transaction req.TxID.
+func (tm *Manager) bufferWrite(req types.RequestContext) error {
+	ops, err := txOps(req)
+	if err != nil {
+		return err
+	}
+
+	tm.txMu.Lock()
+	defer tm.txMu.Unlock()
+	tx, err := tm.openTransaction(req.TxID)
+	if err != nil {
+		return err
+	}
+	if len(tx.Ops)+len(ops) > tm.maxTxOps {
+		return fmt.Errorf("transaction %q would exceed the limit of %d writes", req.TxID, tm.maxTxOps)
+	}
+	tx.Ops = append(tx.Ops, ops...)
+	return nil
+}
+
+// txOps converts a write request to transaction ops.
+func txOps(req types.RequestContext) ([]storage.TxOp, error) {
+	switch params := req.Params.(type) {
+	case *pb.AppendBlockRequest:
+		return []storage.TxOp{{
+			Type:       storage.TxOpAppend,
+			Collection: params.Collection,
+			Key:        params.Key,
+			Block:      blockFromPB(params.Block),
+		}}, nil
+	case *pb.BatchAppendBlockRequest:
+		ops := make([]storage.TxOp, len(params.Requests))
+		for i, r := range params.Requests {
+			ops[i] = storage.TxOp{
+				Type:       storage.TxOpAppend,
+				Collection: params.Collection,
+				Key:        r.Key,
+				Block:      blockFromPB(r.Block),
+			}
+		}
+		return ops, nil
+	case *pb.UpdateBlockRequest:
+		return []storage.TxOp{{
+			Type:       storage.TxOpUpdate,
+			Collection: params.Collection,
+			Key:        params.Key,
+			Index:      params.Index,
+			Block:      blockFromPB(params.Block),
+		}}, nil
+	case *pb.ReplaceBlockRequest:
+		return []storage.TxOp{{
+			Type:       storage.TxOpUpdate,
+			Collection: params.Collection,
+			Key:        params.Key,
+			Index:      params.Index,
+			Block:      blockFromPB(params.Block),
+		}}, nil
+	case *pb.DeleteKeyRequest:
+		return []storage.TxOp{{
+			Type:       storage.TxOpDeleteKey,
+			Collection: params.Collection,
+			Key:        params.Key,
+		}}, nil
+	}
+	return nil, fmt.Errorf("operation %v cannot be part of a transaction", req.Operation)
+}
+
+// blockFromPB converts a protocol block; a missing block stays nil.
+func blockFromPB(b *pb.BlockData) *types.BlockData {
+	if b == nil {
+		return nil
+	}
+	return &types.BlockData{
+		Primary:    b.Primary,
+		Vector:     b.Vector,
+		Keywords:   b.Keywords,
+		TTLSeconds: b.TtlSeconds,
+	}
+}
@@ -0,0 +1,70 @@
+package transaction
+
+import (
+	"testing"
+	"time"
+
+	"waddlemap/internal/types"
+	pb "waddlemap/proto"
+)
+
+func appendRequest(txID string) types.RequestContext {
+	return types.RequestContext{
+		Operation: types.OpAppendBlock,
+		Params:    &pb.AppendBlockRequest{Collection: "col", Key: "k", Block: &pb.BlockData{Primary: "p"}},
+		TxID:      txID,
+	}
+}
+
+func TestManager_TransactionExpires(t *testing.T) {
+	tm := NewManager(nil)
+	stale, err := tm.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm.pending[stale].Created = time.Now().Add(-2 * tm.txTTL)
+
+	if err := tm.bufferWrite(appendRequest(stale)); err == nil {
+		t.Error("Expected a write to an expired transaction to fail")
+	}
+	if _, ok := tm.pending[stale]; ok {
+		t.Error("Expected the expired transaction to be rolled back")
+	}
+
+	// Abandoned transactions are swept when new ones begin
+	abandoned, err := tm.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm.pending[abandoned].Created = time.Now().Add(-2 * tm.txTTL)
+	fresh, err := tm.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tm.pending[abandoned]; ok {
+		t.Error("Expected the abandoned transaction to be swept")
+	}
+	if err := tm.bufferWrite(appendRequest(fresh)); err != nil {
+		t.Errorf("bufferWrite failed: %v", err)
+	}
+}
+
+func TestManager_TransactionOpLimit(t *testing.T) {
+	tm := NewManager(nil)
+	tm.maxTxOps = 2
+	id, err := tm.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := tm.bufferWrite(appendRequest(id)); err != nil {
+			t.Fatalf("bufferWrite failed: %v", err)
+		}
+	}
+	if err := tm.bufferWrite(appendRequest(id)); err == nil {
+		t.Error("Expected a write past the op limit to fail")
+	}
+	if n := len(tm.pending[id].Ops); n != 2 {
+		t.Errorf("Expected 2 buffered writes, got %d", n)
+	}
+}
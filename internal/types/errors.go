@@ -0,0 +1,199 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors of the storage layer. The errors returned for them are one
+// of the structured types below, which carry the details and match their
+// sentinel with errors.Is, also when wrapped:
+//
+//	if errors.Is(err, types.ErrCollectionNotFound) { ... }
+//
+//	var dim *types.DimensionMismatchError
+//	if errors.As(err, &dim) { ... dim.Expected ... }
+var (
+	ErrCollectionNotFound = errors.New("collection not found")
+	ErrKeyNotFound        = errors.New("key not found")
+	ErrDimensionMismatch  = errors.New("dimension mismatch")
+	ErrMetricMismatch     = errors.New("metric mismatch")
+	ErrDuplicateID        = errors.New("duplicate vector ID")
+	ErrInvalidConfig      = errors.New("invalid collection config")
+	ErrStorageFull        = errors.New("storage full")
+	ErrChecksumMismatch   = errors.New("checksum mismatch")
+	ErrIndexCorrupted     = errors.New("index corrupted")
+	ErrVersionConflict    = errors.New("version conflict")
+	ErrCancelled          = errors.New("request cancelled")
+)
+
+// CollectionNotFoundError is returned for a collection that does not exist.
+type CollectionNotFoundError struct {
+	Collection string
+}
+
+func (e *CollectionNotFoundError) Error() string {
+	return fmt.Sprintf("collection %q not found", e.Collection)
+}
+
+func (e *CollectionNotFoundError) Is(target error) bool { return target == ErrCollectionNotFound }
+
+// KeyNotFoundError is returned for a key that does not exist. Collection is
+// empty for keys of the record store, which has no collections.
+type KeyNotFoundError struct {
+	Collection string
+	Key        string
+}
+
+func (e *KeyNotFoundError) Error() string {
+	return fmt.Sprintf("key %q not found", e.Key)
+}
+
+func (e *KeyNotFoundError) Is(target error) bool { return target == ErrKeyNotFound }
+
+// BlockNotFoundError is returned for a block index past the end of a key. It
+// matches ErrKeyNotFound, as callers rarely tell the two apart.
+type BlockNotFoundError struct {
+	Collection string
+	Key        string
+	Index      uint32
+}
+
+func (e *BlockNotFoundError) Error() string {
+	return fmt.Sprintf("block %d not found for key %q", e.Index, e.Key)
+}
+
+func (e *BlockNotFoundError) Is(target error) bool { return target == ErrKeyNotFound }
+
+// DimensionMismatchError is returned for a vector, query or index file whose
+// dimensions differ from the collection's. Subject names what was checked,
+// such as "query" or "vector".
+type DimensionMismatchError struct {
+	Collection string
+	Subject    string
+	Expected   int
+	Actual     int
+}
+
+func (e *DimensionMismatchError) Error() string {
+	return fmt.Sprintf("%s dimension mismatch: expected %d, got %d", e.Subject, e.Expected, e.Actual)
+}
+
+func (e *DimensionMismatchError) Is(target error) bool { return target == ErrDimensionMismatch }
+
+// MetricMismatchError is returned for an index file built with another
+// distance metric than the collection's.
+type MetricMismatchError struct {
+	Collection string
+	Subject    string
+	Expected   DistanceMetric
+	Actual     DistanceMetric
+}
+
+func (e *MetricMismatchError) Error() string {
+	return fmt.Sprintf("%s metric mismatch: expected %s, got %s", e.Subject, e.Expected, e.Actual)
+}
+
+func (e *MetricMismatchError) Is(target error) bool { return target == ErrMetricMismatch }
+
+// DuplicateIDError is returned when a vector ID is added to an index that
+// already holds it.
+type DuplicateIDError struct {
+	Collection string
+	ID         uint64
+}
+
+func (e *DuplicateIDError) Error() string {
+	return fmt.Sprintf("vector ID %d already exists", e.ID)
+}
+
+func (e *DuplicateIDError) Is(target error) bool { return target == ErrDuplicateID }
+
+// InvalidConfigError is returned for a collection config that fails
+// validation. Err describes the problem.
+type InvalidConfigError struct {
+	Collection string
+	Err        error
+}
+
+func (e *InvalidConfigError) Error() string { return e.Err.Error() }
+
+func (e *InvalidConfigError) Unwrap() error { return e.Err }
+
+func (e *InvalidConfigError) Is(target error) bool { return target == ErrInvalidConfig }
+
+// StorageFullError is returned when a write fails because the disk holding
+// Path is out of space.
+type StorageFullError struct {
+	Path string
+	Err  error
+}
+
+func (e *StorageFullError) Error() string {
+	return fmt.Sprintf("storage full writing %s: %v", e.Path, e.Err)
+}
+
+func (e *StorageFullError) Unwrap() error { return e.Err }
+
+func (e *StorageFullError) Is(target error) bool { return target == ErrStorageFull }
+
+// ChecksumMismatchError is returned for a stored record whose CRC does not
+// match its contents.
+type ChecksumMismatchError struct {
+	Key      string
+	Expected uint32 // Stored CRC
+	Actual   uint32 // CRC of the data read
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("CRC mismatch: stored=%08x calculated=%08x", e.Expected, e.Actual)
+	}
+	return fmt.Sprintf("CRC mismatch for key %q: stored=%08x calculated=%08x", e.Key, e.Expected, e.Actual)
+}
+
+func (e *ChecksumMismatchError) Is(target error) bool { return target == ErrChecksumMismatch }
+
+// IndexCorruptedError is returned for an index file that cannot be parsed.
+// Err describes the problem.
+type IndexCorruptedError struct {
+	Path string
+	Err  error
+}
+
+func (e *IndexCorruptedError) Error() string {
+	return fmt.Sprintf("index %s is corrupted: %v", e.Path, e.Err)
+}
+
+func (e *IndexCorruptedError) Unwrap() error { return e.Err }
+
+func (e *IndexCorruptedError) Is(target error) bool { return target == ErrIndexCorrupted }
+
+// VersionConflictError is returned by a conditional update of a block whose
+// version is no longer the expected one.
+type VersionConflictError struct {
+	Collection string
+	Key        string
+	Index      uint32
+	Expected   uint64
+	Actual     uint64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("block %d of key %q is at version %d, expected %d", e.Index, e.Key, e.Actual, e.Expected)
+}
+
+func (e *VersionConflictError) Is(target error) bool { return target == ErrVersionConflict }
+
+// CancelledError is returned by an operation stopped because its context was
+// done. Err is the context's error, context.Canceled or
+// context.DeadlineExceeded, so errors.Is matches those too.
+type CancelledError struct {
+	Err error
+}
+
+func (e *CancelledError) Error() string { return "request cancelled: " + e.Err.Error() }
+
+func (e *CancelledError) Unwrap() error { return e.Err }
+
+func (e *CancelledError) Is(target error) bool { return target == ErrCancelled }
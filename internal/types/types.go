@@ -1,5 +1,10 @@
 package types
 
+import (
+	"context"
+	"time"
+)
+
 // ProtocolMethod defines the operation type.
 type ProtocolMethod int
 
@@ -24,6 +29,12 @@ const (
 	OpKeywordSearch
 	OpSnapshotCollection
 	OpBatchAppendBlock
+	OpSearchVariant
+	OpBatchSearch
+	OpBeginTransaction
+	OpCommitTransaction
+	OpRollbackTransaction
+	OpUpdateValueConditional
 )
 
 // DBSchemaConfig holds database configuration.
@@ -31,13 +42,58 @@ type DBSchemaConfig struct {
 	PayloadSize int
 	DataPath    string
 	SyncMode    string // "strict" or "async"
+
+	// FlushInterval controls how often dirty collection indexes are saved
+	// in the background. Zero uses the default; negative disables flushing.
+	FlushInterval time.Duration
+
+	// CursorTTL controls how long paged search results are kept between
+	// page requests. Zero uses the default.
+	CursorTTL time.Duration
+
+	// ExpirySweepInterval controls how often blocks whose TTL has passed are
+	// removed in the background. Zero uses the default; negative disables
+	// sweeping (expired blocks are still hidden from reads).
+	ExpirySweepInterval time.Duration
+
+	// CoalescingEnabled buffers concurrent appends to the same collection
+	// for CoalescingWindow and writes them as one batch. Zero CoalescingWindow
+	// uses the default.
+	CoalescingEnabled bool
+	CoalescingWindow  time.Duration
+
+	// AdaptiveEfEnabled tunes the EfSearch of primary searches per
+	// collection to keep them near AdaptiveEfTarget (see
+	// Collection.AdaptiveSearch). Zero AdaptiveEfTarget uses the default.
+	AdaptiveEfEnabled bool
+	AdaptiveEfTarget  time.Duration
+
+	// WALMaxSegmentBytes is the size at which the live WAL file is rotated
+	// into a segment. Zero uses the default.
+	WALMaxSegmentBytes int64
+
+	// VectorCacheSize is the number of vectors kept in the LRU cache of
+	// GetVectorByID. Zero uses the default and a negative size disables it.
+	VectorCacheSize int
+
+	// SearchCacheSize is the number of searches whose results are kept in
+	// the LRU cache of repeated searches. Zero uses the default and a
+	// negative size disables it.
+	SearchCacheSize int
+
+	// PartitionCount is the number of bucket files keys are spread over, a
+	// power of 2. Zero uses the default. It cannot change once data is
+	// written, except with the repartition tool.
+	PartitionCount int
 }
 
 // RequestContext carries request data through the pipeline.
 type RequestContext struct {
 	ReqID     string
+	Ctx       context.Context // Carries the trace ID logged with the request; may be nil
 	Operation ProtocolMethod
 	Params    interface{}          // Wraps specific request struct
+	TxID      string               // Transaction to buffer a write in, if any
 	RespChan  chan ResponseContext // Channel to send response back
 }
 
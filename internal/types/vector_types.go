@@ -4,9 +4,23 @@ package types
 type DistanceMetric string
 
 const (
-	MetricL2     DistanceMetric = "l2"     // Euclidean distance
-	MetricCosine DistanceMetric = "cosine" // Cosine similarity
-	MetricIP     DistanceMetric = "ip"     // Inner product
+	MetricL2        DistanceMetric = "l2"        // Euclidean distance
+	MetricCosine    DistanceMetric = "cosine"    // Cosine similarity
+	MetricIP        DistanceMetric = "ip"        // Inner product
+	MetricJaccard   DistanceMetric = "jaccard"   // Jaccard distance of the sets of non-zero components
+	MetricManhattan DistanceMetric = "manhattan" // Sum of absolute differences (L1)
+)
+
+// Primary index types for CollectionConfig.IndexType.
+const (
+	IndexTypeHNSW = "hnsw" // Approximate HNSW graph
+	IndexTypeFlat = "flat" // Exact brute-force scan
+)
+
+// Vector compression modes for CollectionConfig.IndexCompression.
+const (
+	CompressionNone = "none"
+	CompressionPQ   = "pq" // Product quantization
 )
 
 // DataType identifies the type of data stored in an entry.
@@ -29,6 +43,56 @@ type CollectionConfig struct {
 	Name       string         `json:"name"`       // Unique collection name
 	Dimensions uint32         `json:"dimensions"` // Fixed vector dimensions
 	Metric     DistanceMetric `json:"metric"`     // Distance metric: "l2" | "cosine" | "ip"
+
+	// IndexType selects the primary index: IndexTypeHNSW (default) or
+	// IndexTypeFlat for exact brute-force search over small collections.
+	IndexType string `json:"index_type,omitempty"`
+
+	// IndexCompression stores vectors compressed: CompressionNone (default)
+	// or CompressionPQ, which requires the flat index type. PQSubspaces is
+	// the number of sub-vectors (bytes per vector) and must divide
+	// Dimensions; 0 picks sub-vectors of about 4 dimensions.
+	IndexCompression string `json:"index_compression,omitempty"`
+	PQSubspaces      int    `json:"pq_subspaces,omitempty"`
+
+	// Float16Vectors stores HNSW vectors in half precision, halving their
+	// memory at a small cost in recall. Requires the HNSW index type.
+	Float16Vectors bool `json:"float16_vectors,omitempty"`
+
+	// MmapVectors keeps HNSW vectors in a memory-mapped file instead of on
+	// the heap, so that the operating system can page them out. Requires
+	// the HNSW index type.
+	MmapVectors bool `json:"mmap_vectors,omitempty"`
+
+	// AutoNormalize scales inserted vectors and queries to unit length.
+	// Requires the cosine metric.
+	AutoNormalize bool `json:"auto_normalize,omitempty"`
+
+	// NGramSizes are the n-gram lengths keywords are indexed under for
+	// partial matching, such as [2] for bigrams or [2, 3] for both. Empty
+	// uses trigrams.
+	NGramSizes []int `json:"ngram_sizes,omitempty"`
+
+	// TokenizationMode selects how keywords are split for partial matching:
+	// "ngram" (default), "whitespace" for space-separated words or
+	// "cjk_char" for Chinese, Japanese and Korean text. The latter two also
+	// accept keywords with letters of any script.
+	TokenizationMode string `json:"tokenization_mode,omitempty"`
+
+	// HNSWOptions sets the primary graph parameters. Nil uses the defaults.
+	HNSWOptions *HNSWOptions `json:"hnsw_options,omitempty"`
+
+	// SecondaryHNSWOptions enables a second HNSW graph built with different
+	// parameters, for comparing search quality. Nil disables it.
+	SecondaryHNSWOptions *HNSWOptions `json:"secondary_hnsw_options,omitempty"`
+}
+
+// HNSWOptions overrides HNSW graph parameters. Zero fields keep the defaults.
+type HNSWOptions struct {
+	M              int     `json:"m"`
+	EfConstruction int     `json:"ef_construction"`
+	EfSearch       int     `json:"ef_search"`
+	Ml             float64 `json:"ml,omitempty"` // Level normalization factor; defaults to 1/ln(M)
 }
 
 // KeywordEntry represents keyword metadata for a vector entry.
@@ -40,10 +104,21 @@ type KeywordEntry struct {
 
 // SearchFilter defines filters for vector/keyword searches.
 type SearchFilter struct {
-	Keys        []string // Limit to specific keys (empty = all)
-	Keywords    []string // Keyword filter
-	KeywordMode string   // "exact"|"prefix"|"partial"|"levenshtein"
-	MaxDistance uint32   // For levenshtein mode
+	Keys            []string // Limit to specific keys (empty = all)
+	Keywords        []string // Keyword filter
+	KeywordMode     string   // "exact"|"any"|"prefix"|"partial"|"levenshtein"|"jaccard"
+	MaxEditDistance uint32   // For levenshtein mode
+
+	// JaccardThreshold is the Jaccard similarity between the query keywords
+	// and a block's keywords that jaccard mode requires (0 = any overlap).
+	JaccardThreshold float32
+
+	ExcludeIDs  []uint64 // Vector IDs to drop from results
+	ExcludeKeys []string // Keys whose blocks are dropped from results
+
+	// Thresholds that drop poor matches instead of padding results to topK.
+	MaxDistance float32 // L2/cosine: drop results with Distance > MaxDistance (0 = no limit)
+	MinScore    float32 // Inner product: drop results whose dot product is below MinScore (0 = no limit)
 }
 
 // VectorSearchResult holds a single result from a vector search.
@@ -56,9 +131,11 @@ type VectorSearchResult struct {
 
 // BlockData represents a single block of data.
 type BlockData struct {
-	Primary  string    // Primary text/binary data
-	Vector   []float32 // Secondary vector data
-	Keywords []string  // Keywords
+	Primary    string    // Primary text/binary data
+	Vector     []float32 // Secondary vector data
+	Keywords   []string  // Keywords
+	TTLSeconds int64     // Seconds until the block expires (0 = never)
+	Version    uint64    // Number of updates of the block, on reads (0 = never updated)
 }
 
 // SearchResultItem holds a result from block-based search.
@@ -66,6 +143,7 @@ type SearchResultItem struct {
 	Key      string     // Document Key
 	Index    uint32     // Block Index
 	Distance float32    // Distance
+	Score    float64    // Relevance score for ranked keyword search (higher is better)
 	Block    *BlockData // Optional block content
 }
 
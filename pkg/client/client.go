@@ -0,0 +1,305 @@
+// Package client is a minimal Go client for the WaddleMap wire protocol.
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"waddlemap/internal/storage"
+	pb "waddlemap/proto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// EventBuffer is the number of events queued per subscription channel. Events
+// arriving while the channel is full are dropped.
+const EventBuffer = 256
+
+// Client speaks the length-prefixed protobuf protocol over a single TCP connection.
+// Requests are serialized; a Client is safe for concurrent use. Subscription
+// events arrive on the same connection and are routed by subscription ID.
+type Client struct {
+	conn   net.Conn
+	nextID uint64
+	mu     sync.Mutex
+
+	responses chan *pb.WaddleResponse // Non-event frames, in order
+
+	subsMu  sync.Mutex
+	subs    map[string]chan *pb.Event
+	readErr error
+}
+
+// Dial connects to a WaddleMap server at addr (host:port).
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:      conn,
+		responses: make(chan *pb.WaddleResponse),
+		subs:      make(map[string]chan *pb.Event),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// Close closes the underlying connection. Subscription channels are closed
+// once the connection shuts down.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// readLoop reads frames until the connection fails, sending responses to
+// c.responses and events to their subscription channel.
+func (c *Client) readLoop() {
+	var err error
+	defer func() {
+		c.subsMu.Lock()
+		c.readErr = err
+		for _, ch := range c.subs {
+			close(ch)
+		}
+		c.subs = nil
+		c.subsMu.Unlock()
+		close(c.responses)
+	}()
+
+	lenBuf := make([]byte, 4)
+	for {
+		if _, err = io.ReadFull(c.conn, lenBuf); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(lenBuf))
+		if _, err = io.ReadFull(c.conn, body); err != nil {
+			return
+		}
+
+		resp := &pb.WaddleResponse{}
+		if err = proto.Unmarshal(body, resp); err != nil {
+			return
+		}
+
+		if ev := resp.GetEvent(); ev != nil {
+			c.subsMu.Lock()
+			if ch, ok := c.subs[ev.SubscriptionId]; ok {
+				select {
+				case ch <- ev:
+				default:
+				}
+			}
+			c.subsMu.Unlock()
+			continue
+		}
+		c.responses <- resp
+	}
+}
+
+// send writes a request and waits for its response. The caller must hold c.mu.
+func (c *Client) send(req *pb.WaddleRequest) (*pb.WaddleResponse, error) {
+	c.nextID++
+	req.RequestId = strconv.FormatUint(c.nextID, 10)
+
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+
+	resp, ok := <-c.responses
+	if !ok {
+		c.subsMu.Lock()
+		defer c.subsMu.Unlock()
+		if c.readErr != nil {
+			return nil, c.readErr
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	if resp.RequestId != req.RequestId {
+		return nil, fmt.Errorf("response for request %s, expected %s", resp.RequestId, req.RequestId)
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("server error: %s", resp.ErrorMessage)
+	}
+	return resp, nil
+}
+
+// Subscribe registers a subscription on this connection and returns the channel
+// its events are delivered on. collection may be empty to receive events for
+// every collection; with no eventTypes every event type is delivered.
+func (c *Client) Subscribe(id, collection string, eventTypes ...string) (<-chan *pb.Event, error) {
+	ch := make(chan *pb.Event, EventBuffer)
+
+	// Register before sending so events racing the response are not lost
+	c.subsMu.Lock()
+	if c.subs == nil {
+		c.subsMu.Unlock()
+		return nil, errors.New("connection closed")
+	}
+	if _, exists := c.subs[id]; exists {
+		c.subsMu.Unlock()
+		return nil, fmt.Errorf("subscription %q already exists", id)
+	}
+	c.subs[id] = ch
+	c.subsMu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.send(&pb.WaddleRequest{Operation: &pb.WaddleRequest_Subscribe{
+		Subscribe: &pb.SubscribeRequest{SubscriptionId: id, Collection: collection, EventTypes: eventTypes},
+	}})
+	if err != nil {
+		c.subsMu.Lock()
+		if c.subs != nil {
+			delete(c.subs, id)
+			close(ch)
+		}
+		c.subsMu.Unlock()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// CreateCollection creates a new collection.
+func (c *Client) CreateCollection(name string, dimensions uint32, metric string) error {
+	return c.CreateCollectionWithOptions(&pb.CreateCollectionRequest{Name: name, Dimensions: dimensions, Metric: metric})
+}
+
+// CreateCollectionWithOptions creates a collection with the index options of
+// req.
+func (c *Client) CreateCollectionWithOptions(req *pb.CreateCollectionRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.send(&pb.WaddleRequest{Operation: &pb.WaddleRequest_CreateCol{CreateCol: req}})
+	return err
+}
+
+// GetVector returns the vector stored at a block.
+func (c *Client) GetVector(collection, key string, index uint32) ([]float32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp, err := c.send(&pb.WaddleRequest{Operation: &pb.WaddleRequest_GetVector{
+		GetVector: &pb.GetVectorRequest{Collection: collection, Key: key, Index: index},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetBlock().GetVector(), nil
+}
+
+// BatchSearch runs several searches in one round trip and returns one result
+// list per query, in order.
+func (c *Client) BatchSearch(queries []*pb.SearchRequest) ([]*pb.SearchResultList, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp, err := c.send(&pb.WaddleRequest{Operation: &pb.WaddleRequest_BatchSearch{
+		BatchSearch: &pb.BatchSearchRequest{Queries: queries},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetBatchSearch().GetResults(), nil
+}
+
+// KeyLength returns the number of blocks stored under key, or 0 if it does not exist.
+func (c *Client) KeyLength(collection, key string) (uint32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keyLength(collection, key)
+}
+
+// BatchAppend appends blocks[i] to keys[i] for every i in one round trip.
+func (c *Client) BatchAppend(collection string, keys []string, blocks []*pb.BlockData) error {
+	if len(keys) != len(blocks) {
+		return errors.New("keys and blocks must have the same length")
+	}
+	batch := &pb.BatchAppendBlockRequest{
+		Collection: collection,
+		Requests:   make([]*pb.AppendBlockRequest, len(keys)),
+	}
+	for i, key := range keys {
+		batch.Requests[i] = &pb.AppendBlockRequest{Collection: collection, Key: key, Block: blocks[i]}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.send(&pb.WaddleRequest{Operation: &pb.WaddleRequest_BatchAppend{BatchAppend: batch}})
+	return err
+}
+
+// keyLength returns the number of blocks stored under key, or 0 if it does not exist.
+// The caller must hold c.mu.
+func (c *Client) keyLength(collection, key string) (uint32, error) {
+	resp, err := c.send(&pb.WaddleRequest{Operation: &pb.WaddleRequest_ContainsKey{
+		ContainsKey: &pb.ContainsKeyRequest{Collection: collection, Key: key},
+	}})
+	if err != nil {
+		return 0, err
+	}
+	if resp.GetLength() == 0 {
+		return 0, nil
+	}
+
+	resp, err = c.send(&pb.WaddleRequest{Operation: &pb.WaddleRequest_GetKeyLen{
+		GetKeyLen: &pb.GetKeyLengthRequest{Collection: collection, Key: key},
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return uint32(resp.GetLength()), nil
+}
+
+// NormalizeAndAppendBatch normalizes the vectors to unit length in place and appends
+// them to key as a single batch. keywords may be nil or hold one entry per vector.
+// It returns the block index assigned to each vector, assuming no other client
+// appends to the same key concurrently.
+func (c *Client) NormalizeAndAppendBatch(collection, key string, vectors [][]float32, keywords [][]string) ([]uint32, error) {
+	if len(keywords) != 0 && len(keywords) != len(vectors) {
+		return nil, errors.New("keywords must be empty or match the number of vectors")
+	}
+	if len(vectors) == 0 {
+		return nil, nil
+	}
+
+	storage.NormalizeBatchParallel(vectors, 0)
+
+	batch := &pb.BatchAppendBlockRequest{
+		Collection: collection,
+		Requests:   make([]*pb.AppendBlockRequest, len(vectors)),
+	}
+	for i, vec := range vectors {
+		block := &pb.BlockData{Vector: vec}
+		if len(keywords) != 0 {
+			block.Keywords = keywords[i]
+		}
+		batch.Requests[i] = &pb.AppendBlockRequest{Collection: collection, Key: key, Block: block}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start, err := c.keyLength(collection, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.send(&pb.WaddleRequest{Operation: &pb.WaddleRequest_BatchAppend{BatchAppend: batch}}); err != nil {
+		return nil, err
+	}
+
+	indices := make([]uint32, len(vectors))
+	for i := range indices {
+		indices[i] = start + uint32(i)
+	}
+	return indices, nil
+}
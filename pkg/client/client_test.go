@@ -0,0 +1,193 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"waddlemap/internal/network"
+	"waddlemap/internal/storage"
+	"waddlemap/internal/transaction"
+	"waddlemap/internal/types"
+	pb "waddlemap/proto"
+)
+
+func startTestServer(t *testing.T) string {
+	t.Helper()
+	vm, err := storage.NewVectorManager(&types.DBSchemaConfig{DataPath: t.TempDir(), SyncMode: "normal"})
+	if err != nil {
+		t.Fatalf("Failed to create vector manager: %v", err)
+	}
+	t.Cleanup(func() { vm.Close() })
+
+	txMgr := transaction.NewManager(vm)
+	txMgr.Start()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go network.NewServer(0, txMgr).Serve(listener)
+	return listener.Addr().String()
+}
+
+func TestClient_NormalizeAndAppendBatch(t *testing.T) {
+	c, err := Dial(startTestServer(t))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.CreateCollection("docs", 4, "cosine"); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+
+	vectors := [][]float32{{3, 4, 0, 0}, {1, 1, 1, 1}, {0, 0, 0, 2}}
+	keywords := [][]string{{"a"}, {"b"}, {"c"}}
+	for round := 0; round < 2; round++ {
+		batch := make([][]float32, len(vectors))
+		for i := range vectors {
+			batch[i] = append([]float32(nil), vectors[i]...)
+		}
+		indices, err := c.NormalizeAndAppendBatch("docs", "doc1", batch, keywords)
+		if err != nil {
+			t.Fatalf("NormalizeAndAppendBatch failed: %v", err)
+		}
+		for i, idx := range indices {
+			if want := uint32(round*len(vectors) + i); idx != want {
+				t.Fatalf("Round %d: expected index %d, got %d", round, want, idx)
+			}
+		}
+	}
+
+	for idx := uint32(0); idx < uint32(2*len(vectors)); idx++ {
+		vec, err := c.GetVector("docs", "doc1", idx)
+		if err != nil {
+			t.Fatalf("GetVector(%d) failed: %v", idx, err)
+		}
+		var sum float64
+		for _, x := range vec {
+			sum += float64(x) * float64(x)
+		}
+		if math.Abs(math.Sqrt(sum)-1) > 1e-5 {
+			t.Errorf("Vector %d has norm %f, want 1", idx, math.Sqrt(sum))
+		}
+	}
+}
+
+func TestClient_SubscribeWhileQuerying(t *testing.T) {
+	addr := startTestServer(t)
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+	writer, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer writer.Close()
+
+	if err := c.CreateCollection("docs", 4, "l2"); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	appends, err := c.Subscribe("appends", "docs", network.EventAppend)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	all, err := c.Subscribe("all", "")
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if _, err := c.Subscribe("all", ""); err == nil {
+		t.Error("Expected duplicate subscription ID to fail")
+	}
+
+	// Interleave queries on the subscribed connection with writes from both connections.
+	for i := 0; i < 5; i++ {
+		if _, err := writer.NormalizeAndAppendBatch("docs", fmt.Sprintf("w%d", i), [][]float32{{1, 0, 0, 0}}, nil); err != nil {
+			t.Fatalf("Writer append failed: %v", err)
+		}
+		if _, err := c.NormalizeAndAppendBatch("docs", fmt.Sprintf("c%d", i), [][]float32{{0, 1, 0, 0}}, nil); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+		if _, err := c.GetVector("docs", fmt.Sprintf("w%d", i), 0); err != nil {
+			t.Fatalf("GetVector failed: %v", err)
+		}
+	}
+
+	expectEvents := func(name string, ch <-chan *pb.Event, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			select {
+			case ev := <-ch:
+				if ev.SubscriptionId != name || ev.EventType != network.EventAppend || ev.Collection != "docs" {
+					t.Errorf("Unexpected event on %s: %v", name, ev)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Subscription %s received %d of %d events", name, i, n)
+			}
+		}
+	}
+	expectEvents("appends", appends, 10)
+	expectEvents("all", all, 10)
+
+	c.Close()
+	if _, ok := <-appends; ok {
+		t.Error("Expected subscription channel to be closed with the connection")
+	}
+}
+
+func TestClient_BatchSearch(t *testing.T) {
+	c, err := Dial(startTestServer(t))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+
+	for _, name := range []string{"a", "b"} {
+		if err := c.CreateCollection(name, 2, "l2"); err != nil {
+			t.Fatalf("CreateCollection failed: %v", err)
+		}
+	}
+	if _, err := c.NormalizeAndAppendBatch("a", "x", [][]float32{{1, 0}, {0, 1}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.NormalizeAndAppendBatch("b", "y", [][]float32{{0, 1}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := c.BatchSearch([]*pb.SearchRequest{
+		{Collection: "a", Query: []float32{0, 1}, TopK: 1},
+		{Collection: "b", Query: []float32{1, 0}, TopK: 5},
+		{Collection: "a", Query: []float32{1, 0}, TopK: 2},
+	})
+	if err != nil {
+		t.Fatalf("BatchSearch failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 result lists, got %d", len(results))
+	}
+	first, second, third := results[0].Results, results[1].Results, results[2].Results
+	if len(first) != 1 || first[0].Key != "x" || first[0].Index != 1 {
+		t.Errorf("Query 0: expected x[1], got %v", first)
+	}
+	if len(second) != 1 || second[0].Key != "y" {
+		t.Errorf("Query 1: expected y[0], got %v", second)
+	}
+	if len(third) != 2 || third[0].Index != 0 || third[0].Block == nil {
+		t.Errorf("Query 2: expected x[0] first with its block, got %v", third)
+	}
+
+	_, err = c.BatchSearch([]*pb.SearchRequest{
+		{Collection: "a", Query: []float32{0, 1}, TopK: 1},
+		{Collection: "missing", Query: []float32{0, 1}, TopK: 1},
+	})
+	if err == nil || !strings.Contains(err.Error(), "query 1") {
+		t.Errorf("Expected the failing query to be reported, got %v", err)
+	}
+}
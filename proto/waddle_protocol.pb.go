@@ -21,9 +21,81 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// ErrorCode classifies failures that clients may want to handle without
+// parsing error_message.
+type ErrorCode int32
+
+const (
+	ErrorCode_ERROR_CODE_UNSPECIFIED ErrorCode = 0
+	ErrorCode_UNAUTHORIZED           ErrorCode = 1 // Missing or unknown tenant_token
+	ErrorCode_NOT_FOUND              ErrorCode = 2 // Unknown collection, key or block
+	ErrorCode_INVALID_ARGUMENT       ErrorCode = 3 // Dimension or metric mismatch, invalid collection config
+	ErrorCode_ALREADY_EXISTS         ErrorCode = 4 // Duplicate vector ID
+	ErrorCode_RESOURCE_EXHAUSTED     ErrorCode = 5 // Storage full
+	ErrorCode_DATA_CORRUPTED         ErrorCode = 6 // Checksum mismatch or corrupted index file
+	ErrorCode_VERSION_CONFLICT       ErrorCode = 7 // Conditional update of a block at another version
+)
+
+// Enum value maps for ErrorCode.
+var (
+	ErrorCode_name = map[int32]string{
+		0: "ERROR_CODE_UNSPECIFIED",
+		1: "UNAUTHORIZED",
+		2: "NOT_FOUND",
+		3: "INVALID_ARGUMENT",
+		4: "ALREADY_EXISTS",
+		5: "RESOURCE_EXHAUSTED",
+		6: "DATA_CORRUPTED",
+		7: "VERSION_CONFLICT",
+	}
+	ErrorCode_value = map[string]int32{
+		"ERROR_CODE_UNSPECIFIED": 0,
+		"UNAUTHORIZED":           1,
+		"NOT_FOUND":              2,
+		"INVALID_ARGUMENT":       3,
+		"ALREADY_EXISTS":         4,
+		"RESOURCE_EXHAUSTED":     5,
+		"DATA_CORRUPTED":         6,
+		"VERSION_CONFLICT":       7,
+	}
+)
+
+func (x ErrorCode) Enum() *ErrorCode {
+	p := new(ErrorCode)
+	*p = x
+	return p
+}
+
+func (x ErrorCode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ErrorCode) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_waddle_protocol_proto_enumTypes[0].Descriptor()
+}
+
+func (ErrorCode) Type() protoreflect.EnumType {
+	return &file_proto_waddle_protocol_proto_enumTypes[0]
+}
+
+func (x ErrorCode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ErrorCode.Descriptor instead.
+func (ErrorCode) EnumDescriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{0}
+}
+
 type WaddleRequest struct {
 	state     protoimpl.MessageState `protogen:"open.v1"`
 	RequestId string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	// Buffers a write in the transaction returned by begin_tx instead of
+	// applying it. Only writes may be tagged.
+	TransactionId string `protobuf:"bytes,2,opt,name=transaction_id,json=transactionId,proto3" json:"transaction_id,omitempty"`
+	// Identifies the tenant on servers started with tenant tokens, which
+	// scope every collection name to that tenant.
+	TenantToken string `protobuf:"bytes,39,opt,name=tenant_token,json=tenantToken,proto3" json:"tenant_token,omitempty"`
 	// Types that are valid to be assigned to Operation:
 	//
 	//	*WaddleRequest_CreateCol
@@ -46,6 +118,13 @@ type WaddleRequest struct {
 	//	*WaddleRequest_KeywordSearch
 	//	*WaddleRequest_SnapshotCol
 	//	*WaddleRequest_BatchAppend
+	//	*WaddleRequest_SearchVariant
+	//	*WaddleRequest_Subscribe
+	//	*WaddleRequest_BatchSearch
+	//	*WaddleRequest_BeginTx
+	//	*WaddleRequest_CommitTx
+	//	*WaddleRequest_RollbackTx
+	//	*WaddleRequest_UpdateConditional
 	Operation     isWaddleRequest_Operation `protobuf_oneof:"operation"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -88,6 +167,20 @@ func (x *WaddleRequest) GetRequestId() string {
 	return ""
 }
 
+func (x *WaddleRequest) GetTransactionId() string {
+	if x != nil {
+		return x.TransactionId
+	}
+	return ""
+}
+
+func (x *WaddleRequest) GetTenantToken() string {
+	if x != nil {
+		return x.TenantToken
+	}
+	return ""
+}
+
 func (x *WaddleRequest) GetOperation() isWaddleRequest_Operation {
 	if x != nil {
 		return x.Operation
@@ -275,6 +368,69 @@ func (x *WaddleRequest) GetBatchAppend() *BatchAppendBlockRequest {
 	return nil
 }
 
+func (x *WaddleRequest) GetSearchVariant() *SearchVariantRequest {
+	if x != nil {
+		if x, ok := x.Operation.(*WaddleRequest_SearchVariant); ok {
+			return x.SearchVariant
+		}
+	}
+	return nil
+}
+
+func (x *WaddleRequest) GetSubscribe() *SubscribeRequest {
+	if x != nil {
+		if x, ok := x.Operation.(*WaddleRequest_Subscribe); ok {
+			return x.Subscribe
+		}
+	}
+	return nil
+}
+
+func (x *WaddleRequest) GetBatchSearch() *BatchSearchRequest {
+	if x != nil {
+		if x, ok := x.Operation.(*WaddleRequest_BatchSearch); ok {
+			return x.BatchSearch
+		}
+	}
+	return nil
+}
+
+func (x *WaddleRequest) GetBeginTx() *BeginTransactionRequest {
+	if x != nil {
+		if x, ok := x.Operation.(*WaddleRequest_BeginTx); ok {
+			return x.BeginTx
+		}
+	}
+	return nil
+}
+
+func (x *WaddleRequest) GetCommitTx() *CommitTransactionRequest {
+	if x != nil {
+		if x, ok := x.Operation.(*WaddleRequest_CommitTx); ok {
+			return x.CommitTx
+		}
+	}
+	return nil
+}
+
+func (x *WaddleRequest) GetRollbackTx() *RollbackTransactionRequest {
+	if x != nil {
+		if x, ok := x.Operation.(*WaddleRequest_RollbackTx); ok {
+			return x.RollbackTx
+		}
+	}
+	return nil
+}
+
+func (x *WaddleRequest) GetUpdateConditional() *UpdateValueConditional {
+	if x != nil {
+		if x, ok := x.Operation.(*WaddleRequest_UpdateConditional); ok {
+			return x.UpdateConditional
+		}
+	}
+	return nil
+}
+
 type isWaddleRequest_Operation interface {
 	isWaddleRequest_Operation()
 }
@@ -357,7 +513,35 @@ type WaddleRequest_SnapshotCol struct {
 }
 
 type WaddleRequest_BatchAppend struct {
-	BatchAppend *BatchAppendBlockRequest `protobuf:"bytes,32,opt,name=batch_append,json=batchAppend,proto3,oneof"` // ... other block ops ...
+	BatchAppend *BatchAppendBlockRequest `protobuf:"bytes,32,opt,name=batch_append,json=batchAppend,proto3,oneof"`
+}
+
+type WaddleRequest_SearchVariant struct {
+	SearchVariant *SearchVariantRequest `protobuf:"bytes,33,opt,name=search_variant,json=searchVariant,proto3,oneof"`
+}
+
+type WaddleRequest_Subscribe struct {
+	Subscribe *SubscribeRequest `protobuf:"bytes,34,opt,name=subscribe,proto3,oneof"`
+}
+
+type WaddleRequest_BatchSearch struct {
+	BatchSearch *BatchSearchRequest `protobuf:"bytes,35,opt,name=batch_search,json=batchSearch,proto3,oneof"`
+}
+
+type WaddleRequest_BeginTx struct {
+	BeginTx *BeginTransactionRequest `protobuf:"bytes,36,opt,name=begin_tx,json=beginTx,proto3,oneof"`
+}
+
+type WaddleRequest_CommitTx struct {
+	CommitTx *CommitTransactionRequest `protobuf:"bytes,37,opt,name=commit_tx,json=commitTx,proto3,oneof"`
+}
+
+type WaddleRequest_RollbackTx struct {
+	RollbackTx *RollbackTransactionRequest `protobuf:"bytes,38,opt,name=rollback_tx,json=rollbackTx,proto3,oneof"`
+}
+
+type WaddleRequest_UpdateConditional struct {
+	UpdateConditional *UpdateValueConditional `protobuf:"bytes,40,opt,name=update_conditional,json=updateConditional,proto3,oneof"` // ... other block ops ...
 }
 
 func (*WaddleRequest_CreateCol) isWaddleRequest_Operation() {}
@@ -400,11 +584,26 @@ func (*WaddleRequest_SnapshotCol) isWaddleRequest_Operation() {}
 
 func (*WaddleRequest_BatchAppend) isWaddleRequest_Operation() {}
 
+func (*WaddleRequest_SearchVariant) isWaddleRequest_Operation() {}
+
+func (*WaddleRequest_Subscribe) isWaddleRequest_Operation() {}
+
+func (*WaddleRequest_BatchSearch) isWaddleRequest_Operation() {}
+
+func (*WaddleRequest_BeginTx) isWaddleRequest_Operation() {}
+
+func (*WaddleRequest_CommitTx) isWaddleRequest_Operation() {}
+
+func (*WaddleRequest_RollbackTx) isWaddleRequest_Operation() {}
+
+func (*WaddleRequest_UpdateConditional) isWaddleRequest_Operation() {}
+
 type WaddleResponse struct {
 	state        protoimpl.MessageState `protogen:"open.v1"`
 	RequestId    string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
 	Success      bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
 	ErrorMessage string                 `protobuf:"bytes,3,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	ErrorCode    ErrorCode              `protobuf:"varint,16,opt,name=error_code,json=errorCode,proto3,enum=waddlemap.ErrorCode" json:"error_code,omitempty"`
 	// Types that are valid to be assigned to Result:
 	//
 	//	*WaddleResponse_Length
@@ -413,6 +612,9 @@ type WaddleResponse struct {
 	//	*WaddleResponse_SearchList
 	//	*WaddleResponse_Block
 	//	*WaddleResponse_BlockList
+	//	*WaddleResponse_Event
+	//	*WaddleResponse_BatchSearch
+	//	*WaddleResponse_Transaction
 	Result        isWaddleResponse_Result `protobuf_oneof:"result"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -469,6 +671,13 @@ func (x *WaddleResponse) GetErrorMessage() string {
 	return ""
 }
 
+func (x *WaddleResponse) GetErrorCode() ErrorCode {
+	if x != nil {
+		return x.ErrorCode
+	}
+	return ErrorCode_ERROR_CODE_UNSPECIFIED
+}
+
 func (x *WaddleResponse) GetResult() isWaddleResponse_Result {
 	if x != nil {
 		return x.Result
@@ -530,6 +739,33 @@ func (x *WaddleResponse) GetBlockList() *BlockList {
 	return nil
 }
 
+func (x *WaddleResponse) GetEvent() *Event {
+	if x != nil {
+		if x, ok := x.Result.(*WaddleResponse_Event); ok {
+			return x.Event
+		}
+	}
+	return nil
+}
+
+func (x *WaddleResponse) GetBatchSearch() *BatchSearchResponse {
+	if x != nil {
+		if x, ok := x.Result.(*WaddleResponse_BatchSearch); ok {
+			return x.BatchSearch
+		}
+	}
+	return nil
+}
+
+func (x *WaddleResponse) GetTransaction() *BeginTransactionResponse {
+	if x != nil {
+		if x, ok := x.Result.(*WaddleResponse_Transaction); ok {
+			return x.Transaction
+		}
+	}
+	return nil
+}
+
 type isWaddleResponse_Result interface {
 	isWaddleResponse_Result()
 }
@@ -559,6 +795,19 @@ type WaddleResponse_BlockList struct {
 	BlockList *BlockList `protobuf:"bytes,12,opt,name=block_list,json=blockList,proto3,oneof"`
 }
 
+type WaddleResponse_Event struct {
+	// Subscription event; request_id is empty and event.subscription_id routes it
+	Event *Event `protobuf:"bytes,13,opt,name=event,proto3,oneof"`
+}
+
+type WaddleResponse_BatchSearch struct {
+	BatchSearch *BatchSearchResponse `protobuf:"bytes,14,opt,name=batch_search,json=batchSearch,proto3,oneof"`
+}
+
+type WaddleResponse_Transaction struct {
+	Transaction *BeginTransactionResponse `protobuf:"bytes,15,opt,name=transaction,proto3,oneof"`
+}
+
 func (*WaddleResponse_Length) isWaddleResponse_Result() {}
 
 func (*WaddleResponse_KeyList) isWaddleResponse_Result() {}
@@ -571,6 +820,12 @@ func (*WaddleResponse_Block) isWaddleResponse_Result() {}
 
 func (*WaddleResponse_BlockList) isWaddleResponse_Result() {}
 
+func (*WaddleResponse_Event) isWaddleResponse_Result() {}
+
+func (*WaddleResponse_BatchSearch) isWaddleResponse_Result() {}
+
+func (*WaddleResponse_Transaction) isWaddleResponse_Result() {}
+
 type KeyList struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Keys          []string               `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
@@ -617,12 +872,18 @@ func (x *KeyList) GetKeys() []string {
 
 // Collection Ops
 type CreateCollectionRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Dimensions    uint32                 `protobuf:"varint,2,opt,name=dimensions,proto3" json:"dimensions,omitempty"`
-	Metric        string                 `protobuf:"bytes,3,opt,name=metric,proto3" json:"metric,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Name             string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Dimensions       uint32                 `protobuf:"varint,2,opt,name=dimensions,proto3" json:"dimensions,omitempty"`
+	Metric           string                 `protobuf:"bytes,3,opt,name=metric,proto3" json:"metric,omitempty"`
+	SecondaryHnsw    *HNSWOptions           `protobuf:"bytes,4,opt,name=secondary_hnsw,json=secondaryHnsw,proto3" json:"secondary_hnsw,omitempty"`          // Optional second graph for A/B comparison
+	Hnsw             *HNSWOptions           `protobuf:"bytes,5,opt,name=hnsw,proto3" json:"hnsw,omitempty"`                                                 // Primary graph parameters; unset fields use the defaults
+	IndexType        string                 `protobuf:"bytes,6,opt,name=index_type,json=indexType,proto3" json:"index_type,omitempty"`                      // "hnsw" (default) or "flat" for exact search
+	IndexCompression string                 `protobuf:"bytes,7,opt,name=index_compression,json=indexCompression,proto3" json:"index_compression,omitempty"` // "none" (default) or "pq" (implies flat)
+	PqSubspaces      uint32                 `protobuf:"varint,8,opt,name=pq_subspaces,json=pqSubspaces,proto3" json:"pq_subspaces,omitempty"`               // PQ bytes per vector; 0 picks a default
+	AutoNormalize    bool                   `protobuf:"varint,9,opt,name=auto_normalize,json=autoNormalize,proto3" json:"auto_normalize,omitempty"`         // Normalize vectors and queries to unit length; cosine only
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
 }
 
 func (x *CreateCollectionRequest) Reset() {
@@ -676,6 +937,116 @@ func (x *CreateCollectionRequest) GetMetric() string {
 	return ""
 }
 
+func (x *CreateCollectionRequest) GetSecondaryHnsw() *HNSWOptions {
+	if x != nil {
+		return x.SecondaryHnsw
+	}
+	return nil
+}
+
+func (x *CreateCollectionRequest) GetHnsw() *HNSWOptions {
+	if x != nil {
+		return x.Hnsw
+	}
+	return nil
+}
+
+func (x *CreateCollectionRequest) GetIndexType() string {
+	if x != nil {
+		return x.IndexType
+	}
+	return ""
+}
+
+func (x *CreateCollectionRequest) GetIndexCompression() string {
+	if x != nil {
+		return x.IndexCompression
+	}
+	return ""
+}
+
+func (x *CreateCollectionRequest) GetPqSubspaces() uint32 {
+	if x != nil {
+		return x.PqSubspaces
+	}
+	return 0
+}
+
+func (x *CreateCollectionRequest) GetAutoNormalize() bool {
+	if x != nil {
+		return x.AutoNormalize
+	}
+	return false
+}
+
+type HNSWOptions struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	M              uint32                 `protobuf:"varint,1,opt,name=m,proto3" json:"m,omitempty"`
+	EfConstruction uint32                 `protobuf:"varint,2,opt,name=ef_construction,json=efConstruction,proto3" json:"ef_construction,omitempty"`
+	EfSearch       uint32                 `protobuf:"varint,3,opt,name=ef_search,json=efSearch,proto3" json:"ef_search,omitempty"`
+	Ml             float64                `protobuf:"fixed64,4,opt,name=ml,proto3" json:"ml,omitempty"` // Level normalization factor (0 = 1/ln(M))
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *HNSWOptions) Reset() {
+	*x = HNSWOptions{}
+	mi := &file_proto_waddle_protocol_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HNSWOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HNSWOptions) ProtoMessage() {}
+
+func (x *HNSWOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddle_protocol_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HNSWOptions.ProtoReflect.Descriptor instead.
+func (*HNSWOptions) Descriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *HNSWOptions) GetM() uint32 {
+	if x != nil {
+		return x.M
+	}
+	return 0
+}
+
+func (x *HNSWOptions) GetEfConstruction() uint32 {
+	if x != nil {
+		return x.EfConstruction
+	}
+	return 0
+}
+
+func (x *HNSWOptions) GetEfSearch() uint32 {
+	if x != nil {
+		return x.EfSearch
+	}
+	return 0
+}
+
+func (x *HNSWOptions) GetMl() float64 {
+	if x != nil {
+		return x.Ml
+	}
+	return 0
+}
+
 type DeleteCollectionRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
@@ -685,7 +1056,7 @@ type DeleteCollectionRequest struct {
 
 func (x *DeleteCollectionRequest) Reset() {
 	*x = DeleteCollectionRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[4]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -697,7 +1068,7 @@ func (x *DeleteCollectionRequest) String() string {
 func (*DeleteCollectionRequest) ProtoMessage() {}
 
 func (x *DeleteCollectionRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[4]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -710,7 +1081,7 @@ func (x *DeleteCollectionRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DeleteCollectionRequest.ProtoReflect.Descriptor instead.
 func (*DeleteCollectionRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{4}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *DeleteCollectionRequest) GetName() string {
@@ -728,7 +1099,7 @@ type ListCollectionsRequest struct {
 
 func (x *ListCollectionsRequest) Reset() {
 	*x = ListCollectionsRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[5]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -740,7 +1111,7 @@ func (x *ListCollectionsRequest) String() string {
 func (*ListCollectionsRequest) ProtoMessage() {}
 
 func (x *ListCollectionsRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[5]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -753,7 +1124,7 @@ func (x *ListCollectionsRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListCollectionsRequest.ProtoReflect.Descriptor instead.
 func (*ListCollectionsRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{5}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{6}
 }
 
 type CompactCollectionRequest struct {
@@ -765,7 +1136,7 @@ type CompactCollectionRequest struct {
 
 func (x *CompactCollectionRequest) Reset() {
 	*x = CompactCollectionRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[6]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -777,7 +1148,7 @@ func (x *CompactCollectionRequest) String() string {
 func (*CompactCollectionRequest) ProtoMessage() {}
 
 func (x *CompactCollectionRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[6]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -790,7 +1161,7 @@ func (x *CompactCollectionRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CompactCollectionRequest.ProtoReflect.Descriptor instead.
 func (*CompactCollectionRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{6}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *CompactCollectionRequest) GetName() string {
@@ -809,7 +1180,7 @@ type SnapshotCollectionRequest struct {
 
 func (x *SnapshotCollectionRequest) Reset() {
 	*x = SnapshotCollectionRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[7]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -821,7 +1192,7 @@ func (x *SnapshotCollectionRequest) String() string {
 func (*SnapshotCollectionRequest) ProtoMessage() {}
 
 func (x *SnapshotCollectionRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[7]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -834,7 +1205,7 @@ func (x *SnapshotCollectionRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SnapshotCollectionRequest.ProtoReflect.Descriptor instead.
 func (*SnapshotCollectionRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{7}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *SnapshotCollectionRequest) GetCollection() string {
@@ -855,7 +1226,7 @@ type Collection struct {
 
 func (x *Collection) Reset() {
 	*x = Collection{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[8]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -867,7 +1238,7 @@ func (x *Collection) String() string {
 func (*Collection) ProtoMessage() {}
 
 func (x *Collection) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[8]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -880,7 +1251,7 @@ func (x *Collection) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Collection.ProtoReflect.Descriptor instead.
 func (*Collection) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{8}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *Collection) GetName() string {
@@ -913,7 +1284,7 @@ type CollectionList struct {
 
 func (x *CollectionList) Reset() {
 	*x = CollectionList{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[9]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -925,7 +1296,7 @@ func (x *CollectionList) String() string {
 func (*CollectionList) ProtoMessage() {}
 
 func (x *CollectionList) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[9]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -938,7 +1309,7 @@ func (x *CollectionList) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CollectionList.ProtoReflect.Descriptor instead.
 func (*CollectionList) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{9}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *CollectionList) GetCollections() []*Collection {
@@ -957,7 +1328,7 @@ type BlockList struct {
 
 func (x *BlockList) Reset() {
 	*x = BlockList{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[10]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -969,7 +1340,7 @@ func (x *BlockList) String() string {
 func (*BlockList) ProtoMessage() {}
 
 func (x *BlockList) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[10]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -982,7 +1353,7 @@ func (x *BlockList) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use BlockList.ProtoReflect.Descriptor instead.
 func (*BlockList) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{10}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *BlockList) GetBlocks() []*BlockData {
@@ -995,16 +1366,18 @@ func (x *BlockList) GetBlocks() []*BlockData {
 // Block Data
 type BlockData struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Primary       string                 `protobuf:"bytes,1,opt,name=primary,proto3" json:"primary,omitempty"`        // Primary text/binary data
-	Vector        []float32              `protobuf:"fixed32,2,rep,packed,name=vector,proto3" json:"vector,omitempty"` // Secondary vector data
-	Keywords      []string               `protobuf:"bytes,3,rep,name=keywords,proto3" json:"keywords,omitempty"`      // Keywords
+	Primary       string                 `protobuf:"bytes,1,opt,name=primary,proto3" json:"primary,omitempty"`                          // Primary text/binary data
+	Vector        []float32              `protobuf:"fixed32,2,rep,packed,name=vector,proto3" json:"vector,omitempty"`                   // Secondary vector data
+	Keywords      []string               `protobuf:"bytes,3,rep,name=keywords,proto3" json:"keywords,omitempty"`                        // Keywords
+	TtlSeconds    int64                  `protobuf:"varint,4,opt,name=ttl_seconds,json=ttlSeconds,proto3" json:"ttl_seconds,omitempty"` // Seconds until the block expires (0 = never); remaining TTL on reads
+	Version       uint64                 `protobuf:"varint,5,opt,name=version,proto3" json:"version,omitempty"`                         // Number of updates of the block, on reads (0 = never updated)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *BlockData) Reset() {
 	*x = BlockData{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[11]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[12]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1016,7 +1389,7 @@ func (x *BlockData) String() string {
 func (*BlockData) ProtoMessage() {}
 
 func (x *BlockData) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[11]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[12]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1029,7 +1402,7 @@ func (x *BlockData) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use BlockData.ProtoReflect.Descriptor instead.
 func (*BlockData) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{11}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{12}
 }
 
 func (x *BlockData) GetPrimary() string {
@@ -1053,8 +1426,22 @@ func (x *BlockData) GetKeywords() []string {
 	return nil
 }
 
-// Block/Key Ops
-type AppendBlockRequest struct {
+func (x *BlockData) GetTtlSeconds() int64 {
+	if x != nil {
+		return x.TtlSeconds
+	}
+	return 0
+}
+
+func (x *BlockData) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+// Block/Key Ops
+type AppendBlockRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Collection    string                 `protobuf:"bytes,1,opt,name=collection,proto3" json:"collection,omitempty"`
 	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
@@ -1065,7 +1452,7 @@ type AppendBlockRequest struct {
 
 func (x *AppendBlockRequest) Reset() {
 	*x = AppendBlockRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[12]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1077,7 +1464,7 @@ func (x *AppendBlockRequest) String() string {
 func (*AppendBlockRequest) ProtoMessage() {}
 
 func (x *AppendBlockRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[12]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[13]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1090,7 +1477,7 @@ func (x *AppendBlockRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AppendBlockRequest.ProtoReflect.Descriptor instead.
 func (*AppendBlockRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{12}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{13}
 }
 
 func (x *AppendBlockRequest) GetCollection() string {
@@ -1124,7 +1511,7 @@ type BatchAppendBlockRequest struct {
 
 func (x *BatchAppendBlockRequest) Reset() {
 	*x = BatchAppendBlockRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[13]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1136,7 +1523,7 @@ func (x *BatchAppendBlockRequest) String() string {
 func (*BatchAppendBlockRequest) ProtoMessage() {}
 
 func (x *BatchAppendBlockRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[13]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1149,7 +1536,7 @@ func (x *BatchAppendBlockRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use BatchAppendBlockRequest.ProtoReflect.Descriptor instead.
 func (*BatchAppendBlockRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{13}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{14}
 }
 
 func (x *BatchAppendBlockRequest) GetCollection() string {
@@ -1177,7 +1564,7 @@ type GetBlockRequest struct {
 
 func (x *GetBlockRequest) Reset() {
 	*x = GetBlockRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[14]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[15]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1189,7 +1576,7 @@ func (x *GetBlockRequest) String() string {
 func (*GetBlockRequest) ProtoMessage() {}
 
 func (x *GetBlockRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[14]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[15]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1202,7 +1589,7 @@ func (x *GetBlockRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetBlockRequest.ProtoReflect.Descriptor instead.
 func (*GetBlockRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{14}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{15}
 }
 
 func (x *GetBlockRequest) GetCollection() string {
@@ -1237,7 +1624,7 @@ type GetVectorRequest struct {
 
 func (x *GetVectorRequest) Reset() {
 	*x = GetVectorRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[15]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[16]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1249,7 +1636,7 @@ func (x *GetVectorRequest) String() string {
 func (*GetVectorRequest) ProtoMessage() {}
 
 func (x *GetVectorRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[15]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[16]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1262,7 +1649,7 @@ func (x *GetVectorRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetVectorRequest.ProtoReflect.Descriptor instead.
 func (*GetVectorRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{15}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{16}
 }
 
 func (x *GetVectorRequest) GetCollection() string {
@@ -1296,7 +1683,7 @@ type GetKeyLengthRequest struct {
 
 func (x *GetKeyLengthRequest) Reset() {
 	*x = GetKeyLengthRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[16]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[17]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1308,7 +1695,7 @@ func (x *GetKeyLengthRequest) String() string {
 func (*GetKeyLengthRequest) ProtoMessage() {}
 
 func (x *GetKeyLengthRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[16]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[17]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1321,7 +1708,7 @@ func (x *GetKeyLengthRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetKeyLengthRequest.ProtoReflect.Descriptor instead.
 func (*GetKeyLengthRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{16}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{17}
 }
 
 func (x *GetKeyLengthRequest) GetCollection() string {
@@ -1348,7 +1735,7 @@ type GetKeyRequest struct {
 
 func (x *GetKeyRequest) Reset() {
 	*x = GetKeyRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[17]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[18]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1360,7 +1747,7 @@ func (x *GetKeyRequest) String() string {
 func (*GetKeyRequest) ProtoMessage() {}
 
 func (x *GetKeyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[17]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[18]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1373,7 +1760,7 @@ func (x *GetKeyRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetKeyRequest.ProtoReflect.Descriptor instead.
 func (*GetKeyRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{17}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{18}
 }
 
 func (x *GetKeyRequest) GetCollection() string {
@@ -1400,7 +1787,7 @@ type DeleteKeyRequest struct {
 
 func (x *DeleteKeyRequest) Reset() {
 	*x = DeleteKeyRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[18]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[19]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1412,7 +1799,7 @@ func (x *DeleteKeyRequest) String() string {
 func (*DeleteKeyRequest) ProtoMessage() {}
 
 func (x *DeleteKeyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[18]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[19]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1425,7 +1812,7 @@ func (x *DeleteKeyRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DeleteKeyRequest.ProtoReflect.Descriptor instead.
 func (*DeleteKeyRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{18}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{19}
 }
 
 func (x *DeleteKeyRequest) GetCollection() string {
@@ -1451,7 +1838,7 @@ type ListKeysRequest struct {
 
 func (x *ListKeysRequest) Reset() {
 	*x = ListKeysRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[19]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[20]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1463,7 +1850,7 @@ func (x *ListKeysRequest) String() string {
 func (*ListKeysRequest) ProtoMessage() {}
 
 func (x *ListKeysRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[19]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[20]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1476,7 +1863,7 @@ func (x *ListKeysRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListKeysRequest.ProtoReflect.Descriptor instead.
 func (*ListKeysRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{19}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{20}
 }
 
 func (x *ListKeysRequest) GetCollection() string {
@@ -1496,7 +1883,7 @@ type ContainsKeyRequest struct {
 
 func (x *ContainsKeyRequest) Reset() {
 	*x = ContainsKeyRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[20]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[21]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1508,7 +1895,7 @@ func (x *ContainsKeyRequest) String() string {
 func (*ContainsKeyRequest) ProtoMessage() {}
 
 func (x *ContainsKeyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[20]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[21]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1521,7 +1908,7 @@ func (x *ContainsKeyRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ContainsKeyRequest.ProtoReflect.Descriptor instead.
 func (*ContainsKeyRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{20}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{21}
 }
 
 func (x *ContainsKeyRequest) GetCollection() string {
@@ -1550,7 +1937,7 @@ type UpdateBlockRequest struct {
 
 func (x *UpdateBlockRequest) Reset() {
 	*x = UpdateBlockRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[21]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[22]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1562,7 +1949,7 @@ func (x *UpdateBlockRequest) String() string {
 func (*UpdateBlockRequest) ProtoMessage() {}
 
 func (x *UpdateBlockRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[21]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[22]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1575,7 +1962,7 @@ func (x *UpdateBlockRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateBlockRequest.ProtoReflect.Descriptor instead.
 func (*UpdateBlockRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{21}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{22}
 }
 
 func (x *UpdateBlockRequest) GetCollection() string {
@@ -1618,7 +2005,7 @@ type ReplaceBlockRequest struct {
 
 func (x *ReplaceBlockRequest) Reset() {
 	*x = ReplaceBlockRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[22]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[23]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1630,7 +2017,7 @@ func (x *ReplaceBlockRequest) String() string {
 func (*ReplaceBlockRequest) ProtoMessage() {}
 
 func (x *ReplaceBlockRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[22]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[23]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1643,7 +2030,7 @@ func (x *ReplaceBlockRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ReplaceBlockRequest.ProtoReflect.Descriptor instead.
 func (*ReplaceBlockRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{22}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{23}
 }
 
 func (x *ReplaceBlockRequest) GetCollection() string {
@@ -1674,6 +2061,84 @@ func (x *ReplaceBlockRequest) GetBlock() *BlockData {
 	return nil
 }
 
+// Updates a block only if its version, as returned by get_block, is still
+// expected_version; fails with VERSION_CONFLICT otherwise.
+type UpdateValueConditional struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Collection      string                 `protobuf:"bytes,1,opt,name=collection,proto3" json:"collection,omitempty"`
+	Key             string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Index           uint32                 `protobuf:"varint,3,opt,name=index,proto3" json:"index,omitempty"`
+	ExpectedVersion uint64                 `protobuf:"varint,4,opt,name=expected_version,json=expectedVersion,proto3" json:"expected_version,omitempty"`
+	Block           *BlockData             `protobuf:"bytes,5,opt,name=block,proto3" json:"block,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *UpdateValueConditional) Reset() {
+	*x = UpdateValueConditional{}
+	mi := &file_proto_waddle_protocol_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateValueConditional) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateValueConditional) ProtoMessage() {}
+
+func (x *UpdateValueConditional) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddle_protocol_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateValueConditional.ProtoReflect.Descriptor instead.
+func (*UpdateValueConditional) Descriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *UpdateValueConditional) GetCollection() string {
+	if x != nil {
+		return x.Collection
+	}
+	return ""
+}
+
+func (x *UpdateValueConditional) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *UpdateValueConditional) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *UpdateValueConditional) GetExpectedVersion() uint64 {
+	if x != nil {
+		return x.ExpectedVersion
+	}
+	return 0
+}
+
+func (x *UpdateValueConditional) GetBlock() *BlockData {
+	if x != nil {
+		return x.Block
+	}
+	return nil
+}
+
 // Search Ops
 type SearchRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -1682,13 +2147,14 @@ type SearchRequest struct {
 	TopK          uint32                 `protobuf:"varint,3,opt,name=top_k,json=topK,proto3" json:"top_k,omitempty"`
 	Mode          string                 `protobuf:"bytes,4,opt,name=mode,proto3" json:"mode,omitempty"` // "global" or specific keyword mode? Spec says "mode" (match_mode for keywords, or maybe search mode?)
 	Keywords      []string               `protobuf:"bytes,5,rep,name=keywords,proto3" json:"keywords,omitempty"`
+	MaxDistance   float32                `protobuf:"fixed32,6,opt,name=max_distance,json=maxDistance,proto3" json:"max_distance,omitempty"` // Drop results farther than this (0 = no limit)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *SearchRequest) Reset() {
 	*x = SearchRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[23]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[25]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1700,7 +2166,7 @@ func (x *SearchRequest) String() string {
 func (*SearchRequest) ProtoMessage() {}
 
 func (x *SearchRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[23]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[25]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1713,7 +2179,7 @@ func (x *SearchRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SearchRequest.ProtoReflect.Descriptor instead.
 func (*SearchRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{23}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{25}
 }
 
 func (x *SearchRequest) GetCollection() string {
@@ -1751,19 +2217,120 @@ func (x *SearchRequest) GetKeywords() []string {
 	return nil
 }
 
+func (x *SearchRequest) GetMaxDistance() float32 {
+	if x != nil {
+		return x.MaxDistance
+	}
+	return 0
+}
+
+// SearchVariantRequest searches a specific HNSW graph of the collection.
+type SearchVariantRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Collection    string                 `protobuf:"bytes,1,opt,name=collection,proto3" json:"collection,omitempty"`
+	Query         []float32              `protobuf:"fixed32,2,rep,packed,name=query,proto3" json:"query,omitempty"`
+	TopK          uint32                 `protobuf:"varint,3,opt,name=top_k,json=topK,proto3" json:"top_k,omitempty"`
+	Mode          string                 `protobuf:"bytes,4,opt,name=mode,proto3" json:"mode,omitempty"`
+	Keywords      []string               `protobuf:"bytes,5,rep,name=keywords,proto3" json:"keywords,omitempty"`
+	Variant       string                 `protobuf:"bytes,6,opt,name=variant,proto3" json:"variant,omitempty"`                              // "primary" or "secondary"
+	MaxDistance   float32                `protobuf:"fixed32,7,opt,name=max_distance,json=maxDistance,proto3" json:"max_distance,omitempty"` // Drop results farther than this (0 = no limit)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchVariantRequest) Reset() {
+	*x = SearchVariantRequest{}
+	mi := &file_proto_waddle_protocol_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchVariantRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchVariantRequest) ProtoMessage() {}
+
+func (x *SearchVariantRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddle_protocol_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchVariantRequest.ProtoReflect.Descriptor instead.
+func (*SearchVariantRequest) Descriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *SearchVariantRequest) GetCollection() string {
+	if x != nil {
+		return x.Collection
+	}
+	return ""
+}
+
+func (x *SearchVariantRequest) GetQuery() []float32 {
+	if x != nil {
+		return x.Query
+	}
+	return nil
+}
+
+func (x *SearchVariantRequest) GetTopK() uint32 {
+	if x != nil {
+		return x.TopK
+	}
+	return 0
+}
+
+func (x *SearchVariantRequest) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *SearchVariantRequest) GetKeywords() []string {
+	if x != nil {
+		return x.Keywords
+	}
+	return nil
+}
+
+func (x *SearchVariantRequest) GetVariant() string {
+	if x != nil {
+		return x.Variant
+	}
+	return ""
+}
+
+func (x *SearchVariantRequest) GetMaxDistance() float32 {
+	if x != nil {
+		return x.MaxDistance
+	}
+	return 0
+}
+
 type SearchMoreLikeThisRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Collection    string                 `protobuf:"bytes,1,opt,name=collection,proto3" json:"collection,omitempty"`
 	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
 	Index         uint32                 `protobuf:"varint,3,opt,name=index,proto3" json:"index,omitempty"`
 	TopK          uint32                 `protobuf:"varint,4,opt,name=top_k,json=topK,proto3" json:"top_k,omitempty"`
+	ExcludeSelf   bool                   `protobuf:"varint,5,opt,name=exclude_self,json=excludeSelf,proto3" json:"exclude_self,omitempty"` // Leave the source block out of the results
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *SearchMoreLikeThisRequest) Reset() {
 	*x = SearchMoreLikeThisRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[24]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[27]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1775,7 +2342,7 @@ func (x *SearchMoreLikeThisRequest) String() string {
 func (*SearchMoreLikeThisRequest) ProtoMessage() {}
 
 func (x *SearchMoreLikeThisRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[24]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[27]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1788,7 +2355,7 @@ func (x *SearchMoreLikeThisRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SearchMoreLikeThisRequest.ProtoReflect.Descriptor instead.
 func (*SearchMoreLikeThisRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{24}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{27}
 }
 
 func (x *SearchMoreLikeThisRequest) GetCollection() string {
@@ -1819,6 +2386,13 @@ func (x *SearchMoreLikeThisRequest) GetTopK() uint32 {
 	return 0
 }
 
+func (x *SearchMoreLikeThisRequest) GetExcludeSelf() bool {
+	if x != nil {
+		return x.ExcludeSelf
+	}
+	return false
+}
+
 type SearchInKeyRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Collection    string                 `protobuf:"bytes,1,opt,name=collection,proto3" json:"collection,omitempty"`
@@ -1831,7 +2405,7 @@ type SearchInKeyRequest struct {
 
 func (x *SearchInKeyRequest) Reset() {
 	*x = SearchInKeyRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[25]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[28]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1843,7 +2417,7 @@ func (x *SearchInKeyRequest) String() string {
 func (*SearchInKeyRequest) ProtoMessage() {}
 
 func (x *SearchInKeyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[25]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[28]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1856,7 +2430,7 @@ func (x *SearchInKeyRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SearchInKeyRequest.ProtoReflect.Descriptor instead.
 func (*SearchInKeyRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{25}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{28}
 }
 
 func (x *SearchInKeyRequest) GetCollection() string {
@@ -1898,7 +2472,7 @@ type KeywordSearchRequest struct {
 
 func (x *KeywordSearchRequest) Reset() {
 	*x = KeywordSearchRequest{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[26]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[29]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1910,7 +2484,7 @@ func (x *KeywordSearchRequest) String() string {
 func (*KeywordSearchRequest) ProtoMessage() {}
 
 func (x *KeywordSearchRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[26]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[29]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1923,7 +2497,7 @@ func (x *KeywordSearchRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use KeywordSearchRequest.ProtoReflect.Descriptor instead.
 func (*KeywordSearchRequest) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{26}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{29}
 }
 
 func (x *KeywordSearchRequest) GetCollection() string {
@@ -1960,7 +2534,7 @@ type SearchResultItem struct {
 
 func (x *SearchResultItem) Reset() {
 	*x = SearchResultItem{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[27]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[30]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1972,7 +2546,7 @@ func (x *SearchResultItem) String() string {
 func (*SearchResultItem) ProtoMessage() {}
 
 func (x *SearchResultItem) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[27]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[30]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1985,7 +2559,7 @@ func (x *SearchResultItem) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SearchResultItem.ProtoReflect.Descriptor instead.
 func (*SearchResultItem) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{27}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{30}
 }
 
 func (x *SearchResultItem) GetKey() string {
@@ -2025,7 +2599,7 @@ type SearchResultList struct {
 
 func (x *SearchResultList) Reset() {
 	*x = SearchResultList{}
-	mi := &file_proto_waddle_protocol_proto_msgTypes[28]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[31]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -2037,7 +2611,7 @@ func (x *SearchResultList) String() string {
 func (*SearchResultList) ProtoMessage() {}
 
 func (x *SearchResultList) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_waddle_protocol_proto_msgTypes[28]
+	mi := &file_proto_waddle_protocol_proto_msgTypes[31]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -2050,7 +2624,7 @@ func (x *SearchResultList) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SearchResultList.ProtoReflect.Descriptor instead.
 func (*SearchResultList) Descriptor() ([]byte, []int) {
-	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{28}
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{31}
 }
 
 func (x *SearchResultList) GetResults() []*SearchResultItem {
@@ -2060,20 +2634,416 @@ func (x *SearchResultList) GetResults() []*SearchResultItem {
 	return nil
 }
 
-var File_proto_waddle_protocol_proto protoreflect.FileDescriptor
+// BatchSearchRequest runs several searches in one round trip. The request
+// fails as a whole if any query fails.
+type BatchSearchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Queries       []*SearchRequest       `protobuf:"bytes,1,rep,name=queries,proto3" json:"queries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-const file_proto_waddle_protocol_proto_rawDesc = "" +
-	"\n" +
-	"\x1bproto/waddle_protocol.proto\x12\twaddlemap\"\xe9\n" +
-	"\n" +
-	"\rWaddleRequest\x12\x1d\n" +
-	"\n" +
-	"request_id\x18\x01 \x01(\tR\trequestId\x12C\n" +
-	"\n" +
-	"create_col\x18\r \x01(\v2\".waddlemap.CreateCollectionRequestH\x00R\tcreateCol\x12C\n" +
-	"\n" +
-	"delete_col\x18\x0e \x01(\v2\".waddlemap.DeleteCollectionRequestH\x00R\tdeleteCol\x12@\n" +
-	"\tlist_cols\x18\x0f \x01(\v2!.waddlemap.ListCollectionsRequestH\x00R\blistCols\x12F\n" +
+func (x *BatchSearchRequest) Reset() {
+	*x = BatchSearchRequest{}
+	mi := &file_proto_waddle_protocol_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchSearchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSearchRequest) ProtoMessage() {}
+
+func (x *BatchSearchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddle_protocol_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSearchRequest.ProtoReflect.Descriptor instead.
+func (*BatchSearchRequest) Descriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *BatchSearchRequest) GetQueries() []*SearchRequest {
+	if x != nil {
+		return x.Queries
+	}
+	return nil
+}
+
+// BatchSearchResponse holds one result list per query, in request order.
+type BatchSearchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*SearchResultList    `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchSearchResponse) Reset() {
+	*x = BatchSearchResponse{}
+	mi := &file_proto_waddle_protocol_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchSearchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSearchResponse) ProtoMessage() {}
+
+func (x *BatchSearchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddle_protocol_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSearchResponse.ProtoReflect.Descriptor instead.
+func (*BatchSearchResponse) Descriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *BatchSearchResponse) GetResults() []*SearchResultList {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// BeginTransactionRequest opens a transaction. Writes sent with its
+// transaction_id are buffered until commit_tx applies them all at once, or
+// rollback_tx discards them. Open transactions are rolled back when the
+// connection closes.
+type BeginTransactionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BeginTransactionRequest) Reset() {
+	*x = BeginTransactionRequest{}
+	mi := &file_proto_waddle_protocol_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BeginTransactionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BeginTransactionRequest) ProtoMessage() {}
+
+func (x *BeginTransactionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddle_protocol_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BeginTransactionRequest.ProtoReflect.Descriptor instead.
+func (*BeginTransactionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{34}
+}
+
+type BeginTransactionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TransactionId string                 `protobuf:"bytes,1,opt,name=transaction_id,json=transactionId,proto3" json:"transaction_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BeginTransactionResponse) Reset() {
+	*x = BeginTransactionResponse{}
+	mi := &file_proto_waddle_protocol_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BeginTransactionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BeginTransactionResponse) ProtoMessage() {}
+
+func (x *BeginTransactionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddle_protocol_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BeginTransactionResponse.ProtoReflect.Descriptor instead.
+func (*BeginTransactionResponse) Descriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *BeginTransactionResponse) GetTransactionId() string {
+	if x != nil {
+		return x.TransactionId
+	}
+	return ""
+}
+
+// CommitTransactionRequest applies the buffered writes atomically. The
+// response length is the number of writes applied.
+type CommitTransactionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TransactionId string                 `protobuf:"bytes,1,opt,name=transaction_id,json=transactionId,proto3" json:"transaction_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitTransactionRequest) Reset() {
+	*x = CommitTransactionRequest{}
+	mi := &file_proto_waddle_protocol_proto_msgTypes[36]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitTransactionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitTransactionRequest) ProtoMessage() {}
+
+func (x *CommitTransactionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddle_protocol_proto_msgTypes[36]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitTransactionRequest.ProtoReflect.Descriptor instead.
+func (*CommitTransactionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{36}
+}
+
+func (x *CommitTransactionRequest) GetTransactionId() string {
+	if x != nil {
+		return x.TransactionId
+	}
+	return ""
+}
+
+type RollbackTransactionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TransactionId string                 `protobuf:"bytes,1,opt,name=transaction_id,json=transactionId,proto3" json:"transaction_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RollbackTransactionRequest) Reset() {
+	*x = RollbackTransactionRequest{}
+	mi := &file_proto_waddle_protocol_proto_msgTypes[37]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RollbackTransactionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RollbackTransactionRequest) ProtoMessage() {}
+
+func (x *RollbackTransactionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddle_protocol_proto_msgTypes[37]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RollbackTransactionRequest.ProtoReflect.Descriptor instead.
+func (*RollbackTransactionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{37}
+}
+
+func (x *RollbackTransactionRequest) GetTransactionId() string {
+	if x != nil {
+		return x.TransactionId
+	}
+	return ""
+}
+
+// SubscribeRequest registers a subscription on the current connection. Matching
+// Event frames are sent on the same connection alongside regular responses.
+type SubscribeRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SubscriptionId string                 `protobuf:"bytes,1,opt,name=subscription_id,json=subscriptionId,proto3" json:"subscription_id,omitempty"` // Chosen by the client, unique per connection
+	Collection     string                 `protobuf:"bytes,2,opt,name=collection,proto3" json:"collection,omitempty"`                               // Empty subscribes to all collections
+	EventTypes     []string               `protobuf:"bytes,3,rep,name=event_types,json=eventTypes,proto3" json:"event_types,omitempty"`             // "append", "update", "delete", "drop"; empty means all
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_proto_waddle_protocol_proto_msgTypes[38]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddle_protocol_proto_msgTypes[38]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{38}
+}
+
+func (x *SubscribeRequest) GetSubscriptionId() string {
+	if x != nil {
+		return x.SubscriptionId
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetCollection() string {
+	if x != nil {
+		return x.Collection
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetEventTypes() []string {
+	if x != nil {
+		return x.EventTypes
+	}
+	return nil
+}
+
+type Event struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SubscriptionId string                 `protobuf:"bytes,1,opt,name=subscription_id,json=subscriptionId,proto3" json:"subscription_id,omitempty"`
+	EventType      string                 `protobuf:"bytes,2,opt,name=event_type,json=eventType,proto3" json:"event_type,omitempty"`
+	Collection     string                 `protobuf:"bytes,3,opt,name=collection,proto3" json:"collection,omitempty"`
+	Key            string                 `protobuf:"bytes,4,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_proto_waddle_protocol_proto_msgTypes[39]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_waddle_protocol_proto_msgTypes[39]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_proto_waddle_protocol_proto_rawDescGZIP(), []int{39}
+}
+
+func (x *Event) GetSubscriptionId() string {
+	if x != nil {
+		return x.SubscriptionId
+	}
+	return ""
+}
+
+func (x *Event) GetEventType() string {
+	if x != nil {
+		return x.EventType
+	}
+	return ""
+}
+
+func (x *Event) GetCollection() string {
+	if x != nil {
+		return x.Collection
+	}
+	return ""
+}
+
+func (x *Event) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+var File_proto_waddle_protocol_proto protoreflect.FileDescriptor
+
+const file_proto_waddle_protocol_proto_rawDesc = "" +
+	"\n" +
+	"\x1bproto/waddle_protocol.proto\x12\twaddlemap\"\xa1\x0f\n" +
+	"\rWaddleRequest\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12%\n" +
+	"\x0etransaction_id\x18\x02 \x01(\tR\rtransactionId\x12!\n" +
+	"\ftenant_token\x18' \x01(\tR\vtenantToken\x12C\n" +
+	"\n" +
+	"create_col\x18\r \x01(\v2\".waddlemap.CreateCollectionRequestH\x00R\tcreateCol\x12C\n" +
+	"\n" +
+	"delete_col\x18\x0e \x01(\v2\".waddlemap.DeleteCollectionRequestH\x00R\tdeleteCol\x12@\n" +
+	"\tlist_cols\x18\x0f \x01(\v2!.waddlemap.ListCollectionsRequestH\x00R\blistCols\x12F\n" +
 	"\vcompact_col\x18\x10 \x01(\v2#.waddlemap.CompactCollectionRequestH\x00R\n" +
 	"compactCol\x12B\n" +
 	"\fappend_block\x18\x11 \x01(\v2\x1d.waddlemap.AppendBlockRequestH\x00R\vappendBlock\x129\n" +
@@ -2094,13 +3064,23 @@ const file_proto_waddle_protocol_proto_rawDesc = "" +
 	"\rsearch_in_key\x18\x1d \x01(\v2\x1d.waddlemap.SearchInKeyRequestH\x00R\vsearchInKey\x12H\n" +
 	"\x0ekeyword_search\x18\x1e \x01(\v2\x1f.waddlemap.KeywordSearchRequestH\x00R\rkeywordSearch\x12I\n" +
 	"\fsnapshot_col\x18\x1f \x01(\v2$.waddlemap.SnapshotCollectionRequestH\x00R\vsnapshotCol\x12G\n" +
-	"\fbatch_append\x18  \x01(\v2\".waddlemap.BatchAppendBlockRequestH\x00R\vbatchAppendB\v\n" +
-	"\toperation\"\xa0\x03\n" +
+	"\fbatch_append\x18  \x01(\v2\".waddlemap.BatchAppendBlockRequestH\x00R\vbatchAppend\x12H\n" +
+	"\x0esearch_variant\x18! \x01(\v2\x1f.waddlemap.SearchVariantRequestH\x00R\rsearchVariant\x12;\n" +
+	"\tsubscribe\x18\" \x01(\v2\x1b.waddlemap.SubscribeRequestH\x00R\tsubscribe\x12B\n" +
+	"\fbatch_search\x18# \x01(\v2\x1d.waddlemap.BatchSearchRequestH\x00R\vbatchSearch\x12?\n" +
+	"\bbegin_tx\x18$ \x01(\v2\".waddlemap.BeginTransactionRequestH\x00R\abeginTx\x12B\n" +
+	"\tcommit_tx\x18% \x01(\v2#.waddlemap.CommitTransactionRequestH\x00R\bcommitTx\x12H\n" +
+	"\vrollback_tx\x18& \x01(\v2%.waddlemap.RollbackTransactionRequestH\x00R\n" +
+	"rollbackTx\x12R\n" +
+	"\x12update_conditional\x18( \x01(\v2!.waddlemap.UpdateValueConditionalH\x00R\x11updateConditionalB\v\n" +
+	"\toperation\"\x8d\x05\n" +
 	"\x0eWaddleResponse\x12\x1d\n" +
 	"\n" +
 	"request_id\x18\x01 \x01(\tR\trequestId\x12\x18\n" +
 	"\asuccess\x18\x02 \x01(\bR\asuccess\x12#\n" +
-	"\rerror_message\x18\x03 \x01(\tR\ferrorMessage\x12\x18\n" +
+	"\rerror_message\x18\x03 \x01(\tR\ferrorMessage\x123\n" +
+	"\n" +
+	"error_code\x18\x10 \x01(\x0e2\x14.waddlemap.ErrorCodeR\terrorCode\x12\x18\n" +
 	"\x06length\x18\x05 \x01(\x04H\x00R\x06length\x12/\n" +
 	"\bkey_list\x18\a \x01(\v2\x12.waddlemap.KeyListH\x00R\akeyList\x126\n" +
 	"\bcol_list\x18\t \x01(\v2\x19.waddlemap.CollectionListH\x00R\acolList\x12>\n" +
@@ -2109,16 +3089,31 @@ const file_proto_waddle_protocol_proto_rawDesc = "" +
 	"searchList\x12,\n" +
 	"\x05block\x18\v \x01(\v2\x14.waddlemap.BlockDataH\x00R\x05block\x125\n" +
 	"\n" +
-	"block_list\x18\f \x01(\v2\x14.waddlemap.BlockListH\x00R\tblockListB\b\n" +
+	"block_list\x18\f \x01(\v2\x14.waddlemap.BlockListH\x00R\tblockList\x12(\n" +
+	"\x05event\x18\r \x01(\v2\x10.waddlemap.EventH\x00R\x05event\x12C\n" +
+	"\fbatch_search\x18\x0e \x01(\v2\x1e.waddlemap.BatchSearchResponseH\x00R\vbatchSearch\x12G\n" +
+	"\vtransaction\x18\x0f \x01(\v2#.waddlemap.BeginTransactionResponseH\x00R\vtransactionB\b\n" +
 	"\x06result\"\x1d\n" +
 	"\aKeyList\x12\x12\n" +
-	"\x04keys\x18\x01 \x03(\tR\x04keys\"e\n" +
+	"\x04keys\x18\x01 \x03(\tR\x04keys\"\xe6\x02\n" +
 	"\x17CreateCollectionRequest\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1e\n" +
 	"\n" +
 	"dimensions\x18\x02 \x01(\rR\n" +
 	"dimensions\x12\x16\n" +
-	"\x06metric\x18\x03 \x01(\tR\x06metric\"-\n" +
+	"\x06metric\x18\x03 \x01(\tR\x06metric\x12=\n" +
+	"\x0esecondary_hnsw\x18\x04 \x01(\v2\x16.waddlemap.HNSWOptionsR\rsecondaryHnsw\x12*\n" +
+	"\x04hnsw\x18\x05 \x01(\v2\x16.waddlemap.HNSWOptionsR\x04hnsw\x12\x1d\n" +
+	"\n" +
+	"index_type\x18\x06 \x01(\tR\tindexType\x12+\n" +
+	"\x11index_compression\x18\a \x01(\tR\x10indexCompression\x12!\n" +
+	"\fpq_subspaces\x18\b \x01(\rR\vpqSubspaces\x12%\n" +
+	"\x0eauto_normalize\x18\t \x01(\bR\rautoNormalize\"q\n" +
+	"\vHNSWOptions\x12\f\n" +
+	"\x01m\x18\x01 \x01(\rR\x01m\x12'\n" +
+	"\x0fef_construction\x18\x02 \x01(\rR\x0eefConstruction\x12\x1b\n" +
+	"\tef_search\x18\x03 \x01(\rR\befSearch\x12\x0e\n" +
+	"\x02ml\x18\x04 \x01(\x01R\x02ml\"-\n" +
 	"\x17DeleteCollectionRequest\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\"\x18\n" +
 	"\x16ListCollectionsRequest\".\n" +
@@ -2138,11 +3133,14 @@ const file_proto_waddle_protocol_proto_rawDesc = "" +
 	"\x0eCollectionList\x127\n" +
 	"\vcollections\x18\x01 \x03(\v2\x15.waddlemap.CollectionR\vcollections\"9\n" +
 	"\tBlockList\x12,\n" +
-	"\x06blocks\x18\x01 \x03(\v2\x14.waddlemap.BlockDataR\x06blocks\"Y\n" +
+	"\x06blocks\x18\x01 \x03(\v2\x14.waddlemap.BlockDataR\x06blocks\"\x94\x01\n" +
 	"\tBlockData\x12\x18\n" +
 	"\aprimary\x18\x01 \x01(\tR\aprimary\x12\x16\n" +
 	"\x06vector\x18\x02 \x03(\x02R\x06vector\x12\x1a\n" +
-	"\bkeywords\x18\x03 \x03(\tR\bkeywords\"r\n" +
+	"\bkeywords\x18\x03 \x03(\tR\bkeywords\x12\x1f\n" +
+	"\vttl_seconds\x18\x04 \x01(\x03R\n" +
+	"ttlSeconds\x12\x18\n" +
+	"\aversion\x18\x05 \x01(\x04R\aversion\"r\n" +
 	"\x12AppendBlockRequest\x12\x1e\n" +
 	"\n" +
 	"collection\x18\x01 \x01(\tR\n" +
@@ -2203,7 +3201,15 @@ const file_proto_waddle_protocol_proto_rawDesc = "" +
 	"collection\x12\x10\n" +
 	"\x03key\x18\x02 \x01(\tR\x03key\x12\x14\n" +
 	"\x05index\x18\x03 \x01(\rR\x05index\x12*\n" +
-	"\x05block\x18\x04 \x01(\v2\x14.waddlemap.BlockDataR\x05block\"\x8a\x01\n" +
+	"\x05block\x18\x04 \x01(\v2\x14.waddlemap.BlockDataR\x05block\"\xb7\x01\n" +
+	"\x16UpdateValueConditional\x12\x1e\n" +
+	"\n" +
+	"collection\x18\x01 \x01(\tR\n" +
+	"collection\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x14\n" +
+	"\x05index\x18\x03 \x01(\rR\x05index\x12)\n" +
+	"\x10expected_version\x18\x04 \x01(\x04R\x0fexpectedVersion\x12*\n" +
+	"\x05block\x18\x05 \x01(\v2\x14.waddlemap.BlockDataR\x05block\"\xad\x01\n" +
 	"\rSearchRequest\x12\x1e\n" +
 	"\n" +
 	"collection\x18\x01 \x01(\tR\n" +
@@ -2211,14 +3217,26 @@ const file_proto_waddle_protocol_proto_rawDesc = "" +
 	"\x05query\x18\x02 \x03(\x02R\x05query\x12\x13\n" +
 	"\x05top_k\x18\x03 \x01(\rR\x04topK\x12\x12\n" +
 	"\x04mode\x18\x04 \x01(\tR\x04mode\x12\x1a\n" +
-	"\bkeywords\x18\x05 \x03(\tR\bkeywords\"x\n" +
+	"\bkeywords\x18\x05 \x03(\tR\bkeywords\x12!\n" +
+	"\fmax_distance\x18\x06 \x01(\x02R\vmaxDistance\"\xce\x01\n" +
+	"\x14SearchVariantRequest\x12\x1e\n" +
+	"\n" +
+	"collection\x18\x01 \x01(\tR\n" +
+	"collection\x12\x14\n" +
+	"\x05query\x18\x02 \x03(\x02R\x05query\x12\x13\n" +
+	"\x05top_k\x18\x03 \x01(\rR\x04topK\x12\x12\n" +
+	"\x04mode\x18\x04 \x01(\tR\x04mode\x12\x1a\n" +
+	"\bkeywords\x18\x05 \x03(\tR\bkeywords\x12\x18\n" +
+	"\avariant\x18\x06 \x01(\tR\avariant\x12!\n" +
+	"\fmax_distance\x18\a \x01(\x02R\vmaxDistance\"\x9b\x01\n" +
 	"\x19SearchMoreLikeThisRequest\x12\x1e\n" +
 	"\n" +
 	"collection\x18\x01 \x01(\tR\n" +
 	"collection\x12\x10\n" +
 	"\x03key\x18\x02 \x01(\tR\x03key\x12\x14\n" +
 	"\x05index\x18\x03 \x01(\rR\x05index\x12\x13\n" +
-	"\x05top_k\x18\x04 \x01(\rR\x04topK\"q\n" +
+	"\x05top_k\x18\x04 \x01(\rR\x04topK\x12!\n" +
+	"\fexclude_self\x18\x05 \x01(\bR\vexcludeSelf\"q\n" +
 	"\x12SearchInKeyRequest\x12\x1e\n" +
 	"\n" +
 	"collection\x18\x01 \x01(\tR\n" +
@@ -2238,7 +3256,42 @@ const file_proto_waddle_protocol_proto_rawDesc = "" +
 	"\bdistance\x18\x03 \x01(\x02R\bdistance\x12*\n" +
 	"\x05block\x18\x04 \x01(\v2\x14.waddlemap.BlockDataR\x05block\"I\n" +
 	"\x10SearchResultList\x125\n" +
-	"\aresults\x18\x01 \x03(\v2\x1b.waddlemap.SearchResultItemR\aresults2O\n" +
+	"\aresults\x18\x01 \x03(\v2\x1b.waddlemap.SearchResultItemR\aresults\"H\n" +
+	"\x12BatchSearchRequest\x122\n" +
+	"\aqueries\x18\x01 \x03(\v2\x18.waddlemap.SearchRequestR\aqueries\"L\n" +
+	"\x13BatchSearchResponse\x125\n" +
+	"\aresults\x18\x01 \x03(\v2\x1b.waddlemap.SearchResultListR\aresults\"\x19\n" +
+	"\x17BeginTransactionRequest\"A\n" +
+	"\x18BeginTransactionResponse\x12%\n" +
+	"\x0etransaction_id\x18\x01 \x01(\tR\rtransactionId\"A\n" +
+	"\x18CommitTransactionRequest\x12%\n" +
+	"\x0etransaction_id\x18\x01 \x01(\tR\rtransactionId\"C\n" +
+	"\x1aRollbackTransactionRequest\x12%\n" +
+	"\x0etransaction_id\x18\x01 \x01(\tR\rtransactionId\"|\n" +
+	"\x10SubscribeRequest\x12'\n" +
+	"\x0fsubscription_id\x18\x01 \x01(\tR\x0esubscriptionId\x12\x1e\n" +
+	"\n" +
+	"collection\x18\x02 \x01(\tR\n" +
+	"collection\x12\x1f\n" +
+	"\vevent_types\x18\x03 \x03(\tR\n" +
+	"eventTypes\"\x81\x01\n" +
+	"\x05Event\x12'\n" +
+	"\x0fsubscription_id\x18\x01 \x01(\tR\x0esubscriptionId\x12\x1d\n" +
+	"\n" +
+	"event_type\x18\x02 \x01(\tR\teventType\x12\x1e\n" +
+	"\n" +
+	"collection\x18\x03 \x01(\tR\n" +
+	"collection\x12\x10\n" +
+	"\x03key\x18\x04 \x01(\tR\x03key*\xb4\x01\n" +
+	"\tErrorCode\x12\x1a\n" +
+	"\x16ERROR_CODE_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fUNAUTHORIZED\x10\x01\x12\r\n" +
+	"\tNOT_FOUND\x10\x02\x12\x14\n" +
+	"\x10INVALID_ARGUMENT\x10\x03\x12\x12\n" +
+	"\x0eALREADY_EXISTS\x10\x04\x12\x16\n" +
+	"\x12RESOURCE_EXHAUSTED\x10\x05\x12\x12\n" +
+	"\x0eDATA_CORRUPTED\x10\x06\x12\x14\n" +
+	"\x10VERSION_CONFLICT\x10\a2O\n" +
 	"\rWaddleService\x12>\n" +
 	"\aExecute\x12\x18.waddlemap.WaddleRequest\x1a\x19.waddlemap.WaddleResponseB\x11Z\x0fwaddlemap/protob\x06proto3"
 
@@ -2254,79 +3307,108 @@ func file_proto_waddle_protocol_proto_rawDescGZIP() []byte {
 	return file_proto_waddle_protocol_proto_rawDescData
 }
 
-var file_proto_waddle_protocol_proto_msgTypes = make([]protoimpl.MessageInfo, 29)
+var file_proto_waddle_protocol_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_waddle_protocol_proto_msgTypes = make([]protoimpl.MessageInfo, 40)
 var file_proto_waddle_protocol_proto_goTypes = []any{
-	(*WaddleRequest)(nil),             // 0: waddlemap.WaddleRequest
-	(*WaddleResponse)(nil),            // 1: waddlemap.WaddleResponse
-	(*KeyList)(nil),                   // 2: waddlemap.KeyList
-	(*CreateCollectionRequest)(nil),   // 3: waddlemap.CreateCollectionRequest
-	(*DeleteCollectionRequest)(nil),   // 4: waddlemap.DeleteCollectionRequest
-	(*ListCollectionsRequest)(nil),    // 5: waddlemap.ListCollectionsRequest
-	(*CompactCollectionRequest)(nil),  // 6: waddlemap.CompactCollectionRequest
-	(*SnapshotCollectionRequest)(nil), // 7: waddlemap.SnapshotCollectionRequest
-	(*Collection)(nil),                // 8: waddlemap.Collection
-	(*CollectionList)(nil),            // 9: waddlemap.CollectionList
-	(*BlockList)(nil),                 // 10: waddlemap.BlockList
-	(*BlockData)(nil),                 // 11: waddlemap.BlockData
-	(*AppendBlockRequest)(nil),        // 12: waddlemap.AppendBlockRequest
-	(*BatchAppendBlockRequest)(nil),   // 13: waddlemap.BatchAppendBlockRequest
-	(*GetBlockRequest)(nil),           // 14: waddlemap.GetBlockRequest
-	(*GetVectorRequest)(nil),          // 15: waddlemap.GetVectorRequest
-	(*GetKeyLengthRequest)(nil),       // 16: waddlemap.GetKeyLengthRequest
-	(*GetKeyRequest)(nil),             // 17: waddlemap.GetKeyRequest
-	(*DeleteKeyRequest)(nil),          // 18: waddlemap.DeleteKeyRequest
-	(*ListKeysRequest)(nil),           // 19: waddlemap.ListKeysRequest
-	(*ContainsKeyRequest)(nil),        // 20: waddlemap.ContainsKeyRequest
-	(*UpdateBlockRequest)(nil),        // 21: waddlemap.UpdateBlockRequest
-	(*ReplaceBlockRequest)(nil),       // 22: waddlemap.ReplaceBlockRequest
-	(*SearchRequest)(nil),             // 23: waddlemap.SearchRequest
-	(*SearchMoreLikeThisRequest)(nil), // 24: waddlemap.SearchMoreLikeThisRequest
-	(*SearchInKeyRequest)(nil),        // 25: waddlemap.SearchInKeyRequest
-	(*KeywordSearchRequest)(nil),      // 26: waddlemap.KeywordSearchRequest
-	(*SearchResultItem)(nil),          // 27: waddlemap.SearchResultItem
-	(*SearchResultList)(nil),          // 28: waddlemap.SearchResultList
+	(ErrorCode)(0),                     // 0: waddlemap.ErrorCode
+	(*WaddleRequest)(nil),              // 1: waddlemap.WaddleRequest
+	(*WaddleResponse)(nil),             // 2: waddlemap.WaddleResponse
+	(*KeyList)(nil),                    // 3: waddlemap.KeyList
+	(*CreateCollectionRequest)(nil),    // 4: waddlemap.CreateCollectionRequest
+	(*HNSWOptions)(nil),                // 5: waddlemap.HNSWOptions
+	(*DeleteCollectionRequest)(nil),    // 6: waddlemap.DeleteCollectionRequest
+	(*ListCollectionsRequest)(nil),     // 7: waddlemap.ListCollectionsRequest
+	(*CompactCollectionRequest)(nil),   // 8: waddlemap.CompactCollectionRequest
+	(*SnapshotCollectionRequest)(nil),  // 9: waddlemap.SnapshotCollectionRequest
+	(*Collection)(nil),                 // 10: waddlemap.Collection
+	(*CollectionList)(nil),             // 11: waddlemap.CollectionList
+	(*BlockList)(nil),                  // 12: waddlemap.BlockList
+	(*BlockData)(nil),                  // 13: waddlemap.BlockData
+	(*AppendBlockRequest)(nil),         // 14: waddlemap.AppendBlockRequest
+	(*BatchAppendBlockRequest)(nil),    // 15: waddlemap.BatchAppendBlockRequest
+	(*GetBlockRequest)(nil),            // 16: waddlemap.GetBlockRequest
+	(*GetVectorRequest)(nil),           // 17: waddlemap.GetVectorRequest
+	(*GetKeyLengthRequest)(nil),        // 18: waddlemap.GetKeyLengthRequest
+	(*GetKeyRequest)(nil),              // 19: waddlemap.GetKeyRequest
+	(*DeleteKeyRequest)(nil),           // 20: waddlemap.DeleteKeyRequest
+	(*ListKeysRequest)(nil),            // 21: waddlemap.ListKeysRequest
+	(*ContainsKeyRequest)(nil),         // 22: waddlemap.ContainsKeyRequest
+	(*UpdateBlockRequest)(nil),         // 23: waddlemap.UpdateBlockRequest
+	(*ReplaceBlockRequest)(nil),        // 24: waddlemap.ReplaceBlockRequest
+	(*UpdateValueConditional)(nil),     // 25: waddlemap.UpdateValueConditional
+	(*SearchRequest)(nil),              // 26: waddlemap.SearchRequest
+	(*SearchVariantRequest)(nil),       // 27: waddlemap.SearchVariantRequest
+	(*SearchMoreLikeThisRequest)(nil),  // 28: waddlemap.SearchMoreLikeThisRequest
+	(*SearchInKeyRequest)(nil),         // 29: waddlemap.SearchInKeyRequest
+	(*KeywordSearchRequest)(nil),       // 30: waddlemap.KeywordSearchRequest
+	(*SearchResultItem)(nil),           // 31: waddlemap.SearchResultItem
+	(*SearchResultList)(nil),           // 32: waddlemap.SearchResultList
+	(*BatchSearchRequest)(nil),         // 33: waddlemap.BatchSearchRequest
+	(*BatchSearchResponse)(nil),        // 34: waddlemap.BatchSearchResponse
+	(*BeginTransactionRequest)(nil),    // 35: waddlemap.BeginTransactionRequest
+	(*BeginTransactionResponse)(nil),   // 36: waddlemap.BeginTransactionResponse
+	(*CommitTransactionRequest)(nil),   // 37: waddlemap.CommitTransactionRequest
+	(*RollbackTransactionRequest)(nil), // 38: waddlemap.RollbackTransactionRequest
+	(*SubscribeRequest)(nil),           // 39: waddlemap.SubscribeRequest
+	(*Event)(nil),                      // 40: waddlemap.Event
 }
 var file_proto_waddle_protocol_proto_depIdxs = []int32{
-	3,  // 0: waddlemap.WaddleRequest.create_col:type_name -> waddlemap.CreateCollectionRequest
-	4,  // 1: waddlemap.WaddleRequest.delete_col:type_name -> waddlemap.DeleteCollectionRequest
-	5,  // 2: waddlemap.WaddleRequest.list_cols:type_name -> waddlemap.ListCollectionsRequest
-	6,  // 3: waddlemap.WaddleRequest.compact_col:type_name -> waddlemap.CompactCollectionRequest
-	12, // 4: waddlemap.WaddleRequest.append_block:type_name -> waddlemap.AppendBlockRequest
-	14, // 5: waddlemap.WaddleRequest.get_block:type_name -> waddlemap.GetBlockRequest
-	15, // 6: waddlemap.WaddleRequest.get_vector:type_name -> waddlemap.GetVectorRequest
-	16, // 7: waddlemap.WaddleRequest.get_key_len:type_name -> waddlemap.GetKeyLengthRequest
-	17, // 8: waddlemap.WaddleRequest.get_key:type_name -> waddlemap.GetKeyRequest
-	18, // 9: waddlemap.WaddleRequest.delete_key:type_name -> waddlemap.DeleteKeyRequest
-	19, // 10: waddlemap.WaddleRequest.list_keys:type_name -> waddlemap.ListKeysRequest
-	20, // 11: waddlemap.WaddleRequest.contains_key:type_name -> waddlemap.ContainsKeyRequest
-	21, // 12: waddlemap.WaddleRequest.update_block:type_name -> waddlemap.UpdateBlockRequest
-	22, // 13: waddlemap.WaddleRequest.replace_block:type_name -> waddlemap.ReplaceBlockRequest
-	23, // 14: waddlemap.WaddleRequest.search:type_name -> waddlemap.SearchRequest
-	24, // 15: waddlemap.WaddleRequest.search_mlt:type_name -> waddlemap.SearchMoreLikeThisRequest
-	25, // 16: waddlemap.WaddleRequest.search_in_key:type_name -> waddlemap.SearchInKeyRequest
-	26, // 17: waddlemap.WaddleRequest.keyword_search:type_name -> waddlemap.KeywordSearchRequest
-	7,  // 18: waddlemap.WaddleRequest.snapshot_col:type_name -> waddlemap.SnapshotCollectionRequest
-	13, // 19: waddlemap.WaddleRequest.batch_append:type_name -> waddlemap.BatchAppendBlockRequest
-	2,  // 20: waddlemap.WaddleResponse.key_list:type_name -> waddlemap.KeyList
-	9,  // 21: waddlemap.WaddleResponse.col_list:type_name -> waddlemap.CollectionList
-	28, // 22: waddlemap.WaddleResponse.search_list:type_name -> waddlemap.SearchResultList
-	11, // 23: waddlemap.WaddleResponse.block:type_name -> waddlemap.BlockData
-	10, // 24: waddlemap.WaddleResponse.block_list:type_name -> waddlemap.BlockList
-	8,  // 25: waddlemap.CollectionList.collections:type_name -> waddlemap.Collection
-	11, // 26: waddlemap.BlockList.blocks:type_name -> waddlemap.BlockData
-	11, // 27: waddlemap.AppendBlockRequest.block:type_name -> waddlemap.BlockData
-	12, // 28: waddlemap.BatchAppendBlockRequest.requests:type_name -> waddlemap.AppendBlockRequest
-	11, // 29: waddlemap.UpdateBlockRequest.block:type_name -> waddlemap.BlockData
-	11, // 30: waddlemap.ReplaceBlockRequest.block:type_name -> waddlemap.BlockData
-	11, // 31: waddlemap.SearchResultItem.block:type_name -> waddlemap.BlockData
-	27, // 32: waddlemap.SearchResultList.results:type_name -> waddlemap.SearchResultItem
-	0,  // 33: waddlemap.WaddleService.Execute:input_type -> waddlemap.WaddleRequest
-	1,  // 34: waddlemap.WaddleService.Execute:output_type -> waddlemap.WaddleResponse
-	34, // [34:35] is the sub-list for method output_type
-	33, // [33:34] is the sub-list for method input_type
-	33, // [33:33] is the sub-list for extension type_name
-	33, // [33:33] is the sub-list for extension extendee
-	0,  // [0:33] is the sub-list for field type_name
+	4,  // 0: waddlemap.WaddleRequest.create_col:type_name -> waddlemap.CreateCollectionRequest
+	6,  // 1: waddlemap.WaddleRequest.delete_col:type_name -> waddlemap.DeleteCollectionRequest
+	7,  // 2: waddlemap.WaddleRequest.list_cols:type_name -> waddlemap.ListCollectionsRequest
+	8,  // 3: waddlemap.WaddleRequest.compact_col:type_name -> waddlemap.CompactCollectionRequest
+	14, // 4: waddlemap.WaddleRequest.append_block:type_name -> waddlemap.AppendBlockRequest
+	16, // 5: waddlemap.WaddleRequest.get_block:type_name -> waddlemap.GetBlockRequest
+	17, // 6: waddlemap.WaddleRequest.get_vector:type_name -> waddlemap.GetVectorRequest
+	18, // 7: waddlemap.WaddleRequest.get_key_len:type_name -> waddlemap.GetKeyLengthRequest
+	19, // 8: waddlemap.WaddleRequest.get_key:type_name -> waddlemap.GetKeyRequest
+	20, // 9: waddlemap.WaddleRequest.delete_key:type_name -> waddlemap.DeleteKeyRequest
+	21, // 10: waddlemap.WaddleRequest.list_keys:type_name -> waddlemap.ListKeysRequest
+	22, // 11: waddlemap.WaddleRequest.contains_key:type_name -> waddlemap.ContainsKeyRequest
+	23, // 12: waddlemap.WaddleRequest.update_block:type_name -> waddlemap.UpdateBlockRequest
+	24, // 13: waddlemap.WaddleRequest.replace_block:type_name -> waddlemap.ReplaceBlockRequest
+	26, // 14: waddlemap.WaddleRequest.search:type_name -> waddlemap.SearchRequest
+	28, // 15: waddlemap.WaddleRequest.search_mlt:type_name -> waddlemap.SearchMoreLikeThisRequest
+	29, // 16: waddlemap.WaddleRequest.search_in_key:type_name -> waddlemap.SearchInKeyRequest
+	30, // 17: waddlemap.WaddleRequest.keyword_search:type_name -> waddlemap.KeywordSearchRequest
+	9,  // 18: waddlemap.WaddleRequest.snapshot_col:type_name -> waddlemap.SnapshotCollectionRequest
+	15, // 19: waddlemap.WaddleRequest.batch_append:type_name -> waddlemap.BatchAppendBlockRequest
+	27, // 20: waddlemap.WaddleRequest.search_variant:type_name -> waddlemap.SearchVariantRequest
+	39, // 21: waddlemap.WaddleRequest.subscribe:type_name -> waddlemap.SubscribeRequest
+	33, // 22: waddlemap.WaddleRequest.batch_search:type_name -> waddlemap.BatchSearchRequest
+	35, // 23: waddlemap.WaddleRequest.begin_tx:type_name -> waddlemap.BeginTransactionRequest
+	37, // 24: waddlemap.WaddleRequest.commit_tx:type_name -> waddlemap.CommitTransactionRequest
+	38, // 25: waddlemap.WaddleRequest.rollback_tx:type_name -> waddlemap.RollbackTransactionRequest
+	25, // 26: waddlemap.WaddleRequest.update_conditional:type_name -> waddlemap.UpdateValueConditional
+	0,  // 27: waddlemap.WaddleResponse.error_code:type_name -> waddlemap.ErrorCode
+	3,  // 28: waddlemap.WaddleResponse.key_list:type_name -> waddlemap.KeyList
+	11, // 29: waddlemap.WaddleResponse.col_list:type_name -> waddlemap.CollectionList
+	32, // 30: waddlemap.WaddleResponse.search_list:type_name -> waddlemap.SearchResultList
+	13, // 31: waddlemap.WaddleResponse.block:type_name -> waddlemap.BlockData
+	12, // 32: waddlemap.WaddleResponse.block_list:type_name -> waddlemap.BlockList
+	40, // 33: waddlemap.WaddleResponse.event:type_name -> waddlemap.Event
+	34, // 34: waddlemap.WaddleResponse.batch_search:type_name -> waddlemap.BatchSearchResponse
+	36, // 35: waddlemap.WaddleResponse.transaction:type_name -> waddlemap.BeginTransactionResponse
+	5,  // 36: waddlemap.CreateCollectionRequest.secondary_hnsw:type_name -> waddlemap.HNSWOptions
+	5,  // 37: waddlemap.CreateCollectionRequest.hnsw:type_name -> waddlemap.HNSWOptions
+	10, // 38: waddlemap.CollectionList.collections:type_name -> waddlemap.Collection
+	13, // 39: waddlemap.BlockList.blocks:type_name -> waddlemap.BlockData
+	13, // 40: waddlemap.AppendBlockRequest.block:type_name -> waddlemap.BlockData
+	14, // 41: waddlemap.BatchAppendBlockRequest.requests:type_name -> waddlemap.AppendBlockRequest
+	13, // 42: waddlemap.UpdateBlockRequest.block:type_name -> waddlemap.BlockData
+	13, // 43: waddlemap.ReplaceBlockRequest.block:type_name -> waddlemap.BlockData
+	13, // 44: waddlemap.UpdateValueConditional.block:type_name -> waddlemap.BlockData
+	13, // 45: waddlemap.SearchResultItem.block:type_name -> waddlemap.BlockData
+	31, // 46: waddlemap.SearchResultList.results:type_name -> waddlemap.SearchResultItem
+	26, // 47: waddlemap.BatchSearchRequest.queries:type_name -> waddlemap.SearchRequest
+	32, // 48: waddlemap.BatchSearchResponse.results:type_name -> waddlemap.SearchResultList
+	1,  // 49: waddlemap.WaddleService.Execute:input_type -> waddlemap.WaddleRequest
+	2,  // 50: waddlemap.WaddleService.Execute:output_type -> waddlemap.WaddleResponse
+	50, // [50:51] is the sub-list for method output_type
+	49, // [49:50] is the sub-list for method input_type
+	49, // [49:49] is the sub-list for extension type_name
+	49, // [49:49] is the sub-list for extension extendee
+	0,  // [0:49] is the sub-list for field type_name
 }
 
 func init() { file_proto_waddle_protocol_proto_init() }
@@ -2355,6 +3437,13 @@ func file_proto_waddle_protocol_proto_init() {
 		(*WaddleRequest_KeywordSearch)(nil),
 		(*WaddleRequest_SnapshotCol)(nil),
 		(*WaddleRequest_BatchAppend)(nil),
+		(*WaddleRequest_SearchVariant)(nil),
+		(*WaddleRequest_Subscribe)(nil),
+		(*WaddleRequest_BatchSearch)(nil),
+		(*WaddleRequest_BeginTx)(nil),
+		(*WaddleRequest_CommitTx)(nil),
+		(*WaddleRequest_RollbackTx)(nil),
+		(*WaddleRequest_UpdateConditional)(nil),
 	}
 	file_proto_waddle_protocol_proto_msgTypes[1].OneofWrappers = []any{
 		(*WaddleResponse_Length)(nil),
@@ -2363,19 +3452,23 @@ func file_proto_waddle_protocol_proto_init() {
 		(*WaddleResponse_SearchList)(nil),
 		(*WaddleResponse_Block)(nil),
 		(*WaddleResponse_BlockList)(nil),
+		(*WaddleResponse_Event)(nil),
+		(*WaddleResponse_BatchSearch)(nil),
+		(*WaddleResponse_Transaction)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_waddle_protocol_proto_rawDesc), len(file_proto_waddle_protocol_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   29,
+			NumEnums:      1,
+			NumMessages:   40,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_proto_waddle_protocol_proto_goTypes,
 		DependencyIndexes: file_proto_waddle_protocol_proto_depIdxs,
+		EnumInfos:         file_proto_waddle_protocol_proto_enumTypes,
 		MessageInfos:      file_proto_waddle_protocol_proto_msgTypes,
 	}.Build()
 	File_proto_waddle_protocol_proto = out.File